@@ -0,0 +1,34 @@
+package main
+
+//
+// Capturing packets while measuring
+//
+
+import (
+	"filippo.io/age"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/pcapx"
+)
+
+// newCapturerMaybe returns a packet capturer when the user asked us to capture
+// packets and we can capture packets, and nil otherwise. Failing to capture is
+// not fatal because we can still measure without capturing packets.
+func newCapturerMaybe(currentOptions *Options, recipients []age.Recipient, logger model.Logger) *pcapx.Capturer {
+	if !currentOptions.Capture {
+		return nil
+	}
+	if currentOptions.NoJSON {
+		logger.Warnf("capture: not capturing packets because we're not writing the report file")
+		return nil
+	}
+	if len(recipients) > 0 {
+		logger.Warnf("capture: not capturing packets because we would save them unencrypted")
+		return nil
+	}
+	source, err := pcapx.NewSystemSource()
+	if err != nil {
+		logger.Warnf("capture: cannot capture packets: %s", err.Error())
+		return nil
+	}
+	return pcapx.NewCapturer(source, logger)
+}
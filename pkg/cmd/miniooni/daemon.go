@@ -0,0 +1,150 @@
+package main
+
+//
+// Running experiments periodically according to a schedule
+//
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/ooni/probe-engine/pkg/schedule"
+	"github.com/spf13/cobra"
+)
+
+// daemonOptions contains the options for the daemon subcommand.
+type daemonOptions struct {
+	networkType     string
+	networkTypeFile string
+	scheduleFile    string
+}
+
+// registerDaemon registers the daemon subcommand.
+func registerDaemon(rootCmd *cobra.Command, globalOptions *Options) {
+	options := &daemonOptions{}
+	subCmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Runs experiments periodically according to a schedule file",
+		Long: `Runs experiments periodically according to a schedule file.
+
+The schedule file is a JSON document like the following:
+
+    {"entries": [{
+      "experiment": "web_connectivity",
+      "inputs": ["https://www.example.com/"],
+      "options": {},
+      "max_runtime": "5m",
+      "interval": "6h",
+      "jitter": "30m",
+      "poisson": false,
+      "windows": [{"start": "22:00", "end": "06:00"}],
+      "network_types": ["wifi", "wired"],
+      "feature_flag": ""
+    }]}
+
+where only "experiment" and "interval" are mandatory. With "poisson", the
+start times are Poisson distributed with mean "interval". We only run when
+the local time is inside the "windows", the network type (see --network-type)
+is one of the "network_types", and "feature_flag" is enabled by check-in.
+
+We save the last run times into the $HOME/.miniooni directory, such that we
+do not run all the experiments when restarting, and we stop on SIGTERM.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			daemonMain(globalOptions, options)
+		},
+	}
+	rootCmd.AddCommand(subCmd)
+	flags := subCmd.Flags()
+	flags.StringVar(
+		&options.networkType,
+		"network-type",
+		"",
+		"the type of the network we're using (e.g., \"wifi\", \"mobile\", \"wired\")",
+	)
+	flags.StringVar(
+		&options.networkTypeFile,
+		"network-type-file",
+		"",
+		"file we read before each run containing the type of network (overrides --network-type)",
+	)
+	flags.StringVar(
+		&options.scheduleFile,
+		"schedule",
+		"",
+		"path of the schedule file (default: $HOME/.miniooni/schedule.json)",
+	)
+}
+
+// daemonMain runs the daemon until we receive SIGINT or SIGTERM.
+func daemonMain(currentOptions *Options, options *daemonOptions) {
+	logger := configureOrPanic(currentOptions)
+	miniooniDir := getMiniooniDirOrPanic(currentOptions)
+	if options.scheduleFile == "" {
+		options.scheduleFile = filepath.Join(miniooniDir, "schedule.json")
+	}
+	file, err := schedule.Load(options.scheduleFile)
+	runtimex.PanicOnError(err, "cannot load the schedule file")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sched := schedule.NewScheduler(&schedule.SchedulerConfig{
+		File:    file,
+		KVStore: newKVStoreOrPanic(miniooniDir),
+		Logger:  logger,
+		NetworkType: func() string {
+			return daemonNetworkType(options)
+		},
+		Runner: func(ctx context.Context, entry *schedule.Entry) error {
+			return daemonRunEntry(ctx, currentOptions, entry)
+		},
+	})
+	log.Infof("daemon: running %d schedule entries; use Ctrl-C or SIGTERM to stop", len(file.Entries))
+	sched.Run(ctx)
+	log.Info("daemon: shutting down")
+}
+
+// daemonNetworkType returns the current network type.
+func daemonNetworkType(options *daemonOptions) string {
+	if options.networkTypeFile == "" {
+		return options.networkType
+	}
+	data, err := os.ReadFile(options.networkTypeFile) // #nosec G304 - this is working as intended
+	if err != nil {
+		log.Warnf("daemon: cannot read the network type: %s", err.Error())
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// daemonRunEntry runs the experiment described by the given schedule entry.
+func daemonRunEntry(ctx context.Context, currentOptions *Options, entry *schedule.Entry) (err error) {
+	extraOptions, err := entry.ExtraOptions()
+	if err != nil {
+		return err
+	}
+	options := *currentOptions
+	options.ExtraOptions = extraOptions
+	options.InputFilePaths = nil
+	options.Inputs = entry.Inputs
+	options.MaxRuntime = int64(time.Duration(entry.MaxRuntime) / time.Second)
+	options.RepeatEvery = 0
+
+	// We convert panics into errors because we should keep running
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%+v", r)
+		}
+	}()
+	mainSingleIteration(ctx, log.Log, entry.Experiment, &options)
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+//
+// Encrypting measurements at rest
+//
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/fsx"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/msmtcrypt"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/spf13/cobra"
+)
+
+// encryptionRecipientsFile is the file inside the miniooni directory containing
+// the recipients for whom we always encrypt the measurements, one per line.
+const encryptionRecipientsFile = "recipients.txt"
+
+// encryptionPassphraseEnv is the environment variable containing the
+// passphrase protecting the probe identity, if any.
+const encryptionPassphraseEnv = "MINIOONI_PASSPHRASE"
+
+// encryptionDecryptOptions contains the options for the encryption decrypt subcommand.
+type encryptionDecryptOptions struct {
+	identityFiles []string
+}
+
+// registerEncryption registers the encryption subcommand.
+func registerEncryption(rootCmd *cobra.Command, globalOptions *Options) {
+	encryptionCmd := &cobra.Command{
+		Use:   "encryption",
+		Short: "Manages the key for encrypting measurements and decrypts reports",
+		Long: `Manages the key for encrypting measurements and decrypts reports.
+
+We encrypt the measurements saved to disk when you use --encrypt, which
+encrypts for the probe's own key, when you use --encrypt-to, and when the
+$HOME/.miniooni/` + encryptionRecipientsFile + ` file contains recipients.
+
+If you protect the probe's own key using a passphrase, set the ` + encryptionPassphraseEnv + `
+environment variable when you need to decrypt. We don't need the passphrase
+for encrypting measurements.`,
+		Args: cobra.NoArgs,
+	}
+	rootCmd.AddCommand(encryptionCmd)
+
+	encryptionCmd.AddCommand(&cobra.Command{
+		Use:   "recipient",
+		Short: "Prints the age recipient of the probe's own key",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			encryptionRecipientMain(globalOptions)
+		},
+	})
+
+	encryptionCmd.AddCommand(&cobra.Command{
+		Use:   "passphrase",
+		Short: "Changes the passphrase protecting the probe's own key",
+		Long: `Changes the passphrase protecting the probe's own key.
+
+We read the new passphrase from the first line of the standard input and the
+current passphrase, if any, from the ` + encryptionPassphraseEnv + ` environment variable.
+Use an empty new passphrase to remove the protection.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			encryptionPassphraseMain(globalOptions, os.Stdin)
+		},
+	})
+
+	options := &encryptionDecryptOptions{}
+	decryptCmd := &cobra.Command{
+		Use:   "decrypt REPORT_FILE...",
+		Short: "Writes the decrypted measurements to the standard output",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			encryptionDecryptMain(globalOptions, options, args)
+		},
+	}
+	encryptionCmd.AddCommand(decryptCmd)
+	decryptCmd.Flags().StringSliceVar(
+		&options.identityFiles,
+		"identity",
+		[]string{},
+		"also decrypt using the identities in the given file (can be repeated multiple times)",
+	)
+}
+
+// newRecipientsOrPanic returns the recipients for whom we should encrypt
+// the measurements, which is empty when we should not encrypt.
+func newRecipientsOrPanic(
+	miniooniDir string, kvStore model.KeyValueStore, currentOptions *Options) []age.Recipient {
+	values := append([]string{}, currentOptions.EncryptTo...)
+	if filePath := filepath.Join(miniooniDir, encryptionRecipientsFile); fsx.RegularFileExists(filePath) {
+		values = append(values, filePath)
+	}
+	recipients, err := msmtcrypt.ParseRecipients(values...)
+	runtimex.PanicOnError(err, "cannot parse the encryption recipients")
+	if currentOptions.Encrypt {
+		recipient, err := msmtcrypt.LoadOrCreateRecipient(kvStore)
+		runtimex.PanicOnError(err, "cannot load the encryption key")
+		recipients = append(recipients, recipient)
+	}
+	return recipients
+}
+
+// loadIdentities loads the identities in the given files plus the probe's own
+// identity. We only fail to load the latter when there are no other identities.
+func loadIdentities(kvStore model.KeyValueStore, identityFiles []string) ([]age.Identity, error) {
+	var out []age.Identity
+	for _, filePath := range identityFiles {
+		identities, err := msmtcrypt.ParseIdentitiesFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, identities...)
+	}
+	identity, err := msmtcrypt.LoadOrCreateIdentity(kvStore, os.Getenv(encryptionPassphraseEnv))
+	if err != nil {
+		if len(out) <= 0 {
+			return nil, err
+		}
+		log.Warnf("cannot load the probe's own key: %s", err.Error())
+		return out, nil
+	}
+	return append(out, identity), nil
+}
+
+// measurementDecrypter decrypts measurement files. We load the probe's own identity
+// on demand, such that we only need the passphrase for encrypted measurements.
+type measurementDecrypter struct {
+	err        error
+	identities []age.Identity
+	kvStore    model.KeyValueStore
+	once       sync.Once
+}
+
+// newMeasurementDecrypter creates a new [*measurementDecrypter].
+func newMeasurementDecrypter(kvStore model.KeyValueStore) *measurementDecrypter {
+	return &measurementDecrypter{kvStore: kvStore}
+}
+
+// decrypt decrypts the given measurement file content, if needed.
+func (md *measurementDecrypter) decrypt(data []byte) ([]byte, error) {
+	if !msmtcrypt.IsEncrypted(data) {
+		return data, nil
+	}
+	md.once.Do(func() {
+		md.identities, md.err = loadIdentities(md.kvStore, nil)
+	})
+	if md.err != nil {
+		return nil, md.err
+	}
+	return msmtcrypt.DecryptLine(data, md.identities...)
+}
+
+// readFile reads and possibly decrypts the given measurement file.
+func (md *measurementDecrypter) readFile(filePath string) ([]byte, error) {
+	data, err := os.ReadFile(filePath) // #nosec G304 - this is working as intended
+	if err != nil {
+		return nil, err
+	}
+	return md.decrypt(data)
+}
+
+// encryptionRecipientMain prints the recipient of the probe's own key.
+func encryptionRecipientMain(currentOptions *Options) {
+	miniooniDir := getMiniooniDirOrPanic(currentOptions)
+	recipient, err := msmtcrypt.LoadOrCreateRecipient(newKVStoreOrPanic(miniooniDir))
+	runtimex.PanicOnError(err, "cannot load the encryption key")
+	fmt.Println(recipient.String())
+}
+
+// encryptionPassphraseMain changes the passphrase protecting the probe's own key.
+func encryptionPassphraseMain(currentOptions *Options, stdin io.Reader) {
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		runtimex.PanicOnError(err, "cannot read the new passphrase")
+	}
+	newPassphrase := strings.TrimRight(line, "\r\n")
+	miniooniDir := getMiniooniDirOrPanic(currentOptions)
+	err = msmtcrypt.SetPassphrase(
+		newKVStoreOrPanic(miniooniDir), os.Getenv(encryptionPassphraseEnv), newPassphrase)
+	runtimex.PanicOnError(err, "cannot change the passphrase")
+	if newPassphrase == "" {
+		log.Info("the probe's own key is not passphrase protected")
+		return
+	}
+	log.Info("the probe's own key is passphrase protected")
+}
+
+// encryptionDecryptMain decrypts the given report files.
+func encryptionDecryptMain(
+	currentOptions *Options, options *encryptionDecryptOptions, reportFiles []string) {
+	miniooniDir := getMiniooniDirOrPanic(currentOptions)
+	identities, err := loadIdentities(newKVStoreOrPanic(miniooniDir), options.identityFiles)
+	runtimex.PanicOnError(err, "cannot load the decryption keys")
+	for _, filename := range reportFiles {
+		filep, err := os.Open(filename) // #nosec G304 - this is working as intended
+		runtimex.PanicOnError(err, "cannot open the report file")
+		_, err = io.Copy(os.Stdout, msmtcrypt.NewReader(filep, identities...))
+		filep.Close()
+		runtimex.PanicOnError(err, "cannot decrypt "+filename)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+//
+// Exporting measurements to CSV and HAR
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/exporter"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/ooni/probe-engine/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+// exportOptions contains the options for the export subcommand.
+type exportOptions struct {
+	format string
+	output string
+}
+
+// registerExport registers the export subcommand.
+func registerExport(rootCmd *cobra.Command) {
+	options := &exportOptions{}
+	subCmd := &cobra.Command{
+		Use:   "export REPORT_FILE...",
+		Short: "Exports measurements to CSV tables or to HAR 1.2",
+		Long: `Exports the measurements inside the given JSONL report files.
+
+With --format=csv, we create a directory containing a CSV file for each
+observation type (DNS lookups, TCP connects, TLS and QUIC handshakes,
+and HTTP requests). With --format=har, we create a HAR 1.2 file containing
+the HTTP requests, which you can open using the browser developer tools.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			exportMain(options, args)
+		},
+	}
+	rootCmd.AddCommand(subCmd)
+	flags := subCmd.Flags()
+	flags.StringVar(
+		&options.format,
+		"format",
+		"csv",
+		"export format (one of: \"csv\" and \"har\")",
+	)
+	flags.StringVar(
+		&options.output,
+		"output",
+		"",
+		"output directory for --format=csv or output file for --format=har (default: \"export\" or \"export.har\")",
+	)
+}
+
+// exportMain exports the given report files.
+func exportMain(options *exportOptions, reportFiles []string) {
+	var (
+		export func(rec *exporter.Record) error
+		finish func()
+	)
+	switch options.format {
+	case "csv":
+		if options.output == "" {
+			options.output = "export"
+		}
+		exp, err := exporter.NewCSVExporter(options.output)
+		runtimex.PanicOnError(err, "cannot create the CSV files")
+		export = exp.Export
+		finish = func() {
+			runtimex.PanicOnError(exp.Close(), "cannot write the CSV files")
+		}
+	case "har":
+		if options.output == "" {
+			options.output = "export.har"
+		}
+		har := exporter.NewHAR("miniooni", version.Version)
+		export = func(rec *exporter.Record) error {
+			har.AddRecord(rec)
+			return nil
+		}
+		finish = func() {
+			data, err := json.MarshalIndent(har, "", "  ")
+			runtimex.PanicOnError(err, "json.MarshalIndent unexpectedly failed")
+			err = os.WriteFile(options.output, data, 0600)
+			runtimex.PanicOnError(err, "cannot write the HAR file")
+		}
+	default:
+		panic(fmt.Sprintf("unsupported export format: %s", options.format))
+	}
+
+	var count int
+	for _, filename := range reportFiles {
+		filep, err := os.Open(filename) // #nosec G304 - this is working as intended
+		runtimex.PanicOnError(err, "cannot open the report file")
+		err = exporter.ReadRecords(filep, func(rec *exporter.Record) error {
+			count++
+			return export(rec)
+		})
+		filep.Close()
+		runtimex.PanicOnError(err, fmt.Sprintf("cannot export %s", filename))
+	}
+	finish()
+	log.Infof("exported %d measurements to %s", count, options.output)
+}
@@ -0,0 +1,334 @@
+package main
+
+//
+// History of results and measurements saved into the database
+//
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"filippo.io/age"
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/database"
+	"github.com/ooni/probe-engine/pkg/engine"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/msmtcrypt"
+	"github.com/ooni/probe-engine/pkg/oonirun"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/spf13/cobra"
+)
+
+// historyUploadCommand is the pseudo experiment name we pass to
+// MainWithConfiguration to upload the measurements in the database.
+const historyUploadCommand = "upload"
+
+// registerHistory registers the list, show, rm, and upload subcommands.
+func registerHistory(rootCmd *cobra.Command, globalOptions *Options) {
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the results saved into the database grouped by network",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			historyListMain(globalOptions)
+		},
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "show RESULT_ID [MEASUREMENT_ID]",
+		Short: "Shows the measurements of a result or the JSON of a measurement",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			ids := mustParseHistoryIDs(args)
+			if len(ids) > 1 {
+				historyShowMeasurementMain(globalOptions, ids[0], ids[1])
+				return
+			}
+			historyShowResultMain(globalOptions, ids[0])
+		},
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "rm RESULT_ID...",
+		Short: "Removes results and their measurements from the database",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			historyRemoveMain(globalOptions, mustParseHistoryIDs(args))
+		},
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "upload [RESULT_ID...]",
+		Short: "Uploads the measurements that are not uploaded yet (default: from all results)",
+		Args:  cobra.ArbitraryArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			globalOptions.ResultIDs = mustParseHistoryIDs(args)
+			MainWithConfiguration(historyUploadCommand, globalOptions)
+		},
+	})
+}
+
+// mustParseHistoryIDs parses the result and measurement IDs passed on the command line.
+func mustParseHistoryIDs(args []string) (ids []int64) {
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		runtimex.PanicOnError(err, "cannot parse result or measurement ID")
+		ids = append(ids, id)
+	}
+	return
+}
+
+// openDatabaseOrPanic opens the database inside the miniooni directory or panics.
+func openDatabaseOrPanic(miniooniDir string) *database.Database {
+	dbDir := filepath.Join(miniooniDir, "db")
+	err := os.MkdirAll(dbDir, 0700)
+	runtimex.PanicOnError(err, "cannot create $HOME/.miniooni/db directory")
+	db, err := database.Open(filepath.Join(dbDir, "main.sqlite3"))
+	runtimex.PanicOnError(err, "cannot open the database")
+	decrypter := newMeasurementDecrypter(newKVStoreOrPanic(miniooniDir))
+	db.SetMeasurementFileReader(decrypter.readFile)
+	return db
+}
+
+// newResultsDatabaseOrPanic opens the database and registers the network we're
+// measuring. The caller is responsible for closing the database.
+func newResultsDatabaseOrPanic(miniooniDir string, sess *engine.Session,
+	recipients []age.Recipient) (*database.Database, *oonirun.ResultsDatabase) {
+	db := openDatabaseOrPanic(miniooniDir)
+	network, err := db.CreateNetwork(sess)
+	runtimex.PanicOnError(err, "cannot save the network into the database")
+	config := &oonirun.ResultsDatabase{
+		Database:   db,
+		HomeDir:    miniooniDir,
+		NetworkID:  network.ID,
+		Recipients: recipients,
+	}
+	return db, config
+}
+
+// historyListMain lists the results grouped by network.
+func historyListMain(currentOptions *Options) {
+	db := openDatabaseOrPanic(getMiniooniDirOrPanic(currentOptions))
+	defer db.Close()
+	done, incomplete, err := db.ListResults()
+	runtimex.PanicOnError(err, "cannot list results")
+	results := append(done, incomplete...)
+	if len(results) <= 0 {
+		fmt.Printf("no results in the database\n")
+		return
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].StartTime.Before(results[j].StartTime)
+	})
+
+	var networks []int64
+	byNetwork := make(map[int64][]model.DatabaseResultNetwork)
+	for _, result := range results {
+		if _, found := byNetwork[result.NetworkID]; !found {
+			networks = append(networks, result.NetworkID)
+		}
+		byNetwork[result.NetworkID] = append(byNetwork[result.NetworkID], result)
+	}
+
+	for _, networkID := range networks {
+		entries := byNetwork[networkID]
+		fmt.Printf("AS%d (%s), %s\n", entries[0].ASN, entries[0].NetworkName, entries[0].DatabaseNetwork.CountryCode)
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(tw, "ID\tTEST GROUP\tSTART TIME\tDONE\tMEASUREMENTS\tUPLOADED\tANOMALIES\tFAILURES\n")
+		for _, entry := range entries {
+			measurements, err := db.ListMeasurements(entry.DatabaseResult.ID)
+			runtimex.PanicOnError(err, "cannot list measurements")
+			var failures, uploaded int
+			for _, msmt := range measurements {
+				if msmt.IsFailed {
+					failures++
+				}
+				if msmt.DatabaseMeasurement.IsUploaded {
+					uploaded++
+				}
+			}
+			fmt.Fprintf(
+				tw, "%d\t%s\t%s\t%t\t%d\t%d\t%d\t%d\n",
+				entry.DatabaseResult.ID,
+				entry.TestGroupName,
+				entry.StartTime.UTC().Format(time.RFC3339),
+				entry.DatabaseResult.IsDone,
+				entry.TotalCount,
+				uploaded,
+				entry.AnomalyCount,
+				failures,
+			)
+		}
+		tw.Flush()
+		fmt.Printf("\n")
+	}
+}
+
+// historyShowResultMain shows the measurements belonging to a result.
+func historyShowResultMain(currentOptions *Options, resultID int64) {
+	db := openDatabaseOrPanic(getMiniooniDirOrPanic(currentOptions))
+	defer db.Close()
+	measurements, err := db.ListMeasurements(resultID)
+	runtimex.PanicOnError(err, "cannot list measurements")
+	if len(measurements) <= 0 {
+		fmt.Printf("no measurements for result %d\n", resultID)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\tTEST NAME\tINPUT\tANOMALY\tFAILED\tUPLOADED\tREPORT ID\n")
+	for _, msmt := range measurements {
+		fmt.Fprintf(
+			tw, "%d\t%s\t%s\t%s\t%t\t%t\t%s\n",
+			msmt.DatabaseMeasurement.ID,
+			msmt.TestName,
+			msmt.URL.String,
+			historyFormatNullBool(msmt.IsAnomaly),
+			msmt.IsFailed,
+			msmt.DatabaseMeasurement.IsUploaded,
+			msmt.ReportID.String,
+		)
+	}
+	tw.Flush()
+}
+
+// historyFormatNullBool formats a nullable boolean for humans.
+func historyFormatNullBool(value sql.NullBool) string {
+	if !value.Valid {
+		return "-"
+	}
+	return strconv.FormatBool(value.Bool)
+}
+
+// historyShowMeasurementMain prints the JSON of a measurement belonging to a result.
+func historyShowMeasurementMain(currentOptions *Options, resultID, measurementID int64) {
+	db := openDatabaseOrPanic(getMiniooniDirOrPanic(currentOptions))
+	defer db.Close()
+	measurements, err := db.ListMeasurements(resultID)
+	runtimex.PanicOnError(err, "cannot list measurements")
+	var found bool
+	for _, msmt := range measurements {
+		found = found || msmt.DatabaseMeasurement.ID == measurementID
+	}
+	runtimex.Assert(found, "no such measurement in the given result")
+	msmtJSON, err := db.GetMeasurementJSON(measurementID)
+	runtimex.PanicOnError(err, "cannot read the measurement")
+	data, err := json.MarshalIndent(msmtJSON, "", "  ")
+	runtimex.PanicOnError(err, "json.MarshalIndent unexpectedly failed")
+	fmt.Printf("%s\n", string(data))
+}
+
+// historyRemoveMain removes the given results.
+func historyRemoveMain(currentOptions *Options, resultIDs []int64) {
+	db := openDatabaseOrPanic(getMiniooniDirOrPanic(currentOptions))
+	defer db.Close()
+	for _, resultID := range resultIDs {
+		err := db.DeleteResult(resultID)
+		runtimex.PanicOnError(err, fmt.Sprintf("cannot remove result %d", resultID))
+		log.Infof("removed result %d", resultID)
+	}
+}
+
+// historyUploadMain uploads the measurements of the given results that we did not
+// upload yet. When resultIDs is empty, we consider all the results. We use the given
+// recipients to encrypt again the encrypted measurement files we update.
+func historyUploadMain(ctx context.Context, sess *engine.Session,
+	miniooniDir string, resultIDs []int64, recipients []age.Recipient) {
+	db := openDatabaseOrPanic(miniooniDir)
+	defer db.Close()
+	if len(resultIDs) <= 0 {
+		done, incomplete, err := db.ListResults()
+		runtimex.PanicOnError(err, "cannot list results")
+		for _, result := range append(done, incomplete...) {
+			resultIDs = append(resultIDs, result.DatabaseResult.ID)
+		}
+	}
+	submitter, err := sess.NewSubmitter(ctx)
+	runtimex.PanicOnError(err, "cannot create submitter")
+	decrypter := newMeasurementDecrypter(sess.KeyValueStore())
+	var submitted, failed int
+	for _, resultID := range resultIDs {
+		measurements, err := db.ListMeasurements(resultID)
+		runtimex.PanicOnError(err, "cannot list measurements")
+		if len(measurements) <= 0 {
+			continue
+		}
+		for _, entry := range measurements {
+			// Because of the JOIN, the IDs of the result and the URL end up
+			// in other structs, so we restore them before updating the row.
+			msmt := entry.DatabaseMeasurement
+			msmt.ResultID = entry.DatabaseResult.ID
+			msmt.URLID = entry.DatabaseURL.ID
+			if msmt.IsUploaded || !msmt.IsDone || !msmt.MeasurementFilePath.Valid {
+				continue
+			}
+			if err := historyUploadMeasurement(ctx, db, submitter, decrypter, recipients, &msmt); err != nil {
+				log.Warnf("cannot upload measurement %d: %s", msmt.ID, err.Error())
+				if err := db.UploadFailed(&msmt, err.Error()); err != nil {
+					log.Warnf("cannot update measurement %d: %s", msmt.ID, err.Error())
+				}
+				failed++
+				continue
+			}
+			submitted++
+		}
+		result := measurements[0].DatabaseResult
+		if err := db.UpdateUploadedStatus(&result); err != nil {
+			log.Warnf("cannot update the upload status of result %d: %s", resultID, err.Error())
+		}
+	}
+	log.Infof("upload: submitted %d, failed %d", submitted, failed)
+}
+
+// historyUploadMeasurement uploads a single measurement and saves the new report ID.
+func historyUploadMeasurement(ctx context.Context, db *database.Database, submitter model.Submitter,
+	decrypter *measurementDecrypter, recipients []age.Recipient, msmt *model.DatabaseMeasurement) error {
+	filePath := msmt.MeasurementFilePath.String
+	raw, err := os.ReadFile(filePath) // #nosec G304 - this is working as intended
+	if err != nil {
+		return err
+	}
+	data, err := decrypter.decrypt(raw)
+	if err != nil {
+		return err
+	}
+	var m model.Measurement
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if err := submitter.Submit(ctx, &m); err != nil {
+		return err
+	}
+	data, err = json.Marshal(&m)
+	runtimex.PanicOnError(err, "json.Marshal unexpectedly failed")
+	if err := historyUpdateMeasurementFile(filePath, raw, data, recipients); err != nil {
+		return err
+	}
+	msmt.ReportID = sql.NullString{String: m.ReportID, Valid: m.ReportID != ""}
+	return db.UploadSucceeded(msmt)
+}
+
+// historyUpdateMeasurementFile writes the updated measurement into the measurement file. If
+// the original file content was encrypted, we encrypt for the given recipients or, if there
+// are no recipients, we leave the file alone rather than writing it in plaintext.
+func historyUpdateMeasurementFile(filePath string, original, data []byte, recipients []age.Recipient) error {
+	if msmtcrypt.IsEncrypted(original) {
+		if len(recipients) <= 0 {
+			log.Warnf("not updating %s because we don't know the encryption recipients", filePath)
+			return nil
+		}
+		encrypted, err := msmtcrypt.EncryptLine(data, recipients...)
+		if err != nil {
+			return err
+		}
+		data = encrypted
+	}
+	return os.WriteFile(filePath, data, 0600)
+}
@@ -0,0 +1,125 @@
+package main
+
+//
+// Managing the engine key-value store
+//
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/kvstore"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/spf13/cobra"
+)
+
+// kvstoreSQLiteFile is the name of the SQLite key-value store inside the miniooni
+// directory. When this file exists, we use it rather than the engine directory.
+const kvstoreSQLiteFile = "engine.sqlite3"
+
+// registerKVStore registers the kvstore subcommand.
+func registerKVStore(rootCmd *cobra.Command, globalOptions *Options) {
+	kvstoreCmd := &cobra.Command{
+		Use:   "kvstore",
+		Short: "Manages the engine key-value store",
+		Args:  cobra.NoArgs,
+	}
+	rootCmd.AddCommand(kvstoreCmd)
+
+	kvstoreCmd.AddCommand(&cobra.Command{
+		Use:   "migrate",
+		Short: "Migrates the engine key-value store from $HOME/.miniooni/engine to SQLite",
+		Long: `Migrates the engine key-value store from $HOME/.miniooni/engine to the
+$HOME/.miniooni/engine.sqlite3 SQLite database, which is more robust on flaky
+storage. After the migration, miniooni uses the SQLite database. We do not
+remove the engine directory, which you can remove once you're satisfied.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			kvstoreMigrateMain(globalOptions)
+		},
+	})
+
+	kvstoreCmd.AddCommand(&cobra.Command{
+		Use:   "list [PREFIX]",
+		Short: "Lists the keys in the engine key-value store",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var prefix string
+			if len(args) > 0 {
+				prefix = args[0]
+			}
+			kvstoreListMain(globalOptions, prefix)
+		},
+	})
+}
+
+// kvstoreMigrateMain migrates the engine key-value store to SQLite.
+func kvstoreMigrateMain(currentOptions *Options) {
+	miniooniDir := getMiniooniDirOrPanic(currentOptions)
+	dbPath := filepath.Join(miniooniDir, kvstoreSQLiteFile)
+	if _, err := os.Stat(dbPath); err == nil {
+		log.Warnf("kvstore: %s already exists; nothing to do", dbPath)
+		return
+	}
+	// write into a temporary file such that we do not use a partially migrated store
+	tempPath := dbPath + ".tmp"
+	_ = os.Remove(tempPath)
+	db, err := kvstore.NewSQLite(tempPath)
+	runtimex.PanicOnError(err, "cannot create the SQLite key-value store")
+	count, err := kvstore.MigrateFS(filepath.Join(miniooniDir, "engine"), db)
+	runtimex.PanicOnError(err, "cannot migrate the key-value store")
+	runtimex.PanicOnError(db.Close(), "cannot close the SQLite key-value store")
+	runtimex.PanicOnError(os.Rename(tempPath, dbPath), "cannot rename the SQLite key-value store")
+	for _, suffix := range []string{"-shm", "-wal"} {
+		_ = os.Remove(tempPath + suffix)
+	}
+	fmt.Printf("migrated %d keys into %s\n", count, dbPath)
+}
+
+// kvstoreListMain lists the keys in the engine key-value store.
+func kvstoreListMain(currentOptions *Options, prefix string) {
+	miniooniDir := getMiniooniDirOrPanic(currentOptions)
+	keys, err := kvstore.NewExtended(newKVStoreOrPanic(miniooniDir)).List(prefix)
+	runtimex.PanicOnError(err, "cannot list the keys")
+	for _, key := range keys {
+		fmt.Println(key)
+	}
+}
+
+// kvstoreSQLiteStores contains the SQLite key-value stores we opened, which
+// we keep open for the whole lifetime of the process.
+var kvstoreSQLiteStores = struct {
+	m  map[string]*kvstore.SQLite
+	mu sync.Mutex
+}{}
+
+// newKVStoreOrPanic creates the engine key-value store or panics on failure. We use the
+// SQLite key-value store if it exists and otherwise the engine directory.
+func newKVStoreOrPanic(miniooniDir string) model.KeyValueStore {
+	dbPath := filepath.Join(miniooniDir, kvstoreSQLiteFile)
+	_, err := os.Stat(dbPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		enginedir := filepath.Join(miniooniDir, "engine")
+		kvs, err := kvstore.NewFS(enginedir)
+		runtimex.PanicOnError(err, "cannot create engine directory")
+		return kvs
+	}
+	defer kvstoreSQLiteStores.mu.Unlock()
+	kvstoreSQLiteStores.mu.Lock()
+	if kvs := kvstoreSQLiteStores.m[dbPath]; kvs != nil {
+		return kvs
+	}
+	kvs, err := kvstore.NewSQLite(dbPath)
+	runtimex.PanicOnError(err, "cannot open the SQLite key-value store")
+	if kvstoreSQLiteStores.m == nil {
+		kvstoreSQLiteStores.m = make(map[string]*kvstore.SQLite)
+	}
+	kvstoreSQLiteStores.m[dbPath] = kvs
+	return kvs
+}
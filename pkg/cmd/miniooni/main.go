@@ -4,6 +4,7 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
 	"os"
 	"path"
@@ -17,8 +18,10 @@ import (
 	"github.com/ooni/probe-engine/pkg/legacy/assetsdir"
 	"github.com/ooni/probe-engine/pkg/logx"
 	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/oonirun"
 	"github.com/ooni/probe-engine/pkg/registry"
 	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/ooni/probe-engine/pkg/submitqueue"
 	"github.com/ooni/probe-engine/pkg/version"
 	"github.com/spf13/cobra"
 )
@@ -27,12 +30,17 @@ import (
 type Options struct {
 	Annotations         []string
 	AuthFile            string
+	Capture             bool
+	Database            bool
 	Emoji               bool
+	Encrypt             bool
+	EncryptTo           []string
 	ExtraOptions        []string
 	HomeDir             string
 	Inputs              []string
 	InputFilePaths      []string
 	MaxRuntime          int64
+	MetricsListen       string
 	NoJSON              bool
 	NoCollector         bool
 	ProbeServicesURL    string
@@ -40,6 +48,8 @@ type Options struct {
 	Random              bool
 	RepeatEvery         int64
 	ReportFile          string
+	ResultIDs           []int64
+	Sign                bool
 	SnowflakeRendezvous string
 	SoftwareName        string
 	SoftwareVersion     string
@@ -70,6 +80,20 @@ func main() {
 		"add KEY=VALUE annotation to the report (can be repeated multiple times)",
 	)
 
+	flags.BoolVar(
+		&globalOptions.Capture,
+		"capture",
+		false,
+		"capture packets while measuring and save them into pcapng files next to the report file (Linux only; requires CAP_NET_RAW; not available when encrypting measurements)",
+	)
+
+	flags.BoolVar(
+		&globalOptions.Database,
+		"database",
+		false,
+		"also record results and measurements into the $HOME/.miniooni/db database",
+	)
+
 	flags.BoolVar(
 		&globalOptions.Emoji,
 		"emoji",
@@ -77,6 +101,20 @@ func main() {
 		"whether to use emojis when logging",
 	)
 
+	flags.BoolVar(
+		&globalOptions.Encrypt,
+		"encrypt",
+		false,
+		"encrypt the measurements saved to disk for the probe's own key (see \"miniooni encryption\")",
+	)
+
+	flags.StringSliceVar(
+		&globalOptions.EncryptTo,
+		"encrypt-to",
+		[]string{},
+		"encrypt the measurements saved to disk for the given age recipient or recipients file (can be repeated multiple times)",
+	)
+
 	flags.StringVar(
 		&globalOptions.HomeDir,
 		"home",
@@ -84,6 +122,13 @@ func main() {
 		"force specific home directory",
 	)
 
+	flags.StringVar(
+		&globalOptions.MetricsListen,
+		"metrics-listen",
+		"",
+		"serve prometheus metrics at http://ADDRESS/metrics (e.g., \"127.0.0.1:9101\")",
+	)
+
 	flags.BoolVarP(
 		&globalOptions.NoJSON,
 		"no-json",
@@ -100,6 +145,13 @@ func main() {
 		"do not submit measurements to the OONI collector",
 	)
 
+	flags.BoolVar(
+		&globalOptions.Sign,
+		"sign",
+		false,
+		"sign the measurements saved into the report file (see \"miniooni signature\")",
+	)
+
 	flags.StringVar(
 		&globalOptions.ProbeServicesURL,
 		"probe-services",
@@ -192,6 +244,13 @@ func main() {
 	registerAllExperiments(rootCmd, &globalOptions)
 	registerOONIRun(rootCmd, &globalOptions)
 	registerJavaScript(rootCmd, &globalOptions)
+	registerQueue(rootCmd, &globalOptions)
+	registerHistory(rootCmd, &globalOptions)
+	registerExport(rootCmd)
+	registerSignature(rootCmd, &globalOptions)
+	registerEncryption(rootCmd, &globalOptions)
+	registerDaemon(rootCmd, &globalOptions)
+	registerKVStore(rootCmd, &globalOptions)
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
@@ -236,6 +295,7 @@ func registerOONIRun(rootCmd *cobra.Command, globalOptions *Options) {
 		"",
 		"Path to a file containing a bearer token for fetching a remote OONI Run v2 descriptor",
 	)
+	registerOONIRunDescr(subCmd, globalOptions)
 }
 
 // registerAllExperiments registers a subcommand for each experiment
@@ -311,6 +371,21 @@ func registerAllExperiments(rootCmd *cobra.Command, globalOptions *Options) {
 // This function will panic in case of a fatal error. It is up to you that
 // integrate this function to either handle the panic of ignore it.
 func MainWithConfiguration(experimentName string, currentOptions *Options) {
+	logger := configureOrPanic(currentOptions)
+	for {
+		mainSingleIteration(context.Background(), logger, experimentName, currentOptions)
+		if currentOptions.RepeatEvery <= 0 {
+			break
+		}
+		log.Infof("waiting %ds before repeating the measurement", currentOptions.RepeatEvery)
+		log.Info("use Ctrl-C to interrupt miniooni")
+		time.Sleep(time.Duration(currentOptions.RepeatEvery) * time.Second)
+	}
+}
+
+// configureOrPanic checks the embedded configuration, fills the default options,
+// and configures logging. It returns the logger to use.
+func configureOrPanic(currentOptions *Options) *log.Logger {
 	runtimex.PanicOnError(engine.CheckEmbeddedPsiphonConfig(), "Invalid embedded psiphon config")
 	if currentOptions.Tunnel != "" {
 		currentOptions.Proxy = fmt.Sprintf("%s:///", currentOptions.Tunnel)
@@ -326,20 +401,14 @@ func MainWithConfiguration(experimentName string, currentOptions *Options) {
 		currentOptions.ReportFile = "report.jsonl"
 	}
 	log.Log = logger
-	for {
-		mainSingleIteration(logger, experimentName, currentOptions)
-		if currentOptions.RepeatEvery <= 0 {
-			break
-		}
-		log.Infof("waiting %ds before repeating the measurement", currentOptions.RepeatEvery)
-		log.Info("use Ctrl-C to interrupt miniooni")
-		time.Sleep(time.Duration(currentOptions.RepeatEvery) * time.Second)
-	}
+	maybeStartMetricsListenerOrPanic(currentOptions)
+	return logger
 }
 
 // mainSingleIteration runs a single iteration. There may be multiple iterations
-// when the user specifies the --repeat-every command line flag.
-func mainSingleIteration(logger model.Logger, experimentName string, currentOptions *Options) {
+// when the user specifies the --repeat-every command line flag or when we are
+// running as a daemon (see daemon.go).
+func mainSingleIteration(ctx context.Context, logger model.Logger, experimentName string, currentOptions *Options) {
 
 	// We allow the inner code to fail but we stop propagating the panic here
 	// such that --repeat-every works as intended anyway
@@ -354,16 +423,10 @@ func mainSingleIteration(logger model.Logger, experimentName string, currentOpti
 	extraOptions := mustMakeMapStringAny(currentOptions.ExtraOptions)
 	annotations := mustMakeMapStringString(currentOptions.Annotations)
 
-	ctx := context.Background()
-
 	//Mon Jan 2 15:04:05 -0700 MST 2006
 	log.Infof("Current time: %s", time.Now().UTC().Format("2006-01-02 15:04:05 MST"))
 
-	homeDir := gethomedir(currentOptions.HomeDir)
-	runtimex.Assert(homeDir != "", "home directory is empty")
-	miniooniDir := path.Join(homeDir, ".miniooni")
-	err := os.MkdirAll(miniooniDir, 0700)
-	runtimex.PanicOnError(err, "cannot create $HOME/.miniooni directory")
+	miniooniDir := getMiniooniDirOrPanic(currentOptions)
 
 	// We cleanup the assets files used by versions of ooniprobe
 	// older than v3.9.0, where we started embedding the assets
@@ -390,15 +453,71 @@ func mainSingleIteration(logger model.Logger, experimentName string, currentOpti
 	lookupBackendsOrPanic(ctx, sess)
 	lookupLocationOrPanic(ctx, sess)
 
+	// We handle flushing the submission queue specially because it does
+	// not entail running any experiment. See queue.go.
+	queue := submitqueue.New(sess.KeyValueStore())
+	if experimentName == queueFlushCommand {
+		queueFlushMain(ctx, sess, queue, true)
+		return
+	}
+
+	// When requested, encrypt the measurements we save. See encryption.go.
+	recipients := newRecipientsOrPanic(miniooniDir, sess.KeyValueStore(), currentOptions)
+
+	// Uploading the measurements in the database does not entail running
+	// any experiment either. See history.go.
+	if experimentName == historyUploadCommand {
+		historyUploadMain(ctx, sess, miniooniDir, currentOptions.ResultIDs, recipients)
+		return
+	}
+
+	// When requested, record the results into the database.
+	var resultsDB *oonirun.ResultsDatabase
+	if currentOptions.Database {
+		db, config := newResultsDatabaseOrPanic(miniooniDir, sess, recipients)
+		defer db.Close()
+		resultsDB = config
+	}
+
+	// When requested, sign the measurements we save. See signature.go.
+	var signingKey ed25519.PrivateKey
+	if currentOptions.Sign {
+		runtimex.Assert(len(recipients) <= 0, "you cannot combine --sign with encrypting the measurements")
+		signingKey = loadSigningKeyOrPanic(sess.KeyValueStore())
+	}
+
+	// Before running, retry submitting the measurements we could not submit
+	// in previous runs, if their exponential backoff delay is expired.
+	if !currentOptions.NoCollector {
+		queueFlushMain(ctx, sess, queue, false)
+	}
+
+	// When requested, capture packets while measuring. See capture.go.
+	capturer := newCapturerMaybe(currentOptions, recipients, logger)
+	if capturer != nil {
+		defer capturer.Close()
+	}
+
 	// We handle the oonirun experiment name specially. The user must specify
 	// `miniooni -i {OONIRunURL} oonirun` to run a OONI Run URL (v1 or v2).
 	if experimentName == "oonirun" {
-		ooniRunMain(ctx, sess, currentOptions, annotations)
+		ooniRunMain(ctx, sess, currentOptions, annotations, queue, resultsDB, signingKey, recipients, capturer)
 		return
 	}
 
 	// Otherwise just run OONI experiments as we normally do.
-	runx(ctx, sess, experimentName, annotations, extraOptions, currentOptions)
+	runx(ctx, sess, experimentName, annotations, extraOptions, currentOptions, queue, resultsDB, signingKey, recipients, capturer)
+}
+
+// getMiniooniDirOrPanic returns the miniooni state directory, which
+// we create if needed, or panics on failure.
+func getMiniooniDirOrPanic(currentOptions *Options) string {
+	homeDir := gethomedir(currentOptions.HomeDir)
+	runtimex.Assert(homeDir != "", "home directory is empty")
+	miniooniDir := path.Join(homeDir, ".miniooni")
+	err := os.MkdirAll(miniooniDir, 0700)
+	runtimex.PanicOnError(err, "cannot create $HOME/.miniooni directory")
+	return miniooniDir
 }
 
 func documentationForOptions(factory *registry.Factory) string {
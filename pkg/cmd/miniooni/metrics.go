@@ -0,0 +1,33 @@
+package main
+
+//
+// Exporting prometheus metrics
+//
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// maybeStartMetricsListenerOrPanic starts the HTTP server exporting prometheus
+// metrics in the background when the user specified --metrics-listen.
+func maybeStartMetricsListenerOrPanic(currentOptions *Options) {
+	if currentOptions.MetricsListen == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 8 * time.Second,
+	}
+	listener, err := net.Listen("tcp", currentOptions.MetricsListen)
+	runtimex.PanicOnError(err, "net.Listen failed")
+	go srv.Serve(listener)
+	log.Infof("serving prometheus metrics at http://%s/metrics", listener.Addr().String())
+}
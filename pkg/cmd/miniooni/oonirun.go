@@ -6,30 +6,41 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
 	"os"
 
+	"filippo.io/age"
 	"github.com/ooni/probe-engine/pkg/engine"
 	"github.com/ooni/probe-engine/pkg/oonirun"
+	"github.com/ooni/probe-engine/pkg/pcapx"
+	"github.com/ooni/probe-engine/pkg/submitqueue"
 )
 
 // ooniRunMain runs the experiments described by the given OONI Run URLs. This
 // function works with both v1 and v2 OONI Run URLs.
 func ooniRunMain(ctx context.Context,
-	sess *engine.Session, currentOptions *Options, annotations map[string]string) {
+	sess *engine.Session, currentOptions *Options, annotations map[string]string,
+	queue *submitqueue.Queue, resultsDB *oonirun.ResultsDatabase,
+	signingKey ed25519.PrivateKey, recipients []age.Recipient, capturer *pcapx.Capturer) {
 	logger := sess.Logger()
 	cfg := &oonirun.LinkConfig{
-		AcceptChanges: currentOptions.Yes,
-		AuthFile:      currentOptions.AuthFile,
-		Annotations:   annotations,
-		KVStore:       sess.KeyValueStore(),
-		MaxRuntime:    currentOptions.MaxRuntime,
-		NoCollector:   currentOptions.NoCollector,
-		NoJSON:        currentOptions.NoJSON,
-		Random:        currentOptions.Random,
-		ReportFile:    currentOptions.ReportFile,
-		Session:       sess,
+		AcceptChanges:   currentOptions.Yes,
+		AuthFile:        currentOptions.AuthFile,
+		Annotations:     annotations,
+		Capturer:        capturer,
+		KVStore:         sess.KeyValueStore(),
+		MaxRuntime:      currentOptions.MaxRuntime,
+		NoCollector:     currentOptions.NoCollector,
+		NoJSON:          currentOptions.NoJSON,
+		Random:          currentOptions.Random,
+		Recipients:      recipients,
+		ReportFile:      currentOptions.ReportFile,
+		ResultsDatabase: resultsDB,
+		Session:         sess,
+		SigningKey:      signingKey,
+		SubmitQueue:     queue,
 	}
 	for _, URL := range currentOptions.Inputs {
 		r := oonirun.NewLinkRunner(cfg, URL)
@@ -54,6 +65,12 @@ func ooniRunMain(ctx context.Context,
 			logger.Warnf("oonirun: parsing OONI Run v2 descriptor failed: %s", err.Error())
 			continue
 		}
+		// Note: we only warn about issues here because OONI Run API exports may contain
+		// extra fields or options we do not know about yet; `miniooni oonirun lint` is
+		// the command that performs strict checking of descriptors.
+		for _, issue := range oonirun.V2LintDescriptor(&descr) {
+			logger.Warnf("oonirun: %s: %s", filename, issue.String())
+		}
 		logger.Infof("oonirun: running '%s'", descr.Name)
 		logger.Infof("oonirun: link authored by '%s'", descr.Author)
 		if err := oonirun.V2MeasureDescriptor(ctx, cfg, &descr); err != nil {
@@ -0,0 +1,176 @@
+package main
+
+//
+// Authoring and validating OONI Run v2 descriptors
+//
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/ooni/probe-engine/pkg/experimentname"
+	"github.com/ooni/probe-engine/pkg/oonirun"
+	"github.com/ooni/probe-engine/pkg/registry"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/spf13/cobra"
+)
+
+// oonirunDescrOptions contains the options for the descriptor subcommands.
+type oonirunDescrOptions struct {
+	cachedURL   string
+	experiments []string
+	force       bool
+}
+
+// registerOONIRunDescr registers the subcommands of oonirun for
+// authoring and validating OONI Run v2 descriptors.
+func registerOONIRunDescr(oonirunCmd *cobra.Command, globalOptions *Options) {
+	options := &oonirunDescrOptions{}
+
+	validateCmd := &cobra.Command{
+		Use:   "validate FILE...",
+		Short: "Checks local OONI Run v2 descriptors for errors",
+		Long: `Checks local OONI Run v2 descriptors for errors such as unknown experiments,
+unknown options, options with the wrong type, and missing inputs. We exit with
+failure if any descriptor contains errors.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			oonirunDescrCheckMain(globalOptions, options, args, false)
+		},
+	}
+	oonirunCmd.AddCommand(validateCmd)
+
+	lintCmd := &cobra.Command{
+		Use:   "lint FILE...",
+		Short: "Checks local OONI Run v2 descriptors for errors and likely mistakes",
+		Long: `Like validate but also prints warnings about likely mistakes such as missing
+metadata, duplicate inputs, and non-canonical experiment names. We exit with
+failure if any descriptor contains errors or warnings.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			oonirunDescrCheckMain(globalOptions, options, args, true)
+		},
+	}
+	oonirunCmd.AddCommand(lintCmd)
+
+	for _, cmd := range []*cobra.Command{validateCmd, lintCmd} {
+		cmd.Flags().StringVar(
+			&options.cachedURL,
+			"cached-url",
+			"",
+			"also show the diff with the cached descriptor fetched from the given URL",
+		)
+	}
+
+	initCmd := &cobra.Command{
+		Use:   "init [FILE]",
+		Short: "Writes a new OONI Run v2 descriptor (default: \"oonirun.json\")",
+		Long: `Writes a new OONI Run v2 descriptor containing the given experiments
+along with the default values of their options.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			filename := "oonirun.json"
+			if len(args) > 0 {
+				filename = args[0]
+			}
+			oonirunDescrInitMain(options, filename)
+		},
+	}
+	oonirunCmd.AddCommand(initCmd)
+	initCmd.Flags().StringSliceVarP(
+		&options.experiments,
+		"experiment",
+		"e",
+		[]string{"web_connectivity"},
+		"experiment to include into the descriptor (may be specified multiple times)",
+	)
+	initCmd.Flags().BoolVar(
+		&options.force,
+		"force",
+		false,
+		"overwrite the descriptor if it already exists",
+	)
+}
+
+// oonirunDescrCheckMain checks the given descriptors and exits with
+// failure if there are errors or, when lint is true, warnings.
+func oonirunDescrCheckMain(currentOptions *Options, options *oonirunDescrOptions, filenames []string, lint bool) {
+	if options.cachedURL != "" && len(filenames) != 1 {
+		runtimex.PanicOnError(errors.New("expected a single file"), "--cached-url")
+	}
+	var failed bool
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename) // #nosec G304 - this is working as intended
+		runtimex.PanicOnError(err, "cannot read descriptor")
+		desc, issues := oonirun.V2LintDescriptorJSON(data)
+		count := 0
+		for _, issue := range issues {
+			if lint || issue.Severity == oonirun.V2LintError {
+				fmt.Printf("%s: %s\n", filename, issue.String())
+				count++
+			}
+		}
+		if count <= 0 {
+			fmt.Printf("%s: ok\n", filename)
+		}
+		failed = failed || count > 0
+		if desc != nil && options.cachedURL != "" {
+			oonirunDescrPrintDiff(currentOptions, options.cachedURL, desc)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// oonirunDescrPrintDiff prints the diff with the cached descriptor.
+func oonirunDescrPrintDiff(currentOptions *Options, URL string, desc *oonirun.V2Descriptor) {
+	kvStore := newKVStoreOrPanic(getMiniooniDirOrPanic(currentOptions))
+	diff, found, err := oonirun.V2DiffWithCache(kvStore, URL, desc)
+	runtimex.PanicOnError(err, "cannot load the OONI Run v2 descriptors cache")
+	switch {
+	case !found:
+		fmt.Printf("\nwe have not cached any descriptor for %s\n", URL)
+	case diff == "":
+		fmt.Printf("\nthe descriptor is equal to the cached descriptor for %s\n", URL)
+	}
+	if diff != "" {
+		fmt.Printf("\n%s", diff)
+	}
+}
+
+// oonirunDescrInitMain writes a new descriptor with the given experiments.
+func oonirunDescrInitMain(options *oonirunDescrOptions, filename string) {
+	if _, err := os.Stat(filename); !errors.Is(err, fs.ErrNotExist) && !options.force {
+		runtimex.PanicOnError(fmt.Errorf("%s already exists (use --force to overwrite)", filename), "oonirun init")
+	}
+	desc := &oonirun.V2Descriptor{
+		Name:        "",
+		Description: "",
+		Author:      "",
+		Nettests:    []oonirun.V2Nettest{},
+	}
+	for _, name := range options.experiments {
+		name = experimentname.Canonicalize(name)
+		factoryFunc := registry.AllExperiments[name]
+		if factoryFunc == nil {
+			runtimex.PanicOnError(fmt.Errorf("%w: %s", registry.ErrNoSuchExperiment, name), "oonirun init")
+		}
+		defaults, err := factoryFunc().DefaultOptionsJSON()
+		runtimex.PanicOnError(err, "cannot serialize the default options")
+		desc.Nettests = append(desc.Nettests, oonirun.V2Nettest{
+			Inputs:   []string{},
+			Options:  defaults,
+			TestName: name,
+		})
+	}
+	data, err := json.MarshalIndent(desc, "", "  ")
+	runtimex.PanicOnError(err, "json.MarshalIndent failed unexpectedly")
+	err = os.WriteFile(filename, append(data, '\n'), 0600)
+	runtimex.PanicOnError(err, "cannot write descriptor")
+	fmt.Printf("written %s; please, fill the metadata and the inputs and then run:\n\n", filename)
+	fmt.Printf("    miniooni oonirun lint %s\n", filename)
+}
@@ -0,0 +1,114 @@
+package main
+
+//
+// Queue of measurements we could not submit
+//
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/engine"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/ooni/probe-engine/pkg/submitqueue"
+	"github.com/spf13/cobra"
+)
+
+// queueFlushCommand is the pseudo experiment name we pass to
+// MainWithConfiguration to flush the submission queue.
+const queueFlushCommand = "queue flush"
+
+// registerQueue registers the queue subcommand
+func registerQueue(rootCmd *cobra.Command, globalOptions *Options) {
+	queueCmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Inspects and flushes the queue of measurements we could not submit",
+		Args:  cobra.NoArgs,
+	}
+	rootCmd.AddCommand(queueCmd)
+
+	queueCmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Shows the measurements we could not submit",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			queueStatusMain(globalOptions)
+		},
+	})
+
+	queueCmd.AddCommand(&cobra.Command{
+		Use:     "flush",
+		Aliases: []string{"resubmit"},
+		Short:   "Submits all the measurements we could not submit ignoring backoff",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			MainWithConfiguration(queueFlushCommand, globalOptions)
+		},
+	})
+}
+
+// queueStatusMain prints the content of the submission queue.
+func queueStatusMain(currentOptions *Options) {
+	miniooniDir := getMiniooniDirOrPanic(currentOptions)
+	queue := submitqueue.New(newKVStoreOrPanic(miniooniDir))
+	entries, err := queue.Entries()
+	runtimex.PanicOnError(err, "cannot read the submission queue")
+	lastErr, err := queue.LastError()
+	runtimex.PanicOnError(err, "cannot read the submission queue")
+
+	fmt.Printf("queued measurements: %d\n", len(entries))
+	if lastErr != "" {
+		fmt.Printf("last error: %s\n", lastErr)
+	}
+	if len(entries) <= 0 {
+		return
+	}
+	fmt.Printf("\n")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "UID\tQUEUED\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR\n")
+	for _, entry := range entries {
+		fmt.Fprintf(
+			tw, "%s\t%s\t%d\t%s\t%s\n",
+			entry.UID[:min(len(entry.UID), 16)],
+			entry.Queued.UTC().Format(time.RFC3339),
+			entry.Attempts,
+			entry.NextAttempt.UTC().Format(time.RFC3339),
+			entry.LastError,
+		)
+	}
+	tw.Flush()
+}
+
+// queueFlushMain attempts to submit the measurements inside the submission queue.
+func queueFlushMain(ctx context.Context, sess *engine.Session, queue *submitqueue.Queue, force bool) {
+	size, err := queue.Size()
+	if err != nil {
+		log.Warnf("cannot read the submission queue: %s", err.Error())
+		return
+	}
+	if size <= 0 {
+		if force {
+			log.Info("the submission queue is empty")
+		}
+		return
+	}
+	log.Infof("retrying to submit %d queued measurements; please be patient...", size)
+	submitter, err := sess.NewSubmitter(ctx)
+	if err != nil {
+		log.Warnf("cannot create submitter: %s", err.Error())
+		return
+	}
+	result, err := queue.Flush(ctx, submitter, force)
+	if err != nil {
+		log.Warnf("cannot flush the submission queue: %s", err.Error())
+		return
+	}
+	log.Infof(
+		"submission queue: submitted %d, failed %d, postponed %d",
+		result.Submitted, result.Failed, result.Postponed,
+	)
+}
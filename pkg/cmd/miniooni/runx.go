@@ -6,26 +6,37 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 
+	"filippo.io/age"
 	"github.com/ooni/probe-engine/pkg/oonirun"
+	"github.com/ooni/probe-engine/pkg/pcapx"
 	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/ooni/probe-engine/pkg/submitqueue"
 )
 
 // runx runs the given experiment by name
 func runx(ctx context.Context, sess oonirun.Session, experimentName string,
-	annotations map[string]string, extraOptions map[string]any, currentOptions *Options) {
+	annotations map[string]string, extraOptions map[string]any, currentOptions *Options,
+	queue *submitqueue.Queue, resultsDB *oonirun.ResultsDatabase,
+	signingKey ed25519.PrivateKey, recipients []age.Recipient, capturer *pcapx.Capturer) {
 	desc := &oonirun.Experiment{
-		Annotations:    annotations,
-		ExtraOptions:   extraOptions,
-		Inputs:         currentOptions.Inputs,
-		InputFilePaths: currentOptions.InputFilePaths,
-		MaxRuntime:     currentOptions.MaxRuntime,
-		Name:           experimentName,
-		NoCollector:    currentOptions.NoCollector,
-		NoJSON:         currentOptions.NoJSON,
-		Random:         currentOptions.Random,
-		ReportFile:     currentOptions.ReportFile,
-		Session:        sess,
+		Annotations:     annotations,
+		Capturer:        capturer,
+		ExtraOptions:    extraOptions,
+		Inputs:          currentOptions.Inputs,
+		InputFilePaths:  currentOptions.InputFilePaths,
+		MaxRuntime:      currentOptions.MaxRuntime,
+		Name:            experimentName,
+		NoCollector:     currentOptions.NoCollector,
+		NoJSON:          currentOptions.NoJSON,
+		Random:          currentOptions.Random,
+		Recipients:      recipients,
+		ReportFile:      currentOptions.ReportFile,
+		ResultsDatabase: resultsDB,
+		Session:         sess,
+		SigningKey:      signingKey,
+		SubmitQueue:     queue,
 	}
 	err := desc.Run(ctx)
 	runtimex.PanicOnError(err, "cannot run experiment")
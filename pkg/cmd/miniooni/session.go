@@ -8,7 +8,6 @@ import (
 
 	"github.com/apex/log"
 	"github.com/ooni/probe-engine/pkg/engine"
-	"github.com/ooni/probe-engine/pkg/kvstore"
 	"github.com/ooni/probe-engine/pkg/legacy/kvstore2dir"
 	"github.com/ooni/probe-engine/pkg/model"
 	"github.com/ooni/probe-engine/pkg/runtimex"
@@ -25,12 +24,10 @@ func newSessionOrPanic(ctx context.Context, currentOptions *Options,
 	// We renamed kvstore2 to engine in the 3.20 development cycle
 	_ = kvstore2dir.Move(miniooniDir)
 
-	enginedir := filepath.Join(miniooniDir, "engine")
-	kvstore, err := kvstore.NewFS(enginedir)
-	runtimex.PanicOnError(err, "cannot create engine directory")
+	kvstore := newKVStoreOrPanic(miniooniDir)
 
 	tunnelDir := filepath.Join(miniooniDir, "tunnel")
-	err = os.MkdirAll(tunnelDir, 0700)
+	err := os.MkdirAll(tunnelDir, 0700)
 	runtimex.PanicOnError(err, "cannot create tunnelDir")
 
 	config := engine.SessionConfig{
@@ -0,0 +1,115 @@
+package main
+
+//
+// Signing measurements and verifying signed reports
+//
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/msmtsign"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/spf13/cobra"
+)
+
+// signatureVerifyOptions contains the options for the signature verify subcommand.
+type signatureVerifyOptions struct {
+	publicKey string
+}
+
+// registerSignature registers the signature subcommand.
+func registerSignature(rootCmd *cobra.Command, globalOptions *Options) {
+	signatureCmd := &cobra.Command{
+		Use:   "signature",
+		Short: "Shows the signing key and verifies signed reports",
+		Args:  cobra.NoArgs,
+	}
+	rootCmd.AddCommand(signatureCmd)
+
+	signatureCmd.AddCommand(&cobra.Command{
+		Use:   "public-key",
+		Short: "Prints the base64 encoded public key used with --sign",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			signaturePublicKeyMain(globalOptions)
+		},
+	})
+
+	options := &signatureVerifyOptions{}
+	verifyCmd := &cobra.Command{
+		Use:   "verify REPORT_FILE",
+		Short: "Verifies the measurements inside a report file created using --sign",
+		Long: `Verifies the measurements inside REPORT_FILE using the signatures
+inside REPORT_FILE.sig and prints the measurements that do not verify.
+
+By default, we trust the public key of this probe. Use --public-key to
+verify a report created by another probe.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			signatureVerifyMain(globalOptions, options, args[0])
+		},
+	}
+	signatureCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().StringVar(
+		&options.publicKey,
+		"public-key",
+		"",
+		"base64 encoded public key to trust (default: the public key of this probe)",
+	)
+}
+
+// loadSigningKeyOrPanic loads or creates the signing key or panics on failure.
+func loadSigningKeyOrPanic(kvStore model.KeyValueStore) ed25519.PrivateKey {
+	key, err := msmtsign.LoadOrCreateKey(kvStore)
+	runtimex.PanicOnError(err, "cannot load the signing key")
+	return key
+}
+
+// signaturePublicKeyMain prints the public key of this probe.
+func signaturePublicKeyMain(currentOptions *Options) {
+	miniooniDir := getMiniooniDirOrPanic(currentOptions)
+	key := loadSigningKeyOrPanic(newKVStoreOrPanic(miniooniDir))
+	fmt.Println(base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+}
+
+// signatureVerifyMain verifies the given report file.
+func signatureVerifyMain(currentOptions *Options, options *signatureVerifyOptions, reportFile string) {
+	var publicKey ed25519.PublicKey
+	if options.publicKey != "" {
+		data, err := base64.StdEncoding.DecodeString(options.publicKey)
+		runtimex.PanicOnError(err, "cannot decode the public key")
+		runtimex.Assert(len(data) == ed25519.PublicKeySize, "invalid public key length")
+		publicKey = data
+	} else {
+		miniooniDir := getMiniooniDirOrPanic(currentOptions)
+		key := loadSigningKeyOrPanic(newKVStoreOrPanic(miniooniDir))
+		publicKey = key.Public().(ed25519.PublicKey)
+	}
+
+	report, err := os.Open(reportFile) // #nosec G304 - this is working as intended
+	runtimex.PanicOnError(err, "cannot open the report file")
+	defer report.Close()
+	signatures, err := os.Open(reportFile + msmtsign.SignatureFileSuffix) // #nosec G304
+	runtimex.PanicOnError(err, "cannot open the signatures file")
+	defer signatures.Close()
+
+	results, err := msmtsign.Verify(publicKey, report, signatures)
+	runtimex.PanicOnError(err, "cannot verify the report file")
+	var failures int
+	for _, result := range results {
+		if result.Status != msmtsign.VerifyOK {
+			fmt.Printf("line %d: %s\n", result.Line, result.Status)
+			failures++
+		}
+	}
+	if failures > 0 {
+		log.Warnf("%d out of %d measurements do not verify", failures, len(results))
+		os.Exit(1)
+	}
+	log.Infof("all the %d measurements verify", len(results))
+}
@@ -0,0 +1,127 @@
+// Command oodnshelperd implements the DNS test helper.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/oodnshelperd"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/ooni/probe-engine/pkg/version"
+)
+
+var (
+	// addresses contains the addresses to use for A and AAAA answers
+	addresses = flag.String("addresses", "", "Comma separated list of IPv4 and IPv6 addresses for A and AAAA answers")
+
+	// apiEndpoint is the UDP and TCP endpoint where we serve DNS queries
+	apiEndpoint = flag.String("api-endpoint", "127.0.0.1:5353", "UDP and TCP endpoint where to serve DNS queries")
+
+	// debug controls whether to enable verbose logging
+	debug = flag.Bool("debug", false, "Toggle debug mode")
+
+	// queryLog is the file where to log queries
+	queryLog = flag.String("query-log", "", "Append queries to this file using the JSON lines format")
+
+	// sigs is the channel where we collect signals
+	sigs = make(chan os.Signal, 1)
+
+	// srvAdd is used to pass the server address to tests
+	srvAddr = make(chan string, 1)
+
+	// srvWg is used by tests to know when the server has shut down
+	srvWg = new(sync.WaitGroup)
+
+	// ttl is the TTL of the records we serve
+	ttl = flag.Uint("ttl", 0, "TTL of the records we serve")
+
+	// versionFlag indicates we must print the version on stdout
+	versionFlag = flag.Bool("version", false, "Prints version information on the stdout")
+
+	// zone is the zone for which we are authoritative
+	zone = flag.String("zone", "", "Zone for which we are authoritative (e.g., dns.example.org)")
+)
+
+func main() {
+	// parse command line options
+	flag.Parse()
+
+	// set log level
+	logmap := map[bool]log.Level{
+		true:  log.DebugLevel,
+		false: log.InfoLevel,
+	}
+	log.SetLevel(logmap[*debug])
+
+	if *versionFlag {
+		fmt.Printf("oodnshelperd/%s %s dirty=%v commit=%s\n",
+			version.Version,
+			runtimex.BuildInfo.GoVersion,
+			runtimex.BuildInfo.VcsModified,
+			runtimex.BuildInfo.VcsRevision,
+		)
+		return
+	}
+	runtimex.Assert(*zone != "", "you must specify the zone using -zone")
+
+	// create the handler
+	handler := oodnshelperd.NewHandler(log.Log, *zone)
+	for _, addr := range strings.Split(*addresses, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			runtimex.Assert(net.ParseIP(addr) != nil, "invalid address: "+addr)
+			handler.Addresses = append(handler.Addresses, addr)
+		}
+	}
+	handler.TTL = uint32(*ttl)
+	if *queryLog != "" {
+		filep, err := os.OpenFile(*queryLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		runtimex.PanicOnError(err, "os.OpenFile failed")
+		defer filep.Close()
+		handler.QueryLog = filep
+	}
+
+	// create the listening sockets for serving DNS queries, where we use the
+	// UDP address for TCP such that we use the same port when it's zero
+	pconn, err := net.ListenPacket("udp", *apiEndpoint)
+	runtimex.PanicOnError(err, "net.ListenPacket failed")
+	listener, err := net.Listen("tcp", pconn.LocalAddr().String())
+	runtimex.PanicOnError(err, "net.Listen failed")
+
+	// await for the server's address to become available
+	srvAddr <- pconn.LocalAddr().String()
+	srvWg.Add(1)
+
+	// start serving in the background
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_ = handler.Serve(pconn)
+	}()
+	go func() {
+		defer wg.Done()
+		_ = handler.ServeTCP(listener)
+	}()
+	log.Infof("serving DNS queries for %s at udp://%s/ and tcp://%s/",
+		*zone, pconn.LocalAddr().String(), listener.Addr().String())
+
+	// await for a signal
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigs
+	log.Infof("interrupted by signal: %v", sig)
+
+	// shutdown the server
+	pconn.Close()
+	listener.Close()
+	wg.Wait()
+
+	// notify tests that we are now done
+	srvWg.Done()
+}
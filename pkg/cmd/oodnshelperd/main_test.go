@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+func TestMainRunServerWorkingAsIntended(t *testing.T) {
+	// let the kernel pick a random free port
+	*addresses = "104.248.30.161, 2a03:b0c0:1:d0::1a4:1"
+	*apiEndpoint = "127.0.0.1:0"
+	*queryLog = filepath.Join(t.TempDir(), "query.jsonl")
+	*zone = "dns.example.org"
+
+	// run the main function in a background goroutine
+	go main()
+
+	// create a resolver using the test helper
+	endpoint := <-srvAddr
+	netx := &netxlite.Netx{}
+	dialer := netx.NewDialerWithoutResolver(model.DiscardLogger)
+	reso := netx.NewParallelUDPResolver(model.DiscardLogger, dialer, endpoint)
+
+	// resolve a name inside the zone
+	addrs, err := reso.LookupHost(context.Background(), "xyzzy.dns.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 {
+		t.Fatal("unexpected addresses", addrs)
+	}
+
+	// resolve a name inside the zone using TCP
+	txp := netxlite.NewUnwrappedDNSOverTCPTransport(dialer.DialContext, endpoint)
+	reso = netxlite.WrapResolver(model.DiscardLogger, netxlite.NewUnwrappedParallelResolver(txp))
+	addrs, err = reso.LookupHost(context.Background(), "xyzzy.dns.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 {
+		t.Fatal("unexpected addresses", addrs)
+	}
+
+	// tear down the helper
+	sigs <- syscall.SIGINT
+
+	// wait for the background goroutine to join
+	srvWg.Wait()
+
+	// make sure we logged the queries
+	data, err := os.ReadFile(*queryLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		if !strings.Contains(string(data), `"type":"`+dns.TypeToString[qtype]+`"`) {
+			t.Fatal("expected to see the query in the log", qtype)
+		}
+	}
+}
+
+func TestMainVersionWorkingAsIntended(t *testing.T) {
+	*versionFlag = true
+	main()
+	*versionFlag = false
+}
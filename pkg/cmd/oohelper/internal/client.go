@@ -110,6 +110,8 @@ func (oo OOClient) Do(ctx context.Context, config OOConfig) (*CtrlResponse, erro
 		},
 		TCPConnect:   endpoints,
 		XQUICEnabled: true,
+		XTLSDetails:  true,
+		XVantages:    true,
 	}
 	data, err := json.Marshal(creq)
 	runtimex.PanicOnError(err, "oohelper: cannot marshal control request")
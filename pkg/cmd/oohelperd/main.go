@@ -10,6 +10,7 @@ import (
 	"net/http/pprof"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -26,12 +27,42 @@ var (
 	// apiEndpoint is the endpoint where we serve ooniprobe requests
 	apiEndpoint = flag.String("api-endpoint", "127.0.0.1:8080", "API endpoint")
 
+	// cacheMaxEntries is the maximum number of cached responses
+	cacheMaxEntries = flag.Int("cache-max-entries", 4096, "Maximum number of cached responses (zero disables caching)")
+
+	// cacheTTL is the time for which we cache responses
+	cacheTTL = flag.Duration("cache-ttl", 5*time.Minute, "Time for which we cache responses (zero disables caching)")
+
+	// cacheUncommonEndpoints controls whether to cache requests with uncommon endpoints
+	cacheUncommonEndpoints = flag.Bool("cache-uncommon-endpoints", false, "Also cache requests using ports other than 80 and 443")
+
 	// debug controls whether to enable verbose logging
 	debug = flag.Bool("debug", false, "Toggle debug mode")
 
 	// pprofEndpoint is the endpoint where we serve pprof info.
 	pprofEndpoint = flag.String("pprof-endpoint", "127.0.0.1:6061", "Pprof endpoint")
 
+	// rateLimitClientASNBurst is the burst of the per-client-ASN rate limiting policy
+	rateLimitClientASNBurst = flag.Int("rate-limit-client-asn-burst", 0, "Maximum burst of requests from each client ASN (zero disables rate limiting)")
+
+	// rateLimitClientASNRate is the rate of the per-client-ASN rate limiting policy
+	rateLimitClientASNRate = flag.Float64("rate-limit-client-asn-rate", 0, "Requests per second allowed from each client ASN (zero disables rate limiting)")
+
+	// rateLimitClientIPBurst is the burst of the per-client-IP rate limiting policy
+	rateLimitClientIPBurst = flag.Int("rate-limit-client-ip-burst", 0, "Maximum burst of requests from each client IP address (zero disables rate limiting)")
+
+	// rateLimitClientIPRate is the rate of the per-client-IP rate limiting policy
+	rateLimitClientIPRate = flag.Float64("rate-limit-client-ip-rate", 0, "Requests per second allowed from each client IP address (zero disables rate limiting)")
+
+	// rateLimitClientIPHeader is the header containing the client IP address
+	rateLimitClientIPHeader = flag.String("rate-limit-client-ip-header", "", "Header containing the client IP address when running behind a reverse proxy (e.g., X-Forwarded-For)")
+
+	// rateLimitDomainBurst is the burst of the per-domain rate limiting policy
+	rateLimitDomainBurst = flag.Int("rate-limit-domain-burst", 0, "Maximum burst of measurements of each domain (zero disables rate limiting)")
+
+	// rateLimitDomainRate is the rate of the per-domain rate limiting policy
+	rateLimitDomainRate = flag.Float64("rate-limit-domain-rate", 0, "Measurements per second allowed for each domain (zero disables rate limiting)")
+
 	// replace runs the commands to replace a running oohelperd.
 	replace = flag.Bool("replace", false, "Replaces a running oohelperd instance")
 
@@ -44,6 +75,9 @@ var (
 	// srvWg is used by tests to know when the server has shut down
 	srvWg = new(sync.WaitGroup)
 
+	// vantages contains the additional vantage points
+	vantages = flag.String("vantages", "", "Comma separated list of additional vantage points (e.g., de=socks5://10.0.0.1:1080,us=http://10.0.0.2:3128)")
+
 	// versionFlag indicates we must print the version on stdout
 	versionFlag = flag.Bool("version", false, "Prints version information on the stdout")
 
@@ -63,6 +97,31 @@ func shutdown(srv *http.Server, wg *sync.WaitGroup) {
 	_ = srv.Shutdown(ctx)
 }
 
+// parseVantages parses the value of the -vantages flag.
+func parseVantages(value string) (out []*oohelperd.VantagePoint, err error) {
+	names := map[string]bool{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, proxyURL, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("%w: expected name=proxyURL, got %s", oohelperd.ErrVantagePointInvalid, entry)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("%w: duplicate name: %s", oohelperd.ErrVantagePointInvalid, name)
+		}
+		names[name] = true
+		vp, err := oohelperd.NewVantagePoint(name, proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, vp)
+	}
+	return out, nil
+}
+
 func main() {
 	// parse command line options
 	flag.Parse()
@@ -92,7 +151,19 @@ func main() {
 	mux := http.NewServeMux()
 
 	// add the main oohelperd handler to the mux
-	mux.Handle("/", oohelperd.NewHandler(log.Log, &netxlite.Netx{}))
+	handler := oohelperd.NewHandler(log.Log, &netxlite.Netx{})
+	handler.CacheBypassUncommonEndpoints = !*cacheUncommonEndpoints
+	handler.CacheMaxEntries = *cacheMaxEntries
+	handler.CacheTTL = *cacheTTL
+	handler.RateLimitClientASN = oohelperd.RateLimitPolicy{Burst: *rateLimitClientASNBurst, Rate: *rateLimitClientASNRate}
+	handler.RateLimitClientIP = oohelperd.RateLimitPolicy{Burst: *rateLimitClientIPBurst, Rate: *rateLimitClientIPRate}
+	handler.RateLimitClientIPHeader = *rateLimitClientIPHeader
+	handler.RateLimitDomain = oohelperd.RateLimitPolicy{Burst: *rateLimitDomainBurst, Rate: *rateLimitDomainRate}
+	if (*rateLimitClientASNRate > 0 || *rateLimitClientIPRate > 0) && *rateLimitClientIPHeader == "" {
+		log.Warn("rate limiting clients using the remote address: if you are running behind a reverse proxy, set -rate-limit-client-ip-header")
+	}
+	handler.Vantages = runtimex.Try1(parseVantages(*vantages))
+	mux.Handle("/", handler)
 	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
 		user, pass, ok := req.BasicAuth()
 		if ok && user == "prom" && pass == prometheusMetricsPassword {
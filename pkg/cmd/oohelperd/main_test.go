@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/url"
 	"strings"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/ooni/probe-engine/pkg/model"
 	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/oohelperd"
 	"github.com/ooni/probe-engine/pkg/runtimex"
 )
 
@@ -104,3 +106,30 @@ func TestMainVersionWorkingAsIntended(t *testing.T) {
 	main()
 	*versionFlag = false
 }
+
+func TestParseVantages(t *testing.T) {
+	t.Run("with an empty value", func(t *testing.T) {
+		vps, err := parseVantages("")
+		if err != nil || len(vps) != 0 {
+			t.Fatal("unexpected result", vps, err)
+		}
+	})
+
+	t.Run("with valid vantage points", func(t *testing.T) {
+		vps, err := parseVantages("de=socks5://10.0.0.1:1080, us=http://10.0.0.2:3128")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vps) != 2 || vps[0].Name != "de" || vps[1].ProxyURL.Host != "10.0.0.2:3128" {
+			t.Fatal("unexpected vantage points", vps)
+		}
+	})
+
+	for _, value := range []string{"de", "de=ftp://10.0.0.1", "de=socks5://10.0.0.1:1080,de=http://10.0.0.2:3128"} {
+		t.Run("with invalid value "+value, func(t *testing.T) {
+			if _, err := parseVantages(value); !errors.Is(err, oohelperd.ErrVantagePointInvalid) {
+				t.Fatal("unexpected error", err)
+			}
+		})
+	}
+}
@@ -10,11 +10,13 @@ import (
 	"os"
 	"time"
 
+	"filippo.io/age"
 	"github.com/apex/log"
 
 	"github.com/ooni/probe-engine/pkg/engine"
 	"github.com/ooni/probe-engine/pkg/fsx"
 	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/msmtcrypt"
 	"github.com/ooni/probe-engine/pkg/runtimex"
 	"github.com/ooni/probe-engine/pkg/version"
 	"github.com/pborman/getopt/v2"
@@ -42,7 +44,9 @@ const (
 )
 
 var (
-	path string
+	path          string
+	identityFiles = getopt.ListLong(
+		"identity", 'i', "age identity file for decrypting an encrypted report (can be repeated)")
 )
 
 func fatalIfFalse(cond bool, msg string) {
@@ -51,13 +55,14 @@ func fatalIfFalse(cond bool, msg string) {
 	}
 }
 
-func readLines(path string) []string {
+func readLines(path string, identities ...age.Identity) []string {
 	// open measurement file
 	file, err := os.Open(path) // #nosec G304 - this is working as intended
 	runtimex.PanicOnError(err, "Open file error.")
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	// decrypt the lines encrypted using filippo.io/age, if any
+	scanner := bufio.NewScanner(msmtcrypt.NewReader(file, identities...))
 	// the maximum line length should be selected really big
 	const maxCapacity = 800000
 	buf := make([]byte, maxCapacity)
@@ -69,6 +74,7 @@ func readLines(path string) []string {
 		line := scanner.Text()
 		lines = append(lines, line)
 	}
+	runtimex.PanicOnError(scanner.Err(), "Read file error.")
 	return lines
 }
 
@@ -116,12 +122,18 @@ func submitAll(ctx context.Context, lines []string, subm model.Submitter) (int,
 }
 
 func mainWithArgs(args []string) {
-	fatalIfFalse(len(args) == 2, "Usage: ./oonireport upload <file>")
+	fatalIfFalse(len(args) == 2, "Usage: ./oonireport [-i <identity>] upload <file>")
 	fatalIfFalse(args[0] == "upload", "Unsupported operation")
 	fatalIfFalse(fsx.RegularFileExists(args[1]), "Cannot open measurement file")
 
 	path = args[1]
-	lines := readLines(path)
+	var identities []age.Identity
+	for _, filePath := range *identityFiles {
+		values, err := msmtcrypt.ParseIdentitiesFile(filePath)
+		runtimex.PanicOnError(err, "Cannot parse identity file")
+		identities = append(identities, values...)
+	}
+	lines := readLines(path, identities...)
 
 	ctx := context.Background()
 	sess := newSession(ctx)
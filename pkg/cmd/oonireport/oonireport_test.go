@@ -2,7 +2,11 @@ package main
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
+
+	"filippo.io/age"
+	"github.com/ooni/probe-engine/pkg/msmtcrypt"
 )
 
 func TestReadLines(t *testing.T) {
@@ -15,6 +19,27 @@ func TestReadLines(t *testing.T) {
 	}
 }
 
+func TestReadLinesEncrypted(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "report.jsonl")
+	for _, line := range readLines("testdata/testmeasurement.json") {
+		m := toMeasurement(line)
+		if err := msmtcrypt.SaveMeasurement(m, filename, identity.Recipient()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := readLines(filename, identity)
+	if len(lines) != 2 {
+		t.Fatal("unexpected number of measurements")
+	}
+	if mm := toMeasurement(lines[0]); mm.TestName == "" {
+		t.Fatal("unexpected measurement")
+	}
+}
+
 func TestNewSessionAndSubmitter(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skip test in short mode")
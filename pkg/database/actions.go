@@ -24,13 +24,22 @@ func Open(dbpath string) (*Database, error) {
 		return nil, err
 	}
 	return &Database{
-		sess: db,
+		readFile: os.ReadFile,
+		sess:     db,
 	}, nil
 }
 
 // Database is a database instance to store measurements
 type Database struct {
-	sess db.Session
+	readFile func(filePath string) ([]byte, error)
+	sess     db.Session
+}
+
+// SetMeasurementFileReader overrides the function used to read the measurement
+// files, which by default is [os.ReadFile]. This is useful to decrypt measurement
+// files encrypted at rest (see the msmtcrypt package).
+func (d *Database) SetMeasurementFileReader(fn func(filePath string) ([]byte, error)) {
+	d.readFile = fn
 }
 
 var _ model.WritableDatabase = &Database{}
@@ -112,7 +121,7 @@ func (d *Database) GetMeasurementJSON(msmtID int64) (map[string]interface{}, err
 		return nil, errors.New("cannot access measurement file")
 	}
 	measurementFilePath := measurement.DatabaseMeasurement.MeasurementFilePath.String
-	b, err := os.ReadFile(measurementFilePath) // #nosec G304 - this is working as intended
+	b, err := d.readFile(measurementFilePath)
 	if err != nil {
 		return nil, err
 	}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -433,6 +434,40 @@ func TestGetMeasurementJSON(t *testing.T) {
 	}
 }
 
+func TestGetMeasurementJSONWithMeasurementFileReader(t *testing.T) {
+	dir := t.TempDir()
+	database, err := Open(filepath.Join(dir, "main.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	network, err := database.CreateNetwork(&locationInfo{countryCode: "IT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := database.CreateResult(dir, "websites", network.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msmt, err := database.CreateMeasurement(
+		sql.NullString{}, "antani", result.MeasurementDir, 0, result.ID, sql.NullInt64{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var called string
+	database.SetMeasurementFileReader(func(filePath string) ([]byte, error) {
+		called = filePath
+		return []byte(`{"probe_asn":"AS30722"}`), nil
+	})
+	tk, err := database.GetMeasurementJSON(msmt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if called != msmt.MeasurementFilePath.String || tk["probe_asn"] != "AS30722" {
+		t.Fatal("did not use the measurement file reader")
+	}
+}
+
 // chansummary is used to test that we handle summary serialization errors.
 type chansummary chan int
 
@@ -109,7 +109,9 @@ func (e *experiment) SubmitAndUpdateMeasurementContext(
 	if report == nil {
 		return errors.New("report is not open")
 	}
-	return report.SubmitMeasurement(ctx, measurement)
+	err := report.SubmitMeasurement(ctx, measurement)
+	metricSubmissionsCount.WithLabelValues(e.testName, metricsOutcome(ctx, err)).Inc()
+	return err
 }
 
 // newMeasurement creates a new measurement for this experiment with the given input.
@@ -247,6 +249,9 @@ func (e *experiment) MeasureWithContext(
 	// Record when the experiment finished running.
 	stop := time.Now()
 
+	// Count the measurement by experiment and outcome.
+	metricMeasurementsCount.WithLabelValues(e.testName, metricsOutcome(ctx, err)).Inc()
+
 	// Handle the case where there was a fundamental error.
 	if err != nil {
 		return nil, err
@@ -0,0 +1,147 @@
+package engine
+
+//
+// Metrics definitions
+//
+// We register the metrics with the default prometheus registry, such that
+// applications embedding the engine can export them using promhttp.
+//
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/bytecounter"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// metricMeasurementsCount counts the measurements by experiment and outcome.
+	metricMeasurementsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ooniprobe_measurements_count",
+		Help: "Total number of measurements by experiment and outcome",
+	}, []string{"experiment", "outcome"})
+
+	// metricSubmissionsCount counts the submissions by experiment and outcome.
+	metricSubmissionsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ooniprobe_submissions_count",
+		Help: "Total number of measurement submissions by experiment and outcome",
+	}, []string{"experiment", "outcome"})
+
+	// metricBootstrapDurationSeconds is an histogram of the bootstrap latency.
+	metricBootstrapDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ooniprobe_bootstrap_duration_seconds",
+		Help:    "Time to lookup the backends and the probe location (in seconds)",
+		Buckets: prometheus.ExponentialBuckets(0.25, 2, 8),
+	}, []string{"phase", "outcome"})
+
+	// metricCheckInDurationSeconds is an histogram of the check-in latency.
+	metricCheckInDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ooniprobe_checkin_duration_seconds",
+		Help:    "Time to call the check-in API (in seconds)",
+		Buckets: prometheus.ExponentialBuckets(0.25, 2, 8),
+	}, []string{"outcome"})
+
+	// metricBytesSent counts the bytes sent by all the sessions.
+	metricBytesSent = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "ooniprobe_bytes_sent_count",
+		Help: "Total number of bytes sent by all the sessions",
+	}, func() float64 {
+		sent, _ := metricsByteCounters.totals()
+		return float64(sent)
+	})
+
+	// metricBytesReceived counts the bytes received by all the sessions.
+	metricBytesReceived = promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "ooniprobe_bytes_received_count",
+		Help: "Total number of bytes received by all the sessions",
+	}, func() float64 {
+		_, received := metricsByteCounters.totals()
+		return float64(received)
+	})
+)
+
+// metricsOutcome maps the given error to the outcome label value.
+func metricsOutcome(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case ctx.Err() != nil:
+		return "interrupted"
+	default:
+		return "failure"
+	}
+}
+
+// metricsObserveDuration observes the time elapsed since start using the given histogram.
+func metricsObserveDuration(histogram *prometheus.HistogramVec, start time.Time, labels ...string) {
+	histogram.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+}
+
+// metricsByteCountersSet tracks the byte counters of all the sessions such that
+// the bytes counters we export are monotonic across sessions.
+type metricsByteCountersSet struct {
+	// closedReceived contains the bytes received by closed sessions.
+	closedReceived int64
+
+	// closedSent contains the bytes sent by closed sessions.
+	closedSent int64
+
+	// live contains the counters of the sessions that are still open.
+	live map[*bytecounter.Counter]bool
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+}
+
+// metricsByteCounters contains the byte counters of all the sessions.
+var metricsByteCounters = &metricsByteCountersSet{}
+
+// add starts tracking the given byte counter.
+func (s *metricsByteCountersSet) add(counter *bytecounter.Counter) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	if s.live == nil {
+		s.live = make(map[*bytecounter.Counter]bool)
+	}
+	s.live[counter] = true
+}
+
+// remove stops tracking the given byte counter and accounts its bytes as closed.
+func (s *metricsByteCountersSet) remove(counter *bytecounter.Counter) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	if !s.live[counter] {
+		return
+	}
+	delete(s.live, counter)
+	s.closedSent += counter.BytesSent()
+	s.closedReceived += counter.BytesReceived()
+}
+
+// totals returns the total bytes sent and received.
+func (s *metricsByteCountersSet) totals() (sent, received int64) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	sent, received = s.closedSent, s.closedReceived
+	for counter := range s.live {
+		sent += counter.BytesSent()
+		received += counter.BytesReceived()
+	}
+	return
+}
+
+// metricsSubmitter is a [model.Submitter] that counts the submissions.
+type metricsSubmitter struct {
+	model.Submitter
+}
+
+// Submit implements model.Submitter.
+func (ms *metricsSubmitter) Submit(ctx context.Context, m *model.Measurement) error {
+	err := ms.Submitter.Submit(ctx, m)
+	metricSubmissionsCount.WithLabelValues(m.TestName, metricsOutcome(ctx, err)).Inc()
+	return err
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ooni/probe-engine/pkg/bytecounter"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsOutcome(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if v := metricsOutcome(ctx, nil); v != "success" {
+		t.Fatal("unexpected outcome", v)
+	}
+	if v := metricsOutcome(ctx, errors.New("mocked error")); v != "failure" {
+		t.Fatal("unexpected outcome", v)
+	}
+	cancel()
+	if v := metricsOutcome(ctx, errors.New("mocked error")); v != "interrupted" {
+		t.Fatal("unexpected outcome", v)
+	}
+}
+
+func TestMetricsByteCountersSet(t *testing.T) {
+	set := &metricsByteCountersSet{}
+	first, second := bytecounter.New(), bytecounter.New()
+	set.add(first)
+	set.add(second)
+	first.CountBytesSent(10)
+	first.CountBytesReceived(100)
+	second.CountBytesSent(1)
+	if sent, received := set.totals(); sent != 11 || received != 100 {
+		t.Fatal("unexpected totals", sent, received)
+	}
+
+	// make sure that the totals do not decrease after removing a counter
+	// and that removing the same counter twice does not double count
+	set.remove(first)
+	set.remove(first)
+	second.CountBytesReceived(1)
+	if sent, received := set.totals(); sent != 11 || received != 101 {
+		t.Fatal("unexpected totals", sent, received)
+	}
+}
+
+func TestMetricsSubmitter(t *testing.T) {
+	expected := errors.New("mocked error")
+	submitter := &metricsSubmitter{&mocks.Submitter{
+		MockSubmit: func(ctx context.Context, m *model.Measurement) error {
+			return expected
+		},
+	}}
+	counter := metricSubmissionsCount.WithLabelValues("antani_metrics", "failure")
+	before := testutil.ToFloat64(counter)
+	err := submitter.Submit(context.Background(), &model.Measurement{TestName: "antani_metrics"})
+	if !errors.Is(err, expected) {
+		t.Fatal("unexpected error", err)
+	}
+	if after := testutil.ToFloat64(counter); after != before+1 {
+		t.Fatal("the counter did not increase", before, after)
+	}
+}
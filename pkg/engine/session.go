@@ -8,6 +8,7 @@ import (
 	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ooni/probe-engine/pkg/bytecounter"
 	"github.com/ooni/probe-engine/pkg/enginelocate"
@@ -217,6 +218,7 @@ func NewSession(ctx context.Context, config SessionConfig) (*Session, error) {
 		proxyURL,
 		sess.resolver,
 	)
+	metricsByteCounters.add(sess.byteCounter)
 	return sess, nil
 }
 
@@ -293,7 +295,9 @@ func (s *Session) CheckIn(
 	if config.WebConnectivity.CategoryCodes == nil {
 		config.WebConnectivity.CategoryCodes = []string{}
 	}
+	start := time.Now()
 	resp, err := client.CheckIn(ctx, *config)
+	metricsObserveDuration(metricCheckInDurationSeconds, start, metricsOutcome(ctx, err))
 	if err != nil {
 		return nil, err
 	}
@@ -345,6 +349,9 @@ func (s *Session) doClose() {
 		s.tunnel.Stop()
 	}
 	_ = os.RemoveAll(s.tempDir)
+
+	// make sure the exported byte counters account for this session
+	metricsByteCounters.remove(s.byteCounter)
 }
 
 // GetTestHelpersByName returns the available test helpers that
@@ -460,7 +467,7 @@ func (s *Session) NewSubmitter(ctx context.Context) (model.Submitter, error) {
 	if err != nil {
 		return nil, err
 	}
-	return probeservices.NewSubmitter(psc, s.Logger()), nil
+	return &metricsSubmitter{probeservices.NewSubmitter(psc, s.Logger())}, nil
 }
 
 // newOrchestraClient creates a new orchestra client. This client is registered
@@ -673,11 +680,15 @@ func (s *Session) MaybeLookupBackendsContext(ctx context.Context) error {
 		return nil
 	}
 	s.queryProbeServicesCount.Add(1)
+	start := time.Now()
 	candidates := probeservices.TryAll(ctx, s, s.getAvailableProbeServicesUnlocked())
 	selected := probeservices.SelectBest(candidates)
 	if selected == nil {
+		metricsObserveDuration(metricBootstrapDurationSeconds, start, "backends",
+			metricsOutcome(ctx, ErrAllProbeServicesFailed))
 		return ErrAllProbeServicesFailed
 	}
+	metricsObserveDuration(metricBootstrapDurationSeconds, start, "backends", "success")
 	s.logger.Infof("session: using probe services: %+v", selected.Service)
 	s.selectedProbeService = &selected.Service
 	s.availableTestHelpers = selected.TestHelpers
@@ -714,7 +725,9 @@ func (s *Session) MaybeLookupLocationContext(ctx context.Context) error {
 	defer s.mu.Unlock()
 	s.mu.Lock()
 	if s.location == nil {
+		start := time.Now()
 		location, err := s.lookupLocationContext(ctx)
+		metricsObserveDuration(metricBootstrapDurationSeconds, start, "location", metricsOutcome(ctx, err))
 		if err != nil {
 			return err
 		}
@@ -7,6 +7,7 @@ package enginenetx
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/ooni/probe-engine/pkg/model"
 	"github.com/ooni/probe-engine/pkg/netxlite"
@@ -47,24 +48,65 @@ func (p *dnsPolicy) LookupTactics(
 		// on why here we MUST make sure we short-circuit IP addresses.
 		resoWithShortCircuit := &netxlite.ResolverShortCircuitIPAddr{Resolver: p.Resolver}
 
-		addrs, err := resoWithShortCircuit.LookupHost(ctx, domain)
-		if err != nil {
-			p.Logger.Warnf("resoWithShortCircuit.LookupHost: %s", err.Error())
-			return
+		// The tactics we generate here have SNI == VerifyHostname == domain
+		seen := map[string]bool{}
+		emit := func(addrs []string) {
+			for _, addr := range addrs {
+				if seen[addr] {
+					continue
+				}
+				seen[addr] = true
+				tactic := &httpsDialerTactic{
+					Address:        addr,
+					InitialDelay:   0, // set when dialing
+					Port:           port,
+					SNI:            domain,
+					VerifyHostname: domain,
+				}
+				out <- tactic
+			}
 		}
 
-		// The tactics we generate here have SNI == VerifyHostname == domain
-		for _, addr := range addrs {
-			tactic := &httpsDialerTactic{
-				Address:        addr,
-				InitialDelay:   0, // set when dialing
-				Port:           port,
-				SNI:            domain,
-				VerifyHostname: domain,
+		// Also use the IP address hints inside the HTTPS records, which may
+		// point to addresses that the A/AAAA lookups did not return.
+		//
+		// We do not use the ECH configs: netxlite's TLS handshaker goes through
+		// oocrypto, which refuses tls.Config fields it does not know about,
+		// including EncryptedClientHelloConfigList. Only echcheck performs ECH,
+		// because it uses crypto/tls directly.
+		//
+		// Most resolvers we use (e.g., the session resolver) do not implement
+		// LookupHTTPS, so this lookup often fails. We run this lookup in
+		// parallel with LookupHost to avoid delaying the tactics.
+		hints := make(chan []string, 1)
+		go func() {
+			https, err := resoWithShortCircuit.LookupHTTPS(ctx, domain)
+			if err != nil {
+				p.Logger.Debugf("resoWithShortCircuit.LookupHTTPS: %s", err.Error())
+				hints <- nil
+				return
 			}
-			out <- tactic
+			hints <- dnsPolicyHTTPSHints(https, port)
+		}()
+
+		addrs, err := resoWithShortCircuit.LookupHost(ctx, domain)
+		if err != nil {
+			p.Logger.Warnf("resoWithShortCircuit.LookupHost: %s", err.Error())
+			// fallthrough to use the HTTPS hints, if any
 		}
+		emit(addrs)
+		emit(<-hints)
 	}()
 
 	return out
 }
+
+// dnsPolicyHTTPSHints returns the IP address hints inside the HTTPS lookup
+// result that are suitable for connecting to the given port.
+func dnsPolicyHTTPSHints(https *model.HTTPSSvc, port string) []string {
+	value, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil
+	}
+	return https.AddressHints(uint16(value))
+}
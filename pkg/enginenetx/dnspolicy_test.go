@@ -2,10 +2,14 @@ package enginenetx
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-engine/pkg/mocks"
 	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
 )
 
 func TestDNSPolicy(t *testing.T) {
@@ -72,4 +76,94 @@ func TestDNSPolicy(t *testing.T) {
 			t.Fatal("expected to see just one tactic")
 		}
 	})
+
+	t.Run("we also use the HTTPS records hints", func(t *testing.T) {
+		for _, lookupHostErr := range []error{nil, netxlite.ErrOODNSNoSuchHost} {
+			policy := &dnsPolicy{
+				Logger: model.DiscardLogger,
+				Resolver: &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						if lookupHostErr != nil {
+							return nil, lookupHostErr
+						}
+						return []string{"93.184.215.14"}, nil
+					},
+					MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+						return &model.HTTPSSvc{
+							Records: []*model.HTTPSSvcRecord{{
+								Priority:   0,
+								TargetName: "cdn.example.com.",
+							}, {
+								Priority:   1,
+								TargetName: ".",
+								IPv4:       []string{"93.184.215.14", "93.184.215.15"},
+								IPv6:       []string{"2606:2800:21f:cb07:6820:80da:af6b:8b2c"},
+							}, {
+								Priority:   2,
+								TargetName: ".",
+								Port:       8443,
+								IPv4:       []string{"93.184.215.16"},
+							}},
+						}, nil
+					},
+				},
+			}
+
+			tactics := policy.LookupTactics(context.Background(), "www.example.com", "443")
+
+			var got []string
+			for tactic := range tactics {
+				if tactic.Port != "443" || tactic.SNI != "www.example.com" || tactic.VerifyHostname != "www.example.com" {
+					t.Fatal("unexpected tactic", tactic)
+				}
+				got = append(got, tactic.Address)
+			}
+
+			// note: the hints still work when LookupHost fails and we do not emit duplicates
+			expect := []string{"93.184.215.14", "93.184.215.15", "2606:2800:21f:cb07:6820:80da:af6b:8b2c"}
+			if diff := cmp.Diff(expect, got); diff != "" {
+				t.Fatal(diff)
+			}
+		}
+	})
+
+	t.Run("we run LookupHTTPS in parallel with LookupHost", func(t *testing.T) {
+		httpsStarted := make(chan any)
+		policy := &dnsPolicy{
+			Logger: model.DiscardLogger,
+			Resolver: &mocks.Resolver{
+				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+					select {
+					case <-httpsStarted:
+						return []string{"93.184.215.14"}, nil
+					case <-time.After(10 * time.Second):
+						return nil, errors.New("LookupHTTPS did not start in parallel")
+					}
+				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					close(httpsStarted)
+					return &model.HTTPSSvc{
+						Records: []*model.HTTPSSvcRecord{{
+							Priority:   1,
+							TargetName: ".",
+							IPv4:       []string{"93.184.215.15"},
+						}},
+					}, nil
+				},
+			},
+		}
+
+		tactics := policy.LookupTactics(context.Background(), "www.example.com", "443")
+
+		var got []string
+		for tactic := range tactics {
+			got = append(got, tactic.Address)
+		}
+
+		// note: we emit the LookupHost results first
+		expect := []string{"93.184.215.14", "93.184.215.15"}
+		if diff := cmp.Diff(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
 }
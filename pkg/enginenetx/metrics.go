@@ -0,0 +1,21 @@
+package enginenetx
+
+//
+// Metrics definitions
+//
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// metricTacticsCount counts the outcome of the TLS dialing tactics we tried.
+var metricTacticsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ooniprobe_enginenetx_tactics_count",
+	Help: "Total number of TLS dialing tactics by verify hostname and outcome",
+}, []string{"domain", "outcome"})
+
+// metricsCountTactic increments the tactics counter for the given tactic and outcome.
+func metricsCountTactic(tactic *httpsDialerTactic, outcome string) {
+	metricTacticsCount.WithLabelValues(tactic.VerifyHostname, outcome).Inc()
+}
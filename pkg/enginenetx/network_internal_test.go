@@ -397,6 +397,9 @@ func TestNewHTTPSDialerPolicyFunctional(t *testing.T) {
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return nil, netxlite.ErrOODNSNoSuchHost
 				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, netxlite.ErrOODNSNoAnswer
+				},
 			},
 			domain:                 "www.example.com",
 			totalExpectedEntries:   0,
@@ -413,6 +416,9 @@ func TestNewHTTPSDialerPolicyFunctional(t *testing.T) {
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return []string{"93.184.215.14", "2606:2800:21f:cb07:6820:80da:af6b:8b2c"}, nil
 				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, netxlite.ErrOODNSNoAnswer
+				},
 			},
 			domain:               "www.example.com",
 			totalExpectedEntries: 2,
@@ -441,6 +447,9 @@ func TestNewHTTPSDialerPolicyFunctional(t *testing.T) {
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return nil, netxlite.ErrOODNSNoSuchHost
 				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, netxlite.ErrOODNSNoAnswer
+				},
 			},
 			domain:                 "api.ooni.io",
 			totalExpectedEntries:   152,
@@ -457,6 +466,9 @@ func TestNewHTTPSDialerPolicyFunctional(t *testing.T) {
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return []string{"130.192.91.211", "130.192.91.231"}, nil
 				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, netxlite.ErrOODNSNoAnswer
+				},
 			},
 			domain:               "api.ooni.io",
 			totalExpectedEntries: 154,
@@ -485,6 +497,9 @@ func TestNewHTTPSDialerPolicyFunctional(t *testing.T) {
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return nil, netxlite.ErrOODNSNoSuchHost
 				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, netxlite.ErrOODNSNoAnswer
+				},
 			},
 			domain:                 "0.th.ooni.org",
 			totalExpectedEntries:   0,
@@ -501,6 +516,9 @@ func TestNewHTTPSDialerPolicyFunctional(t *testing.T) {
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return []string{"130.192.91.211", "130.192.91.231"}, nil
 				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, netxlite.ErrOODNSNoAnswer
+				},
 			},
 			domain:               "0.th.ooni.org",
 			totalExpectedEntries: 306,
@@ -532,6 +550,9 @@ func TestNewHTTPSDialerPolicyFunctional(t *testing.T) {
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return nil, netxlite.ErrOODNSNoSuchHost
 				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, netxlite.ErrOODNSNoAnswer
+				},
 			},
 			domain:                 "www.example.com",
 			totalExpectedEntries:   0,
@@ -548,6 +569,9 @@ func TestNewHTTPSDialerPolicyFunctional(t *testing.T) {
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return []string{"93.184.215.14", "2606:2800:21f:cb07:6820:80da:af6b:8b2c"}, nil
 				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, netxlite.ErrOODNSNoAnswer
+				},
 			},
 			domain:               "www.example.com",
 			totalExpectedEntries: 2,
@@ -576,6 +600,9 @@ func TestNewHTTPSDialerPolicyFunctional(t *testing.T) {
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return nil, netxlite.ErrOODNSNoSuchHost
 				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, netxlite.ErrOODNSNoAnswer
+				},
 			},
 			domain:                 "api.ooni.io",
 			totalExpectedEntries:   0,
@@ -592,6 +619,9 @@ func TestNewHTTPSDialerPolicyFunctional(t *testing.T) {
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return []string{"130.192.91.211", "130.192.91.231"}, nil
 				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, netxlite.ErrOODNSNoAnswer
+				},
 			},
 			domain:               "api.ooni.io",
 			totalExpectedEntries: 2,
@@ -620,6 +650,9 @@ func TestNewHTTPSDialerPolicyFunctional(t *testing.T) {
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return nil, netxlite.ErrOODNSNoSuchHost
 				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, netxlite.ErrOODNSNoAnswer
+				},
 			},
 			domain:                 "0.th.ooni.org",
 			totalExpectedEntries:   0,
@@ -636,6 +669,9 @@ func TestNewHTTPSDialerPolicyFunctional(t *testing.T) {
 				MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
 					return []string{"130.192.91.211", "130.192.91.231"}, nil
 				},
+				MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+					return nil, netxlite.ErrOODNSNoAnswer
+				},
 			},
 			domain:               "0.th.ooni.org",
 			totalExpectedEntries: 2,
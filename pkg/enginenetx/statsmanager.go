@@ -499,8 +499,19 @@ func statsSafeIncrementMapStringInt64(input *map[string]int64, value string) {
 	(*input)[value]++
 }
 
+// statsInterruptedOrOutcome returns "interrupted" if the context is done and the outcome otherwise.
+func statsInterruptedOrOutcome(ctx context.Context, outcome string) string {
+	if ctx.Err() != nil {
+		return "interrupted"
+	}
+	return outcome
+}
+
 // OnTCPConnectError implements httpsDialerEventsHandler.
 func (mt *statsManager) OnTCPConnectError(ctx context.Context, tactic *httpsDialerTactic, err error) {
+	// update the exported metrics
+	metricsCountTactic(tactic, statsInterruptedOrOutcome(ctx, "tcp_connect_error"))
+
 	// get exclusive access
 	defer mt.mu.Unlock()
 	mt.mu.Lock()
@@ -526,6 +537,9 @@ func (mt *statsManager) OnTCPConnectError(ctx context.Context, tactic *httpsDial
 
 // OnTLSHandshakeError implements httpsDialerEventsHandler.
 func (mt *statsManager) OnTLSHandshakeError(ctx context.Context, tactic *httpsDialerTactic, err error) {
+	// update the exported metrics
+	metricsCountTactic(tactic, statsInterruptedOrOutcome(ctx, "tls_handshake_error"))
+
 	// get exclusive access
 	defer mt.mu.Unlock()
 	mt.mu.Lock()
@@ -551,6 +565,9 @@ func (mt *statsManager) OnTLSHandshakeError(ctx context.Context, tactic *httpsDi
 
 // OnTLSVerifyError implements httpsDialerEventsHandler.
 func (mt *statsManager) OnTLSVerifyError(tactic *httpsDialerTactic, err error) {
+	// update the exported metrics
+	metricsCountTactic(tactic, "tls_verify_error")
+
 	// get exclusive access
 	defer mt.mu.Unlock()
 	mt.mu.Lock()
@@ -571,6 +588,9 @@ func (mt *statsManager) OnTLSVerifyError(tactic *httpsDialerTactic, err error) {
 
 // OnSuccess implements httpsDialerEventsHandler.
 func (mt *statsManager) OnSuccess(tactic *httpsDialerTactic) {
+	// update the exported metrics
+	metricsCountTactic(tactic, "success")
+
 	// get exclusive access
 	defer mt.mu.Unlock()
 	mt.mu.Lock()
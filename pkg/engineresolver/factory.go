@@ -1,7 +1,9 @@
 package engineresolver
 
 import (
+	"context"
 	"errors"
+	"net"
 	"net/url"
 
 	"github.com/ooni/probe-engine/pkg/bytecounter"
@@ -14,8 +16,12 @@ import (
 // child resolver using HTTP/3 with a proxy URL.
 var errCannotUseHTTP3WithAProxyURL = errors.New("cannot use HTTP/3 with a proxy URL")
 
+// errCannotUseDoQWithAProxyURL means we cannot construct a new
+// child resolver using DNS-over-QUIC with a proxy URL.
+var errCannotUseDoQWithAProxyURL = errors.New("cannot use DNS-over-QUIC with a proxy URL")
+
 // errUnsupportedResolverScheme means we don't support the
-// given resolver scheme. We only support https, http and system.
+// given resolver scheme. We only support https, http, dot, doq, odoh and system.
 var errUnsupportedResolverScheme = errors.New("unsupported resolver scheme")
 
 // newChildResolver constructs a new child resolver.
@@ -24,7 +30,7 @@ var errUnsupportedResolverScheme = errors.New("unsupported resolver scheme")
 //
 // - logger is the MANDATORY logger;
 //
-// - URL is the MANDATORY URL to use (a DoH URL or system:///);
+// - URL is the MANDATORY URL to use (a DoH URL, a dot://, doq:// or odoh:// URL, or system:///);
 //
 // - http3Enabled indicates whether to use HTTP/3;
 //
@@ -32,8 +38,8 @@ var errUnsupportedResolverScheme = errors.New("unsupported resolver scheme")
 //
 // - proxyURL is the OPTIONAL proxy URL.
 //
-// Using a proxy URL is incompatible with using HTTP/3 and this
-// factory will return an error if that happens.
+// Using a proxy URL is incompatible with using HTTP/3 or DNS-over-QUIC and
+// this factory will return an error if that happens.
 //
 // This function returns a model.Resolver or an error.
 func newChildResolver(
@@ -56,6 +62,21 @@ func newChildResolver(
 	switch parsed.Scheme {
 	case "http", "https": // http is here for testing
 		reso = newChildResolverHTTPS(logger, URL, http3Enabled, counter, proxyURL)
+	case "odoh":
+		reso = newChildResolverODoH(logger, URL, http3Enabled, counter, proxyURL)
+	case "dot":
+		reso, err = newChildResolverDoT(logger, parsed, counter, proxyURL)
+		if err != nil {
+			return nil, err
+		}
+	case "doq":
+		if proxyURL != nil {
+			return nil, errCannotUseDoQWithAProxyURL
+		}
+		reso, err = newChildResolverDoQ(logger, parsed)
+		if err != nil {
+			return nil, err
+		}
 	case "system":
 		netx := &netxlite.Netx{}
 		reso = bytecounter.MaybeWrapSystemResolver(
@@ -78,6 +99,36 @@ func newChildResolverHTTPS(
 	counter *bytecounter.Counter,
 	proxyURL *url.URL,
 ) model.Resolver {
+	txp := newChildResolverHTTPTransport(logger, http3Enabled, counter, proxyURL)
+	dnstxp := netxlite.NewDNSOverHTTPSTransportWithHTTPTransport(txp, URL)
+	underlying := netxlite.NewUnwrappedParallelResolver(dnstxp)
+	wrapped := netxlite.WrapResolver(logger, underlying)
+	return wrapped
+}
+
+// newChildResolverODoH is like newChildResolver but assumes that
+// we already know that the URL scheme is odoh.
+func newChildResolverODoH(
+	logger model.Logger,
+	URL string,
+	http3Enabled bool,
+	counter *bytecounter.Counter,
+	proxyURL *url.URL,
+) model.Resolver {
+	txp := newChildResolverHTTPTransport(logger, http3Enabled, counter, proxyURL)
+	dnstxp := netxlite.NewDNSOverODoHTransportWithHTTPTransport(txp, URL)
+	underlying := netxlite.NewUnwrappedParallelResolver(dnstxp)
+	return netxlite.WrapResolver(logger, underlying)
+}
+
+// newChildResolverHTTPTransport creates the HTTP transport used
+// by the DNS-over-HTTPS and the ODoH child resolvers.
+func newChildResolverHTTPTransport(
+	logger model.Logger,
+	http3Enabled bool,
+	counter *bytecounter.Counter,
+	proxyURL *url.URL,
+) model.HTTPTransport {
 	var txp model.HTTPTransport
 	netx := &netxlite.Netx{}
 	switch http3Enabled {
@@ -93,9 +144,63 @@ func newChildResolverHTTPS(
 	case true:
 		txp = netx.NewHTTP3TransportStdlib(logger)
 	}
-	txp = bytecounter.MaybeWrapHTTPTransport(txp, counter)
-	dnstxp := netxlite.NewDNSOverHTTPSTransportWithHTTPTransport(txp, URL)
+	return bytecounter.MaybeWrapHTTPTransport(txp, counter)
+}
+
+// newChildResolverDoT is like newChildResolver but assumes that
+// we already know that the URL scheme is dot.
+func newChildResolverDoT(
+	logger model.Logger,
+	URL *url.URL,
+	counter *bytecounter.Counter,
+	proxyURL *url.URL,
+) (model.Resolver, error) {
+	endpoint, err := newChildResolverEndpoint(URL)
+	if err != nil {
+		return nil, err
+	}
+	netx := &netxlite.Netx{}
+	dialer := netxlite.MaybeWrapWithProxyDialer(
+		netxlite.NewDialerWithStdlibResolver(logger),
+		proxyURL, // nil here disables using the proxy
+	)
+	thx := netx.NewTLSHandshakerStdlib(logger)
+	tlsDialer := netxlite.NewTLSDialer(dialer, thx)
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := tlsDialer.DialTLSContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return bytecounter.MaybeWrapConn(conn, counter), nil
+	}
+	dnstxp := netxlite.NewDNSOverTLSTransport(dial, endpoint)
 	underlying := netxlite.NewUnwrappedParallelResolver(dnstxp)
-	wrapped := netxlite.WrapResolver(logger, underlying)
-	return wrapped
+	return netxlite.WrapResolver(logger, underlying), nil
+}
+
+// newChildResolverDoQ is like newChildResolver but assumes that
+// we already know that the URL scheme is doq.
+//
+// TODO(https://github.com/ooni/probe/issues/2121#issuecomment-1147424810): we
+// should count the bytes consumed by this resolver
+func newChildResolverDoQ(logger model.Logger, URL *url.URL) (model.Resolver, error) {
+	endpoint, err := newChildResolverEndpoint(URL)
+	if err != nil {
+		return nil, err
+	}
+	netx := &netxlite.Netx{}
+	return netx.NewParallelDNSOverQUICResolver(logger, endpoint), nil
+}
+
+// newChildResolverEndpoint returns the endpoint of a dot or doq URL
+// using the default port (i.e., 853) when the URL does not contain a port.
+func newChildResolverEndpoint(URL *url.URL) (string, error) {
+	if URL.Hostname() == "" {
+		return "", errors.New("missing hostname in resolver URL")
+	}
+	port := URL.Port()
+	if port == "" {
+		port = "853"
+	}
+	return net.JoinHostPort(URL.Hostname(), port), nil
 }
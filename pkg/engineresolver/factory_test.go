@@ -12,11 +12,13 @@ import (
 	"testing"
 
 	"github.com/miekg/dns"
+	"github.com/ooni/netem"
 	"github.com/ooni/probe-engine/pkg/bytecounter"
 	"github.com/ooni/probe-engine/pkg/mocks"
 	"github.com/ooni/probe-engine/pkg/model"
 	"github.com/ooni/probe-engine/pkg/netxlite"
 	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/ooni/probe-engine/pkg/testingx"
 )
 
 // testDNSOverHTTPSHandler is an [http.Handler] serving DNS over HTTPS.
@@ -104,7 +106,7 @@ func Test_newChildResolver(t *testing.T) {
 	t.Run("we return an error when we don't support the URL scheme", func(t *testing.T) {
 		reso, err := newChildResolver(
 			model.DiscardLogger,
-			"dot://8.8.8.8:853/",
+			"udp://8.8.8.8:53/",
 			true,
 			bytecounter.New(),
 			nil,
@@ -247,6 +249,122 @@ func Test_newChildResolver(t *testing.T) {
 		})
 	})
 
+	t.Run("for DNS-over-TLS resolvers", func(t *testing.T) {
+		ca := netem.MustNewCA()
+		config := netem.NewDNSConfig()
+		config.AddRecord("dns.google", "", "8.8.8.8")
+		listener := testingx.MustNewDNSOverTLSListener(
+			&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+			&testingx.TCPListenerStdlib{},
+			ca.MustNewServerTLSConfig("dns.example.com", "127.0.0.1"),
+			testingx.NewDNSRoundTripperWithDNSConfig(config),
+		)
+		defer listener.Close()
+		URL := "dot://" + listener.LocalAddr().String()
+
+		t.Run("the returned resolver wraps errors", func(t *testing.T) {
+			// Because we're using a testing server w/o installing its
+			// certificate, we expect to see a TLS failure here
+			reso, err := newChildResolver(model.DiscardLogger, URL, false, bytecounter.New(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			addrs, err := reso.LookupHost(context.Background(), "dns.google")
+			if err == nil || err.Error() != netxlite.FailureSSLUnknownAuthority {
+				t.Fatal("unexpected error", err)
+			}
+			if len(addrs) != 0 {
+				t.Fatal("expected zero length addrs here")
+			}
+		})
+
+		t.Run("we count the bytes received and sent", func(t *testing.T) {
+			counter := bytecounter.New()
+			tproxy := &netxlite.DefaultTProxy{}
+			mocked := &mocks.UnderlyingNetwork{
+				MockDefaultCertPool:            ca.DefaultCertPool,
+				MockDialTimeout:                tproxy.DialTimeout,
+				MockDialContext:                tproxy.DialContext,
+				MockGetaddrinfoLookupANY:       tproxy.GetaddrinfoLookupANY,
+				MockGetaddrinfoResolverNetwork: tproxy.GetaddrinfoResolverNetwork,
+			}
+			netxlite.WithCustomTProxy(mocked, func() {
+				reso, err := newChildResolver(model.DiscardLogger, URL, false, counter, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				addrs, err := reso.LookupHost(context.Background(), "dns.google")
+				if err != nil {
+					t.Fatal("unexpected error", err)
+				}
+				if len(addrs) != 1 || addrs[0] != "8.8.8.8" {
+					t.Fatal("unexpected addrs", addrs)
+				}
+			})
+			if counter.BytesReceived() <= 0 {
+				t.Fatal("expected to see received bytes")
+			}
+			if counter.BytesSent() <= 0 {
+				t.Fatal("expected to see sent bytes")
+			}
+		})
+
+		t.Run("we return an error when the URL has no hostname", func(t *testing.T) {
+			reso, err := newChildResolver(model.DiscardLogger, "dot:///", false, bytecounter.New(), nil)
+			if err == nil || reso != nil {
+				t.Fatal("expected an error", err)
+			}
+		})
+	})
+
+	t.Run("for DNS-over-QUIC resolvers", func(t *testing.T) {
+		t.Run("we cannot create a resolver with a proxy URL", func(t *testing.T) {
+			reso, err := newChildResolver(
+				model.DiscardLogger,
+				"doq://94.140.14.140",
+				false,
+				bytecounter.New(),
+				&url.URL{}, // even an empty URL is enough
+			)
+			if !errors.Is(err, errCannotUseDoQWithAProxyURL) {
+				t.Fatal("unexpected error", err)
+			}
+			if reso != nil {
+				t.Fatal("expected nil resolver here")
+			}
+		})
+
+		t.Run("we use the default port", func(t *testing.T) {
+			reso, err := newChildResolver(model.DiscardLogger, "doq://94.140.14.140", false, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reso.Network() != "doq" || reso.Address() != "94.140.14.140:853" {
+				t.Fatal("unexpected resolver", reso.Network(), reso.Address())
+			}
+		})
+
+		t.Run("we return an error when the URL has no hostname", func(t *testing.T) {
+			reso, err := newChildResolver(model.DiscardLogger, "doq:///", false, nil, nil)
+			if err == nil || reso != nil {
+				t.Fatal("expected an error", err)
+			}
+		})
+	})
+
+	t.Run("for ODoH resolvers", func(t *testing.T) {
+		const URL = "odoh://odoh1.surfdomeinen.nl/odoh.cloudflare-dns.com"
+		for _, proxyURL := range []*url.URL{nil, {Scheme: "socks5", Host: "127.0.0.1:9050"}} {
+			reso, err := newChildResolver(model.DiscardLogger, URL, false, bytecounter.New(), proxyURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reso.Network() != "odoh" || reso.Address() != URL {
+				t.Fatal("unexpected resolver", reso.Network(), reso.Address())
+			}
+		}
+	})
+
 	t.Run("for the system resolver", func(t *testing.T) {
 
 		t.Run("the returned resolver wraps errors", func(t *testing.T) {
@@ -134,7 +134,7 @@ func (r *Resolver) shouldSkipWithProxy(e *resolverinfo) bool {
 		return true // please skip
 	}
 	switch URL.Scheme {
-	case "https", "dot", "tcp":
+	case "https", "dot", "odoh", "tcp":
 		return false // we can handle this
 	default:
 		return true // please skip
@@ -355,6 +355,9 @@ func TestShouldSkipWithProxyWorks(t *testing.T) {
 	}, {
 		url:    "dot://dns.google/",
 		result: false,
+	}, {
+		url:    "odoh://odoh1.surfdomeinen.nl/odoh.cloudflare-dns.com",
+		result: false,
 	}, {
 		url:    "http3://dns.google/dns-query",
 		result: true,
@@ -166,7 +166,7 @@ func (m *Measurer) Run(ctx context.Context, args *model.ExperimentArgs) error {
 		return fmt.Errorf("%w: %s", ErrInvalidURL, err.Error())
 	}
 	switch URL.Scheme {
-	case "https", "dot", "udp", "tcp":
+	case "https", "dot", "doq", "odoh", "udp", "tcp":
 		// all good
 	default:
 		return ErrUnsupportedURLScheme
@@ -174,13 +174,31 @@ func (m *Measurer) Run(ctx context.Context, args *model.ExperimentArgs) error {
 
 	// Implementation note: we must not return an error from now now. Returning an
 	// error means that we don't have a measurement to submit.
+	begin := measurement.MeasurementStartTimeSaved
+
+	// ODoH involves two distinct hosts, the proxy and the target, hence we
+	// cannot replace the URL hostname with IP addresses and we cannot override
+	// the HTTP host and the SNI. So, we measure the input URL as-is.
+	if URL.Scheme == "odoh" {
+		multi := urlgetter.Multi{Begin: begin, Parallelism: 1, Session: sess}
+		inputs := []urlgetter.MultiInput{{
+			Config: urlgetter.Config{
+				DNSTLSVersion:   config.TLSVersion,
+				RejectDNSBogons: true, // bogons are errors in this context
+				ResolverURL:     URL.String(),
+				Timeout:         15 * time.Second,
+			},
+			Target: fmt.Sprintf("dnslookup://%s", domain), // urlgetter wants a URL
+		}}
+		m.measure(ctx, sess, multi, inputs, tk)
+		return nil
+	}
 
 	// 4. possibly expand a domain to a list of IP addresses.
 	//
 	// Implementation note: because the resolver we constructed also deals
 	// with IP addresses successfully, we just get back the IPs when we are
 	// passing as input an IP address rather than a domain name.
-	begin := measurement.MeasurementStartTimeSaved
 	evsaver := new(tracex.Saver)
 	resolver := netx.NewResolver(netx.Config{
 		BogonIsError: true,
@@ -231,20 +249,27 @@ func (m *Measurer) Run(ctx context.Context, args *model.ExperimentArgs) error {
 		})
 	}
 
-	// 7. make sure we don't test the same endpoint too frequently
+	// 7. measure all the required inputs
+	m.measure(ctx, sess, multi, inputs, tk)
+	return nil
+}
+
+// measure performs the given lookups and stores the results into the test keys.
+func (m *Measurer) measure(ctx context.Context, sess model.ExperimentSession,
+	multi urlgetter.Multi, inputs []urlgetter.MultiInput, tk *TestKeys) {
+	// 1. make sure we don't test the same endpoint too frequently
 	// because this may cause residual censorship.
 	for _, input := range inputs {
 		resolverURL := input.Config.ResolverURL
 		m.Endpoints.maybeSleep(resolverURL, sess.Logger())
 	}
 
-	// 8. perform all the required resolutions
+	// 2. perform all the required resolutions
 	for output := range Collect(ctx, multi, inputs, sess.Logger()) {
 		resolverURL := output.Input.Config.ResolverURL
 		tk.Lookups[resolverURL] = output.TestKeys
 		m.Endpoints.maybeRegister(resolverURL)
 	}
-	return nil
 }
 
 func (m *Measurer) lookupHost(ctx context.Context, hostname string, r model.Resolver) ([]string, error) {
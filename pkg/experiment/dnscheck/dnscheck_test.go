@@ -139,6 +139,36 @@ func TestWithCancelledContext(t *testing.T) {
 	}
 }
 
+func TestDNSCheckWithODoHMeasuresTheURLAsIs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // immediately cancel the context
+	const URL = "odoh://odoh1.surfdomeinen.nl/odoh.cloudflare-dns.com"
+	measurer := NewExperimentMeasurer()
+	measurement := &model.Measurement{Input: URL}
+	args := &model.ExperimentArgs{
+		Callbacks:   model.NewPrinterCallbacks(log.Log),
+		Measurement: measurement,
+		Session:     newsession(),
+		Target: &Target{
+			URL: URL,
+			Config: &Config{
+				DefaultAddrs: "1.1.1.1 1.0.0.1",
+			},
+		},
+	}
+	err := measurer.Run(ctx, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := measurement.TestKeys.(*TestKeys)
+	if tk.Bootstrap != nil {
+		t.Fatal("expected no bootstrap")
+	}
+	if _, found := tk.Lookups[URL]; !found || len(tk.Lookups) != 1 {
+		t.Fatal("unexpected lookups", tk.Lookups)
+	}
+}
+
 func TestDNSCheckFailsWithNilTarget(t *testing.T) {
 	measurer := NewExperimentMeasurer()
 	measurement := &model.Measurement{Input: "dot://one.one.one.one"}
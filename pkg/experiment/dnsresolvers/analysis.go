@@ -0,0 +1,159 @@
+package dnsresolvers
+
+//
+// Code to analyze the results of each check
+//
+
+import (
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/pkg/geoipx"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// analysisContext contains the information shared by the
+// analysis of all the public resolvers.
+type analysisContext struct {
+	// ISPResolvers contains the addresses of the ISP resolvers.
+	ISPResolvers []string
+
+	// ProbeASN is the probe ASN or zero if unknown.
+	ProbeASN uint
+
+	// ReferenceTTL is the authoritative TTL or nil if unknown.
+	ReferenceTTL *uint32
+}
+
+// analyzeInterception returns whether the whoami addresses obtained by querying the
+// resolver at the given address indicate that someone else answered in its place, which
+// happens when the whoami addresses do not belong to the resolver's ASN and instead
+// belong to the probe ASN or are the ISP resolvers. This function returns nil when
+// the whoami lookup failed, therefore we cannot say anything.
+func analyzeInterception(address string, whoami []string, actx *analysisContext) *bool {
+	if len(whoami) <= 0 {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	resolverASN, _, _ := geoipx.LookupASN(host) // zero on failure
+
+	value := false
+	for _, addr := range whoami {
+		asn, _, _ := geoipx.LookupASN(addr) // zero on failure
+		if asn != 0 && asn == resolverASN {
+			continue // consistent with the resolver we addressed
+		}
+		if (actx.ProbeASN != 0 && asn == actx.ProbeASN) || slices.Contains(actx.ISPResolvers, addr) {
+			value = true
+			break
+		}
+	}
+	return &value
+}
+
+// analyzeNXDOMAIN returns whether the result of looking up a nonexisting
+// domain indicates NXDOMAIN rewriting. This function returns nil when the
+// lookup failed with an error different from NXDOMAIN.
+func analyzeNXDOMAIN(addrs []string, err error) *bool {
+	switch {
+	case err == nil && len(addrs) > 0:
+		value := true
+		return &value
+	case err != nil && err.Error() == netxlite.FailureDNSNXDOMAINError:
+		value := false
+		return &value
+	default:
+		return nil
+	}
+}
+
+// analyzeECS extracts the EDNS client subnet from the TXT records of the
+// ecsDomain and returns whether the resolver leaked our subnet. This function
+// returns nil when the response does not contain any TXT record.
+func analyzeECS(resp model.DNSResponse) (string, *bool) {
+	msg := &dns.Msg{}
+	if err := msg.Unpack(resp.Bytes()); err != nil {
+		return "", nil
+	}
+	var (
+		found  bool
+		subnet string
+	)
+	for _, answer := range msg.Answer {
+		txt, ok := answer.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		found = true
+		for _, entry := range txt.Txt {
+			if value, good := strings.CutPrefix(entry, "edns0-client-subnet "); good {
+				subnet = value
+			}
+		}
+	}
+	if !found {
+		return "", nil
+	}
+	value := subnet != ""
+	return subnet, &value
+}
+
+// analyzeTTL returns whether the TTL returned by the resolver is larger than the
+// authoritative TTL, which indicates that the resolver rewrites the TTL. A smaller TTL
+// is expected since resolvers decrement the TTL of cached answers. This function returns
+// nil when we do not know either of the two TTLs.
+func analyzeTTL(ttl *uint32, reference *uint32) *bool {
+	if ttl == nil || reference == nil {
+		return nil
+	}
+	value := *ttl > *reference
+	return &value
+}
+
+// dnsMinimumTTL returns the minimum TTL of the answers with the given qtype
+// contained in the response or nil if there are no such answers.
+func dnsMinimumTTL(resp model.DNSResponse, qtype uint16) (out *uint32) {
+	msg := &dns.Msg{}
+	if err := msg.Unpack(resp.Bytes()); err != nil {
+		return nil
+	}
+	for _, answer := range msg.Answer {
+		header := answer.Header()
+		if header.Rrtype != qtype {
+			continue
+		}
+		if out == nil || header.Ttl < *out {
+			ttl := header.Ttl
+			out = &ttl
+		}
+	}
+	return
+}
+
+// mergeVerdicts computes the overall verdict from the verdicts of each resolver. Each
+// field is true if any resolver has it true, false if no resolver has it true and at least
+// one resolver has it false, and nil otherwise.
+func mergeVerdicts(results []*ResolverResult) *Verdict {
+	out := &Verdict{}
+	for _, result := range results {
+		out.Interception = mergeFlag(out.Interception, result.Verdict.Interception)
+		out.NXDOMAINRewriting = mergeFlag(out.NXDOMAINRewriting, result.Verdict.NXDOMAINRewriting)
+		out.ECSLeak = mergeFlag(out.ECSLeak, result.Verdict.ECSLeak)
+		out.TTLManipulation = mergeFlag(out.TTLManipulation, result.Verdict.TTLManipulation)
+	}
+	return out
+}
+
+// mergeFlag merges the current flag with a new flag.
+func mergeFlag(current, flag *bool) *bool {
+	if current == nil || (flag != nil && *flag) {
+		return flag
+	}
+	return current
+}
@@ -0,0 +1,301 @@
+package dnsresolvers
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// newFlag returns a pointer to the given value.
+func newFlag(value bool) *bool {
+	return &value
+}
+
+// flagToString converts a flag to string for diagnostics.
+func flagToString(flag *bool) string {
+	switch {
+	case flag == nil:
+		return "nil"
+	case *flag:
+		return "true"
+	default:
+		return "false"
+	}
+}
+
+// newResponseWithAnswers returns a [model.DNSResponse] containing the given answers.
+func newResponseWithAnswers(answers ...dns.RR) model.DNSResponse {
+	msg := &dns.Msg{}
+	msg.SetQuestion("example.com.", dns.TypeA)
+	msg.Response = true
+	msg.Answer = answers
+	data := runtimex.Try1(msg.Pack())
+	return &mocks.DNSResponse{
+		MockBytes: func() []byte {
+			return data
+		},
+	}
+}
+
+func TestAnalyzeInterception(t *testing.T) {
+	actx := &analysisContext{
+		ISPResolvers: []string{"130.192.3.21"},
+		ProbeASN:     137,
+		ReferenceTTL: nil,
+	}
+
+	cases := []struct {
+		name    string
+		address string
+		whoami  []string
+		expect  *bool
+	}{{
+		name:    "when the whoami lookup failed",
+		address: "8.8.8.8:53",
+		whoami:  nil,
+		expect:  nil,
+	}, {
+		name:    "when the whoami address belongs to the resolver ASN",
+		address: "8.8.8.8:53",
+		whoami:  []string{"74.125.18.1"},
+		expect:  newFlag(false),
+	}, {
+		name:    "when the whoami address is an ISP resolver",
+		address: "8.8.8.8:53",
+		whoami:  []string{"130.192.3.21"},
+		expect:  newFlag(true),
+	}, {
+		name:    "when the whoami address belongs to the probe ASN",
+		address: "1.1.1.1:53",
+		whoami:  []string{"130.192.91.211"},
+		expect:  newFlag(true),
+	}, {
+		name:    "when the whoami address belongs to a third ASN",
+		address: "9.9.9.9:53",
+		whoami:  []string{"74.125.18.1"},
+		expect:  newFlag(false),
+	}, {
+		name:    "with an address without port",
+		address: "8.8.8.8",
+		whoami:  []string{"130.192.3.21"},
+		expect:  newFlag(true),
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := analyzeInterception(tc.address, tc.whoami, actx)
+			if flagToString(got) != flagToString(tc.expect) {
+				t.Fatal("expected", flagToString(tc.expect), "got", flagToString(got))
+			}
+		})
+	}
+}
+
+func TestAnalyzeNXDOMAIN(t *testing.T) {
+	cases := []struct {
+		name   string
+		addrs  []string
+		err    error
+		expect *bool
+	}{{
+		name:   "with addresses",
+		addrs:  []string{"10.10.34.35"},
+		err:    nil,
+		expect: newFlag(true),
+	}, {
+		name:   "with NXDOMAIN",
+		addrs:  nil,
+		err:    errors.New(netxlite.FailureDNSNXDOMAINError),
+		expect: newFlag(false),
+	}, {
+		name:   "with another error",
+		addrs:  nil,
+		err:    errors.New(netxlite.FailureGenericTimeoutError),
+		expect: nil,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := analyzeNXDOMAIN(tc.addrs, tc.err)
+			if flagToString(got) != flagToString(tc.expect) {
+				t.Fatal("expected", flagToString(tc.expect), "got", flagToString(got))
+			}
+		})
+	}
+}
+
+func TestAnalyzeECS(t *testing.T) {
+	newTXT := func(values ...string) dns.RR {
+		return &dns.TXT{
+			Hdr: dns.RR_Header{Name: ecsDomain + ".", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: values,
+		}
+	}
+
+	t.Run("with an EDNS client subnet", func(t *testing.T) {
+		resp := newResponseWithAnswers(newTXT("74.125.18.1"), newTXT("edns0-client-subnet 130.192.91.0/24"))
+		subnet, leak := analyzeECS(resp)
+		if subnet != "130.192.91.0/24" {
+			t.Fatal("unexpected subnet", subnet)
+		}
+		if flagToString(leak) != "true" {
+			t.Fatal("expected to see a leak")
+		}
+	})
+
+	t.Run("without an EDNS client subnet", func(t *testing.T) {
+		resp := newResponseWithAnswers(newTXT("74.125.18.1"))
+		subnet, leak := analyzeECS(resp)
+		if subnet != "" {
+			t.Fatal("unexpected subnet", subnet)
+		}
+		if flagToString(leak) != "false" {
+			t.Fatal("expected to see no leak")
+		}
+	})
+
+	t.Run("without TXT records", func(t *testing.T) {
+		resp := newResponseWithAnswers()
+		_, leak := analyzeECS(resp)
+		if leak != nil {
+			t.Fatal("expected nil")
+		}
+	})
+
+	t.Run("with an invalid response", func(t *testing.T) {
+		resp := &mocks.DNSResponse{
+			MockBytes: func() []byte {
+				return []byte{0xde, 0xad}
+			},
+		}
+		_, leak := analyzeECS(resp)
+		if leak != nil {
+			t.Fatal("expected nil")
+		}
+	})
+}
+
+func TestAnalyzeTTL(t *testing.T) {
+	newTTL := func(value uint32) *uint32 {
+		return &value
+	}
+
+	cases := []struct {
+		name      string
+		ttl       *uint32
+		reference *uint32
+		expect    *bool
+	}{{
+		name:      "with unknown TTL",
+		ttl:       nil,
+		reference: newTTL(300),
+		expect:    nil,
+	}, {
+		name:      "with unknown reference TTL",
+		ttl:       newTTL(300),
+		reference: nil,
+		expect:    nil,
+	}, {
+		name:      "with a cached answer",
+		ttl:       newTTL(117),
+		reference: newTTL(300),
+		expect:    newFlag(false),
+	}, {
+		name:      "with an inflated TTL",
+		ttl:       newTTL(3600),
+		reference: newTTL(300),
+		expect:    newFlag(true),
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := analyzeTTL(tc.ttl, tc.reference)
+			if flagToString(got) != flagToString(tc.expect) {
+				t.Fatal("expected", flagToString(tc.expect), "got", flagToString(got))
+			}
+		})
+	}
+}
+
+func TestDNSMinimumTTL(t *testing.T) {
+	newA := func(ttl uint32) dns.RR {
+		return &dns.A{
+			Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+			A:   net.IPv4(93, 184, 216, 34),
+		}
+	}
+	cname := &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 5},
+		Target: "www.example.com.",
+	}
+
+	t.Run("with A records", func(t *testing.T) {
+		ttl := dnsMinimumTTL(newResponseWithAnswers(cname, newA(300), newA(200)), dns.TypeA)
+		if ttl == nil || *ttl != 200 {
+			t.Fatal("unexpected TTL", ttl)
+		}
+	})
+
+	t.Run("without A records", func(t *testing.T) {
+		ttl := dnsMinimumTTL(newResponseWithAnswers(cname), dns.TypeA)
+		if ttl != nil {
+			t.Fatal("expected nil")
+		}
+	})
+
+	t.Run("with an invalid response", func(t *testing.T) {
+		resp := &mocks.DNSResponse{
+			MockBytes: func() []byte {
+				return []byte{0xde, 0xad}
+			},
+		}
+		if dnsMinimumTTL(resp, dns.TypeA) != nil {
+			t.Fatal("expected nil")
+		}
+	})
+}
+
+func TestMergeVerdicts(t *testing.T) {
+	results := []*ResolverResult{{
+		Verdict: &Verdict{
+			Interception:      nil,
+			NXDOMAINRewriting: newFlag(false),
+			ECSLeak:           nil,
+			TTLManipulation:   nil,
+		},
+	}, {
+		Verdict: &Verdict{
+			Interception:      newFlag(true),
+			NXDOMAINRewriting: newFlag(false),
+			ECSLeak:           nil,
+			TTLManipulation:   newFlag(false),
+		},
+	}, {
+		Verdict: &Verdict{
+			Interception:      newFlag(false),
+			NXDOMAINRewriting: nil,
+			ECSLeak:           nil,
+			TTLManipulation:   newFlag(false),
+		},
+	}}
+
+	verdict := mergeVerdicts(results)
+	if flagToString(verdict.Interception) != "true" {
+		t.Fatal("unexpected Interception", flagToString(verdict.Interception))
+	}
+	if flagToString(verdict.NXDOMAINRewriting) != "false" {
+		t.Fatal("unexpected NXDOMAINRewriting", flagToString(verdict.NXDOMAINRewriting))
+	}
+	if flagToString(verdict.ECSLeak) != "nil" {
+		t.Fatal("unexpected ECSLeak", flagToString(verdict.ECSLeak))
+	}
+	if flagToString(verdict.TTLManipulation) != "false" {
+		t.Fatal("unexpected TTLManipulation", flagToString(verdict.TTLManipulation))
+	}
+}
@@ -0,0 +1,113 @@
+// Package dnsresolvers is the experimental dnsresolvers experiment.
+//
+// For the system resolver and for a list of public DNS-over-UDP resolvers,
+// this experiment performs whoami lookups to discover which recursive resolver
+// actually answered, detects transparent DNS interception, and checks for
+// NXDOMAIN rewriting, EDNS client subnet leaks and TTL manipulation.
+package dnsresolvers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+const (
+	testName    = "dnsresolvers"
+	testVersion = "0.1.0"
+)
+
+// Config contains the experiment configuration.
+type Config struct {
+	// Resolvers is the space-separated list of DNS-over-UDP resolvers to measure.
+	Resolvers string `ooni:"space-separated list of DNS-over-UDP resolvers to measure"`
+}
+
+func (c *Config) resolvers() []string {
+	if c.Resolvers != "" {
+		return strings.Fields(c.Resolvers)
+	}
+	return []string{"8.8.8.8:53", "1.1.1.1:53", "9.9.9.9:53"}
+}
+
+// Measurer performs the measurement.
+type Measurer struct {
+	config Config
+}
+
+// ExperimentName implements ExperimentMeasurer.ExperimentName.
+func (m *Measurer) ExperimentName() string {
+	return testName
+}
+
+// ExperimentVersion implements ExperimentMeasurer.ExperimentVersion.
+func (m *Measurer) ExperimentVersion() string {
+	return testVersion
+}
+
+// Run implements ExperimentMeasurer.Run.
+func (m *Measurer) Run(ctx context.Context, args *model.ExperimentArgs) error {
+	// unpack experiment args
+	measurement := args.Measurement
+	sess := args.Session
+	logger := sess.Logger()
+	zeroTime := measurement.MeasurementStartTimeSaved
+
+	// create the empty measurement test keys
+	tk := NewTestKeys()
+	measurement.TestKeys = tk
+
+	// measure the system resolver first because its whoami results help
+	// us to figure out whether public resolvers are being intercepted
+	resolvers := m.config.resolvers()
+	system := m.measureSystemResolver(ctx, zeroTime, logger, tk)
+
+	// the ISP resolvers are the ones seen by the system resolver's whoami
+	// lookup as well as the one discovered during the probe geolocation
+	ispResolvers := append([]string{}, system.Whoami...)
+	if ip := sess.ResolverIP(); ip != "" && ip != model.DefaultResolverIP {
+		ispResolvers = append(ispResolvers, ip)
+	}
+
+	// obtain the authoritative TTL we use to detect TTL manipulation
+	if len(resolvers) > 0 {
+		tk.ReferenceTTL = m.lookupReferenceTTL(
+			ctx, int64(len(resolvers)+1), zeroTime, logger, resolvers[0], tk)
+	}
+
+	// measure all the public resolvers in parallel
+	results := make([]*ResolverResult, len(resolvers))
+	wg := &sync.WaitGroup{}
+	for idx, address := range resolvers {
+		wg.Add(1)
+		go func(idx int, address string) {
+			defer wg.Done()
+			results[idx] = m.measureUDPResolver(ctx, int64(idx+1), zeroTime, logger, address, &analysisContext{
+				ISPResolvers: ispResolvers,
+				ProbeASN:     parseProbeASN(measurement.ProbeASN),
+				ReferenceTTL: tk.ReferenceTTL,
+			}, tk)
+		}(idx, address)
+	}
+	wg.Wait()
+
+	// assemble the test keys and compute the overall verdict
+	tk.Resolvers = append([]*ResolverResult{system}, results...)
+	tk.Verdict = mergeVerdicts(tk.Resolvers)
+
+	return nil // return nil so we always submit the measurement
+}
+
+// parseProbeASN converts a probe ASN string (e.g., AS137) to a number.
+func parseProbeASN(value string) (asn uint) {
+	_, _ = fmt.Sscanf(value, "AS%d", &asn)
+	return
+}
+
+// NewExperimentMeasurer creates a new ExperimentMeasurer.
+func NewExperimentMeasurer(config Config) model.ExperimentMeasurer {
+	return &Measurer{config: config}
+}
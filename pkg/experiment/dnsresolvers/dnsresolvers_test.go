@@ -0,0 +1,177 @@
+package dnsresolvers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/netem"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netemx"
+)
+
+func TestConfig_resolvers(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		c := &Config{}
+		expect := []string{"8.8.8.8:53", "1.1.1.1:53", "9.9.9.9:53"}
+		if diff := cmp.Diff(expect, c.resolvers()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		c := &Config{Resolvers: " 8.8.4.4:53  1.0.0.1:53 "}
+		expect := []string{"8.8.4.4:53", "1.0.0.1:53"}
+		if diff := cmp.Diff(expect, c.resolvers()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestParseProbeASN(t *testing.T) {
+	if parseProbeASN("AS137") != 137 {
+		t.Fatal("unexpected ASN")
+	}
+	if parseProbeASN("") != 0 {
+		t.Fatal("unexpected ASN")
+	}
+}
+
+func TestMeasurer_run(t *testing.T) {
+	// runHelper is an helper function to run this set of tests.
+	runHelper := func(t *testing.T) *TestKeys {
+		m := NewExperimentMeasurer(Config{Resolvers: "8.8.8.8:53"})
+		if m.ExperimentName() != "dnsresolvers" {
+			t.Fatal("invalid experiment name")
+		}
+		if m.ExperimentVersion() != "0.1.0" {
+			t.Fatal("invalid experiment version")
+		}
+		meas := &model.Measurement{
+			ProbeASN: "AS137",
+		}
+		sess := &mocks.Session{
+			MockLogger: func() model.Logger { return model.DiscardLogger },
+			MockResolverIP: func() string {
+				return netemx.ISPResolverAddress
+			},
+		}
+		args := &model.ExperimentArgs{
+			Callbacks:   model.NewPrinterCallbacks(model.DiscardLogger),
+			Measurement: meas,
+			Session:     sess,
+		}
+		if err := m.Run(context.Background(), args); err != nil {
+			t.Fatal(err)
+		}
+		return meas.TestKeys.(*TestKeys)
+	}
+
+	// newEnv creates a new environment where 8.8.8.8 is a public resolver and where
+	// whoami queries resolve to the given address. Note that netem DNS servers answer
+	// whoami queries with the client address, because they behave like authoritative
+	// servers, so we use DPI to spoof the whoami answer we would like to see.
+	newEnv := func(whoami string) *netemx.QAEnv {
+		env := netemx.MustNewQAEnv(netemx.QAEnvOptionNetStack("8.8.8.8", &netemx.DNSOverUDPServerFactory{}))
+		env.AddRecordToAllResolvers("example.com", "", "93.184.216.34")
+		env.DPIEngine().AddRule(&netem.DPISpoofDNSResponse{
+			Addresses: []string{whoami},
+			Logger:    model.DiscardLogger,
+			Domain:    whoamiDomain,
+		})
+		return env
+	}
+
+	t.Run("without interception", func(t *testing.T) {
+		env := newEnv("74.125.18.1") // Google's AS
+		defer env.Close()
+
+		env.Do(func() {
+			tk := runHelper(t)
+
+			if len(tk.Resolvers) != 2 {
+				t.Fatal("expected two resolvers")
+			}
+
+			system := tk.Resolvers[0]
+			if diff := cmp.Diff([]string{"74.125.18.1"}, system.Whoami); diff != "" {
+				t.Fatal(diff)
+			}
+			if system.Verdict.Interception != nil {
+				t.Fatal("interception should not apply to the system resolver")
+			}
+			if system.Verdict.NXDOMAINRewriting == nil || *system.Verdict.NXDOMAINRewriting {
+				t.Fatal("unexpected NXDOMAIN rewriting verdict")
+			}
+
+			public := tk.Resolvers[1]
+			if public.Engine != "udp" || public.Address != "8.8.8.8:53" {
+				t.Fatal("unexpected resolver", public.Engine, public.Address)
+			}
+			if diff := cmp.Diff([]string{"74.125.18.1"}, public.Whoami); diff != "" {
+				t.Fatal(diff)
+			}
+			if public.Verdict.Interception == nil || *public.Verdict.Interception {
+				t.Fatal("unexpected interception verdict")
+			}
+			if public.Verdict.NXDOMAINRewriting == nil || *public.Verdict.NXDOMAINRewriting {
+				t.Fatal("unexpected NXDOMAIN rewriting verdict")
+			}
+			if public.TTL == nil {
+				t.Fatal("expected to see the TTL")
+			}
+
+			// the netem DNS server does not serve NS and TXT records
+			if tk.ReferenceTTL != nil || public.Verdict.TTLManipulation != nil {
+				t.Fatal("expected to know nothing about TTL manipulation")
+			}
+			if public.Verdict.ECSLeak != nil {
+				t.Fatal("expected to know nothing about ECS leaks")
+			}
+
+			if tk.Verdict.Interception == nil || *tk.Verdict.Interception {
+				t.Fatal("unexpected overall interception verdict")
+			}
+
+			// make sure we have tagged queries for each check
+			tags := map[string]bool{}
+			for _, query := range tk.Queries {
+				for _, tag := range query.Tags {
+					tags[tag] = true
+				}
+			}
+			expectTags := map[string]bool{
+				"ecs":           true,
+				"nxdomain":      true,
+				"reference_ttl": true,
+				"ttl":           true,
+				"whoami":        true,
+			}
+			if diff := cmp.Diff(expectTags, tags); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	})
+
+	t.Run("with interception", func(t *testing.T) {
+		// answer whoami queries as if the ISP resolver had processed them
+		env := newEnv(netemx.ISPResolverAddress)
+		defer env.Close()
+
+		env.Do(func() {
+			tk := runHelper(t)
+
+			public := tk.Resolvers[1]
+			if diff := cmp.Diff([]string{netemx.ISPResolverAddress}, public.Whoami); diff != "" {
+				t.Fatal(diff)
+			}
+			if public.Verdict.Interception == nil || !*public.Verdict.Interception {
+				t.Fatal("expected to see interception")
+			}
+			if tk.Verdict.Interception == nil || !*tk.Verdict.Interception {
+				t.Fatal("expected to see interception in the overall verdict")
+			}
+		})
+	})
+}
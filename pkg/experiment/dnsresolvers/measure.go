@@ -0,0 +1,192 @@
+package dnsresolvers
+
+//
+// Code to measure a single resolver
+//
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/pkg/logx"
+	"github.com/ooni/probe-engine/pkg/measurexlite"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/randx"
+)
+
+const (
+	// whoamiDomain is the domain whose A record is the address of the
+	// recursive resolver querying the authoritative servers.
+	whoamiDomain = "whoami.v4.powerdns.org"
+
+	// ecsDomain is the domain whose TXT records include the EDNS client
+	// subnet forwarded by the recursive resolver, if any.
+	ecsDomain = "o-o.myaddr.l.google.com"
+
+	// nxdomainParent is the parent of the random nonexisting
+	// domains we use to detect NXDOMAIN rewriting.
+	nxdomainParent = "example.com"
+
+	// ttlDomain is the domain we use to detect TTL manipulation.
+	ttlDomain = "example.com"
+
+	// lookupTimeout is the timeout of each lookup.
+	lookupTimeout = 5 * time.Second
+)
+
+// measureSystemResolver measures the system resolver. Because we do not
+// have access to the raw responses, we only run the whoami and NXDOMAIN checks.
+func (m *Measurer) measureSystemResolver(
+	ctx context.Context, zeroTime time.Time, logger model.Logger, tk *TestKeys) *ResolverResult {
+	result := &ResolverResult{
+		Engine:  "", // set by measureWithResolver
+		Address: "",
+		Verdict: &Verdict{},
+	}
+	m.measureWithResolver(ctx, 0, zeroTime, logger, result, func(trace *measurexlite.Trace) model.Resolver {
+		return trace.NewStdlibResolver(logger)
+	}, tk)
+	return result
+}
+
+// measureUDPResolver measures the DNS-over-UDP resolver at the given address.
+func (m *Measurer) measureUDPResolver(ctx context.Context, index int64, zeroTime time.Time,
+	logger model.Logger, address string, actx *analysisContext, tk *TestKeys) *ResolverResult {
+	result := &ResolverResult{
+		Engine:  "", // set by measureWithResolver
+		Address: address,
+		Verdict: &Verdict{},
+	}
+	dialer := netxlite.NewDialerWithStdlibResolver(logger)
+
+	// perform the checks that also apply to the system resolver
+	m.measureWithResolver(ctx, index, zeroTime, logger, result, func(trace *measurexlite.Trace) model.Resolver {
+		return trace.NewParallelUDPResolver(logger, dialer, address)
+	}, tk)
+	result.Verdict.Interception = analyzeInterception(address, result.Whoami, actx)
+
+	// the following checks require access to the raw responses
+	txp := netxlite.NewDNSOverUDPTransport(dialer, address)
+	defer txp.CloseIdleConnections()
+
+	trace := measurexlite.NewTrace(index, zeroTime, "ecs")
+	if resp, err := m.roundTrip(ctx, trace, logger, txp, ecsDomain, dns.TypeTXT, tk); err == nil {
+		result.ECSSubnet, result.Verdict.ECSLeak = analyzeECS(resp)
+	}
+
+	trace = measurexlite.NewTrace(index, zeroTime, "ttl")
+	if resp, err := m.roundTrip(ctx, trace, logger, txp, ttlDomain, dns.TypeA, tk); err == nil {
+		result.TTL = dnsMinimumTTL(resp, dns.TypeA)
+	}
+	result.Verdict.TTLManipulation = analyzeTTL(result.TTL, actx.ReferenceTTL)
+
+	return result
+}
+
+// measureWithResolver performs the whoami and NXDOMAIN checks using
+// a new resolver constructed for each check by newResolver.
+func (m *Measurer) measureWithResolver(ctx context.Context, index int64, zeroTime time.Time,
+	logger model.Logger, result *ResolverResult,
+	newResolver func(trace *measurexlite.Trace) model.Resolver, tk *TestKeys) {
+	trace := measurexlite.NewTrace(index, zeroTime, "whoami")
+	reso := newResolver(trace)
+	result.Engine = reso.Network()
+	result.Whoami, _ = m.lookupHost(ctx, trace, logger, reso, whoamiDomain, tk)
+
+	trace = measurexlite.NewTrace(index, zeroTime, "nxdomain")
+	domain := fmt.Sprintf("%s.%s", strings.ToLower(randx.Letters(16)), nxdomainParent)
+	addrs, err := m.lookupHost(ctx, trace, logger, newResolver(trace), domain, tk)
+	result.NXDOMAINAddrs = addrs
+	result.Verdict.NXDOMAINRewriting = analyzeNXDOMAIN(addrs, err)
+}
+
+// lookupReferenceTTL queries the authoritative servers of the ttlDomain to
+// obtain the reference TTL, using the resolver at the given address to discover
+// them. This function returns nil if any of the required lookups fails.
+func (m *Measurer) lookupReferenceTTL(ctx context.Context, index int64, zeroTime time.Time,
+	logger model.Logger, address string, tk *TestKeys) *uint32 {
+	trace := measurexlite.NewTrace(index, zeroTime, "reference_ttl")
+	dialer := netxlite.NewDialerWithStdlibResolver(logger)
+	txp := netxlite.NewDNSOverUDPTransport(dialer, address)
+	defer txp.CloseIdleConnections()
+
+	// discover the authoritative servers
+	resp, err := m.roundTrip(ctx, trace, logger, txp, ttlDomain, dns.TypeNS, tk)
+	if err != nil {
+		return nil
+	}
+	nameservers, err := resp.DecodeNS()
+	if err != nil || len(nameservers) <= 0 {
+		return nil
+	}
+
+	// resolve the first authoritative server
+	resp, err = m.roundTrip(ctx, trace, logger, txp, nameservers[0].Host, dns.TypeA, tk)
+	if err != nil {
+		return nil
+	}
+	addrs, err := resp.DecodeLookupHost()
+	if err != nil || len(addrs) <= 0 {
+		return nil
+	}
+
+	// query the authoritative server directly
+	authTxp := netxlite.NewDNSOverUDPTransport(dialer, net.JoinHostPort(addrs[0], "53"))
+	defer authTxp.CloseIdleConnections()
+	resp, err = m.roundTrip(ctx, trace, logger, authTxp, ttlDomain, dns.TypeA, tk)
+	if err != nil {
+		return nil
+	}
+	return dnsMinimumTTL(resp, dns.TypeA)
+}
+
+// lookupHost performs a LookupHost using the given resolver and saves
+// the corresponding DNS queries into the test keys.
+func (m *Measurer) lookupHost(ctx context.Context, trace *measurexlite.Trace,
+	logger model.Logger, reso model.Resolver, domain string, tk *TestKeys) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	ol := logx.NewOperationLogger(logger, "DNSResolvers #%d %s %s %s",
+		trace.Index(), reso.Network(), reso.Address(), domain)
+	addrs, err := reso.LookupHost(ctx, domain)
+	if err == nil {
+		ol.Stop(strings.Join(addrs, " "))
+	} else {
+		ol.Stop(err)
+	}
+
+	tk.appendQueries(trace.DNSLookupsFromRoundTrip()...)
+	return addrs, err
+}
+
+// roundTrip sends a raw query using the given transport and saves
+// the corresponding DNS query into the test keys.
+func (m *Measurer) roundTrip(ctx context.Context, trace *measurexlite.Trace, logger model.Logger,
+	txp model.DNSTransport, domain string, qtype uint16, tk *TestKeys) (model.DNSResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	query := (&netxlite.DNSEncoderMiekg{}).Encode(domain, qtype, txp.RequiresPadding())
+	ol := logx.NewOperationLogger(logger, "DNSResolvers #%d %s %s IN %s",
+		trace.Index(), txp.Address(), domain, dns.TypeToString[qtype])
+	started := trace.TimeSince(trace.ZeroTime())
+	resp, err := txp.RoundTrip(ctx, query)
+	finished := trace.TimeSince(trace.ZeroTime())
+	ol.Stop(err)
+
+	// make sure we archive the addresses of A and AAAA queries
+	var addrs []string
+	if resp != nil && (qtype == dns.TypeA || qtype == dns.TypeAAAA) {
+		addrs, _ = resp.DecodeLookupHost()
+	}
+
+	tk.appendQueries(measurexlite.NewArchivalDNSLookupResultFromRoundTrip(
+		trace.Index(), started, txp, query, resp, addrs, err, finished, trace.Tags()...))
+	return resp, err
+}
@@ -0,0 +1,94 @@
+package dnsresolvers
+
+import (
+	"sync"
+
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// TestKeys contains the experiment results.
+type TestKeys struct {
+	// Queries contains all the DNS queries we performed.
+	Queries []*model.ArchivalDNSLookupResult `json:"queries"`
+
+	// ReferenceTTL is the TTL returned by the authoritative servers
+	// of the domain we use to detect TTL manipulation.
+	ReferenceTTL *uint32 `json:"reference_ttl"`
+
+	// Resolvers contains the results for each resolver. The first
+	// entry always refers to the system resolver.
+	Resolvers []*ResolverResult `json:"resolvers"`
+
+	// Verdict summarizes the results of all resolvers.
+	Verdict *Verdict `json:"verdict"`
+
+	// mu provides mutual exclusion
+	mu sync.Mutex
+}
+
+// ResolverResult contains the results for a single resolver.
+type ResolverResult struct {
+	// Engine is the resolver network (e.g., getaddrinfo or udp).
+	Engine string `json:"engine"`
+
+	// Address is the resolver address or empty for getaddrinfo.
+	Address string `json:"address"`
+
+	// Whoami contains the addresses of the recursive resolver that
+	// contacted the authoritative servers on our behalf.
+	Whoami []string `json:"whoami"`
+
+	// NXDOMAINAddrs contains the addresses returned for a
+	// domain that does not exist, if any.
+	NXDOMAINAddrs []string `json:"nxdomain_addrs"`
+
+	// ECSSubnet is the EDNS client subnet that the resolver forwarded
+	// to the authoritative servers, if any.
+	ECSSubnet string `json:"ecs_subnet"`
+
+	// TTL is the TTL returned by the resolver for the domain
+	// we use to detect TTL manipulation.
+	TTL *uint32 `json:"ttl"`
+
+	// Verdict summarizes the results for this resolver.
+	Verdict *Verdict `json:"verdict"`
+}
+
+// Verdict summarizes the anomalies we detected. A nil field means that we
+// could not determine the corresponding property (e.g., because a lookup failed
+// or because the check does not apply to this resolver).
+type Verdict struct {
+	// Interception indicates that another resolver answered
+	// in place of the resolver we addressed.
+	Interception *bool `json:"interception"`
+
+	// NXDOMAINRewriting indicates that the resolver returned
+	// addresses for a domain that does not exist.
+	NXDOMAINRewriting *bool `json:"nxdomain_rewriting"`
+
+	// ECSLeak indicates that the resolver forwarded our
+	// subnet to the authoritative servers.
+	ECSLeak *bool `json:"ecs_leak"`
+
+	// TTLManipulation indicates that the resolver returned
+	// a TTL larger than the authoritative one.
+	TTLManipulation *bool `json:"ttl_manipulation"`
+}
+
+// NewTestKeys creates new dnsresolvers TestKeys.
+func NewTestKeys() *TestKeys {
+	return &TestKeys{
+		Queries:      []*model.ArchivalDNSLookupResult{},
+		ReferenceTTL: nil,
+		Resolvers:    []*ResolverResult{},
+		Verdict:      &Verdict{},
+		mu:           sync.Mutex{},
+	}
+}
+
+// appendQueries appends DNS queries to the test keys.
+func (tk *TestKeys) appendQueries(queries ...*model.ArchivalDNSLookupResult) {
+	tk.mu.Lock()
+	tk.Queries = append(tk.Queries, queries...)
+	tk.mu.Unlock()
+}
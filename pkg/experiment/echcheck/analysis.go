@@ -0,0 +1,63 @@
+package echcheck
+
+//
+// Classifying ECH-specific blocking
+//
+
+// These are the possible values of the TestKeys.Blocking field.
+const (
+	// blockingNone means that all the handshakes we attempted succeeded.
+	blockingNone = "none"
+
+	// blockingTLS means that the handshake without ECH failed, therefore we cannot
+	// say whether there is blocking that specifically targets ECH.
+	blockingTLS = "tls"
+
+	// blockingECH means that the handshake without ECH succeeded, while both the
+	// handshakes using GREASE ECH and the one using a real ECH config failed.
+	blockingECH = "ech"
+
+	// blockingECHGREASE means that the handshake without ECH succeeded, while at
+	// least one of the handshakes using GREASE ECH failed.
+	blockingECHGREASE = "ech_grease"
+
+	// blockingECHReal means that the handshake without ECH succeeded, while the
+	// handshake using a real ECH config failed.
+	blockingECHReal = "ech_real"
+)
+
+// analyzeBlocking determines whether there is blocking targeting ECH by comparing the
+// results of the handshakes without ECH, with GREASE ECH, and with real ECH. The server
+// rejecting a real ECH config is not blocking, since the handshake completed using the
+// ECH public name. When we retried using the retry configs sent by the server, the
+// result of the retry supersedes the result of the handshake that was rejected.
+func analyzeBlocking(results []*handshakeResult) string {
+	var (
+		controlFailed bool
+		greaseFailed  bool
+		realFailed    bool
+	)
+	for _, result := range results {
+		failed := result.Handshake.Failure != nil && !result.ECHRejected
+		switch result.ECH {
+		case echNone:
+			controlFailed = controlFailed || failed
+		case echGREASE:
+			greaseFailed = greaseFailed || failed
+		case echReal:
+			realFailed = failed // the last one wins
+		}
+	}
+	switch {
+	case controlFailed:
+		return blockingTLS
+	case greaseFailed && realFailed:
+		return blockingECH
+	case greaseFailed:
+		return blockingECHGREASE
+	case realFailed:
+		return blockingECHReal
+	default:
+		return blockingNone
+	}
+}
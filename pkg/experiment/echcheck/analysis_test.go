@@ -0,0 +1,89 @@
+package echcheck
+
+import (
+	"testing"
+
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+func TestAnalyzeBlocking(t *testing.T) {
+	// newResult is a helper to create a [*handshakeResult].
+	newResult := func(ech string, failure string, rejected bool) *handshakeResult {
+		hs := &model.ArchivalTLSOrQUICHandshakeResult{}
+		if failure != "" {
+			hs.Failure = &failure
+		}
+		return &handshakeResult{Handshake: hs, ECH: ech, ECHRejected: rejected}
+	}
+
+	cases := []struct {
+		name    string
+		results []*handshakeResult
+		expect  string
+	}{{
+		name: "when all the handshakes succeed",
+		results: []*handshakeResult{
+			newResult(echNone, "", false),
+			newResult(echGREASE, "", false),
+			newResult(echReal, "", false),
+		},
+		expect: blockingNone,
+	}, {
+		name: "when the handshake without ECH fails",
+		results: []*handshakeResult{
+			newResult(echNone, "connection_reset", false),
+			newResult(echGREASE, "connection_reset", false),
+			newResult(echReal, "connection_reset", false),
+		},
+		expect: blockingTLS,
+	}, {
+		name: "when a GREASE handshake fails",
+		results: []*handshakeResult{
+			newResult(echNone, "", false),
+			newResult(echGREASE, "", false),
+			newResult(echGREASE, "connection_reset", false),
+		},
+		expect: blockingECHGREASE,
+	}, {
+		name: "when the real ECH handshake fails",
+		results: []*handshakeResult{
+			newResult(echNone, "", false),
+			newResult(echGREASE, "", false),
+			newResult(echReal, "connection_reset", false),
+		},
+		expect: blockingECHReal,
+	}, {
+		name: "when both GREASE and real ECH handshakes fail",
+		results: []*handshakeResult{
+			newResult(echNone, "", false),
+			newResult(echGREASE, "connection_reset", false),
+			newResult(echReal, "connection_reset", false),
+		},
+		expect: blockingECH,
+	}, {
+		name: "when the server rejects the real ECH config",
+		results: []*handshakeResult{
+			newResult(echNone, "", false),
+			newResult(echGREASE, "", false),
+			newResult(echReal, "unknown_failure: tls: server rejected ECH", true),
+		},
+		expect: blockingNone,
+	}, {
+		name: "when the retry after the rejection fails",
+		results: []*handshakeResult{
+			newResult(echNone, "", false),
+			newResult(echGREASE, "", false),
+			newResult(echReal, "unknown_failure: tls: server rejected ECH", true),
+			newResult(echReal, "connection_reset", false),
+		},
+		expect: blockingECHReal,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := analyzeBlocking(tc.results); got != tc.expect {
+				t.Fatal("expected", tc.expect, "got", got)
+			}
+		})
+	}
+}
@@ -1,11 +1,17 @@
 package echcheck
 
+import "encoding/base64"
+
 const (
 	defaultResolver = "https://mozilla.cloudflare-dns.com/dns-query"
 )
 
 // Config contains the experiment config.
 type Config struct {
+	// ECHConfigList is the OPTIONAL base64-encoded ECHConfigList to use
+	// instead of the one we obtain using the HTTPS record of the target.
+	ECHConfigList string `ooni:"base64-encoded ECHConfigList to use instead of the one in the HTTPS record"`
+
 	// ResolverURL is the default DoH resolver
 	ResolverURL string `ooni:"URL for DoH resolver"`
 }
@@ -16,3 +22,7 @@ func (c Config) resolverURL() string {
 	}
 	return defaultResolver
 }
+
+func (c Config) echConfigList() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(c.ECHConfigList)
+}
@@ -24,3 +24,31 @@ func TestConfig(t *testing.T) {
 		t.Fatalf("expected: %s, got %s", testResolver, s1)
 	}
 }
+
+func TestConfigECHConfigList(t *testing.T) {
+	t.Run("when empty", func(t *testing.T) {
+		configList, err := Config{}.echConfigList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(configList) != 0 {
+			t.Fatal("expected empty config list")
+		}
+	})
+
+	t.Run("with valid base64", func(t *testing.T) {
+		configList, err := Config{ECHConfigList: "AAEC"}.echConfigList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(configList) != "\x00\x01\x02" {
+			t.Fatal("unexpected config list", configList)
+		}
+	})
+
+	t.Run("with invalid base64", func(t *testing.T) {
+		if _, err := (Config{ECHConfigList: "@@@"}).echConfigList(); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -1,4 +1,9 @@
 // Package echcheck contains the ECH blocking network experiment.
 //
+// We perform TLS handshakes without ECH, with GREASE ECH, and, when we can
+// obtain it from the HTTPS record or from the config, with the real ECH config
+// of the target, and we compare the results to detect blocking that
+// specifically targets ECH-bearing ClientHellos.
+//
 // https://github.com/ooni/spec/pull/263
 package echcheck
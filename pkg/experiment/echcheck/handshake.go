@@ -17,16 +17,45 @@ import (
 
 const echExtensionType uint16 = 0xfe0d
 
-func connectAndHandshake(
+// handshakeResult is the result of one of the TLS handshakes we perform.
+type handshakeResult struct {
+	// Handshake is the archival TLS handshake result.
+	Handshake *model.ArchivalTLSOrQUICHandshakeResult
+
+	// ECH is the kind of ECH we used (one of echNone, echGREASE, and echReal).
+	ECH string
+
+	// ECHAccepted indicates whether the server accepted the real ECH config.
+	ECHAccepted bool
+
+	// ECHRejected indicates whether the server rejected the real ECH config.
+	ECHRejected bool
+
+	// ECHRetryConfigs contains the retry configs the server sent when rejecting ECH.
+	ECHRetryConfigs []byte
+}
+
+// These are the possible values of the handshakeResult.ECH field.
+const (
+	echNone   = "none"
+	echGREASE = "grease"
+	echReal   = "real"
+)
+
+// connectAndDo connects to the given address and runs the given function using the
+// connection in a background goroutine. The function result is emitted on the returned
+// channel and the connection is closed once the function has returned.
+func connectAndDo(
 	ctx context.Context,
-	startTime time.Time,
-	address string, sni string, outerSni string,
-	logger model.Logger) (chan model.ArchivalTLSOrQUICHandshakeResult, error) {
+	address string,
+	logger model.Logger,
+	fx func(conn net.Conn) *handshakeResult) (chan *handshakeResult, error) {
 
-	channel := make(chan model.ArchivalTLSOrQUICHandshakeResult)
+	channel := make(chan *handshakeResult)
 
 	ol := logx.NewOperationLogger(logger, "echcheck: TCPConnect %s", address)
-	var dialer net.Dialer
+	netx := &netxlite.Netx{}
+	dialer := netx.NewDialerWithoutResolver(logger)
 	conn, err := dialer.DialContext(ctx, "tcp", address)
 	ol.Stop(err)
 	if err != nil {
@@ -34,9 +63,22 @@ func connectAndHandshake(
 	}
 
 	go func() {
-		var res *model.ArchivalTLSOrQUICHandshakeResult
+		defer conn.Close()
+		channel <- fx(conn)
+	}()
+
+	return channel, nil
+}
+
+func connectAndHandshake(
+	ctx context.Context,
+	startTime time.Time,
+	address string, sni string, outerSni string,
+	logger model.Logger) (chan *handshakeResult, error) {
+
+	return connectAndDo(ctx, address, logger, func(conn net.Conn) *handshakeResult {
 		if outerSni == "" {
-			res = handshake(
+			res := handshake(
 				ctx,
 				conn,
 				startTime,
@@ -44,23 +86,21 @@ func connectAndHandshake(
 				sni,
 				logger,
 			)
-		} else {
-			res = handshakeWithEch(
-				ctx,
-				conn,
-				startTime,
-				address,
-				outerSni,
-				logger,
-			)
-			// We need to set this explicitly because otherwise it will get
-			// overridden with the outerSni in the case of ECH
-			res.ServerName = sni
+			return &handshakeResult{Handshake: res, ECH: echNone}
 		}
-		channel <- *res
-	}()
-
-	return channel, nil
+		res := handshakeWithEch(
+			ctx,
+			conn,
+			startTime,
+			address,
+			outerSni,
+			logger,
+		)
+		// We need to set this explicitly because otherwise it will get
+		// overridden with the outerSni in the case of ECH
+		res.ServerName = sni
+		return &handshakeResult{Handshake: res, ECH: echGREASE}
+	})
 }
 
 func handshake(ctx context.Context, conn net.Conn, zeroTime time.Time,
@@ -15,7 +15,7 @@ import (
 
 const (
 	testName    = "echcheck"
-	testVersion = "0.2.0"
+	testVersion = "0.3.0"
 	defaultURL  = "https://cloudflare-ech.com/cdn-cgi/trace"
 )
 
@@ -25,11 +25,36 @@ var (
 
 	// errInvalidInputScheme indicates that the input scheme is invalid
 	errInvalidInputScheme = errors.New("input scheme must be https")
+
+	// errInvalidECHConfigList indicates that the configured ECHConfigList is not valid base64
+	errInvalidECHConfigList = errors.New("ECHConfigList must be base64 encoded")
 )
 
 // TestKeys contains echcheck test keys.
 type TestKeys struct {
+	// Queries contains the DNS queries we performed.
+	Queries []*model.ArchivalDNSLookupResult `json:"queries"`
+
+	// TLSHandshakes contains the TLS handshakes we performed.
 	TLSHandshakes []*model.ArchivalTLSOrQUICHandshakeResult `json:"tls_handshakes"`
+
+	// ECHConfigSource is "dns" when the real ECH config comes from the target's HTTPS record,
+	// "config" when it comes from the experiment config, and empty when we have none.
+	ECHConfigSource string `json:"ech_config_source"`
+
+	// ECHAccepted indicates whether the server accepted the real ECH config and
+	// is nil when we did not perform any handshake using a real ECH config.
+	ECHAccepted *bool `json:"ech_accepted"`
+
+	// ECHRetryConfigs contains the retry configs sent by the server when rejecting
+	// the real ECH config, if any. When the server sends retry configs, we perform
+	// another handshake using them, and ECHAccepted reflects such an handshake.
+	ECHRetryConfigs model.ArchivalBinaryData `json:"ech_retry_configs,omitempty"`
+
+	// Blocking classifies the blocking that specifically targets ECH by comparing the
+	// handshakes without ECH, with GREASE ECH, and with a real ECH config. It is one of
+	// "none", "tls", "ech", "ech_grease", and "ech_real".
+	Blocking string `json:"blocking"`
 }
 
 // Measurer performs the measurement.
@@ -63,10 +88,17 @@ func (m *Measurer) Run(
 		return errInvalidInputScheme
 	}
 
+	configList, err := m.config.echConfigList()
+	if err != nil {
+		return errInvalidECHConfigList
+	}
+
 	// 1. perform a DNSLookup
-	ol := logx.NewOperationLogger(args.Session.Logger(), "echcheck: DNSLookup[%s] %s", m.config.resolverURL(), parsed.Host)
-	trace := measurexlite.NewTrace(0, args.Measurement.MeasurementStartTimeSaved)
-	resolver := trace.NewParallelDNSOverHTTPSResolver(args.Session.Logger(), m.config.resolverURL())
+	logger := args.Session.Logger()
+	zeroTime := args.Measurement.MeasurementStartTimeSaved
+	ol := logx.NewOperationLogger(logger, "echcheck: DNSLookup[%s] %s", m.config.resolverURL(), parsed.Host)
+	trace := measurexlite.NewTrace(0, zeroTime)
+	resolver := trace.NewParallelDNSOverHTTPSResolver(logger, m.config.resolverURL())
 	addrs, err := resolver.LookupHost(ctx, parsed.Host)
 	ol.Stop(err)
 	if err != nil {
@@ -75,37 +107,52 @@ func (m *Measurer) Run(
 	runtimex.Assert(len(addrs) > 0, "expected at least one entry in addrs")
 	address := net.JoinHostPort(addrs[0], "443")
 
-	handshakes := []func() (chan model.ArchivalTLSOrQUICHandshakeResult, error){
+	// 2. obtain the real ECH config, if possible
+	tk := TestKeys{}
+	switch {
+	case len(configList) > 0:
+		tk.ECHConfigSource = "config"
+	default:
+		configList = m.lookupECHConfigList(ctx, logger, resolver, parsed.Host)
+		if len(configList) > 0 {
+			tk.ECHConfigSource = "dns"
+		}
+	}
+	tk.Queries = trace.DNSLookupsFromRoundTrip()
+
+	handshakes := []func() (chan *handshakeResult, error){
 		// handshake with ECH disabled and SNI coming from the URL
-		func() (chan model.ArchivalTLSOrQUICHandshakeResult, error) {
-			return connectAndHandshake(ctx, args.Measurement.MeasurementStartTimeSaved,
-				address, parsed.Host, "", args.Session.Logger())
+		func() (chan *handshakeResult, error) {
+			return connectAndHandshake(ctx, zeroTime, address, parsed.Host, "", logger)
 		},
 		// handshake with ECH enabled and ClientHelloOuter SNI coming from the URL
-		func() (chan model.ArchivalTLSOrQUICHandshakeResult, error) {
-			return connectAndHandshake(ctx, args.Measurement.MeasurementStartTimeSaved,
-				address, parsed.Host, parsed.Host, args.Session.Logger())
+		func() (chan *handshakeResult, error) {
+			return connectAndHandshake(ctx, zeroTime, address, parsed.Host, parsed.Host, logger)
 		},
 		// handshake with ECH enabled and hardcoded different ClientHelloOuter SNI
-		func() (chan model.ArchivalTLSOrQUICHandshakeResult, error) {
-			return connectAndHandshake(ctx, args.Measurement.MeasurementStartTimeSaved,
-				address, parsed.Host, "cloudflare.com", args.Session.Logger())
+		func() (chan *handshakeResult, error) {
+			return connectAndHandshake(ctx, zeroTime, address, parsed.Host, "cloudflare.com", logger)
 		},
 	}
 
+	// handshake with the real ECH config, when we have one and we can use it
+	if len(configList) > 0 && realECHSupported {
+		handshakes = append(handshakes, func() (chan *handshakeResult, error) {
+			return connectAndHandshakeWithRealECH(ctx, zeroTime, address, parsed.Host, configList, logger)
+		})
+	}
+
 	// We shuffle the order in which the operations are done to avoid residual
 	// censorship issues.
 	rand.Shuffle(len(handshakes), func(i, j int) {
 		handshakes[i], handshakes[j] = handshakes[j], handshakes[i]
 	})
 
-	var channels [3](chan model.ArchivalTLSOrQUICHandshakeResult)
-	var results [3](model.ArchivalTLSOrQUICHandshakeResult)
-
 	// Fire the handshakes in parallel
 	// TODO: currently if one of the connects fails we fail the whole result
 	// set. This is probably OK given that we only ever use the same address,
 	// but this may be something we want to change in the future.
+	channels := make([]chan *handshakeResult, len(handshakes))
 	for idx, hs := range handshakes {
 		channels[idx], err = hs()
 		if err != nil {
@@ -114,17 +161,54 @@ func (m *Measurer) Run(
 	}
 
 	// Wait on each channel for the results to come in
-	for idx, ch := range channels {
-		results[idx] = <-ch
+	results := make([]*handshakeResult, 0, len(channels))
+	for _, ch := range channels {
+		results = append(results, <-ch)
+	}
+
+	// When the server rejects the real ECH config and sends retry configs, the
+	// client should retry using them, so we also do that
+	for _, result := range results {
+		if result.ECH != echReal || !result.ECHRejected || len(result.ECHRetryConfigs) <= 0 {
+			continue
+		}
+		tk.ECHRetryConfigs = result.ECHRetryConfigs
+		ch, err := connectAndHandshakeWithRealECH(
+			ctx, zeroTime, address, parsed.Host, result.ECHRetryConfigs, logger)
+		if err != nil {
+			return err
+		}
+		results = append(results, <-ch)
+		break
 	}
 
-	args.Measurement.TestKeys = TestKeys{TLSHandshakes: []*model.ArchivalTLSOrQUICHandshakeResult{
-		&results[0], &results[1], &results[2],
-	}}
+	// Fill the test keys and classify blocking
+	for _, result := range results {
+		tk.TLSHandshakes = append(tk.TLSHandshakes, result.Handshake)
+		if result.ECH == echReal {
+			accepted := result.ECHAccepted
+			tk.ECHAccepted = &accepted
+		}
+	}
+	tk.Blocking = analyzeBlocking(results)
+	args.Measurement.TestKeys = tk
 
 	return nil
 }
 
+// lookupECHConfigList obtains the ECHConfigList from the HTTPS record of the given
+// domain and returns nil when the lookup fails or the record contains no ECH config.
+func (m *Measurer) lookupECHConfigList(
+	ctx context.Context, logger model.Logger, resolver model.Resolver, domain string) []byte {
+	ol := logx.NewOperationLogger(logger, "echcheck: LookupHTTPS[%s] %s", m.config.resolverURL(), domain)
+	https, err := resolver.LookupHTTPS(ctx, domain)
+	ol.Stop(err)
+	if err != nil {
+		return nil
+	}
+	return https.ECHConfig
+}
+
 // NewExperimentMeasurer creates a new ExperimentMeasurer.
 func NewExperimentMeasurer(config Config) model.ExperimentMeasurer {
 	return &Measurer{config: config}
@@ -14,7 +14,7 @@ func TestNewExperimentMeasurer(t *testing.T) {
 	if measurer.ExperimentName() != "echcheck" {
 		t.Fatal("unexpected name")
 	}
-	if measurer.ExperimentVersion() != "0.1.2" {
+	if measurer.ExperimentVersion() != "0.3.0" {
 		t.Fatal("unexpected version")
 	}
 }
@@ -91,6 +91,26 @@ func TestMeasurerMeasureWithInvalidInput(t *testing.T) {
 	}
 }
 
+func TestMeasurerMeasureWithInvalidECHConfigList(t *testing.T) {
+	// create measurer
+	measurer := NewExperimentMeasurer(Config{ECHConfigList: "@@@"})
+	args := &model.ExperimentArgs{
+		Callbacks: model.NewPrinterCallbacks(model.DiscardLogger),
+		Measurement: &model.Measurement{
+			Input: "https://crypto.cloudflare.com/cdn-cgi/trace",
+		},
+		Session: &mocks.Session{MockLogger: func() model.Logger { return model.DiscardLogger }},
+	}
+	// run measurement
+	err := measurer.Run(context.Background(), args)
+	if err == nil {
+		t.Fatal("expected an error here")
+	}
+	if err.Error() != "ECHConfigList must be base64 encoded" {
+		t.Fatal("unexpected error type")
+	}
+}
+
 func TestMeasurementSuccessRealWorld(t *testing.T) {
 	if testing.Short() {
 		// this test uses the real internet so we want to skip this in short mode
@@ -0,0 +1,114 @@
+package echcheck
+
+//
+// TLS handshakes using real ECH configs
+//
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/logx"
+	"github.com/ooni/probe-engine/pkg/measurexlite"
+	"github.com/ooni/probe-engine/pkg/model"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// errRealECHNotSupported indicates that this build cannot perform handshakes using real
+// ECH configs, which requires the standard library of Go >= 1.23.
+var errRealECHNotSupported = errors.New("echcheck: real ECH not supported by this build")
+
+// realECHOutcome contains the outcome of a handshake using a real ECH config.
+type realECHOutcome struct {
+	// State is the TLS connection state.
+	State tls.ConnectionState
+
+	// Accepted indicates whether the server accepted ECH.
+	Accepted bool
+
+	// Rejected indicates whether the server rejected ECH.
+	Rejected bool
+
+	// RetryConfigs contains the retry configs sent by the server when rejecting ECH.
+	RetryConfigs []byte
+}
+
+func connectAndHandshakeWithRealECH(
+	ctx context.Context,
+	startTime time.Time,
+	address string, sni string, configList []byte,
+	logger model.Logger) (chan *handshakeResult, error) {
+
+	return connectAndDo(ctx, address, logger, func(conn net.Conn) *handshakeResult {
+		return handshakeWithRealECH(ctx, conn, startTime, address, sni, configList, logger)
+	})
+}
+
+func handshakeWithRealECH(ctx context.Context, conn net.Conn, zeroTime time.Time,
+	address string, sni string, configList []byte, logger model.Logger) *handshakeResult {
+	tlsConfig := genTLSConfig(sni)
+
+	ol := logx.NewOperationLogger(logger, "echcheck: TLSHandshakeWithRealECH")
+	start := time.Now()
+	outcome, err := realECHHandshake(ctx, conn, tlsConfig, configList)
+	finish := time.Now()
+	ol.Stop(err)
+
+	hs := measurexlite.NewArchivalTLSOrQUICHandshakeResult(0, start.Sub(zeroTime), "tcp", address, tlsConfig,
+		outcome.State, err, finish.Sub(zeroTime))
+	hs.ECHConfig = base64.StdEncoding.EncodeToString(configList)
+	hs.OuterServerName = echConfigListPublicName(configList)
+	return &handshakeResult{
+		Handshake:       hs,
+		ECH:             echReal,
+		ECHAccepted:     outcome.Accepted,
+		ECHRejected:     outcome.Rejected,
+		ECHRetryConfigs: outcome.RetryConfigs,
+	}
+}
+
+// echConfigListPublicName returns the public name of the first ECHConfig with a known version
+// inside the given ECHConfigList or an empty string if there is no such ECHConfig.
+//
+// See https://datatracker.ietf.org/doc/draft-ietf-tls-esni/.
+func echConfigListPublicName(configList []byte) string {
+	var configs cryptobyte.String
+	input := cryptobyte.String(configList)
+	if !input.ReadUint16LengthPrefixed(&configs) {
+		return ""
+	}
+	for !configs.Empty() {
+		var (
+			version  uint16
+			contents cryptobyte.String
+		)
+		if !configs.ReadUint16(&version) || !configs.ReadUint16LengthPrefixed(&contents) {
+			return ""
+		}
+		if version != echExtensionType {
+			continue // we don't know how to parse this version
+		}
+		var (
+			configID     uint8
+			kemID        uint16
+			publicKey    cryptobyte.String
+			cipherSuites cryptobyte.String
+			maxNameLen   uint8
+			publicName   cryptobyte.String
+		)
+		if !contents.ReadUint8(&configID) ||
+			!contents.ReadUint16(&kemID) ||
+			!contents.ReadUint16LengthPrefixed(&publicKey) ||
+			!contents.ReadUint16LengthPrefixed(&cipherSuites) ||
+			!contents.ReadUint8(&maxNameLen) ||
+			!contents.ReadUint8LengthPrefixed(&publicName) {
+			return ""
+		}
+		return string(publicName)
+	}
+	return ""
+}
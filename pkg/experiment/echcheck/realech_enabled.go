@@ -0,0 +1,41 @@
+//go:build go1.23
+
+package echcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+// realECHSupported indicates whether this build can perform handshakes using real ECH configs.
+const realECHSupported = true
+
+// realECHHandshake performs a TLS handshake over the given conn using the given config
+// modified to offer the given ECHConfigList. This function always returns a non-nil outcome.
+func realECHHandshake(
+	ctx context.Context, conn net.Conn, config *tls.Config, configList []byte) (*realECHOutcome, error) {
+	config.EncryptedClientHelloConfigList = configList
+
+	// When the server rejects ECH, the standard library verifies the certificate for the public
+	// name regardless of InsecureSkipVerify, so we need to explicitly skip verification
+	config.EncryptedClientHelloRejectionVerify = func(tls.ConnectionState) error {
+		return nil
+	}
+
+	tlsConn := tls.Client(conn, config)
+	err := tlsConn.HandshakeContext(ctx)
+	state := tlsConn.ConnectionState()
+	outcome := &realECHOutcome{
+		State:    state,
+		Accepted: err == nil && state.ECHAccepted,
+	}
+
+	var rejection *tls.ECHRejectionError
+	if errors.As(err, &rejection) {
+		outcome.Rejected = true
+		outcome.RetryConfigs = rejection.RetryConfigList
+	}
+	return outcome, err
+}
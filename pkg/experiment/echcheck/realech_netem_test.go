@@ -0,0 +1,226 @@
+//go:build go1.24
+
+package echcheck
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/ooni/netem"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netemx"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// echServerAddress is the address of the ECH-enabled server.
+const echServerAddress = "130.192.91.7"
+
+// echPublicName is the ECH public name used by the ECH-enabled server.
+const echPublicName = "cloudflare-ech.com"
+
+// newECHKey generates a new [tls.EncryptedClientHelloKey] with the given config ID.
+func newECHKey(configID uint8) tls.EncryptedClientHelloKey {
+	privateKey := runtimex.Try1(ecdh.X25519().GenerateKey(rand.Reader))
+	return tls.EncryptedClientHelloKey{
+		Config:      encodeECHConfig(configID, privateKey.PublicKey().Bytes(), echPublicName),
+		PrivateKey:  privateKey.Bytes(),
+		SendAsRetry: true,
+	}
+}
+
+// echServerFactory implements [netemx.NetStackServerFactory] for an HTTPS server using ECH.
+type echServerFactory struct {
+	keys []tls.EncryptedClientHelloKey
+}
+
+var _ netemx.NetStackServerFactory = &echServerFactory{}
+
+// MustNewServer implements netemx.NetStackServerFactory.
+func (f *echServerFactory) MustNewServer(env netemx.NetStackServerFactoryEnv, stack *netem.UNetStack) netemx.NetStackServer {
+	return &echServer{
+		closers: []io.Closer{},
+		keys:    f.keys,
+		mu:      sync.Mutex{},
+		unet:    stack,
+	}
+}
+
+// echServer is the server created by [echServerFactory].
+type echServer struct {
+	closers []io.Closer
+	keys    []tls.EncryptedClientHelloKey
+	mu      sync.Mutex
+	unet    *netem.UNetStack
+}
+
+// Close implements netemx.NetStackServer.
+func (srv *echServer) Close() error {
+	defer srv.mu.Unlock()
+	srv.mu.Lock()
+	for _, closer := range srv.closers {
+		_ = closer.Close()
+	}
+	srv.closers = []io.Closer{}
+	return nil
+}
+
+// MustStart implements netemx.NetStackServer.
+func (srv *echServer) MustStart() {
+	defer srv.mu.Unlock()
+	srv.mu.Lock()
+
+	addr := &net.TCPAddr{IP: net.ParseIP(srv.unet.IPAddress()), Port: 443}
+	listener := runtimex.Try1(srv.unet.ListenTCP("tcp", addr))
+
+	tlsConfig := srv.unet.MustNewServerTLSConfig("crypto.cloudflare.com", echPublicName)
+	tlsConfig.EncryptedClientHelloKeys = srv.keys
+
+	srvr := &http.Server{ // #nosec G112 - just a testing server
+		Handler:   netemx.ExampleWebPageHandler(),
+		TLSConfig: tlsConfig,
+	}
+	go srvr.ServeTLS(listener, "", "")
+	srv.closers = append(srv.closers, srvr)
+}
+
+// newECHEnv creates a [netemx.QAEnv] with the mozilla DoH server and an ECH-enabled
+// crypto.cloudflare.com server using the given ECH keys.
+func newECHEnv(keys ...tls.EncryptedClientHelloKey) *netemx.QAEnv {
+	env := netemx.MustNewQAEnv(
+		netemx.QAEnvOptionNetStack(netemx.AddressMozillaCloudflareDNSCom, &netemx.HTTPSecureServerFactory{
+			Factory:        &netemx.DNSOverHTTPSHandlerFactory{},
+			Ports:          []int{443},
+			ServerNameMain: "mozilla.cloudflare-dns.com",
+		}),
+		netemx.QAEnvOptionNetStack(echServerAddress, &echServerFactory{keys: keys}),
+	)
+	env.AddRecordToAllResolvers("mozilla.cloudflare-dns.com", "", netemx.AddressMozillaCloudflareDNSCom)
+	env.AddRecordToAllResolvers("crypto.cloudflare.com", "", echServerAddress)
+	return env
+}
+
+// runWithECHConfigList runs the experiment using the given ECHConfigList.
+func runWithECHConfigList(t *testing.T, configList []byte) TestKeys {
+	measurer := NewExperimentMeasurer(Config{
+		ECHConfigList: base64.StdEncoding.EncodeToString(configList),
+	})
+	msrmnt := &model.Measurement{
+		Input: "https://crypto.cloudflare.com/",
+	}
+	args := &model.ExperimentArgs{
+		Callbacks:   model.NewPrinterCallbacks(model.DiscardLogger),
+		Measurement: msrmnt,
+		Session:     &mocks.Session{MockLogger: func() model.Logger { return model.DiscardLogger }},
+	}
+	if err := measurer.Run(context.Background(), args); err != nil {
+		t.Fatal(err)
+	}
+	return msrmnt.TestKeys.(TestKeys)
+}
+
+func TestMeasurerRunWithRealECH(t *testing.T) {
+	key := newECHKey(1)
+	configList := encodeECHConfigList(key.Config)
+
+	t.Run("when the server accepts ECH", func(t *testing.T) {
+		env := newECHEnv(key)
+		defer env.Close()
+
+		env.Do(func() {
+			tk := runWithECHConfigList(t, configList)
+			if len(tk.TLSHandshakes) != 4 {
+				t.Fatal("expected four handshakes, got", len(tk.TLSHandshakes))
+			}
+			for _, hs := range tk.TLSHandshakes {
+				if hs.Failure != nil {
+					t.Fatal("unexpected failure", *hs.Failure)
+				}
+			}
+			if tk.ECHConfigSource != "config" {
+				t.Fatal("unexpected ECH config source", tk.ECHConfigSource)
+			}
+			if tk.ECHAccepted == nil || !*tk.ECHAccepted {
+				t.Fatal("expected ECH to be accepted")
+			}
+			if len(tk.ECHRetryConfigs) != 0 {
+				t.Fatal("expected no retry configs")
+			}
+			if tk.Blocking != blockingNone {
+				t.Fatal("unexpected blocking", tk.Blocking)
+			}
+		})
+	})
+
+	t.Run("when the server rejects ECH and sends retry configs", func(t *testing.T) {
+		env := newECHEnv(key)
+		defer env.Close()
+
+		env.Do(func() {
+			stale := newECHKey(2)
+			tk := runWithECHConfigList(t, encodeECHConfigList(stale.Config))
+			if len(tk.TLSHandshakes) != 5 {
+				t.Fatal("expected five handshakes, got", len(tk.TLSHandshakes))
+			}
+			if string(tk.ECHRetryConfigs) != string(configList) {
+				t.Fatal("unexpected retry configs")
+			}
+			if tk.ECHAccepted == nil || !*tk.ECHAccepted {
+				t.Fatal("expected ECH to be accepted after retrying")
+			}
+			if tk.Blocking != blockingNone {
+				t.Fatal("unexpected blocking", tk.Blocking)
+			}
+		})
+	})
+
+	t.Run("when the censor blocks the ECH public name", func(t *testing.T) {
+		env := newECHEnv(key)
+		defer env.Close()
+
+		env.DPIEngine().AddRule(&netem.DPIResetTrafficForTLSSNI{
+			Logger: model.DiscardLogger,
+			SNI:    echPublicName,
+		})
+
+		env.Do(func() {
+			tk := runWithECHConfigList(t, configList)
+			for _, hs := range tk.TLSHandshakes {
+				if hs.OuterServerName == echPublicName && hs.Failure == nil {
+					t.Fatal("expected the real ECH handshake to fail")
+				}
+			}
+			if tk.ECHAccepted == nil || *tk.ECHAccepted {
+				t.Fatal("expected ECH not to be accepted")
+			}
+			if tk.Blocking != blockingECHReal {
+				t.Fatal("unexpected blocking", tk.Blocking)
+			}
+		})
+	})
+
+	t.Run("when the censor blocks a GREASE ECH outer SNI", func(t *testing.T) {
+		env := newECHEnv(key)
+		defer env.Close()
+
+		env.DPIEngine().AddRule(&netem.DPIResetTrafficForTLSSNI{
+			Logger: model.DiscardLogger,
+			SNI:    "cloudflare.com",
+		})
+
+		env.Do(func() {
+			tk := runWithECHConfigList(t, configList)
+			if tk.Blocking != blockingECHGREASE {
+				t.Fatal("unexpected blocking", tk.Blocking)
+			}
+		})
+	})
+}
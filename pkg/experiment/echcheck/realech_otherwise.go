@@ -0,0 +1,19 @@
+//go:build !go1.23
+
+package echcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// realECHSupported indicates whether this build can perform handshakes using real ECH configs.
+const realECHSupported = false
+
+// realECHHandshake performs a TLS handshake over the given conn using the given config
+// modified to offer the given ECHConfigList. This function always returns a non-nil outcome.
+func realECHHandshake(
+	ctx context.Context, conn net.Conn, config *tls.Config, configList []byte) (*realECHOutcome, error) {
+	return &realECHOutcome{}, errRealECHNotSupported
+}
@@ -0,0 +1,122 @@
+package echcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// encodeECHConfig encodes an ECHConfig using DHKEM(X25519, HKDF-SHA256), HKDF-SHA256,
+// and AES-128-GCM for the given config ID, public key, and public name.
+func encodeECHConfig(configID uint8, publicKey []byte, publicName string) []byte {
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint16(echExtensionType)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(configID)
+		b.AddUint16(0x0020) // DHKEM(X25519, HKDF-SHA256)
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(publicKey)
+		})
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(0x0001) // HKDF-SHA256
+			b.AddUint16(0x0001) // AES-128-GCM
+		})
+		b.AddUint8(0) // maximum_name_length
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes([]byte(publicName))
+		})
+		b.AddUint16(0) // no extensions
+	})
+	return b.BytesOrPanic()
+}
+
+// encodeECHConfigList encodes an ECHConfigList containing the given ECHConfigs.
+func encodeECHConfigList(configs ...[]byte) []byte {
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, config := range configs {
+			b.AddBytes(config)
+		}
+	})
+	return b.BytesOrPanic()
+}
+
+func TestECHConfigListPublicName(t *testing.T) {
+	// unknownVersion returns an ECHConfig with an unknown version.
+	unknownVersion := func() []byte {
+		b := cryptobyte.NewBuilder(nil)
+		b.AddUint16(0xfe0a)
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes([]byte{1, 2, 3, 4})
+		})
+		return b.BytesOrPanic()
+	}
+
+	cases := []struct {
+		name   string
+		input  []byte
+		expect string
+	}{{
+		name:   "with a nil list",
+		input:  nil,
+		expect: "",
+	}, {
+		name:   "with an empty list",
+		input:  encodeECHConfigList(),
+		expect: "",
+	}, {
+		name:   "with a valid config",
+		input:  encodeECHConfigList(encodeECHConfig(1, make([]byte, 32), "cloudflare-ech.com")),
+		expect: "cloudflare-ech.com",
+	}, {
+		name: "with an unknown version followed by a valid config",
+		input: encodeECHConfigList(
+			unknownVersion(), encodeECHConfig(1, make([]byte, 32), "public.example.com")),
+		expect: "public.example.com",
+	}, {
+		name:   "with a truncated config",
+		input:  encodeECHConfigList(encodeECHConfig(1, make([]byte, 32), "cloudflare-ech.com")[:10]),
+		expect: "",
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := echConfigListPublicName(tc.input); got != tc.expect {
+				t.Fatal("expected", tc.expect, "got", got)
+			}
+		})
+	}
+}
+
+func TestMeasurerLookupECHConfigList(t *testing.T) {
+	t.Run("on success", func(t *testing.T) {
+		expect := []byte{0, 1, 2, 3}
+		reso := &mocks.Resolver{
+			MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+				return &model.HTTPSSvc{ECHConfig: expect}, nil
+			},
+		}
+		m := &Measurer{}
+		got := m.lookupECHConfigList(context.Background(), model.DiscardLogger, reso, "example.com")
+		if string(got) != string(expect) {
+			t.Fatal("unexpected config list", got)
+		}
+	})
+
+	t.Run("on failure", func(t *testing.T) {
+		reso := &mocks.Resolver{
+			MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+				return nil, errors.New("mocked error")
+			},
+		}
+		m := &Measurer{}
+		got := m.lookupECHConfigList(context.Background(), model.DiscardLogger, reso, "example.com")
+		if got != nil {
+			t.Fatal("expected nil config list")
+		}
+	})
+}
@@ -16,11 +16,13 @@ import (
 	"github.com/ooni/probe-engine/pkg/logx"
 	"github.com/ooni/probe-engine/pkg/measurexlite"
 	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/runtimex"
 )
 
 const (
 	testName    = "tlsping"
-	testVersion = "0.2.1"
+	testVersion = "0.3.0"
 )
 
 // Config contains the experiment configuration.
@@ -28,6 +30,9 @@ type Config struct {
 	// ALPN allows to specify which ALPN or ALPNs to send.
 	ALPN string `ooni:"space separated list of ALPNs to use"`
 
+	// ClientHelloID is the name of the TLS ClientHello fingerprint to use.
+	ClientHelloID string `ooni:"TLS ClientHello fingerprint to use (android, chrome, firefox, golang, ios, randomized, safari)"`
+
 	// Delay is the delay between each repetition (in milliseconds).
 	Delay int64 `ooni:"number of milliseconds to wait before sending each ping"`
 
@@ -36,6 +41,9 @@ type Config struct {
 
 	// SNI is the SNI value to use.
 	SNI string `ooni:"the SNI value to use"`
+
+	// TLSFingerprints enables recording the ClientHello and computing JA3/JA4 fingerprints.
+	TLSFingerprints bool `ooni:"record the ClientHello and compute the JA3/JA4 fingerprints"`
 }
 
 func (c *Config) alpn() string {
@@ -129,6 +137,9 @@ func (m *Measurer) Run(ctx context.Context, args *model.ExperimentArgs) error {
 	if parsed.Port() == "" {
 		return errMissingPort
 	}
+	if _, err := netxlite.ParseClientHelloID(m.config.ClientHelloID); err != nil {
+		return err
+	}
 	tk := new(TestKeys)
 	measurement.TestKeys = tk
 	out := make(chan *SinglePing)
@@ -169,6 +180,7 @@ func (m *Measurer) tlsConnectAndHandshake(ctx context.Context, index int64,
 		TLSHandshake:  nil,
 	}
 	trace := measurexlite.NewTrace(index, zeroTime)
+	trace.TLSFingerprints = m.config.TLSFingerprints
 	dialer := trace.NewDialerWithoutResolver(logger)
 	alpn := strings.Split(m.config.alpn(), " ")
 	sni := m.config.sni(address)
@@ -180,7 +192,7 @@ func (m *Measurer) tlsConnectAndHandshake(ctx context.Context, index int64,
 		return sp
 	}
 	defer conn.Close()
-	thx := trace.NewTLSHandshakerStdlib(logger)
+	thx := runtimex.Try1(trace.NewTLSHandshakerClientHello(logger, m.config.ClientHelloID)) // validated in Run
 	// See https://github.com/ooni/probe/issues/2413 to understand
 	// why we're using nil to force netxlite to use the cached
 	// default Mozilla cert pool.
@@ -53,7 +53,7 @@ func TestMeasurerRun(t *testing.T) {
 		if m.ExperimentName() != "tlsping" {
 			t.Fatal("invalid experiment name")
 		}
-		if m.ExperimentVersion() != "0.2.1" {
+		if m.ExperimentVersion() != "0.3.0" {
 			t.Fatal("invalid experiment version")
 		}
 
@@ -255,6 +255,120 @@ func TestMeasurerRun(t *testing.T) {
 	})
 }
 
+func TestMeasurerRunWithClientHelloID(t *testing.T) {
+	// runHelper is an helper function to run this set of tests.
+	runHelper := func(config Config) (*model.Measurement, error) {
+		config.Delay = 1 // millisecond
+		config.Repetitions = NPINGS
+		config.SNI = SNI
+		m := NewExperimentMeasurer(config)
+		meas := &model.Measurement{
+			Input: "tlshandshake://8.8.8.8:443",
+		}
+		args := &model.ExperimentArgs{
+			Callbacks:   model.NewPrinterCallbacks(model.DiscardLogger),
+			Measurement: meas,
+			Session: &mocks.Session{
+				MockLogger: func() model.Logger { return model.DiscardLogger },
+			},
+		}
+		err := m.Run(context.Background(), args)
+		return meas, err
+	}
+
+	t.Run("with an unknown ClientHello fingerprint", func(t *testing.T) {
+		meas, err := runHelper(Config{ClientHelloID: "netscape"})
+		if !errors.Is(err, netxlite.ErrUnknownClientHelloID) {
+			t.Fatal("unexpected error", err)
+		}
+		if meas.TestKeys != nil {
+			t.Fatal("expected nil test keys")
+		}
+	})
+
+	t.Run("with netem: with a known ClientHello fingerprint: expect success", func(t *testing.T) {
+		// create a new test environment
+		env := netemx.MustNewQAEnv(netemx.QAEnvOptionNetStack(
+			"8.8.8.8",
+			&netemx.HTTPSecureServerFactory{
+				Factory:          netemx.ExampleWebPageHandlerFactory(),
+				Ports:            []int{443},
+				ServerNameMain:   SNI,
+				ServerNameExtras: []string{},
+			},
+		))
+		defer env.Close()
+
+		env.Do(func() {
+			meas, err := runHelper(Config{ClientHelloID: "firefox"})
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			tk, _ := (meas.TestKeys).(*TestKeys)
+			if len(tk.Pings) != NPINGS {
+				t.Fatal("unexpected number of pings")
+			}
+
+			for _, p := range tk.Pings {
+				if p.TLSHandshake == nil {
+					t.Fatal("TLSHandshake should not be nil")
+				}
+				if p.TLSHandshake.Failure != nil {
+					t.Fatal("unexpected error", *p.TLSHandshake.Failure)
+				}
+				if p.TLSHandshake.ClientHelloID != "firefox" {
+					t.Fatal("unexpected ClientHelloID", p.TLSHandshake.ClientHelloID)
+				}
+				if p.TLSHandshake.JA3 != "" || p.TLSHandshake.JA4 != "" {
+					t.Fatal("expected no fingerprints by default")
+				}
+			}
+		})
+	})
+
+	t.Run("with netem: with TLS fingerprints: expect fingerprints", func(t *testing.T) {
+		// create a new test environment
+		env := netemx.MustNewQAEnv(netemx.QAEnvOptionNetStack(
+			"8.8.8.8",
+			&netemx.HTTPSecureServerFactory{
+				Factory:          netemx.ExampleWebPageHandlerFactory(),
+				Ports:            []int{443},
+				ServerNameMain:   SNI,
+				ServerNameExtras: []string{},
+			},
+		))
+		defer env.Close()
+
+		env.Do(func() {
+			meas, err := runHelper(Config{ClientHelloID: "chrome", TLSFingerprints: true})
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			tk, _ := (meas.TestKeys).(*TestKeys)
+			if len(tk.Pings) != NPINGS {
+				t.Fatal("unexpected number of pings")
+			}
+
+			for _, p := range tk.Pings {
+				if p.TLSHandshake == nil {
+					t.Fatal("TLSHandshake should not be nil")
+				}
+				if len(p.TLSHandshake.ClientHello) <= 0 {
+					t.Fatal("expected to see the ClientHello")
+				}
+				if p.TLSHandshake.JA3 == "" || p.TLSHandshake.JA4 == "" {
+					t.Fatal("expected to see the JA3 and JA4 fingerprints")
+				}
+				if p.TLSHandshake.JA3S == "" || p.TLSHandshake.JA4S == "" {
+					t.Fatal("expected to see the JA3S and JA4S fingerprints")
+				}
+			}
+		})
+	})
+}
+
 func TestConfig_sni(t *testing.T) {
 	type fields struct {
 		SNI string
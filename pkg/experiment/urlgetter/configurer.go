@@ -41,6 +41,7 @@ func (c Configurer) NewConfiguration() (Configuration, error) {
 		HTTPConfig: netx.Config{
 			BogonIsError:        c.Config.RejectDNSBogons,
 			CacheResolutions:    true,
+			ClientHelloID:       c.Config.ClientHelloID,
 			ContextByteCounting: true,
 			HTTP3Enabled:        c.Config.HTTP3Enabled,
 			Logger:              c.Logger,
@@ -80,6 +81,13 @@ func (c Configurer) NewConfiguration() (Configuration, error) {
 	configuration.DNSClient = dnsclient
 	configuration.HTTPConfig.BaseResolver = dnsclient
 	// configure TLS
+	clientHelloID, err := netxlite.ParseClientHelloID(c.Config.ClientHelloID)
+	if err != nil {
+		return configuration, err
+	}
+	if clientHelloID != nil && c.Config.TLSVersion != "" {
+		return configuration, errors.New("cannot force the TLS version with a ClientHelloID other than golang")
+	}
 	configuration.HTTPConfig.TLSConfig = &tls.Config{ // #nosec G402 - we need to use a large TLS versions range for measuring
 		NextProtos: []string{"h2", "http/1.1"},
 	}
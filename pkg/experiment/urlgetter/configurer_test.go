@@ -670,6 +670,55 @@ func TestConfigurerNewConfigurationTLSvInvalid(t *testing.T) {
 	}
 }
 
+func TestConfigurerNewConfigurationClientHelloID(t *testing.T) {
+	saver := new(tracex.Saver)
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			ClientHelloID: "firefox",
+		},
+		Logger: log.Log,
+		Saver:  saver,
+	}
+	configuration, err := configurer.NewConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configuration.HTTPConfig.ClientHelloID != "firefox" {
+		t.Fatal("invalid ClientHelloID")
+	}
+}
+
+func TestConfigurerNewConfigurationClientHelloIDInvalid(t *testing.T) {
+	saver := new(tracex.Saver)
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			ClientHelloID: "netscape",
+		},
+		Logger: log.Log,
+		Saver:  saver,
+	}
+	_, err := configurer.NewConfiguration()
+	if !errors.Is(err, netxlite.ErrUnknownClientHelloID) {
+		t.Fatalf("not the error we expected: %+v", err)
+	}
+}
+
+func TestConfigurerNewConfigurationClientHelloIDWithTLSVersion(t *testing.T) {
+	saver := new(tracex.Saver)
+	configurer := urlgetter.Configurer{
+		Config: urlgetter.Config{
+			ClientHelloID: "chrome",
+			TLSVersion:    "TLSv1.3",
+		},
+		Logger: log.Log,
+		Saver:  saver,
+	}
+	_, err := configurer.NewConfiguration()
+	if err == nil || err.Error() != "cannot force the TLS version with a ClientHelloID other than golang" {
+		t.Fatalf("not the error we expected: %+v", err)
+	}
+}
+
 func TestConfigurerNewConfigurationProxyURL(t *testing.T) {
 	URL, _ := url.Parse("socks5://127.0.0.1:9050")
 	saver := new(tracex.Saver)
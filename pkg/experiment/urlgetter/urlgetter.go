@@ -29,6 +29,7 @@ type Config struct {
 	Timeout  time.Duration
 
 	// settable from command line
+	ClientHelloID     string `ooni:"TLS ClientHello fingerprint to use (android, chrome, firefox, golang, ios, randomized, safari)"`
 	DNSCache          string `ooni:"Add 'DOMAIN IP...' to cache"`
 	DNSHTTPHost       string `ooni:"Force using specific HTTP Host header for DNS requests"`
 	DNSTLSServerName  string `ooni:"Force TLS to using a specific SNI for encrypted DNS requests"`
@@ -73,12 +73,14 @@ func analysisClassicDNSConsistency(woa *minipipeline.WebAnalysis) optional.Value
 	switch {
 	case woa.DNSLookupUnexpectedFailure.Len() <= 0 && // no unexpected failures; and
 		woa.DNSLookupSuccessWithInvalidAddressesClassic.Len() <= 0 && // no invalid addresses; and
+		woa.DNSLookupDNSSECBogus.Len() <= 0 && // no bogus DNSSEC responses; and
 		(woa.DNSLookupSuccessWithValidAddressClassic.Len() > 0 || // good addrs; or
 			woa.DNSLookupExpectedFailure.Len() > 0): // expected failures
 		return optional.Some("consistent")
 
 	case woa.DNSLookupSuccessWithInvalidAddressesClassic.Len() > 0 || // unexpected addrs; or
 		woa.DNSLookupUnexpectedFailure.Len() > 0 || // unexpected failures; or
+		woa.DNSLookupDNSSECBogus.Len() > 0 || // bogus DNSSEC responses; or
 		(woa.DNSLookupSuccess.Len() > 0 && // successful lookups; and
 			!woa.ControlExpectations.IsNone() && // we have control info; and
 			woa.ControlExpectations.Unwrap().DNSAddresses.Len() <= 0): // control resolved nothing
@@ -2,6 +2,7 @@ package webconnectivitylte
 
 import (
 	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -129,3 +130,27 @@ func TestAnalysisClassicContainsOnlyLoopbackAddrs(t *testing.T) {
 		})
 	}
 }
+
+func TestAnalysisDNSSECBogus(t *testing.T) {
+	woa := &minipipeline.WebAnalysis{
+		DNSLookupDNSSECBogus:                    minipipeline.NewSet[int64](2),
+		DNSLookupSuccessWithValidAddressClassic: minipipeline.NewSet[int64](1),
+	}
+
+	t.Run("the classic analysis says the DNS is inconsistent", func(t *testing.T) {
+		if got := analysisClassicDNSConsistency(woa); got.UnwrapOr("") != "inconsistent" {
+			t.Fatal("unexpected DNS consistency", got)
+		}
+	})
+
+	t.Run("the extended analysis flags DNS blocking", func(t *testing.T) {
+		tk := &TestKeys{}
+		analysisExtDNS(tk, woa, io.Discard)
+		if tk.BlockingFlags != AnalysisBlockingFlagDNSBlocking {
+			t.Fatal("unexpected blocking flags", tk.BlockingFlags)
+		}
+		if tk.DNSFlags != AnalysisDNSFlagDNSSECBogus {
+			t.Fatal("unexpected DNS flags", tk.DNSFlags)
+		}
+	})
+}
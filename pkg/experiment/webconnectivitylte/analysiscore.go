@@ -75,4 +75,8 @@ const (
 	// AnalysisDNSFlagUnexpectedAddrs indicates the TH resolved
 	// different addresses from the probe
 	AnalysisDNSFlagUnexpectedAddrs
+
+	// AnalysisDNSFlagDNSSECBogus indicates that a response
+	// failed DNSSEC validation
+	AnalysisDNSFlagDNSSECBogus
 )
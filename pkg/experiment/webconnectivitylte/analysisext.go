@@ -89,6 +89,14 @@ func analysisExtDNS(tk *TestKeys, analysis *minipipeline.WebAnalysis, info io.Wr
 		tk.DNSFlags |= AnalysisDNSFlagUnexpectedAddrs
 		fmt.Fprintf(info, "- transactions with invalid IP addrs: %s\n", failures.String())
 	}
+
+	// Implementation note: unlike the cases above, we do not need control information
+	// because a response failing DNSSEC validation has been tampered with.
+	if failures := analysis.DNSLookupDNSSECBogus; failures.Len() > 0 {
+		tk.BlockingFlags |= AnalysisBlockingFlagDNSBlocking
+		tk.DNSFlags |= AnalysisDNSFlagDNSSECBogus
+		fmt.Fprintf(info, "- transactions failing DNSSEC validation: %s\n", failures.String())
+	}
 }
 
 func analysisExtEndpointFailure(tk *TestKeys, analysis *minipipeline.WebAnalysis, info io.Writer) {
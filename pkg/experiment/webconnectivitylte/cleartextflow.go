@@ -62,6 +62,10 @@ type CleartextFlow struct {
 	// WaitGroup is the MANDATORY wait group this task belongs to.
 	WaitGroup *sync.WaitGroup
 
+	// ClientHelloID is the OPTIONAL name of the TLS ClientHello fingerprint to
+	// use. If this field is not set we use the Go standard library.
+	ClientHelloID string
+
 	// CookieJar contains the OPTIONAL cookie jar, used for redirects.
 	CookieJar http.CookieJar
 
@@ -330,6 +334,7 @@ func (t *CleartextFlow) maybeFollowRedirects(ctx context.Context, resp *http.Res
 		t.Logger.Infof("redirect to: %s", location.String())
 		resolvers := &DNSResolvers{
 			CookieJar:               t.CookieJar,
+			ClientHelloID:           t.ClientHelloID,
 			Depth:                   t.Depth + 1,
 			DNSOverHTTPSURLProvider: t.DNSOverHTTPSURLProvider,
 			DNSCache:                t.DNSCache,
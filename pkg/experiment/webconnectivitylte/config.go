@@ -6,5 +6,8 @@ package webconnectivitylte
 
 // Config contains webconnectivity experiment configuration.
 type Config struct {
+	// ClientHelloID is the name of the TLS ClientHello fingerprint to use.
+	ClientHelloID string `ooni:"TLS ClientHello fingerprint to use (android, chrome, firefox, golang, ios, randomized, safari)"`
+
 	DNSOverUDPResolver string
 }
@@ -96,7 +96,9 @@ func (c *Control) Run(parentCtx context.Context) {
 			"Accept-Language": {model.HTTPHeaderAcceptLanguage},
 			"User-Agent":      {model.HTTPHeaderUserAgent},
 		},
-		TCPConnect: endpoints,
+		TCPConnect:  endpoints,
+		XTLSDetails: true,
+		XVantages:   true,
 	}
 	c.TestKeys.SetControlRequest(creq)
 
@@ -20,6 +20,10 @@ const (
 
 	// DNSAddrFlagHTTPS means we discovered this addr using the DNS-over-HTTPS resolver.
 	DNSAddrFlagHTTPS
+
+	// DNSAddrFlagHTTPSSvcHint means we discovered this addr using the IP address
+	// hints contained inside the HTTPS resource records for the domain.
+	DNSAddrFlagHTTPSSvcHint
 )
 
 // DNSCache wraps a model.Resolver to provide DNS caching.
@@ -12,6 +12,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
@@ -61,6 +62,10 @@ type DNSResolvers struct {
 	// WaitGroup is the MANDATORY wait group this task belongs to.
 	WaitGroup *sync.WaitGroup
 
+	// ClientHelloID is the OPTIONAL name of the TLS ClientHello fingerprint to
+	// use. If this field is not set we use the Go standard library.
+	ClientHelloID string
+
 	// CookieJar contains the OPTIONAL cookie jar, used for redirects.
 	CookieJar http.CookieJar
 
@@ -103,6 +108,7 @@ func (t *DNSResolvers) run(parentCtx context.Context) []DNSEntry {
 	systemOut := make(chan []string)
 	udpOut := make(chan []string)
 	httpsOut := make(chan []string)
+	httpsSvcOut := make(chan []string)
 	whoamiSystemV4Out := make(chan []webconnectivityalgo.DNSWhoamiInfoEntry)
 	whoamiUDPv4Out := make(chan []webconnectivityalgo.DNSWhoamiInfoEntry)
 
@@ -114,6 +120,7 @@ func (t *DNSResolvers) run(parentCtx context.Context) []DNSEntry {
 	go t.lookupHostSystem(parentCtx, systemOut)
 	go t.lookupHostUDP(parentCtx, udpAddress, udpOut)
 	go t.lookupHostDNSOverHTTPS(parentCtx, httpsOut)
+	go t.lookupHTTPSSvcUDP(parentCtx, udpAddress, httpsSvcOut)
 	go t.whoamiSystemV4(parentCtx, whoamiSystemV4Out)
 	go t.whoamiUDPv4(parentCtx, udpAddress, whoamiUDPv4Out)
 
@@ -121,6 +128,7 @@ func (t *DNSResolvers) run(parentCtx context.Context) []DNSEntry {
 	systemAddrs := <-systemOut
 	udpAddrs := <-udpOut
 	httpsAddrs := <-httpsOut
+	httpsSvcAddrs := <-httpsSvcOut
 
 	// collect whoami results (which also may be nil/empty)
 	whoamiSystemV4 := <-whoamiSystemV4Out
@@ -153,6 +161,13 @@ func (t *DNSResolvers) run(parentCtx context.Context) []DNSEntry {
 		merged[addr].Addr = addr
 		merged[addr].Flags |= DNSAddrFlagHTTPS
 	}
+	for _, addr := range httpsSvcAddrs {
+		if _, found := merged[addr]; !found {
+			merged[addr] = &DNSEntry{}
+		}
+		merged[addr].Addr = addr
+		merged[addr].Flags |= DNSAddrFlagHTTPSSvcHint
+	}
 	var entries []DNSEntry
 	for _, entry := range merged {
 		entries = append(entries, *entry)
@@ -287,6 +302,66 @@ func (t *DNSResolvers) waitForLateReplies(parentCtx context.Context, trace *meas
 	t.TestKeys.AppendDNSLateReplies(events...)
 }
 
+// lookupHTTPSSvcUDP performs an HTTPS lookup using an UDP resolver and returns the
+// IP address hints usable for connecting to the URL's port. We only perform this lookup
+// for HTTPS URLs. The ECH configs, if any, are only archived as part of the query
+// results since netxlite's TLS handshaker (based on oocrypto) cannot use them. This function must always
+// emit an ouput on the [out] channel to synchronize with the caller func.
+func (t *DNSResolvers) lookupHTTPSSvcUDP(parentCtx context.Context, udpAddress string, out chan<- []string) {
+	if t.URL.Scheme != "https" {
+		// HTTPS records only describe how to reach HTTPS endpoints
+		out <- []string{}
+		return
+	}
+
+	// create context with attached a timeout
+	const timeout = 4 * time.Second
+	lookupCtx, lookpCancel := context.WithTimeout(parentCtx, timeout)
+	defer lookpCancel()
+
+	// create trace's index
+	index := t.IDGenerator.NewIDForDNSOverUDP()
+
+	// create trace
+	trace := measurexlite.NewTrace(index, t.ZeroTime, fmt.Sprintf("depth=%d", t.Depth))
+
+	// start the operation logger
+	ol := logx.NewOperationLogger(
+		t.Logger, "[#%d] lookup HTTPS %s using %s", index, t.Domain, udpAddress,
+	)
+
+	// runs the lookup
+	netx := &netxlite.Netx{}
+	dialer := netx.NewDialerWithoutResolver(t.Logger)
+	reso := trace.NewParallelUDPResolver(t.Logger, dialer, udpAddress)
+	https, err := reso.LookupHTTPS(lookupCtx, t.Domain)
+
+	// saves the results making sure we split Do53 queries from other queries
+	do53, other := t.do53SplitQueries(trace.DNSLookupsFromRoundTrip())
+	t.TestKeys.AppendQueries(do53...)
+	t.TestKeys.WithTestKeysDo53(func(tkd *TestKeysDo53) {
+		tkd.Queries = append(tkd.Queries, other...)
+		tkd.NetworkEvents = append(tkd.NetworkEvents, trace.NetworkEvents()...)
+	})
+
+	ol.Stop(err)
+	out <- httpsSvcHints(https, t.URL)
+}
+
+// httpsSvcHints returns the IP address hints inside the given, possibly nil, HTTPS
+// lookup result that we can use to connect to the port implied by the given URL.
+func httpsSvcHints(https *model.HTTPSSvc, URL *url.URL) []string {
+	port := uint16(443)
+	if urlPort := URL.Port(); urlPort != "" {
+		value, err := strconv.ParseUint(urlPort, 10, 16)
+		if err != nil {
+			return nil
+		}
+		port = uint16(value)
+	}
+	return https.AddressHints(port)
+}
+
 // Divides queries generated by Do53 in Do53-proper queries and other queries.
 func (t *DNSResolvers) do53SplitQueries(
 	input []*model.ArchivalDNSLookupResult) (do53, other []*model.ArchivalDNSLookupResult) {
@@ -405,6 +480,7 @@ func (t *DNSResolvers) startCleartextFlows(
 			ZeroTime:                t.ZeroTime,
 			WaitGroup:               t.WaitGroup,
 			CookieJar:               t.CookieJar,
+			ClientHelloID:           t.ClientHelloID,
 			FollowRedirects:         t.URL.Scheme == "http",
 			HostHeader:              t.URL.Host,
 			PrioSelector:            ps,
@@ -457,6 +533,7 @@ func (t *DNSResolvers) startSecureFlows(
 			WaitGroup:               t.WaitGroup,
 			ALPN:                    []string{"h2", "http/1.1"},
 			CookieJar:               t.CookieJar,
+			ClientHelloID:           t.ClientHelloID,
 			FollowRedirects:         t.URL.Scheme == "https",
 			SNI:                     t.URL.Hostname(),
 			HostHeader:              t.URL.Host,
@@ -0,0 +1,73 @@
+package webconnectivitylte
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+func Test_httpsSvcHints(t *testing.T) {
+	https := &model.HTTPSSvc{
+		Records: []*model.HTTPSSvcRecord{{
+			Priority:   0,
+			TargetName: "cdn.example.com.",
+		}, {
+			Priority:   1,
+			TargetName: ".",
+			IPv4:       []string{"1.1.1.1"},
+			IPv6:       []string{"::1"},
+		}, {
+			Priority:   2,
+			TargetName: ".",
+			Port:       8443,
+			IPv4:       []string{"2.2.2.2"},
+		}},
+	}
+
+	tests := []struct {
+		name  string
+		https *model.HTTPSSvc
+		URL   string
+		want  []string
+	}{{
+		name:  "with nil HTTPS lookup results",
+		https: nil,
+		URL:   "https://www.example.com/",
+		want:  nil,
+	}, {
+		name:  "with the default port",
+		https: https,
+		URL:   "https://www.example.com/",
+		want:  []string{"1.1.1.1", "::1"},
+	}, {
+		name:  "with an explicit port matching a record",
+		https: https,
+		URL:   "https://www.example.com:8443/",
+		want:  []string{"1.1.1.1", "::1", "2.2.2.2"},
+	}, {
+		name:  "with an explicit port not matching any record",
+		https: https,
+		URL:   "https://www.example.com:443/",
+		want:  []string{"1.1.1.1", "::1"},
+	}, {
+		name:  "with an invalid port",
+		https: https,
+		URL:   "https://www.example.com:65536/",
+		want:  nil,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			URL, err := url.Parse(tt.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := httpsSvcHints(tt.https, URL)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
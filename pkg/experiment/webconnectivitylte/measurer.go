@@ -12,6 +12,7 @@ import (
 
 	"github.com/ooni/probe-engine/pkg/inputparser"
 	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
 	"github.com/ooni/probe-engine/pkg/webconnectivityalgo"
 	"golang.org/x/net/publicsuffix"
 )
@@ -83,6 +84,11 @@ func (m *Measurer) Run(ctx context.Context, args *model.ExperimentArgs) error {
 		return err
 	}
 
+	// make sure the TLS ClientHello fingerprint is valid
+	if _, err := netxlite.ParseClientHelloID(m.Config.ClientHelloID); err != nil {
+		return err
+	}
+
 	// initialize the experiment's test keys
 	tk := NewTestKeys()
 	measurement.TestKeys = tk
@@ -126,6 +132,7 @@ func (m *Measurer) Run(ctx context.Context, args *model.ExperimentArgs) error {
 		ZeroTime:                measurement.MeasurementStartTimeSaved,
 		WaitGroup:               wg,
 		CookieJar:               jar,
+		ClientHelloID:           m.Config.ClientHelloID,
 		Referer:                 "",
 		Session:                 sess,
 		TestHelpers:             testhelpers,
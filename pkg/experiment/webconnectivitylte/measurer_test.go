@@ -0,0 +1,51 @@
+package webconnectivitylte
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/webconnectivityqa"
+)
+
+func TestMeasurerWithClientHelloID(t *testing.T) {
+	t.Run("we fail with an unknown ClientHello fingerprint", func(t *testing.T) {
+		measurer := NewExperimentMeasurer(&Config{ClientHelloID: "netscape"})
+		args := &model.ExperimentArgs{
+			Callbacks:   model.NewPrinterCallbacks(model.DiscardLogger),
+			Measurement: &model.Measurement{Input: "https://www.example.com/"},
+			Session:     &mocks.Session{},
+		}
+		err := measurer.Run(context.Background(), args)
+		if !errors.Is(err, netxlite.ErrUnknownClientHelloID) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("we record the ClientHello fingerprint into the TLS handshakes", func(t *testing.T) {
+		tc := &webconnectivityqa.TestCase{
+			Name:  "clientHelloID",
+			Input: "https://www.example.com/",
+		}
+		measurer := NewExperimentMeasurer(&Config{ClientHelloID: "chrome"})
+		measurement, err := webconnectivityqa.MeasureTestCase(measurer, tc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tk := measurement.TestKeys.(*TestKeys)
+		if len(tk.TLSHandshakes) <= 0 {
+			t.Fatal("expected at least one TLS handshake")
+		}
+		for _, hs := range tk.TLSHandshakes {
+			if hs.Failure != nil {
+				t.Fatal("unexpected failure", *hs.Failure)
+			}
+			if hs.ClientHelloID != "chrome" {
+				t.Fatal("unexpected ClientHelloID", hs.ClientHelloID)
+			}
+		}
+	})
+}
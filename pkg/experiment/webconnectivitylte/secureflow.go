@@ -67,6 +67,10 @@ type SecureFlow struct {
 	// ALPN is the OPTIONAL ALPN to use.
 	ALPN []string
 
+	// ClientHelloID is the OPTIONAL name of the TLS ClientHello fingerprint to
+	// use. If this field is not set we use the Go standard library.
+	ClientHelloID string
+
 	// CookieJar contains the OPTIONAL cookie jar, used for redirects.
 	CookieJar http.CookieJar
 
@@ -158,7 +162,12 @@ func (t *SecureFlow) Run(parentCtx context.Context, index int64) error {
 		ol.Stop(err)
 		return err
 	}
-	tlsHandshaker := trace.NewTLSHandshakerStdlib(t.Logger)
+	tlsHandshaker, err := trace.NewTLSHandshakerClientHello(t.Logger, t.ClientHelloID)
+	if err != nil {
+		t.TestKeys.SetFundamentalFailure(err)
+		ol.Stop(err)
+		return err
+	}
 	// See https://github.com/ooni/probe/issues/2413 to understand
 	// why we're using nil to force netxlite to use the cached
 	// default Mozilla cert pool.
@@ -389,6 +398,7 @@ func (t *SecureFlow) maybeFollowRedirects(ctx context.Context, resp *http.Respon
 		t.Logger.Infof("redirect to: %s", location.String())
 		resolvers := &DNSResolvers{
 			CookieJar:               t.CookieJar,
+			ClientHelloID:           t.ClientHelloID,
 			Depth:                   t.Depth + 1,
 			DNSOverHTTPSURLProvider: t.DNSOverHTTPSURLProvider,
 			DNSCache:                t.DNSCache,
@@ -0,0 +1,376 @@
+package exporter
+
+//
+// CSV export
+//
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// CSVTable is a CSV table containing a specific observation type. Each row
+// starts with the [CSVCommonColumns] identifying the measurement.
+type CSVTable struct {
+	// Name is the table name, which we use as the file name.
+	Name string
+
+	// Columns contains the columns specific of this table.
+	Columns []string
+
+	// rows generates the rows specific of this table.
+	rows func(tk *TestKeys) [][]string
+}
+
+// CSVCommonColumns are the columns identifying the measurement.
+var CSVCommonColumns = []string{
+	"report_id",
+	"measurement_start_time",
+	"test_name",
+	"input",
+	"probe_asn",
+	"probe_cc",
+}
+
+// Header returns the table header.
+func (t *CSVTable) Header() []string {
+	return append(append([]string{}, CSVCommonColumns...), t.Columns...)
+}
+
+// Rows returns the table rows for the given record.
+func (t *CSVTable) Rows(rec *Record) (out [][]string) {
+	m := rec.Measurement
+	common := []string{
+		m.ReportID,
+		m.MeasurementStartTime,
+		m.TestName,
+		string(m.Input),
+		m.ProbeASN,
+		m.ProbeCC,
+	}
+	for _, row := range t.rows(rec.TestKeys) {
+		out = append(out, append(append([]string{}, common...), row...))
+	}
+	return
+}
+
+// CSVTableDNSLookups contains a row for each DNS lookup answer or a single
+// row for DNS lookups without any answer (e.g., because of a failure). The
+// raw_response column contains the base64 encoded DNS response, if any.
+var CSVTableDNSLookups = &CSVTable{
+	Name: "dns_lookups",
+	Columns: []string{
+		"transaction_id",
+		"t0",
+		"t",
+		"engine",
+		"resolver_address",
+		"hostname",
+		"query_type",
+		"rcode",
+		"failure",
+		"answer_type",
+		"answer",
+		"ttl",
+		"asn",
+		"as_org_name",
+		"raw_response",
+	},
+	rows: func(tk *TestKeys) (out [][]string) {
+		for _, q := range tk.Queries {
+			prefix := []string{
+				formatInt(q.TransactionID),
+				formatFloat(q.T0),
+				formatFloat(q.T),
+				q.Engine,
+				q.ResolverAddress,
+				q.Hostname,
+				q.QueryType,
+				formatInt(q.Rcode),
+				formatFailure(q.Failure),
+			}
+			suffix := []string{base64.StdEncoding.EncodeToString(q.RawResponse)}
+			if len(q.Answers) <= 0 {
+				out = append(out, concat(prefix, []string{"", "", "", "", ""}, suffix))
+				continue
+			}
+			for _, a := range q.Answers {
+				answer := a.Hostname
+				switch {
+				case a.IPv4 != "":
+					answer = a.IPv4
+				case a.IPv6 != "":
+					answer = a.IPv6
+				}
+				ttl := ""
+				if a.TTL != nil {
+					ttl = strconv.FormatUint(uint64(*a.TTL), 10)
+				}
+				row := []string{a.AnswerType, answer, ttl, formatInt(a.ASN), a.ASOrgName}
+				out = append(out, concat(prefix, row, suffix))
+			}
+		}
+		return
+	},
+}
+
+// CSVTableTCPConnects contains a row for each TCP connect.
+var CSVTableTCPConnects = &CSVTable{
+	Name: "tcp_connects",
+	Columns: []string{
+		"transaction_id",
+		"t0",
+		"t",
+		"ip",
+		"port",
+		"success",
+		"blocked",
+		"failure",
+	},
+	rows: func(tk *TestKeys) (out [][]string) {
+		for _, c := range tk.TCPConnect {
+			blocked := ""
+			if c.Status.Blocked != nil {
+				blocked = strconv.FormatBool(*c.Status.Blocked)
+			}
+			out = append(out, []string{
+				formatInt(c.TransactionID),
+				formatFloat(c.T0),
+				formatFloat(c.T),
+				c.IP,
+				strconv.Itoa(c.Port),
+				strconv.FormatBool(c.Status.Success),
+				blocked,
+				formatFailure(c.Status.Failure),
+			})
+		}
+		return
+	},
+}
+
+// CSVTableTLSHandshakes contains a row for each TLS or QUIC handshake. The
+// peer_certificates column contains the space-separated base64 encoding of
+// each DER certificate sent by the peer.
+var CSVTableTLSHandshakes = &CSVTable{
+	Name: "tls_handshakes",
+	Columns: []string{
+		"transaction_id",
+		"t0",
+		"t",
+		"network",
+		"address",
+		"server_name",
+		"outer_server_name",
+		"tls_version",
+		"cipher_suite",
+		"client_hello_id",
+		"ja3",
+		"ja3s",
+		"ja4",
+		"ja4s",
+		"negotiated_protocol",
+		"no_tls_verify",
+		"failure",
+		"so_error",
+		"peer_certificates",
+	},
+	rows: func(tk *TestKeys) (out [][]string) {
+		for _, h := range append(append([]*model.ArchivalTLSOrQUICHandshakeResult{},
+			tk.TLSHandshakes...), tk.QUICHandshakes...) {
+			var certs []string
+			for _, cert := range h.PeerCertificates {
+				certs = append(certs, base64.StdEncoding.EncodeToString(cert))
+			}
+			out = append(out, []string{
+				formatInt(h.TransactionID),
+				formatFloat(h.T0),
+				formatFloat(h.T),
+				h.Network,
+				h.Address,
+				h.ServerName,
+				h.OuterServerName,
+				h.TLSVersion,
+				h.CipherSuite,
+				h.ClientHelloID,
+				h.JA3,
+				h.JA3S,
+				h.JA4,
+				h.JA4S,
+				h.NegotiatedProtocol,
+				strconv.FormatBool(h.NoTLSVerify),
+				formatFailure(h.Failure),
+				formatFailure(h.SoError),
+				strings.Join(certs, " "),
+			})
+		}
+		return
+	},
+}
+
+// CSVTableHTTPRequests contains a row for each HTTP request. The headers columns
+// contain the JSON serialization of the headers list, where possibly-binary strings
+// use the OONI data format. The body columns contain the body encoded using
+// [EncodeMaybeBinary] and the corresponding *_encoding column contains the encoding.
+var CSVTableHTTPRequests = &CSVTable{
+	Name: "http_requests",
+	Columns: []string{
+		"transaction_id",
+		"t0",
+		"t",
+		"network",
+		"address",
+		"alpn",
+		"method",
+		"url",
+		"request_headers",
+		"request_body",
+		"request_body_encoding",
+		"response_code",
+		"response_headers",
+		"response_body",
+		"response_body_encoding",
+		"response_body_is_truncated",
+		"failure",
+	},
+	rows: func(tk *TestKeys) (out [][]string) {
+		for _, r := range tk.Requests {
+			reqBody, reqBodyEncoding := EncodeMaybeBinary(string(r.Request.Body))
+			respBody, respBodyEncoding := EncodeMaybeBinary(string(r.Response.Body))
+			out = append(out, []string{
+				formatInt(r.TransactionID),
+				formatFloat(r.T0),
+				formatFloat(r.T),
+				r.Network,
+				r.Address,
+				r.ALPN,
+				r.Request.Method,
+				r.Request.URL,
+				EncodeHTTPHeaders(httpHeadersList(r.Request.HeadersList, r.Request.Headers)),
+				reqBody,
+				reqBodyEncoding,
+				formatInt(r.Response.Code),
+				EncodeHTTPHeaders(httpHeadersList(r.Response.HeadersList, r.Response.Headers)),
+				respBody,
+				respBodyEncoding,
+				strconv.FormatBool(r.Response.BodyIsTruncated),
+				formatFailure(r.Failure),
+			})
+		}
+		return
+	},
+}
+
+// CSVTables contains all the CSV tables.
+var CSVTables = []*CSVTable{
+	CSVTableDNSLookups,
+	CSVTableTCPConnects,
+	CSVTableTLSHandshakes,
+	CSVTableHTTPRequests,
+}
+
+// EncodeHTTPHeaders serializes a list of HTTP headers to JSON using the OONI data
+// format for possibly-binary strings. Use [DecodeHTTPHeaders] to parse the result.
+func EncodeHTTPHeaders(headers []model.ArchivalHTTPHeader) string {
+	values := [][2]any{}
+	for _, h := range headers {
+		values = append(values, [2]any{maybeBinaryValue(string(h[0])), maybeBinaryValue(string(h[1]))})
+	}
+	data, err := json.Marshal(values)
+	runtimex.PanicOnError(err, "json.Marshal unexpectedly failed")
+	return string(data)
+}
+
+// DecodeHTTPHeaders is the inverse of [EncodeHTTPHeaders].
+func DecodeHTTPHeaders(value string) ([]model.ArchivalHTTPHeader, error) {
+	var headers []model.ArchivalHTTPHeader
+	if err := json.Unmarshal([]byte(value), &headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// CSVExporter exports records into a directory containing a CSV file for each
+// table in [CSVTables]. Construct using [NewCSVExporter].
+type CSVExporter struct {
+	files   []*os.File
+	writers []*csv.Writer
+}
+
+// NewCSVExporter creates the given directory, if needed, and the CSV files inside
+// it, overwriting existing files, and returns a new [*CSVExporter].
+func NewCSVExporter(dir string) (*CSVExporter, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	exp := &CSVExporter{}
+	for _, table := range CSVTables {
+		filep, err := os.Create(filepath.Join(dir, table.Name+".csv"))
+		if err != nil {
+			exp.Close()
+			return nil, err
+		}
+		writer := csv.NewWriter(filep)
+		exp.files = append(exp.files, filep)
+		exp.writers = append(exp.writers, writer)
+		if err := writer.Write(table.Header()); err != nil {
+			exp.Close()
+			return nil, err
+		}
+	}
+	return exp, nil
+}
+
+// Export writes the rows of the given record into the CSV files.
+func (exp *CSVExporter) Export(rec *Record) error {
+	for idx, table := range CSVTables {
+		if err := exp.writers[idx].WriteAll(table.Rows(rec)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes the CSV files.
+func (exp *CSVExporter) Close() error {
+	var errs []error
+	for idx, filep := range exp.files {
+		exp.writers[idx].Flush()
+		errs = append(errs, exp.writers[idx].Error(), filep.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// concat concatenates string slices.
+func concat(slices ...[]string) (out []string) {
+	for _, s := range slices {
+		out = append(out, s...)
+	}
+	return
+}
+
+// formatFailure formats an OONI failure.
+func formatFailure(failure *string) string {
+	if failure == nil {
+		return ""
+	}
+	return *failure
+}
+
+// formatFloat formats a float64.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// formatInt formats an int64.
+func formatInt(value int64) string {
+	return strconv.FormatInt(value, 10)
+}
@@ -0,0 +1,157 @@
+package exporter
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// readCSVTable reads the given table from the given directory and returns
+// the rows as maps from the column name to the value.
+func readCSVTable(t *testing.T, dir string, table *CSVTable) []map[string]string {
+	filep, err := os.Open(filepath.Join(dir, table.Name+".csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filep.Close()
+	records, err := csv.NewReader(filep).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(table.Header(), records[0]); diff != "" {
+		t.Fatal(diff)
+	}
+	var out []map[string]string
+	for _, record := range records[1:] {
+		row := make(map[string]string)
+		for idx, value := range record {
+			row[records[0][idx]] = value
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+func TestCSVExporter(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "csv")
+	exp, err := NewCSVExporter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := ParseRecord(newTestingMeasurement(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exp.Export(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := exp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("dns_lookups", func(t *testing.T) {
+		rows := readCSVTable(t, dir, CSVTableDNSLookups)
+		if len(rows) != 3 {
+			t.Fatal("unexpected number of rows", len(rows))
+		}
+		if rows[0]["answer"] != "93.184.216.34" || rows[0]["ttl"] != "300" || rows[0]["asn"] != "15133" {
+			t.Fatalf("unexpected row %+v", rows[0])
+		}
+		if rows[1]["answer"] != "www.example.com." || rows[1]["ttl"] != "" {
+			t.Fatalf("unexpected row %+v", rows[1])
+		}
+		if rows[2]["failure"] != "connection_reset" || rows[2]["answer_type"] != "" {
+			t.Fatalf("unexpected row %+v", rows[2])
+		}
+		if rows[0]["raw_response"] != base64.StdEncoding.EncodeToString([]byte{0x00, 0x01}) {
+			t.Fatal("unexpected raw response", rows[0]["raw_response"])
+		}
+		if rows[0]["report_id"] != rec.Measurement.ReportID || rows[0]["probe_asn"] != "AS30722" {
+			t.Fatalf("unexpected common columns %+v", rows[0])
+		}
+	})
+
+	t.Run("tcp_connects", func(t *testing.T) {
+		rows := readCSVTable(t, dir, CSVTableTCPConnects)
+		if len(rows) != 1 || rows[0]["success"] != "true" || rows[0]["port"] != "443" {
+			t.Fatalf("unexpected rows %+v", rows)
+		}
+	})
+
+	t.Run("tls_handshakes", func(t *testing.T) {
+		rows := readCSVTable(t, dir, CSVTableTLSHandshakes)
+		if len(rows) != 2 {
+			t.Fatal("unexpected number of rows", len(rows))
+		}
+		var certs []model.ArchivalBinaryData
+		for _, encoded := range strings.Fields(rows[0]["peer_certificates"]) {
+			cert, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			certs = append(certs, cert)
+		}
+		if diff := cmp.Diff(rec.TestKeys.TLSHandshakes[0].PeerCertificates, certs); diff != "" {
+			t.Fatal(diff)
+		}
+		if rows[1]["network"] != "udp" || rows[1]["failure"] != "connection_reset" {
+			t.Fatalf("unexpected row %+v", rows[1])
+		}
+	})
+
+	t.Run("http_requests", func(t *testing.T) {
+		rows := readCSVTable(t, dir, CSVTableHTTPRequests)
+		if len(rows) != 2 {
+			t.Fatal("unexpected number of rows", len(rows))
+		}
+		if rows[0]["response_body_encoding"] != EncodingBase64 {
+			t.Fatal("expected base64 encoding")
+		}
+		body, err := DecodeMaybeBinary(rows[0]["response_body"], rows[0]["response_body_encoding"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != binaryBody {
+			t.Fatal("did not round trip the response body")
+		}
+		headers, err := DecodeHTTPHeaders(rows[0]["response_headers"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(rec.TestKeys.Requests[0].Response.HeadersList, headers); diff != "" {
+			t.Fatal(diff)
+		}
+		// the second request only uses the headers map
+		headers, err = DecodeHTTPHeaders(rows[1]["response_headers"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := []model.ArchivalHTTPHeader{{"Location", "https://www.example.com/?a=1&b=2"}}
+		if diff := cmp.Diff(expect, headers); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestNewCSVExporterFailure(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(filename, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	exp, err := NewCSVExporter(filename)
+	if err == nil || exp != nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestDecodeHTTPHeadersFailure(t *testing.T) {
+	if _, err := DecodeHTTPHeaders(`[["a"]]`); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,177 @@
+// Package exporter converts OONI measurements into formats that are
+// convenient for offline analysis.
+//
+// We support exporting the observations inside the test keys (DNS lookups,
+// TCP connects, TLS and QUIC handshakes, and HTTP requests) as flat CSV
+// tables, one per observation type, and HTTP requests as HAR 1.2 files
+// that one can open using the browser developer tools.
+//
+// Because CSV and HAR are textual formats, we encode binary data (e.g., HTTP
+// bodies that are not valid UTF-8, TLS certificates) using base64 and we
+// record which encoding we used, so that consumers can recover the original
+// bytes. See [EncodeMaybeBinary] and [DecodeMaybeBinary].
+package exporter
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// Record is a measurement we want to export.
+type Record struct {
+	// Measurement is the measurement. Note that the TestKeys field
+	// contains a map[string]any after parsing.
+	Measurement *model.Measurement
+
+	// TestKeys contains the observations inside the test keys.
+	TestKeys *TestKeys
+}
+
+// TestKeys contains the observations we know how to export. Most experiments
+// use these field names for the observations stored inside the test keys.
+type TestKeys struct {
+	// Queries contains the DNS lookups.
+	Queries []*model.ArchivalDNSLookupResult `json:"queries"`
+
+	// TCPConnect contains the TCP connects.
+	TCPConnect []*model.ArchivalTCPConnectResult `json:"tcp_connect"`
+
+	// TLSHandshakes contains the TLS handshakes.
+	TLSHandshakes []*model.ArchivalTLSOrQUICHandshakeResult `json:"tls_handshakes"`
+
+	// QUICHandshakes contains the QUIC handshakes.
+	QUICHandshakes []*model.ArchivalTLSOrQUICHandshakeResult `json:"quic_handshakes"`
+
+	// Requests contains the HTTP requests.
+	Requests []*model.ArchivalHTTPRequestResult `json:"requests"`
+}
+
+// ParseRecord parses a serialized measurement. We parse each known test keys
+// field separately and we skip the fields that cannot be parsed, since some
+// experiments use the same names for differently shaped data.
+func ParseRecord(data []byte) (*Record, error) {
+	var measurement model.Measurement
+	if err := json.Unmarshal(data, &measurement); err != nil {
+		return nil, err
+	}
+	var container struct {
+		TestKeys map[string]json.RawMessage `json:"test_keys"`
+	}
+	if err := json.Unmarshal(data, &container); err != nil {
+		return nil, err
+	}
+	tk := &TestKeys{}
+	fields := map[string]any{
+		"queries":         &tk.Queries,
+		"tcp_connect":     &tk.TCPConnect,
+		"tls_handshakes":  &tk.TLSHandshakes,
+		"quic_handshakes": &tk.QUICHandshakes,
+		"requests":        &tk.Requests,
+	}
+	for name, value := range fields {
+		if raw, found := container.TestKeys[name]; found {
+			_ = json.Unmarshal(raw, value) // best effort
+		}
+	}
+	return &Record{Measurement: &measurement, TestKeys: tk}, nil
+}
+
+// MaxRecordSize is the maximum size of a serialized measurement we read.
+const MaxRecordSize = 1 << 26
+
+// ReadRecords reads the measurements inside a JSONL report, such as the
+// report.jsonl file written by miniooni, and calls fn for each of them. We
+// skip empty lines and we stop at the first error.
+func ReadRecords(r io.Reader, fn func(rec *Record) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1<<20), MaxRecordSize)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Bytes()
+		if len(line) <= 0 {
+			continue
+		}
+		rec, err := ParseRecord(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineno, err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// EncodingBase64 is the encoding we use for binary data.
+const EncodingBase64 = "base64"
+
+// EncodeMaybeBinary encodes a possibly-binary string such as the value of an
+// [model.ArchivalScrubbedMaybeBinaryString]. When the value is valid UTF-8, we
+// return it unmodified along with an empty encoding. Otherwise, we return its
+// base64 representation and [EncodingBase64] as the encoding.
+func EncodeMaybeBinary(value string) (text, encoding string) {
+	if utf8.ValidString(value) {
+		return value, ""
+	}
+	return base64.StdEncoding.EncodeToString([]byte(value)), EncodingBase64
+}
+
+// DecodeMaybeBinary is the inverse of [EncodeMaybeBinary].
+func DecodeMaybeBinary(text, encoding string) (string, error) {
+	switch encoding {
+	case "":
+		return text, nil
+	case EncodingBase64:
+		data, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	default:
+		return "", fmt.Errorf("%w: '%s'", model.ErrInvalidBinaryDataFormat, encoding)
+	}
+}
+
+// maybeBinaryValue returns a value that serializes to JSON like the given
+// possibly-binary string, i.e., either as a string or using the OONI binary
+// data format. Unlike [model.ArchivalScrubbedMaybeBinaryString], we do not scrub
+// the value, since we're exporting data that has already been scrubbed.
+func maybeBinaryValue(value string) any {
+	if utf8.ValidString(value) {
+		return value
+	}
+	return model.ArchivalBinaryData(value)
+}
+
+// httpHeadersList returns the headers list, if available, and otherwise
+// the headers map converted to a list with sorted keys.
+func httpHeadersList(list []model.ArchivalHTTPHeader,
+	headers map[string]model.ArchivalScrubbedMaybeBinaryString) []model.ArchivalHTTPHeader {
+	if len(list) > 0 || len(headers) <= 0 {
+		return list
+	}
+	out := []model.ArchivalHTTPHeader{}
+	for _, key := range sortedKeys(headers) {
+		out = append(out, model.ArchivalHTTPHeader{
+			model.ArchivalScrubbedMaybeBinaryString(key),
+			headers[key],
+		})
+	}
+	return out
+}
+
+// sortedKeys returns the sorted keys of the given map.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
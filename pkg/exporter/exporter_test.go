@@ -0,0 +1,215 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// binaryBody is a body that is not valid UTF-8.
+const binaryBody = "\xff\xfe\x00\x01antani"
+
+// newTestingMeasurement returns a measurement containing all the observation types.
+func newTestingMeasurement(t *testing.T) []byte {
+	failure := "connection_reset"
+	ttl := uint32(300)
+	tk := map[string]any{
+		"queries": []*model.ArchivalDNSLookupResult{{
+			Answers: []model.ArchivalDNSAnswer{
+				{AnswerType: "A", IPv4: "93.184.216.34", TTL: &ttl, ASN: 15133},
+				{AnswerType: "CNAME", Hostname: "www.example.com."},
+			},
+			Engine:          "udp",
+			Hostname:        "www.example.com",
+			QueryType:       "A",
+			RawResponse:     []byte{0x00, 0x01},
+			ResolverAddress: "8.8.8.8:53",
+			T0:              0.1,
+			T:               0.2,
+			TransactionID:   1,
+		}, {
+			Engine:        "getaddrinfo",
+			Failure:       &failure,
+			Hostname:      "www.example.com",
+			QueryType:     "ANY",
+			TransactionID: 2,
+		}},
+		"tcp_connect": []*model.ArchivalTCPConnectResult{{
+			IP:            "93.184.216.34",
+			Port:          443,
+			Status:        model.ArchivalTCPConnectStatus{Success: true},
+			TransactionID: 3,
+		}},
+		"tls_handshakes": []*model.ArchivalTLSOrQUICHandshakeResult{{
+			Network:          "tcp",
+			Address:          "93.184.216.34:443",
+			PeerCertificates: []model.ArchivalBinaryData{{0xde, 0xad}, {0xbe, 0xef}},
+			ServerName:       "www.example.com",
+			TLSVersion:       "TLSv1.3",
+			TransactionID:    3,
+		}},
+		"quic_handshakes": []*model.ArchivalTLSOrQUICHandshakeResult{{
+			Network:       "udp",
+			Address:       "93.184.216.34:443",
+			Failure:       &failure,
+			ServerName:    "www.example.com",
+			TransactionID: 4,
+		}},
+		"requests": []*model.ArchivalHTTPRequestResult{{
+			Network: "tcp",
+			Address: "93.184.216.34:443",
+			Request: model.ArchivalHTTPRequest{
+				HeadersList: []model.ArchivalHTTPHeader{{"Accept", "*/*"}},
+				Method:      "GET",
+				URL:         "https://www.example.com/?a=1&b=2",
+			},
+			Response: model.ArchivalHTTPResponse{
+				Body: binaryBody,
+				Code: 200,
+				HeadersList: []model.ArchivalHTTPHeader{
+					{"Content-Type", "application/octet-stream"},
+					{"X-Binary", "\xff"},
+				},
+			},
+			T0:            0.5,
+			T:             0.75,
+			TransactionID: 3,
+		}, {
+			Network: "tcp",
+			Address: "93.184.216.34:80",
+			Request: model.ArchivalHTTPRequest{
+				Headers: map[string]model.ArchivalScrubbedMaybeBinaryString{"Accept": "*/*"},
+				Method:  "GET",
+				URL:     "http://www.example.com/",
+			},
+			Response: model.ArchivalHTTPResponse{
+				Code: 301,
+				Headers: map[string]model.ArchivalScrubbedMaybeBinaryString{
+					"Location": "https://www.example.com/?a=1&b=2",
+				},
+			},
+			T0:            0.3,
+			T:             0.4,
+			TransactionID: 5,
+		}},
+	}
+	m := &model.Measurement{
+		Input:                "http://www.example.com/",
+		MeasurementStartTime: "2024-01-02 03:04:05",
+		ProbeASN:             "AS30722",
+		ProbeCC:              "IT",
+		ReportID:             "20240102T030405Z_webconnectivity_IT_30722_n1_xx",
+		TestKeys:             tk,
+		TestName:             "web_connectivity",
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseRecord(t *testing.T) {
+	t.Run("with a well formed measurement", func(t *testing.T) {
+		rec, err := ParseRecord(newTestingMeasurement(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Measurement.TestName != "web_connectivity" {
+			t.Fatal("unexpected test name", rec.Measurement.TestName)
+		}
+		tk := rec.TestKeys
+		if len(tk.Queries) != 2 || len(tk.TCPConnect) != 1 || len(tk.TLSHandshakes) != 1 ||
+			len(tk.QUICHandshakes) != 1 || len(tk.Requests) != 2 {
+			t.Fatalf("unexpected test keys %+v", tk)
+		}
+		if string(tk.Requests[0].Response.Body) != binaryBody {
+			t.Fatal("did not round trip the binary body")
+		}
+	})
+
+	t.Run("we skip test keys fields with an unexpected type", func(t *testing.T) {
+		rec, err := ParseRecord([]byte(`{"test_keys":{"queries":{},"tcp_connect":[{"ip":"1.1.1.1"}]}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.TestKeys.Queries) != 0 || len(rec.TestKeys.TCPConnect) != 1 {
+			t.Fatalf("unexpected test keys %+v", rec.TestKeys)
+		}
+	})
+
+	t.Run("with invalid JSON", func(t *testing.T) {
+		if _, err := ParseRecord([]byte(`{`)); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestReadRecords(t *testing.T) {
+	t.Run("we skip empty lines", func(t *testing.T) {
+		input := string(newTestingMeasurement(t)) + "\n\n" + `{"test_name":"example"}` + "\n"
+		var names []string
+		err := ReadRecords(strings.NewReader(input), func(rec *Record) error {
+			names = append(names, rec.Measurement.TestName)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 2 || names[0] != "web_connectivity" || names[1] != "example" {
+			t.Fatal("unexpected names", names)
+		}
+	})
+
+	t.Run("we report the line number of invalid records", func(t *testing.T) {
+		err := ReadRecords(strings.NewReader("{}\n{\n"), func(rec *Record) error {
+			return nil
+		})
+		if err == nil || !strings.HasPrefix(err.Error(), "line 2: ") {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("we stop when the callback fails", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		var count int
+		err := ReadRecords(strings.NewReader("{}\n{}\n"), func(rec *Record) error {
+			count++
+			return expected
+		})
+		if !errors.Is(err, expected) || count != 1 {
+			t.Fatal("unexpected result", err, count)
+		}
+	})
+}
+
+func TestMaybeBinary(t *testing.T) {
+	for _, value := range []string{"", "antani", "ciao, 世界", binaryBody} {
+		text, encoding := EncodeMaybeBinary(value)
+		if (encoding == EncodingBase64) == (value != binaryBody) {
+			t.Fatal("unexpected encoding for", value, encoding)
+		}
+		decoded, err := DecodeMaybeBinary(text, encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded != value {
+			t.Fatal("did not round trip", value)
+		}
+	}
+
+	t.Run("with invalid base64", func(t *testing.T) {
+		if _, err := DecodeMaybeBinary("@@@", EncodingBase64); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("with unknown encoding", func(t *testing.T) {
+		if _, err := DecodeMaybeBinary("", "hex"); !errors.Is(err, model.ErrInvalidBinaryDataFormat) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
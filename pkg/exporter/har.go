@@ -0,0 +1,298 @@
+package exporter
+
+//
+// HAR 1.2 export
+//
+// See http://www.softwareishard.com/blog/har-12-spec/.
+//
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// HAR is the root of a HAR 1.2 file. Construct using [NewHAR].
+type HAR struct {
+	Log *HARLog `json:"log"`
+}
+
+// HARLog is the HAR log.
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator *HARCreator `json:"creator"`
+	Pages   []*HARPage  `json:"pages"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+// HARCreator describes the software that created the HAR.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HARPage is a HAR page. We create a page for each measurement.
+type HARPage struct {
+	StartedDateTime string          `json:"startedDateTime"`
+	ID              string          `json:"id"`
+	Title           string          `json:"title"`
+	PageTimings     *HARPageTimings `json:"pageTimings"`
+	Comment         string          `json:"comment,omitempty"`
+}
+
+// HARPageTimings contains the page timings, which we don't know.
+type HARPageTimings struct {
+	OnContentLoad int64 `json:"onContentLoad"`
+	OnLoad        int64 `json:"onLoad"`
+}
+
+// HAREntry is a HAR entry. We create an entry for each HTTP request.
+type HAREntry struct {
+	PageRef         string       `json:"pageref"`
+	StartedDateTime string       `json:"startedDateTime"`
+	Time            float64      `json:"time"`
+	Request         *HARRequest  `json:"request"`
+	Response        *HARResponse `json:"response"`
+	Cache           struct{}     `json:"cache"`
+	Timings         *HARTimings  `json:"timings"`
+	ServerIPAddress string       `json:"serverIPAddress,omitempty"`
+	Connection      string       `json:"connection,omitempty"`
+	Comment         string       `json:"comment,omitempty"`
+}
+
+// HARRequest is a HAR request.
+type HARRequest struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []struct{}      `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	QueryString []*HARNameValue `json:"queryString"`
+	PostData    *HARPostData    `json:"postData,omitempty"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+// HARPostData contains the request body. The HAR specification does not allow
+// us to specify an encoding, therefore we use the comment to signal that the
+// text is base64 encoded. See [EncodeMaybeBinary].
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARResponse is a HAR response.
+type HARResponse struct {
+	Status      int64           `json:"status"`
+	StatusText  string          `json:"statusText"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []struct{}      `json:"cookies"`
+	Headers     []*HARNameValue `json:"headers"`
+	Content     *HARContent     `json:"content"`
+	RedirectURL string          `json:"redirectURL"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+	Comment     string          `json:"comment,omitempty"`
+}
+
+// HARNameValue is a header or a query string parameter. Like for [HARPostData],
+// a "base64" comment signals that the value is base64 encoded.
+type HARNameValue struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// HARContent is the response body. The encoding is "base64" when the
+// body is not valid UTF-8. See [EncodeMaybeBinary].
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Decode returns the original response body.
+func (c *HARContent) Decode() (string, error) {
+	return DecodeMaybeBinary(c.Text, c.Encoding)
+}
+
+// HARTimings contains the timings of a HAR entry. Because we only know the
+// overall duration of each HTTP transaction, we account it as wait time.
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// NewHAR creates a new empty [*HAR] created by the given software.
+func NewHAR(softwareName, softwareVersion string) *HAR {
+	return &HAR{
+		Log: &HARLog{
+			Version: "1.2",
+			Creator: &HARCreator{
+				Name:    softwareName,
+				Version: softwareVersion,
+			},
+			Pages:   []*HARPage{},
+			Entries: []*HAREntry{},
+		},
+	}
+}
+
+// AddRecord adds a page for the given record along with an entry for each HTTP
+// request in the record. We sort the entries by start time, so that redirect
+// chains appear in the order in which we followed them.
+func (h *HAR) AddRecord(rec *Record) {
+	m := rec.Measurement
+	startTime, _ := time.Parse(model.MeasurementDateFormat, m.MeasurementStartTime)
+	page := &HARPage{
+		StartedDateTime: formatHARTime(startTime),
+		ID:              fmt.Sprintf("page_%d", len(h.Log.Pages)+1),
+		Title:           string(m.Input),
+		PageTimings:     &HARPageTimings{OnContentLoad: -1, OnLoad: -1},
+		Comment:         strings.TrimSpace(fmt.Sprintf("%s %s", m.TestName, m.ReportID)),
+	}
+	if page.Title == "" {
+		page.Title = m.TestName
+	}
+	h.Log.Pages = append(h.Log.Pages, page)
+
+	requests := append([]*model.ArchivalHTTPRequestResult{}, rec.TestKeys.Requests...)
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].T0 < requests[j].T0
+	})
+	for _, r := range requests {
+		h.Log.Entries = append(h.Log.Entries, newHAREntry(page.ID, startTime, r))
+	}
+}
+
+// newHAREntry creates a new [*HAREntry] from the given HTTP request result.
+func newHAREntry(pageID string, startTime time.Time, r *model.ArchivalHTTPRequestResult) *HAREntry {
+	elapsed := math.Round(max(r.T-r.T0, 0)*1e6) / 1e3 // milliseconds
+	httpVersion := harHTTPVersion(r.ALPN)
+	entry := &HAREntry{
+		PageRef:         pageID,
+		StartedDateTime: formatHARTime(startTime.Add(time.Duration(r.T0 * float64(time.Second)))),
+		Time:            elapsed,
+		Request: &HARRequest{
+			Method:      r.Request.Method,
+			URL:         r.Request.URL,
+			HTTPVersion: httpVersion,
+			Cookies:     []struct{}{},
+			Headers:     newHARHeaders(httpHeadersList(r.Request.HeadersList, r.Request.Headers)),
+			QueryString: newHARQueryString(r.Request.URL),
+			HeadersSize: -1,
+			BodySize:    int64(len(r.Request.Body)),
+		},
+		Timings: &HARTimings{Send: 0, Wait: elapsed, Receive: 0},
+	}
+	if host, _, err := net.SplitHostPort(r.Address); err == nil {
+		entry.ServerIPAddress = host
+	}
+	if r.TransactionID > 0 {
+		entry.Connection = strconv.FormatInt(r.TransactionID, 10)
+	}
+	if r.Failure != nil {
+		entry.Comment = *r.Failure
+	}
+
+	if len(r.Request.Body) > 0 {
+		text, encoding := EncodeMaybeBinary(string(r.Request.Body))
+		entry.Request.PostData = &HARPostData{
+			MimeType: harHeaderValue(entry.Request.Headers, "Content-Type"),
+			Text:     text,
+			Comment:  encoding,
+		}
+	}
+
+	headers := newHARHeaders(httpHeadersList(r.Response.HeadersList, r.Response.Headers))
+	text, encoding := EncodeMaybeBinary(string(r.Response.Body))
+	entry.Response = &HARResponse{
+		Status:      r.Response.Code,
+		StatusText:  http.StatusText(int(r.Response.Code)),
+		HTTPVersion: httpVersion,
+		Cookies:     []struct{}{},
+		Headers:     headers,
+		Content: &HARContent{
+			Size:     int64(len(r.Response.Body)),
+			MimeType: harHeaderValue(headers, "Content-Type"),
+			Text:     text,
+			Encoding: encoding,
+		},
+		RedirectURL: harHeaderValue(headers, "Location"),
+		HeadersSize: -1,
+		BodySize:    int64(len(r.Response.Body)),
+	}
+	if r.Response.BodyIsTruncated {
+		entry.Response.Content.Comment = "truncated"
+	}
+	return entry
+}
+
+// newHARHeaders converts OONI headers to HAR headers.
+func newHARHeaders(headers []model.ArchivalHTTPHeader) []*HARNameValue {
+	out := []*HARNameValue{}
+	for _, h := range headers {
+		value, encoding := EncodeMaybeBinary(string(h[1]))
+		out = append(out, &HARNameValue{
+			Name:    string(h[0]),
+			Value:   value,
+			Comment: encoding,
+		})
+	}
+	return out
+}
+
+// newHARQueryString returns the query string parameters of the given URL.
+func newHARQueryString(URL string) []*HARNameValue {
+	out := []*HARNameValue{}
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		return out
+	}
+	query := parsed.Query()
+	for _, key := range sortedKeys(query) {
+		for _, value := range query[key] {
+			out = append(out, &HARNameValue{Name: key, Value: value})
+		}
+	}
+	return out
+}
+
+// harHeaderValue returns the value of the first header with the given name.
+func harHeaderValue(headers []*HARNameValue, name string) string {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) && h.Comment == "" {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// harHTTPVersion maps the negotiated ALPN to the HTTP version.
+func harHTTPVersion(alpn string) string {
+	switch alpn {
+	case "h2":
+		return "HTTP/2.0"
+	case "h3":
+		return "HTTP/3.0"
+	default:
+		return "HTTP/1.1"
+	}
+}
+
+// formatHARTime formats time using the ISO 8601 format required by HAR.
+func formatHARTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
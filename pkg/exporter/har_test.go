@@ -0,0 +1,101 @@
+package exporter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ooni/probe-engine/pkg/version"
+)
+
+func TestHAR(t *testing.T) {
+	rec, err := ParseRecord(newTestingMeasurement(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	har := NewHAR("miniooni", version.Version)
+	har.AddRecord(rec)
+	har.AddRecord(&Record{Measurement: rec.Measurement, TestKeys: &TestKeys{}})
+
+	// make sure the HAR survives a JSON round trip
+	data, err := json.Marshal(har)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log HAR
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatal(err)
+	}
+
+	if log.Log.Version != "1.2" || log.Log.Creator.Name != "miniooni" {
+		t.Fatalf("unexpected log %+v", log.Log)
+	}
+	if len(log.Log.Pages) != 2 || log.Log.Pages[1].ID != "page_2" {
+		t.Fatal("unexpected pages")
+	}
+	page := log.Log.Pages[0]
+	if page.Title != "http://www.example.com/" || page.StartedDateTime != "2024-01-02T03:04:05.000Z" {
+		t.Fatalf("unexpected page %+v", page)
+	}
+	if len(log.Log.Entries) != 2 {
+		t.Fatal("unexpected number of entries", len(log.Log.Entries))
+	}
+
+	t.Run("entries follow the redirect chain", func(t *testing.T) {
+		first, second := log.Log.Entries[0], log.Log.Entries[1]
+		if first.Request.URL != "http://www.example.com/" || first.Response.Status != 301 {
+			t.Fatalf("unexpected first entry %+v", first.Request)
+		}
+		if first.Response.RedirectURL != second.Request.URL {
+			t.Fatal("unexpected redirect URL", first.Response.RedirectURL)
+		}
+		if first.StartedDateTime != "2024-01-02T03:04:05.300Z" || first.Time != 100 {
+			t.Fatal("unexpected timing", first.StartedDateTime, first.Time)
+		}
+		if first.Response.StatusText != "Moved Permanently" || first.PageRef != "page_1" {
+			t.Fatalf("unexpected first entry %+v", first.Response)
+		}
+	})
+
+	t.Run("we round trip binary bodies", func(t *testing.T) {
+		entry := log.Log.Entries[1]
+		content := entry.Response.Content
+		if content.Encoding != EncodingBase64 || content.MimeType != "application/octet-stream" {
+			t.Fatalf("unexpected content %+v", content)
+		}
+		body, err := content.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body != binaryBody || content.Size != int64(len(binaryBody)) {
+			t.Fatal("did not round trip the body")
+		}
+		binaryHeader := entry.Response.Headers[1]
+		value, err := DecodeMaybeBinary(binaryHeader.Value, binaryHeader.Comment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != "\xff" {
+			t.Fatal("did not round trip the header")
+		}
+	})
+
+	t.Run("we fill the query string and the server address", func(t *testing.T) {
+		entry := log.Log.Entries[1]
+		qs := entry.Request.QueryString
+		if len(qs) != 2 || qs[0].Name != "a" || qs[0].Value != "1" || qs[1].Name != "b" {
+			t.Fatal("unexpected query string", qs)
+		}
+		if entry.ServerIPAddress != "93.184.216.34" || entry.Connection != "3" {
+			t.Fatal("unexpected connection info", entry.ServerIPAddress, entry.Connection)
+		}
+	})
+}
+
+func TestHARHTTPVersion(t *testing.T) {
+	expect := map[string]string{"": "HTTP/1.1", "http/1.1": "HTTP/1.1", "h2": "HTTP/2.0", "h3": "HTTP/3.0"}
+	for alpn, version := range expect {
+		if got := harHTTPVersion(alpn); got != version {
+			t.Fatal("unexpected version for", alpn, got)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package kvstore
+
+//
+// Adapter implementing model.ExtendedKeyValueStore for any model.KeyValueStore
+//
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// ErrNotSupported indicates that the underlying store does not support an operation.
+var ErrNotSupported = errors.New("kvstore: operation not supported")
+
+// AdapterStateKey is the key where the [NewExtended] adapter saves the expiration times.
+const AdapterStateKey = "kvstore.state"
+
+// adapterState is the state saved under the [AdapterStateKey] key.
+type adapterState struct {
+	// Expires maps keys to their expiration time.
+	Expires map[string]time.Time
+}
+
+// storeDeleter is implemented by stores that can delete keys (e.g., [*FS]).
+type storeDeleter interface {
+	Delete(key string) error
+}
+
+// storeLister is implemented by stores that can list keys (e.g., [*FS]).
+type storeLister interface {
+	List(prefix string) ([]string, error)
+}
+
+// NewExtended returns a [model.ExtendedKeyValueStore] wrapping the given store. When
+// the store already implements [model.ExtendedKeyValueStore], we return it. Otherwise,
+// we return an adapter that preserves the semantics of Get and Set and emulates the
+// extended operations as follows:
+//
+// 1. we save the expiration times under the [AdapterStateKey] key;
+//
+// 2. CompareAndSwap is atomic only with respect to other calls using the same
+// adapter, therefore you SHOULD NOT share the underlying store among processes;
+//
+// 3. Delete deletes the key if the store has a Delete method (e.g., [*FS]) and
+// otherwise marks the key as expired;
+//
+// 4. List fails with [ErrNotSupported] unless the store has a List method (e.g., [*FS]).
+func NewExtended(kvs model.KeyValueStore) model.ExtendedKeyValueStore {
+	if extended, ok := kvs.(model.ExtendedKeyValueStore); ok {
+		return extended
+	}
+	return &extendedAdapter{kvs: kvs, mu: sync.Mutex{}, timeNow: time.Now}
+}
+
+// extendedAdapter is the adapter returned by [NewExtended].
+type extendedAdapter struct {
+	kvs     model.KeyValueStore
+	mu      sync.Mutex
+	timeNow func() time.Time
+}
+
+var _ model.ExtendedKeyValueStore = &extendedAdapter{}
+
+// loadStateLocked loads the adapter state. We start from an empty state on error.
+func (a *extendedAdapter) loadStateLocked() *adapterState {
+	st := &adapterState{}
+	if data, err := a.kvs.Get(AdapterStateKey); err == nil {
+		_ = json.Unmarshal(data, st)
+	}
+	if st.Expires == nil {
+		st.Expires = make(map[string]time.Time)
+	}
+	return st
+}
+
+// saveStateLocked saves the adapter state.
+func (a *extendedAdapter) saveStateLocked(st *adapterState) error {
+	data, err := json.Marshal(st)
+	runtimex.PanicOnError(err, "json.Marshal unexpectedly failed")
+	return a.kvs.Set(AdapterStateKey, data)
+}
+
+// setExpiresLocked sets or, when the time is zero, clears the expiration time of a key.
+func (a *extendedAdapter) setExpiresLocked(key string, expires time.Time) error {
+	st := a.loadStateLocked()
+	if _, found := st.Expires[key]; !found && expires.IsZero() {
+		return nil // avoid writing the state when there's nothing to do
+	}
+	if expires.IsZero() {
+		delete(st.Expires, key)
+	} else {
+		st.Expires[key] = expires
+	}
+	return a.saveStateLocked(st)
+}
+
+// expiredLocked returns whether the given key expired.
+func (a *extendedAdapter) expiredLocked(st *adapterState, key string) bool {
+	expires, found := st.Expires[key]
+	return found && !a.timeNow().Before(expires)
+}
+
+// getLocked returns the value of a key that did not expire.
+func (a *extendedAdapter) getLocked(key string) ([]byte, error) {
+	if a.expiredLocked(a.loadStateLocked(), key) {
+		return nil, ErrNoSuchKey
+	}
+	return a.kvs.Get(key)
+}
+
+// setLocked sets a key that does not expire.
+func (a *extendedAdapter) setLocked(key string, value []byte) error {
+	if err := a.kvs.Set(key, value); err != nil {
+		return err
+	}
+	return a.setExpiresLocked(key, time.Time{})
+}
+
+// Get implements model.KeyValueStore.
+func (a *extendedAdapter) Get(key string) ([]byte, error) {
+	defer a.mu.Unlock()
+	a.mu.Lock()
+	return a.getLocked(key)
+}
+
+// Set implements model.KeyValueStore.
+func (a *extendedAdapter) Set(key string, value []byte) error {
+	defer a.mu.Unlock()
+	a.mu.Lock()
+	return a.setLocked(key, value)
+}
+
+// SetWithTTL implements model.ExtendedKeyValueStore.
+func (a *extendedAdapter) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	defer a.mu.Unlock()
+	a.mu.Lock()
+	if err := a.kvs.Set(key, value); err != nil {
+		return err
+	}
+	return a.setExpiresLocked(key, a.timeNow().Add(ttl))
+}
+
+// Delete implements model.ExtendedKeyValueStore.
+func (a *extendedAdapter) Delete(key string) error {
+	defer a.mu.Unlock()
+	a.mu.Lock()
+	deleter, ok := a.kvs.(storeDeleter)
+	if !ok {
+		return a.setExpiresLocked(key, time.Unix(0, 0))
+	}
+	if err := deleter.Delete(key); err != nil {
+		return err
+	}
+	return a.setExpiresLocked(key, time.Time{})
+}
+
+// List implements model.ExtendedKeyValueStore.
+func (a *extendedAdapter) List(prefix string) ([]string, error) {
+	defer a.mu.Unlock()
+	a.mu.Lock()
+	lister, ok := a.kvs.(storeLister)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	keys, err := lister.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	st := a.loadStateLocked()
+	out := []string{}
+	for _, key := range keys {
+		if key != AdapterStateKey && !a.expiredLocked(st, key) {
+			out = append(out, key)
+		}
+	}
+	return out, nil
+}
+
+// CompareAndSwap implements model.ExtendedKeyValueStore.
+func (a *extendedAdapter) CompareAndSwap(key string, oldValue, newValue []byte) (bool, error) {
+	defer a.mu.Unlock()
+	a.mu.Lock()
+	current, err := a.getLocked(key)
+	found := err == nil
+	if err != nil && !errors.Is(err, ErrNoSuchKey) {
+		return false, err
+	}
+	if !compareValues(current, found, oldValue) {
+		return false, nil
+	}
+	if err := a.setLocked(key, newValue); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -1,2 +1,8 @@
-// Package kvstore implements model.KeyValueStore.
+// Package kvstore implements model.KeyValueStore and model.ExtendedKeyValueStore.
+//
+// The [FS] and [Memory] stores are the simplest implementations. The [SQLite] store
+// implements [model.ExtendedKeyValueStore] on top of an SQLite database, which is
+// more robust than using a file for each key. Use [NewExtended] to obtain a
+// [model.ExtendedKeyValueStore] from any [model.KeyValueStore] and [MigrateFS]
+// to copy the content of an [FS] directory into another store.
 package kvstore
@@ -0,0 +1,301 @@
+package kvstore
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// testExtendedKeyValueStore checks that the given store implements the
+// semantics of the [model.ExtendedKeyValueStore] interface.
+func testExtendedKeyValueStore(t *testing.T, kvs model.ExtendedKeyValueStore, canList bool) {
+	t.Run("Get and Set", func(t *testing.T) {
+		if _, err := kvs.Get("antani"); !errors.Is(err, ErrNoSuchKey) {
+			t.Fatal("unexpected error", err)
+		}
+		if err := kvs.Set("antani", []byte("mascetti")); err != nil {
+			t.Fatal(err)
+		}
+		value, err := kvs.Get("antani")
+		if err != nil || !bytes.Equal(value, []byte("mascetti")) {
+			t.Fatal("unexpected result", string(value), err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if err := kvs.Set("todelete", []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		for idx := 0; idx < 2; idx++ { // deleting twice is not an error
+			if err := kvs.Delete("todelete"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := kvs.Get("todelete"); !errors.Is(err, ErrNoSuchKey) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("SetWithTTL", func(t *testing.T) {
+		if err := kvs.SetWithTTL("expired", []byte("x"), -time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := kvs.Get("expired"); !errors.Is(err, ErrNoSuchKey) {
+			t.Fatal("unexpected error", err)
+		}
+		if err := kvs.SetWithTTL("fresh", []byte("x"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := kvs.Get("fresh"); err != nil {
+			t.Fatal(err)
+		}
+		// Set should clear the expiration time
+		if err := kvs.SetWithTTL("renewed", []byte("x"), -time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if err := kvs.Set("renewed", []byte("y")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := kvs.Get("renewed"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		for _, key := range []string{"list.b", "list.a", "listx"} {
+			if err := kvs.Set(key, []byte("x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := kvs.SetWithTTL("list.expired", []byte("x"), -time.Second); err != nil {
+			t.Fatal(err)
+		}
+		keys, err := kvs.List("list.")
+		if !canList {
+			if !errors.Is(err, ErrNotSupported) {
+				t.Fatal("unexpected error", err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"list.a", "list.b"}, keys); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("CompareAndSwap", func(t *testing.T) {
+		swapped, err := kvs.CompareAndSwap("cas", nil, []byte("1"))
+		if err != nil || !swapped {
+			t.Fatal("expected to swap a nonexistent key", swapped, err)
+		}
+		swapped, err = kvs.CompareAndSwap("cas", nil, []byte("2"))
+		if err != nil || swapped {
+			t.Fatal("expected to not swap an existing key", swapped, err)
+		}
+		swapped, err = kvs.CompareAndSwap("cas", []byte("0"), []byte("2"))
+		if err != nil || swapped {
+			t.Fatal("expected to not swap a different value", swapped, err)
+		}
+		swapped, err = kvs.CompareAndSwap("cas", []byte("1"), []byte("2"))
+		if err != nil || !swapped {
+			t.Fatal("expected to swap an equal value", swapped, err)
+		}
+	})
+
+	t.Run("CompareAndSwap is atomic", func(t *testing.T) {
+		const workers, increments = 4, 10
+		if err := kvs.Set("counter", []byte{0}); err != nil {
+			t.Fatal(err)
+		}
+		wg := &sync.WaitGroup{}
+		for idx := 0; idx < workers; idx++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for count := 0; count < increments; {
+					value, err := kvs.Get("counter")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					swapped, err := kvs.CompareAndSwap("counter", value, []byte{value[0] + 1})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if swapped {
+						count++
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		value, err := kvs.Get("counter")
+		if err != nil || value[0] != workers*increments {
+			t.Fatal("unexpected counter value", value, err)
+		}
+	})
+}
+
+func TestMemoryExtended(t *testing.T) {
+	testExtendedKeyValueStore(t, &Memory{}, true)
+}
+
+func TestSQLite(t *testing.T) {
+	t.Run("implements model.ExtendedKeyValueStore", func(t *testing.T) {
+		kvs, err := NewSQLite(filepath.Join(t.TempDir(), "kvstore.sqlite3"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer kvs.Close()
+		testExtendedKeyValueStore(t, kvs, true)
+	})
+
+	t.Run("persists keys and removes expired keys when opening", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "kvstore.sqlite3")
+		kvs, err := NewSQLite(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := kvs.Set("antani", []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		if err := kvs.SetWithTTL("expired", []byte("x"), -time.Second); err != nil {
+			t.Fatal(err)
+		}
+		kvs.Close()
+		kvs, err = NewSQLite(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer kvs.Close()
+		if _, err := kvs.Get("antani"); err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		if err := kvs.db.QueryRow(`SELECT COUNT(*) FROM kvstore`).Scan(&count); err != nil || count != 1 {
+			t.Fatal("unexpected number of rows", count, err)
+		}
+	})
+
+	t.Run("with an invalid path", func(t *testing.T) {
+		kvs, err := NewSQLite(filepath.Join(t.TempDir(), "nonexistent", "kvstore.sqlite3"))
+		if err == nil || kvs != nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestNewExtended(t *testing.T) {
+	t.Run("we return stores that are already extended", func(t *testing.T) {
+		kvs := &Memory{}
+		if NewExtended(kvs) != kvs {
+			t.Fatal("expected the same store")
+		}
+	})
+
+	t.Run("with a store that can delete and list keys", func(t *testing.T) {
+		kvs, err := NewFS(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		testExtendedKeyValueStore(t, NewExtended(kvs), true)
+	})
+
+	t.Run("with a store that cannot delete and list keys", func(t *testing.T) {
+		testExtendedKeyValueStore(t, NewExtended(&plainKeyValueStore{}), false)
+	})
+
+	t.Run("we handle errors", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		kvs := NewExtended(&mocks.KeyValueStore{
+			MockGet: func(key string) ([]byte, error) {
+				return nil, expected
+			},
+			MockSet: func(key string, value []byte) error {
+				return expected
+			},
+		})
+		if err := kvs.Set("antani", nil); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if err := kvs.SetWithTTL("antani", nil, time.Hour); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if _, err := kvs.CompareAndSwap("antani", nil, nil); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
+
+// plainKeyValueStore is a [model.KeyValueStore] without extensions.
+type plainKeyValueStore struct {
+	kvs Memory
+}
+
+func (p *plainKeyValueStore) Get(key string) ([]byte, error) {
+	return p.kvs.Get(key)
+}
+
+func (p *plainKeyValueStore) Set(key string, value []byte) error {
+	return p.kvs.Set(key, value)
+}
+
+func TestMigrateFS(t *testing.T) {
+	basedir := t.TempDir()
+	src, err := NewFS(basedir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter := NewExtended(src)
+	if err := adapter.Set("checkincache.state", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := adapter.Set("httpsdialerstats.state", []byte("y")); err != nil {
+		t.Fatal(err)
+	}
+	if err := adapter.SetWithTTL("fresh", []byte("z"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := adapter.SetWithTTL("expired", []byte("w"), -time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := NewSQLite(filepath.Join(t.TempDir(), "kvstore.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	count, err := MigrateFS(basedir, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatal("unexpected count", count)
+	}
+	keys, err := dst.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"checkincache.state", "fresh", "httpsdialerstats.state"}, keys); diff != "" {
+		t.Fatal(diff)
+	}
+	var expires *int64
+	if err := dst.db.QueryRow(`SELECT expires_at FROM kvstore WHERE key = 'fresh'`).Scan(&expires); err != nil || expires == nil {
+		t.Fatal("expected to preserve the expiration time", err)
+	}
+
+	// make sure we do not fail with a plain destination store
+	if _, err := MigrateFS(basedir, &plainKeyValueStore{}); err != nil {
+		t.Fatal(err)
+	}
+}
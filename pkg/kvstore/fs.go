@@ -2,10 +2,13 @@ package kvstore
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/ooni/probe-engine/pkg/model"
 	"github.com/rogpeppe/go-internal/lockedfile"
@@ -54,3 +57,37 @@ func (kvs *FS) Get(key string) ([]byte, error) {
 func (kvs *FS) Set(key string, value []byte) error {
 	return lockedfile.Write(kvs.filename(key), bytes.NewReader(value), 0600)
 }
+
+// Delete deletes the specified key. Deleting a nonexistent key is not an error.
+func (kvs *FS) Delete(key string) error {
+	if err := os.Remove(kvs.filename(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List returns the sorted keys starting with the given prefix.
+func (kvs *FS) List(prefix string) ([]string, error) {
+	keys := []string{}
+	err := filepath.WalkDir(kvs.basedir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(kvs.basedir, path)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
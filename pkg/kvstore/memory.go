@@ -1,8 +1,12 @@
 package kvstore
 
 import (
+	"bytes"
 	"errors"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/ooni/probe-engine/pkg/model"
 )
@@ -14,6 +18,9 @@ var ErrNoSuchKey = errors.New("no such key")
 //
 // The zero value is ready to use.
 type Memory struct {
+	// expires maps keys to their expiration time.
+	expires map[string]time.Time
+
 	// m is the underlying map.
 	m map[string][]byte
 
@@ -21,27 +28,104 @@ type Memory struct {
 	mu sync.Mutex
 }
 
-var _ model.KeyValueStore = &Memory{}
+var _ model.ExtendedKeyValueStore = &Memory{}
 
 // Get returns the specified key's value. In case of error, the
 // error type is such that errors.Is(err, ErrNoSuchKey).
 func (kvs *Memory) Get(key string) ([]byte, error) {
 	kvs.mu.Lock()
 	defer kvs.mu.Unlock()
-	value, ok := kvs.m[key]
+	value, ok := kvs.getLocked(key)
 	if !ok {
 		return nil, ErrNoSuchKey
 	}
 	return value, nil
 }
 
+// getLocked returns the value of a key that did not expire.
+func (kvs *Memory) getLocked(key string) ([]byte, bool) {
+	value, ok := kvs.m[key]
+	if !ok {
+		return nil, false
+	}
+	if expires, found := kvs.expires[key]; found && !time.Now().Before(expires) {
+		delete(kvs.m, key)
+		delete(kvs.expires, key)
+		return nil, false
+	}
+	return value, true
+}
+
 // Set sets a key into the key-value store.
 func (kvs *Memory) Set(key string, value []byte) error {
 	kvs.mu.Lock()
 	defer kvs.mu.Unlock()
+	kvs.setLocked(key, value)
+	return nil
+}
+
+// setLocked sets a key that does not expire.
+func (kvs *Memory) setLocked(key string, value []byte) {
 	if kvs.m == nil {
 		kvs.m = make(map[string][]byte)
 	}
 	kvs.m[key] = value
+	delete(kvs.expires, key)
+}
+
+// SetWithTTL sets a key that expires after the given time to live.
+func (kvs *Memory) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	kvs.setLocked(key, value)
+	if kvs.expires == nil {
+		kvs.expires = make(map[string]time.Time)
+	}
+	kvs.expires[key] = time.Now().Add(ttl)
+	return nil
+}
+
+// Delete deletes a key from the key-value store.
+func (kvs *Memory) Delete(key string) error {
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	delete(kvs.m, key)
+	delete(kvs.expires, key)
 	return nil
 }
+
+// List returns the sorted keys starting with the given prefix.
+func (kvs *Memory) List(prefix string) ([]string, error) {
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	keys := []string{}
+	for key := range kvs.m {
+		if _, ok := kvs.getLocked(key); ok && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// CompareAndSwap atomically swaps the value of a key.
+func (kvs *Memory) CompareAndSwap(key string, oldValue, newValue []byte) (bool, error) {
+	kvs.mu.Lock()
+	defer kvs.mu.Unlock()
+	current, found := kvs.getLocked(key)
+	if !compareValues(current, found, oldValue) {
+		return false, nil
+	}
+	kvs.setLocked(key, newValue)
+	return true, nil
+}
+
+// compareValues returns whether the current value of a key, which may not
+// have been found, is equal to the given old value, where nil means that
+// the key must not exist.
+func compareValues(current []byte, found bool, oldValue []byte) bool {
+	if oldValue == nil {
+		return !found
+	}
+	return found && bytes.Equal(current, oldValue)
+}
@@ -0,0 +1,64 @@
+package kvstore
+
+//
+// Migrating from the FS key-value store
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// MigrateFS copies all the keys of the [FS] store at basedir into the destination
+// store and returns the number of keys we copied. We do not modify basedir, such
+// that you can remove it once you're satisfied with the migration.
+//
+// When basedir contains the expiration times saved by the [NewExtended] adapter,
+// we skip the expired keys and, if dst is a [model.ExtendedKeyValueStore], we
+// preserve the expiration time of the other keys.
+func MigrateFS(basedir string, dst model.KeyValueStore) (int, error) {
+	src, err := NewFS(basedir)
+	if err != nil {
+		return 0, err
+	}
+	keys, err := src.List("")
+	if err != nil {
+		return 0, err
+	}
+	st := &adapterState{}
+	if data, err := src.Get(AdapterStateKey); err == nil {
+		if err := json.Unmarshal(data, st); err != nil {
+			return 0, fmt.Errorf("kvstore: cannot parse %s: %w", AdapterStateKey, err)
+		}
+	}
+	extended, _ := dst.(model.ExtendedKeyValueStore)
+	count := 0
+	for _, key := range keys {
+		if key == AdapterStateKey {
+			continue
+		}
+		value, err := src.Get(key)
+		if err != nil {
+			return count, err
+		}
+		expires, found := st.Expires[key]
+		switch {
+		case !found:
+			err = dst.Set(key, value)
+		case !time.Now().Before(expires):
+			continue // already expired
+		case extended != nil:
+			err = extended.SetWithTTL(key, value, time.Until(expires))
+		default:
+			err = dst.Set(key, value)
+		}
+		if err != nil {
+			return count, fmt.Errorf("kvstore: cannot migrate %s: %w", key, err)
+		}
+		count++
+	}
+	return count, nil
+}
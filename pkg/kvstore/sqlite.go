@@ -0,0 +1,175 @@
+package kvstore
+
+//
+// SQLite based key-value store
+//
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// sqliteSchema is the schema of the SQLite key-value store. The expires_at
+// column contains the expiration time in nanoseconds since the epoch or
+// NULL when the key does not expire.
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS kvstore (
+	key TEXT PRIMARY KEY NOT NULL,
+	value BLOB NOT NULL,
+	expires_at INTEGER
+)`
+
+// SQLite is an SQLite based key-value store. Because we use transactions
+// and a single database file, this store is more robust than [FS] and multiple
+// processes can safely share the same database. Construct using [NewSQLite].
+type SQLite struct {
+	db      *sql.DB
+	timeNow func() time.Time
+}
+
+var _ model.ExtendedKeyValueStore = &SQLite{}
+
+// NewSQLite opens or creates the SQLite key-value store at the given path. You
+// MUST call the Close method when done using the returned store.
+func NewSQLite(path string) (*SQLite, error) {
+	// We use immediate transactions such that CompareAndSwap acquires the write lock
+	// before reading and we wait when another process is holding the lock.
+	dsn := path + "?_txlock=immediate&_busy_timeout=5000&_journal_mode=WAL"
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	kvs := &SQLite{db: db, timeNow: time.Now}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	// Opportunistically remove the expired keys, which we otherwise skip.
+	if _, err := db.Exec(`DELETE FROM kvstore WHERE expires_at <= ?`, kvs.now()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return kvs, nil
+}
+
+// now returns the current time in nanoseconds since the epoch.
+func (kvs *SQLite) now() int64 {
+	return kvs.timeNow().UnixNano()
+}
+
+// Close closes the underlying database.
+func (kvs *SQLite) Close() error {
+	return kvs.db.Close()
+}
+
+// sqliteQueryer abstracts over *sql.DB and *sql.Tx.
+type sqliteQueryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// get returns the value of a key that did not expire.
+func (kvs *SQLite) get(q sqliteQueryer, key string) ([]byte, error) {
+	var value []byte
+	err := q.QueryRow(
+		`SELECT value FROM kvstore WHERE key = ? AND (expires_at IS NULL OR expires_at > ?)`,
+		key, kvs.now(),
+	).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchKey, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// set sets the value of a key and its expiration time, which may be nil.
+func (kvs *SQLite) set(q sqliteQueryer, key string, value []byte, expiresAt any) error {
+	if value == nil {
+		value = []byte{} // the value column is NOT NULL
+	}
+	_, err := q.Exec(
+		`INSERT INTO kvstore (key, value, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`,
+		key, value, expiresAt,
+	)
+	return err
+}
+
+// Get returns the specified key's value. In case of error, the
+// error type is such that errors.Is(err, ErrNoSuchKey).
+func (kvs *SQLite) Get(key string) ([]byte, error) {
+	return kvs.get(kvs.db, key)
+}
+
+// Set sets the value of a specific key.
+func (kvs *SQLite) Set(key string, value []byte) error {
+	return kvs.set(kvs.db, key, value, nil)
+}
+
+// SetWithTTL sets a key that expires after the given time to live.
+func (kvs *SQLite) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	return kvs.set(kvs.db, key, value, kvs.timeNow().Add(ttl).UnixNano())
+}
+
+// Delete deletes the specified key.
+func (kvs *SQLite) Delete(key string) error {
+	_, err := kvs.db.Exec(`DELETE FROM kvstore WHERE key = ?`, key)
+	return err
+}
+
+// List returns the sorted keys starting with the given prefix.
+func (kvs *SQLite) List(prefix string) ([]string, error) {
+	// Note: we use substr rather than LIKE to avoid escaping the prefix.
+	rows, err := kvs.db.Query(
+		`SELECT key FROM kvstore WHERE substr(key, 1, length(?)) = ?
+		AND (expires_at IS NULL OR expires_at > ?) ORDER BY key`,
+		prefix, prefix, kvs.now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// CompareAndSwap atomically swaps the value of a key.
+func (kvs *SQLite) CompareAndSwap(key string, oldValue, newValue []byte) (bool, error) {
+	tx, err := kvs.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback() // no-op after a successful commit
+
+	current, err := kvs.get(tx, key)
+	found := err == nil
+	if err != nil && !errors.Is(err, ErrNoSuchKey) {
+		return false, err
+	}
+	if !compareValues(current, found, oldValue) {
+		return false, nil
+	}
+	if err := kvs.set(tx, key, newValue, nil); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -20,6 +20,7 @@ type Config struct {
 	BogonIsError        bool                 // default: bogon is not error
 	ByteCounter         *bytecounter.Counter // default: no explicit byte counting
 	CacheResolutions    bool                 // default: no caching
+	ClientHelloID       string               // default: use the Go standard library
 	ContextByteCounting bool                 // default: no implicit byte counting
 	DNSCache            map[string][]string  // default: cache is empty
 	Dialer              model.Dialer         // default: dialer.DNSDialer
@@ -33,6 +33,12 @@ import (
 // - if the URL starts with `udp://`, then we create a client using
 // a resolver that uses the specified UDP endpoint.
 //
+// - if the URL starts with `dot://` or `doq://`, then we create a client
+// using DNS-over-TLS or DNS-over-QUIC and the specified endpoint.
+//
+// - if the URL starts with `odoh://`, then we create an Oblivious DoH
+// client using the `odoh://PROXY/TARGET` URL (see netxlite for details).
+//
 // We return error if the URL does not parse or the URL scheme does not
 // fall into one of the cases described above.
 //
@@ -44,6 +50,9 @@ func NewDNSClient(config Config, URL string) (model.Resolver, error) {
 
 // NewDNSClientWithOverrides creates a new DNS client, similar to NewDNSClient,
 // with the option to override the default Hostname and SNI.
+//
+// When using ODoH, we ignore the Hostname and SNI overrides because we
+// connect to two distinct hosts, i.e., the proxy and the target.
 func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
 	TLSVersion string) (model.Resolver, error) {
 	// We should split this function in smaller and testable units
@@ -74,6 +83,13 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
 			httpClient, URL, hostOverride)
 		txp = config.Saver.WrapDNSTransport(txp) // safe when config.Saver == nil
 		return netxlite.NewUnwrappedSerialResolver(txp), nil
+	case "odoh":
+		config.TLSConfig.ServerName = ""
+		config.TLSConfig.NextProtos = []string{"h2", "http/1.1"}
+		httpClient := &http.Client{Transport: NewHTTPTransport(config)}
+		var txp model.DNSTransport = netxlite.NewUnwrappedDNSOverODoHTransport(httpClient, URL)
+		txp = config.Saver.WrapDNSTransport(txp) // safe when config.Saver == nil
+		return netxlite.NewUnwrappedSerialResolver(txp), nil
 	case "udp":
 		dialer := NewDialer(config)
 		endpoint, err := makeValidEndpoint(resolverURL)
@@ -95,6 +111,16 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
 			tlsDialer.DialTLSContext, endpoint)
 		txp = config.Saver.WrapDNSTransport(txp) // safe when config.Saver == nil
 		return netxlite.NewUnwrappedSerialResolver(txp), nil
+	case "doq":
+		quicDialer := NewQUICDialer(config)
+		endpoint, err := makeValidEndpoint(resolverURL)
+		if err != nil {
+			return nil, err
+		}
+		var txp model.DNSTransport = netxlite.NewUnwrappedDNSOverQUICTransportWithTLSConfig(
+			quicDialer, endpoint, config.TLSConfig)
+		txp = config.Saver.WrapDNSTransport(txp) // safe when config.Saver == nil
+		return netxlite.NewUnwrappedSerialResolver(txp), nil
 	case "tcp":
 		dialer := NewDialer(config)
 		endpoint, err := makeValidEndpoint(resolverURL)
@@ -110,11 +136,11 @@ func NewDNSClientWithOverrides(config Config, URL, hostOverride, SNIOverride,
 	}
 }
 
-// makeValidEndpoint makes a valid endpoint for DoT and Do53 given the
+// makeValidEndpoint makes a valid endpoint for DoT, DoQ, and Do53 given the
 // input URL representing such endpoint. Specifically, we are
 // concerned with the case where the port is missing. In such a
 // case, we ensure that we are using the default port 853 for DoT
-// and default port 53 for TCP and UDP.
+// and DoQ and default port 53 for TCP and UDP.
 func makeValidEndpoint(URL *url.URL) (string, error) {
 	// Implementation note: when we're using a quoted IPv6
 	// address, URL.Host contains the quotes but instead the
@@ -152,7 +178,7 @@ func makeValidEndpoint(URL *url.URL) (string, error) {
 	// For this reason we check again whether we can split it using
 	// net.SplitHostPort. If we cannot, we were in case four.
 	host := URL.Host
-	if URL.Scheme == "dot" {
+	if URL.Scheme == "dot" || URL.Scheme == "doq" {
 		host += ":853"
 	} else {
 		host += ":53"
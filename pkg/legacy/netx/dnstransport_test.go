@@ -1,12 +1,23 @@
 package netx
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/netem"
 	"github.com/ooni/probe-engine/pkg/legacy/tracex"
+	"github.com/ooni/probe-engine/pkg/mocks"
 	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/testingx"
 )
 
 func TestNewDNSClientInvalidURL(t *testing.T) {
@@ -209,6 +220,166 @@ func TestNewDNSClientDoTDNSSaver(t *testing.T) {
 	dnsclient.CloseIdleConnections()
 }
 
+func TestNewDNSClientDoQ(t *testing.T) {
+	dnsclient, err := NewDNSClient(
+		Config{}, "doq://94.140.14.140:853")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(*netxlite.DNSOverQUICTransport)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if txp.Network() != "doq" {
+		t.Fatal("not the Network we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientDoQDNSSaver(t *testing.T) {
+	saver := new(tracex.Saver)
+	dnsclient, err := NewDNSClient(
+		Config{Saver: saver}, "doq://94.140.14.140:853")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(*tracex.DNSTransportSaver)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	doquic, ok := txp.DNSTransport.(*netxlite.DNSOverQUICTransport)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if doquic.Network() != "doq" {
+		t.Fatal("not the Network we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSCLientDoQWithoutPort(t *testing.T) {
+	c, err := NewDNSClientWithOverrides(
+		Config{}, "doq://94.140.14.140", "", "dns.adguard-dns.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Address() != "94.140.14.140:853" {
+		t.Fatal("expected default port to be added")
+	}
+}
+
+func TestNewDNSClientODoHDNSSaver(t *testing.T) {
+	saver := new(tracex.Saver)
+	const URL = "odoh://odoh1.surfdomeinen.nl/odoh.cloudflare-dns.com"
+	dnsclient, err := NewDNSClientWithOverrides(
+		Config{Saver: saver}, URL, "odoh1.surfdomeinen.nl", "odoh1.surfdomeinen.nl", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := dnsclient.(*netxlite.SerialResolver)
+	if !ok {
+		t.Fatal("not the resolver we expected")
+	}
+	txp, ok := r.Transport().(*tracex.DNSTransportSaver)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	odoh, ok := txp.DNSTransport.(*netxlite.DNSOverODoHTransport)
+	if !ok {
+		t.Fatal("not the transport we expected")
+	}
+	if odoh.Network() != "odoh" || odoh.Address() != URL {
+		t.Fatal("not the transport we expected")
+	}
+	dnsclient.CloseIdleConnections()
+}
+
+func TestNewDNSClientODoHSavesProxyAndTargetHandshakes(t *testing.T) {
+	ca := netem.MustNewCA()
+
+	// newServer starts an HTTPS server using the given handler.
+	newServer := func(handler http.Handler) *httptest.Server {
+		srv := httptest.NewUnstartedServer(handler)
+		srv.TLS = ca.MustNewServerTLSConfig("proxy.example.com", "target.example.com")
+		srv.StartTLS()
+		return srv
+	}
+
+	dnsConfig := netem.NewDNSConfig()
+	dnsConfig.AddRecord("example.com", "", "93.184.216.34")
+	target := newServer(testingx.MustNewODoHTargetHandler(testingx.NewDNSRoundTripperWithDNSConfig(dnsConfig)))
+	defer target.Close()
+	proxy := newServer(&testingx.ODoHProxyHandler{
+		Client: &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, target.Listener.Addr().String())
+			},
+			TLSClientConfig: &tls.Config{RootCAs: ca.DefaultCertPool()},
+		}},
+	})
+	defer proxy.Close()
+
+	URL := fmt.Sprintf("odoh://proxy.example.com:%d/target.example.com:%d",
+		proxy.Listener.Addr().(*net.TCPAddr).Port, target.Listener.Addr().(*net.TCPAddr).Port)
+	saver := new(tracex.Saver)
+	config := Config{
+		DNSCache: map[string][]string{
+			"proxy.example.com":  {"127.0.0.1"},
+			"target.example.com": {"127.0.0.1"},
+		},
+		Saver: saver,
+	}
+	tproxy := &netxlite.DefaultTProxy{}
+	mocked := &mocks.UnderlyingNetwork{
+		MockDefaultCertPool:            ca.DefaultCertPool,
+		MockDialTimeout:                tproxy.DialTimeout,
+		MockDialContext:                tproxy.DialContext,
+		MockGetaddrinfoLookupANY:       tproxy.GetaddrinfoLookupANY,
+		MockGetaddrinfoResolverNetwork: tproxy.GetaddrinfoResolverNetwork,
+	}
+	netxlite.WithCustomTProxy(mocked, func() {
+		dnsclient, err := NewDNSClientWithOverrides(config, URL, "", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dnsclient.CloseIdleConnections()
+		addrs, err := dnsclient.LookupHost(context.Background(), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0] != "93.184.216.34" {
+			t.Fatal("unexpected addrs", addrs)
+		}
+	})
+
+	var serverNames []string
+	for _, hs := range tracex.NewTLSHandshakesList(time.Now(), saver.Read()) {
+		if hs.Failure != nil {
+			t.Fatal("unexpected failure", *hs.Failure)
+		}
+		serverNames = append(serverNames, hs.ServerName)
+	}
+	if diff := cmp.Diff([]string{"target.example.com", "proxy.example.com"}, serverNames); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestNewDNSClientBadDoQEndpoint(t *testing.T) {
+	_, err := NewDNSClient(
+		Config{}, "doq://bad:endpoint:53")
+	if err == nil || !strings.Contains(err.Error(), "too many colons in address") {
+		t.Fatal("expected error with bad endpoint")
+	}
+}
+
 func TestNewDNSCLientDoTWithoutPort(t *testing.T) {
 	c, err := NewDNSClientWithOverrides(
 		Config{}, "dot://8.8.8.8", "", "8.8.8.8", "")
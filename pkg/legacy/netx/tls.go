@@ -7,9 +7,13 @@ package netx
 import (
 	"github.com/ooni/probe-engine/pkg/model"
 	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/runtimex"
 )
 
 // NewTLSDialer creates a new TLSDialer from the specified config.
+//
+// This function panics if config.ClientHelloID is not a valid name according
+// to [netxlite.ParseClientHelloID], so callers should validate it first.
 func NewTLSDialer(config Config) model.TLSDialer {
 	if config.Dialer == nil {
 		config.Dialer = NewDialer(config)
@@ -17,7 +21,10 @@ func NewTLSDialer(config Config) model.TLSDialer {
 	netx := &netxlite.Netx{}
 	logger := model.ValidLoggerOrDefault(config.Logger)
 	thx := netx.NewTLSHandshakerStdlib(logger)
-	thx = config.Saver.WrapTLSHandshaker(thx) // WAI even when config.Saver is nil
+	if id := runtimex.Try1(netxlite.ParseClientHelloID(config.ClientHelloID)); id != nil {
+		thx = netx.NewTLSHandshakerUTLS(logger, id)
+	}
+	thx = config.Saver.WrapTLSHandshakerWithClientHelloID(thx, config.ClientHelloID) // WAI even when config.Saver is nil
 	tlsConfig := netxlite.ClonedTLSConfigOrNewEmptyConfig(config.TLSConfig)
 	return netxlite.NewTLSDialerWithConfig(config.Dialer, thx, tlsConfig)
 }
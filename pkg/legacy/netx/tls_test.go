@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"testing"
+	"time"
 
 	"github.com/ooni/netem"
 	"github.com/ooni/probe-engine/pkg/legacy/tracex"
@@ -76,4 +77,32 @@ func TestNewTLSDialer(t *testing.T) {
 		}
 		conn.Close()
 	})
+
+	t.Run("we can use a ClientHello fingerprint", func(t *testing.T) {
+		ca := netem.MustNewCA()
+		cert := ca.MustNewTLSCertificate("dns.google")
+		server := testingx.MustNewTLSServer(testingx.TLSHandlerHandshakeAndWriteText(cert, testingx.HTTPBlockpage451))
+		defer server.Close()
+		saver := &tracex.Saver{}
+		tdx := NewTLSDialer(Config{
+			ClientHelloID: "android",
+			Saver:         saver,
+			TLSConfig: &tls.Config{
+				RootCAs:    ca.DefaultCertPool(),
+				ServerName: "dns.google",
+			},
+		})
+		conn, err := tdx.DialTLSContext(context.Background(), "tcp", server.Endpoint())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		handshakes := tracex.NewTLSHandshakesList(time.Now(), saver.Read())
+		if len(handshakes) != 1 {
+			t.Fatal("expected a single TLS handshake")
+		}
+		if handshakes[0].ClientHelloID != "android" {
+			t.Fatal("unexpected ClientHelloID", handshakes[0].ClientHelloID)
+		}
+	})
 }
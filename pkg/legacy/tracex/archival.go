@@ -263,6 +263,7 @@ func NewTLSHandshakesList(begin time.Time, events []Event) (out []TLSHandshake)
 		out = append(out, TLSHandshake{
 			Address:            ev.Address,
 			CipherSuite:        ev.TLSCipherSuite,
+			ClientHelloID:      ev.TLSClientHelloID,
 			Failure:            ev.Err.ToFailure(),
 			NegotiatedProtocol: ev.TLSNegotiatedProto,
 			NoTLSVerify:        ev.NoTLSVerify,
@@ -294,6 +294,7 @@ type EventValue struct {
 	Proto                       string        `json:",omitempty"`
 	TLSServerName               string        `json:",omitempty"`
 	TLSCipherSuite              string        `json:",omitempty"`
+	TLSClientHelloID            string        `json:",omitempty"`
 	TLSNegotiatedProto          string        `json:",omitempty"`
 	TLSNextProtos               []string      `json:",omitempty"`
 	TLSPeerCerts                [][]byte      `json:",omitempty"`
@@ -18,6 +18,10 @@ import (
 
 // TLSHandshakerSaver saves events occurring during the TLS handshake.
 type TLSHandshakerSaver struct {
+	// ClientHelloID is the OPTIONAL name of the TLS ClientHello
+	// fingerprint used by the underlying TLS handshaker.
+	ClientHelloID string
+
 	// TLSHandshaker is the underlying TLS handshaker.
 	TLSHandshaker model.TLSHandshaker
 
@@ -31,10 +35,17 @@ type TLSHandshakerSaver struct {
 // When this function is invoked on a nil Saver, it will directly return
 // the original TLSHandshaker without any wrapping.
 func (s *Saver) WrapTLSHandshaker(thx model.TLSHandshaker) model.TLSHandshaker {
+	return s.WrapTLSHandshakerWithClientHelloID(thx, "")
+}
+
+// WrapTLSHandshakerWithClientHelloID is like WrapTLSHandshaker but also saves the
+// name of the TLS ClientHello fingerprint used by the given TLSHandshaker.
+func (s *Saver) WrapTLSHandshakerWithClientHelloID(thx model.TLSHandshaker, clientHelloID string) model.TLSHandshaker {
 	if s == nil {
 		return thx
 	}
 	return &TLSHandshakerSaver{
+		ClientHelloID: clientHelloID,
 		TLSHandshaker: thx,
 		Saver:         s,
 	}
@@ -64,6 +75,7 @@ func (h *TLSHandshakerSaver) Handshake(
 		NoTLSVerify:        config.InsecureSkipVerify,
 		Proto:              proto,
 		TLSCipherSuite:     netxlite.TLSCipherSuiteString(tstate.CipherSuite),
+		TLSClientHelloID:   h.ClientHelloID,
 		TLSNegotiatedProto: tstate.NegotiatedProtocol,
 		TLSNextProtos:      config.NextProtos,
 		TLSPeerCerts:       tlsPeerCerts(tstate, err),
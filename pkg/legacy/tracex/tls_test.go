@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"io"
 	"net"
 	"testing"
 
@@ -21,6 +22,46 @@ func TestWrapTLSHandshaker(t *testing.T) {
 	}
 }
 
+func TestWrapTLSHandshakerWithClientHelloID(t *testing.T) {
+	t.Run("with a nil saver", func(t *testing.T) {
+		var saver *Saver
+		thx := &mocks.TLSHandshaker{}
+		if saver.WrapTLSHandshakerWithClientHelloID(thx, "chrome") != thx {
+			t.Fatal("unexpected result")
+		}
+	})
+
+	t.Run("with a non-nil saver", func(t *testing.T) {
+		saver := &Saver{}
+		thx := &mocks.TLSHandshaker{
+			MockHandshake: func(ctx context.Context, conn net.Conn, config *tls.Config) (model.TLSConn, error) {
+				return nil, io.EOF
+			},
+		}
+		tcpConn := &mocks.Conn{
+			MockRemoteAddr: func() net.Addr {
+				return &mocks.Addr{
+					MockString: func() string {
+						return "8.8.8.8:443"
+					},
+					MockNetwork: func() string {
+						return "tcp"
+					},
+				}
+			},
+		}
+		wrapped := saver.WrapTLSHandshakerWithClientHelloID(thx, "chrome")
+		_, _ = wrapped.Handshake(context.Background(), tcpConn, &tls.Config{})
+		events := saver.Read()
+		if len(events) != 2 {
+			t.Fatal("expected two events")
+		}
+		if events[1].Value().TLSClientHelloID != "chrome" {
+			t.Fatal("unexpected TLSClientHelloID")
+		}
+	})
+}
+
 func TestTLSHandshakerSaver(t *testing.T) {
 
 	t.Run("Handshake", func(t *testing.T) {
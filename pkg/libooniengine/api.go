@@ -0,0 +1,89 @@
+package main
+
+//
+// Go API wrapped by the C API
+//
+// The C API in engine.go is a thin layer converting C types to Go
+// types and vice versa. We implement the real logic here, such that
+// we can test the same entry points without using cgo.
+//
+
+import (
+	"context"
+	"time"
+)
+
+var (
+	// sessions contains the sessions created by the C code.
+	sessions = &handleTable[*session]{}
+
+	// tasks contains the tasks created by the C code.
+	tasks = &handleTable[*task]{}
+)
+
+// sessionNew creates a new session from the given JSON config
+// and returns its handle or the error that occurred.
+func sessionNew(config string) (int64, error) {
+	sess, err := newSession(context.Background(), []byte(config))
+	if err != nil {
+		return 0, err
+	}
+	return sessions.put(sess), nil
+}
+
+// sessionDelete closes and deletes the given session.
+func sessionDelete(handle int64) {
+	if sess, found := sessions.remove(handle); found {
+		_ = sess.close()
+	}
+}
+
+// taskStart starts the task with the given name inside the given
+// session using the given JSON arguments and returns its handle.
+//
+// This function does not fail. When the session does not exist or
+// we don't know about the task, the returned task fails immediately
+// emitting an event explaining what went wrong.
+func taskStart(sessionHandle int64, name string, args string) int64 {
+	sess, _ := sessions.get(sessionHandle)
+	t := newTask()
+	t.start(sess, taskRegistry[name], []byte(args))
+	return tasks.put(t)
+}
+
+// taskWaitForNextEvent waits for the next event emitted by the given task for
+// at most the given timeout and returns the JSON serialized event. A negative
+// timeout means we wait until the next event or the end of the task. We return
+// false on timeout, for an unknown task, or when the task is done and we have
+// read all the events it emitted.
+func taskWaitForNextEvent(handle int64, timeout time.Duration) (string, bool) {
+	t, found := tasks.get(handle)
+	if !found {
+		return "", false
+	}
+	return t.waitForNextEvent(timeout)
+}
+
+// taskIsDone returns whether the task is done and we have read all
+// the events it emitted. An unknown task is always done.
+func taskIsDone(handle int64) bool {
+	t, found := tasks.get(handle)
+	if !found {
+		return true
+	}
+	return t.isDone()
+}
+
+// taskInterrupt interrupts the given task.
+func taskInterrupt(handle int64) {
+	if t, found := tasks.get(handle); found {
+		t.interrupt()
+	}
+}
+
+// taskFree interrupts and deletes the given task.
+func taskFree(handle int64) {
+	if t, found := tasks.remove(handle); found {
+		t.interrupt()
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/version"
+)
+
+// readAllEvents reads all the events emitted by a task.
+func readAllEvents(t *testing.T, handle int64) []*event {
+	var events []*event
+	for !taskIsDone(handle) {
+		data, found := taskWaitForNextEvent(handle, -1)
+		if !found {
+			continue
+		}
+		var ev event
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, &ev)
+	}
+	return events
+}
+
+// newTestingSession creates a new session for testing.
+func newTestingSession(t *testing.T) int64 {
+	config := &sessionConfig{
+		SoftwareName:    "miniooni",
+		SoftwareVersion: version.Version,
+		StateDir:        t.TempDir(),
+		Verbose:         true,
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle, err := sessionNew(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sessionDelete(handle)
+	})
+	return handle
+}
+
+// registerTestingTask registers a task runner for testing.
+func registerTestingTask(t *testing.T, name string, runner taskRunner) {
+	taskRegistry[name] = runner
+	t.Cleanup(func() {
+		delete(taskRegistry, name)
+	})
+}
+
+func TestSessionNew(t *testing.T) {
+	t.Run("with invalid JSON", func(t *testing.T) {
+		handle, err := sessionNew("{")
+		if err == nil || !strings.HasPrefix(err.Error(), "unexpected end of JSON") {
+			t.Fatal("unexpected error", err)
+		}
+		if handle != 0 {
+			t.Fatal("expected zero handle")
+		}
+	})
+
+	t.Run("with empty state dir", func(t *testing.T) {
+		handle, err := sessionNew(`{"software_name":"miniooni","software_version":"0.1.0"}`)
+		if err == nil || err.Error() != "libooniengine: state_dir is empty" {
+			t.Fatal("unexpected error", err)
+		}
+		if handle != 0 {
+			t.Fatal("expected zero handle")
+		}
+	})
+
+	t.Run("with invalid proxy URL", func(t *testing.T) {
+		config := `{"software_name":"miniooni","software_version":"0.1.0","proxy":"\t",`
+		config += `"state_dir":"` + t.TempDir() + `"}`
+		handle, err := sessionNew(config)
+		if err == nil || !strings.HasSuffix(err.Error(), "invalid control character in URL") {
+			t.Fatal("unexpected error", err)
+		}
+		if handle != 0 {
+			t.Fatal("expected zero handle")
+		}
+	})
+
+	t.Run("with empty software name", func(t *testing.T) {
+		handle, err := sessionNew(`{"state_dir":"` + t.TempDir() + `"}`)
+		if err == nil || err.Error() != "SoftwareName is empty" {
+			t.Fatal("unexpected error", err)
+		}
+		if handle != 0 {
+			t.Fatal("expected zero handle")
+		}
+	})
+
+	t.Run("on success", func(t *testing.T) {
+		handle := newTestingSession(t)
+		if _, found := sessions.get(handle); !found {
+			t.Fatal("session not found")
+		}
+		sessionDelete(handle)
+		if _, found := sessions.get(handle); found {
+			t.Fatal("session not deleted")
+		}
+	})
+}
+
+func TestTaskStart(t *testing.T) {
+	t.Run("with nonexisting session", func(t *testing.T) {
+		handle := taskStart(0, "lookup_location", "")
+		defer taskFree(handle)
+		events := readAllEvents(t, handle)
+		if len(events) != 1 {
+			t.Fatal("expected a single event")
+		}
+		if events[0].Type != eventTypeFailure || events[0].Value != ErrNoSuchSession.Error() {
+			t.Fatal("unexpected event", events[0])
+		}
+	})
+
+	t.Run("with nonexisting task", func(t *testing.T) {
+		sess := newTestingSession(t)
+		handle := taskStart(sess, "antani", "")
+		defer taskFree(handle)
+		events := readAllEvents(t, handle)
+		if len(events) != 1 {
+			t.Fatal("expected a single event")
+		}
+		if events[0].Type != eventTypeFailure || events[0].Value != ErrNoSuchTaskRunner.Error() {
+			t.Fatal("unexpected event", events[0])
+		}
+	})
+
+	t.Run("with successful task", func(t *testing.T) {
+		sess := newTestingSession(t)
+		registerTestingTask(t, "testing_success", func(
+			ctx context.Context, sess *session, emitter taskEmitter, args []byte) (any, error) {
+			sess.sess.Logger().Infof("the arguments are: %s", string(args))
+			sess.sess.Logger().Debug("this is a debug message")
+			emitter.emit(eventTypeProgress, &progressEventValue{Percentage: 1, Message: "done"})
+			return "antani", nil
+		})
+		handle := taskStart(sess, "testing_success", `{}`)
+		defer taskFree(handle)
+		events := readAllEvents(t, handle)
+		expect := []string{eventTypeLog, eventTypeLog, eventTypeProgress, eventTypeResult}
+		if len(events) != len(expect) {
+			t.Fatal("unexpected number of events", len(events))
+		}
+		for idx, ev := range events {
+			if ev.Type != expect[idx] {
+				t.Fatal("unexpected event type", idx, ev.Type)
+			}
+		}
+		logEvent := events[0].Value.(map[string]any)
+		if logEvent["level"] != "INFO" || logEvent["message"] != "the arguments are: {}" {
+			t.Fatal("unexpected log event", logEvent)
+		}
+		if events[3].Value != "antani" {
+			t.Fatal("unexpected result", events[3].Value)
+		}
+	})
+
+	t.Run("with failing task", func(t *testing.T) {
+		sess := newTestingSession(t)
+		expected := errors.New("mocked error")
+		registerTestingTask(t, "testing_failure", func(
+			ctx context.Context, sess *session, emitter taskEmitter, args []byte) (any, error) {
+			return nil, expected
+		})
+		handle := taskStart(sess, "testing_failure", "")
+		defer taskFree(handle)
+		events := readAllEvents(t, handle)
+		if len(events) != 1 {
+			t.Fatal("expected a single event")
+		}
+		if events[0].Type != eventTypeFailure || events[0].Value != expected.Error() {
+			t.Fatal("unexpected event", events[0])
+		}
+	})
+
+	t.Run("with panicking task", func(t *testing.T) {
+		sess := newTestingSession(t)
+		registerTestingTask(t, "testing_panic", func(
+			ctx context.Context, sess *session, emitter taskEmitter, args []byte) (any, error) {
+			panic("mascetti")
+		})
+		handle := taskStart(sess, "testing_panic", "")
+		defer taskFree(handle)
+		events := readAllEvents(t, handle)
+		if len(events) != 1 {
+			t.Fatal("expected a single event")
+		}
+		if events[0].Type != eventTypeFailure || events[0].Value != "libooniengine: task panicked: mascetti" {
+			t.Fatal("unexpected event", events[0])
+		}
+	})
+	t.Run("with a task emitting more logs than we can buffer", func(t *testing.T) {
+		sess := newTestingSession(t)
+		logged := make(chan any)
+		registerTestingTask(t, "testing_many_logs", func(
+			ctx context.Context, sess *session, emitter taskEmitter, args []byte) (any, error) {
+			for idx := 0; idx < 2*taskEventsBuffer; idx++ {
+				sess.sess.Logger().Infof("log message #%d", idx)
+			}
+			close(logged)
+			return "antani", nil
+		})
+		handle := taskStart(sess, "testing_many_logs", "")
+		defer taskFree(handle)
+
+		// make sure logging does not block when nobody reads the events
+		<-logged
+
+		events := readAllEvents(t, handle)
+		if len(events) != taskEventsBuffer+2 {
+			t.Fatal("unexpected number of events", len(events))
+		}
+		warning := events[taskEventsBuffer].Value.(map[string]any)
+		expectWarning := fmt.Sprintf("libooniengine: dropped %d log messages because events were not read fast enough", taskEventsBuffer)
+		if warning["level"] != "WARNING" || warning["message"] != expectWarning {
+			t.Fatal("unexpected warning", warning)
+		}
+		if events[taskEventsBuffer+1].Value != "antani" {
+			t.Fatal("unexpected result", events[taskEventsBuffer+1])
+		}
+	})
+
+	t.Run("with a task whose result cannot be serialized", func(t *testing.T) {
+		sess := newTestingSession(t)
+		registerTestingTask(t, "testing_unserializable", func(
+			ctx context.Context, sess *session, emitter taskEmitter, args []byte) (any, error) {
+			return make(chan int), nil
+		})
+		handle := taskStart(sess, "testing_unserializable", "")
+		defer taskFree(handle)
+		events := readAllEvents(t, handle)
+		if len(events) != 1 {
+			t.Fatal("expected a single event")
+		}
+		if events[0].Type != eventTypeFailure || !strings.HasPrefix(
+			events[0].Value.(string), "libooniengine: cannot serialize result event:") {
+			t.Fatal("unexpected event", events[0])
+		}
+	})
+}
+
+func TestTaskInterrupt(t *testing.T) {
+	sess := newTestingSession(t)
+	started := make(chan any)
+	registerTestingTask(t, "testing_blocking", func(
+		ctx context.Context, sess *session, emitter taskEmitter, args []byte) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	handle := taskStart(sess, "testing_blocking", "")
+	defer taskFree(handle)
+	<-started
+
+	if _, found := taskWaitForNextEvent(handle, 10*time.Millisecond); found {
+		t.Fatal("expected a timeout")
+	}
+	if taskIsDone(handle) {
+		t.Fatal("expected the task to be running")
+	}
+
+	taskInterrupt(handle)
+	events := readAllEvents(t, handle)
+	if len(events) != 1 {
+		t.Fatal("expected a single event")
+	}
+	if events[0].Type != eventTypeFailure || events[0].Value != context.Canceled.Error() {
+		t.Fatal("unexpected event", events[0])
+	}
+}
+
+func TestTaskWithNonexistingHandle(t *testing.T) {
+	if _, found := taskWaitForNextEvent(0, -1); found {
+		t.Fatal("expected not found")
+	}
+	if !taskIsDone(0) {
+		t.Fatal("expected a nonexisting task to be done")
+	}
+	taskInterrupt(0) // should not crash
+	taskFree(0)      // ditto
+}
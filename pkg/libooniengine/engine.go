@@ -10,6 +10,7 @@ package main
 import "C"
 
 import (
+	"time"
 	"unsafe"
 
 	"github.com/ooni/probe-engine/pkg/version"
@@ -25,6 +26,59 @@ func OONIEngineFreeMemory(ptr *C.void) {
 	C.free(unsafe.Pointer(ptr))
 }
 
+//export OONIEngineSessionNew
+func OONIEngineSessionNew(config *C.char, failure **C.char) C.OONISession {
+	handle, err := sessionNew(C.GoString(config))
+	if err != nil {
+		if failure != nil {
+			*failure = C.CString(err.Error())
+		}
+		return 0
+	}
+	return C.OONISession(handle)
+}
+
+//export OONIEngineSessionDelete
+func OONIEngineSessionDelete(sess C.OONISession) {
+	sessionDelete(int64(sess))
+}
+
+//export OONIEngineTaskStart
+func OONIEngineTaskStart(sess C.OONISession, name *C.char, arguments *C.char) C.OONITask {
+	var args string
+	if arguments != nil {
+		args = C.GoString(arguments)
+	}
+	return C.OONITask(taskStart(int64(sess), C.GoString(name), args))
+}
+
+//export OONIEngineTaskWaitForNextEvent
+func OONIEngineTaskWaitForNextEvent(task C.OONITask, timeout C.int32_t) *C.char {
+	ev, found := taskWaitForNextEvent(int64(task), time.Duration(timeout)*time.Millisecond)
+	if !found {
+		return nil
+	}
+	return C.CString(ev)
+}
+
+//export OONIEngineTaskIsDone
+func OONIEngineTaskIsDone(task C.OONITask) C.int {
+	if taskIsDone(int64(task)) {
+		return 1
+	}
+	return 0
+}
+
+//export OONIEngineTaskInterrupt
+func OONIEngineTaskInterrupt(task C.OONITask) {
+	taskInterrupt(int64(task))
+}
+
+//export OONIEngineTaskFree
+func OONIEngineTaskFree(task C.OONITask) {
+	taskFree(int64(task))
+}
+
 func main() {
 	// do nothing
 }
@@ -6,11 +6,44 @@
 ///
 /// C API for using the OONI engine.
 ///
+/// The general usage pattern is the following:
+///
+/// 1. create a session using OONIEngineSessionNew;
+///
+/// 2. start a task inside the session using OONIEngineTaskStart;
+///
+/// 3. loop calling OONIEngineTaskWaitForNextEvent until
+/// OONIEngineTaskIsDone returns a nonzero value;
+///
+/// 4. free the task using OONIEngineTaskFree;
+///
+/// 5. when you don't need the session anymore, delete it
+/// using OONIEngineSessionDelete.
+///
+/// Events are JSON objects such as `{"type": "log", "value": {...}}`. The
+/// last event emitted by a task has either type "result", in which case
+/// the value contains the task result, or "failure", in which case the
+/// value is a string describing the error.
+///
+/// If you do not read events fast enough, the task drops "log" events
+/// rather than blocking and emits a "log" event with "WARNING" level
+/// saying how many messages it dropped before its last event.
+///
+
+#include <stdint.h>
 
 #ifdef __cplusplus
 extern "C" {
 #endif
 
+/// OONISession is a handle referring to a measurement session. The zero
+/// value is never a valid session handle.
+typedef int64_t OONISession;
+
+/// OONITask is a handle referring to a task. The zero value is never a
+/// valid task handle.
+typedef int64_t OONITask;
+
 /// OONIEngineVersion return the current engine version.
 ///
 /// @return A char pointer with the current version string.
@@ -19,7 +52,77 @@ char *OONIEngineVersion(void);
 /// OONIEngineFreeMemory frees the memory allocated by the engine.
 ///
 /// @param ptr a void pointer refering to the memory to be freed.
-void OONIENgineFreeMemory(void *ptr);
+void OONIEngineFreeMemory(void *ptr);
+
+/// OONIEngineSessionNew creates a new measurement session.
+///
+/// The config is a JSON object containing the following fields:
+/// "software_name" (mandatory), "software_version" (mandatory),
+/// "state_dir" (mandatory), "temp_dir", "tunnel_dir", "proxy",
+/// "probe_services_url", "snowflake_rendezvous", "tor_args",
+/// "tor_binary", and "verbose".
+///
+/// @param config the JSON serialized session config.
+///
+/// @param failure if not NULL, on failure we set it to point to a
+/// string describing the error, which you MUST free using the
+/// OONIEngineFreeMemory function.
+///
+/// @return A session handle on success, zero on failure.
+OONISession OONIEngineSessionNew(char *config, char **failure);
+
+/// OONIEngineSessionDelete closes and deletes a session. You SHOULD
+/// free all the tasks using this session before deleting it.
+///
+/// @param sess the session to delete.
+void OONIEngineSessionDelete(OONISession sess);
+
+/// OONIEngineTaskStart starts a task in the background.
+///
+/// The available tasks are: "check_in", "lookup_location",
+/// "run_experiment", and "run_oonirun_v2".
+///
+/// @param sess the session in which to run the task.
+///
+/// @param name the name of the task to run.
+///
+/// @param arguments the JSON serialized task arguments or NULL.
+///
+/// @return A task handle, which you MUST free using OONIEngineTaskFree. If
+/// the session or the task name are invalid, the task fails immediately.
+OONITask OONIEngineTaskStart(OONISession sess, char *name, char *arguments);
+
+/// OONIEngineTaskWaitForNextEvent waits for the next task event.
+///
+/// @param task the task handle.
+///
+/// @param timeout the maximum number of milliseconds to wait. A
+/// negative value means waiting until there is an event or the
+/// task is done. Zero means polling without blocking.
+///
+/// @return A JSON serialized event, which you MUST free using
+/// OONIEngineFreeMemory, or NULL in case of timeout, or when the task
+/// is done and there are no more events to read.
+char *OONIEngineTaskWaitForNextEvent(OONITask task, int32_t timeout);
+
+/// OONIEngineTaskIsDone returns whether a task is done.
+///
+/// @param task the task handle.
+///
+/// @return Nonzero if the task is done and you have already read all
+/// the events it emitted, zero otherwise.
+int OONIEngineTaskIsDone(OONITask task);
+
+/// OONIEngineTaskInterrupt interrupts a running task. You SHOULD continue
+/// reading events until the task is done after calling this function.
+///
+/// @param task the task handle.
+void OONIEngineTaskInterrupt(OONITask task);
+
+/// OONIEngineTaskFree interrupts a task, if needed, and frees it.
+///
+/// @param task the task handle.
+void OONIEngineTaskFree(OONITask task);
 
 #ifdef __cplusplus
 }
@@ -0,0 +1,69 @@
+package main
+
+//
+// Events emitted by tasks
+//
+
+// These are the event types emitted by tasks.
+const (
+	// eventTypeFailure is the last event emitted by a failed task and
+	// its value is a string containing the error.
+	eventTypeFailure = "failure"
+
+	// eventTypeLog is a log event whose value is a [logEventValue].
+	eventTypeLog = "log"
+
+	// eventTypeMeasurement is emitted after each measurement and its
+	// value is a [measurementEventValue].
+	eventTypeMeasurement = "measurement"
+
+	// eventTypeProgress is a progress event whose value is a [progressEventValue].
+	eventTypeProgress = "progress"
+
+	// eventTypeResult is the last event emitted by a successful task and
+	// its value depends on the specific task.
+	eventTypeResult = "result"
+)
+
+// event is an event emitted by a task. We serialize events to JSON
+// before passing them to the C code.
+type event struct {
+	// Type is the event type.
+	Type string `json:"type"`
+
+	// Value is the event value.
+	Value any `json:"value"`
+}
+
+// logEventValue is the value of a log event.
+type logEventValue struct {
+	// Level is the log level: "DEBUG", "INFO", or "WARNING".
+	Level string `json:"level"`
+
+	// Message is the log message.
+	Message string `json:"message"`
+}
+
+// progressEventValue is the value of a progress event.
+type progressEventValue struct {
+	// Percentage is a number between 0.0 and 1.0.
+	Percentage float64 `json:"percentage"`
+
+	// Message is a message describing the progress.
+	Message string `json:"message"`
+}
+
+// measurementEventValue is the value of a measurement event.
+type measurementEventValue struct {
+	// Idx is the index of the target we measured.
+	Idx int `json:"idx"`
+
+	// Input is the input we measured, if any.
+	Input string `json:"input"`
+
+	// SubmitFailure is the error that occurred when submitting, if any.
+	SubmitFailure *string `json:"submit_failure"`
+
+	// Measurement is the measurement.
+	Measurement any `json:"measurement"`
+}
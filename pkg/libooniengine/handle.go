@@ -0,0 +1,53 @@
+package main
+
+//
+// Handles for objects shared with C code
+//
+
+import "sync"
+
+// handleTable maps opaque integer handles to Go objects.
+//
+// We cannot pass Go pointers to C code and keep them around, therefore
+// we give C code an integer handle referring to the real object.
+//
+// The zero value is ready to use. The zero handle is never valid.
+type handleTable[T any] struct {
+	// m maps handles to objects.
+	m map[int64]T
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// next is the next handle to assign.
+	next int64
+}
+
+// put stores the given value and returns its handle.
+func (ht *handleTable[T]) put(value T) int64 {
+	defer ht.mu.Unlock()
+	ht.mu.Lock()
+	if ht.m == nil {
+		ht.m = make(map[int64]T)
+	}
+	ht.next++
+	ht.m[ht.next] = value
+	return ht.next
+}
+
+// get returns the value associated with the given handle, if any.
+func (ht *handleTable[T]) get(handle int64) (T, bool) {
+	defer ht.mu.Unlock()
+	ht.mu.Lock()
+	value, found := ht.m[handle]
+	return value, found
+}
+
+// remove removes the value associated with the given handle and returns it.
+func (ht *handleTable[T]) remove(handle int64) (T, bool) {
+	defer ht.mu.Unlock()
+	ht.mu.Lock()
+	value, found := ht.m[handle]
+	delete(ht.m, handle)
+	return value, found
+}
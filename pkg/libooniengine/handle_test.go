@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestHandleTable(t *testing.T) {
+	ht := &handleTable[string]{}
+
+	t.Run("get and remove fail for a nonexisting handle", func(t *testing.T) {
+		if _, found := ht.get(0); found {
+			t.Fatal("expected not found")
+		}
+		if _, found := ht.remove(0); found {
+			t.Fatal("expected not found")
+		}
+	})
+
+	t.Run("put, get, and remove work as intended", func(t *testing.T) {
+		h1 := ht.put("antani")
+		h2 := ht.put("mascetti")
+		if h1 <= 0 || h2 <= 0 || h1 == h2 {
+			t.Fatal("unexpected handles", h1, h2)
+		}
+		value, found := ht.get(h1)
+		if !found || value != "antani" {
+			t.Fatal("unexpected result", value, found)
+		}
+		value, found = ht.remove(h2)
+		if !found || value != "mascetti" {
+			t.Fatal("unexpected result", value, found)
+		}
+		if _, found := ht.get(h2); found {
+			t.Fatal("expected not found")
+		}
+	})
+}
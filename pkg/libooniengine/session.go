@@ -0,0 +1,197 @@
+package main
+
+//
+// Measurement session
+//
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+
+	"github.com/ooni/probe-engine/pkg/engine"
+	"github.com/ooni/probe-engine/pkg/kvstore"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// ErrNoSuchSession indicates that a session does not exist.
+var ErrNoSuchSession = errors.New("libooniengine: no such session")
+
+// sessionConfig is the JSON config used to create a new session.
+type sessionConfig struct {
+	// ProbeServicesURL is the OPTIONAL URL of the OONI backend to use.
+	ProbeServicesURL string `json:"probe_services_url"`
+
+	// Proxy is the OPTIONAL proxy URL (e.g., socks5://127.0.0.1:9050/ or psiphon:///).
+	Proxy string `json:"proxy"`
+
+	// SnowflakeRendezvous is the OPTIONAL rendezvous method for the torsf tunnel.
+	SnowflakeRendezvous string `json:"snowflake_rendezvous"`
+
+	// SoftwareName is the MANDATORY name of the application.
+	SoftwareName string `json:"software_name"`
+
+	// SoftwareVersion is the MANDATORY version of the application.
+	SoftwareVersion string `json:"software_version"`
+
+	// StateDir is the MANDATORY directory where to store persistent state.
+	StateDir string `json:"state_dir"`
+
+	// TempDir is the OPTIONAL directory where to create temporary files.
+	TempDir string `json:"temp_dir"`
+
+	// TorArgs contains OPTIONAL arguments for the tor binary.
+	TorArgs []string `json:"tor_args"`
+
+	// TorBinary is the OPTIONAL path to the tor binary.
+	TorBinary string `json:"tor_binary"`
+
+	// TunnelDir is the OPTIONAL directory where to store tunnels state.
+	TunnelDir string `json:"tunnel_dir"`
+
+	// Verbose OPTIONALLY enables emitting debug log events.
+	Verbose bool `json:"verbose"`
+}
+
+// session wraps an [*engine.Session].
+type session struct {
+	// logger is the logger used by the session.
+	logger *sessionLogger
+
+	// sess is the underlying session.
+	sess *engine.Session
+}
+
+// newSession creates a new session from the given JSON config.
+func newSession(ctx context.Context, rawConfig []byte) (*session, error) {
+	var config sessionConfig
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, err
+	}
+	if config.StateDir == "" {
+		return nil, errors.New("libooniengine: state_dir is empty")
+	}
+	kvs, err := kvstore.NewFS(filepath.Join(config.StateDir, "engine"))
+	if err != nil {
+		return nil, err
+	}
+	var proxyURL *url.URL
+	if config.Proxy != "" {
+		if proxyURL, err = url.Parse(config.Proxy); err != nil {
+			return nil, err
+		}
+	}
+	logger := &sessionLogger{verbose: config.Verbose}
+	engineConfig := engine.SessionConfig{
+		KVStore:             kvs,
+		Logger:              logger,
+		ProxyURL:            proxyURL,
+		SoftwareName:        config.SoftwareName,
+		SoftwareVersion:     config.SoftwareVersion,
+		TempDir:             config.TempDir,
+		TorArgs:             config.TorArgs,
+		TorBinary:           config.TorBinary,
+		SnowflakeRendezvous: config.SnowflakeRendezvous,
+		TunnelDir:           config.TunnelDir,
+	}
+	if config.ProbeServicesURL != "" {
+		engineConfig.AvailableProbeServices = []model.OOAPIService{{
+			Address: config.ProbeServicesURL,
+			Type:    "https",
+		}}
+	}
+	sess, err := engine.NewSession(ctx, engineConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &session{logger: logger, sess: sess}, nil
+}
+
+// close closes the underlying session.
+func (s *session) close() error {
+	return s.sess.Close()
+}
+
+// sessionLogger is the [model.Logger] used by a session. It forwards
+// log messages to all the tasks running inside the session as events.
+type sessionLogger struct {
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// tasks contains the tasks currently attached to the logger.
+	tasks map[taskEmitter]bool
+
+	// verbose indicates whether to emit debug messages.
+	verbose bool
+}
+
+var _ model.Logger = &sessionLogger{}
+
+// attach starts forwarding log messages to the given task.
+func (sl *sessionLogger) attach(t taskEmitter) {
+	defer sl.mu.Unlock()
+	sl.mu.Lock()
+	if sl.tasks == nil {
+		sl.tasks = make(map[taskEmitter]bool)
+	}
+	sl.tasks[t] = true
+}
+
+// detach stops forwarding log messages to the given task.
+func (sl *sessionLogger) detach(t taskEmitter) {
+	defer sl.mu.Unlock()
+	sl.mu.Lock()
+	delete(sl.tasks, t)
+}
+
+// emit emits a log event to all the attached tasks without blocking, such that
+// a consumer that is slow to read events cannot stall the whole session.
+func (sl *sessionLogger) emit(level, message string) {
+	sl.mu.Lock()
+	var tasks []taskEmitter
+	for t := range sl.tasks {
+		tasks = append(tasks, t)
+	}
+	sl.mu.Unlock()
+	for _, t := range tasks {
+		t.emitLog(level, message)
+	}
+}
+
+// Debug implements model.Logger.
+func (sl *sessionLogger) Debug(msg string) {
+	if sl.verbose {
+		sl.emit("DEBUG", msg)
+	}
+}
+
+// Debugf implements model.Logger.
+func (sl *sessionLogger) Debugf(format string, v ...any) {
+	if sl.verbose {
+		sl.Debug(fmt.Sprintf(format, v...))
+	}
+}
+
+// Info implements model.Logger.
+func (sl *sessionLogger) Info(msg string) {
+	sl.emit("INFO", msg)
+}
+
+// Infof implements model.Logger.
+func (sl *sessionLogger) Infof(format string, v ...any) {
+	sl.Info(fmt.Sprintf(format, v...))
+}
+
+// Warn implements model.Logger.
+func (sl *sessionLogger) Warn(msg string) {
+	sl.emit("WARNING", msg)
+}
+
+// Warnf implements model.Logger.
+func (sl *sessionLogger) Warnf(format string, v ...any) {
+	sl.Warn(fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,195 @@
+package main
+
+//
+// Running tasks in the background
+//
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// taskEventsBuffer is the number of events we buffer before blocking the task.
+const taskEventsBuffer = 1024
+
+// taskEmitter is the interface that task runners use to emit events.
+type taskEmitter interface {
+	// emit emits an event with the given type and value. This method
+	// blocks until the event is buffered or the task is interrupted.
+	emit(eventType string, value any)
+
+	// emitLog emits a log event without blocking. When the events
+	// buffer is full, we drop the log event and count it.
+	emitLog(level, message string)
+}
+
+// task is a task running in the background.
+type task struct {
+	// cancel cancels the task context.
+	cancel context.CancelFunc
+
+	// ctx is the task context.
+	ctx context.Context
+
+	// droppedLogs counts the log events we dropped.
+	droppedLogs atomic.Int64
+
+	// done is closed when the task has finished running.
+	done chan any
+
+	// events contains the events emitted by the task.
+	events chan *event
+
+	// once ensures we close done just once.
+	once sync.Once
+}
+
+var _ taskEmitter = &task{}
+
+// taskRunner is the function implementing a specific task. It receives the
+// session in which to run the task and the task's JSON serialized arguments.
+//
+// The runner SHOULD emit log, progress, and measurement events and MUST return
+// the result to include into the final [eventTypeResult] event or an error.
+type taskRunner func(ctx context.Context, sess *session, emitter taskEmitter, args []byte) (any, error)
+
+// newTask creates a new task instance. You MUST call task.start to start it.
+func newTask() *task {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &task{
+		cancel: cancel,
+		ctx:    ctx,
+		done:   make(chan any),
+		events: make(chan *event, taskEventsBuffer),
+		once:   sync.Once{},
+	}
+}
+
+// start runs the given runner in a background goroutine.
+func (t *task) start(sess *session, runner taskRunner, args []byte) {
+	go func() {
+		defer t.finish()
+		t.run(sess, runner, args)
+	}()
+}
+
+// run runs the runner and emits the final event.
+func (t *task) run(sess *session, runner taskRunner, args []byte) {
+	// make sure we do not crash the application embedding us
+	defer func() {
+		if r := recover(); r != nil {
+			t.emit(eventTypeFailure, fmt.Sprintf("libooniengine: task panicked: %+v", r))
+		}
+	}()
+	if sess == nil {
+		t.emit(eventTypeFailure, ErrNoSuchSession.Error())
+		return
+	}
+	if runner == nil {
+		t.emit(eventTypeFailure, ErrNoSuchTaskRunner.Error())
+		return
+	}
+	sess.logger.attach(t)
+	result, err := runner(t.ctx, sess, t, args)
+	sess.logger.detach(t)
+	if count := t.droppedLogs.Load(); count > 0 {
+		t.emit(eventTypeLog, &logEventValue{
+			Level:   "WARNING",
+			Message: fmt.Sprintf("libooniengine: dropped %d log messages because events were not read fast enough", count),
+		})
+	}
+	if err != nil {
+		t.emit(eventTypeFailure, err.Error())
+		return
+	}
+	t.emit(eventTypeResult, result)
+}
+
+// finish marks the task as done.
+func (t *task) finish() {
+	t.once.Do(func() {
+		close(t.done)
+	})
+}
+
+// emit implements taskEmitter.
+func (t *task) emit(eventType string, value any) {
+	ev := &event{Type: eventType, Value: value}
+	select {
+	case t.events <- ev:
+	case <-t.ctx.Done():
+		// we must not block forever if the consumer went away; we still
+		// try to deliver the final events emitted after the interrupt
+		select {
+		case t.events <- ev:
+		default:
+		}
+	}
+}
+
+// emitLog implements taskEmitter.
+func (t *task) emitLog(level, message string) {
+	select {
+	case t.events <- &event{Type: eventTypeLog, Value: &logEventValue{Level: level, Message: message}}:
+	default:
+		t.droppedLogs.Add(1)
+	}
+}
+
+// waitForNextEvent returns the next JSON serialized event or false on timeout or
+// when the task is done and there are no more events to read. A negative timeout
+// means that we wait until there's an event or the task is done.
+func (t *task) waitForNextEvent(timeout time.Duration) (string, bool) {
+	var timer <-chan time.Time
+	if timeout >= 0 {
+		tt := time.NewTimer(timeout)
+		defer tt.Stop()
+		timer = tt.C
+	}
+	select {
+	case ev := <-t.events:
+		return t.serialize(ev), true
+	case <-t.done:
+		// make sure we drain events that were emitted before the task finished
+		select {
+		case ev := <-t.events:
+			return t.serialize(ev), true
+		default:
+			return "", false
+		}
+	case <-timer:
+		return "", false
+	}
+}
+
+// serialize serializes the given event to JSON. If we cannot serialize the
+// event, we return a failure event describing the error instead.
+func (t *task) serialize(ev *event) string {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		data, _ = json.Marshal(&event{
+			Type:  eventTypeFailure,
+			Value: fmt.Sprintf("libooniengine: cannot serialize %s event: %s", ev.Type, err.Error()),
+		})
+	}
+	return string(data)
+}
+
+// isDone returns whether the task is done and there are no more events to read.
+func (t *task) isDone() bool {
+	select {
+	case <-t.done:
+		return len(t.events) <= 0
+	default:
+		return false
+	}
+}
+
+// interrupt interrupts the task.
+func (t *task) interrupt() {
+	t.cancel()
+}
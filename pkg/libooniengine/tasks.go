@@ -0,0 +1,277 @@
+package main
+
+//
+// Implementation of the available tasks
+//
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/oonirun"
+)
+
+// ErrNoSuchTaskRunner indicates that we don't know how to run a task.
+var ErrNoSuchTaskRunner = errors.New("libooniengine: no such task runner")
+
+// taskRegistry maps a task name to its runner.
+var taskRegistry = map[string]taskRunner{
+	"check_in":        taskRunCheckIn,
+	"lookup_location": taskRunLookupLocation,
+	"run_experiment":  taskRunExperiment,
+	"run_oonirun_v2":  taskRunOONIRunV2,
+}
+
+// taskUnmarshalArgs unmarshals the task arguments, if any.
+func taskUnmarshalArgs(args []byte, v any) error {
+	if len(args) <= 0 {
+		return nil
+	}
+	return json.Unmarshal(args, v)
+}
+
+// taskRunCheckIn calls the check-in API. The arguments are a
+// [model.OOAPICheckInConfig] and the result is a [model.OOAPICheckInResult].
+func taskRunCheckIn(ctx context.Context, sess *session, emitter taskEmitter, args []byte) (any, error) {
+	var config model.OOAPICheckInConfig
+	if err := taskUnmarshalArgs(args, &config); err != nil {
+		return nil, err
+	}
+	if err := sess.sess.MaybeLookupBackendsContext(ctx); err != nil {
+		return nil, err
+	}
+	return sess.sess.CheckIn(ctx, &config)
+}
+
+// locationResult is the result of the lookup_location task.
+type locationResult struct {
+	ProbeIP             string `json:"probe_ip"`
+	ProbeASN            string `json:"probe_asn"`
+	ProbeCC             string `json:"probe_cc"`
+	ProbeNetworkName    string `json:"probe_network_name"`
+	ResolverIP          string `json:"resolver_ip"`
+	ResolverASN         string `json:"resolver_asn"`
+	ResolverNetworkName string `json:"resolver_network_name"`
+}
+
+// taskRunLookupLocation looks up the probe location. This task takes no
+// arguments and its result is a [locationResult].
+func taskRunLookupLocation(ctx context.Context, sess *session, emitter taskEmitter, args []byte) (any, error) {
+	if err := sess.sess.MaybeLookupLocationContext(ctx); err != nil {
+		return nil, err
+	}
+	result := &locationResult{
+		ProbeIP:             sess.sess.ProbeIP(),
+		ProbeASN:            sess.sess.ProbeASNString(),
+		ProbeCC:             sess.sess.ProbeCC(),
+		ProbeNetworkName:    sess.sess.ProbeNetworkName(),
+		ResolverIP:          sess.sess.ResolverIP(),
+		ResolverASN:         sess.sess.ResolverASNString(),
+		ResolverNetworkName: sess.sess.ResolverNetworkName(),
+	}
+	return result, nil
+}
+
+// runExperimentArgs contains the arguments of the run_experiment task.
+type runExperimentArgs struct {
+	// Annotations contains OPTIONAL annotations for the measurements.
+	Annotations map[string]string `json:"annotations"`
+
+	// Inputs contains the OPTIONAL inputs for the experiment.
+	Inputs []string `json:"inputs"`
+
+	// MaxRuntime is the OPTIONAL maximum runtime in seconds.
+	MaxRuntime int64 `json:"max_runtime"`
+
+	// Name is the MANDATORY experiment name.
+	Name string `json:"name"`
+
+	// NoCollector OPTIONALLY disables submitting measurements.
+	NoCollector bool `json:"no_collector"`
+
+	// Options contains the OPTIONAL experiment options.
+	Options json.RawMessage `json:"options"`
+}
+
+// runExperimentResult is the result of the run_experiment task.
+type runExperimentResult struct {
+	// Measurements is the number of measurements we performed.
+	Measurements int `json:"measurements"`
+
+	// ReportID is the ID of the report, if we opened a report.
+	ReportID string `json:"report_id"`
+}
+
+// taskRunExperiment runs an experiment. The arguments are [runExperimentArgs]
+// and the result is a [runExperimentResult]. This task emits a measurement
+// event for each measurement that it performs.
+func taskRunExperiment(ctx context.Context, sess *session, emitter taskEmitter, args []byte) (any, error) {
+	var config runExperimentArgs
+	if err := taskUnmarshalArgs(args, &config); err != nil {
+		return nil, err
+	}
+	if err := sess.sess.MaybeLookupBackendsContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := sess.sess.MaybeLookupLocationContext(ctx); err != nil {
+		return nil, err
+	}
+	return runExperiment(ctx, sess, emitter, &config)
+}
+
+// taskCallbacks implements [model.ExperimentCallbacks] by emitting progress events.
+type taskCallbacks struct {
+	emitter taskEmitter
+}
+
+var _ model.ExperimentCallbacks = &taskCallbacks{}
+
+// OnProgress implements model.ExperimentCallbacks.
+func (tc *taskCallbacks) OnProgress(percentage float64, message string) {
+	tc.emitter.emit(eventTypeProgress, &progressEventValue{
+		Percentage: percentage,
+		Message:    message,
+	})
+}
+
+// runExperiment is the common code to run an experiment.
+func runExperiment(
+	ctx context.Context, sess *session, emitter taskEmitter, config *runExperimentArgs) (*runExperimentResult, error) {
+	logger := sess.sess.Logger()
+
+	builder, err := sess.sess.NewExperimentBuilder(config.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := builder.SetOptionsJSON(config.Options); err != nil {
+		return nil, err
+	}
+	builder.SetCallbacks(&taskCallbacks{emitter})
+
+	loader := builder.NewTargetLoader(&model.ExperimentTargetLoaderConfig{
+		CheckInConfig: &model.OOAPICheckInConfig{
+			RunType:  model.RunTypeManual,
+			OnWiFi:   true, // meaning: not on 4G
+			Charging: true,
+		},
+		Session:      sess.sess,
+		StaticInputs: config.Inputs,
+		SourceFiles:  nil,
+	})
+	targets, err := loader.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	experiment := builder.NewExperiment()
+	submit := !config.NoCollector
+	if submit {
+		if err := experiment.OpenReportContext(ctx); err != nil {
+			logger.Warnf("cannot open report: %s", err.Error())
+			submit = false
+		}
+	}
+
+	result := &runExperimentResult{}
+	start := time.Now()
+	maxRuntime := time.Duration(config.MaxRuntime) * time.Second
+	for idx, target := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		if maxRuntime > 0 && time.Since(start) > maxRuntime {
+			logger.Info("stopping because we reached the maximum runtime")
+			break
+		}
+		if target.Input() != "" {
+			logger.Infof("[%d/%d] running with input: %s", idx+1, len(targets), target)
+		}
+		meas, err := experiment.MeasureWithContext(ctx, target)
+		if err != nil {
+			logger.Warnf("measurement failed: %s", err.Error())
+			continue
+		}
+		meas.AddAnnotations(config.Annotations)
+		value := &measurementEventValue{
+			Idx:           idx,
+			Input:         target.Input(),
+			SubmitFailure: nil,
+			Measurement:   meas,
+		}
+		if submit {
+			if err := experiment.SubmitAndUpdateMeasurementContext(ctx, meas); err != nil {
+				logger.Warnf("submitting measurement failed: %s", err.Error())
+				failure := err.Error()
+				value.SubmitFailure = &failure
+			}
+		}
+		emitter.emit(eventTypeMeasurement, value)
+		result.Measurements++
+	}
+
+	result.ReportID = experiment.ReportID()
+	return result, nil
+}
+
+// runOONIRunV2Args contains the arguments of the run_oonirun_v2 task.
+type runOONIRunV2Args struct {
+	// Annotations contains OPTIONAL annotations for the measurements.
+	Annotations map[string]string `json:"annotations"`
+
+	// Descriptor is the MANDATORY OONI Run v2 descriptor.
+	Descriptor *oonirun.V2Descriptor `json:"descriptor"`
+
+	// MaxRuntime is the OPTIONAL maximum runtime in seconds of each nettest.
+	MaxRuntime int64 `json:"max_runtime"`
+
+	// NoCollector OPTIONALLY disables submitting measurements.
+	NoCollector bool `json:"no_collector"`
+}
+
+// taskRunOONIRunV2 runs all the nettests inside an OONI Run v2 descriptor. The
+// arguments are [runOONIRunV2Args] and the result is a list containing a
+// [runExperimentResult] for each nettest that we could run.
+func taskRunOONIRunV2(ctx context.Context, sess *session, emitter taskEmitter, args []byte) (any, error) {
+	var config runOONIRunV2Args
+	if err := taskUnmarshalArgs(args, &config); err != nil {
+		return nil, err
+	}
+	if config.Descriptor == nil {
+		return nil, oonirun.ErrNilDescriptor
+	}
+	if err := sess.sess.MaybeLookupBackendsContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := sess.sess.MaybeLookupLocationContext(ctx); err != nil {
+		return nil, err
+	}
+	logger := sess.sess.Logger()
+	logger.Infof("oonirun: running '%s'", config.Descriptor.Name)
+	results := []*runExperimentResult{}
+	for _, nettest := range config.Descriptor.Nettests {
+		if ctx.Err() != nil {
+			break
+		}
+		if nettest.TestName == "" {
+			logger.Warn("oonirun: nettest name cannot be empty")
+			continue
+		}
+		result, err := runExperiment(ctx, sess, emitter, &runExperimentArgs{
+			Annotations: config.Annotations,
+			Inputs:      nettest.Inputs,
+			MaxRuntime:  config.MaxRuntime,
+			Name:        nettest.TestName,
+			NoCollector: config.NoCollector,
+			Options:     nettest.Options,
+		})
+		if err != nil {
+			logger.Warnf("cannot run experiment: %s", err.Error())
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
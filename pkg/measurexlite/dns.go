@@ -103,11 +103,40 @@ func (tx *Trace) NewParallelUDPResolver(logger model.DebugLogger, dialer model.D
 	return tx.wrapResolver(tx.Netx.NewParallelUDPResolver(logger, dialer, address))
 }
 
+// NewParallelUDPResolverWithCollectWindow returns a trace-ware parallel UDP resolver
+// that waits for the given window to collect all the responses to each query, which
+// you can then obtain using [Trace.DelayedDNSResponseWithTimeout].
+func (tx *Trace) NewParallelUDPResolverWithCollectWindow(logger model.DebugLogger,
+	dialer model.Dialer, address string, window time.Duration) model.Resolver {
+	return tx.wrapResolver(tx.Netx.NewParallelUDPResolverWithCollectWindow(logger, dialer, address, window))
+}
+
 // NewParallelDNSOverHTTPSResolver returns a trace-aware parallel DoH resolver
 func (tx *Trace) NewParallelDNSOverHTTPSResolver(logger model.DebugLogger, URL string) model.Resolver {
 	return tx.wrapResolver(tx.Netx.NewParallelDNSOverHTTPSResolver(logger, URL))
 }
 
+// NewParallelDNSOverTLSResolver returns a trace-aware parallel DoT resolver
+func (tx *Trace) NewParallelDNSOverTLSResolver(logger model.DebugLogger, address string) model.Resolver {
+	return tx.wrapResolver(tx.Netx.NewParallelDNSOverTLSResolver(logger, address))
+}
+
+// NewParallelODoHResolver returns a trace-aware parallel ODoH resolver
+func (tx *Trace) NewParallelODoHResolver(logger model.DebugLogger, URL string) model.Resolver {
+	return tx.wrapResolver(tx.Netx.NewParallelODoHResolver(logger, URL))
+}
+
+// NewParallelDNSSECValidatingResolver returns a trace-aware parallel resolver
+// that validates DNSSEC using the given transport (see [netxlite.DNSSECValidatingTransport]).
+func (tx *Trace) NewParallelDNSSECValidatingResolver(logger model.DebugLogger, txp model.DNSTransport) model.Resolver {
+	return tx.wrapResolver(tx.Netx.NewParallelDNSSECValidatingResolver(logger, txp))
+}
+
+// NewParallelDNSOverQUICResolver returns a trace-aware parallel DoQ resolver
+func (tx *Trace) NewParallelDNSOverQUICResolver(logger model.DebugLogger, address string) model.Resolver {
+	return tx.wrapResolver(tx.Netx.NewParallelDNSOverQUICResolver(logger, address))
+}
+
 // OnDNSRoundTripForLookupHost implements model.Trace.OnDNSRoundTripForLookupHost
 func (tx *Trace) OnDNSRoundTripForLookupHost(started time.Time, reso model.Resolver, query model.DNSQuery,
 	response model.DNSResponse, addrs []string, err error, finished time.Time) {
@@ -131,6 +160,63 @@ func (tx *Trace) OnDNSRoundTripForLookupHost(started time.Time, reso model.Resol
 	}
 }
 
+// OnDNSRoundTripForLookupHTTPS implements model.Trace.OnDNSRoundTripForLookupHTTPS
+func (tx *Trace) OnDNSRoundTripForLookupHTTPS(started time.Time, reso model.Resolver, query model.DNSQuery,
+	response model.DNSResponse, https *model.HTTPSSvc, err error, finished time.Time) {
+	ev := NewArchivalDNSLookupResultFromRoundTrip(
+		tx.Index(),
+		started.Sub(tx.ZeroTime()),
+		reso,
+		query,
+		response,
+		[]string{},
+		err,
+		finished.Sub(tx.ZeroTime()),
+		tx.tags...,
+	)
+	ev.Answers = append(ev.Answers, newArchivalDNSSVCBAnswers(https)...)
+
+	select {
+	case tx.dnsLookup <- ev:
+
+	default:
+		// buffer is full
+	}
+}
+
+// newArchivalDNSSVCBAnswers generates []model.ArchivalDNSAnswer from the
+// records contained in the given, possibly nil, [*model.HTTPSSvc].
+func newArchivalDNSSVCBAnswers(https *model.HTTPSSvc) (out []model.ArchivalDNSAnswer) {
+	if https == nil {
+		return
+	}
+	for _, record := range https.Records {
+		ttl := record.TTL
+		out = append(out, model.ArchivalDNSAnswer{
+			ASN:        0,
+			ASOrgName:  "",
+			AnswerType: "HTTPS",
+			Hostname:   record.TargetName,
+			IPv4:       "",
+			IPv6:       "",
+			SVCB: &model.ArchivalDNSSVCBAnswer{
+				Priority:      record.Priority,
+				TargetName:    record.TargetName,
+				ALPN:          record.ALPN,
+				NoDefaultALPN: record.NoDefaultALPN,
+				Port:          record.Port,
+				Mandatory:     record.Mandatory,
+				IPv4Hint:      record.IPv4,
+				IPv6Hint:      record.IPv6,
+				ECHConfig:     record.ECHConfig,
+				Params:        record.Params,
+			},
+			TTL: &ttl,
+		})
+	}
+	return
+}
+
 // DNSNetworkAddresser is the type of something we just used to perform a DNS
 // round trip (e.g., model.DNSTransport, model.Resolver) that allows us to get
 // the network and the address of the underlying resolver/transport.
@@ -149,10 +235,12 @@ func NewArchivalDNSLookupResultFromRoundTrip(index int64, started time.Duration,
 	addrs []string, err error, finished time.Duration, tags ...string) *model.ArchivalDNSLookupResult {
 	return &model.ArchivalDNSLookupResult{
 		Answers:          newArchivalDNSAnswers(addrs, response),
+		DNSSECStatus:     maybeDNSSECStatus(response),
 		Engine:           reso.Network(),
 		Failure:          NewFailure(err),
 		GetaddrinfoError: netxlite.ErrorToGetaddrinfoRetvalOrZero(err),
 		Hostname:         query.Domain(),
+		IPTTL:            maybeIPTTL(response),
 		QueryType:        dns.TypeToString[query.Type()],
 		RawResponse:      maybeRawResponse(response),
 		Rcode:            maybeResponseRcode(response),
@@ -174,6 +262,24 @@ func maybeResponseRcode(resp model.DNSResponse) (out int64) {
 	return
 }
 
+// maybeDNSSECStatus returns the DNSSEC validation status when the response
+// has been validated (see [model.DNSSECValidatedResponse]) or an empty string.
+func maybeDNSSECStatus(resp model.DNSResponse) (out string) {
+	if validated, ok := resp.(model.DNSSECValidatedResponse); ok {
+		out = validated.DNSSECStatus()
+	}
+	return
+}
+
+// maybeIPTTL returns the TTL of the IP packet carrying the response when
+// available (see [model.DNSResponseWithIPTTL]) or zero.
+func maybeIPTTL(resp model.DNSResponse) (out int64) {
+	if withTTL, ok := resp.(model.DNSResponseWithIPTTL); ok {
+		out = withTTL.IPTTL()
+	}
+	return
+}
+
 // maybeRawResponse returns either the raw response (when available) or nil.
 func maybeRawResponse(resp model.DNSResponse) (out []byte) {
 	if resp != nil {
@@ -226,6 +226,137 @@ func TestNewResolver(t *testing.T) {
 		})
 	})
 
+	t.Run("LookupHTTPS saves into trace", func(t *testing.T) {
+		zeroTime := time.Now()
+		td := testingx.NewTimeDeterministic(zeroTime)
+		trace := NewTrace(0, zeroTime, "antani")
+		trace.timeNowFn = td.Now
+		expectHTTPS := &model.HTTPSSvc{
+			ALPN: []string{"h3"},
+			IPv4: []string{"1.1.1.1"},
+			IPv6: []string{},
+			Records: []*model.HTTPSSvcRecord{{
+				Priority:   1,
+				TargetName: ".",
+				TTL:        300,
+				ALPN:       []string{"h3"},
+				Mandatory:  []string{},
+				IPv4:       []string{"1.1.1.1"},
+				IPv6:       []string{},
+				ECHConfig:  []byte{1, 2, 3},
+				Params: map[string]string{
+					"alpn":     "h3",
+					"ech":      "AQID",
+					"ipv4hint": "1.1.1.1",
+				},
+			}},
+		}
+		txp := &mocks.DNSTransport{
+			MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+				response := &mocks.DNSResponse{
+					MockDecodeHTTPS: func() (*model.HTTPSSvc, error) {
+						return expectHTTPS, nil
+					},
+					MockDecodeCNAME: func() (string, error) {
+						return "", netxlite.ErrOODNSNoAnswer
+					},
+					MockRcode: func() int {
+						return 0
+					},
+					MockBytes: func() []byte {
+						return []byte{}
+					},
+				}
+				return response, nil
+			},
+			MockRequiresPadding: func() bool {
+				return true
+			},
+			MockNetwork: func() string {
+				return "mocked"
+			},
+			MockAddress: func() string {
+				return "dns.google"
+			},
+		}
+		r := netxlite.NewUnwrappedParallelResolver(txp)
+		resolver := trace.wrapResolver(r)
+		https, err := resolver.LookupHTTPS(context.Background(), "example.com")
+		if err != nil {
+			t.Fatal("unexpected err", err)
+		}
+		if https != expectHTTPS {
+			t.Fatal("unexpected https")
+		}
+
+		events := trace.DNSLookupsFromRoundTrip()
+		if len(events) != 1 {
+			t.Fatal("unexpected DNS events length")
+		}
+		ttl := uint32(300)
+		expectAnswers := []model.ArchivalDNSAnswer{{
+			AnswerType: "HTTPS",
+			Hostname:   ".",
+			SVCB: &model.ArchivalDNSSVCBAnswer{
+				Priority:   1,
+				TargetName: ".",
+				ALPN:       []string{"h3"},
+				Mandatory:  []string{},
+				IPv4Hint:   []string{"1.1.1.1"},
+				IPv6Hint:   []string{},
+				ECHConfig:  []byte{1, 2, 3},
+				Params: map[string]string{
+					"alpn":     "h3",
+					"ech":      "AQID",
+					"ipv4hint": "1.1.1.1",
+				},
+			},
+			TTL: &ttl,
+		}}
+		if diff := cmp.Diff(expectAnswers, events[0].Answers); diff != "" {
+			t.Fatal(diff)
+		}
+		if events[0].QueryType != "HTTPS" {
+			t.Fatal("unexpected query type", events[0].QueryType)
+		}
+		if diff := cmp.Diff([]string{"antani"}, events[0].Tags); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("LookupHTTPS discards events when buffers are full", func(t *testing.T) {
+		zeroTime := time.Now()
+		trace := NewTrace(0, zeroTime)
+		trace.dnsLookup = make(chan *model.ArchivalDNSLookupResult) // no buffer
+		expected := errors.New("mocked")
+		txp := &mocks.DNSTransport{
+			MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+				return nil, expected
+			},
+			MockRequiresPadding: func() bool {
+				return true
+			},
+			MockNetwork: func() string {
+				return "mocked"
+			},
+			MockAddress: func() string {
+				return "dns.google"
+			},
+		}
+		r := netxlite.NewUnwrappedParallelResolver(txp)
+		resolver := trace.wrapResolver(r)
+		https, err := resolver.LookupHTTPS(context.Background(), "example.com")
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if https != nil {
+			t.Fatal("expected nil https")
+		}
+		if events := trace.DNSLookupsFromRoundTrip(); len(events) != 0 {
+			t.Fatal("expected no DNS events")
+		}
+	})
+
 	t.Run("LookupHost discards events when buffers are full", func(t *testing.T) {
 		zeroTime := time.Now()
 		td := testingx.NewTimeDeterministic(zeroTime)
@@ -311,6 +442,60 @@ func TestNewWrappedResolvers(t *testing.T) {
 		}
 	})
 
+	t.Run("NewParallelDNSOverTLSResolver works as intended", func(t *testing.T) {
+		zeroTime := time.Now()
+		trace := NewTrace(0, zeroTime)
+		resolver := trace.NewParallelDNSOverTLSResolver(model.DiscardLogger, "1.1.1.1:853")
+		resolvert := resolver.(*resolverTrace)
+		if resolvert.tx != trace {
+			t.Fatal("invalid trace")
+		}
+		if resolver.Network() != "dot" {
+			t.Fatal("unexpected resolver network")
+		}
+	})
+
+	t.Run("NewParallelDNSOverQUICResolver works as intended", func(t *testing.T) {
+		zeroTime := time.Now()
+		trace := NewTrace(0, zeroTime)
+		resolver := trace.NewParallelDNSOverQUICResolver(model.DiscardLogger, "94.140.14.140:853")
+		resolvert := resolver.(*resolverTrace)
+		if resolvert.tx != trace {
+			t.Fatal("invalid trace")
+		}
+		if resolver.Network() != "doq" {
+			t.Fatal("unexpected resolver network")
+		}
+	})
+
+	t.Run("NewParallelODoHResolver works as intended", func(t *testing.T) {
+		zeroTime := time.Now()
+		trace := NewTrace(0, zeroTime)
+		resolver := trace.NewParallelODoHResolver(model.DiscardLogger, "odoh://proxy.example.com/target.example.com")
+		resolvert := resolver.(*resolverTrace)
+		if resolvert.tx != trace {
+			t.Fatal("invalid trace")
+		}
+		if resolver.Network() != "odoh" {
+			t.Fatal("unexpected resolver network")
+		}
+	})
+
+	t.Run("NewParallelDNSSECValidatingResolver works as intended", func(t *testing.T) {
+		zeroTime := time.Now()
+		trace := NewTrace(0, zeroTime)
+		dialer := netxlite.NewDialerWithStdlibResolver(model.DiscardLogger)
+		txp := netxlite.NewUnwrappedDNSOverUDPTransport(dialer, "1.1.1.1:53")
+		resolver := trace.NewParallelDNSSECValidatingResolver(model.DiscardLogger, txp)
+		resolvert := resolver.(*resolverTrace)
+		if resolvert.tx != trace {
+			t.Fatal("invalid trace")
+		}
+		if resolver.Network() != "udp" {
+			t.Fatal("unexpected resolver network")
+		}
+	})
+
 	t.Run("NewParallelUDPResolver works as intended", func(t *testing.T) {
 		zeroTime := time.Now()
 		trace := NewTrace(0, zeroTime)
@@ -732,3 +917,73 @@ func TestNewArchivalDNSAnswers(t *testing.T) {
 		})
 	}
 }
+
+func TestMaybeDNSSECStatus(t *testing.T) {
+	t.Run("with a nil response", func(t *testing.T) {
+		if got := maybeDNSSECStatus(nil); got != "" {
+			t.Fatal("unexpected status", got)
+		}
+	})
+
+	t.Run("with a response that has not been validated", func(t *testing.T) {
+		if got := maybeDNSSECStatus(&mocks.DNSResponse{}); got != "" {
+			t.Fatal("unexpected status", got)
+		}
+	})
+
+	t.Run("with a validated response", func(t *testing.T) {
+		resp := &dnssecValidatedResponse{
+			DNSResponse: &mocks.DNSResponse{},
+			status:      model.DNSSECStatusBogus,
+		}
+		if got := maybeDNSSECStatus(resp); got != model.DNSSECStatusBogus {
+			t.Fatal("unexpected status", got)
+		}
+	})
+}
+
+func TestMaybeIPTTL(t *testing.T) {
+	t.Run("with a nil response", func(t *testing.T) {
+		if got := maybeIPTTL(nil); got != 0 {
+			t.Fatal("unexpected TTL", got)
+		}
+	})
+
+	t.Run("with a response without the IP TTL", func(t *testing.T) {
+		if got := maybeIPTTL(&mocks.DNSResponse{}); got != 0 {
+			t.Fatal("unexpected TTL", got)
+		}
+	})
+
+	t.Run("with a response with the IP TTL", func(t *testing.T) {
+		resp := &dnsResponseWithIPTTL{
+			DNSResponse: &mocks.DNSResponse{},
+			ttl:         57,
+		}
+		if got := maybeIPTTL(resp); got != 57 {
+			t.Fatal("unexpected TTL", got)
+		}
+	})
+}
+
+// dnsResponseWithIPTTL is a [model.DNSResponseWithIPTTL] for testing.
+type dnsResponseWithIPTTL struct {
+	model.DNSResponse
+	ttl int64
+}
+
+// IPTTL implements [model.DNSResponseWithIPTTL].
+func (r *dnsResponseWithIPTTL) IPTTL() int64 {
+	return r.ttl
+}
+
+// dnssecValidatedResponse is a [model.DNSSECValidatedResponse] for testing.
+type dnssecValidatedResponse struct {
+	model.DNSResponse
+	status string
+}
+
+// DNSSECStatus implements [model.DNSSECValidatedResponse].
+func (r *dnssecValidatedResponse) DNSSECStatus() string {
+	return r.status
+}
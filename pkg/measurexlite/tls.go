@@ -25,10 +25,33 @@ func (tx *Trace) NewTLSHandshakerStdlib(dl model.DebugLogger) model.TLSHandshake
 	}
 }
 
+// NewTLSHandshakerClientHello returns a trace-aware TLS handshaker using the ClientHello
+// fingerprint with the given name, which is recorded into the archival TLS handshake results.
+// See [netxlite.ParseClientHelloID] for the supported names. We use the standard library
+// for the "golang" and the empty names, and utls otherwise.
+func (tx *Trace) NewTLSHandshakerClientHello(dl model.DebugLogger, name string) (model.TLSHandshaker, error) {
+	id, err := netxlite.ParseClientHelloID(name)
+	if err != nil {
+		return nil, err
+	}
+	thx := &tlsHandshakerTrace{
+		clientHello: name,
+		thx:         nil, // set below
+		tx:          tx,
+	}
+	if id == nil {
+		thx.thx = tx.Netx.NewTLSHandshakerStdlib(dl)
+		return thx, nil
+	}
+	thx.thx = tx.Netx.NewTLSHandshakerUTLS(dl, id)
+	return thx, nil
+}
+
 // tlsHandshakerTrace is a trace-aware TLS handshaker.
 type tlsHandshakerTrace struct {
-	thx model.TLSHandshaker
-	tx  *Trace
+	clientHello string
+	thx         model.TLSHandshaker
+	tx          *Trace
 }
 
 var _ model.TLSHandshaker = &tlsHandshakerTrace{}
@@ -36,7 +59,30 @@ var _ model.TLSHandshaker = &tlsHandshakerTrace{}
 // Handshake implements model.TLSHandshaker.Handshake.
 func (thx *tlsHandshakerTrace) Handshake(
 	ctx context.Context, conn net.Conn, tlsConfig *tls.Config) (model.TLSConn, error) {
-	return thx.thx.Handshake(netxlite.ContextWithTrace(ctx, thx.tx), conn, tlsConfig)
+	var hellos *tlsHelloRecorder
+	if thx.tx.TLSFingerprints {
+		hellos = &tlsHelloRecorder{}
+		conn = hellos.wrap(conn)
+	}
+	var trace model.Trace = thx.tx
+	if thx.clientHello != "" || hellos != nil {
+		trace = &tlsHandshakeTrace{Trace: thx.tx, clientHello: thx.clientHello, hellos: hellos}
+	}
+	return thx.thx.Handshake(netxlite.ContextWithTrace(ctx, trace), conn, tlsConfig)
+}
+
+// tlsHandshakeTrace is a [*Trace] that records the ClientHello fingerprint
+// name and, optionally, the hello messages exchanged during the handshake.
+type tlsHandshakeTrace struct {
+	*Trace
+	clientHello string
+	hellos      *tlsHelloRecorder
+}
+
+// OnTLSHandshakeDone implements model.Trace.OnTLSHandshakeDone.
+func (tx *tlsHandshakeTrace) OnTLSHandshakeDone(started time.Time, remoteAddr string, config *tls.Config,
+	state tls.ConnectionState, err error, finished time.Time) {
+	tx.Trace.onTLSHandshakeDone(started, remoteAddr, config, state, err, finished, tx.clientHello, tx.hellos)
 }
 
 // OnTLSHandshakeStart implements model.Trace.OnTLSHandshakeStart.
@@ -61,10 +107,16 @@ func (tx *Trace) OnTLSHandshakeStart(now time.Time, remoteAddr string, config *t
 // OnTLSHandshakeDone implements model.Trace.OnTLSHandshakeDone.
 func (tx *Trace) OnTLSHandshakeDone(started time.Time, remoteAddr string, config *tls.Config,
 	state tls.ConnectionState, err error, finished time.Time) {
+	tx.onTLSHandshakeDone(started, remoteAddr, config, state, err, finished, "", nil)
+}
+
+// onTLSHandshakeDone is like OnTLSHandshakeDone but also records the ClientHello fingerprint
+// name and the fingerprints of the hello messages, when hellos is not nil.
+func (tx *Trace) onTLSHandshakeDone(started time.Time, remoteAddr string, config *tls.Config,
+	state tls.ConnectionState, err error, finished time.Time, clientHello string, hellos *tlsHelloRecorder) {
 	t := finished.Sub(tx.ZeroTime())
 
-	select {
-	case tx.tlsHandshake <- NewArchivalTLSOrQUICHandshakeResult(
+	hs := NewArchivalTLSOrQUICHandshakeResult(
 		tx.Index(),
 		started.Sub(tx.ZeroTime()),
 		"tcp",
@@ -74,7 +126,14 @@ func (tx *Trace) OnTLSHandshakeDone(started time.Time, remoteAddr string, config
 		err,
 		t,
 		tx.tags...,
-	):
+	)
+	hs.ClientHelloID = clientHello
+	if hellos != nil {
+		tlsAddFingerprints(hs, hellos)
+	}
+
+	select {
+	case tx.tlsHandshake <- hs:
 	default: // buffer is full
 	}
 
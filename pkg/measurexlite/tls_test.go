@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"errors"
 	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -342,6 +343,160 @@ func TestNewTLSHandshakerStdlib(t *testing.T) {
 	})
 }
 
+func TestNewTLSHandshakerClientHello(t *testing.T) {
+	t.Run("NewTLSHandshakerClientHello fails with an unknown fingerprint", func(t *testing.T) {
+		trace := NewTrace(0, time.Now())
+		thx, err := trace.NewTLSHandshakerClientHello(model.DiscardLogger, "netscape")
+		if !errors.Is(err, netxlite.ErrUnknownClientHelloID) {
+			t.Fatal("unexpected error", err)
+		}
+		if thx != nil {
+			t.Fatal("expected nil TLSHandshaker")
+		}
+	})
+
+	t.Run("NewTLSHandshakerClientHello uses the stdlib for golang", func(t *testing.T) {
+		underlying := &mocks.TLSHandshaker{}
+		trace := NewTrace(0, time.Now())
+		trace.Netx = &mocks.MeasuringNetwork{
+			MockNewTLSHandshakerStdlib: func(logger model.DebugLogger) model.TLSHandshaker {
+				return underlying
+			},
+		}
+		thx, err := trace.NewTLSHandshakerClientHello(model.DiscardLogger, "golang")
+		if err != nil {
+			t.Fatal(err)
+		}
+		thxt := thx.(*tlsHandshakerTrace)
+		if thxt.thx != underlying {
+			t.Fatal("invalid TLS handshaker")
+		}
+		if thxt.clientHello != "golang" {
+			t.Fatal("invalid ClientHello fingerprint name")
+		}
+	})
+
+	t.Run("we record the fingerprint name with a local TLS server", func(t *testing.T) {
+		ca := netem.MustNewCA()
+		cert := ca.MustNewTLSCertificate("dns.google")
+		server := testingx.MustNewTLSServer(testingx.TLSHandlerHandshakeAndWriteText(cert, testingx.HTTPBlockpage451))
+		defer server.Close()
+		netx := &netxlite.Netx{}
+		dialer := netx.NewDialerWithoutResolver(model.DiscardLogger)
+		ctx := context.Background()
+		conn, err := dialer.DialContext(ctx, "tcp", server.Endpoint())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		trace := NewTrace(0, time.Now())
+		thx, err := trace.NewTLSHandshakerClientHello(model.DiscardLogger, "chrome")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsConfig := &tls.Config{
+			RootCAs:    ca.DefaultCertPool(),
+			ServerName: "dns.google",
+		}
+		tlsConn, err := thx.Handshake(ctx, conn, tlsConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tlsConn.Close()
+		events := trace.TLSHandshakes()
+		if len(events) != 1 {
+			t.Fatal("expected to see a single TLSHandshake event")
+		}
+		if events[0].ClientHelloID != "chrome" {
+			t.Fatal("unexpected ClientHelloID", events[0].ClientHelloID)
+		}
+		if events[0].Failure != nil {
+			t.Fatal("unexpected failure", *events[0].Failure)
+		}
+		if len(trace.NetworkEvents()) != 2 {
+			t.Fatal("expected to see two network events")
+		}
+	})
+}
+
+func TestTLSFingerprints(t *testing.T) {
+	ca := netem.MustNewCA()
+	cert := ca.MustNewTLSCertificate("dns.google")
+	server := testingx.MustNewTLSServer(testingx.TLSHandlerHandshakeAndWriteText(cert, testingx.HTTPBlockpage451))
+	defer server.Close()
+
+	// handshake performs a TLS handshake with the server using the given ClientHello fingerprint
+	// name and returns the resulting TLS handshake observation.
+	handshake := func(t *testing.T, fingerprints bool, clientHello string) *model.ArchivalTLSOrQUICHandshakeResult {
+		netx := &netxlite.Netx{}
+		dialer := netx.NewDialerWithoutResolver(model.DiscardLogger)
+		ctx := context.Background()
+		conn, err := dialer.DialContext(ctx, "tcp", server.Endpoint())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		trace := NewTrace(0, time.Now())
+		trace.TLSFingerprints = fingerprints
+		thx, err := trace.NewTLSHandshakerClientHello(model.DiscardLogger, clientHello)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsConfig := &tls.Config{
+			NextProtos: []string{"h2", "http/1.1"},
+			RootCAs:    ca.DefaultCertPool(),
+			ServerName: "dns.google",
+		}
+		tlsConn, err := thx.Handshake(ctx, conn, tlsConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tlsConn.Close()
+		hs := trace.FirstTLSHandshakeOrNil()
+		if hs == nil {
+			t.Fatal("expected to see a TLS handshake")
+		}
+		return hs
+	}
+
+	t.Run("we do not compute fingerprints by default", func(t *testing.T) {
+		hs := handshake(t, false, "")
+		if hs.ClientHello != nil || hs.JA3 != "" || hs.JA3S != "" || hs.JA4 != "" || hs.JA4S != "" {
+			t.Fatal("expected no fingerprints")
+		}
+	})
+
+	for _, clientHello := range []string{"golang", "chrome"} {
+		t.Run("we compute fingerprints using "+clientHello, func(t *testing.T) {
+			hs := handshake(t, true, clientHello)
+			hello, err := tlsParseClientHello(hs.ClientHello)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hs.JA3 != tlsComputeJA3(hello) || len(hs.JA3) != 32 {
+				t.Fatal("unexpected JA3", hs.JA3)
+			}
+			if !strings.HasPrefix(hs.JA4, "t13d") || !strings.Contains(hs.JA4, "h2_") {
+				t.Fatal("unexpected JA4", hs.JA4)
+			}
+			if len(hs.JA3S) != 32 {
+				t.Fatal("unexpected JA3S", hs.JA3S)
+			}
+			if !strings.HasPrefix(hs.JA4S, "t13") {
+				t.Fatal("unexpected JA4S", hs.JA4S)
+			}
+		})
+	}
+
+	t.Run("the fingerprints depend on the ClientHello", func(t *testing.T) {
+		golang := handshake(t, true, "golang")
+		chrome := handshake(t, true, "chrome")
+		if golang.JA4 == chrome.JA4 {
+			t.Fatal("expected different JA4 fingerprints")
+		}
+	})
+}
+
 func TestFirstTLSHandshake(t *testing.T) {
 	t.Run("returns nil when buffer is empty", func(t *testing.T) {
 		zeroTime := time.Now()
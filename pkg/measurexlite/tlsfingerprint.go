@@ -0,0 +1,202 @@
+package measurexlite
+
+//
+// Computing the JA3, JA3S, JA4, and JA4S fingerprints
+//
+// See https://github.com/salesforce/ja3 and https://github.com/FoxIO-LLC/ja4.
+//
+
+import (
+	"crypto/md5" // #nosec G501 - JA3 is defined in terms of MD5
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// tlsAddFingerprints stops the given recorder and adds the raw ClientHello as well as
+// the JA3, JA3S, JA4, and JA4S fingerprints to the given handshake result.
+func tlsAddFingerprints(hs *model.ArchivalTLSOrQUICHandshakeResult, hellos *tlsHelloRecorder) {
+	clientHello, serverHello := hellos.stop()
+	if clientHello != nil {
+		hs.ClientHello = clientHello
+		if hello, err := tlsParseClientHello(clientHello); err == nil {
+			hs.JA3 = tlsComputeJA3(hello)
+			hs.JA4 = tlsComputeJA4(hello)
+		}
+	}
+	if serverHello != nil {
+		if hello, err := tlsParseServerHello(serverHello); err == nil {
+			hs.JA3S = tlsComputeJA3S(hello)
+			hs.JA4S = tlsComputeJA4S(hello)
+		}
+	}
+}
+
+// tlsIsGREASE returns whether the given value is a GREASE value (RFC 8701).
+func tlsIsGREASE(value uint16) bool {
+	return value&0x0f0f == 0x0a0a && value>>8 == value&0xff
+}
+
+// tlsFilterGREASE returns a copy of the given values without GREASE values.
+func tlsFilterGREASE(values []uint16) (out []uint16) {
+	for _, value := range values {
+		if !tlsIsGREASE(value) {
+			out = append(out, value)
+		}
+	}
+	return
+}
+
+// tlsJoinDecimal joins the given values using their decimal representation.
+func tlsJoinDecimal[T uint8 | uint16](values []T) string {
+	var out []string
+	for _, value := range values {
+		out = append(out, strconv.Itoa(int(value)))
+	}
+	return strings.Join(out, "-")
+}
+
+// tlsJoinHex joins the given values using their four digits hex representation.
+func tlsJoinHex(values []uint16) string {
+	var out []string
+	for _, value := range values {
+		out = append(out, fmt.Sprintf("%04x", value))
+	}
+	return strings.Join(out, ",")
+}
+
+// tlsComputeJA3 computes the JA3 fingerprint of the given ClientHello.
+func tlsComputeJA3(hello *tlsHello) string {
+	text := strings.Join([]string{
+		strconv.Itoa(int(hello.Version)),
+		tlsJoinDecimal(tlsFilterGREASE(hello.CipherSuites)),
+		tlsJoinDecimal(tlsFilterGREASE(hello.Extensions)),
+		tlsJoinDecimal(tlsFilterGREASE(hello.SupportedGroups)),
+		tlsJoinDecimal(hello.PointFormats),
+	}, ",")
+	digest := md5.Sum([]byte(text)) // #nosec G401 - JA3 is defined in terms of MD5
+	return hex.EncodeToString(digest[:])
+}
+
+// tlsComputeJA3S computes the JA3S fingerprint of the given ServerHello.
+func tlsComputeJA3S(hello *tlsHello) string {
+	text := strings.Join([]string{
+		strconv.Itoa(int(hello.Version)),
+		tlsJoinDecimal(hello.CipherSuites),
+		tlsJoinDecimal(hello.Extensions),
+	}, ",")
+	digest := md5.Sum([]byte(text)) // #nosec G401 - JA3S is defined in terms of MD5
+	return hex.EncodeToString(digest[:])
+}
+
+// tlsJA4Version returns the JA4 representation of the highest TLS version.
+func tlsJA4Version(hello *tlsHello) string {
+	version := hello.Version
+	if versions := tlsFilterGREASE(hello.SupportedVersions); len(versions) > 0 {
+		version = versions[0]
+		for _, entry := range versions {
+			version = max(version, entry)
+		}
+	}
+	switch version {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	default:
+		return "00"
+	}
+}
+
+// tlsJA4Count returns the JA4 two digits representation of a count.
+func tlsJA4Count(count int) string {
+	return fmt.Sprintf("%02d", min(count, 99))
+}
+
+// tlsJA4ALPN returns the JA4 representation of the first ALPN protocol.
+func tlsJA4ALPN(hello *tlsHello) string {
+	if len(hello.ALPN) <= 0 || len(hello.ALPN[0]) <= 0 {
+		return "00"
+	}
+	proto := hello.ALPN[0]
+	first, last := proto[0], proto[len(proto)-1]
+	if !tlsIsAlphanumeric(first) || !tlsIsAlphanumeric(last) {
+		encoded := hex.EncodeToString([]byte(proto))
+		return encoded[:1] + encoded[len(encoded)-1:]
+	}
+	return string([]byte{first, last})
+}
+
+// tlsIsAlphanumeric returns whether the given byte is an ASCII letter or digit.
+func tlsIsAlphanumeric(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+// tlsJA4Hash returns the first twelve hex digits of the SHA256 of the given text
+// or twelve zeroes when the text is empty.
+func tlsJA4Hash(text string) string {
+	if text == "" {
+		return "000000000000"
+	}
+	digest := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(digest[:])[:12]
+}
+
+// tlsSortedCopy returns a sorted copy of the given values.
+func tlsSortedCopy(values []uint16) []uint16 {
+	out := append([]uint16{}, values...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// tlsComputeJA4 computes the JA4 fingerprint of the given ClientHello sent over TCP.
+func tlsComputeJA4(hello *tlsHello) string {
+	ciphers := tlsFilterGREASE(hello.CipherSuites)
+	extensions := tlsFilterGREASE(hello.Extensions)
+
+	sni := "i"
+	var hashedExtensions []uint16
+	for _, ext := range extensions {
+		switch ext {
+		case tlsExtensionServerName:
+			sni = "d"
+		case tlsExtensionALPN:
+			// nothing
+		default:
+			hashedExtensions = append(hashedExtensions, ext)
+		}
+	}
+
+	partA := "t" + tlsJA4Version(hello) + sni + tlsJA4Count(len(ciphers)) +
+		tlsJA4Count(len(extensions)) + tlsJA4ALPN(hello)
+
+	partB := tlsJA4Hash(tlsJoinHex(tlsSortedCopy(ciphers)))
+
+	partC := tlsJoinHex(tlsSortedCopy(hashedExtensions))
+	if sigalgs := tlsFilterGREASE(hello.SignatureAlgorithms); partC != "" && len(sigalgs) > 0 {
+		partC += "_" + tlsJoinHex(sigalgs)
+	}
+
+	return partA + "_" + partB + "_" + tlsJA4Hash(partC)
+}
+
+// tlsComputeJA4S computes the JA4S fingerprint of the given ServerHello sent over TCP.
+func tlsComputeJA4S(hello *tlsHello) string {
+	partA := "t" + tlsJA4Version(hello) + tlsJA4Count(len(hello.Extensions)) + tlsJA4ALPN(hello)
+	partB := tlsJoinHex(hello.CipherSuites)
+	partC := tlsJA4Hash(tlsJoinHex(hello.Extensions))
+	return partA + "_" + partB + "_" + partC
+}
@@ -0,0 +1,195 @@
+package measurexlite
+
+import (
+	"testing"
+
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+func TestTLSComputeJA3(t *testing.T) {
+	// See https://github.com/salesforce/ja3
+	hello := &tlsHello{
+		CipherSuites:    []uint16{0x0a0a, 47, 53, 5, 10, 49161, 49162, 49171, 49172, 50, 56, 19, 4},
+		Extensions:      []uint16{0x1a1a, 0, 10, 11},
+		PointFormats:    []uint8{0},
+		SupportedGroups: []uint16{0x2a2a, 23, 24, 25},
+		Version:         769,
+	}
+	if got := tlsComputeJA3(hello); got != "ada70206e40642a3e4461f35503241d5" {
+		t.Fatal("unexpected JA3", got)
+	}
+}
+
+func TestTLSComputeJA3S(t *testing.T) {
+	hello := &tlsHello{
+		CipherSuites: []uint16{47},
+		Extensions:   []uint16{65281, 0, 11, 35, 16},
+		Version:      769,
+	}
+	if got := tlsComputeJA3S(hello); got != "359a4ac4ef6cebad2239afcd55718b24" {
+		t.Fatal("unexpected JA3S", got)
+	}
+}
+
+func TestTLSComputeJA4(t *testing.T) {
+	// See https://github.com/FoxIO-LLC/ja4/blob/main/technical_details/JA4.md
+	newHello := func() *tlsHello {
+		return &tlsHello{
+			ALPN: []string{"h2", "http/1.1"},
+			CipherSuites: []uint16{
+				0x3a3a, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9,
+				0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035,
+			},
+			Extensions: []uint16{
+				0x4a4a, 0x001b, 0x0000, 0x0033, 0x0010, 0x4469, 0x0017, 0x002d, 0x000d,
+				0x0005, 0x0023, 0x0012, 0x002b, 0xff01, 0x000b, 0x000a, 0x0015, 0x5a5a,
+			},
+			SignatureAlgorithms: []uint16{
+				0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601,
+			},
+			SupportedVersions: []uint16{0x6a6a, 0x0304, 0x0303},
+			Version:           0x0303,
+		}
+	}
+
+	t.Run("with a typical Chrome ClientHello", func(t *testing.T) {
+		got := tlsComputeJA4(newHello())
+		if got != "t13d1516h2_8daaf6152771_e5627efa2ab1" {
+			t.Fatal("unexpected JA4", got)
+		}
+	})
+
+	t.Run("without SNI and ALPN", func(t *testing.T) {
+		hello := newHello()
+		hello.ALPN = nil
+		var extensions []uint16
+		for _, ext := range hello.Extensions {
+			if ext != tlsExtensionServerName && ext != tlsExtensionALPN {
+				extensions = append(extensions, ext)
+			}
+		}
+		hello.Extensions = extensions
+		got := tlsComputeJA4(hello)
+		if got != "t13i151400_8daaf6152771_e5627efa2ab1" {
+			t.Fatal("unexpected JA4", got)
+		}
+	})
+
+	t.Run("without extensions", func(t *testing.T) {
+		hello := &tlsHello{
+			CipherSuites: []uint16{0x002f},
+			Version:      0x0301,
+		}
+		got := tlsComputeJA4(hello)
+		if got != "t10i010000_"+tlsJA4Hash("002f")+"_000000000000" {
+			t.Fatal("unexpected JA4", got)
+		}
+	})
+}
+
+func TestTLSComputeJA4S(t *testing.T) {
+	// See https://github.com/FoxIO-LLC/ja4/blob/main/technical_details/JA4S.md
+	hello := &tlsHello{
+		CipherSuites:      []uint16{0x1301},
+		Extensions:        []uint16{0x0033, 0x002b},
+		SupportedVersions: []uint16{0x0304},
+		Version:           0x0303,
+	}
+	if got := tlsComputeJA4S(hello); got != "t130200_1301_234ea6891581" {
+		t.Fatal("unexpected JA4S", got)
+	}
+}
+
+func TestTLSJA4ALPN(t *testing.T) {
+	tests := []struct {
+		name string
+		alpn []string
+		want string
+	}{{
+		name: "with no ALPN",
+		alpn: nil,
+		want: "00",
+	}, {
+		name: "with an empty ALPN",
+		alpn: []string{""},
+		want: "00",
+	}, {
+		name: "with a single character ALPN",
+		alpn: []string{"h"},
+		want: "hh",
+	}, {
+		name: "with http/1.1",
+		alpn: []string{"http/1.1"},
+		want: "h1",
+	}, {
+		name: "with a non alphanumeric ALPN",
+		alpn: []string{"\xab\xcd"},
+		want: "ad",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tlsJA4ALPN(&tlsHello{ALPN: tt.alpn}); got != tt.want {
+				t.Fatal("expected", tt.want, "got", got)
+			}
+		})
+	}
+}
+
+func TestTLSJA4Version(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  uint16
+		versions []uint16
+		want     string
+	}{{
+		name:     "with supported versions",
+		version:  0x0303,
+		versions: []uint16{0x7a7a, 0x0303, 0x0304},
+		want:     "13",
+	}, {
+		name:    "with TLS 1.2",
+		version: 0x0303,
+		want:    "12",
+	}, {
+		name:    "with TLS 1.1",
+		version: 0x0302,
+		want:    "11",
+	}, {
+		name:    "with SSL 3.0",
+		version: 0x0300,
+		want:    "s3",
+	}, {
+		name:    "with SSL 2.0",
+		version: 0x0002,
+		want:    "s2",
+	}, {
+		name:    "with an unknown version",
+		version: 0x1234,
+		want:    "00",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hello := &tlsHello{Version: tt.version, SupportedVersions: tt.versions}
+			if got := tlsJA4Version(hello); got != tt.want {
+				t.Fatal("expected", tt.want, "got", got)
+			}
+		})
+	}
+}
+
+func TestTLSAddFingerprints(t *testing.T) {
+	t.Run("with invalid hello messages", func(t *testing.T) {
+		hellos := &tlsHelloRecorder{
+			clientHello: []byte{tlsHandshakeTypeClientHello, 0, 0, 0},
+			serverHello: []byte{tlsHandshakeTypeServerHello, 0, 0, 0},
+		}
+		hs := &model.ArchivalTLSOrQUICHandshakeResult{}
+		tlsAddFingerprints(hs, hellos)
+		if len(hs.ClientHello) != 4 {
+			t.Fatal("expected to see the raw ClientHello")
+		}
+		if hs.JA3 != "" || hs.JA4 != "" || hs.JA3S != "" || hs.JA4S != "" {
+			t.Fatal("expected no fingerprints")
+		}
+	})
+}
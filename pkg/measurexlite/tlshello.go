@@ -0,0 +1,352 @@
+package measurexlite
+
+//
+// Recording and parsing the TLS ClientHello and ServerHello
+//
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// tlsHelloRecorderMaxBytes is the maximum number of bytes we buffer in each
+// direction while waiting for the ClientHello or the ServerHello.
+const tlsHelloRecorderMaxBytes = 1 << 16
+
+// tlsHelloRecorder records the ClientHello and the ServerHello exchanged
+// over a [net.Conn] wrapped using the wrap method.
+//
+// The zero value is ready to use.
+type tlsHelloRecorder struct {
+	clientHello []byte
+	clientRaw   []byte
+	mu          sync.Mutex
+	serverHello []byte
+	serverRaw   []byte
+	stopped     bool
+}
+
+// wrap wraps the given conn such that we record the hello messages.
+func (r *tlsHelloRecorder) wrap(conn net.Conn) net.Conn {
+	return &tlsHelloRecorderConn{Conn: conn, r: r}
+}
+
+// stop stops recording and returns the ClientHello and the ServerHello we have
+// recorded so far. Either of the returned values MAY be nil.
+func (r *tlsHelloRecorder) stop() (clientHello, serverHello []byte) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	r.stopped = true
+	r.clientRaw, r.serverRaw = nil, nil
+	return r.clientHello, r.serverHello
+}
+
+// onWrite is called when we write data to the conn.
+func (r *tlsHelloRecorder) onWrite(data []byte) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	if r.stopped || r.clientHello != nil {
+		return
+	}
+	r.clientRaw, r.clientHello = tlsHelloRecorderAppend(r.clientRaw, data, tlsHandshakeTypeClientHello)
+}
+
+// onRead is called when we read data from the conn.
+func (r *tlsHelloRecorder) onRead(data []byte) {
+	defer r.mu.Unlock()
+	r.mu.Lock()
+	if r.stopped || r.serverHello != nil {
+		return
+	}
+	r.serverRaw, r.serverHello = tlsHelloRecorderAppend(r.serverRaw, data, tlsHandshakeTypeServerHello)
+}
+
+// tlsHelloRecorderAppend appends data to the raw bytes and attempts to extract a handshake
+// message with the given type. It returns the updated raw bytes and the message, if found.
+func tlsHelloRecorderAppend(raw, data []byte, msgType uint8) ([]byte, []byte) {
+	if len(raw)+len(data) > tlsHelloRecorderMaxBytes {
+		return raw, nil
+	}
+	raw = append(raw, data...)
+	msg, err := tlsExtractHandshakeMessage(raw, msgType)
+	if err != nil {
+		return raw, nil
+	}
+	return nil, msg
+}
+
+// tlsHelloRecorderConn is the [net.Conn] returned by [*tlsHelloRecorder.wrap].
+type tlsHelloRecorderConn struct {
+	net.Conn
+	r *tlsHelloRecorder
+}
+
+// Read implements net.Conn.
+func (c *tlsHelloRecorderConn) Read(buffer []byte) (int, error) {
+	count, err := c.Conn.Read(buffer)
+	if count > 0 {
+		c.r.onRead(buffer[:count])
+	}
+	return count, err
+}
+
+// Write implements net.Conn.
+func (c *tlsHelloRecorderConn) Write(data []byte) (int, error) {
+	c.r.onWrite(data)
+	return c.Conn.Write(data)
+}
+
+const (
+	// tlsRecordTypeHandshake is the TLS record type for handshake messages.
+	tlsRecordTypeHandshake = 22
+
+	// tlsHandshakeTypeClientHello is the TLS handshake type for the ClientHello.
+	tlsHandshakeTypeClientHello = 1
+
+	// tlsHandshakeTypeServerHello is the TLS handshake type for the ServerHello.
+	tlsHandshakeTypeServerHello = 2
+)
+
+var (
+	// errTLSHandshakeMessageIncomplete indicates we need more data to extract the message.
+	errTLSHandshakeMessageIncomplete = errors.New("tls: incomplete handshake message")
+
+	// errTLSHandshakeMessageUnexpected indicates we found an unexpected record or message.
+	errTLSHandshakeMessageUnexpected = errors.New("tls: unexpected record or handshake message")
+)
+
+// tlsExtractHandshakeMessage extracts the first handshake message from the given TLS records,
+// reassembling it when it spans multiple records, and checks whether it has the given type.
+func tlsExtractHandshakeMessage(records []byte, msgType uint8) ([]byte, error) {
+	var payload []byte
+	input := cryptobyte.String(records)
+	for !input.Empty() {
+		var (
+			recordType uint8
+			version    uint16
+			fragment   cryptobyte.String
+		)
+		if !input.ReadUint8(&recordType) || !input.ReadUint16(&version) ||
+			!input.ReadUint16LengthPrefixed(&fragment) {
+			return nil, errTLSHandshakeMessageIncomplete
+		}
+		if recordType != tlsRecordTypeHandshake {
+			return nil, errTLSHandshakeMessageUnexpected
+		}
+		payload = append(payload, fragment...)
+		if len(payload) < 4 {
+			continue
+		}
+		if payload[0] != msgType {
+			return nil, errTLSHandshakeMessageUnexpected
+		}
+		length := 4 + (int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3]))
+		if len(payload) >= length {
+			return payload[:length], nil
+		}
+	}
+	return nil, errTLSHandshakeMessageIncomplete
+}
+
+// tlsHello contains the fields of a ClientHello or ServerHello we need
+// for computing the JA3, JA3S, JA4, and JA4S fingerprints.
+type tlsHello struct {
+	// ALPN contains the ALPN protocols.
+	ALPN []string
+
+	// CipherSuites contains the offered (or selected) cipher suites.
+	CipherSuites []uint16
+
+	// Extensions contains the extension types in order of appearance.
+	Extensions []uint16
+
+	// PointFormats contains the EC point formats.
+	PointFormats []uint8
+
+	// SignatureAlgorithms contains the signature algorithms in order of appearance.
+	SignatureAlgorithms []uint16
+
+	// SupportedGroups contains the supported groups.
+	SupportedGroups []uint16
+
+	// SupportedVersions contains the supported (or selected) versions.
+	SupportedVersions []uint16
+
+	// Version is the legacy_version field.
+	Version uint16
+}
+
+// errTLSHelloInvalid indicates that we could not parse a ClientHello or ServerHello.
+var errTLSHelloInvalid = errors.New("tls: invalid hello message")
+
+// tlsParseClientHello parses a ClientHello handshake message including its header.
+func tlsParseClientHello(msg []byte) (*tlsHello, error) {
+	var (
+		body         cryptobyte.String
+		msgType      uint8
+		random       []byte
+		sessionID    cryptobyte.String
+		cipherSuites cryptobyte.String
+		compression  cryptobyte.String
+	)
+	hello := &tlsHello{}
+	input := cryptobyte.String(msg)
+	if !input.ReadUint8(&msgType) || msgType != tlsHandshakeTypeClientHello ||
+		!input.ReadUint24LengthPrefixed(&body) ||
+		!body.ReadUint16(&hello.Version) ||
+		!body.ReadBytes(&random, 32) ||
+		!body.ReadUint8LengthPrefixed(&sessionID) ||
+		!body.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!body.ReadUint8LengthPrefixed(&compression) {
+		return nil, errTLSHelloInvalid
+	}
+	for !cipherSuites.Empty() {
+		var suite uint16
+		if !cipherSuites.ReadUint16(&suite) {
+			return nil, errTLSHelloInvalid
+		}
+		hello.CipherSuites = append(hello.CipherSuites, suite)
+	}
+	if err := tlsParseHelloExtensions(&body, hello, tlsHandshakeTypeClientHello); err != nil {
+		return nil, err
+	}
+	return hello, nil
+}
+
+// tlsParseServerHello parses a ServerHello handshake message including its header.
+func tlsParseServerHello(msg []byte) (*tlsHello, error) {
+	var (
+		body        cryptobyte.String
+		msgType     uint8
+		random      []byte
+		sessionID   cryptobyte.String
+		suite       uint16
+		compression uint8
+	)
+	hello := &tlsHello{}
+	input := cryptobyte.String(msg)
+	if !input.ReadUint8(&msgType) || msgType != tlsHandshakeTypeServerHello ||
+		!input.ReadUint24LengthPrefixed(&body) ||
+		!body.ReadUint16(&hello.Version) ||
+		!body.ReadBytes(&random, 32) ||
+		!body.ReadUint8LengthPrefixed(&sessionID) ||
+		!body.ReadUint16(&suite) ||
+		!body.ReadUint8(&compression) {
+		return nil, errTLSHelloInvalid
+	}
+	hello.CipherSuites = []uint16{suite}
+	if err := tlsParseHelloExtensions(&body, hello, tlsHandshakeTypeServerHello); err != nil {
+		return nil, err
+	}
+	return hello, nil
+}
+
+// These are the TLS extensions we need to parse.
+const (
+	tlsExtensionServerName          = 0x0000
+	tlsExtensionSupportedGroups     = 0x000a
+	tlsExtensionPointFormats        = 0x000b
+	tlsExtensionSignatureAlgorithms = 0x000d
+	tlsExtensionALPN                = 0x0010
+	tlsExtensionSupportedVersions   = 0x002b
+)
+
+// tlsParseHelloExtensions parses the extensions of a ClientHello or ServerHello.
+func tlsParseHelloExtensions(body *cryptobyte.String, hello *tlsHello, msgType uint8) error {
+	if body.Empty() {
+		return nil // extensions are optional
+	}
+	var extensions cryptobyte.String
+	if !body.ReadUint16LengthPrefixed(&extensions) || !body.Empty() {
+		return errTLSHelloInvalid
+	}
+	for !extensions.Empty() {
+		var (
+			extType uint16
+			extData cryptobyte.String
+		)
+		if !extensions.ReadUint16(&extType) || !extensions.ReadUint16LengthPrefixed(&extData) {
+			return errTLSHelloInvalid
+		}
+		hello.Extensions = append(hello.Extensions, extType)
+		if !tlsParseHelloExtension(extType, extData, hello, msgType) {
+			return errTLSHelloInvalid
+		}
+	}
+	return nil
+}
+
+// tlsParseHelloExtension parses the content of a single extension and
+// returns false in case the extension content is invalid.
+func tlsParseHelloExtension(extType uint16, data cryptobyte.String, hello *tlsHello, msgType uint8) bool {
+	switch extType {
+	case tlsExtensionSupportedGroups:
+		var list cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&list) {
+			return false
+		}
+		return tlsReadUint16List(list, &hello.SupportedGroups)
+
+	case tlsExtensionPointFormats:
+		var list cryptobyte.String
+		if !data.ReadUint8LengthPrefixed(&list) {
+			return false
+		}
+		hello.PointFormats = append(hello.PointFormats, list...)
+		return true
+
+	case tlsExtensionSignatureAlgorithms:
+		var list cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&list) {
+			return false
+		}
+		return tlsReadUint16List(list, &hello.SignatureAlgorithms)
+
+	case tlsExtensionALPN:
+		var list cryptobyte.String
+		if !data.ReadUint16LengthPrefixed(&list) {
+			return false
+		}
+		for !list.Empty() {
+			var proto cryptobyte.String
+			if !list.ReadUint8LengthPrefixed(&proto) {
+				return false
+			}
+			hello.ALPN = append(hello.ALPN, string(proto))
+		}
+		return true
+
+	case tlsExtensionSupportedVersions:
+		if msgType == tlsHandshakeTypeServerHello {
+			var version uint16
+			if !data.ReadUint16(&version) {
+				return false
+			}
+			hello.SupportedVersions = []uint16{version}
+			return true
+		}
+		var list cryptobyte.String
+		if !data.ReadUint8LengthPrefixed(&list) {
+			return false
+		}
+		return tlsReadUint16List(list, &hello.SupportedVersions)
+
+	default:
+		return true
+	}
+}
+
+// tlsReadUint16List reads a list of uint16 values and appends them to out.
+func tlsReadUint16List(list cryptobyte.String, out *[]uint16) bool {
+	for !list.Empty() {
+		var value uint16
+		if !list.ReadUint16(&value) {
+			return false
+		}
+		*out = append(*out, value)
+	}
+	return true
+}
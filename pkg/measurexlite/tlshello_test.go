@@ -0,0 +1,208 @@
+package measurexlite
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/mocks"
+)
+
+// tlsNewRecord returns a TLS record with the given type and fragment.
+func tlsNewRecord(recordType uint8, fragment []byte) []byte {
+	return append([]byte{recordType, 0x03, 0x01, byte(len(fragment) >> 8), byte(len(fragment))}, fragment...)
+}
+
+// tlsNewHandshakeMessage returns a handshake message with the given type and body.
+func tlsNewHandshakeMessage(msgType uint8, body []byte) []byte {
+	return append([]byte{msgType, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+func TestTLSExtractHandshakeMessage(t *testing.T) {
+	message := tlsNewHandshakeMessage(tlsHandshakeTypeClientHello, bytes.Repeat([]byte{7}, 64))
+
+	tests := []struct {
+		name    string
+		records []byte
+		msgType uint8
+		want    []byte
+		wantErr error
+	}{{
+		name:    "with no data",
+		records: nil,
+		msgType: tlsHandshakeTypeClientHello,
+		want:    nil,
+		wantErr: errTLSHandshakeMessageIncomplete,
+	}, {
+		name:    "with a single record",
+		records: tlsNewRecord(tlsRecordTypeHandshake, message),
+		msgType: tlsHandshakeTypeClientHello,
+		want:    message,
+		wantErr: nil,
+	}, {
+		name: "with a message spanning multiple records",
+		records: append(
+			tlsNewRecord(tlsRecordTypeHandshake, message[:2]),
+			append(
+				tlsNewRecord(tlsRecordTypeHandshake, message[2:30]),
+				tlsNewRecord(tlsRecordTypeHandshake, message[30:])...,
+			)...,
+		),
+		msgType: tlsHandshakeTypeClientHello,
+		want:    message,
+		wantErr: nil,
+	}, {
+		name:    "with a truncated record",
+		records: tlsNewRecord(tlsRecordTypeHandshake, message)[:40],
+		msgType: tlsHandshakeTypeClientHello,
+		want:    nil,
+		wantErr: errTLSHandshakeMessageIncomplete,
+	}, {
+		name:    "with a truncated message",
+		records: tlsNewRecord(tlsRecordTypeHandshake, message[:40]),
+		msgType: tlsHandshakeTypeClientHello,
+		want:    nil,
+		wantErr: errTLSHandshakeMessageIncomplete,
+	}, {
+		name:    "with an alert record",
+		records: tlsNewRecord(21, []byte{2, 40}),
+		msgType: tlsHandshakeTypeServerHello,
+		want:    nil,
+		wantErr: errTLSHandshakeMessageUnexpected,
+	}, {
+		name:    "with an unexpected handshake message",
+		records: tlsNewRecord(tlsRecordTypeHandshake, message),
+		msgType: tlsHandshakeTypeServerHello,
+		want:    nil,
+		wantErr: errTLSHandshakeMessageUnexpected,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tlsExtractHandshakeMessage(tt.records, tt.msgType)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatal("unexpected error", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestTLSHelloRecorder(t *testing.T) {
+	clientHello := tlsNewHandshakeMessage(tlsHandshakeTypeClientHello, bytes.Repeat([]byte{1}, 32))
+	serverHello := tlsNewHandshakeMessage(tlsHandshakeTypeServerHello, bytes.Repeat([]byte{2}, 32))
+	serverRecord := tlsNewRecord(tlsRecordTypeHandshake, serverHello)
+
+	t.Run("we record the hello messages", func(t *testing.T) {
+		hellos := &tlsHelloRecorder{}
+		reader := bytes.NewReader(serverRecord)
+		conn := hellos.wrap(&mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				// read at most 7 bytes at a time to exercise reassembly
+				return reader.Read(b[:min(len(b), 7)])
+			},
+			MockWrite: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+		})
+		clientRecord := tlsNewRecord(tlsRecordTypeHandshake, clientHello)
+		if _, err := conn.Write(clientRecord[:10]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write(clientRecord[10:]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(conn); err != nil {
+			t.Fatal(err)
+		}
+		gotClient, gotServer := hellos.stop()
+		if diff := cmp.Diff(clientHello, gotClient); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff(serverHello, gotServer); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we stop recording after stop", func(t *testing.T) {
+		hellos := &tlsHelloRecorder{}
+		conn := hellos.wrap(&mocks.Conn{
+			MockWrite: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+		})
+		hellos.stop()
+		if _, err := conn.Write(tlsNewRecord(tlsRecordTypeHandshake, clientHello)); err != nil {
+			t.Fatal(err)
+		}
+		if gotClient, _ := hellos.stop(); gotClient != nil {
+			t.Fatal("expected nil ClientHello")
+		}
+	})
+
+	t.Run("we give up after too much data", func(t *testing.T) {
+		hellos := &tlsHelloRecorder{}
+		conn := hellos.wrap(&mocks.Conn{
+			MockWrite: func(b []byte) (int, error) {
+				return len(b), nil
+			},
+		})
+		if _, err := conn.Write(make([]byte, tlsHelloRecorderMaxBytes)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write(tlsNewRecord(tlsRecordTypeHandshake, clientHello)); err != nil {
+			t.Fatal(err)
+		}
+		if gotClient, _ := hellos.stop(); gotClient != nil {
+			t.Fatal("expected nil ClientHello")
+		}
+	})
+}
+
+func TestTLSParseHello(t *testing.T) {
+	t.Run("tlsParseClientHello fails with a ServerHello", func(t *testing.T) {
+		msg := tlsNewHandshakeMessage(tlsHandshakeTypeServerHello, make([]byte, 38))
+		if _, err := tlsParseClientHello(msg); !errors.Is(err, errTLSHelloInvalid) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("tlsParseServerHello fails with a ClientHello", func(t *testing.T) {
+		msg := tlsNewHandshakeMessage(tlsHandshakeTypeClientHello, make([]byte, 38))
+		if _, err := tlsParseServerHello(msg); !errors.Is(err, errTLSHelloInvalid) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("tlsParseServerHello works without extensions", func(t *testing.T) {
+		body := append([]byte{0x03, 0x03}, make([]byte, 32)...) // version and random
+		body = append(body, 0)                                  // empty session ID
+		body = append(body, 0x00, 0x2f)                         // cipher suite
+		body = append(body, 0)                                  // compression
+		hello, err := tlsParseServerHello(tlsNewHandshakeMessage(tlsHandshakeTypeServerHello, body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hello.Version != 0x0303 || len(hello.CipherSuites) != 1 || hello.CipherSuites[0] != 0x002f {
+			t.Fatal("unexpected ServerHello", hello)
+		}
+		if len(hello.Extensions) != 0 {
+			t.Fatal("expected no extensions")
+		}
+	})
+
+	t.Run("tlsParseServerHello fails with truncated extensions", func(t *testing.T) {
+		body := append([]byte{0x03, 0x03}, make([]byte, 32)...) // version and random
+		body = append(body, 0)                                  // empty session ID
+		body = append(body, 0x00, 0x2f)                         // cipher suite
+		body = append(body, 0)                                  // compression
+		body = append(body, 0x00, 0x04, 0)                      // truncated extensions
+		_, err := tlsParseServerHello(tlsNewHandshakeMessage(tlsHandshakeTypeServerHello, body))
+		if !errors.Is(err, errTLSHelloInvalid) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
@@ -33,6 +33,11 @@ type Trace struct {
 	// sure you do that before you start measuring to avoid data races.
 	Netx model.MeasuringNetwork
 
+	// TLSFingerprints OPTIONALLY enables recording the raw ClientHello and computing
+	// the JA3, JA3S, JA4, and JA4S fingerprints of TLS handshakes over TCP. Make
+	// sure you set this field before you start measuring to avoid data races.
+	TLSFingerprints bool
+
 	// bytesReceivedMap maps a remote host with the bytes we received
 	// from such a remote host. Accessing this map requires one to
 	// additionally hold the bytesReceivedMu mutex.
@@ -109,6 +114,7 @@ func NewTrace(index int64, zeroTime time.Time, tags ...string) *Trace {
 	return &Trace{
 		index:            index,
 		Netx:             &netxlite.Netx{Underlying: nil}, // use the host network
+		TLSFingerprints:  false,
 		bytesReceivedMap: make(map[string]int64),
 		bytesReceivedMu:  &sync.Mutex{},
 		dnsLookup: make(
@@ -204,6 +204,23 @@ func TestTrace(t *testing.T) {
 		}
 	})
 
+	t.Run("NewParallelUDPResolverWithCollectWindow works as intended", func(t *testing.T) {
+		tx := NewTrace(0, time.Now())
+		netx := &netxlite.Netx{}
+		dialer := netx.NewDialerWithoutResolver(model.DiscardLogger)
+		resolver := tx.NewParallelUDPResolverWithCollectWindow(
+			model.DiscardLogger, dialer, "1.1.1.1:53", time.Second)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		addrs, err := resolver.LookupHost(ctx, "example.com")
+		if err == nil || err.Error() != netxlite.FailureInterrupted {
+			t.Fatal("unexpected err", err)
+		}
+		if len(addrs) != 0 {
+			t.Fatal("expected array of size 0")
+		}
+	})
+
 	t.Run("NewParallelDNSOverHTTPSResolver works as intended", func(t *testing.T) {
 		tx := NewTrace(0, time.Now())
 		resolver := tx.NewParallelDNSOverHTTPSResolver(model.DiscardLogger, "https://dns.google.com")
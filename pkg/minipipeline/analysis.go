@@ -108,6 +108,8 @@ func AnalyzeWebObservationsWithoutLinearAnalysis(
 	analysis.dnsComputeSuccessMetrics(lookupper, container)
 	analysis.dnsComputeSuccessMetricsClassic(lookupper, container)
 	analysis.dnsComputeFailureMetrics(container)
+	analysis.dnsComputeDNSSECMetrics(container)
+	analysis.dnsComputeInjectionMetrics(container)
 
 	analysis.tcpComputeMetrics(container)
 	analysis.tlsComputeMetrics(container)
@@ -156,6 +158,15 @@ type WebAnalysis struct {
 	// DNSLookupSuccessWithValidAddressClassic contains DNS transactions with valid IP addresses.
 	DNSLookupSuccessWithValidAddressClassic Set[int64]
 
+	// DNSLookupDNSSECBogus contains DNS transactions whose response failed DNSSEC
+	// validation, which is a strong signal that someone tampered with the response.
+	DNSLookupDNSSECBogus Set[int64]
+
+	// DNSLookupInjectionSuspected contains DNS transactions for which we received late or
+	// duplicate responses resolving addresses different from the ones in the first response,
+	// which is a strong signal that an on-path attacker injected a response.
+	DNSLookupInjectionSuspected Set[int64]
+
 	// DNSLookupUnexpectedFailure contains DNS transactions with unexpected failures.
 	DNSLookupUnexpectedFailure Set[int64]
 
@@ -228,6 +239,17 @@ type WebAnalysis struct {
 	// while checking for connectivity, as opposed to fetching a webpage.
 	TLSHandshakeUnexplainedFailureDuringConnectivityCheck Set[int64]
 
+	// TLSHandshakeCertificateMismatch contains TLS endpoint transactions where both the
+	// probe and the control succeeded but saw different leaf certificates. This could
+	// be legitimate (e.g., CDNs rotating certificates) or a MITM attempt.
+	TLSHandshakeCertificateMismatch Set[int64]
+
+	// TLSHandshakeIssuerMismatch contains TLS endpoint transactions where both the probe
+	// and the control succeeded but saw leaf certificates signed by different issuers. This
+	// is only a weak hint of a MITM, since CDNs and large services legitimately use several
+	// CAs depending on the region or the client, so we MUST NOT use it to compute verdicts.
+	TLSHandshakeIssuerMismatch Set[int64]
+
 	// HTTPRoundTripUnexpectedFailure contains HTTP endpoint transactions with unexpected failures.
 	HTTPRoundTripUnexpectedFailure Set[int64]
 
@@ -405,6 +427,13 @@ func (wa *WebAnalysis) dnsComputeFailureMetrics(c *WebObservationsContainer) {
 			continue
 		}
 
+		// skip HTTPS queries, which most domains do not have and for which the
+		// control does not provide information, because the A and AAAA queries
+		// already tell us whether there's DNS interference for the domain
+		if utilsDNSQueryTypeIsHTTPS(obs) {
+			continue
+		}
+
 		// TODO(bassosimone): if we set an IPv6 address as the resolver address, we
 		// end up with false positive errors when there's no IPv6 support
 
@@ -473,6 +502,31 @@ func (wa *WebAnalysis) dnsComputeFailureMetrics(c *WebObservationsContainer) {
 	}
 }
 
+func (wa *WebAnalysis) dnsComputeDNSSECMetrics(c *WebObservationsContainer) {
+	// Implementation note: a bogus response may either be a forged NXDOMAIN or a forged
+	// answer, hence we need to walk through both failures and successes.
+	for _, obs := range append(append([]*WebObservation{}, c.DNSLookupFailures...), c.DNSLookupSuccesses...) {
+		if obs.DNSSECStatus.UnwrapOr("") == model.DNSSECStatusBogus {
+			wa.DNSLookupDNSSECBogus.Add(obs.DNSTransactionID.Unwrap())
+		}
+	}
+}
+
+func (wa *WebAnalysis) dnsComputeInjectionMetrics(c *WebObservationsContainer) {
+	// Implementation note: the injected response may arrive first and cause either a
+	// failure or a success, hence we need to walk through both failures and successes.
+	for _, obs := range append(append([]*WebObservation{}, c.DNSLookupFailures...), c.DNSLookupSuccesses...) {
+		if obs.DNSDuplicateResolvedAddrs.IsNone() {
+			continue
+		}
+		duplicates := obs.DNSDuplicateResolvedAddrs.Unwrap()
+		addrs := obs.DNSResolvedAddrs.UnwrapOr(Set[string]{})
+		if !utilsSetsEqual(addrs, duplicates) {
+			wa.DNSLookupInjectionSuspected.Add(obs.DNSTransactionID.Unwrap())
+		}
+	}
+}
+
 func (wa *WebAnalysis) tcpComputeMetrics(c *WebObservationsContainer) {
 	for _, obs := range c.KnownTCPEndpoints {
 		// handle the case where there is no measurement
@@ -589,6 +643,22 @@ func (wa *WebAnalysis) tlsComputeMetrics(c *WebObservationsContainer) {
 			wa.TLSHandshakeUnexpectedFailure.Add(obs.EndpointTransactionID.Unwrap())
 			continue
 		}
+
+		// handle the case where both succeed by comparing the leaf certificates
+		wa.tlsCompareLeafCertificates(obs)
+	}
+}
+
+// tlsCompareLeafCertificates compares the leaf certificates seen by the probe and
+// by the control, when both are available, to flag differences worth investigating.
+func (wa *WebAnalysis) tlsCompareLeafCertificates(obs *WebObservation) {
+	if !obs.TLSLeafCertificateFingerprint.IsNone() && !obs.ControlTLSLeafCertificateFingerprint.IsNone() &&
+		obs.TLSLeafCertificateFingerprint.Unwrap() != obs.ControlTLSLeafCertificateFingerprint.Unwrap() {
+		wa.TLSHandshakeCertificateMismatch.Add(obs.EndpointTransactionID.Unwrap())
+	}
+	if !obs.TLSLeafCertificateIssuer.IsNone() && !obs.ControlTLSLeafCertificateIssuer.IsNone() &&
+		obs.TLSLeafCertificateIssuer.Unwrap() != obs.ControlTLSLeafCertificateIssuer.Unwrap() {
+		wa.TLSHandshakeIssuerMismatch.Add(obs.EndpointTransactionID.Unwrap())
 	}
 }
 
@@ -669,6 +739,19 @@ func (wa *WebAnalysis) httpHandleFinalResponse(obs *WebObservation) {
 	wa.httpDiffTitleDifferentLongWords(obs)
 }
 
+// httpControlResponses returns the HTTP responses seen by the control, starting with the
+// primary response and followed by the responses seen from additional vantage points. When
+// computing the HTTPDiff metrics, we use the response most similar to the probe's one.
+func httpControlResponses(obs *WebObservation) []*WebObservationControlHTTPResponse {
+	out := []*WebObservationControlHTTPResponse{{
+		StatusCode:  obs.ControlHTTPResponseStatusCode.UnwrapOr(0),
+		BodyLength:  obs.ControlHTTPResponseBodyLength.UnwrapOr(0),
+		HeadersKeys: obs.ControlHTTPResponseHeadersKeys.UnwrapOr(nil),
+		Title:       obs.ControlHTTPResponseTitle.UnwrapOr(""),
+	}}
+	return append(out, obs.ControlHTTPVantageResponses.UnwrapOr(nil)...)
+}
+
 // httpDiffBodyProportionFactor computes the body proportion factor.
 //
 // The return value--used for testing--is zero on success and negative in case of failure.
@@ -687,15 +770,25 @@ func (wa *WebAnalysis) httpDiffBodyProportionFactor(obs *WebObservation) int64 {
 		return -3
 	}
 
+	// compute the largest body proportion factor using valid control body lengths
+	state := optional.None[float64]()
+	for _, control := range httpControlResponses(obs) {
+		if control.BodyLength <= 0 {
+			continue
+		}
+		proportion := ComputeHTTPDiffBodyProportionFactor(measurement, control.BodyLength)
+		if state.IsNone() || proportion > state.Unwrap() {
+			state = optional.Some(proportion)
+		}
+	}
+
 	// we also need a valid control body length
-	control := obs.ControlHTTPResponseBodyLength.UnwrapOr(0)
-	if control <= 0 {
+	if state.IsNone() {
 		return -4
 	}
 
-	// compute the body proportion factor and update the state
-	proportion := ComputeHTTPDiffBodyProportionFactor(measurement, control)
-	wa.HTTPFinalResponseDiffBodyProportionFactor = optional.Some(proportion)
+	// update the state
+	wa.HTTPFinalResponseDiffBodyProportionFactor = state
 	return 0
 }
 
@@ -713,13 +806,29 @@ func (wa *WebAnalysis) httpDiffStatusCodeMatch(obs *WebObservation) int64 {
 	if measurement <= 0 {
 		return -2
 	}
-	control := obs.ControlHTTPResponseStatusCode.UnwrapOr(0)
-	if control <= 0 {
+
+	// prefer a match with any control over a mismatch and a mismatch over no comparison
+	var (
+		found bool
+		state = optional.None[bool]()
+	)
+	for _, control := range httpControlResponses(obs) {
+		if control.StatusCode <= 0 {
+			continue
+		}
+		found = true
+		if match := ComputeHTTPDiffStatusCodeMatch(measurement, control.StatusCode); !match.IsNone() {
+			if match.Unwrap() || state.IsNone() {
+				state = match
+			}
+		}
+	}
+	if !found {
 		return -3
 	}
 
 	// update state
-	wa.HTTPFinalResponseDiffStatusCodeMatch = ComputeHTTPDiffStatusCodeMatch(measurement, control)
+	wa.HTTPFinalResponseDiffStatusCodeMatch = state
 	return 0
 }
 
@@ -732,20 +841,28 @@ func (wa *WebAnalysis) httpDiffUncommonHeadersIntersection(obs *WebObservation)
 		return -1
 	}
 
-	// We should only perform the comparison if we have valid control data. Because
-	// the headers could legitimately be empty, let's use the status code here.
-	if obs.ControlHTTPResponseStatusCode.UnwrapOr(0) <= 0 {
-		return -2
-	}
-
 	// Implementation note: here we need to continue running when either
 	// headers are empty in order to produce an empty intersection. If we'd stop
 	// after noticing that either dictionary is empty, we'd produce a nil
 	// analysis result, which causes QA differences with v0.4.
 	measurement := obs.HTTPResponseHeadersKeys.UnwrapOr(nil)
-	control := obs.ControlHTTPResponseHeadersKeys.UnwrapOr(nil)
 
-	state := ComputeHTTPDiffUncommonHeadersIntersection(measurement, control)
+	// keep the largest intersection with a control response
+	var state map[string]bool
+	for _, control := range httpControlResponses(obs) {
+		// We should only perform the comparison if we have valid control data. Because
+		// the headers could legitimately be empty, let's use the status code here.
+		if control.StatusCode <= 0 {
+			continue
+		}
+		if current := ComputeHTTPDiffUncommonHeadersIntersection(measurement, control.HeadersKeys); state == nil || len(current) > len(state) {
+			state = current
+		}
+	}
+	if state == nil {
+		return -2
+	}
+
 	wa.HTTPFinalResponseDiffUncommonHeadersIntersection = optional.Some(state)
 	return int64(len(state))
 }
@@ -759,16 +876,23 @@ func (wa *WebAnalysis) httpDiffTitleDifferentLongWords(obs *WebObservation) int6
 		return -1
 	}
 
-	// We should only perform the comparison if we have valid control data. Because
-	// the title could legitimately be empty, let's use the status code here.
-	if obs.ControlHTTPResponseStatusCode.UnwrapOr(0) <= 0 {
-		return -2
-	}
-
 	measurement := obs.HTTPResponseTitle.UnwrapOr("")
-	control := obs.ControlHTTPResponseTitle.UnwrapOr("")
 
-	state := ComputeHTTPDiffTitleDifferentLongWords(measurement, control)
+	// keep the fewest different long words with a control response
+	var state map[string]bool
+	for _, control := range httpControlResponses(obs) {
+		// We should only perform the comparison if we have valid control data. Because
+		// the title could legitimately be empty, let's use the status code here.
+		if control.StatusCode <= 0 {
+			continue
+		}
+		if current := ComputeHTTPDiffTitleDifferentLongWords(measurement, control.Title); state == nil || len(current) < len(state) {
+			state = current
+		}
+	}
+	if state == nil {
+		return -2
+	}
 
 	wa.HTTPFinalResponseDiffTitleDifferentLongWords = optional.Some(state)
 	return int64(len(state))
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/model"
 	"github.com/ooni/probe-engine/pkg/optional"
 )
 
@@ -482,3 +483,316 @@ func TestHTTPDiffTitleDifferentLongWords(t *testing.T) {
 		})
 	}
 }
+
+func TestWebAnalysisDNSSECMetrics(t *testing.T) {
+	failure := "dns_nxdomain_error"
+	container := NewWebObservationsContainer()
+	container.IngestDNSLookupEvents(
+		model.GeoIPASNLookupperFunc(func(ip string) (uint, string, error) {
+			return 0, "", nil
+		}),
+		&model.ArchivalDNSLookupResult{
+			Answers: []model.ArchivalDNSAnswer{{
+				AnswerType: "A",
+				IPv4:       "93.184.216.34",
+			}},
+			DNSSECStatus:  model.DNSSECStatusSecure,
+			Engine:        "udp",
+			Hostname:      "example.com",
+			QueryType:     "A",
+			TransactionID: 1,
+		},
+		&model.ArchivalDNSLookupResult{
+			Answers: []model.ArchivalDNSAnswer{{
+				AnswerType: "A",
+				IPv4:       "10.10.34.35",
+			}},
+			DNSSECStatus:  model.DNSSECStatusBogus,
+			Engine:        "udp",
+			Hostname:      "example.com",
+			QueryType:     "A",
+			TransactionID: 2,
+		},
+		&model.ArchivalDNSLookupResult{
+			DNSSECStatus:  model.DNSSECStatusBogus,
+			Engine:        "udp",
+			Failure:       &failure,
+			Hostname:      "example.com",
+			QueryType:     "AAAA",
+			TransactionID: 3,
+		},
+		&model.ArchivalDNSLookupResult{
+			Engine:        "getaddrinfo",
+			Failure:       &failure,
+			Hostname:      "example.com",
+			QueryType:     "ANY",
+			TransactionID: 4,
+		},
+	)
+
+	if status := container.DNSLookupFailures[0].DNSSECStatus.UnwrapOr(""); status != model.DNSSECStatusBogus {
+		t.Fatal("unexpected DNSSEC status", status)
+	}
+	if !container.DNSLookupFailures[1].DNSSECStatus.IsNone() {
+		t.Fatal("expected no DNSSEC status")
+	}
+
+	analysis := AnalyzeWebObservationsWithoutLinearAnalysis(
+		model.GeoIPASNLookupperFunc(func(ip string) (uint, string, error) {
+			return 0, "", nil
+		}),
+		container,
+	)
+	if diff := cmp.Diff([]int64{2, 3}, analysis.DNSLookupDNSSECBogus.Keys()); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestWebAnalysisDNSComputeFailureMetricsSkipsHTTPSQueries(t *testing.T) {
+	container := NewWebObservationsContainer()
+	container.DNSLookupFailures = append(container.DNSLookupFailures, &WebObservation{
+		DNSTransactionID:        optional.Some(int64(1)),
+		DNSLookupFailure:        optional.Some("dns_nxdomain_error"),
+		DNSQueryType:            optional.Some("HTTPS"),
+		DNSEngine:               optional.Some("udp"),
+		TagDepth:                optional.Some(int64(0)),
+		ControlDNSLookupFailure: optional.Some(""),
+	})
+	analysis := &WebAnalysis{}
+	analysis.dnsComputeFailureMetrics(container)
+	if analysis.DNSLookupUnexpectedFailure.Len() != 0 {
+		t.Fatal("expected no unexpected failures")
+	}
+	if !analysis.DNSExperimentFailure.IsNone() {
+		t.Fatal("expected no DNS experiment failure")
+	}
+}
+
+func TestWebAnalysisDNSInjectionMetrics(t *testing.T) {
+	failure := "dns_nxdomain_error"
+	container := NewWebObservationsContainer()
+	container.IngestDNSLookupEvents(
+		model.GeoIPASNLookupperFunc(func(ip string) (uint, string, error) {
+			return 0, "", nil
+		}),
+		&model.ArchivalDNSLookupResult{
+			Answers: []model.ArchivalDNSAnswer{{
+				AnswerType: "A",
+				IPv4:       "93.184.216.34",
+			}},
+			Engine:        "udp",
+			Hostname:      "example.com",
+			QueryType:     "A",
+			TransactionID: 1,
+		},
+		&model.ArchivalDNSLookupResult{
+			Answers: []model.ArchivalDNSAnswer{{
+				AnswerType: "A",
+				IPv4:       "10.10.34.35",
+			}},
+			Engine:        "udp",
+			Hostname:      "example.com",
+			QueryType:     "A",
+			TransactionID: 2,
+		},
+		&model.ArchivalDNSLookupResult{
+			Engine:        "udp",
+			Failure:       &failure,
+			Hostname:      "example.com",
+			QueryType:     "A",
+			TransactionID: 3,
+		},
+		&model.ArchivalDNSLookupResult{
+			Engine:        "udp",
+			Failure:       &failure,
+			Hostname:      "example.com",
+			QueryType:     "AAAA",
+			TransactionID: 4,
+		},
+	)
+	container.IngestDNSDuplicateResponses(
+		// same addresses as the first response
+		&model.ArchivalDNSLookupResult{
+			Answers: []model.ArchivalDNSAnswer{{
+				AnswerType: "A",
+				IPv4:       "93.184.216.34",
+			}},
+			Engine:        "udp",
+			Hostname:      "example.com",
+			QueryType:     "A",
+			TransactionID: 1,
+		},
+		// different addresses than the first response
+		&model.ArchivalDNSLookupResult{
+			Answers: []model.ArchivalDNSAnswer{{
+				AnswerType: "A",
+				IPv4:       "93.184.216.34",
+			}},
+			Engine:        "udp",
+			Hostname:      "example.com",
+			QueryType:     "A",
+			TransactionID: 2,
+		},
+		// addresses after a failure
+		&model.ArchivalDNSLookupResult{
+			Answers: []model.ArchivalDNSAnswer{{
+				AnswerType: "A",
+				IPv4:       "93.184.216.34",
+			}},
+			Engine:        "udp",
+			Hostname:      "example.com",
+			QueryType:     "A",
+			TransactionID: 3,
+		},
+		// a duplicate without addresses
+		&model.ArchivalDNSLookupResult{
+			Engine:        "udp",
+			Failure:       &failure,
+			Hostname:      "example.com",
+			QueryType:     "AAAA",
+			TransactionID: 4,
+		},
+	)
+
+	if addrs := container.DNSLookupSuccesses[1].DNSDuplicateResolvedAddrs.UnwrapOr(Set[string]{}); addrs.Len() != 1 {
+		t.Fatal("unexpected duplicate addresses", addrs)
+	}
+	if !container.DNSLookupFailures[1].DNSDuplicateResolvedAddrs.IsNone() {
+		t.Fatal("expected no duplicate addresses")
+	}
+
+	analysis := AnalyzeWebObservationsWithoutLinearAnalysis(
+		model.GeoIPASNLookupperFunc(func(ip string) (uint, string, error) {
+			return 0, "", nil
+		}),
+		container,
+	)
+	if diff := cmp.Diff([]int64{2, 3}, analysis.DNSLookupInjectionSuspected.Keys()); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestWebAnalysisTLSLeafCertificateMetrics(t *testing.T) {
+	type testcase struct {
+		name                 string
+		obs                  *WebObservation
+		expectCertMismatch   []int64
+		expectIssuerMismatch []int64
+	}
+
+	newObs := func(fingerprint, issuer, controlFingerprint, controlIssuer optional.Value[string]) *WebObservation {
+		return &WebObservation{
+			EndpointTransactionID:                optional.Some(int64(1)),
+			TagDepth:                             optional.Some(int64(0)),
+			TLSHandshakeFailure:                  optional.Some(""),
+			TLSLeafCertificateFingerprint:        fingerprint,
+			TLSLeafCertificateIssuer:             issuer,
+			ControlTLSHandshakeFailure:           optional.Some(""),
+			ControlTLSLeafCertificateFingerprint: controlFingerprint,
+			ControlTLSLeafCertificateIssuer:      controlIssuer,
+		}
+	}
+
+	cases := []testcase{{
+		name: "when the certificates are the same",
+		obs: newObs(
+			optional.Some("deadbeef"), optional.Some("CN=jafar"),
+			optional.Some("deadbeef"), optional.Some("CN=jafar"),
+		),
+		expectCertMismatch:   []int64{},
+		expectIssuerMismatch: []int64{},
+	}, {
+		name: "when only the certificates differ",
+		obs: newObs(
+			optional.Some("deadbeef"), optional.Some("CN=jafar"),
+			optional.Some("abad1dea"), optional.Some("CN=jafar"),
+		),
+		expectCertMismatch:   []int64{1},
+		expectIssuerMismatch: []int64{},
+	}, {
+		name: "when both the certificates and the issuers differ",
+		obs: newObs(
+			optional.Some("deadbeef"), optional.Some("CN=jafar"),
+			optional.Some("abad1dea"), optional.Some("CN=iago"),
+		),
+		expectCertMismatch:   []int64{1},
+		expectIssuerMismatch: []int64{1},
+	}, {
+		name: "when the control does not provide certificate details",
+		obs: newObs(
+			optional.Some("deadbeef"), optional.Some("CN=jafar"),
+			optional.None[string](), optional.None[string](),
+		),
+		expectCertMismatch:   []int64{},
+		expectIssuerMismatch: []int64{},
+	}, {
+		name: "when the probe does not provide certificate details",
+		obs: newObs(
+			optional.None[string](), optional.None[string](),
+			optional.Some("abad1dea"), optional.Some("CN=iago"),
+		),
+		expectCertMismatch:   []int64{},
+		expectIssuerMismatch: []int64{},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			container := NewWebObservationsContainer()
+			container.KnownTCPEndpoints[1] = tc.obs
+			analysis := &WebAnalysis{}
+			analysis.tlsComputeMetrics(container)
+			if diff := cmp.Diff(tc.expectCertMismatch, analysis.TLSHandshakeCertificateMismatch.Keys()); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(tc.expectIssuerMismatch, analysis.TLSHandshakeIssuerMismatch.Keys()); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
+
+func TestWebAnalysisHTTPDiffWithVantages(t *testing.T) {
+	// the primary control saw a localized page while a vantage point saw the same page as the probe
+	obs := &WebObservation{
+		HTTPResponseIsFinal:            optional.Some(true),
+		HTTPResponseBodyIsTruncated:    optional.Some(false),
+		HTTPResponseBodyLength:         optional.Some(int64(1000)),
+		HTTPResponseStatusCode:         optional.Some(int64(200)),
+		HTTPResponseHeadersKeys:        optional.Some(map[string]bool{"X-Antani": true}),
+		HTTPResponseTitle:              optional.Some("Antani Mascetti Melandri"),
+		ControlHTTPResponseStatusCode:  optional.Some(int64(302)),
+		ControlHTTPResponseBodyLength:  optional.Some(int64(100)),
+		ControlHTTPResponseHeadersKeys: optional.Some(map[string]bool{}),
+		ControlHTTPResponseTitle:       optional.Some("Localized"),
+		ControlHTTPVantageResponses: optional.Some([]*WebObservationControlHTTPResponse{{
+			StatusCode:  404,
+			BodyLength:  10,
+			HeadersKeys: map[string]bool{},
+			Title:       "",
+		}, {
+			StatusCode:  200,
+			BodyLength:  990,
+			HeadersKeys: map[string]bool{"X-Antani": true},
+			Title:       "Antani Mascetti Melandri",
+		}}),
+	}
+
+	wa := &WebAnalysis{}
+	wa.httpDiffBodyProportionFactor(obs)
+	wa.httpDiffStatusCodeMatch(obs)
+	wa.httpDiffUncommonHeadersIntersection(obs)
+	wa.httpDiffTitleDifferentLongWords(obs)
+
+	if diff := cmp.Diff(0.99, wa.HTTPFinalResponseDiffBodyProportionFactor.UnwrapOr(0)); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(true, wa.HTTPFinalResponseDiffStatusCodeMatch.UnwrapOr(false)); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(map[string]bool{"x-antani": true}, wa.HTTPFinalResponseDiffUncommonHeadersIntersection.UnwrapOr(nil)); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(map[string]bool{}, wa.HTTPFinalResponseDiffTitleDifferentLongWords.UnwrapOr(nil)); diff != "" {
+		t.Fatal(diff)
+	}
+}
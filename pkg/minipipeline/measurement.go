@@ -44,4 +44,7 @@ type WebMeasurementTestKeys struct {
 
 	// XControlRequest contains the OPTIONAL TH request.
 	XControlRequest optional.Value[*model.THRequest] `json:"x_control_request"`
+
+	// XDNSDuplicateResponses contains the OPTIONAL late or duplicate DNS responses.
+	XDNSDuplicateResponses []*model.ArchivalDNSLookupResult `json:"x_dns_duplicate_responses"`
 }
@@ -1,6 +1,9 @@
 package minipipeline
 
 import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"net"
 	"net/url"
@@ -30,6 +33,7 @@ func IngestWebMeasurement(lookupper model.GeoIPASNLookupper, meas *WebMeasuremen
 
 	container := NewWebObservationsContainer()
 	container.IngestDNSLookupEvents(lookupper, tk.Queries...)
+	container.IngestDNSDuplicateResponses(tk.XDNSDuplicateResponses...)
 	container.IngestTCPConnectEvents(lookupper, tk.TCPConnect...)
 	container.IngestTLSHandshakeEvents(tk.TLSHandshakes...)
 	container.IngestHTTPRoundTripEvents(tk.Requests...)
@@ -143,6 +147,14 @@ type WebObservation struct {
 	// DNSResolvedAddrs contains the list of DNS-resolved addrs.
 	DNSResolvedAddrs optional.Value[Set[string]]
 
+	// DNSSECStatus is the DNSSEC validation status (e.g., "bogus"), which is only
+	// available when the measurement used a DNSSEC validating resolver.
+	DNSSECStatus optional.Value[string]
+
+	// DNSDuplicateResolvedAddrs contains the addresses resolved by late or duplicate
+	// responses to the same DNS query, which is only available when we received them.
+	DNSDuplicateResolvedAddrs optional.Value[Set[string]]
+
 	// The following fields are optional.Some in these cases:
 	//
 	// 1. when you process successful DNS lookup events from OONI measurements;
@@ -196,6 +208,13 @@ type WebObservation struct {
 	// TLSServerName is the optional TLS server name used by the TLS handshake.
 	TLSServerName optional.Value[string]
 
+	// TLSLeafCertificateFingerprint is the optional hex-encoded SHA-256 of the
+	// leaf certificate returned by the server during the TLS handshake.
+	TLSLeafCertificateFingerprint optional.Value[string]
+
+	// TLSLeafCertificateIssuer is the optional issuer of the leaf certificate.
+	TLSLeafCertificateIssuer optional.Value[string]
+
 	// The following fields are optional.Some when you process the HTTP round
 	// trip events contained inside an OONI measurement:
 
@@ -246,6 +265,14 @@ type WebObservation struct {
 	// ControlTLSHandshakeFailure is the control's TLS handshake failure.
 	ControlTLSHandshakeFailure optional.Value[string]
 
+	// ControlTLSLeafCertificateFingerprint is the fingerprint of the leaf certificate
+	// seen by the control, which is only available with recent test helpers.
+	ControlTLSLeafCertificateFingerprint optional.Value[string]
+
+	// ControlTLSLeafCertificateIssuer is the issuer of the leaf certificate seen
+	// by the control, which is only available with recent test helpers.
+	ControlTLSLeafCertificateIssuer optional.Value[string]
+
 	// ControlHTTPFailure is the HTTP failure seen by the control.
 	ControlHTTPFailure optional.Value[string]
 
@@ -260,6 +287,27 @@ type WebObservation struct {
 
 	// ControlHTTPResponseTitle contains the title seen by the control.
 	ControlHTTPResponseTitle optional.Value[string]
+
+	// ControlHTTPVantageResponses contains the successful HTTP responses seen by the
+	// control from additional vantage points, which are only available with recent test
+	// helpers. We consider the probe's final response consistent with the control if
+	// it is consistent with either the primary response or any of these responses.
+	ControlHTTPVantageResponses optional.Value[[]*WebObservationControlHTTPResponse]
+}
+
+// WebObservationControlHTTPResponse is an HTTP response seen by the control.
+type WebObservationControlHTTPResponse struct {
+	// StatusCode is the status code.
+	StatusCode int64
+
+	// BodyLength is the body length.
+	BodyLength int64
+
+	// HeadersKeys contains the response headers keys.
+	HeadersKeys map[string]bool
+
+	// Title is the title.
+	Title string
 }
 
 // WebObservationsControlExpectations summarizes the expectations based on the control.
@@ -336,6 +384,7 @@ func (c *WebObservationsContainer) ingestDNSLookupFailures(evs ...*model.Archiva
 			DNSLookupFailure: failure,
 			DNSQueryType:     optional.Some(ev.QueryType),
 			DNSEngine:        optional.Some(ev.Engine),
+			DNSSECStatus:     utilsDNSSECStatus(ev.DNSSECStatus),
 			TagDepth:         utilsExtractTagDepth(ev.Tags),
 		}
 
@@ -366,6 +415,7 @@ func (c *WebObservationsContainer) ingestDNSLookupSuccesses(
 				DNSQueryType:     optional.Some(ev.QueryType),
 				DNSEngine:        optional.Some(ev.Engine),
 				DNSResolvedAddrs: optional.Some(addrs),
+				DNSSECStatus:     utilsDNSSECStatus(ev.DNSSECStatus),
 				IPAddressOrigin:  optional.Some(IPAddressOriginDNS),
 				IPAddress:        optional.Some(ipAddr),
 				IPAddressASN:     utilsGeoipxLookupASN(lookupper, ipAddr),
@@ -384,6 +434,40 @@ func (c *WebObservationsContainer) ingestDNSLookupSuccesses(
 	}
 }
 
+// IngestDNSDuplicateResponses ingests late or duplicate DNS responses from a OONI measurement. You
+// MUST ingest these events after DNS lookup events. We match each late or duplicate response with
+// the DNS lookup observations having the same transaction ID and query type.
+func (c *WebObservationsContainer) IngestDNSDuplicateResponses(evs ...*model.ArchivalDNSLookupResult) {
+	// collect the addresses resolved by each transaction and query type
+	type dnsQueryKey struct {
+		TransactionID int64
+		QueryType     string
+	}
+	duplicates := map[dnsQueryKey]Set[string]{}
+	for _, ev := range evs {
+		// skip all the responses without any address
+		addrs := utilsResolvedAddresses(ev.Answers)
+		if len(addrs) <= 0 {
+			continue
+		}
+		key := dnsQueryKey{TransactionID: ev.TransactionID, QueryType: ev.QueryType}
+		set := duplicates[key]
+		set.Add(addrs...)
+		duplicates[key] = set
+	}
+
+	// attach the addresses to the corresponding DNS lookup observations
+	for _, obs := range append(append([]*WebObservation{}, c.DNSLookupFailures...), c.DNSLookupSuccesses...) {
+		key := dnsQueryKey{
+			TransactionID: obs.DNSTransactionID.UnwrapOr(0),
+			QueryType:     obs.DNSQueryType.UnwrapOr(""),
+		}
+		if set, found := duplicates[key]; found {
+			obs.DNSDuplicateResolvedAddrs = optional.Some(set)
+		}
+	}
+}
+
 // IngestTCPConnectEvents ingests TCP connect events from a OONI measurement. You MUST ingest
 // these events after DNS events and before any other kind of events.
 func (c *WebObservationsContainer) IngestTCPConnectEvents(
@@ -448,6 +532,16 @@ func (c *WebObservationsContainer) IngestTLSHandshakeEvents(evs ...*model.Archiv
 		obs.Failure = failure
 		obs.TLSHandshakeFailure = failure
 		obs.TLSServerName = optional.Some(ev.ServerName)
+
+		// the first peer certificate, if any, is the leaf certificate
+		if len(ev.PeerCertificates) > 0 {
+			leaf := ev.PeerCertificates[0]
+			digest := sha256.Sum256(leaf)
+			obs.TLSLeafCertificateFingerprint = optional.Some(hex.EncodeToString(digest[:]))
+			if cert, err := x509.ParseCertificate(leaf); err == nil {
+				obs.TLSLeafCertificateIssuer = optional.Some(cert.Issuer.String())
+			}
+		}
 	}
 }
 
@@ -492,15 +586,74 @@ func (c *WebObservationsContainer) IngestControlMessages(req *model.THRequest, r
 	}
 	inputDomain := URL.Hostname()
 
+	resp, vantages := controlMergeVantages(resp)
+
 	c.controlXrefDNSQueries(inputDomain, resp)
 	c.controlMatchDNSLookupResults(inputDomain, resp)
 	c.controlXrefTCPIPFailures(resp)
 	c.controlXrefTLSFailures(resp)
-	c.controlSetHTTPFinalResponseExpectation(resp)
+	c.controlSetHTTPFinalResponseExpectation(resp, vantages)
 
 	return nil
 }
 
+// controlMergeVantages accounts for the results measured by the control from additional
+// vantage points, if any, such that a probe result is consistent with the control when it
+// matches any vantage point. To this end, we return a copy of resp where:
+//
+// 1. the DNS lookup succeeds if any vantage point succeeded and the resolved addresses
+// are the union of the addresses resolved by all the successful vantage points;
+//
+// 2. the HTTP result is the one of the first successful vantage point when the primary
+// control's HTTP request failed.
+//
+// We also return the other successful HTTP responses, if any.
+func controlMergeVantages(resp *model.THResponse) (*model.THResponse, []*WebObservationControlHTTPResponse) {
+	if len(resp.Vantages) <= 0 {
+		return resp, nil
+	}
+	merged := *resp
+
+	// merge the successful DNS lookup results
+	dnsAddrs := NewSet[string]()
+	dnsResults := []model.THDNSResult{resp.DNS}
+	for _, vantage := range resp.Vantages {
+		dnsResults = append(dnsResults, vantage.DNS)
+	}
+	for _, result := range dnsResults {
+		if result.Failure != nil {
+			continue
+		}
+		if merged.DNS.Failure != nil {
+			merged.DNS = model.THDNSResult{Failure: nil, Addrs: []string{}, ASNs: []int64{}}
+		}
+		dnsAddrs.Add(result.Addrs...)
+	}
+	if merged.DNS.Failure == nil {
+		merged.DNS.Addrs = dnsAddrs.Keys()
+	}
+
+	// use a successful HTTP result as the primary one and collect the others
+	var httpResponses []*WebObservationControlHTTPResponse
+	for _, vantage := range resp.Vantages {
+		if vantage.HTTPRequest.Failure != nil {
+			continue
+		}
+		if merged.HTTPRequest.Failure != nil {
+			merged.HTTPRequest = vantage.HTTPRequest
+			continue
+		}
+		httpResponses = append(httpResponses, &WebObservationControlHTTPResponse{
+			StatusCode:  vantage.HTTPRequest.StatusCode,
+			BodyLength:  vantage.HTTPRequest.BodyLength,
+			HeadersKeys: utilsExtractHTTPHeaderKeys(vantage.HTTPRequest.Headers).UnwrapOr(nil),
+			Title:       vantage.HTTPRequest.Title,
+		})
+	}
+
+	return &merged, httpResponses
+}
+
 func (c *WebObservationsContainer) controlXrefDNSQueries(inputDomain string, resp *model.THResponse) {
 	var observations []*WebObservation
 	observations = append(observations, c.DNSLookupFailures...)
@@ -609,10 +762,19 @@ func (c *WebObservationsContainer) controlXrefTLSFailures(resp *model.THResponse
 
 		// save the corresponding control result
 		obs.ControlTLSHandshakeFailure = optional.Some(utilsStringPointerToString(tls.Failure))
+
+		// save the leaf certificate details, which old test helpers do not provide
+		if tls.LeafCertificateFingerprint != "" {
+			obs.ControlTLSLeafCertificateFingerprint = optional.Some(tls.LeafCertificateFingerprint)
+		}
+		if tls.LeafCertificateIssuer != "" {
+			obs.ControlTLSLeafCertificateIssuer = optional.Some(tls.LeafCertificateIssuer)
+		}
 	}
 }
 
-func (c *WebObservationsContainer) controlSetHTTPFinalResponseExpectation(resp *model.THResponse) {
+func (c *WebObservationsContainer) controlSetHTTPFinalResponseExpectation(
+	resp *model.THResponse, vantages []*WebObservationControlHTTPResponse) {
 	// We need to set expectations for each type of observation. For example, to detect
 	// NXDOMAIN blocking with redirects when there's the expectation of success, we need
 	// to have the expectation inside the DNS-lookup-failure observation.
@@ -644,5 +806,8 @@ func (c *WebObservationsContainer) controlSetHTTPFinalResponseExpectation(resp *
 		obs.ControlHTTPResponseBodyLength = optional.Some(resp.HTTPRequest.BodyLength)
 		obs.ControlHTTPResponseHeadersKeys = utilsExtractHTTPHeaderKeys(resp.HTTPRequest.Headers)
 		obs.ControlHTTPResponseTitle = optional.Some(resp.HTTPRequest.Title)
+		if len(vantages) > 0 {
+			obs.ControlHTTPVantageResponses = optional.Some(vantages)
+		}
 	}
 }
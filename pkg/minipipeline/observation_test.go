@@ -1,10 +1,14 @@
 package minipipeline
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/netem"
 	"github.com/ooni/probe-engine/pkg/geoipx"
 	"github.com/ooni/probe-engine/pkg/model"
 	"github.com/ooni/probe-engine/pkg/netxlite"
@@ -90,6 +94,33 @@ func TestWebObservationsContainerIngestTLSHandshakeEvents(t *testing.T) {
 			t.Fatal("the number of known TCP endpoints should not have changed")
 		}
 	})
+
+	t.Run("we extract the leaf certificate details", func(t *testing.T) {
+		ca := netem.MustNewCA()
+		cert := ca.MustNewTLSCertificate("www.example.com")
+		leaf := cert.Certificate[0]
+
+		obs := &WebObservation{}
+		container := &WebObservationsContainer{
+			DNSLookupFailures: []*WebObservation{},
+			KnownTCPEndpoints: map[int64]*WebObservation{1: obs},
+			knownIPAddresses:  map[string]*WebObservation{},
+		}
+
+		container.IngestTLSHandshakeEvents(&model.ArchivalTLSOrQUICHandshakeResult{
+			PeerCertificates: []model.ArchivalBinaryData{leaf, ca.CACert().Raw},
+			ServerName:       "www.example.com",
+			TransactionID:    1,
+		})
+
+		digest := sha256.Sum256(leaf)
+		if diff := cmp.Diff(hex.EncodeToString(digest[:]), obs.TLSLeafCertificateFingerprint.UnwrapOr("")); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff(ca.CACert().Subject.String(), obs.TLSLeafCertificateIssuer.UnwrapOr("")); diff != "" {
+			t.Fatal(diff)
+		}
+	})
 }
 
 func TestWebObservationsContainerIngestHTTPRoundTripEvents(t *testing.T) {
@@ -210,4 +241,91 @@ func TestWebObservationsContainerIngestControlMessages(t *testing.T) {
 			t.Fatal("ControlDNSResolvedAddrs should be none")
 		}
 	})
+
+	t.Run("we merge the results of additional vantage points", func(t *testing.T) {
+		container := NewWebObservationsContainer()
+		container.KnownTCPEndpoints[1] = &WebObservation{
+			DNSDomain:             optional.Some("www.example.com"),
+			IPAddress:             optional.Some("93.184.216.34"),
+			EndpointTransactionID: optional.Some(int64(1)),
+			EndpointPort:          optional.Some("443"),
+			EndpointAddress:       optional.Some("93.184.216.34:443"),
+		}
+
+		thRequest := &model.THRequest{
+			HTTPRequest: "https://www.example.com/",
+			XVantages:   true,
+		}
+
+		failure := netxlite.FailureGenericTimeoutError
+		thResponse := &model.THResponse{
+			DNS: model.THDNSResult{
+				Failure: &failure,
+				Addrs:   []string{},
+				ASNs:    []int64{},
+			},
+			HTTPRequest: model.THHTTPRequestResult{
+				Failure: &failure,
+			},
+			Vantages: []model.THVantageResult{{
+				Name: "de",
+				DNS: model.THDNSResult{
+					Addrs: []string{"93.184.216.34"},
+				},
+				HTTPRequest: model.THHTTPRequestResult{
+					StatusCode: 200,
+					Title:      "Example Domain",
+				},
+			}, {
+				Name: "us",
+				DNS: model.THDNSResult{
+					Addrs: []string{"93.184.215.14"},
+				},
+				HTTPRequest: model.THHTTPRequestResult{
+					StatusCode: 200,
+					Title:      "Example Domain (US)",
+				},
+			}, {
+				Name: "jp",
+				DNS: model.THDNSResult{
+					Failure: &failure,
+				},
+				HTTPRequest: model.THHTTPRequestResult{
+					Failure: &failure,
+				},
+			}},
+		}
+
+		if err := container.IngestControlMessages(thRequest, thResponse); err != nil {
+			t.Fatal(err)
+		}
+
+		entry := container.KnownTCPEndpoints[1]
+
+		if diff := cmp.Diff("", entry.ControlDNSLookupFailure.UnwrapOr("<none>")); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff([]string{"93.184.215.14", "93.184.216.34"}, entry.ControlDNSResolvedAddrs.Unwrap().Keys()); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff("", entry.ControlHTTPFailure.UnwrapOr("<none>")); diff != "" {
+			t.Fatal(diff)
+		}
+		if diff := cmp.Diff("Example Domain", entry.ControlHTTPResponseTitle.UnwrapOr("")); diff != "" {
+			t.Fatal(diff)
+		}
+		expectVantages := []*WebObservationControlHTTPResponse{{
+			StatusCode:  200,
+			HeadersKeys: map[string]bool{},
+			Title:       "Example Domain (US)",
+		}}
+		if diff := cmp.Diff(expectVantages, entry.ControlHTTPVantageResponses.UnwrapOr(nil)); diff != "" {
+			t.Fatal(diff)
+		}
+
+		// make sure we did not modify the original response
+		if thResponse.DNS.Failure == nil || thResponse.HTTPRequest.Failure == nil {
+			t.Fatal("we should not modify the original response")
+		}
+	})
 }
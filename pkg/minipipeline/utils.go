@@ -49,6 +49,25 @@ func utilsDetermineWhetherHTTPResponseIsFinal(status int64) optional.Value[bool]
 	}
 }
 
+func utilsDNSSECStatus(status string) optional.Value[string] {
+	if status != "" {
+		return optional.Some(status)
+	}
+	return optional.None[string]()
+}
+
+func utilsSetsEqual[T ~string | ~int64](left, right Set[T]) bool {
+	if left.Len() != right.Len() {
+		return false
+	}
+	for _, key := range left.Keys() {
+		if !right.Contains(key) {
+			return false
+		}
+	}
+	return true
+}
+
 func utilsResolvedAddresses(answers []model.ArchivalDNSAnswer) (addrs []string) {
 	for _, ans := range answers {
 		// extract the IP address we resolved
@@ -106,6 +125,10 @@ func utilsDNSLookupFailureIsDNSNoAnswerForAAAA(obs *WebObservation) bool {
 		obs.DNSLookupFailure.UnwrapOr("") == netxlite.FailureDNSNoAnswer
 }
 
+func utilsDNSQueryTypeIsHTTPS(obs *WebObservation) bool {
+	return obs.DNSQueryType.UnwrapOr("") == "HTTPS"
+}
+
 func utilsDNSEngineIsDNSOverHTTPS(obs *WebObservation) bool {
 	return obs.DNSEngine.UnwrapOr("") == "doh"
 }
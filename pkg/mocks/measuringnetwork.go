@@ -1,6 +1,8 @@
 package mocks
 
 import (
+	"time"
+
 	"github.com/ooni/probe-engine/pkg/model"
 	utls "gitlab.com/yawning/utls.git"
 )
@@ -11,8 +13,19 @@ type MeasuringNetwork struct {
 
 	MockNewParallelDNSOverHTTPSResolver func(logger model.DebugLogger, URL string) model.Resolver
 
+	MockNewParallelODoHResolver func(logger model.DebugLogger, URL string) model.Resolver
+
+	MockNewParallelDNSSECValidatingResolver func(logger model.DebugLogger, txp model.DNSTransport) model.Resolver
+
+	MockNewParallelDNSOverQUICResolver func(logger model.DebugLogger, address string) model.Resolver
+
+	MockNewParallelDNSOverTLSResolver func(logger model.DebugLogger, address string) model.Resolver
+
 	MockNewParallelUDPResolver func(logger model.DebugLogger, dialer model.Dialer, address string) model.Resolver
 
+	MockNewParallelUDPResolverWithCollectWindow func(
+		logger model.DebugLogger, dialer model.Dialer, address string, window time.Duration) model.Resolver
+
 	MockNewQUICDialerWithoutResolver func(listener model.UDPListener, logger model.DebugLogger, w ...model.QUICDialerWrapper) model.QUICDialer
 
 	MockNewStdlibResolver func(logger model.DebugLogger) model.Resolver
@@ -36,11 +49,37 @@ func (mn *MeasuringNetwork) NewParallelDNSOverHTTPSResolver(logger model.DebugLo
 	return mn.MockNewParallelDNSOverHTTPSResolver(logger, URL)
 }
 
+// NewParallelODoHResolver implements model.MeasuringNetwork.
+func (mn *MeasuringNetwork) NewParallelODoHResolver(logger model.DebugLogger, URL string) model.Resolver {
+	return mn.MockNewParallelODoHResolver(logger, URL)
+}
+
+// NewParallelDNSSECValidatingResolver implements model.MeasuringNetwork.
+func (mn *MeasuringNetwork) NewParallelDNSSECValidatingResolver(logger model.DebugLogger, txp model.DNSTransport) model.Resolver {
+	return mn.MockNewParallelDNSSECValidatingResolver(logger, txp)
+}
+
+// NewParallelDNSOverQUICResolver implements model.MeasuringNetwork.
+func (mn *MeasuringNetwork) NewParallelDNSOverQUICResolver(logger model.DebugLogger, address string) model.Resolver {
+	return mn.MockNewParallelDNSOverQUICResolver(logger, address)
+}
+
+// NewParallelDNSOverTLSResolver implements model.MeasuringNetwork.
+func (mn *MeasuringNetwork) NewParallelDNSOverTLSResolver(logger model.DebugLogger, address string) model.Resolver {
+	return mn.MockNewParallelDNSOverTLSResolver(logger, address)
+}
+
 // NewParallelUDPResolver implements model.MeasuringNetwork.
 func (mn *MeasuringNetwork) NewParallelUDPResolver(logger model.DebugLogger, dialer model.Dialer, address string) model.Resolver {
 	return mn.MockNewParallelUDPResolver(logger, dialer, address)
 }
 
+// NewParallelUDPResolverWithCollectWindow implements model.MeasuringNetwork.
+func (mn *MeasuringNetwork) NewParallelUDPResolverWithCollectWindow(
+	logger model.DebugLogger, dialer model.Dialer, address string, window time.Duration) model.Resolver {
+	return mn.MockNewParallelUDPResolverWithCollectWindow(logger, dialer, address, window)
+}
+
 // NewQUICDialerWithoutResolver implements model.MeasuringNetwork.
 func (mn *MeasuringNetwork) NewQUICDialerWithoutResolver(listener model.UDPListener, logger model.DebugLogger, w ...model.QUICDialerWrapper) model.QUICDialer {
 	return mn.MockNewQUICDialerWithoutResolver(listener, logger, w...)
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"testing"
+	"time"
 
 	"github.com/ooni/probe-engine/pkg/model"
 	utls "gitlab.com/yawning/utls.git"
@@ -34,6 +35,58 @@ func TestMeasuringN(t *testing.T) {
 		}
 	})
 
+	t.Run("MockNewParallelODoHResolver", func(t *testing.T) {
+		expected := &Resolver{}
+		mn := &MeasuringNetwork{
+			MockNewParallelODoHResolver: func(logger model.DebugLogger, URL string) model.Resolver {
+				return expected
+			},
+		}
+		got := mn.NewParallelODoHResolver(nil, "")
+		if expected != got {
+			t.Fatal("unexpected result")
+		}
+	})
+
+	t.Run("MockNewParallelDNSSECValidatingResolver", func(t *testing.T) {
+		expected := &Resolver{}
+		mn := &MeasuringNetwork{
+			MockNewParallelDNSSECValidatingResolver: func(logger model.DebugLogger, txp model.DNSTransport) model.Resolver {
+				return expected
+			},
+		}
+		got := mn.NewParallelDNSSECValidatingResolver(nil, nil)
+		if expected != got {
+			t.Fatal("unexpected result")
+		}
+	})
+
+	t.Run("MockNewParallelDNSOverQUICResolver", func(t *testing.T) {
+		expected := &Resolver{}
+		mn := &MeasuringNetwork{
+			MockNewParallelDNSOverQUICResolver: func(logger model.DebugLogger, address string) model.Resolver {
+				return expected
+			},
+		}
+		got := mn.NewParallelDNSOverQUICResolver(nil, "")
+		if expected != got {
+			t.Fatal("unexpected result")
+		}
+	})
+
+	t.Run("MockNewParallelDNSOverTLSResolver", func(t *testing.T) {
+		expected := &Resolver{}
+		mn := &MeasuringNetwork{
+			MockNewParallelDNSOverTLSResolver: func(logger model.DebugLogger, address string) model.Resolver {
+				return expected
+			},
+		}
+		got := mn.NewParallelDNSOverTLSResolver(nil, "")
+		if expected != got {
+			t.Fatal("unexpected result")
+		}
+	})
+
 	t.Run("MockNewParallelUDPResolver", func(t *testing.T) {
 		expected := &Resolver{}
 		mn := &MeasuringNetwork{
@@ -47,6 +100,20 @@ func TestMeasuringN(t *testing.T) {
 		}
 	})
 
+	t.Run("MockNewParallelUDPResolverWithCollectWindow", func(t *testing.T) {
+		expected := &Resolver{}
+		mn := &MeasuringNetwork{
+			MockNewParallelUDPResolverWithCollectWindow: func(
+				logger model.DebugLogger, dialer model.Dialer, address string, window time.Duration) model.Resolver {
+				return expected
+			},
+		}
+		got := mn.NewParallelUDPResolverWithCollectWindow(nil, nil, "", time.Second)
+		if expected != got {
+			t.Fatal("unexpected result")
+		}
+	})
+
 	t.Run("MockNewQUICDialerWithoutResolver", func(t *testing.T) {
 		expected := &QUICDialer{}
 		mn := &MeasuringNetwork{
@@ -71,6 +71,28 @@ func TestTrace(t *testing.T) {
 		}
 	})
 
+	t.Run("OnDNSRoundTripForLookupHTTPS", func(t *testing.T) {
+		var called bool
+		tx := &Trace{
+			MockOnDNSRoundTripForLookupHTTPS: func(started time.Time, reso model.Resolver, query model.DNSQuery,
+				response model.DNSResponse, https *model.HTTPSSvc, err error, finished time.Time) {
+				called = true
+			},
+		}
+		tx.OnDNSRoundTripForLookupHTTPS(
+			time.Now(),
+			&Resolver{},
+			&DNSQuery{},
+			&DNSResponse{},
+			&model.HTTPSSvc{},
+			nil,
+			time.Now(),
+		)
+		if !called {
+			t.Fatal("not called")
+		}
+	})
+
 	t.Run("OnDelayedDNSResponse", func(t *testing.T) {
 		var called bool
 		tx := &Trace{
@@ -180,10 +180,12 @@ func (value *ArchivalScrubbedMaybeBinaryString) UnmarshalJSON(rawData []byte) er
 // See https://github.com/ooni/spec/blob/master/data-formats/df-002-dnst.md.
 type ArchivalDNSLookupResult struct {
 	Answers          []ArchivalDNSAnswer `json:"answers"`
+	DNSSECStatus     string              `json:"dnssec_status,omitempty"`
 	Engine           string              `json:"engine"`
 	Failure          *string             `json:"failure"`
 	GetaddrinfoError int64               `json:"getaddrinfo_error,omitempty"`
 	Hostname         string              `json:"hostname"`
+	IPTTL            int64               `json:"ip_ttl,omitempty"`
 	QueryType        string              `json:"query_type"`
 	RawResponse      []byte              `json:"raw_response,omitempty"`
 	Rcode            int64               `json:"rcode,omitempty"`
@@ -198,13 +200,28 @@ type ArchivalDNSLookupResult struct {
 
 // ArchivalDNSAnswer is a DNS answer.
 type ArchivalDNSAnswer struct {
-	ASN        int64   `json:"asn,omitempty"`
-	ASOrgName  string  `json:"as_org_name,omitempty"`
-	AnswerType string  `json:"answer_type"`
-	Hostname   string  `json:"hostname,omitempty"`
-	IPv4       string  `json:"ipv4,omitempty"`
-	IPv6       string  `json:"ipv6,omitempty"`
-	TTL        *uint32 `json:"ttl"`
+	ASN        int64                  `json:"asn,omitempty"`
+	ASOrgName  string                 `json:"as_org_name,omitempty"`
+	AnswerType string                 `json:"answer_type"`
+	Hostname   string                 `json:"hostname,omitempty"`
+	IPv4       string                 `json:"ipv4,omitempty"`
+	IPv6       string                 `json:"ipv6,omitempty"`
+	SVCB       *ArchivalDNSSVCBAnswer `json:"svcb,omitempty"`
+	TTL        *uint32                `json:"ttl"`
+}
+
+// ArchivalDNSSVCBAnswer contains the content of an SVCB or HTTPS answer.
+type ArchivalDNSSVCBAnswer struct {
+	Priority      uint16             `json:"priority"`
+	TargetName    string             `json:"target_name"`
+	ALPN          []string           `json:"alpn,omitempty"`
+	NoDefaultALPN bool               `json:"no_default_alpn,omitempty"`
+	Port          uint16             `json:"port,omitempty"`
+	Mandatory     []string           `json:"mandatory,omitempty"`
+	IPv4Hint      []string           `json:"ipv4hint,omitempty"`
+	IPv6Hint      []string           `json:"ipv6hint,omitempty"`
+	ECHConfig     ArchivalBinaryData `json:"ech,omitempty"`
+	Params        map[string]string  `json:"params"`
 }
 
 //
@@ -242,6 +259,8 @@ type ArchivalTLSOrQUICHandshakeResult struct {
 	Network            string               `json:"network"`
 	Address            string               `json:"address"`
 	CipherSuite        string               `json:"cipher_suite"`
+	ClientHello        ArchivalBinaryData   `json:"client_hello,omitempty"`
+	ClientHelloID      string               `json:"client_hello_id,omitempty"`
 	Failure            *string              `json:"failure"`
 	SoError            *string              `json:"so_error,omitempty"`
 	NegotiatedProtocol string               `json:"negotiated_protocol"`
@@ -250,6 +269,10 @@ type ArchivalTLSOrQUICHandshakeResult struct {
 	ServerName         string               `json:"server_name"`
 	OuterServerName    string               `json:"outer_server_name,omitempty"`
 	ECHConfig          string               `json:"echconfig,omitempty"`
+	JA3                string               `json:"ja3,omitempty"`
+	JA3S               string               `json:"ja3s,omitempty"`
+	JA4                string               `json:"ja4,omitempty"`
+	JA4S               string               `json:"ja4s,omitempty"`
 	T0                 float64              `json:"t0,omitempty"`
 	T                  float64              `json:"t"`
 	Tags               []string             `json:"tags"`
@@ -4,6 +4,8 @@ package model
 // Definition of a key-value store.
 //
 
+import "time"
+
 // KeyValueStore is a generic key-value store.
 type KeyValueStore interface {
 	// Get gets the value of the given key or returns an
@@ -15,3 +17,28 @@ type KeyValueStore interface {
 	// whether the operation was successful or not.
 	Set(key string, value []byte) (err error)
 }
+
+// ExtendedKeyValueStore is a [KeyValueStore] that also supports deleting
+// and listing keys, atomically updating a key, and expiring keys.
+type ExtendedKeyValueStore interface {
+	KeyValueStore
+
+	// Delete deletes the given key. Deleting a nonexistent
+	// key is not an error.
+	Delete(key string) (err error)
+
+	// List returns the sorted list of the keys starting
+	// with the given prefix that did not expire.
+	List(prefix string) (keys []string, err error)
+
+	// CompareAndSwap atomically sets the value of the given key to
+	// newValue if its current value is equal to oldValue. A nil oldValue
+	// means that the key must not exist. The return value indicates
+	// whether we swapped the value. A swapped value does not expire.
+	CompareAndSwap(key string, oldValue, newValue []byte) (swapped bool, err error)
+
+	// SetWithTTL is like Set but the key expires after the given
+	// time to live. After a key expires, Get fails as if the key
+	// did not exist in the key-value store.
+	SetWithTTL(key string, value []byte, ttl time.Duration) (err error)
+}
@@ -44,6 +44,43 @@ type DNSResponse interface {
 	DecodeCNAME() (string, error)
 }
 
+// DNSSEC validation statuses (see RFC4035 Sect. 4.3).
+const (
+	// DNSSECStatusSecure means we built a chain of trust from the root to the answer.
+	DNSSECStatusSecure = "secure"
+
+	// DNSSECStatusInsecure means we proved the answer comes from an unsigned zone.
+	DNSSECStatusInsecure = "insecure"
+
+	// DNSSECStatusBogus means that the answer should have been signed but
+	// we could not validate it, which is a strong indicator of tampering.
+	DNSSECStatusBogus = "bogus"
+
+	// DNSSECStatusIndeterminate means we could not fetch the records
+	// required to validate the answer (e.g., because of a timeout).
+	DNSSECStatusIndeterminate = "indeterminate"
+)
+
+// DNSSECValidatedResponse is a [DNSResponse] validated using DNSSEC.
+type DNSSECValidatedResponse interface {
+	DNSResponse
+
+	// DNSSECStatus returns the validation status (e.g., [DNSSECStatusSecure]).
+	DNSSECStatus() string
+}
+
+// DNSResponseWithIPTTL is a [DNSResponse] that knows the TTL (or the hop
+// limit, for IPv6) of the IP packet that carried the response. The DNS-over-UDP
+// transport returns these responses when collecting all the responses and it
+// has access to the underlying socket. This information is useful to tell apart
+// injected responses, which typically have a different TTL.
+type DNSResponseWithIPTTL interface {
+	DNSResponse
+
+	// IPTTL returns the TTL of the IP packet.
+	IPTTL() int64
+}
+
 // The DNSDecoder decodes DNS responses.
 type DNSDecoder interface {
 	// DecodeResponse decodes a DNS response message.
@@ -175,6 +212,9 @@ type HTTPTransport interface {
 }
 
 // HTTPSSvc is the reply to an HTTPS DNS query.
+//
+// The ALPN, IPv4, IPv6, and ECHConfig fields summarize the content of
+// all the service-mode records, while Records contains each record.
 type HTTPSSvc struct {
 	// ALPN contains the ALPNs inside the HTTPS reply.
 	ALPN []string
@@ -184,6 +224,73 @@ type HTTPSSvc struct {
 
 	// IPv6 contains the IPv6 hints (which may be empty).
 	IPv6 []string
+
+	// ECHConfig contains the first ECHConfigList inside the
+	// HTTPS reply ordered by priority (which may be empty).
+	ECHConfig []byte
+
+	// Records contains all the HTTPS records sorted by priority.
+	Records []*HTTPSSvcRecord
+}
+
+// HTTPSSvcRecord is a single SVCB/HTTPS resource record (see RFC 9460).
+type HTTPSSvcRecord struct {
+	// Priority is the SvcPriority. Zero means that this is an AliasMode record.
+	Priority uint16
+
+	// TargetName is the TargetName, where "." means the owner name.
+	TargetName string
+
+	// TTL is the record TTL.
+	TTL uint32
+
+	// ALPN contains the alpn SvcParam (which may be empty).
+	ALPN []string
+
+	// NoDefaultALPN indicates whether the record contains no-default-alpn.
+	NoDefaultALPN bool
+
+	// Port is the port SvcParam or zero when not present.
+	Port uint16
+
+	// Mandatory contains the names of the mandatory SvcParamKeys.
+	Mandatory []string
+
+	// IPv4 contains the ipv4hint SvcParam (which may be empty).
+	IPv4 []string
+
+	// IPv6 contains the ipv6hint SvcParam (which may be empty).
+	IPv6 []string
+
+	// ECHConfig contains the ech SvcParam (which may be empty).
+	ECHConfig []byte
+
+	// Params maps each SvcParamKey in the record, including the keys
+	// we don't know about, to its value in presentation format.
+	Params map[string]string
+}
+
+// AddressHints returns the IP address hints inside the HTTPS records that we can
+// use to connect to the given port. This method is safe to call on a nil pointer.
+func (svc *HTTPSSvc) AddressHints(port uint16) (out []string) {
+	if svc == nil {
+		return
+	}
+	for _, record := range svc.Records {
+		// Note: AliasMode records do not have hints and records with an explicit
+		// port would cause us to connect to the wrong port
+		if record.IsAliasMode() || (record.Port != 0 && record.Port != port) {
+			continue
+		}
+		out = append(out, record.IPv4...)
+		out = append(out, record.IPv6...)
+	}
+	return
+}
+
+// IsAliasMode returns whether this is an AliasMode record.
+func (r *HTTPSSvcRecord) IsAliasMode() bool {
+	return r.Priority == 0
 }
 
 // MeasuringNetwork defines the constructors required for implementing OONI experiments. All
@@ -202,12 +309,37 @@ type MeasuringNetwork interface {
 	// NewParallelDNSOverHTTPSResolver creates a new DNS-over-HTTPS resolver with error wrapping.
 	NewParallelDNSOverHTTPSResolver(logger DebugLogger, URL string) Resolver
 
+	// NewParallelODoHResolver creates a new Oblivious DNS-over-HTTPS resolver with error wrapping.
+	//
+	// The URL argument has the odoh://PROXY/TARGET form (e.g., odoh://odoh1.surfdomeinen.nl/odoh.cloudflare-dns.com).
+	NewParallelODoHResolver(logger DebugLogger, URL string) Resolver
+
+	// NewParallelDNSSECValidatingResolver creates a new resolver with error wrapping
+	// that validates DNSSEC for the responses returned by the given transport.
+	NewParallelDNSSECValidatingResolver(logger DebugLogger, txp DNSTransport) Resolver
+
+	// NewParallelDNSOverQUICResolver creates a new DNS-over-QUIC resolver with error wrapping.
+	//
+	// The address argument is the QUIC endpoint address (e.g., 94.140.14.140:853).
+	NewParallelDNSOverQUICResolver(logger DebugLogger, address string) Resolver
+
+	// NewParallelDNSOverTLSResolver creates a new DNS-over-TLS resolver with error wrapping.
+	//
+	// The address argument is the TCP endpoint address (e.g., 1.1.1.1:853, dns.google:853).
+	NewParallelDNSOverTLSResolver(logger DebugLogger, address string) Resolver
+
 	// NewParallelUDPResolver creates a new Resolver using DNS-over-UDP
 	// that performs parallel A/AAAA lookups during LookupHost.
 	//
 	// The address argument is the UDP endpoint address (e.g., 1.1.1.1:53, [::1]:53).
 	NewParallelUDPResolver(logger DebugLogger, dialer Dialer, address string) Resolver
 
+	// NewParallelUDPResolverWithCollectWindow is like NewParallelUDPResolver but each
+	// query waits for the given window to collect all the responses, including the
+	// ones injected by censors, and reports the additional ones as delayed responses.
+	NewParallelUDPResolverWithCollectWindow(
+		logger DebugLogger, dialer Dialer, address string, window time.Duration) Resolver
+
 	// NewQUICDialerWithoutResolver creates a [QUICDialer] with error wrapping and without an attached
 	// resolver, meaning that you MUST pass UDP endpoint addresses to this dialer.
 	//
@@ -403,6 +535,27 @@ type Trace interface {
 	OnDNSRoundTripForLookupHost(started time.Time, reso Resolver, query DNSQuery,
 		response DNSResponse, addrs []string, err error, finished time.Time)
 
+	// OnDNSRoundTripForLookupHTTPS is like OnDNSRoundTripForLookupHost but is
+	// called after the RoundTrip performed by LookupHTTPS terminates.
+	//
+	// Arguments:
+	//
+	// - started is when we started the RoundTrip;
+	//
+	// - reso is the parent resolver for the trace;
+	//
+	// - query is the non-nil DNS query we use for the RoundTrip;
+	//
+	// - response is a valid DNS response, obtained after the RoundTrip;
+	//
+	// - https is the decoded HTTPS response, which is nil on failure;
+	//
+	// - err is the result of LookupHTTPS; either an error or nil;
+	//
+	// - finished is the time right after the RoundTrip.
+	OnDNSRoundTripForLookupHTTPS(started time.Time, reso Resolver, query DNSQuery,
+		response DNSResponse, https *HTTPSSvc, err error, finished time.Time)
+
 	// OnDelayedDNSResponse is used with a DNSOverUDPTransport and called
 	// when we get delayed, unexpected DNS responses.
 	//
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHTTPSSvcAddressHints(t *testing.T) {
+	https := &HTTPSSvc{
+		Records: []*HTTPSSvcRecord{{
+			Priority:   0,
+			TargetName: "cdn.example.com.",
+		}, {
+			Priority:   1,
+			TargetName: ".",
+			IPv4:       []string{"1.1.1.1"},
+			IPv6:       []string{"::1"},
+		}, {
+			Priority:   2,
+			TargetName: ".",
+			Port:       8443,
+			IPv4:       []string{"2.2.2.2"},
+		}},
+	}
+
+	tests := []struct {
+		name  string
+		https *HTTPSSvc
+		port  uint16
+		want  []string
+	}{{
+		name:  "with nil HTTPS lookup results",
+		https: nil,
+		port:  443,
+		want:  nil,
+	}, {
+		name:  "with a port not matching any record",
+		https: https,
+		port:  443,
+		want:  []string{"1.1.1.1", "::1"},
+	}, {
+		name:  "with a port matching a record",
+		https: https,
+		port:  8443,
+		want:  []string{"1.1.1.1", "::1", "2.2.2.2"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.https.AddressHints(tt.port)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
@@ -17,6 +17,16 @@ type THRequest struct {
 	// v3.17.x release cycle and possibly also for v3.18.x but we
 	// will eventually enable QUIC for all clients.
 	XQUICEnabled bool `json:"x_quic_enabled"`
+
+	// XTLSDetails is a feature flag that tells the oohelperd to include
+	// the OPTIONAL details in each [THTLSHandshakeResult]. Old probes do not
+	// send this flag, hence they keep receiving the same response.
+	XTLSDetails bool `json:"x_tls_details,omitempty"`
+
+	// XVantages is a feature flag that tells the oohelperd to also measure
+	// DNS and HTTP from its additional vantage points, if any, and to include
+	// the results inside [THResponse]. Old probes do not send this flag.
+	XVantages bool `json:"x_vantages,omitempty"`
 }
 
 // THTCPConnectResult is the result of the TCP connect
@@ -32,6 +42,30 @@ type THTLSHandshakeResult struct {
 	ServerName string  `json:"server_name"`
 	Status     bool    `json:"status"`
 	Failure    *string `json:"failure"`
+
+	// The following fields are OPTIONAL and the oohelperd only fills
+	// them when the request sets the XTLSDetails feature flag.
+
+	// LeafCertificateFingerprint is the hex-encoded SHA-256 of the DER
+	// encoding of the leaf certificate returned by the server.
+	LeafCertificateFingerprint string `json:"leaf_certificate_fingerprint,omitempty"`
+
+	// LeafCertificateIssuer is the issuer of the leaf certificate.
+	LeafCertificateIssuer string `json:"leaf_certificate_issuer,omitempty"`
+
+	// LeafCertificateSANs contains the DNS names and IP addresses
+	// listed by the leaf certificate's subject alternative names.
+	LeafCertificateSANs []string `json:"leaf_certificate_sans,omitempty"`
+
+	// NegotiatedProtocol is the negotiated ALPN.
+	NegotiatedProtocol string `json:"negotiated_protocol,omitempty"`
+
+	// TLSVersion is the negotiated TLS version (e.g., "TLSv1.3").
+	TLSVersion string `json:"tls_version,omitempty"`
+
+	// ECHConfigOffered indicates whether the domain's HTTPS record
+	// contains an ECH config, thus offering ECH via the DNS.
+	ECHConfigOffered bool `json:"ech_config_offered,omitempty"`
 }
 
 // THHTTPRequestResult is the result of the HTTP request
@@ -94,4 +128,24 @@ type THResponse struct {
 	HTTP3Request  *THHTTPRequestResult            `json:"http3_request"` // optional!
 	DNS           THDNSResult                     `json:"dns"`
 	IPInfo        map[string]*THIPInfo            `json:"ip_info,omitempty"`
+
+	// Vantages OPTIONALLY contains the results measured from the additional
+	// vantage points of the control service, which is only filled when the
+	// request sets the XVantages flag and the oohelperd has vantage points.
+	Vantages []THVantageResult `json:"x_vantages,omitempty"`
+}
+
+// THVantageResult contains the DNS and HTTP results measured from an
+// additional vantage point of the control service (e.g., by using a proxy
+// in another country), which helps the probe to distinguish censorship from
+// geoblocking or localized answers affecting the main vantage point.
+type THVantageResult struct {
+	// Name is the name of the vantage point.
+	Name string `json:"name"`
+
+	// DNS is the result of the DNS lookup.
+	DNS THDNSResult `json:"dns"`
+
+	// HTTPRequest is the result of the HTTP request.
+	HTTPRequest THHTTPRequestResult `json:"http_request"`
 }
@@ -0,0 +1,350 @@
+// Package msmtcrypt encrypts measurements at rest using filippo.io/age.
+//
+// An encrypted report file is a JSONL-like file where each line contains the
+// base64 encoding of a binary age file containing a single measurement serialized
+// as JSON. We encrypt each measurement separately because age files cannot be
+// appended to and we want to append measurements to the same report file as we
+// measure. Use [NewReader] to obtain the plaintext JSONL. Because [NewReader] passes
+// plaintext lines through, a report file may mix plaintext and encrypted lines.
+//
+// The probe has its own X25519 identity, which lives inside the [model.KeyValueStore],
+// such that it can decrypt what it encrypted to itself. Encrypting only requires the
+// public recipient, while decrypting requires the identity, which may optionally be
+// protected by a passphrase (see [SetPassphrase]).
+package msmtcrypt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/ooni/probe-engine/pkg/kvstore"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// StateKey is the [model.KeyValueStore] key containing the probe identity.
+const StateKey = "msmtcrypt.state"
+
+// state is the state saved in the key-value store.
+type state struct {
+	// Recipient is the public recipient of the probe identity.
+	Recipient string
+
+	// Identity is the probe identity when it is not passphrase protected.
+	Identity string
+
+	// EncryptedIdentity is the probe identity encrypted using the
+	// passphrase, when the identity is passphrase protected.
+	EncryptedIdentity []byte
+}
+
+var (
+	// ErrNoIdentity indicates that we need an identity to decrypt.
+	ErrNoIdentity = errors.New("msmtcrypt: no identity for decrypting")
+
+	// ErrPassphraseRequired indicates that the probe identity is
+	// passphrase protected and we were not given a passphrase.
+	ErrPassphraseRequired = errors.New("msmtcrypt: the identity is passphrase protected")
+)
+
+// scryptWorkFactor is the scrypt work factor for passphrase protection.
+var scryptWorkFactor = 18
+
+// loadState loads the state or creates a new identity if there's no state.
+func loadState(kvStore model.KeyValueStore) (*state, error) {
+	data, err := kvStore.Get(StateKey)
+	if err == nil {
+		var st state
+		if err := json.Unmarshal(data, &st); err != nil {
+			return nil, err
+		}
+		return &st, nil
+	}
+	if !errors.Is(err, kvstore.ErrNoSuchKey) {
+		return nil, err
+	}
+	identity, err := age.GenerateX25519Identity()
+	runtimex.PanicOnError(err, "age.GenerateX25519Identity unexpectedly failed")
+	st := &state{
+		Recipient: identity.Recipient().String(),
+		Identity:  identity.String(),
+	}
+	if err := storeState(kvStore, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// storeState stores the given state into the key-value store.
+func storeState(kvStore model.KeyValueStore, st *state) error {
+	data, err := json.Marshal(st)
+	runtimex.PanicOnError(err, "json.Marshal unexpectedly failed")
+	return kvStore.Set(StateKey, data)
+}
+
+// LoadOrCreateRecipient returns the recipient of the probe identity, which we
+// generate and store if needed. This function never requires the passphrase.
+func LoadOrCreateRecipient(kvStore model.KeyValueStore) (*age.X25519Recipient, error) {
+	st, err := loadState(kvStore)
+	if err != nil {
+		return nil, err
+	}
+	return age.ParseX25519Recipient(st.Recipient)
+}
+
+// LoadOrCreateIdentity returns the probe identity, which we generate and store if
+// needed. The passphrase is only used when the identity is passphrase protected.
+func LoadOrCreateIdentity(kvStore model.KeyValueStore, passphrase string) (*age.X25519Identity, error) {
+	st, err := loadState(kvStore)
+	if err != nil {
+		return nil, err
+	}
+	return st.identity(passphrase)
+}
+
+// identity returns the identity, using the passphrase to decrypt it if needed.
+func (st *state) identity(passphrase string) (*age.X25519Identity, error) {
+	if len(st.EncryptedIdentity) <= 0 {
+		return age.ParseX25519Identity(st.Identity)
+	}
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+	scryptIdentity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decrypt(st.EncryptedIdentity, scryptIdentity)
+	if err != nil {
+		return nil, fmt.Errorf("msmtcrypt: cannot decrypt the identity: %w", err)
+	}
+	return age.ParseX25519Identity(string(data))
+}
+
+// SetPassphrase changes the passphrase protecting the probe identity. Use an empty
+// oldPassphrase if the identity is not protected and an empty newPassphrase to
+// remove the protection. We generate the identity if needed.
+func SetPassphrase(kvStore model.KeyValueStore, oldPassphrase, newPassphrase string) error {
+	st, err := loadState(kvStore)
+	if err != nil {
+		return err
+	}
+	identity, err := st.identity(oldPassphrase)
+	if err != nil {
+		return err
+	}
+	if newPassphrase == "" {
+		return storeState(kvStore, &state{
+			Recipient: st.Recipient,
+			Identity:  identity.String(),
+		})
+	}
+	recipient, err := age.NewScryptRecipient(newPassphrase)
+	if err != nil {
+		return err
+	}
+	recipient.SetWorkFactor(scryptWorkFactor)
+	encrypted, err := encrypt([]byte(identity.String()), recipient)
+	if err != nil {
+		return err
+	}
+	return storeState(kvStore, &state{
+		Recipient:         st.Recipient,
+		EncryptedIdentity: encrypted,
+	})
+}
+
+// ParseRecipients parses recipients. Each value is either an age X25519 recipient
+// (i.e., "age1...") or the path of a file containing recipients, one per line.
+func ParseRecipients(values ...string) ([]age.Recipient, error) {
+	var out []age.Recipient
+	for _, value := range values {
+		if strings.HasPrefix(value, "age1") {
+			recipient, err := age.ParseX25519Recipient(value)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, recipient)
+			continue
+		}
+		recipients, err := parseFile(value, age.ParseRecipients)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, recipients...)
+	}
+	return out, nil
+}
+
+// ParseIdentitiesFile parses a file containing age identities, such as the
+// files generated by the age-keygen command.
+func ParseIdentitiesFile(filePath string) ([]age.Identity, error) {
+	return parseFile(filePath, age.ParseIdentities)
+}
+
+// parseFile opens the given file and parses it using the given parser.
+func parseFile[T any](filePath string, parser func(io.Reader) ([]T, error)) ([]T, error) {
+	filep, err := os.Open(filePath) // #nosec G304 - this is working as intended
+	if err != nil {
+		return nil, err
+	}
+	defer filep.Close()
+	values, err := parser(filep)
+	if err != nil {
+		return nil, fmt.Errorf("msmtcrypt: cannot parse %s: %w", filePath, err)
+	}
+	return values, nil
+}
+
+// encrypt encrypts the given data for the given recipients.
+func encrypt(data []byte, recipients ...age.Recipient) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer, err := age.Encrypt(&buffer, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// decrypt decrypts the given data using the given identities.
+func decrypt(data []byte, identities ...age.Identity) ([]byte, error) {
+	if len(identities) <= 0 {
+		return nil, ErrNoIdentity
+	}
+	reader, err := age.Decrypt(bytes.NewReader(data), identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+// EncryptLine encrypts the given JSON document for the given recipients and
+// returns the encrypted line, without the trailing newline.
+func EncryptLine(data []byte, recipients ...age.Recipient) ([]byte, error) {
+	encrypted, err := encrypt(data, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(encrypted)))
+	base64.StdEncoding.Encode(out, encrypted)
+	return out, nil
+}
+
+// IsEncrypted returns whether the given line or file content is encrypted
+// rather than being a plaintext JSON document.
+func IsEncrypted(line []byte) bool {
+	return !bytes.HasPrefix(bytes.TrimSpace(line), []byte("{"))
+}
+
+// DecryptLine decrypts a line using the given identities. We return a plaintext
+// JSON document as is, so you can use this function for any report line.
+func DecryptLine(line []byte, identities ...age.Identity) ([]byte, error) {
+	line = bytes.TrimSpace(line)
+	if !IsEncrypted(line) {
+		return line, nil
+	}
+	encrypted := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	count, err := base64.StdEncoding.Decode(encrypted, line)
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(encrypted[:count], identities...)
+}
+
+// SaveMeasurement appends the measurement encrypted for the given recipients to
+// the given report file. This function is like [engine.SaveMeasurement] except
+// that it writes encrypted lines.
+func SaveMeasurement(m *model.Measurement, filePath string, recipients ...age.Recipient) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	line, err := EncryptLine(data, recipients...)
+	if err != nil {
+		return err
+	}
+	filep, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := filep.Write(append(line, '\n')); err != nil {
+		filep.Close()
+		return err
+	}
+	return filep.Close()
+}
+
+// ReadFile reads a file containing a single, possibly encrypted, measurement
+// and returns the plaintext measurement serialized as JSON.
+func ReadFile(filePath string, identities ...age.Identity) ([]byte, error) {
+	data, err := os.ReadFile(filePath) // #nosec G304 - this is working as intended
+	if err != nil {
+		return nil, err
+	}
+	return DecryptLine(data, identities...)
+}
+
+// Reader is an [io.Reader] returning the plaintext JSONL of a report file
+// containing encrypted lines. Construct using [NewReader].
+type Reader struct {
+	err        error
+	identities []age.Identity
+	lineno     int
+	pending    []byte
+	reader     *bufio.Reader
+}
+
+var _ io.Reader = &Reader{}
+
+// NewReader creates a new [*Reader] decrypting the given report using the
+// given identities. We skip empty lines and pass plaintext lines through.
+func NewReader(report io.Reader, identities ...age.Identity) *Reader {
+	return &Reader{
+		err:        nil,
+		identities: identities,
+		lineno:     0,
+		pending:    nil,
+		reader:     bufio.NewReader(report),
+	}
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(data []byte) (int, error) {
+	for len(r.pending) <= 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		line, err := r.reader.ReadBytes('\n')
+		if len(line) > 0 {
+			r.lineno++
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			plaintext, err := DecryptLine(line, r.identities...)
+			if err != nil {
+				r.err = fmt.Errorf("msmtcrypt: line %d: %w", r.lineno, err)
+				continue
+			}
+			r.pending = append(plaintext, '\n')
+		}
+		if err != nil {
+			r.err = err
+		}
+	}
+	count := copy(data, r.pending)
+	r.pending = r.pending[count:]
+	return count, nil
+}
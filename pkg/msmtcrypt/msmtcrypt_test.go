@@ -0,0 +1,276 @@
+package msmtcrypt
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/kvstore"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+func init() {
+	// make passphrase protection fast enough for running tests
+	scryptWorkFactor = 10
+}
+
+func TestIdentity(t *testing.T) {
+	t.Run("the recipient matches the identity", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		recipient, err := LoadOrCreateRecipient(kvs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		identity, err := LoadOrCreateIdentity(kvs, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity.Recipient().String() != recipient.String() {
+			t.Fatal("the recipient does not match the identity")
+		}
+	})
+
+	t.Run("with passphrase protection", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		identity, err := LoadOrCreateIdentity(kvs, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SetPassphrase(kvs, "", "antani"); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := kvs.Get(StateKey); strings.Contains(string(data), "AGE-SECRET-KEY") {
+			t.Fatal("the identity is stored in plaintext")
+		}
+		if _, err := LoadOrCreateRecipient(kvs); err != nil {
+			t.Fatal("we should not need the passphrase for encrypting", err)
+		}
+		if _, err := LoadOrCreateIdentity(kvs, ""); !errors.Is(err, ErrPassphraseRequired) {
+			t.Fatal("unexpected error", err)
+		}
+		if _, err := LoadOrCreateIdentity(kvs, "mascetti"); err == nil {
+			t.Fatal("expected an error with the wrong passphrase")
+		}
+		if err := SetPassphrase(kvs, "mascetti", ""); err == nil {
+			t.Fatal("expected an error with the wrong passphrase")
+		}
+		got, err := LoadOrCreateIdentity(kvs, "antani")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != identity.String() {
+			t.Fatal("unexpected identity")
+		}
+		if err := SetPassphrase(kvs, "antani", ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadOrCreateIdentity(kvs, ""); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("with a key-value store error", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		kvs := &mocks.KeyValueStore{
+			MockGet: func(key string) ([]byte, error) {
+				return nil, expected
+			},
+		}
+		if _, err := LoadOrCreateRecipient(kvs); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if _, err := LoadOrCreateIdentity(kvs, ""); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if err := SetPassphrase(kvs, "", "antani"); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("with a failure to store the identity", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		kvs := &mocks.KeyValueStore{
+			MockGet: func(key string) ([]byte, error) {
+				return nil, kvstore.ErrNoSuchKey
+			},
+			MockSet: func(key string, value []byte) error {
+				return expected
+			},
+		}
+		if _, err := LoadOrCreateRecipient(kvs); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("with an invalid state", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		if err := kvs.Set(StateKey, []byte(`{`)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadOrCreateRecipient(kvs); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestParseRecipients(t *testing.T) {
+	first, second := newIdentity(t), newIdentity(t)
+	filePath := filepath.Join(t.TempDir(), "recipients.txt")
+	content := "# comment\n" + second.Recipient().String() + "\n"
+	if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("with recipients and files", func(t *testing.T) {
+		recipients, err := ParseRecipients(first.Recipient().String(), filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, recipient := range recipients {
+			got = append(got, recipient.(*age.X25519Recipient).String())
+		}
+		expect := []string{first.Recipient().String(), second.Recipient().String()}
+		if diff := cmp.Diff(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("with failures", func(t *testing.T) {
+		invalid := filepath.Join(t.TempDir(), "invalid.txt")
+		if err := os.WriteFile(invalid, []byte("antani\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		for _, value := range []string{"age1antani", "/nonexistent", invalid} {
+			if _, err := ParseRecipients(value); err == nil {
+				t.Fatal("expected an error for", value)
+			}
+		}
+	})
+}
+
+func TestParseIdentitiesFile(t *testing.T) {
+	identity := newIdentity(t)
+	filePath := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(filePath, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	identities, err := ParseIdentitiesFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 || identities[0].(*age.X25519Identity).String() != identity.String() {
+		t.Fatal("unexpected identities")
+	}
+}
+
+// newIdentity generates a new identity.
+func newIdentity(t *testing.T) *age.X25519Identity {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+func TestSaveMeasurementAndReader(t *testing.T) {
+	identity := newIdentity(t)
+	reportFile := filepath.Join(t.TempDir(), "report.jsonl")
+	for _, input := range []string{"https://a.com/", "https://b.com/"} {
+		m := &model.Measurement{Input: model.MeasurementInput(input)}
+		if err := SaveMeasurement(m, reportFile, identity.Recipient()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "a.com") || !IsEncrypted(data) {
+		t.Fatal("the report file is not encrypted")
+	}
+	// add a plaintext line and an empty line, which we should handle
+	data = append(data, []byte("\n{\"input\":\"https://c.com/\"}")...)
+
+	t.Run("we decrypt using the right identity", func(t *testing.T) {
+		reader := NewReader(strings.NewReader(string(data)), newIdentity(t), identity)
+		plaintext, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(plaintext)), "\n")
+		if len(lines) != 3 {
+			t.Fatal("unexpected number of lines", len(lines))
+		}
+		for idx, host := range []string{"a.com", "b.com", "c.com"} {
+			if !strings.Contains(lines[idx], host) || !strings.HasPrefix(lines[idx], "{") {
+				t.Fatal("unexpected line", lines[idx])
+			}
+		}
+	})
+
+	t.Run("we fail without the right identity", func(t *testing.T) {
+		reader := NewReader(strings.NewReader(string(data)), newIdentity(t))
+		if _, err := io.ReadAll(reader); err == nil || !strings.HasPrefix(err.Error(), "msmtcrypt: line 1: ") {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("we fail without identities", func(t *testing.T) {
+		reader := NewReader(strings.NewReader(string(data)))
+		if _, err := io.ReadAll(reader); !errors.Is(err, ErrNoIdentity) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("we fail with invalid base64", func(t *testing.T) {
+		if _, err := DecryptLine([]byte("@@@"), identity); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestReadFile(t *testing.T) {
+	identity := newIdentity(t)
+	filePath := filepath.Join(t.TempDir(), "msmt.json")
+	line, err := EncryptLine([]byte(`{"input":"https://a.com/"}`), identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, line, 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ReadFile(filePath, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"input":"https://a.com/"}` {
+		t.Fatal("unexpected data", string(data))
+	}
+	if _, err := ReadFile(filepath.Join(t.TempDir(), "nonexistent")); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestSaveMeasurementFailure(t *testing.T) {
+	identity := newIdentity(t)
+	t.Run("without recipients", func(t *testing.T) {
+		reportFile := filepath.Join(t.TempDir(), "report.jsonl")
+		if err := SaveMeasurement(&model.Measurement{}, reportFile); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("when we cannot open the file", func(t *testing.T) {
+		reportFile := filepath.Join(t.TempDir(), "nonexistent", "report.jsonl")
+		if err := SaveMeasurement(&model.Measurement{}, reportFile, identity.Recipient()); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -0,0 +1,357 @@
+// Package msmtsign signs measurements and verifies signed measurements.
+//
+// We attach a detached Ed25519 signature to each measurement we save into
+// a report file. The signatures live in a separate file, whose name we obtain
+// by appending [SignatureFileSuffix] to the report file name, containing a
+// [*Signature] serialized as JSON for each line of the report file. We sign the
+// canonical JSON encoding of the measurement (see [CanonicalJSON]), such that the
+// signature only depends on the measurement content and not on the way in which
+// it is serialized. Each signature contains the SHA256 of such an encoding, which
+// [Verify] uses to pair signatures and measurements regardless of their position,
+// so that an unsigned, missing, or reordered line does not affect the others.
+//
+// The signing key lives inside the [model.KeyValueStore]. Teams receiving
+// reports should obtain the public key of the probe out of band and use it
+// to call [Verify], which reports the measurements that have been tampered with.
+package msmtsign
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ooni/probe-engine/pkg/kvstore"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/rogpeppe/go-internal/lockedfile"
+)
+
+// StateKey is the [model.KeyValueStore] key containing the signing key.
+const StateKey = "msmtsign.state"
+
+// SignatureFileSuffix is the suffix we append to the report file name to
+// obtain the name of the file containing the signatures.
+const SignatureFileSuffix = ".sig"
+
+// state is the state saved in the key-value store.
+type state struct {
+	// PrivateKey is the Ed25519 private key.
+	PrivateKey []byte
+}
+
+// ErrInvalidKey indicates that the key inside the key-value store is invalid.
+var ErrInvalidKey = errors.New("msmtsign: invalid signing key")
+
+// LoadOrCreateKey loads the signing key from the given key-value store. If there
+// is no key, we generate and store a new one.
+func LoadOrCreateKey(kvStore model.KeyValueStore) (ed25519.PrivateKey, error) {
+	data, err := kvStore.Get(StateKey)
+	if err == nil {
+		var st state
+		if err := json.Unmarshal(data, &st); err != nil {
+			return nil, err
+		}
+		if len(st.PrivateKey) != ed25519.PrivateKeySize {
+			return nil, ErrInvalidKey
+		}
+		return ed25519.PrivateKey(st.PrivateKey), nil
+	}
+	if !errors.Is(err, kvstore.ErrNoSuchKey) {
+		return nil, err
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	runtimex.PanicOnError(err, "ed25519.GenerateKey unexpectedly failed")
+	data, err = json.Marshal(&state{PrivateKey: key})
+	runtimex.PanicOnError(err, "json.Marshal unexpectedly failed")
+	if err := kvStore.Set(StateKey, data); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// CanonicalJSON returns the canonical encoding of the given JSON document: we
+// remove insignificant whitespace, sort the objects keys, avoid escaping HTML
+// characters, and preserve numbers as they are written in the document.
+func CanonicalJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("msmtsign: unexpected data after the JSON document")
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// Signature is the detached signature of a measurement.
+type Signature struct {
+	// SHA256 is the SHA256 of the canonical JSON encoding of the measurement.
+	SHA256 string `json:"sha256"`
+
+	// PublicKey is the public key of the probe that signed the measurement.
+	PublicKey []byte `json:"public_key"`
+
+	// Signature is the Ed25519 signature of the canonical JSON encoding.
+	Signature []byte `json:"signature"`
+}
+
+// Sign signs the given JSON serialized measurement.
+func Sign(key ed25519.PrivateKey, data []byte) (*Signature, error) {
+	canonical, err := CanonicalJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(canonical)
+	sig := &Signature{
+		SHA256:    hex.EncodeToString(digest[:]),
+		PublicKey: key.Public().(ed25519.PublicKey),
+		Signature: ed25519.Sign(key, canonical),
+	}
+	return sig, nil
+}
+
+// Saver is a [model.Saver] that signs measurements. Construct using [NewSaver].
+type Saver struct {
+	child    model.Saver
+	filePath string
+	key      ed25519.PrivateKey
+	mu       sync.Mutex
+}
+
+var _ model.Saver = &Saver{}
+
+// NewSaver creates a new [*Saver] that uses child to save the measurement into
+// the given report file and appends the measurement signature to the file with
+// the same name plus the [SignatureFileSuffix].
+func NewSaver(child model.Saver, reportFile string, key ed25519.PrivateKey) *Saver {
+	return &Saver{
+		child:    child,
+		filePath: reportFile + SignatureFileSuffix,
+		key:      key,
+		mu:       sync.Mutex{},
+	}
+}
+
+// SaveMeasurement implements model.Saver.
+//
+// We open and lock the signatures file and we write the signature using a single
+// write, such that we do not interleave with other savers (possibly in other processes)
+// using the same report file. We write the signature before saving the measurement,
+// such that we do not save the measurement when we cannot write the signature, and we
+// truncate the signatures file to its previous size when we cannot save the measurement.
+func (s *Saver) SaveMeasurement(m *model.Measurement) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	sig, err := Sign(s.key, data)
+	if err != nil {
+		return err
+	}
+	rawSig, err := json.Marshal(sig)
+	runtimex.PanicOnError(err, "json.Marshal unexpectedly failed")
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	filep, err := lockedfile.OpenFile(s.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := filep.Stat()
+	if err != nil {
+		filep.Close()
+		return err
+	}
+	if _, err := filep.Write(append(rawSig, '\n')); err != nil {
+		filep.Close()
+		return fmt.Errorf("msmtsign: cannot write signature: %w", err)
+	}
+	if err := s.child.SaveMeasurement(m); err != nil {
+		if err := filep.Truncate(info.Size()); err != nil {
+			filep.Close()
+			return fmt.Errorf("msmtsign: cannot remove the signature of the unsaved measurement: %w", err)
+		}
+		filep.Close()
+		return err
+	}
+	return filep.Close()
+}
+
+// VerifyStatus is the result of verifying a measurement.
+type VerifyStatus string
+
+const (
+	// VerifyOK indicates that the signature is valid.
+	VerifyOK = VerifyStatus("ok")
+
+	// VerifyTampered indicates that the measurement has been modified.
+	VerifyTampered = VerifyStatus("tampered")
+
+	// VerifyBadSignature indicates that the signature is not valid, which
+	// means that someone modified the file containing the signatures.
+	VerifyBadSignature = VerifyStatus("bad_signature")
+
+	// VerifyUntrustedKey indicates that the measurement has been signed
+	// using a key different from the one we trust.
+	VerifyUntrustedKey = VerifyStatus("untrusted_key")
+
+	// VerifyUnsigned indicates that there is no signature for the measurement.
+	VerifyUnsigned = VerifyStatus("unsigned")
+
+	// VerifyMissing indicates that a signature exists but the corresponding
+	// measurement has been removed from the report.
+	VerifyMissing = VerifyStatus("missing")
+
+	// VerifyInvalid indicates that we cannot parse the measurement or the signature.
+	VerifyInvalid = VerifyStatus("invalid")
+)
+
+// VerifyResult is the result of verifying a line of a report file.
+type VerifyResult struct {
+	// Line is the line number starting from one. For signatures without
+	// a corresponding measurement, whose status is [VerifyMissing], we
+	// use line numbers past the end of the report.
+	Line int
+
+	// Status is the verification status.
+	Status VerifyStatus
+}
+
+// verifySignature is a signature read by [Verify].
+type verifySignature struct {
+	// sig is the parsed signature or nil if we cannot parse it.
+	sig *Signature
+
+	// used indicates we have already paired the signature with a measurement.
+	used bool
+}
+
+// Verify verifies the measurements in the given report using the given signatures
+// and the trusted public key. We return a result for each line in the report plus
+// a result for each signature without a corresponding measurement.
+//
+// We pair each measurement with the signature having the same SHA256, such that the
+// position of lines does not matter. Then, we pair the measurements and signatures left
+// in the order in which they appear, because a measurement whose SHA256 does not match
+// any signature is likely a measurement that has been tampered with.
+func Verify(publicKey ed25519.PublicKey, report, signatures io.Reader) ([]*VerifyResult, error) {
+	// read all the signatures and index them by SHA256
+	var sigs []*verifySignature
+	bySHA256 := map[string][]*verifySignature{}
+	signaturesReader := bufio.NewReader(signatures)
+	for {
+		rawSig, eof, err := readLine(signaturesReader)
+		if err != nil {
+			return nil, err
+		}
+		if eof {
+			break
+		}
+		entry := &verifySignature{}
+		var sig Signature
+		if err := json.Unmarshal(rawSig, &sig); err == nil {
+			entry.sig = &sig
+			bySHA256[sig.SHA256] = append(bySHA256[sig.SHA256], entry)
+		}
+		sigs = append(sigs, entry)
+	}
+
+	// verify the lines having a signature with the same SHA256
+	var results []*VerifyResult
+	var unmatched []*VerifyResult
+	reportReader := bufio.NewReader(report)
+	for lineno := 1; ; lineno++ {
+		line, eof, err := readLine(reportReader)
+		if err != nil {
+			return nil, err
+		}
+		if eof {
+			break
+		}
+		result := &VerifyResult{Line: lineno, Status: VerifyInvalid}
+		results = append(results, result)
+		canonical, err := CanonicalJSON(line)
+		if err != nil {
+			unmatched = append(unmatched, result)
+			continue
+		}
+		entry := verifyTakeSignature(bySHA256, canonical)
+		if entry == nil {
+			result.Status = VerifyTampered
+			unmatched = append(unmatched, result)
+			continue
+		}
+		result.Status = verifyCanonical(publicKey, canonical, entry.sig)
+	}
+
+	// pair the lines and the signatures left in order
+	for _, entry := range sigs {
+		if entry.used {
+			continue
+		}
+		if len(unmatched) <= 0 {
+			results = append(results, &VerifyResult{Line: len(results) + 1, Status: VerifyMissing})
+			continue
+		}
+		if entry.sig == nil {
+			unmatched[0].Status = VerifyInvalid
+		}
+		unmatched = unmatched[1:]
+	}
+	for _, result := range unmatched {
+		if result.Status == VerifyTampered {
+			result.Status = VerifyUnsigned
+		}
+	}
+	return results, nil
+}
+
+// verifyTakeSignature returns the first unused signature having the SHA256 of
+// the given canonical measurement, marking it as used, or nil.
+func verifyTakeSignature(bySHA256 map[string][]*verifySignature, canonical []byte) *verifySignature {
+	digest := sha256.Sum256(canonical)
+	for _, entry := range bySHA256[hex.EncodeToString(digest[:])] {
+		if !entry.used {
+			entry.used = true
+			return entry
+		}
+	}
+	return nil
+}
+
+// verifyCanonical verifies a canonical measurement given its signature.
+func verifyCanonical(publicKey ed25519.PublicKey, canonical []byte, sig *Signature) VerifyStatus {
+	if !publicKey.Equal(ed25519.PublicKey(sig.PublicKey)) {
+		return VerifyUntrustedKey
+	}
+	if !ed25519.Verify(publicKey, canonical, sig.Signature) {
+		return VerifyBadSignature
+	}
+	return VerifyOK
+}
+
+// readLine reads the next line without the trailing newline. The returned
+// bool is true when we have reached the end of the input.
+func readLine(reader *bufio.Reader) ([]byte, bool, error) {
+	line, err := reader.ReadBytes('\n')
+	if errors.Is(err, io.EOF) {
+		return line, len(line) <= 0, nil
+	}
+	return bytes.TrimRight(line, "\r\n"), false, err
+}
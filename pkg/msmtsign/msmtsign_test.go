@@ -0,0 +1,327 @@
+package msmtsign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/engine"
+	"github.com/ooni/probe-engine/pkg/kvstore"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+func TestLoadOrCreateKey(t *testing.T) {
+	t.Run("we create the key once and then we reuse it", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		key1, err := LoadOrCreateKey(kvs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key2, err := LoadOrCreateKey(kvs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !key1.Equal(key2) {
+			t.Fatal("expected the same key")
+		}
+	})
+
+	t.Run("with a key-value store error", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		kvs := &mocks.KeyValueStore{
+			MockGet: func(key string) ([]byte, error) {
+				return nil, expected
+			},
+		}
+		if _, err := LoadOrCreateKey(kvs); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("with a failure to store the key", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		kvs := &mocks.KeyValueStore{
+			MockGet: func(key string) ([]byte, error) {
+				return nil, kvstore.ErrNoSuchKey
+			},
+			MockSet: func(key string, value []byte) error {
+				return expected
+			},
+		}
+		if _, err := LoadOrCreateKey(kvs); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("with an invalid state", func(t *testing.T) {
+		for _, value := range []string{`{`, `{"PrivateKey":"AAAA"}`} {
+			kvs := &kvstore.Memory{}
+			if err := kvs.Set(StateKey, []byte(value)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadOrCreateKey(kvs); err == nil {
+				t.Fatal("expected an error for", value)
+			}
+		}
+	})
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	t.Run("we canonicalize equivalent documents", func(t *testing.T) {
+		a := `{"b": [1.0, 2], "a": "<x>", "c": {"z": null, "y": true}}`
+		b := "{\"c\":{\"y\":true,\"z\":null},\n\"a\":\"\\u003cx\\u003e\",\"b\":[1.0,2]}"
+		ca, err := CanonicalJSON([]byte(a))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cb, err := CanonicalJSON([]byte(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := `{"a":"<x>","b":[1.0,2],"c":{"y":true,"z":null}}`
+		if diff := cmp.Diff(expect, string(ca)); diff != "" {
+			t.Fatal(diff)
+		}
+		if !bytes.Equal(ca, cb) {
+			t.Fatal("expected equal canonical documents")
+		}
+	})
+
+	t.Run("we reject invalid documents", func(t *testing.T) {
+		for _, value := range []string{`{`, `{}{}`, `{} 1`} {
+			if _, err := CanonicalJSON([]byte(value)); err == nil {
+				t.Fatal("expected an error for", value)
+			}
+		}
+	})
+}
+
+// newSignedReport creates a report containing three signed measurements.
+func newSignedReport(t *testing.T) (ed25519.PrivateKey, string) {
+	key, err := LoadOrCreateKey(&kvstore.Memory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reportFile := filepath.Join(t.TempDir(), "report.jsonl")
+	saver := NewSaver(&mocks.Saver{
+		MockSaveMeasurement: func(m *model.Measurement) error {
+			return engine.SaveMeasurement(m, reportFile)
+		},
+	}, reportFile, key)
+	for _, input := range []string{"https://a.com/", "https://b.com/", "https://c.com/"} {
+		m := &model.Measurement{
+			Input:    model.MeasurementInput(input),
+			TestKeys: map[string]any{"body": "<html>\xff</html>", "runtime": 0.25},
+		}
+		if err := saver.SaveMeasurement(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return key, reportFile
+}
+
+// verifyFiles verifies the given report files and returns the status of each line.
+func verifyFiles(t *testing.T, publicKey ed25519.PublicKey, reportFile string) (out []VerifyStatus) {
+	report, err := os.Open(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer report.Close()
+	signatures, err := os.Open(reportFile + SignatureFileSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signatures.Close()
+	results, err := Verify(publicKey, report, signatures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, result := range results {
+		if result.Line != idx+1 {
+			t.Fatal("unexpected line number", result.Line)
+		}
+		out = append(out, result.Status)
+	}
+	return
+}
+
+// editLines rewrites the given file passing each line to fn.
+func editLines(t *testing.T, filename string, fn func(lines []string) []string) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	output := strings.Join(fn(lines), "\n") + "\n"
+	if err := os.WriteFile(filename, []byte(output), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	type testcase struct {
+		name   string
+		edit   func(t *testing.T, reportFile string)
+		expect []VerifyStatus
+	}
+
+	cases := []testcase{{
+		name:   "with an untouched report",
+		edit:   func(t *testing.T, reportFile string) {},
+		expect: []VerifyStatus{VerifyOK, VerifyOK, VerifyOK},
+	}, {
+		name: "with an edited measurement",
+		edit: func(t *testing.T, reportFile string) {
+			editLines(t, reportFile, func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], "b.com", "x.com", 1)
+				return lines
+			})
+		},
+		expect: []VerifyStatus{VerifyOK, VerifyTampered, VerifyOK},
+	}, {
+		name: "with a reformatted measurement",
+		edit: func(t *testing.T, reportFile string) {
+			editLines(t, reportFile, func(lines []string) []string {
+				var buffer bytes.Buffer
+				if err := json.Indent(&buffer, []byte(lines[0]), "", " "); err != nil {
+					t.Fatal(err)
+				}
+				lines[0] = strings.ReplaceAll(buffer.String(), "\n", " ")
+				return lines
+			})
+		},
+		expect: []VerifyStatus{VerifyOK, VerifyOK, VerifyOK},
+	}, {
+		name: "with a removed measurement",
+		edit: func(t *testing.T, reportFile string) {
+			editLines(t, reportFile, func(lines []string) []string {
+				return lines[1:]
+			})
+		},
+		expect: []VerifyStatus{VerifyOK, VerifyOK, VerifyMissing},
+	}, {
+		name: "with reordered measurements",
+		edit: func(t *testing.T, reportFile string) {
+			editLines(t, reportFile, func(lines []string) []string {
+				return []string{lines[2], lines[0], lines[1]}
+			})
+		},
+		expect: []VerifyStatus{VerifyOK, VerifyOK, VerifyOK},
+	}, {
+		name: "with an unsigned measurement in the middle",
+		edit: func(t *testing.T, reportFile string) {
+			editLines(t, reportFile, func(lines []string) []string {
+				return []string{lines[0], `{"input":"https://d.com/"}`, lines[1], lines[2]}
+			})
+		},
+		expect: []VerifyStatus{VerifyOK, VerifyUnsigned, VerifyOK, VerifyOK},
+	}, {
+		name: "with an added measurement",
+		edit: func(t *testing.T, reportFile string) {
+			editLines(t, reportFile, func(lines []string) []string {
+				return append(lines, `{"input":"https://d.com/"}`)
+			})
+		},
+		expect: []VerifyStatus{VerifyOK, VerifyOK, VerifyOK, VerifyUnsigned},
+	}, {
+		name: "with an invalid measurement",
+		edit: func(t *testing.T, reportFile string) {
+			editLines(t, reportFile, func(lines []string) []string {
+				lines[2] = "{"
+				return lines
+			})
+		},
+		expect: []VerifyStatus{VerifyOK, VerifyOK, VerifyInvalid},
+	}, {
+		name: "with an edited signature",
+		edit: func(t *testing.T, reportFile string) {
+			editLines(t, reportFile+SignatureFileSuffix, func(lines []string) []string {
+				lines[0] = strings.Replace(lines[0], `"signature":"`, `"signature":"AAAA`, 1)
+				lines[1] = "{"
+				return lines
+			})
+		},
+		expect: []VerifyStatus{VerifyBadSignature, VerifyInvalid, VerifyOK},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, reportFile := newSignedReport(t)
+			tc.edit(t, reportFile)
+			got := verifyFiles(t, key.Public().(ed25519.PublicKey), reportFile)
+			if diff := cmp.Diff(tc.expect, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+
+	t.Run("with an untrusted key", func(t *testing.T) {
+		_, reportFile := newSignedReport(t)
+		other, err := LoadOrCreateKey(&kvstore.Memory{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := verifyFiles(t, other.Public().(ed25519.PublicKey), reportFile)
+		expect := []VerifyStatus{VerifyUntrustedKey, VerifyUntrustedKey, VerifyUntrustedKey}
+		if diff := cmp.Diff(expect, got); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestSaverFailure(t *testing.T) {
+	expected := errors.New("mocked error")
+	reportFile := filepath.Join(t.TempDir(), "report.jsonl")
+	key, err := LoadOrCreateKey(&kvstore.Memory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var childErr error
+	saver := NewSaver(&mocks.Saver{
+		MockSaveMeasurement: func(m *model.Measurement) error {
+			return childErr
+		},
+	}, reportFile, key)
+	if err := saver.SaveMeasurement(&model.Measurement{Input: "https://www.example.com/"}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(reportFile + SignatureFileSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	childErr = expected
+	if err := saver.SaveMeasurement(&model.Measurement{}); !errors.Is(err, expected) {
+		t.Fatal("unexpected error", err)
+	}
+	after, err := os.ReadFile(reportFile + SignatureFileSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(before, after); diff != "" {
+		t.Fatal("should have removed the signature of the unsaved measurement", diff)
+	}
+}
+
+func TestSaverCannotOpenSignatures(t *testing.T) {
+	reportFile := filepath.Join(t.TempDir(), "nonexistent", "report.jsonl")
+	key, err := LoadOrCreateKey(&kvstore.Memory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saver := NewSaver(&mocks.Saver{
+		MockSaveMeasurement: func(m *model.Measurement) error {
+			panic("should not save the measurement without saving the signature")
+		},
+	}, reportFile, key)
+	if err := saver.SaveMeasurement(&model.Measurement{}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("unexpected error", err)
+	}
+}
@@ -89,3 +89,6 @@ const AddressOpenDNS220 = "208.67.220.220"
 
 // AddressNextDNSIo is a dns.nextdns.io address.
 const AddressNextDNSIo = "38.175.119.129"
+
+// AddressDNSTHOONIOrg is the IP address of the DNS test helper serving the dns.th.ooni.org zone.
+const AddressDNSTHOONIOrg = "161.35.81.17"
@@ -0,0 +1,92 @@
+package netemx
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/ooni/netem"
+	"github.com/ooni/probe-engine/pkg/logx"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/oodnshelperd"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// OODNSHelperDFactory is a [NetStackServerFactory] for the OONI DNS test helper, which
+// serves the given zone using DNS-over-UDP and DNS-over-TCP on port 53.
+type OODNSHelperDFactory struct {
+	// Addresses contains the OPTIONAL addresses for A and AAAA answers.
+	Addresses []string
+
+	// Zone is the MANDATORY zone for which the helper is authoritative.
+	Zone string
+}
+
+var _ NetStackServerFactory = &OODNSHelperDFactory{}
+
+// MustNewServer implements NetStackServerFactory.
+func (f *OODNSHelperDFactory) MustNewServer(env NetStackServerFactoryEnv, stack *netem.UNetStack) NetStackServer {
+	return &ooDNSHelperDServer{
+		addresses: f.Addresses,
+		closers:   []io.Closer{},
+		logger:    env.Logger(),
+		mu:        sync.Mutex{},
+		unet:      stack,
+		zone:      f.Zone,
+	}
+}
+
+type ooDNSHelperDServer struct {
+	addresses []string
+	closers   []io.Closer
+	logger    model.Logger
+	mu        sync.Mutex
+	unet      *netem.UNetStack
+	zone      string
+}
+
+// Close implements NetStackServer.
+func (srv *ooDNSHelperDServer) Close() error {
+	// "this method MUST be CONCURRENCY SAFE"
+	defer srv.mu.Unlock()
+	srv.mu.Lock()
+
+	// make sure we close all the child listeners
+	for _, closer := range srv.closers {
+		_ = closer.Close()
+	}
+
+	// "this method MUST be IDEMPOTENT"
+	srv.closers = []io.Closer{}
+
+	return nil
+}
+
+// MustStart implements NetStackServer.
+func (srv *ooDNSHelperDServer) MustStart() {
+	// "this method MUST be CONCURRENCY SAFE"
+	defer srv.mu.Unlock()
+	srv.mu.Lock()
+
+	// create the handler using a prefix logger
+	logger := &logx.PrefixLogger{
+		Prefix: fmt.Sprintf("%-16s", "DNS_TH"),
+		Logger: srv.logger,
+	}
+	handler := oodnshelperd.NewHandler(logger, srv.zone)
+	handler.Addresses = srv.addresses
+
+	// create the listening sockets
+	ipAddr := net.ParseIP(srv.unet.IPAddress())
+	runtimex.Assert(ipAddr != nil, "invalid IP address")
+	pconn := runtimex.Try1(srv.unet.ListenUDP("udp", &net.UDPAddr{IP: ipAddr, Port: 53}))
+	listener := runtimex.Try1(srv.unet.ListenTCP("tcp", &net.TCPAddr{IP: ipAddr, Port: 53}))
+
+	// serve in the background
+	go handler.Serve(pconn)
+	go handler.ServeTCP(listener)
+
+	// track these closables
+	srv.closers = append(srv.closers, pconn, listener)
+}
@@ -0,0 +1,39 @@
+package netemx
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+func TestOODNSHelperDFactory(t *testing.T) {
+	env := MustNewQAEnv(QAEnvOptionNetStack(AddressDNSTHOONIOrg, &OODNSHelperDFactory{
+		Addresses: []string{AddressDNSTHOONIOrg},
+		Zone:      "dns.th.ooni.org",
+	}))
+	defer env.Close()
+
+	env.Do(func() {
+		netx := &netxlite.Netx{}
+		dialer := netx.NewDialerWithoutResolver(log.Log)
+		endpoint := net.JoinHostPort(AddressDNSTHOONIOrg, "53")
+		txp := netxlite.NewUnwrappedDNSOverTCPTransport(dialer.DialContext, endpoint)
+		for _, reso := range []model.Resolver{
+			netx.NewParallelUDPResolver(log.Log, dialer, endpoint),
+			netxlite.WrapResolver(log.Log, netxlite.NewUnwrappedParallelResolver(txp)),
+		} {
+			addrs, err := reso.LookupHost(context.Background(), "xyzzy.dns.th.ooni.org")
+			if err != nil {
+				t.Fatal(reso.Network(), err)
+			}
+			if diff := cmp.Diff([]string{AddressDNSTHOONIOrg}, addrs); diff != "" {
+				t.Fatal(reso.Network(), diff)
+			}
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package netxlite
+
+//
+// Selecting the TLS ClientHello fingerprint by name
+//
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	utls "gitlab.com/yawning/utls.git"
+)
+
+// ClientHelloGolang is the name of the ClientHello fingerprint of the Go standard library,
+// which is what we use by default when the fingerprint name is empty.
+const ClientHelloGolang = "golang"
+
+// HelloAndroid11OkHttp is the [utls.ClientHelloID] mimicking the ClientHello
+// sent by the OkHttp library on Android 11. Because yawning/utls does not
+// include this parrot, we implement it using a custom [utls.ClientHelloSpec].
+var HelloAndroid11OkHttp = utls.ClientHelloID{
+	Client:  "Android",
+	Version: "11-OkHttp",
+	Seed:    nil,
+}
+
+// clientHelloIDs maps each fingerprint name to the corresponding [utls.ClientHelloID].
+//
+// Note that we map "safari" to the iOS parrot because yawning/utls does not include a
+// macOS Safari parrot and Safari on iOS and on macOS share the same TLS stack.
+var clientHelloIDs = map[string]*utls.ClientHelloID{
+	"android":    &HelloAndroid11OkHttp,
+	"chrome":     &utls.HelloChrome_Auto,
+	"firefox":    &utls.HelloFirefox_Auto,
+	"ios":        &utls.HelloIOS_Auto,
+	"randomized": &utls.HelloRandomized,
+	"safari":     &utls.HelloIOS_Auto,
+}
+
+// ErrUnknownClientHelloID indicates that we don't know the ClientHello fingerprint name.
+var ErrUnknownClientHelloID = errors.New("netxlite: unknown ClientHello fingerprint")
+
+// ParseClientHelloID maps the given ClientHello fingerprint name to the corresponding
+// [utls.ClientHelloID]. The supported names are the ones returned by [ClientHelloIDNames].
+//
+// This function returns a nil [utls.ClientHelloID] and a nil error for [ClientHelloGolang]
+// and for the empty string, meaning that the caller should use the standard library.
+func ParseClientHelloID(name string) (*utls.ClientHelloID, error) {
+	if name == "" || name == ClientHelloGolang {
+		return nil, nil
+	}
+	id, found := clientHelloIDs[name]
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownClientHelloID, name)
+	}
+	return id, nil
+}
+
+// ClientHelloIDNames returns the sorted list of the supported ClientHello fingerprint names.
+func ClientHelloIDNames() []string {
+	names := []string{ClientHelloGolang}
+	for name := range clientHelloIDs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// utlsCustomSpecs maps the [utls.ClientHelloID] values we implement using a custom
+// [utls.ClientHelloSpec] to a function returning such a spec. We use functions because
+// utls shares the slices inside a spec across all the conns using such a spec.
+var utlsCustomSpecs = map[utls.ClientHelloID]func() *utls.ClientHelloSpec{
+	HelloAndroid11OkHttp: newUTLSAndroid11OkHttpSpec,
+}
+
+// newUTLSAndroid11OkHttpSpec returns the [utls.ClientHelloSpec] for [HelloAndroid11OkHttp].
+//
+// See https://github.com/refraction-networking/utls/blob/v1.6.7/u_parrots.go.
+func newUTLSAndroid11OkHttpSpec() *utls.ClientHelloSpec {
+	return &utls.ClientHelloSpec{
+		CipherSuites: []uint16{
+			utls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			utls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			utls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			utls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			utls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			utls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			utls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+			utls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+			utls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+			utls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+			utls.TLS_RSA_WITH_AES_128_CBC_SHA,
+			utls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		},
+		CompressionMethods: []uint8{
+			0x00, // compressionNone
+		},
+		Extensions: []utls.TLSExtension{
+			&utls.SNIExtension{},
+			&utls.UtlsExtendedMasterSecretExtension{},
+			&utls.RenegotiationInfoExtension{
+				Renegotiation: utls.RenegotiateOnceAsClient,
+			},
+			&utls.SupportedCurvesExtension{
+				Curves: []utls.CurveID{
+					utls.X25519,
+					utls.CurveP256,
+					utls.CurveP384,
+				},
+			},
+			&utls.SupportedPointsExtension{
+				SupportedPoints: []uint8{
+					0x00, // pointFormatUncompressed
+				},
+			},
+			&utls.StatusRequestExtension{},
+			&utls.SignatureAlgorithmsExtension{
+				SupportedSignatureAlgorithms: []utls.SignatureScheme{
+					utls.ECDSAWithP256AndSHA256,
+					utls.PSSWithSHA256,
+					utls.PKCS1WithSHA256,
+					utls.ECDSAWithP384AndSHA384,
+					utls.PSSWithSHA384,
+					utls.PKCS1WithSHA384,
+					utls.PSSWithSHA512,
+					utls.PKCS1WithSHA512,
+					utls.PKCS1WithSHA1,
+				},
+			},
+		},
+		TLSVersMin:   0,
+		TLSVersMax:   0,
+		GetSessionID: nil,
+	}
+}
@@ -0,0 +1,131 @@
+package netxlite
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/netem"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/testingx"
+	utls "gitlab.com/yawning/utls.git"
+)
+
+func TestParseClientHelloID(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *utls.ClientHelloID
+		wantErr error
+	}{{
+		name:    "with the empty string",
+		input:   "",
+		want:    nil,
+		wantErr: nil,
+	}, {
+		name:    "with golang",
+		input:   "golang",
+		want:    nil,
+		wantErr: nil,
+	}, {
+		name:    "with android",
+		input:   "android",
+		want:    &HelloAndroid11OkHttp,
+		wantErr: nil,
+	}, {
+		name:    "with chrome",
+		input:   "chrome",
+		want:    &utls.HelloChrome_Auto,
+		wantErr: nil,
+	}, {
+		name:    "with firefox",
+		input:   "firefox",
+		want:    &utls.HelloFirefox_Auto,
+		wantErr: nil,
+	}, {
+		name:    "with ios",
+		input:   "ios",
+		want:    &utls.HelloIOS_Auto,
+		wantErr: nil,
+	}, {
+		name:    "with randomized",
+		input:   "randomized",
+		want:    &utls.HelloRandomized,
+		wantErr: nil,
+	}, {
+		name:    "with safari",
+		input:   "safari",
+		want:    &utls.HelloIOS_Auto,
+		wantErr: nil,
+	}, {
+		name:    "with an unknown name",
+		input:   "netscape",
+		want:    nil,
+		wantErr: ErrUnknownClientHelloID,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClientHelloID(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatal("unexpected error", err)
+			}
+			if got != tt.want {
+				t.Fatal("unexpected ClientHelloID", got)
+			}
+		})
+	}
+}
+
+func TestClientHelloIDNames(t *testing.T) {
+	expect := []string{"android", "chrome", "firefox", "golang", "ios", "randomized", "safari"}
+	if diff := cmp.Diff(expect, ClientHelloIDNames()); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestClientHelloIDHandshake(t *testing.T) {
+	ca := netem.MustNewCA()
+	cert := ca.MustNewTLSCertificate("dns.google")
+	server := testingx.MustNewTLSServer(testingx.TLSHandlerHandshakeAndWriteText(cert, testingx.HTTPBlockpage451))
+	defer server.Close()
+
+	for _, name := range ClientHelloIDNames() {
+		t.Run(name, func(t *testing.T) {
+			id, err := ParseClientHelloID(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			netx := &Netx{}
+			thx := netx.NewTLSHandshakerStdlib(model.DiscardLogger)
+			if id != nil {
+				thx = netx.NewTLSHandshakerUTLS(model.DiscardLogger, id)
+			}
+			ctx := context.Background()
+			conn, err := net.Dial("tcp", server.Endpoint())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			tlsConfig := &tls.Config{
+				RootCAs:    ca.DefaultCertPool(),
+				ServerName: "dns.google",
+			}
+			tlsConn, err := thx.Handshake(ctx, conn, tlsConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tlsConn.Close()
+			data, err := ReadAllContext(ctx, tlsConn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, testingx.HTTPBlockpage451) {
+				t.Fatal("bytes should match")
+			}
+		})
+	}
+}
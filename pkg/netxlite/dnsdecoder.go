@@ -7,6 +7,8 @@ package netxlite
 import (
 	"errors"
 	"net"
+	"slices"
+	"sort"
 
 	"github.com/miekg/dns"
 	"github.com/ooni/probe-engine/pkg/model"
@@ -98,35 +100,77 @@ func (r *dnsResponse) DecodeHTTPS() (*model.HTTPSSvc, error) {
 		return nil, err // error already wrapped
 	}
 	out := &model.HTTPSSvc{
-		ALPN: []string{}, // ensure it's not nil
-		IPv4: []string{}, // ensure it's not nil
-		IPv6: []string{}, // ensure it's not nil
+		ALPN:    []string{}, // ensure it's not nil
+		IPv4:    []string{}, // ensure it's not nil
+		IPv6:    []string{}, // ensure it's not nil
+		Records: []*model.HTTPSSvcRecord{},
 	}
 	for _, answer := range r.msg.Answer {
-		switch avalue := answer.(type) {
-		case *dns.HTTPS:
-			for _, v := range avalue.Value {
-				switch extv := v.(type) {
-				case *dns.SVCBAlpn:
-					out.ALPN = extv.Alpn
-				case *dns.SVCBIPv4Hint:
-					for _, ip := range extv.Hint {
-						out.IPv4 = append(out.IPv4, ip.String())
-					}
-				case *dns.SVCBIPv6Hint:
-					for _, ip := range extv.Hint {
-						out.IPv6 = append(out.IPv6, ip.String())
-					}
-				}
-			}
+		if avalue, ok := answer.(*dns.HTTPS); ok {
+			out.Records = append(out.Records, dnsDecodeSVCB(&avalue.SVCB))
 		}
 	}
-	if len(out.IPv4) <= 0 && len(out.IPv6) <= 0 {
+	if len(out.Records) <= 0 {
 		return nil, dnsDecoderWrapError(ErrOODNSNoAnswer)
 	}
+	sort.SliceStable(out.Records, func(i, j int) bool {
+		return out.Records[i].Priority < out.Records[j].Priority
+	})
+	for _, record := range out.Records {
+		for _, alpn := range record.ALPN {
+			if !slices.Contains(out.ALPN, alpn) {
+				out.ALPN = append(out.ALPN, alpn)
+			}
+		}
+		out.IPv4 = append(out.IPv4, record.IPv4...)
+		out.IPv6 = append(out.IPv6, record.IPv6...)
+		if len(out.ECHConfig) <= 0 {
+			out.ECHConfig = record.ECHConfig
+		}
+	}
 	return out, nil
 }
 
+// dnsDecodeSVCB converts a [*dns.SVCB] to a [*model.HTTPSSvcRecord].
+func dnsDecodeSVCB(rr *dns.SVCB) *model.HTTPSSvcRecord {
+	out := &model.HTTPSSvcRecord{
+		Priority:   rr.Priority,
+		TargetName: rr.Target,
+		TTL:        rr.Hdr.Ttl,
+		ALPN:       []string{}, // ensure it's not nil
+		Mandatory:  []string{}, // ensure it's not nil
+		IPv4:       []string{}, // ensure it's not nil
+		IPv6:       []string{}, // ensure it's not nil
+		Params:     map[string]string{},
+	}
+	for _, v := range rr.Value {
+		out.Params[v.Key().String()] = v.String()
+		switch extv := v.(type) {
+		case *dns.SVCBMandatory:
+			for _, key := range extv.Code {
+				out.Mandatory = append(out.Mandatory, key.String())
+			}
+		case *dns.SVCBAlpn:
+			out.ALPN = append(out.ALPN, extv.Alpn...)
+		case *dns.SVCBNoDefaultAlpn:
+			out.NoDefaultALPN = true
+		case *dns.SVCBPort:
+			out.Port = extv.Port
+		case *dns.SVCBIPv4Hint:
+			for _, ip := range extv.Hint {
+				out.IPv4 = append(out.IPv4, ip.String())
+			}
+		case *dns.SVCBECHConfig:
+			out.ECHConfig = extv.ECH
+		case *dns.SVCBIPv6Hint:
+			for _, ip := range extv.Hint {
+				out.IPv6 = append(out.IPv6, ip.String())
+			}
+		}
+	}
+	return out
+}
+
 // DecodeLookupHost implements model.DNSResponse.DecodeLookupHost.
 func (r *dnsResponse) DecodeLookupHost() ([]string, error) {
 	if err := r.rcodeToError(); err != nil {
@@ -9,6 +9,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/miekg/dns"
 	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
 	"github.com/ooni/probe-engine/pkg/runtimex"
 )
 
@@ -216,7 +217,7 @@ func TestDNSDecoderMiekg(t *testing.T) {
 				d := &DNSDecoderMiekg{}
 				queryID := dns.Id()
 				rawQuery := dnsGenQuery(dns.TypeHTTPS, queryID)
-				rawResponse := dnsGenHTTPSReplySuccess(rawQuery, nil, nil, nil)
+				rawResponse := dnsGenReplyWithError(rawQuery, dns.RcodeSuccess)
 				query := &mocks.DNSQuery{
 					MockID: func() uint16 {
 						return queryID
@@ -269,6 +270,104 @@ func TestDNSDecoderMiekg(t *testing.T) {
 					t.Fatal(diff)
 				}
 			})
+
+			t.Run("with an AliasMode answer", func(t *testing.T) {
+				d := &DNSDecoderMiekg{}
+				queryID := dns.Id()
+				rawQuery := dnsGenQuery(dns.TypeHTTPS, queryID)
+				rawResponse := dnsGenHTTPSReplySuccess(rawQuery, nil, nil, nil)
+				query := &mocks.DNSQuery{
+					MockID: func() uint16 {
+						return queryID
+					},
+				}
+				resp, err := d.DecodeResponse(rawResponse, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				reply, err := resp.DecodeHTTPS()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(reply.Records) != 1 || !reply.Records[0].IsAliasMode() {
+					t.Fatal("expected a single AliasMode record")
+				}
+				if reply.Records[0].TargetName != "x.org." {
+					t.Fatal("unexpected target name", reply.Records[0].TargetName)
+				}
+				if len(reply.IPv4) != 0 || len(reply.IPv6) != 0 {
+					t.Fatal("expected no hints")
+				}
+			})
+
+			t.Run("with multiple ServiceMode answers", func(t *testing.T) {
+				d := &DNSDecoderMiekg{}
+				queryID := dns.Id()
+				rawQuery := dnsGenQuery(dns.TypeHTTPS, queryID)
+				rawResponse := dnsGenHTTPSReplyWithRecords(
+					rawQuery,
+					"x.org. 100 IN HTTPS 2 . alpn=h2 ipv4hint=2.2.2.2 ech=AQID",
+					"x.org. 100 IN HTTPS 1 svc.x.org. mandatory=alpn,port alpn=h3,h2 no-default-alpn port=8443 ipv4hint=1.1.1.1 ech=BAUG ipv6hint=::1 key65000=foo",
+				)
+				query := &mocks.DNSQuery{
+					MockID: func() uint16 {
+						return queryID
+					},
+				}
+				resp, err := d.DecodeResponse(rawResponse, query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				reply, err := resp.DecodeHTTPS()
+				if err != nil {
+					t.Fatal(err)
+				}
+				expect := &model.HTTPSSvc{
+					ALPN:      []string{"h3", "h2"},
+					IPv4:      []string{"1.1.1.1", "2.2.2.2"},
+					IPv6:      []string{"::1"},
+					ECHConfig: []byte{4, 5, 6},
+					Records: []*model.HTTPSSvcRecord{{
+						Priority:      1,
+						TargetName:    "svc.x.org.",
+						TTL:           100,
+						ALPN:          []string{"h3", "h2"},
+						NoDefaultALPN: true,
+						Port:          8443,
+						Mandatory:     []string{"alpn", "port"},
+						IPv4:          []string{"1.1.1.1"},
+						IPv6:          []string{"::1"},
+						ECHConfig:     []byte{4, 5, 6},
+						Params: map[string]string{
+							"mandatory":       "alpn,port",
+							"alpn":            "h3,h2",
+							"no-default-alpn": "",
+							"port":            "8443",
+							"ipv4hint":        "1.1.1.1",
+							"ech":             "BAUG",
+							"ipv6hint":        "::1",
+							"key65000":        "foo",
+						},
+					}, {
+						Priority:   2,
+						TargetName: ".",
+						TTL:        100,
+						ALPN:       []string{"h2"},
+						Mandatory:  []string{},
+						IPv4:       []string{"2.2.2.2"},
+						IPv6:       []string{},
+						ECHConfig:  []byte{1, 2, 3},
+						Params: map[string]string{
+							"alpn":     "h2",
+							"ipv4hint": "2.2.2.2",
+							"ech":      "AQID",
+						},
+					}},
+				}
+				if diff := cmp.Diff(expect, reply); diff != "" {
+					t.Fatal(diff)
+				}
+			})
 		})
 
 		t.Run("dnsResponse.DecodeNS", func(t *testing.T) {
@@ -755,6 +854,26 @@ func dnsGenHTTPSReplySuccess(rawQuery []byte, alpns, ipv4s, ipv6s []string) []by
 	return data
 }
 
+// dnsGenHTTPSReplyWithRecords generates a successful HTTPS response containing
+// the given HTTPS records written in presentation format.
+func dnsGenHTTPSReplyWithRecords(rawQuery []byte, records ...string) []byte {
+	query := new(dns.Msg)
+	err := query.Unpack(rawQuery)
+	runtimex.PanicOnError(err, "query.Unpack failed")
+	reply := new(dns.Msg)
+	reply.Compress = true
+	reply.MsgHdr.RecursionAvailable = true
+	reply.SetReply(query)
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		runtimex.PanicOnError(err, "dns.NewRR failed")
+		reply.Answer = append(reply.Answer, rr)
+	}
+	data, err := reply.Pack()
+	runtimex.PanicOnError(err, "reply.Pack failed")
+	return data
+}
+
 // dnsGenNSReplySuccess generates a successful NS reply using the given names.
 func dnsGenNSReplySuccess(rawQuery []byte, names ...string) []byte {
 	query := new(dns.Msg)
@@ -0,0 +1,341 @@
+package netxlite
+
+//
+// Oblivious DNS-over-HTTPS transport
+//
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/odoh"
+)
+
+// DNSOverODoHTransport is an Oblivious DNS-over-HTTPS DNSTransport (see RFC9230).
+//
+// We fetch the target's ObliviousDoHConfigs directly from the target using
+// the well-known URL and then send encrypted queries through the proxy. Because
+// we use the same HTTP client for both operations, the TLS handshakes with the
+// proxy and with the target end up in the same archival data.
+type DNSOverODoHTransport struct {
+	// Client is the MANDATORY http client to use.
+	Client model.HTTPClient
+
+	// Decoder is the MANDATORY DNSDecoder.
+	Decoder model.DNSDecoder
+
+	// URL is the MANDATORY odoh://PROXY/TARGET URL.
+	URL string
+
+	// call is the OPTIONAL fetch of the target config in progress.
+	call *odohConfigCall
+
+	// config caches the target config.
+	config *odoh.Config
+
+	// expiresAt is when the cached config expires.
+	expiresAt time.Time
+
+	// mu protects call, config, and expiresAt.
+	mu sync.Mutex
+
+	// timeNow is the OPTIONAL function returning the current time.
+	timeNow func() time.Time
+}
+
+// odohConfigCall is a fetch of the target config in progress.
+type odohConfigCall struct {
+	// done is closed when the fetch is done.
+	done chan any
+
+	// config is the fetched config or nil.
+	config *odoh.Config
+
+	// err is the error that occurred or nil.
+	err error
+
+	// canceled indicates that the fetch failed because the context of the
+	// goroutine performing the fetch was done.
+	canceled bool
+}
+
+const (
+	// odohDefaultConfigLifetime is how long we cache the target config
+	// when the response does not specify its cache lifetime.
+	odohDefaultConfigLifetime = 10 * time.Minute
+
+	// odohMaxConfigLifetime is the maximum amount of time for which
+	// we cache the target config.
+	odohMaxConfigLifetime = 24 * time.Hour
+)
+
+// NewUnwrappedDNSOverODoHTransport creates a new DNSOverODoHTransport
+// instance that has not been wrapped yet.
+//
+// Arguments:
+//
+// - client is a model.HTTPClient type;
+//
+// - URL is the ODoH URL, which has the odoh://PROXY/TARGET form where PROXY is
+// the proxy domain and TARGET is the target domain. Both may contain an explicit
+// port. TARGET may be followed by a path, which defaults to /dns-query. For
+// example, odoh://odoh1.surfdomeinen.nl/odoh.cloudflare-dns.com/dns-query.
+func NewUnwrappedDNSOverODoHTransport(client model.HTTPClient, URL string) *DNSOverODoHTransport {
+	return &DNSOverODoHTransport{
+		Client:  client,
+		Decoder: &DNSDecoderMiekg{},
+		URL:     URL,
+	}
+}
+
+// NewDNSOverODoHTransport is like NewUnwrappedDNSOverODoHTransport but
+// returns an already wrapped DNSTransport.
+func NewDNSOverODoHTransport(client model.HTTPClient, URL string) model.DNSTransport {
+	return wrapDNSTransport(NewUnwrappedDNSOverODoHTransport(client, URL))
+}
+
+// NewDNSOverODoHTransportWithHTTPTransport is like NewDNSOverODoHTransport
+// but takes in input an HTTPTransport rather than an HTTPClient.
+func NewDNSOverODoHTransportWithHTTPTransport(txp model.HTTPTransport, URL string) model.DNSTransport {
+	return wrapDNSTransport(NewUnwrappedDNSOverODoHTransport(NewHTTPClient(txp), URL))
+}
+
+// errInvalidODoHURL indicates that the ODoH URL is invalid.
+var errInvalidODoHURL = errors.New("odoh: invalid URL")
+
+// odohEndpoints contains the URLs derived from the odoh:// URL.
+type odohEndpoints struct {
+	// configsURL is the URL from which to fetch the target configs.
+	configsURL string
+
+	// proxyURL is the URL to which we POST the queries.
+	proxyURL string
+}
+
+// parseODoHURL parses the odoh:// URL and returns the corresponding endpoints.
+func parseODoHURL(URL string) (*odohEndpoints, error) {
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "odoh" || parsed.Host == "" {
+		return nil, errInvalidODoHURL
+	}
+	targetHost, targetPath, _ := strings.Cut(strings.TrimPrefix(parsed.Path, "/"), "/")
+	if targetHost == "" {
+		return nil, errInvalidODoHURL
+	}
+	targetPath = "/" + targetPath
+	if targetPath == "/" {
+		targetPath = "/dns-query"
+	}
+	configsURL := &url.URL{Scheme: "https", Host: targetHost, Path: odoh.ConfigsPath}
+	query := url.Values{}
+	query.Set("targethost", targetHost)
+	query.Set("targetpath", targetPath)
+	proxyURL := &url.URL{Scheme: "https", Host: parsed.Host, Path: "/proxy", RawQuery: query.Encode()}
+	return &odohEndpoints{configsURL: configsURL.String(), proxyURL: proxyURL.String()}, nil
+}
+
+// RoundTrip sends a query and receives a reply.
+func (t *DNSOverODoHTransport) RoundTrip(
+	ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+	endpoints, err := parseODoHURL(t.URL)
+	if err != nil {
+		return nil, err
+	}
+	rawQuery, err := query.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 45*time.Second)
+	defer cancel()
+	config, err := t.getConfig(ctx, endpoints.configsURL)
+	if err != nil {
+		return nil, err
+	}
+	encryptedQuery, qctx, err := odoh.EncryptQuery(config, rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", endpoints.proxyURL, bytes.NewReader(encryptedQuery))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("user-agent", model.HTTPHeaderUserAgent)
+	req.Header.Set("content-type", odoh.ContentType)
+	req.Header.Set("accept", odoh.ContentType)
+	_, encryptedResponse, err := t.do(ctx, req, odoh.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	rawResponse, err := qctx.DecryptResponse(encryptedResponse)
+	if err != nil {
+		return nil, err
+	}
+	return t.Decoder.DecodeResponse(rawResponse, query)
+}
+
+// getConfig returns the cached config or fetches it from the target. We do not
+// hold the mutex while fetching and concurrent callers share the same fetch.
+func (t *DNSOverODoHTransport) getConfig(ctx context.Context, URL string) (*odoh.Config, error) {
+	for {
+		t.mu.Lock()
+
+		// handle the case where the config is cached
+		if t.config != nil && t.now().Before(t.expiresAt) {
+			config := t.config
+			t.mu.Unlock()
+			return config, nil
+		}
+
+		// handle the case where we are the first to fetch
+		call := t.call
+		if call == nil {
+			call = &odohConfigCall{done: make(chan any)}
+			t.call = call
+			t.mu.Unlock()
+			return t.fetchConfig(ctx, URL, call)
+		}
+
+		// wait for the fetch in progress
+		t.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		// retry ourselves if the fetch failed only because of its context
+		if !call.canceled {
+			return call.config, call.err
+		}
+	}
+}
+
+// fetchConfig fetches the config from the target, caches it, and notifies
+// the goroutines waiting for the given call.
+func (t *DNSOverODoHTransport) fetchConfig(ctx context.Context, URL string, call *odohConfigCall) (*odoh.Config, error) {
+	var lifetime time.Duration
+	call.config, lifetime, call.err = t.doFetchConfig(ctx, URL)
+	call.canceled = call.err != nil && ctx.Err() != nil
+
+	t.mu.Lock()
+	t.call = nil
+	if call.err == nil {
+		t.config = call.config
+		t.expiresAt = t.now().Add(lifetime)
+	}
+	t.mu.Unlock()
+
+	close(call.done)
+	return call.config, call.err
+}
+
+// doFetchConfig fetches the config from the target and returns the
+// config along with the amount of time for which we can cache it.
+func (t *DNSOverODoHTransport) doFetchConfig(ctx context.Context, URL string) (*odoh.Config, time.Duration, error) {
+	req, err := http.NewRequest("GET", URL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("user-agent", model.HTTPHeaderUserAgent)
+	header, rawConfigs, err := t.do(ctx, req, "")
+	if err != nil {
+		return nil, 0, err
+	}
+	configs, err := odoh.ParseConfigs(rawConfigs)
+	if err != nil {
+		return nil, 0, err
+	}
+	return configs[0], odohConfigLifetime(header, t.now()), nil
+}
+
+// odohConfigLifetime returns the cache lifetime of the target config given
+// the response headers. We honour the max-age, no-cache, and no-store directives
+// of the Cache-Control header and the Expires header.
+func odohConfigLifetime(header http.Header, now time.Time) time.Duration {
+	for _, directive := range strings.Split(header.Get("cache-control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0
+		case "max-age":
+			seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+			if err != nil || seconds < 0 {
+				return 0
+			}
+			return min(time.Duration(seconds)*time.Second, odohMaxConfigLifetime)
+		}
+	}
+	if value := header.Get("expires"); value != "" {
+		expires, err := http.ParseTime(value)
+		if err != nil || !expires.After(now) {
+			return 0
+		}
+		return min(expires.Sub(now), odohMaxConfigLifetime)
+	}
+	return odohDefaultConfigLifetime
+}
+
+// now returns the current time.
+func (t *DNSOverODoHTransport) now() time.Time {
+	if t.timeNow != nil {
+		return t.timeNow()
+	}
+	return time.Now()
+}
+
+// do sends the request and returns the response headers and body. When contentType
+// is not empty, we also ensure the response has such a content type.
+func (t *DNSOverODoHTransport) do(ctx context.Context, req *http.Request, contentType string) (http.Header, []byte, error) {
+	resp, err := t.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, nil, errors.New("odoh: server returned error")
+	}
+	if contentType != "" && resp.Header.Get("content-type") != contentType {
+		return nil, nil, errors.New("odoh: invalid content-type")
+	}
+	const maxresponsesize = 1 << 20
+	limitReader := io.LimitReader(resp.Body, maxresponsesize)
+	body, err := ReadAllContext(ctx, limitReader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Header, body, nil
+}
+
+// RequiresPadding returns true for ODoH as we do for DoH.
+func (t *DNSOverODoHTransport) RequiresPadding() bool {
+	return true
+}
+
+// Network returns the transport network, i.e., "odoh".
+func (t *DNSOverODoHTransport) Network() string {
+	return "odoh"
+}
+
+// Address returns the odoh:// URL we're using.
+func (t *DNSOverODoHTransport) Address() string {
+	return t.URL
+}
+
+// CloseIdleConnections closes idle connections, if any.
+func (t *DNSOverODoHTransport) CloseIdleConnections() {
+	t.Client.CloseIdleConnections()
+}
+
+var _ model.DNSTransport = &DNSOverODoHTransport{}
@@ -0,0 +1,468 @@
+package netxlite
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/circl/hpke"
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+	"github.com/ooni/netem"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/odoh"
+	"github.com/ooni/probe-engine/pkg/testingx"
+)
+
+func TestParseODoHURL(t *testing.T) {
+	type testconfig struct {
+		name      string
+		URL       string
+		expectErr error
+		expect    *odohEndpoints
+	}
+
+	testcases := []testconfig{{
+		name: "with the default target path",
+		URL:  "odoh://proxy.example.com/target.example.com",
+		expect: &odohEndpoints{
+			configsURL: "https://target.example.com/.well-known/odohconfigs",
+			proxyURL:   "https://proxy.example.com/proxy?targethost=target.example.com&targetpath=%2Fdns-query",
+		},
+	}, {
+		name: "with explicit ports and path",
+		URL:  "odoh://proxy.example.com:8443/target.example.com:4443/custom/path",
+		expect: &odohEndpoints{
+			configsURL: "https://target.example.com:4443/.well-known/odohconfigs",
+			proxyURL:   "https://proxy.example.com:8443/proxy?targethost=target.example.com%3A4443&targetpath=%2Fcustom%2Fpath",
+		},
+	}, {
+		name:      "with the wrong scheme",
+		URL:       "https://proxy.example.com/target.example.com",
+		expectErr: errInvalidODoHURL,
+	}, {
+		name:      "without the proxy",
+		URL:       "odoh:///target.example.com",
+		expectErr: errInvalidODoHURL,
+	}, {
+		name:      "without the target",
+		URL:       "odoh://proxy.example.com/",
+		expectErr: errInvalidODoHURL,
+	}}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoints, err := parseODoHURL(tc.URL)
+			if !errors.Is(err, tc.expectErr) {
+				t.Fatal("unexpected error", err)
+			}
+			if diff := cmp.Diff(tc.expect, endpoints, cmp.AllowUnexported(odohEndpoints{})); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+
+	t.Run("with an unparseable URL", func(t *testing.T) {
+		endpoints, err := parseODoHURL("\t")
+		if err == nil || !strings.HasSuffix(err.Error(), "invalid control character in URL") {
+			t.Fatal("unexpected error", err)
+		}
+		if endpoints != nil {
+			t.Fatal("expected nil endpoints")
+		}
+	})
+}
+
+func TestDNSOverODoHTransport(t *testing.T) {
+	const odohURL = "odoh://proxy.example.com/target.example.com"
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		t.Run("with an invalid URL", func(t *testing.T) {
+			txp := NewUnwrappedDNSOverODoHTransport(&mocks.HTTPClient{}, "https://dns.google/dns-query")
+			resp, err := txp.RoundTrip(context.Background(), &mocks.DNSQuery{})
+			if !errors.Is(err, errInvalidODoHURL) {
+				t.Fatal("unexpected err", err)
+			}
+			if resp != nil {
+				t.Fatal("expected nil response here")
+			}
+		})
+
+		t.Run("query serialization failure", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			txp := NewUnwrappedDNSOverODoHTransport(&mocks.HTTPClient{}, odohURL)
+			query := &mocks.DNSQuery{
+				MockBytes: func() ([]byte, error) {
+					return nil, expected
+				},
+			}
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if resp != nil {
+				t.Fatal("expected nil response here")
+			}
+		})
+
+		// newClient returns a client that always returns the given response or error.
+		newClient := func(resp *http.Response, err error) *mocks.HTTPClient {
+			return &mocks.HTTPClient{
+				MockDo: func(req *http.Request) (*http.Response, error) {
+					return resp, err
+				},
+			}
+		}
+
+		// query is a query that can be serialized.
+		query := &mocks.DNSQuery{
+			MockBytes: func() ([]byte, error) {
+				return make([]byte, 17), nil
+			},
+		}
+
+		t.Run("we cannot fetch the configs", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			txp := NewUnwrappedDNSOverODoHTransport(newClient(nil, expected), odohURL)
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if resp != nil {
+				t.Fatal("expected nil response here")
+			}
+		})
+
+		t.Run("the target returns an error when fetching the configs", func(t *testing.T) {
+			client := newClient(&http.Response{
+				StatusCode: 500,
+				Body:       io.NopCloser(bytes.NewReader(nil)),
+			}, nil)
+			txp := NewUnwrappedDNSOverODoHTransport(client, odohURL)
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if err == nil || err.Error() != "odoh: server returned error" {
+				t.Fatal("unexpected err", err)
+			}
+			if resp != nil {
+				t.Fatal("expected nil response here")
+			}
+		})
+
+		t.Run("the target returns invalid configs", func(t *testing.T) {
+			client := newClient(&http.Response{
+				StatusCode: 200,
+				Body:       io.NopCloser(bytes.NewReader([]byte{1, 2, 3})),
+			}, nil)
+			txp := NewUnwrappedDNSOverODoHTransport(client, odohURL)
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if !errors.Is(err, odoh.ErrInvalidMessage) {
+				t.Fatal("unexpected err", err)
+			}
+			if resp != nil {
+				t.Fatal("expected nil response here")
+			}
+		})
+
+		// newClientWithConfigs returns a client that serves valid configs and
+		// otherwise returns the given response for queries.
+		newClientWithConfigs := func(queryResp *http.Response) *mocks.HTTPClient {
+			kp, err := odoh.NewKeyPair(hpke.KEM_X25519_HKDF_SHA256, hpke.KDF_HKDF_SHA256, hpke.AEAD_AES128GCM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return &mocks.HTTPClient{
+				MockDo: func(req *http.Request) (*http.Response, error) {
+					if req.Method == "GET" {
+						return &http.Response{
+							StatusCode: 200,
+							Body:       io.NopCloser(bytes.NewReader(odoh.MarshalConfigs(kp.Config))),
+						}, nil
+					}
+					return queryResp, nil
+				},
+			}
+		}
+
+		t.Run("the proxy returns an invalid content-type", func(t *testing.T) {
+			client := newClientWithConfigs(&http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {"text/plain"}},
+				Body:       io.NopCloser(bytes.NewReader(nil)),
+			})
+			txp := NewUnwrappedDNSOverODoHTransport(client, odohURL)
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if err == nil || err.Error() != "odoh: invalid content-type" {
+				t.Fatal("unexpected err", err)
+			}
+			if resp != nil {
+				t.Fatal("expected nil response here")
+			}
+		})
+
+		t.Run("the proxy returns an invalid message", func(t *testing.T) {
+			client := newClientWithConfigs(&http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {odoh.ContentType}},
+				Body:       io.NopCloser(bytes.NewReader([]byte{1, 2, 3})),
+			})
+			txp := NewUnwrappedDNSOverODoHTransport(client, odohURL)
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if !errors.Is(err, odoh.ErrInvalidMessage) {
+				t.Fatal("unexpected err", err)
+			}
+			if resp != nil {
+				t.Fatal("expected nil response here")
+			}
+		})
+
+		t.Run("successful case with a local proxy and target", func(t *testing.T) {
+			ca := netem.MustNewCA()
+			tlsConfig := ca.MustNewServerTLSConfig("proxy.example.com", "target.example.com")
+
+			// newServer starts an HTTPS server using the given handler.
+			newServer := func(handler http.Handler) *httptest.Server {
+				srv := httptest.NewUnstartedServer(handler)
+				srv.TLS = tlsConfig
+				srv.StartTLS()
+				return srv
+			}
+
+			// newClient returns a client connecting to the given servers.
+			newClient := func(servers map[string]*httptest.Server) *http.Client {
+				return &http.Client{Transport: &http.Transport{
+					DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+						srv, found := servers[address]
+						if !found {
+							return nil, errors.New("no such host")
+						}
+						return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+					},
+					TLSClientConfig: &tls.Config{RootCAs: ca.DefaultCertPool()},
+				}}
+			}
+
+			dnsConfig := netem.NewDNSConfig()
+			dnsConfig.AddRecord("example.com", "", "93.184.216.34")
+			target := newServer(testingx.MustNewODoHTargetHandler(testingx.NewDNSRoundTripperWithDNSConfig(dnsConfig)))
+			defer target.Close()
+			proxy := newServer(&testingx.ODoHProxyHandler{
+				Client: newClient(map[string]*httptest.Server{"target.example.com:443": target}),
+			})
+			defer proxy.Close()
+			client := newClient(map[string]*httptest.Server{
+				"proxy.example.com:443":  proxy,
+				"target.example.com:443": target,
+			})
+
+			txp := NewUnwrappedDNSOverODoHTransport(client, odohURL)
+			defer txp.CloseIdleConnections()
+			encoder := &DNSEncoderMiekg{}
+			for idx := 0; idx < 2; idx++ {
+				query := encoder.Encode("example.com", dns.TypeA, txp.RequiresPadding())
+				resp, err := txp.RoundTrip(context.Background(), query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				addrs, err := resp.DecodeLookupHost()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff([]string{"93.184.216.34"}, addrs); diff != "" {
+					t.Fatal(diff)
+				}
+			}
+			if txp.config == nil {
+				t.Fatal("expected to have cached the config")
+			}
+		})
+	})
+
+	t.Run("getConfig", func(t *testing.T) {
+		// newConfigsResponse returns a response containing valid configs.
+		newConfigsResponse := func(header http.Header) *http.Response {
+			kp, err := odoh.NewKeyPair(hpke.KEM_X25519_HKDF_SHA256, hpke.KDF_HKDF_SHA256, hpke.AEAD_AES128GCM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return &http.Response{
+				StatusCode: 200,
+				Header:     header,
+				Body:       io.NopCloser(bytes.NewReader(odoh.MarshalConfigs(kp.Config))),
+			}
+		}
+
+		t.Run("we refetch the config when it expires", func(t *testing.T) {
+			var fetches int
+			client := &mocks.HTTPClient{
+				MockDo: func(req *http.Request) (*http.Response, error) {
+					fetches++
+					return newConfigsResponse(http.Header{"Cache-Control": {"public, max-age=60"}}), nil
+				},
+			}
+			now := time.Date(2024, 2, 8, 9, 8, 7, 0, time.UTC)
+			txp := NewUnwrappedDNSOverODoHTransport(client, odohURL)
+			txp.timeNow = func() time.Time {
+				return now
+			}
+			for _, elapsed := range []time.Duration{0, 30 * time.Second, 31 * time.Second} {
+				now = now.Add(elapsed)
+				if _, err := txp.getConfig(context.Background(), "https://target.example.com/"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if fetches != 2 {
+				t.Fatal("unexpected number of fetches", fetches)
+			}
+		})
+
+		t.Run("concurrent callers share the same fetch", func(t *testing.T) {
+			var fetches atomic.Int64
+			release := make(chan any)
+			client := &mocks.HTTPClient{
+				MockDo: func(req *http.Request) (*http.Response, error) {
+					fetches.Add(1)
+					<-release
+					return newConfigsResponse(nil), nil
+				},
+			}
+			txp := NewUnwrappedDNSOverODoHTransport(client, odohURL)
+			const concurrency = 4
+			errch := make(chan error, concurrency)
+			for idx := 0; idx < concurrency; idx++ {
+				go func() {
+					_, err := txp.getConfig(context.Background(), "https://target.example.com/")
+					errch <- err
+				}()
+			}
+			time.Sleep(100 * time.Millisecond)
+			close(release)
+			for idx := 0; idx < concurrency; idx++ {
+				if err := <-errch; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if fetches.Load() != 1 {
+				t.Fatal("unexpected number of fetches", fetches.Load())
+			}
+		})
+
+		t.Run("waiters fetch again when the fetching caller goes away", func(t *testing.T) {
+			started := make(chan any)
+			var fetches atomic.Int64
+			client := &mocks.HTTPClient{
+				MockDo: func(req *http.Request) (*http.Response, error) {
+					if fetches.Add(1) == 1 {
+						close(started)
+						<-req.Context().Done()
+						return nil, req.Context().Err()
+					}
+					return newConfigsResponse(nil), nil
+				},
+			}
+			txp := NewUnwrappedDNSOverODoHTransport(client, odohURL)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			leaderErr := make(chan error, 1)
+			go func() {
+				_, err := txp.getConfig(ctx, "https://target.example.com/")
+				leaderErr <- err
+			}()
+			<-started
+
+			waiterErr := make(chan error, 1)
+			go func() {
+				_, err := txp.getConfig(context.Background(), "https://target.example.com/")
+				waiterErr <- err
+			}()
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+
+			if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+				t.Fatal("unexpected leader error", err)
+			}
+			if err := <-waiterErr; err != nil {
+				t.Fatal("unexpected waiter error", err)
+			}
+		})
+	})
+
+	t.Run("odohConfigLifetime", func(t *testing.T) {
+		now := time.Date(2024, 2, 8, 9, 8, 7, 0, time.UTC)
+		cases := []struct {
+			header http.Header
+			expect time.Duration
+		}{{
+			header: http.Header{},
+			expect: odohDefaultConfigLifetime,
+		}, {
+			header: http.Header{"Cache-Control": {"public, max-age=86400"}},
+			expect: 24 * time.Hour,
+		}, {
+			header: http.Header{"Cache-Control": {"max-age=31536000"}},
+			expect: odohMaxConfigLifetime,
+		}, {
+			header: http.Header{"Cache-Control": {"no-store"}},
+			expect: 0,
+		}, {
+			header: http.Header{"Cache-Control": {"max-age=antani"}},
+			expect: 0,
+		}, {
+			header: http.Header{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}},
+			expect: time.Hour,
+		}, {
+			header: http.Header{"Expires": {"0"}},
+			expect: 0,
+		}}
+		for _, tc := range cases {
+			if got := odohConfigLifetime(tc.header, now); got != tc.expect {
+				t.Fatal("for", tc.header, "expected", tc.expect, "got", got)
+			}
+		}
+	})
+
+	t.Run("other functions", func(t *testing.T) {
+		var called bool
+		client := &mocks.HTTPClient{
+			MockCloseIdleConnections: func() {
+				called = true
+			},
+		}
+		txp := NewUnwrappedDNSOverODoHTransport(client, odohURL)
+		if txp.RequiresPadding() != true {
+			t.Fatal("invalid RequiresPadding")
+		}
+		if txp.Network() != "odoh" {
+			t.Fatal("invalid Network")
+		}
+		if txp.Address() != odohURL {
+			t.Fatal("invalid Address")
+		}
+		txp.CloseIdleConnections()
+		if !called {
+			t.Fatal("did not call CloseIdleConnections")
+		}
+	})
+
+	t.Run("NewDNSOverODoHTransport wraps errors", func(t *testing.T) {
+		txp := NewDNSOverODoHTransport(&mocks.HTTPClient{}, odohURL)
+		if _, good := txp.(*dnsTransportErrWrapper); !good {
+			t.Fatal("not wrapped")
+		}
+	})
+
+	t.Run("NewDNSOverODoHTransportWithHTTPTransport wraps errors", func(t *testing.T) {
+		txp := NewDNSOverODoHTransportWithHTTPTransport(&mocks.HTTPTransport{}, odohURL)
+		if _, good := txp.(*dnsTransportErrWrapper); !good {
+			t.Fatal("not wrapped")
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package netxlite
+
+//
+// DNS-over-QUIC transport
+//
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"math"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/quic-go/quic-go"
+)
+
+// DNSOverQUICTransport is a DNS-over-QUIC DNSTransport (see RFC9250).
+//
+// Note: like [DNSOverTCPTransport], this implementation always creates a new
+// connection for each query and uses a single stream for the query.
+type DNSOverQUICTransport struct {
+	dialer    model.QUICDialer
+	decoder   model.DNSDecoder
+	address   string
+	tlsConfig *tls.Config
+}
+
+// NewUnwrappedDNSOverQUICTransport creates a new DNSOverQUICTransport
+// that has not been wrapped yet.
+//
+// Arguments:
+//
+// - dialer is the QUIC dialer to use;
+//
+// - address is the endpoint address (e.g., 94.140.14.140:853).
+func NewUnwrappedDNSOverQUICTransport(dialer model.QUICDialer, address string) *DNSOverQUICTransport {
+	return NewUnwrappedDNSOverQUICTransportWithTLSConfig(dialer, address, nil)
+}
+
+// NewUnwrappedDNSOverQUICTransportWithTLSConfig is like NewUnwrappedDNSOverQUICTransport
+// but allows to specify a TLS config (e.g., to override the SNI). When the config is nil, we
+// use an empty config. In any case, we always force the ALPN to be "doq".
+func NewUnwrappedDNSOverQUICTransportWithTLSConfig(
+	dialer model.QUICDialer, address string, config *tls.Config) *DNSOverQUICTransport {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config = config.Clone()
+	config.NextProtos = []string{"doq"}
+	return &DNSOverQUICTransport{
+		dialer:    dialer,
+		decoder:   &DNSDecoderMiekg{},
+		address:   address,
+		tlsConfig: config,
+	}
+}
+
+// NewDNSOverQUICTransport is like NewUnwrappedDNSOverQUICTransport but
+// returns an already wrapped DNSTransport.
+func NewDNSOverQUICTransport(dialer model.QUICDialer, address string) model.DNSTransport {
+	return wrapDNSTransport(NewUnwrappedDNSOverQUICTransport(dialer, address))
+}
+
+// dnsOverQUICNoError is the DOQ_NO_ERROR error code (see RFC9250 Sect. 4.3).
+const dnsOverQUICNoError = 0
+
+// RoundTrip sends a query and receives a reply.
+func (t *DNSOverQUICTransport) RoundTrip(
+	ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+	// RFC9250 Sect. 4.2.1 says the message ID MUST be zero
+	query = &dnsOverQUICQuery{query}
+	rawQuery, err := query.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(rawQuery) > math.MaxUint16 {
+		return nil, errQueryTooLarge
+	}
+	qconn, err := t.dialer.DialContext(ctx, t.address, t.tlsConfig, &quic.Config{})
+	if err != nil {
+		return nil, err
+	}
+	defer qconn.CloseWithError(dnsOverQUICNoError, "")
+	stream, err := qconn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	const iotimeout = 10 * time.Second
+	_ = stream.SetDeadline(time.Now().Add(iotimeout))
+	// Write request and close the sending side of the stream (RFC9250 Sect. 4.2)
+	buf := []byte{byte(len(rawQuery) >> 8)}
+	buf = append(buf, byte(len(rawQuery)))
+	buf = append(buf, rawQuery...)
+	if _, err = stream.Write(buf); err != nil {
+		return nil, err
+	}
+	if err = stream.Close(); err != nil {
+		return nil, err
+	}
+	// Read response
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(stream, header); err != nil {
+		return nil, err
+	}
+	length := int(header[0])<<8 | int(header[1])
+	rawResponse := make([]byte, length)
+	if _, err = io.ReadFull(stream, rawResponse); err != nil {
+		return nil, err
+	}
+	return t.decoder.DecodeResponse(rawResponse, query)
+}
+
+// RequiresPadding returns true for DoQ according to RFC9250 Sect. 5.4.
+func (t *DNSOverQUICTransport) RequiresPadding() bool {
+	return true
+}
+
+// Network returns the transport network, i.e., "doq".
+func (t *DNSOverQUICTransport) Network() string {
+	return "doq"
+}
+
+// Address returns the upstream server endpoint (e.g., "94.140.14.140:853").
+func (t *DNSOverQUICTransport) Address() string {
+	return t.address
+}
+
+// CloseIdleConnections closes idle connections, if any.
+func (t *DNSOverQUICTransport) CloseIdleConnections() {
+	// nothing to do
+}
+
+var _ model.DNSTransport = &DNSOverQUICTransport{}
+
+// dnsOverQUICQuery wraps a [model.DNSQuery] to use zero as the message ID.
+type dnsOverQUICQuery struct {
+	model.DNSQuery
+}
+
+// Bytes implements model.DNSQuery.
+func (q *dnsOverQUICQuery) Bytes() ([]byte, error) {
+	rawQuery, err := q.DNSQuery.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(rawQuery) < 2 {
+		return rawQuery, nil // let the server reject this query
+	}
+	out := append([]byte{0, 0}, rawQuery[2:]...)
+	return out, nil
+}
+
+// ID implements model.DNSQuery.
+func (q *dnsOverQUICQuery) ID() uint16 {
+	return 0
+}
@@ -0,0 +1,284 @@
+package netxlite
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/netem"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/testingx"
+	"github.com/quic-go/quic-go"
+)
+
+func TestDNSOverQUICTransport(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		t.Run("cannot encode query", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			const address = "94.140.14.140:853"
+			txp := NewUnwrappedDNSOverQUICTransport(&mocks.QUICDialer{}, address)
+			query := &mocks.DNSQuery{
+				MockBytes: func() ([]byte, error) {
+					return nil, expected
+				},
+			}
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if resp != nil {
+				t.Fatal("expected nil response here")
+			}
+		})
+
+		t.Run("query too large", func(t *testing.T) {
+			const address = "94.140.14.140:853"
+			txp := NewUnwrappedDNSOverQUICTransport(&mocks.QUICDialer{}, address)
+			query := &mocks.DNSQuery{
+				MockBytes: func() ([]byte, error) {
+					return make([]byte, math.MaxUint16+1), nil
+				},
+			}
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if !errors.Is(err, errQueryTooLarge) {
+				t.Fatal("unexpected err", err)
+			}
+			if resp != nil {
+				t.Fatal("expected nil response here")
+			}
+		})
+
+		t.Run("dial failure", func(t *testing.T) {
+			const address = "94.140.14.140:853"
+			mocked := errors.New("mocked error")
+			query := &mocks.DNSQuery{
+				MockBytes: func() ([]byte, error) {
+					return make([]byte, 128), nil
+				},
+			}
+			var alpn []string
+			fakedialer := &mocks.QUICDialer{
+				MockDialContext: func(ctx context.Context, address string,
+					tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlyConnection, error) {
+					alpn = tlsConfig.NextProtos
+					return nil, mocked
+				},
+			}
+			txp := NewUnwrappedDNSOverQUICTransport(fakedialer, address)
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if resp != nil {
+				t.Fatal("expected nil resp here")
+			}
+			if len(alpn) != 1 || alpn[0] != "doq" {
+				t.Fatal("unexpected ALPN", alpn)
+			}
+		})
+
+		t.Run("we honour the TLS config", func(t *testing.T) {
+			query := &mocks.DNSQuery{
+				MockBytes: func() ([]byte, error) {
+					return make([]byte, 128), nil
+				},
+			}
+			config := &tls.Config{ServerName: "dns.adguard-dns.com", NextProtos: []string{"h3"}}
+			var got *tls.Config
+			fakedialer := &mocks.QUICDialer{
+				MockDialContext: func(ctx context.Context, address string,
+					tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlyConnection, error) {
+					got = tlsConfig
+					return nil, errors.New("mocked error")
+				},
+			}
+			txp := NewUnwrappedDNSOverQUICTransportWithTLSConfig(fakedialer, "94.140.14.140:853", config)
+			_, _ = txp.RoundTrip(context.Background(), query)
+			if got.ServerName != "dns.adguard-dns.com" {
+				t.Fatal("unexpected SNI", got.ServerName)
+			}
+			if len(got.NextProtos) != 1 || got.NextProtos[0] != "doq" {
+				t.Fatal("unexpected ALPN", got.NextProtos)
+			}
+			if len(config.NextProtos) != 1 || config.NextProtos[0] != "h3" {
+				t.Fatal("we modified the original config")
+			}
+		})
+
+		t.Run("open stream failure", func(t *testing.T) {
+			const address = "94.140.14.140:853"
+			mocked := errors.New("mocked error")
+			query := &mocks.DNSQuery{
+				MockBytes: func() ([]byte, error) {
+					return make([]byte, 128), nil
+				},
+			}
+			var closed bool
+			fakedialer := &mocks.QUICDialer{
+				MockDialContext: func(ctx context.Context, address string,
+					tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlyConnection, error) {
+					return &mocks.QUICEarlyConnection{
+						MockOpenStreamSync: func(ctx context.Context) (quic.Stream, error) {
+							return nil, mocked
+						},
+						MockCloseWithError: func(code quic.ApplicationErrorCode, reason string) error {
+							closed = (code == dnsOverQUICNoError)
+							return nil
+						},
+					}, nil
+				},
+			}
+			txp := NewUnwrappedDNSOverQUICTransport(fakedialer, address)
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if !errors.Is(err, mocked) {
+				t.Fatal("not the error we expected")
+			}
+			if resp != nil {
+				t.Fatal("expected nil resp here")
+			}
+			if !closed {
+				t.Fatal("did not close the connection")
+			}
+		})
+
+		// runWithServer performs a round trip with a local DoQ server
+		// that uses the given round tripper to generate responses.
+		runWithServer := func(rtx testingx.DNSRoundTripper) (model.DNSResponse, error) {
+			ca := netem.MustNewCA()
+			listener := testingx.MustNewDNSOverQUICListener(
+				&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+				&testingx.DNSOverUDPListenerStdlib{},
+				ca.MustNewServerTLSConfig("dns.example.com", "127.0.0.1"),
+				rtx,
+			)
+			defer listener.Close()
+			netx := &Netx{}
+			dialer := netx.NewQUICDialerWithoutResolver(netx.NewUDPListener(), model.DiscardLogger)
+			fakedialer := &mocks.QUICDialer{
+				MockDialContext: func(ctx context.Context, address string,
+					tlsConfig *tls.Config, quicConfig *quic.Config) (quic.EarlyConnection, error) {
+					tlsConfig = tlsConfig.Clone()
+					tlsConfig.RootCAs = ca.DefaultCertPool()
+					return dialer.DialContext(ctx, address, tlsConfig, quicConfig)
+				},
+			}
+			txp := NewUnwrappedDNSOverQUICTransport(fakedialer, listener.LocalAddr().String())
+			encoder := &DNSEncoderMiekg{}
+			query := encoder.Encode("dns.google", dns.TypeA, txp.RequiresPadding())
+			return txp.RoundTrip(context.Background(), query)
+		}
+
+		t.Run("successful case", func(t *testing.T) {
+			var queryID uint16 = math.MaxUint16
+			rtx := testingx.DNSRoundTripperFunc(func(ctx context.Context, rawReq []byte) ([]byte, error) {
+				query := &dns.Msg{}
+				if err := query.Unpack(rawReq); err != nil {
+					return nil, err
+				}
+				queryID = query.Id
+				resp := &dns.Msg{}
+				resp.SetReply(query)
+				resp.Answer = append(resp.Answer, &dns.A{
+					Hdr: dns.RR_Header{
+						Name:   query.Question[0].Name,
+						Rrtype: dns.TypeA,
+						Class:  dns.ClassINET,
+						Ttl:    3600,
+					},
+					A: net.IPv4(8, 8, 8, 8),
+				})
+				return resp.Pack()
+			})
+			resp, err := runWithServer(rtx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if queryID != 0 {
+				t.Fatal("the query ID should be zero", queryID)
+			}
+			addrs, err := resp.DecodeLookupHost()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != 1 || addrs[0] != "8.8.8.8" {
+				t.Fatal("unexpected addrs", addrs)
+			}
+		})
+
+		t.Run("when the server does not send any response", func(t *testing.T) {
+			rtx := testingx.DNSRoundTripperFunc(func(ctx context.Context, rawReq []byte) ([]byte, error) {
+				return nil, errors.New("mocked error")
+			})
+			resp, err := runWithServer(rtx)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if resp != nil {
+				t.Fatal("expected nil resp here")
+			}
+		})
+	})
+
+	t.Run("other functions", func(t *testing.T) {
+		const address = "94.140.14.140:853"
+		txp := NewUnwrappedDNSOverQUICTransport(&mocks.QUICDialer{}, address)
+		if txp.RequiresPadding() != true {
+			t.Fatal("invalid RequiresPadding")
+		}
+		if txp.Network() != "doq" {
+			t.Fatal("invalid Network")
+		}
+		if txp.Address() != address {
+			t.Fatal("invalid Address")
+		}
+		txp.CloseIdleConnections()
+	})
+
+	t.Run("NewDNSOverQUICTransport wraps errors", func(t *testing.T) {
+		txp := NewDNSOverQUICTransport(&mocks.QUICDialer{}, "94.140.14.140:853")
+		if _, good := txp.(*dnsTransportErrWrapper); !good {
+			t.Fatal("not wrapped")
+		}
+	})
+}
+
+func TestDNSOverQUICQuery(t *testing.T) {
+	t.Run("we zero the ID of the query", func(t *testing.T) {
+		query := &dnsOverQUICQuery{&mocks.DNSQuery{
+			MockBytes: func() ([]byte, error) {
+				return []byte{0xde, 0xad, 0xbe, 0xef}, nil
+			},
+		}}
+		rawQuery, err := query.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rawQuery, []byte{0, 0, 0xbe, 0xef}) {
+			t.Fatal("unexpected raw query", rawQuery)
+		}
+		if query.ID() != 0 {
+			t.Fatal("unexpected ID")
+		}
+	})
+
+	t.Run("with a too short query", func(t *testing.T) {
+		query := &dnsOverQUICQuery{&mocks.DNSQuery{
+			MockBytes: func() ([]byte, error) {
+				return []byte{0xde}, nil
+			},
+		}}
+		rawQuery, err := query.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rawQuery, []byte{0xde}) {
+			t.Fatal("unexpected raw query", rawQuery)
+		}
+	})
+}
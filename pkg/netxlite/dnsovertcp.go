@@ -55,6 +55,12 @@ func NewUnwrappedDNSOverTLSTransport(dial DialContextFunc, address string) *DNSO
 	return newDNSOverTCPOrTLSTransport(dial, "dot", address, true)
 }
 
+// NewDNSOverTLSTransport is like NewUnwrappedDNSOverTLSTransport but
+// returns an already wrapped DNSTransport.
+func NewDNSOverTLSTransport(dial DialContextFunc, address string) model.DNSTransport {
+	return wrapDNSTransport(NewUnwrappedDNSOverTLSTransport(dial, address))
+}
+
 // newDNSOverTCPOrTLSTransport is the common factory for creating a transport
 func newDNSOverTCPOrTLSTransport(
 	dial DialContextFunc, network, address string, padding bool) *DNSOverTCPTransport {
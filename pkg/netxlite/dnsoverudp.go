@@ -35,7 +35,8 @@ import (
 // make this code suitable to implement parasitic traceroute.
 //
 // This transport by default listens for additional responses after the first
-// one and makes them available using the context-configured trace.
+// one and makes them available using the context-configured trace. Set the
+// CollectWindow field to wait for additional responses before returning.
 type DNSOverUDPTransport struct {
 	// Decoder is the MANDATORY DNSDecoder to use.
 	Decoder model.DNSDecoder
@@ -46,6 +47,25 @@ type DNSOverUDPTransport struct {
 	// Endpoint is the MANDATORY server's endpoint (e.g., 1.1.1.1:53)
 	Endpoint string
 
+	// CollectWindow is the OPTIONAL time window during which RoundTrip keeps
+	// reading responses after the first one. When zero (the default), RoundTrip
+	// returns as soon as it receives the first response and delivers any late
+	// response to the context-configured trace in the background. When positive,
+	// RoundTrip waits for the window to expire, delivers each additional response
+	// to the trace using OnDelayedDNSResponse, and only then returns the first
+	// response, such that callers find all the responses in the trace as soon
+	// as RoundTrip returns. Censors such as the GFW inject forged responses that
+	// race with the legitimate one, so this mode allows to observe both.
+	//
+	// In this mode, we also record the TTL of the IP packets carrying the responses
+	// (see [model.DNSResponseWithIPTTL]) when the Dialer returns a [*net.UDPConn] that
+	// is not wrapped. We do not record the TTL when the conn is wrapped (e.g., by
+	// the dialers constructed by this package, which wrap errors, or by conn wrappers
+	// collecting network events), because reading from the underlying conn would bypass
+	// the wrappers. Note that the IP ID is not available because UDP sockets do not
+	// expose it.
+	CollectWindow time.Duration
+
 	// lateResponses is posted in nonblocking mode each time this
 	// transport detects there was a late response for a query that had
 	// already been answered. Use this channel for testing.
@@ -71,10 +91,17 @@ func NewUnwrappedDNSOverUDPTransport(dialer model.Dialer, address string) *DNSOv
 		Decoder:       &DNSDecoderMiekg{},
 		Dialer:        dialer,
 		Endpoint:      address,
+		CollectWindow: 0,
 		lateResponses: nil, // not interested by default
 	}
 }
 
+// NewDNSOverUDPTransport is like NewUnwrappedDNSOverUDPTransport but
+// returns an already wrapped DNSTransport.
+func NewDNSOverUDPTransport(dialer model.Dialer, address string) model.DNSTransport {
+	return wrapDNSTransport(NewUnwrappedDNSOverUDPTransport(dialer, address))
+}
+
 // RoundTrip sends a query and receives a response.
 func (t *DNSOverUDPTransport) RoundTrip(
 	ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
@@ -96,6 +123,9 @@ func (t *DNSOverUDPTransport) RoundTrip(
 		return nil, err
 	}
 	_ = conn.SetDeadline(deadline) // time to dial (usually ~zero) already factored in
+	if t.CollectWindow > 0 {
+		return t.ownConnAndCollectAll(ctx, conn, query, rawQuery, deadline)
+	}
 	joinedch := make(chan bool)
 	myaddr := conn.LocalAddr().String()
 	if _, err := conn.Write(rawQuery); err != nil {
@@ -177,6 +207,109 @@ func (t *DNSOverUDPTransport) ownConnAndSendRecvLoop(ctx context.Context, conn n
 	}
 }
 
+// ownConnAndCollectAll implements RoundTrip when CollectWindow is positive. As the
+// name implies, this function TAKES OWNERSHIP of the [conn].
+func (t *DNSOverUDPTransport) ownConnAndCollectAll(ctx context.Context, conn net.Conn,
+	query model.DNSQuery, rawQuery []byte, deadline time.Time) (model.DNSResponse, error) {
+	defer conn.Close() // we own the conn
+	reader := newDNSOverUDPPacketReader(conn)
+	if _, err := conn.Write(rawQuery); err != nil {
+		return nil, err
+	}
+	resp, err := t.recvWithIPTTL(query, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// make sure the window does not extend beyond the overall deadline
+	windowDeadline := time.Now().Add(t.CollectWindow)
+	if windowDeadline.After(deadline) {
+		windowDeadline = deadline
+	}
+	_ = reader.SetReadDeadline(windowDeadline)
+
+	trace := ContextTraceOrDefault(ctx)
+	for {
+		started := trace.TimeNow()
+		rawResponse, ttl, err := t.readWithIPTTL(reader)
+		if err != nil {
+			// This includes the expiration of the window, which is the
+			// expected way in which we leave this loop.
+			return resp, nil
+		}
+		lateResp, err := t.decodeWithIPTTL(query, rawResponse, ttl)
+		finished := trace.TimeNow()
+		if err != nil {
+			// We cannot decode this packet or it does not answer our query (e.g., its
+			// ID does not match), which may be caused by a censor injecting packets, so
+			// we keep reading until the window expires rather than giving up.
+			continue
+		}
+		// if there's testing code waiting to be unblocked because we
+		// received a delayed response, unblock it
+		select {
+		case t.lateResponses <- true:
+		default:
+			// there's no one waiting and it does not matter
+		}
+		addrs, err := lateResp.DecodeLookupHost()
+		if err := trace.OnDelayedDNSResponse(started, t, query, lateResp, addrs, err, finished); err != nil {
+			// This error typically indicates that the buffer on which we're
+			// writing is now full, so there's no point in persisting.
+			return resp, nil
+		}
+	}
+}
+
+// recvWithIPTTL is like recv but uses a [dnsOverUDPPacketReader] and returns
+// a [model.DNSResponseWithIPTTL] when the IP TTL is available.
+func (t *DNSOverUDPTransport) recvWithIPTTL(
+	query model.DNSQuery, reader dnsOverUDPPacketReader) (model.DNSResponse, error) {
+	rawResponse, ttl, err := t.readWithIPTTL(reader)
+	if err != nil {
+		return nil, err
+	}
+	return t.decodeWithIPTTL(query, rawResponse, ttl)
+}
+
+// readWithIPTTL reads a single raw response along with its IP TTL.
+func (t *DNSOverUDPTransport) readWithIPTTL(reader dnsOverUDPPacketReader) ([]byte, int, error) {
+	const maxmessagesize = 1 << 17
+	rawResponse := make([]byte, maxmessagesize)
+	count, ttl, err := reader.ReadWithIPTTL(rawResponse)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rawResponse[:count], ttl, nil
+}
+
+// decodeWithIPTTL decodes the raw response to the given query and returns
+// a [model.DNSResponseWithIPTTL] when the IP TTL is available.
+func (t *DNSOverUDPTransport) decodeWithIPTTL(
+	query model.DNSQuery, rawResponse []byte, ttl int) (model.DNSResponse, error) {
+	resp, err := t.Decoder.DecodeResponse(rawResponse, query)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		resp = &dnsResponseWithIPTTL{DNSResponse: resp, ttl: int64(ttl)}
+	}
+	return resp, nil
+}
+
+// dnsResponseWithIPTTL implements [model.DNSResponseWithIPTTL].
+type dnsResponseWithIPTTL struct {
+	model.DNSResponse
+	ttl int64
+}
+
+var _ model.DNSResponseWithIPTTL = &dnsResponseWithIPTTL{}
+
+// IPTTL implements model.DNSResponseWithIPTTL.
+func (r *dnsResponseWithIPTTL) IPTTL() int64 {
+	return r.ttl
+}
+
 // recv receives a single response for the given query using the given conn.
 func (t *DNSOverUDPTransport) recv(query model.DNSQuery, conn net.Conn) (model.DNSResponse, error) {
 	const maxmessagesize = 1 << 17
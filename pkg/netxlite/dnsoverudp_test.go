@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"io"
 	"net"
+	"runtime"
 	"sync"
 	"testing"
 	"time"
@@ -493,6 +495,313 @@ func TestDNSOverUDPTransport(t *testing.T) {
 		})
 	})
 
+	t.Run("collecting all the responses within a window", func(t *testing.T) {
+		dnsConfigGood := netem.NewDNSConfig()
+		dnsConfigGood.AddRecord("dns.google", "", "8.8.8.8")
+
+		dnsConfigBogus := netem.NewDNSConfig()
+		dnsConfigBogus.AddRecord("dns.google", "", "127.0.0.1")
+
+		// newTransport creates a transport using a server that first sends a bogus response and
+		// then sends the good response, and returns the transport and the server.
+		newTransport := func() (*DNSOverUDPTransport, io.Closer) {
+			udpAddr := &net.UDPAddr{
+				IP:   net.IPv4(127, 0, 0, 1),
+				Port: 0,
+			}
+			listener := testingx.MustNewDNSSimulateGWFListener(
+				udpAddr, &testingx.DNSOverUDPListenerStdlib{}, dnsConfigBogus,
+				dnsConfigGood, testingx.DNSNumBogusResponses(1))
+			netx := &Netx{}
+			dialer := netx.NewDialerWithoutResolver(model.DiscardLogger)
+			txp := NewUnwrappedDNSOverUDPTransport(dialer, listener.LocalAddr().String())
+			txp.CollectWindow = 500 * time.Millisecond
+			return txp, listener
+		}
+
+		// newTrace creates a trace appending the delayed responses to the given slice.
+		newTrace := func(delayed *[]model.DNSResponse) model.Trace {
+			return &mocks.Trace{
+				MockTimeNow: time.Now,
+				MockOnDelayedDNSResponse: func(started time.Time, txp model.DNSTransport,
+					query model.DNSQuery, response model.DNSResponse, addrs []string, err error,
+					finished time.Time) error {
+					*delayed = append(*delayed, response) // no locking: we're called synchronously
+					return nil
+				},
+				MockOnConnectDone: func(started time.Time, network, domain, remoteAddr string, err error,
+					finished time.Time) {
+					// do nothing
+				},
+				MockMaybeWrapNetConn: func(conn net.Conn) net.Conn {
+					return conn
+				},
+			}
+		}
+
+		t.Run("we ignore packets we cannot decode while collecting", func(t *testing.T) {
+			pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pconn.Close()
+
+			// the server answers and then sends an undecodable packet, a response with
+			// a mismatched ID, and a response resolving a different address
+			go func() {
+				buffer := make([]byte, 1<<12)
+				count, addr, err := pconn.ReadFrom(buffer)
+				if err != nil {
+					return
+				}
+				query := &dns.Msg{}
+				if err := query.Unpack(buffer[:count]); err != nil {
+					return
+				}
+				newResponse := func(id uint16, ipAddr string) []byte {
+					resp := &dns.Msg{}
+					resp.SetReply(query)
+					resp.Id = id
+					resp.Answer = append(resp.Answer, &dns.A{
+						Hdr: dns.RR_Header{
+							Name:   query.Question[0].Name,
+							Rrtype: dns.TypeA,
+							Class:  dns.ClassINET,
+							Ttl:    3600,
+						},
+						A: net.ParseIP(ipAddr),
+					})
+					data, _ := resp.Pack()
+					return data
+				}
+				for _, packet := range [][]byte{
+					newResponse(query.Id, "127.0.0.1"),
+					{0x01},
+					newResponse(query.Id+1, "10.0.0.1"),
+					newResponse(query.Id, "8.8.8.8"),
+				} {
+					_, _ = pconn.WriteTo(packet, addr)
+				}
+			}()
+
+			netx := &Netx{}
+			dialer := netx.NewDialerWithoutResolver(model.DiscardLogger)
+			txp := NewUnwrappedDNSOverUDPTransport(dialer, pconn.LocalAddr().String())
+			txp.CollectWindow = 500 * time.Millisecond
+
+			var delayed []model.DNSResponse
+			ctx := ContextWithTrace(context.Background(), newTrace(&delayed))
+			encoder := &DNSEncoderMiekg{}
+			query := encoder.Encode("dns.google.", dns.TypeA, false)
+			resp, err := txp.RoundTrip(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			addrs, err := resp.DecodeLookupHost()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"127.0.0.1"}, addrs); diff != "" {
+				t.Fatal(diff)
+			}
+			if len(delayed) != 1 {
+				t.Fatal("expected exactly one delayed response, got", len(delayed))
+			}
+			addrs, err = delayed[0].DecodeLookupHost()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"8.8.8.8"}, addrs); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+
+		t.Run("we deliver late responses before returning", func(t *testing.T) {
+			txp, listener := newTransport()
+			defer listener.Close()
+
+			var delayed []model.DNSResponse
+			ctx := ContextWithTrace(context.Background(), newTrace(&delayed))
+			encoder := &DNSEncoderMiekg{}
+			query := encoder.Encode("dns.google.", dns.TypeA, false)
+			resp, err := txp.RoundTrip(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the first response is the bogus one
+			addrs, err := resp.DecodeLookupHost()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"127.0.0.1"}, addrs); diff != "" {
+				t.Fatal(diff)
+			}
+
+			// the good response should already be in the trace
+			if len(delayed) != 1 {
+				t.Fatal("expected exactly one delayed response, got", len(delayed))
+			}
+			addrs, err = delayed[0].DecodeLookupHost()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"8.8.8.8"}, addrs); diff != "" {
+				t.Fatal(diff)
+			}
+
+			// the dialer wraps the conn, hence we cannot read the IP TTL
+			for _, entry := range []model.DNSResponse{resp, delayed[0]} {
+				if _, good := entry.(model.DNSResponseWithIPTTL); good {
+					t.Fatal("did not expect to see the IP TTL")
+				}
+			}
+		})
+
+		t.Run("we read the IP TTL when the conn is not wrapped", func(t *testing.T) {
+			if runtime.GOOS != "linux" {
+				t.Skip("we only know we can read the IP TTL on Linux")
+			}
+			txp, listener := newTransport()
+			defer listener.Close()
+			txp.Dialer = &mocks.Dialer{
+				MockDialContext: (&net.Dialer{}).DialContext,
+			}
+
+			var delayed []model.DNSResponse
+			ctx := ContextWithTrace(context.Background(), newTrace(&delayed))
+			encoder := &DNSEncoderMiekg{}
+			query := encoder.Encode("dns.google.", dns.TypeA, false)
+			resp, err := txp.RoundTrip(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(delayed) != 1 {
+				t.Fatal("expected exactly one delayed response, got", len(delayed))
+			}
+			for _, entry := range []model.DNSResponse{resp, delayed[0]} {
+				withTTL, good := entry.(model.DNSResponseWithIPTTL)
+				if !good || withTTL.IPTTL() <= 0 {
+					t.Fatal("expected to see the IP TTL")
+				}
+			}
+		})
+
+		t.Run("we stop collecting when the trace buffer is full", func(t *testing.T) {
+			txp, listener := newTransport()
+			defer listener.Close()
+
+			var count int
+			tx := &mocks.Trace{
+				MockTimeNow: time.Now,
+				MockOnDelayedDNSResponse: func(started time.Time, txp model.DNSTransport,
+					query model.DNSQuery, response model.DNSResponse, addrs []string, err error,
+					finished time.Time) error {
+					count++
+					return errors.New("full buffer")
+				},
+				MockOnConnectDone: func(started time.Time, network, domain, remoteAddr string, err error,
+					finished time.Time) {
+					// do nothing
+				},
+				MockMaybeWrapNetConn: func(conn net.Conn) net.Conn {
+					return conn
+				},
+			}
+			ctx := ContextWithTrace(context.Background(), tx)
+			encoder := &DNSEncoderMiekg{}
+			query := encoder.Encode("dns.google.", dns.TypeA, false)
+			resp, err := txp.RoundTrip(ctx, query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp == nil {
+				t.Fatal("expected non-nil response")
+			}
+			if count != 1 {
+				t.Fatal("expected a single call, got", count)
+			}
+		})
+
+		t.Run("Write failure", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			var closed bool
+			txp := NewUnwrappedDNSOverUDPTransport(&mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return &mocks.Conn{
+						MockSetDeadline: func(t time.Time) error {
+							return nil
+						},
+						MockWrite: func(b []byte) (int, error) {
+							return 0, expected
+						},
+						MockClose: func() error {
+							closed = true
+							return nil
+						},
+						MockLocalAddr: func() net.Addr {
+							return &net.UDPAddr{}
+						},
+					}, nil
+				},
+			}, "9.9.9.9:53")
+			txp.CollectWindow = time.Second
+			query := &mocks.DNSQuery{
+				MockBytes: func() ([]byte, error) {
+					return make([]byte, 128), nil
+				},
+			}
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if resp != nil {
+				t.Fatal("expected nil response here")
+			}
+			if !closed {
+				t.Fatal("did not close the conn")
+			}
+		})
+
+		t.Run("Read failure", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			txp := NewUnwrappedDNSOverUDPTransport(&mocks.Dialer{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return &mocks.Conn{
+						MockSetDeadline: func(t time.Time) error {
+							return nil
+						},
+						MockWrite: func(b []byte) (int, error) {
+							return len(b), nil
+						},
+						MockRead: func(b []byte) (int, error) {
+							return 0, expected
+						},
+						MockClose: func() error {
+							return nil
+						},
+						MockLocalAddr: func() net.Addr {
+							return &net.UDPAddr{}
+						},
+					}, nil
+				},
+			}, "9.9.9.9:53")
+			txp.CollectWindow = time.Second
+			query := &mocks.DNSQuery{
+				MockBytes: func() ([]byte, error) {
+					return make([]byte, 128), nil
+				},
+			}
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected err", err)
+			}
+			if resp != nil {
+				t.Fatal("expected nil response here")
+			}
+		})
+	})
+
 	t.Run("CloseIdleConnections", func(t *testing.T) {
 		var called bool
 		dialer := &mocks.Dialer{
@@ -522,4 +831,11 @@ func TestDNSOverUDPTransport(t *testing.T) {
 			t.Fatal("invalid Address")
 		}
 	})
+
+	t.Run("NewDNSOverUDPTransport wraps errors", func(t *testing.T) {
+		txp := NewDNSOverUDPTransport(&mocks.Dialer{}, "9.9.9.9:53")
+		if _, good := txp.(*dnsTransportErrWrapper); !good {
+			t.Fatal("not wrapped")
+		}
+	})
 }
@@ -0,0 +1,95 @@
+package netxlite
+
+//
+// Reading DNS-over-UDP responses along with the IP TTL
+//
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// dnsOverUDPPacketReader reads DNS-over-UDP responses along with the TTL
+// of the IP packet carrying them, when such information is available.
+type dnsOverUDPPacketReader interface {
+	// ReadWithIPTTL reads a packet into the buffer and returns the number
+	// of bytes read and the IP TTL, which is zero when unavailable.
+	ReadWithIPTTL(buffer []byte) (int, int, error)
+
+	// SetReadDeadline is like net.Conn.SetReadDeadline.
+	SetReadDeadline(t time.Time) error
+}
+
+// newDNSOverUDPPacketReader creates a new [dnsOverUDPPacketReader] for the given conn. When
+// the conn is a [*net.UDPConn] that supports reading the IP TTL, we read the TTL along with
+// each packet, otherwise the TTL is zero. We do not unwrap conns to read the TTL, because
+// reading from the underlying conn would bypass the wrappers (e.g., the ones collecting
+// network events or wrapping errors), so wrapped conns never provide the TTL.
+func newDNSOverUDPPacketReader(conn net.Conn) dnsOverUDPPacketReader {
+	udpConn, good := conn.(*net.UDPConn)
+	if !good {
+		return &dnsOverUDPConnReader{conn}
+	}
+	if addr, good := udpConn.RemoteAddr().(*net.UDPAddr); good && addr.IP.To4() == nil {
+		pconn := ipv6.NewPacketConn(udpConn)
+		if err := pconn.SetControlMessage(ipv6.FlagHopLimit, true); err != nil {
+			return &dnsOverUDPConnReader{conn}
+		}
+		return &dnsOverUDPIPv6Reader{pconn}
+	}
+	pconn := ipv4.NewPacketConn(udpConn)
+	if err := pconn.SetControlMessage(ipv4.FlagTTL, true); err != nil {
+		return &dnsOverUDPConnReader{conn}
+	}
+	return &dnsOverUDPIPv4Reader{pconn}
+}
+
+// dnsOverUDPConnReader is a [dnsOverUDPPacketReader] that does not know the IP TTL.
+type dnsOverUDPConnReader struct {
+	net.Conn
+}
+
+// ReadWithIPTTL implements dnsOverUDPPacketReader.
+func (r *dnsOverUDPConnReader) ReadWithIPTTL(buffer []byte) (int, int, error) {
+	count, err := r.Conn.Read(buffer)
+	return count, 0, err
+}
+
+// dnsOverUDPIPv4Reader is a [dnsOverUDPPacketReader] for IPv4.
+type dnsOverUDPIPv4Reader struct {
+	*ipv4.PacketConn
+}
+
+// ReadWithIPTTL implements dnsOverUDPPacketReader.
+func (r *dnsOverUDPIPv4Reader) ReadWithIPTTL(buffer []byte) (int, int, error) {
+	count, cm, _, err := r.PacketConn.ReadFrom(buffer)
+	if err != nil {
+		return 0, 0, err
+	}
+	var ttl int
+	if cm != nil {
+		ttl = cm.TTL
+	}
+	return count, ttl, nil
+}
+
+// dnsOverUDPIPv6Reader is a [dnsOverUDPPacketReader] for IPv6.
+type dnsOverUDPIPv6Reader struct {
+	*ipv6.PacketConn
+}
+
+// ReadWithIPTTL implements dnsOverUDPPacketReader.
+func (r *dnsOverUDPIPv6Reader) ReadWithIPTTL(buffer []byte) (int, int, error) {
+	count, cm, _, err := r.PacketConn.ReadFrom(buffer)
+	if err != nil {
+		return 0, 0, err
+	}
+	var ttl int
+	if cm != nil {
+		ttl = cm.HopLimit
+	}
+	return count, ttl, nil
+}
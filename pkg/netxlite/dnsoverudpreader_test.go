@@ -0,0 +1,57 @@
+package netxlite
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/ooni/probe-engine/pkg/mocks"
+)
+
+func TestNewDNSOverUDPPacketReader(t *testing.T) {
+	t.Run("with a conn that is not a UDP conn", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		conn := &mocks.Conn{
+			MockRead: func(b []byte) (int, error) {
+				return 0, expected
+			},
+		}
+		reader := newDNSOverUDPPacketReader(&dialerErrWrapperConn{conn})
+		if _, good := reader.(*dnsOverUDPConnReader); !good {
+			t.Fatalf("unexpected reader type %T", reader)
+		}
+		count, ttl, err := reader.ReadWithIPTTL(make([]byte, 128))
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected err", err)
+		}
+		if count != 0 || ttl != 0 {
+			t.Fatal("unexpected count or ttl", count, ttl)
+		}
+	})
+
+	t.Run("with an IPv4 UDP conn", func(t *testing.T) {
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		reader := newDNSOverUDPPacketReader(conn)
+		switch reader.(type) {
+		case *dnsOverUDPIPv4Reader, *dnsOverUDPConnReader: // the latter when TTL is not supported
+		default:
+			t.Fatalf("unexpected reader type %T", reader)
+		}
+	})
+
+	t.Run("with a wrapped UDP conn we read through the wrapper", func(t *testing.T) {
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		reader := newDNSOverUDPPacketReader(&dialerErrWrapperConn{conn})
+		if _, good := reader.(*dnsOverUDPConnReader); !good {
+			t.Fatalf("unexpected reader type %T", reader)
+		}
+	})
+}
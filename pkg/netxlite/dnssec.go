@@ -0,0 +1,537 @@
+package netxlite
+
+//
+// DNSSEC validating transport
+//
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// dnssecRootAnchors contains the DS records of the root zone KSKs. They come
+// from https://data.iana.org/root-anchors/root-anchors.xml and include both
+// the KSK-2017 (key tag 20326) and the KSK-2024 (key tag 38696).
+const dnssecRootAnchors = `
+. 0 IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+. 0 IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16
+`
+
+// dnssecMustParseAnchors parses the given DS records in zone file format.
+func dnssecMustParseAnchors(data string) (out []*dns.DS) {
+	parser := dns.NewZoneParser(strings.NewReader(data), "", "")
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		ds, good := rr.(*dns.DS)
+		runtimex.Assert(good, "dnssec: expected a DS record")
+		out = append(out, ds)
+	}
+	runtimex.PanicOnError(parser.Err(), "dnssec: cannot parse anchors")
+	return
+}
+
+// DNSSECValidatingTransport is a [model.DNSTransport] validating DNSSEC.
+//
+// We send queries with the DO and CD bits set, so the upstream resolver gives us
+// the DNSSEC records without filtering bogus answers, and we build the chain of
+// trust from the root trust anchors to the answer by sending DS and DNSKEY queries
+// using the underlying transport. We do not fail when validation fails. Rather, the
+// returned response implements [model.DNSSECValidatedResponse].
+//
+// For negative answers, we validate the signatures of the NSEC and NSEC3 records
+// in the authority section, but we do not check whether they actually prove the
+// non-existence of the queried name and type.
+//
+// The zero value is invalid; please, use [NewDNSSECValidatingTransport] to construct.
+type DNSSECValidatingTransport struct {
+	// DNSTransport is the underlying transport.
+	model.DNSTransport
+
+	// anchors contains the root trust anchors.
+	anchors []*dns.DS
+
+	// encoder is the encoder for DS and DNSKEY queries.
+	encoder model.DNSEncoder
+
+	// mu protects zones.
+	mu sync.Mutex
+
+	// timeNow allows to mock time.Now in tests.
+	timeNow func() time.Time
+
+	// zones maps a name to the cached zone that contains it.
+	zones map[string]*dnssecCachedZone
+}
+
+// dnssecMaxZoneTTL is the maximum amount of time for which we cache a zone, which
+// also applies to the root zone, which we authenticate using the trust anchors.
+const dnssecMaxZoneTTL = 24 * time.Hour
+
+// dnssecCachedZone is a zone inside the cache.
+type dnssecCachedZone struct {
+	// zone is the cached zone.
+	zone *dnssecZone
+
+	// expiresAt is when the cached zone expires.
+	expiresAt time.Time
+}
+
+// NewDNSSECValidatingTransport creates a new [*DNSSECValidatingTransport] using the
+// given underlying transport and the bundled root trust anchors.
+func NewDNSSECValidatingTransport(txp model.DNSTransport) *DNSSECValidatingTransport {
+	return &DNSSECValidatingTransport{
+		DNSTransport: txp,
+		anchors:      dnssecMustParseAnchors(dnssecRootAnchors),
+		encoder:      &DNSEncoderMiekg{},
+		mu:           sync.Mutex{},
+		timeNow:      time.Now,
+		zones:        map[string]*dnssecCachedZone{},
+	}
+}
+
+// NewParallelDNSSECValidatingResolver creates a new parallel resolver with error
+// wrapping that uses the given transport wrapped by [DNSSECValidatingTransport].
+func NewParallelDNSSECValidatingResolver(logger model.DebugLogger, txp model.DNSTransport) model.Resolver {
+	return WrapResolver(logger, NewUnwrappedParallelResolver(NewDNSSECValidatingTransport(txp)))
+}
+
+var _ model.DNSTransport = &DNSSECValidatingTransport{}
+
+// RoundTrip implements model.DNSTransport.
+func (t *DNSSECValidatingTransport) RoundTrip(
+	ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+	resp, err := t.DNSTransport.RoundTrip(ctx, &dnssecQuery{query})
+	if err != nil {
+		return nil, err
+	}
+	status := model.DNSSECStatusIndeterminate
+	msg := &dns.Msg{}
+	if err := msg.Unpack(resp.Bytes()); err == nil {
+		status = t.validate(ctx, dns.Fqdn(query.Domain()), msg)
+	}
+	return &dnssecResponse{DNSResponse: resp, query: query, status: status}, nil
+}
+
+// dnssecZone is a zone we authenticated.
+type dnssecZone struct {
+	// name is the zone name.
+	name string
+
+	// status is the zone status.
+	status string
+
+	// keys contains the zone keys when the status is secure.
+	keys []*dns.DNSKEY
+
+	// ttl is the amount of time for which we can cache the zone, which
+	// derives from the TTLs of the records used to authenticate it.
+	ttl time.Duration
+}
+
+// dnssecRRSet is a set of records with the same owner and type.
+type dnssecRRSet struct {
+	// rrs contains the records.
+	rrs []dns.RR
+
+	// sigs contains the RRSIGs covering the records.
+	sigs []*dns.RRSIG
+}
+
+// dnssecGroupRRSets groups the given records by owner and type.
+func dnssecGroupRRSets(records []dns.RR) (out []*dnssecRRSet) {
+	index := map[string]*dnssecRRSet{}
+	key := func(name string, rtype uint16) string {
+		return strings.ToLower(name) + " " + dns.TypeToString[rtype]
+	}
+	get := func(name string, rtype uint16) *dnssecRRSet {
+		k := key(name, rtype)
+		rrset, found := index[k]
+		if !found {
+			rrset = &dnssecRRSet{}
+			index[k] = rrset
+			out = append(out, rrset)
+		}
+		return rrset
+	}
+	for _, rr := range records {
+		if sig, good := rr.(*dns.RRSIG); good {
+			rrset := get(sig.Hdr.Name, sig.TypeCovered)
+			rrset.sigs = append(rrset.sigs, sig)
+			continue
+		}
+		rrset := get(rr.Header().Name, rr.Header().Rrtype)
+		rrset.rrs = append(rrset.rrs, rr)
+	}
+	// signatures without records are meaningless
+	var filtered []*dnssecRRSet
+	for _, rrset := range out {
+		if len(rrset.rrs) > 0 {
+			filtered = append(filtered, rrset)
+		}
+	}
+	return filtered
+}
+
+// ttl returns the amount of time for which we can cache the RRSet, i.e., the
+// minimum among the TTL of the records, the original TTL of the signatures, and
+// the time until the signatures expire.
+func (rrset *dnssecRRSet) ttl(now time.Time) time.Duration {
+	out := dnssecMaxZoneTTL
+	for _, rr := range rrset.rrs {
+		out = min(out, time.Duration(rr.Header().Ttl)*time.Second)
+	}
+	for _, sig := range rrset.sigs {
+		out = min(out, time.Duration(sig.OrigTtl)*time.Second)
+		out = min(out, max(0, time.Unix(int64(sig.Expiration), 0).Sub(now)))
+	}
+	return out
+}
+
+// dnssecFindRRSet returns the RRSet with the given owner and type or nil.
+func dnssecFindRRSet(rrsets []*dnssecRRSet, name string, rtype uint16) *dnssecRRSet {
+	for _, rrset := range rrsets {
+		hdr := rrset.rrs[0].Header()
+		if hdr.Rrtype == rtype && strings.EqualFold(hdr.Name, name) {
+			return rrset
+		}
+	}
+	return nil
+}
+
+// dnssecStatusSeverity allows to sort statuses from the best to the worst.
+var dnssecStatusSeverity = map[string]int{
+	model.DNSSECStatusSecure:        0,
+	model.DNSSECStatusInsecure:      1,
+	model.DNSSECStatusIndeterminate: 2,
+	model.DNSSECStatusBogus:         3,
+}
+
+// dnssecWorstStatus returns the worst of the given statuses.
+func dnssecWorstStatus(left, right string) string {
+	if dnssecStatusSeverity[right] > dnssecStatusSeverity[left] {
+		return right
+	}
+	return left
+}
+
+// validate validates the response to a query for the given name.
+func (t *DNSSECValidatingTransport) validate(ctx context.Context, name string, msg *dns.Msg) string {
+	switch msg.Rcode {
+	case dns.RcodeSuccess, dns.RcodeNameError:
+	default:
+		return model.DNSSECStatusIndeterminate
+	}
+	answers := dnssecGroupRRSets(msg.Answer)
+	if len(answers) <= 0 {
+		return t.validateDenial(ctx, name, msg)
+	}
+	status := model.DNSSECStatusSecure
+	for _, rrset := range answers {
+		zone := t.authenticate(ctx, rrset.rrs[0].Header().Name)
+		if zone.status != model.DNSSECStatusSecure {
+			status = dnssecWorstStatus(status, zone.status)
+			continue
+		}
+		if !t.verify(rrset, zone) {
+			status = dnssecWorstStatus(status, model.DNSSECStatusBogus)
+		}
+	}
+	return status
+}
+
+// validateDenial validates a negative response to a query for the given name.
+func (t *DNSSECValidatingTransport) validateDenial(ctx context.Context, name string, msg *dns.Msg) string {
+	zone := t.authenticate(ctx, name)
+	if zone.status != model.DNSSECStatusSecure {
+		return zone.status
+	}
+	var proofs int
+	for _, rrset := range dnssecGroupRRSets(msg.Ns) {
+		switch rrset.rrs[0].Header().Rrtype {
+		case dns.TypeNSEC, dns.TypeNSEC3:
+			proofs++
+		case dns.TypeSOA:
+		default:
+			continue
+		}
+		if !t.verify(rrset, zone) {
+			return model.DNSSECStatusBogus
+		}
+	}
+	if proofs <= 0 {
+		return model.DNSSECStatusBogus
+	}
+	return model.DNSSECStatusSecure
+}
+
+// verify returns whether a valid signature using one of the zone keys covers the RRSet.
+func (t *DNSSECValidatingTransport) verify(rrset *dnssecRRSet, zone *dnssecZone) bool {
+	for _, sig := range rrset.sigs {
+		if !strings.EqualFold(sig.SignerName, zone.name) || !sig.ValidityPeriod(t.timeNow()) {
+			continue
+		}
+		for _, key := range zone.keys {
+			if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+			if sig.Verify(key, rrset.rrs) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authenticate returns the zone containing the given name after walking the
+// chain of trust from the root zone down to such a zone.
+func (t *DNSSECValidatingTransport) authenticate(ctx context.Context, name string) *dnssecZone {
+	zone := t.cachedZoneOrLookup(ctx, ".", func() *dnssecZone {
+		return t.authenticateRoot(ctx)
+	})
+	labels := dns.SplitDomainName(name)
+	for idx := len(labels) - 1; idx >= 0 && zone.status == model.DNSSECStatusSecure; idx-- {
+		parent, child := zone, dns.Fqdn(strings.Join(labels[idx:], "."))
+		zone = t.cachedZoneOrLookup(ctx, child, func() *dnssecZone {
+			return t.descend(ctx, parent, child)
+		})
+	}
+	return zone
+}
+
+// cachedZoneOrLookup returns the cached zone for the given name or calls the given
+// function and caches its result when it's conclusive until its TTL expires.
+func (t *DNSSECValidatingTransport) cachedZoneOrLookup(
+	ctx context.Context, name string, fx func() *dnssecZone) *dnssecZone {
+	name = strings.ToLower(name)
+	t.mu.Lock()
+	entry, found := t.zones[name]
+	if found && !t.timeNow().Before(entry.expiresAt) {
+		delete(t.zones, name)
+		found = false
+	}
+	t.mu.Unlock()
+	if found {
+		return entry.zone
+	}
+	zone := fx()
+	switch zone.status {
+	case model.DNSSECStatusSecure, model.DNSSECStatusInsecure:
+		if zone.ttl > 0 {
+			t.mu.Lock()
+			t.zones[name] = &dnssecCachedZone{zone: zone, expiresAt: t.timeNow().Add(zone.ttl)}
+			t.mu.Unlock()
+		}
+	}
+	return zone
+}
+
+// errDNSSECUnexpectedRcode indicates that a DS or DNSKEY query failed.
+var errDNSSECUnexpectedRcode = errors.New("dnssec: unexpected rcode")
+
+// lookup sends a query with the DO and CD bits set and returns the response.
+func (t *DNSSECValidatingTransport) lookup(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	query := t.encoder.Encode(name, qtype, t.DNSTransport.RequiresPadding())
+	resp, err := t.DNSTransport.RoundTrip(ctx, &dnssecQuery{query})
+	if err != nil {
+		return nil, err
+	}
+	msg := &dns.Msg{}
+	if err := msg.Unpack(resp.Bytes()); err != nil {
+		return nil, err
+	}
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return nil, errDNSSECUnexpectedRcode
+	}
+	return msg, nil
+}
+
+// authenticateRoot authenticates the root zone using the trust anchors.
+func (t *DNSSECValidatingTransport) authenticateRoot(ctx context.Context) *dnssecZone {
+	return t.authenticateKeys(ctx, ".", t.anchors, dnssecMaxZoneTTL)
+}
+
+// authenticateKeys fetches the DNSKEYs of the given zone and authenticates them using
+// the given DS records (which are either trust anchors or come from the parent zone). The
+// dsTTL argument is the amount of time for which we can cache the DS records.
+func (t *DNSSECValidatingTransport) authenticateKeys(
+	ctx context.Context, name string, dss []*dns.DS, dsTTL time.Duration) *dnssecZone {
+	msg, err := t.lookup(ctx, name, dns.TypeDNSKEY)
+	if err != nil {
+		return &dnssecZone{name: name, status: model.DNSSECStatusIndeterminate}
+	}
+	rrset := dnssecFindRRSet(dnssecGroupRRSets(msg.Answer), name, dns.TypeDNSKEY)
+	if rrset == nil {
+		return &dnssecZone{name: name, status: model.DNSSECStatusBogus}
+	}
+	var keys []*dns.DNSKEY
+	for _, rr := range rrset.rrs {
+		if key, good := rr.(*dns.DNSKEY); good && key.Flags&dns.ZONE != 0 {
+			keys = append(keys, key)
+		}
+	}
+	// the DNSKEY RRSet must be signed by a key matching one of the DS records
+	for _, key := range keys {
+		if !dnssecKeyMatchesAnyDS(key, dss) {
+			continue
+		}
+		zone := &dnssecZone{name: name, status: model.DNSSECStatusSecure, keys: []*dns.DNSKEY{key}}
+		if t.verify(rrset, zone) {
+			zone.keys = keys
+			zone.ttl = min(dsTTL, rrset.ttl(t.timeNow()))
+			return zone
+		}
+	}
+	return &dnssecZone{name: name, status: model.DNSSECStatusBogus}
+}
+
+// dnssecKeyMatchesAnyDS returns whether the key matches any of the given DS records.
+func dnssecKeyMatchesAnyDS(key *dns.DNSKEY, dss []*dns.DS) bool {
+	for _, ds := range dss {
+		if ds.KeyTag != key.KeyTag() || ds.Algorithm != key.Algorithm {
+			continue
+		}
+		if computed := key.ToDS(ds.DigestType); computed != nil && strings.EqualFold(computed.Digest, ds.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// descend returns the zone containing the child name given the secure zone containing
+// its parent name. If there's a signed delegation, we return the child zone. If there's
+// an unsigned delegation, we return an insecure zone. Otherwise, we return the parent.
+func (t *DNSSECValidatingTransport) descend(ctx context.Context, parent *dnssecZone, child string) *dnssecZone {
+	msg, err := t.lookup(ctx, child, dns.TypeDS)
+	if err != nil {
+		return &dnssecZone{name: child, status: model.DNSSECStatusIndeterminate}
+	}
+
+	// case 1: signed delegation
+	if rrset := dnssecFindRRSet(dnssecGroupRRSets(msg.Answer), child, dns.TypeDS); rrset != nil {
+		if !t.verify(rrset, parent) {
+			return &dnssecZone{name: child, status: model.DNSSECStatusBogus}
+		}
+		var dss []*dns.DS
+		for _, rr := range rrset.rrs {
+			if ds, good := rr.(*dns.DS); good {
+				dss = append(dss, ds)
+			}
+		}
+		return t.authenticateKeys(ctx, child, dss, rrset.ttl(t.timeNow()))
+	}
+
+	// case 2: the parent must prove there is no DS using signed NSEC or NSEC3 records
+	var proofs []dns.RR
+	proofsTTL := parent.ttl
+	for _, rrset := range dnssecGroupRRSets(msg.Ns) {
+		switch rrset.rrs[0].Header().Rrtype {
+		case dns.TypeNSEC, dns.TypeNSEC3:
+			if !t.verify(rrset, parent) {
+				return &dnssecZone{name: child, status: model.DNSSECStatusBogus}
+			}
+			proofs = append(proofs, rrset.rrs...)
+			proofsTTL = min(proofsTTL, rrset.ttl(t.timeNow()))
+		}
+	}
+	if len(proofs) <= 0 {
+		return &dnssecZone{name: child, status: model.DNSSECStatusBogus}
+	}
+	if dnssecIsUnsignedDelegation(child, proofs) {
+		return &dnssecZone{name: child, status: model.DNSSECStatusInsecure, ttl: proofsTTL}
+	}
+
+	// case 3: the child name is not a zone cut
+	zone := *parent
+	zone.ttl = proofsTTL
+	return &zone
+}
+
+// dnssecIsUnsignedDelegation returns whether the given NSEC or NSEC3 records prove
+// that the name is a delegation point without DS records (see RFC4035 Sect. 5.2).
+func dnssecIsUnsignedDelegation(name string, proofs []dns.RR) bool {
+	isDelegation := func(bitmap []uint16) bool {
+		var hasNS, hasDS, hasSOA bool
+		for _, rtype := range bitmap {
+			switch rtype {
+			case dns.TypeNS:
+				hasNS = true
+			case dns.TypeDS:
+				hasDS = true
+			case dns.TypeSOA:
+				hasSOA = true
+			}
+		}
+		return hasNS && !hasDS && !hasSOA
+	}
+	for _, rr := range proofs {
+		switch proof := rr.(type) {
+		case *dns.NSEC:
+			if strings.EqualFold(proof.Hdr.Name, name) && isDelegation(proof.TypeBitMap) {
+				return true
+			}
+		case *dns.NSEC3:
+			if proof.Match(name) && isDelegation(proof.TypeBitMap) {
+				return true
+			}
+			// with opt-out, an unsigned delegation may not have its own NSEC3 record
+			if proof.Flags&0x01 != 0 && proof.Cover(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dnssecQuery wraps a [model.DNSQuery] to set the DO and CD bits.
+type dnssecQuery struct {
+	model.DNSQuery
+}
+
+// Bytes implements model.DNSQuery.
+func (q *dnssecQuery) Bytes() ([]byte, error) {
+	rawQuery, err := q.DNSQuery.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	msg := &dns.Msg{}
+	if err := msg.Unpack(rawQuery); err != nil {
+		return nil, err
+	}
+	// the CD bit prevents the upstream resolver from filtering bogus answers
+	msg.CheckingDisabled = true
+	if opt := msg.IsEdns0(); opt != nil {
+		opt.SetDo()
+	} else {
+		msg.SetEdns0(dnsEDNS0MaxResponseSize, true)
+	}
+	return msg.Pack()
+}
+
+// dnssecResponse is a [model.DNSSECValidatedResponse].
+type dnssecResponse struct {
+	model.DNSResponse
+
+	// query is the original query.
+	query model.DNSQuery
+
+	// status is the validation status.
+	status string
+}
+
+var _ model.DNSSECValidatedResponse = &dnssecResponse{}
+
+// Query implements model.DNSResponse.
+func (r *dnssecResponse) Query() model.DNSQuery {
+	return r.query
+}
+
+// DNSSECStatus implements model.DNSSECValidatedResponse.
+func (r *dnssecResponse) DNSSECStatus() string {
+	return r.status
+}
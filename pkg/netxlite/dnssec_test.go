@@ -0,0 +1,547 @@
+package netxlite
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// dnssecTestZone is a zone served by [*dnssecTestAuthority].
+type dnssecTestZone struct {
+	// key is the zone key or nil if the zone is unsigned.
+	key *dns.DNSKEY
+
+	// priv is the private key or nil if the zone is unsigned.
+	priv crypto.Signer
+}
+
+// dnssecTestAuthority answers queries for a small signed DNS hierarchy
+// on behalf of a recursive resolver that does not validate DNSSEC.
+type dnssecTestAuthority struct {
+	// records contains the records indexed by lowercase owner name.
+	records map[string][]dns.RR
+
+	// tamper is an optional hook to modify the response.
+	tamper func(query *dns.Msg, resp *dns.Msg)
+
+	// zones contains the zones indexed by name.
+	zones map[string]*dnssecTestZone
+}
+
+// newDNSSECTestAuthority creates the following hierarchy:
+//
+// - . (signed) delegates com. (signed)
+//
+// - com. delegates example.com. (signed) and insecure.com. (unsigned)
+//
+// - example.com. contains example.com. and www.example.com.
+//
+// - insecure.com. contains insecure.com.
+func newDNSSECTestAuthority() *dnssecTestAuthority {
+	a := &dnssecTestAuthority{
+		records: map[string][]dns.RR{},
+		zones:   map[string]*dnssecTestZone{},
+	}
+	a.addSignedZone(".")
+	a.addSignedZone("com.")
+	a.addSignedZone("example.com.")
+	a.zones["insecure.com."] = &dnssecTestZone{}
+	a.addRecord("insecure.com. 3600 IN NS ns.insecure.com.")
+	a.addRecord("example.com. 3600 IN A 93.184.216.34")
+	a.addRecord("www.example.com. 3600 IN A 93.184.216.34")
+	a.addRecord("insecure.com. 3600 IN A 10.0.0.1")
+	return a
+}
+
+// addSignedZone adds a signed zone along with its DS in the parent.
+func (a *dnssecTestAuthority) addSignedZone(name string) {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv := runtimex.Try1(key.Generate(256))
+	a.zones[name] = &dnssecTestZone{key: key, priv: priv.(crypto.Signer)}
+	a.records[name] = append(a.records[name], key)
+	if name != "." {
+		a.records[name] = append(a.records[name], key.ToDS(dns.SHA256))
+	}
+}
+
+// addRecord adds the given record.
+func (a *dnssecTestAuthority) addRecord(s string) {
+	rr := runtimex.Try1(dns.NewRR(s))
+	name := strings.ToLower(rr.Header().Name)
+	a.records[name] = append(a.records[name], rr)
+}
+
+// anchors returns the trust anchors for this authority.
+func (a *dnssecTestAuthority) anchors() []*dns.DS {
+	return []*dns.DS{a.zones["."].key.ToDS(dns.SHA256)}
+}
+
+// zoneFor returns the name of the zone authoritative for the given name and type.
+func (a *dnssecTestAuthority) zoneFor(name string, qtype uint16) string {
+	labels := dns.SplitDomainName(name)
+	start := 0
+	if qtype == dns.TypeDS {
+		start = 1 // DS records live in the parent zone
+	}
+	for idx := start; idx < len(labels); idx++ {
+		candidate := dns.Fqdn(strings.Join(labels[idx:], "."))
+		if _, found := a.zones[candidate]; found {
+			return candidate
+		}
+	}
+	return "."
+}
+
+// sign returns the RRSIG covering the given records using the given zone key or
+// nil when the zone is unsigned or is a child of an unsigned zone.
+func (a *dnssecTestAuthority) sign(zoneName string, rrs []dns.RR) dns.RR {
+	zone := a.zones[zoneName]
+	if zone.key == nil {
+		return nil
+	}
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+		KeyTag:     zone.key.KeyTag(),
+		SignerName: zone.key.Hdr.Name,
+		Algorithm:  zone.key.Algorithm,
+	}
+	runtimex.Try0(sig.Sign(zone.priv, rrs))
+	return sig
+}
+
+// answer answers the given query.
+func (a *dnssecTestAuthority) answer(query *dns.Msg) *dns.Msg {
+	q0 := query.Question[0]
+	name := strings.ToLower(q0.Name)
+	zoneName := a.zoneFor(name, q0.Qtype)
+	resp := &dns.Msg{}
+	resp.SetReply(query)
+	var (
+		rrs   []dns.RR
+		types []uint16
+	)
+	for _, rr := range a.records[name] {
+		rtype := rr.Header().Rrtype
+		if q0.Qtype == dns.TypeDS && rtype != dns.TypeDS && rtype != dns.TypeNS {
+			continue // the parent only knows about the delegation
+		}
+		types = append(types, rtype)
+		if rtype == q0.Qtype {
+			rrs = append(rrs, dns.Copy(rr))
+		}
+	}
+	if len(rrs) > 0 {
+		resp.Answer = rrs
+		if sig := a.sign(zoneName, rrs); sig != nil {
+			resp.Answer = append(resp.Answer, sig)
+		}
+	} else {
+		if len(a.records[name]) <= 0 {
+			resp.Rcode = dns.RcodeNameError
+		}
+		nsec := &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 3600},
+			NextDomain: "\\000." + name,
+			TypeBitMap: append(types, dns.TypeNSEC, dns.TypeRRSIG),
+		}
+		if sig := a.sign(zoneName, []dns.RR{nsec}); sig != nil {
+			resp.Ns = []dns.RR{nsec, sig}
+		}
+	}
+	if a.tamper != nil {
+		a.tamper(query, resp)
+	}
+	return resp
+}
+
+// newTransport returns a transport using this authority.
+func (a *dnssecTestAuthority) newTransport() *mocks.DNSTransport {
+	return &mocks.DNSTransport{
+		MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+			rawQuery := runtimex.Try1(query.Bytes())
+			msg := &dns.Msg{}
+			runtimex.Try0(msg.Unpack(rawQuery))
+			runtimex.Assert(msg.CheckingDisabled, "expected the CD bit")
+			runtimex.Assert(msg.IsEdns0() != nil && msg.IsEdns0().Do(), "expected the DO bit")
+			rawResp := runtimex.Try1(a.answer(msg).Pack())
+			return (&DNSDecoderMiekg{}).DecodeResponse(rawResp, query)
+		},
+		MockRequiresPadding: func() bool {
+			return false
+		},
+		MockNetwork: func() string {
+			return "udp"
+		},
+		MockAddress: func() string {
+			return "8.8.8.8:53"
+		},
+		MockCloseIdleConnections: func() {
+			// nothing
+		},
+	}
+}
+
+// newValidatingTransport returns a validating transport using this authority.
+func (a *dnssecTestAuthority) newValidatingTransport() *DNSSECValidatingTransport {
+	txp := NewDNSSECValidatingTransport(a.newTransport())
+	txp.anchors = a.anchors()
+	return txp
+}
+
+func TestDNSSECValidatingTransport(t *testing.T) {
+	type testconfig struct {
+		name         string
+		domain       string
+		qtype        uint16
+		tamper       func(query *dns.Msg, resp *dns.Msg)
+		expectStatus string
+	}
+
+	testcases := []testconfig{{
+		name:         "with a signed answer",
+		domain:       "example.com",
+		qtype:        dns.TypeA,
+		expectStatus: model.DNSSECStatusSecure,
+	}, {
+		name:         "with a signed answer for a name that is not a zone cut",
+		domain:       "www.example.com",
+		qtype:        dns.TypeA,
+		expectStatus: model.DNSSECStatusSecure,
+	}, {
+		name:         "with an answer from an unsigned zone",
+		domain:       "insecure.com",
+		qtype:        dns.TypeA,
+		expectStatus: model.DNSSECStatusInsecure,
+	}, {
+		name:         "with a signed NXDOMAIN",
+		domain:       "nonexistent.example.com",
+		qtype:        dns.TypeA,
+		expectStatus: model.DNSSECStatusSecure,
+	}, {
+		name:   "with a forged answer",
+		domain: "example.com",
+		qtype:  dns.TypeA,
+		tamper: func(query *dns.Msg, resp *dns.Msg) {
+			if query.Question[0].Qtype == dns.TypeA {
+				resp.Answer[0].(*dns.A).A = net.IPv4(10, 10, 34, 35)
+			}
+		},
+		expectStatus: model.DNSSECStatusBogus,
+	}, {
+		name:   "with a stripped signature",
+		domain: "example.com",
+		qtype:  dns.TypeA,
+		tamper: func(query *dns.Msg, resp *dns.Msg) {
+			if query.Question[0].Qtype == dns.TypeA {
+				resp.Answer = resp.Answer[:1]
+			}
+		},
+		expectStatus: model.DNSSECStatusBogus,
+	}, {
+		name:   "with a forged NXDOMAIN",
+		domain: "example.com",
+		qtype:  dns.TypeA,
+		tamper: func(query *dns.Msg, resp *dns.Msg) {
+			if query.Question[0].Qtype == dns.TypeA {
+				resp.Rcode = dns.RcodeNameError
+				resp.Answer = nil
+			}
+		},
+		expectStatus: model.DNSSECStatusBogus,
+	}, {
+		name:   "with a stripped DS pretending the zone is unsigned",
+		domain: "example.com",
+		qtype:  dns.TypeA,
+		tamper: func(query *dns.Msg, resp *dns.Msg) {
+			if query.Question[0].Qtype == dns.TypeDS {
+				resp.Answer = nil
+			}
+		},
+		expectStatus: model.DNSSECStatusBogus,
+	}, {
+		name:   "with a forged DS",
+		domain: "example.com",
+		qtype:  dns.TypeA,
+		tamper: func(query *dns.Msg, resp *dns.Msg) {
+			if query.Question[0].Qtype == dns.TypeDS && query.Question[0].Name == "example.com." {
+				resp.Answer[0].(*dns.DS).Digest = strings.Repeat("00", 32)
+			}
+		},
+		expectStatus: model.DNSSECStatusBogus,
+	}, {
+		name:   "with forged DNSKEYs",
+		domain: "example.com",
+		qtype:  dns.TypeA,
+		tamper: func(query *dns.Msg, resp *dns.Msg) {
+			if query.Question[0].Qtype == dns.TypeDNSKEY && query.Question[0].Name == "example.com." {
+				resp.Answer = resp.Answer[:1]
+			}
+		},
+		expectStatus: model.DNSSECStatusBogus,
+	}, {
+		name:   "with a forged NSEC pretending there is an unsigned delegation",
+		domain: "www.example.com",
+		qtype:  dns.TypeA,
+		tamper: func(query *dns.Msg, resp *dns.Msg) {
+			if query.Question[0].Qtype == dns.TypeDS && query.Question[0].Name == "www.example.com." {
+				resp.Ns[0].(*dns.NSEC).TypeBitMap = []uint16{dns.TypeNS, dns.TypeNSEC, dns.TypeRRSIG}
+			}
+		},
+		expectStatus: model.DNSSECStatusBogus,
+	}, {
+		name:   "when the root keys do not match the anchors",
+		domain: "example.com",
+		qtype:  dns.TypeA,
+		tamper: func(query *dns.Msg, resp *dns.Msg) {
+			if query.Question[0].Qtype == dns.TypeDNSKEY && query.Question[0].Name == "." {
+				resp.Answer = nil
+			}
+		},
+		expectStatus: model.DNSSECStatusBogus,
+	}, {
+		name:   "when we cannot fetch the chain of trust",
+		domain: "example.com",
+		qtype:  dns.TypeA,
+		tamper: func(query *dns.Msg, resp *dns.Msg) {
+			if query.Question[0].Qtype == dns.TypeDS {
+				resp.Rcode = dns.RcodeServerFailure
+			}
+		},
+		expectStatus: model.DNSSECStatusIndeterminate,
+	}, {
+		name:   "when the query fails with SERVFAIL",
+		domain: "example.com",
+		qtype:  dns.TypeA,
+		tamper: func(query *dns.Msg, resp *dns.Msg) {
+			if query.Question[0].Qtype == dns.TypeA {
+				resp.Rcode = dns.RcodeServerFailure
+			}
+		},
+		expectStatus: model.DNSSECStatusIndeterminate,
+	}}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			authority := newDNSSECTestAuthority()
+			authority.tamper = tc.tamper
+			txp := authority.newValidatingTransport()
+			query := (&DNSEncoderMiekg{}).Encode(tc.domain, tc.qtype, false)
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			validated := resp.(model.DNSSECValidatedResponse)
+			if got := validated.DNSSECStatus(); got != tc.expectStatus {
+				t.Fatal("expected", tc.expectStatus, "got", got)
+			}
+			if resp.Query() != query {
+				t.Fatal("unexpected query")
+			}
+		})
+	}
+
+	t.Run("we cache the authenticated zones", func(t *testing.T) {
+		authority := newDNSSECTestAuthority()
+		var count int
+		authority.tamper = func(query *dns.Msg, resp *dns.Msg) {
+			count++
+		}
+		txp := authority.newValidatingTransport()
+		for idx := 0; idx < 2; idx++ {
+			query := (&DNSEncoderMiekg{}).Encode("example.com", dns.TypeA, false)
+			if _, err := txp.RoundTrip(context.Background(), query); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// first round: A + DNSKEY . + DS com + DNSKEY com + DS example.com + DNSKEY example.com
+		// second round: A
+		if count != 7 {
+			t.Fatal("unexpected number of queries", count)
+		}
+	})
+
+	t.Run("we expire the cached zones according to their TTL", func(t *testing.T) {
+		authority := newDNSSECTestAuthority()
+		var count int
+		authority.tamper = func(query *dns.Msg, resp *dns.Msg) {
+			count++
+			// note: changing the TTL does not invalidate the signature
+			// because the RRSIG contains the original TTL
+			for _, rr := range resp.Answer {
+				if rr.Header().Rrtype == dns.TypeDNSKEY && rr.Header().Name == "example.com." {
+					rr.Header().Ttl = 60
+				}
+			}
+		}
+		txp := authority.newValidatingTransport()
+		now := time.Now()
+		txp.timeNow = func() time.Time {
+			return now
+		}
+		for _, elapsed := range []time.Duration{0, 30 * time.Second, 31 * time.Second} {
+			now = now.Add(elapsed)
+			query := (&DNSEncoderMiekg{}).Encode("example.com", dns.TypeA, false)
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.(model.DNSSECValidatedResponse).DNSSECStatus(); got != model.DNSSECStatusSecure {
+				t.Fatal("unexpected status", got)
+			}
+		}
+		// first round: A + DNSKEY . + DS com + DNSKEY com + DS example.com + DNSKEY example.com
+		// second round: A
+		// third round: A + DS example.com + DNSKEY example.com
+		if count != 10 {
+			t.Fatal("unexpected number of queries", count)
+		}
+	})
+
+	t.Run("we do not cache failures", func(t *testing.T) {
+		authority := newDNSSECTestAuthority()
+		var fail = true
+		authority.tamper = func(query *dns.Msg, resp *dns.Msg) {
+			if fail && query.Question[0].Qtype == dns.TypeDNSKEY {
+				resp.Rcode = dns.RcodeServerFailure
+			}
+		}
+		txp := authority.newValidatingTransport()
+		for _, expect := range []string{model.DNSSECStatusIndeterminate, model.DNSSECStatusSecure} {
+			query := (&DNSEncoderMiekg{}).Encode("example.com", dns.TypeA, false)
+			resp, err := txp.RoundTrip(context.Background(), query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.(model.DNSSECValidatedResponse).DNSSECStatus(); got != expect {
+				t.Fatal("expected", expect, "got", got)
+			}
+			fail = false
+		}
+	})
+
+	t.Run("when the underlying transport fails", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		txp := NewDNSSECValidatingTransport(&mocks.DNSTransport{
+			MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+				return nil, expected
+			},
+		})
+		query := (&DNSEncoderMiekg{}).Encode("example.com", dns.TypeA, false)
+		resp, err := txp.RoundTrip(context.Background(), query)
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if resp != nil {
+			t.Fatal("expected nil response")
+		}
+	})
+
+	t.Run("when the response cannot be parsed", func(t *testing.T) {
+		txp := NewDNSSECValidatingTransport(&mocks.DNSTransport{
+			MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+				return &mocks.DNSResponse{
+					MockBytes: func() []byte {
+						return []byte{1, 2, 3}
+					},
+				}, nil
+			},
+		})
+		query := (&DNSEncoderMiekg{}).Encode("example.com", dns.TypeA, false)
+		resp, err := txp.RoundTrip(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.(model.DNSSECValidatedResponse).DNSSECStatus(); got != model.DNSSECStatusIndeterminate {
+			t.Fatal("unexpected status", got)
+		}
+	})
+
+	t.Run("we use the underlying transport Network and Address", func(t *testing.T) {
+		txp := NewDNSSECValidatingTransport(&mocks.DNSTransport{
+			MockNetwork: func() string {
+				return "udp"
+			},
+			MockAddress: func() string {
+				return "8.8.8.8:53"
+			},
+		})
+		if txp.Network() != "udp" || txp.Address() != "8.8.8.8:53" {
+			t.Fatal("unexpected Network or Address")
+		}
+	})
+
+	t.Run("the bundled anchors are valid", func(t *testing.T) {
+		anchors := dnssecMustParseAnchors(dnssecRootAnchors)
+		if len(anchors) != 2 || anchors[0].KeyTag != 20326 || anchors[1].KeyTag != 38696 {
+			t.Fatal("unexpected anchors", anchors)
+		}
+	})
+}
+
+func TestNewParallelDNSSECValidatingResolver(t *testing.T) {
+	authority := newDNSSECTestAuthority()
+	reso := NewParallelDNSSECValidatingResolver(model.DiscardLogger, authority.newTransport())
+	addrs, err := reso.LookupHost(context.Background(), "www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0] != "93.184.216.34" {
+		t.Fatal("unexpected addrs", addrs)
+	}
+}
+
+func TestDNSSECQuery(t *testing.T) {
+	for _, padding := range []bool{false, true} {
+		query := &dnssecQuery{(&DNSEncoderMiekg{}).Encode("example.com", dns.TypeA, padding)}
+		rawQuery, err := query.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := &dns.Msg{}
+		if err := msg.Unpack(rawQuery); err != nil {
+			t.Fatal(err)
+		}
+		if !msg.CheckingDisabled || msg.IsEdns0() == nil || !msg.IsEdns0().Do() {
+			t.Fatal("expected the CD and DO bits", padding)
+		}
+	}
+
+	t.Run("when the query cannot be serialized", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		query := &dnssecQuery{&mocks.DNSQuery{
+			MockBytes: func() ([]byte, error) {
+				return nil, expected
+			},
+		}}
+		if _, err := query.Bytes(); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("when the query cannot be parsed", func(t *testing.T) {
+		query := &dnssecQuery{&mocks.DNSQuery{
+			MockBytes: func() ([]byte, error) {
+				return []byte{1, 2, 3}, nil
+			},
+		}}
+		if _, err := query.Bytes(); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
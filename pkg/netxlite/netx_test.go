@@ -11,6 +11,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/netem"
 	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/ooni/probe-engine/pkg/testingx"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 )
@@ -35,6 +36,20 @@ func TestNetxWithNetem(t *testing.T) {
 	nameServer := runtimex.Try1(netem.NewDNSServer(log.Log, nameServerStack, quad8Address, nameServerConfig))
 	defer nameServer.Close()
 
+	// also serve DNS-over-TLS and DNS-over-QUIC using the same config
+	nameServerTLSConfig := nameServerStack.MustNewServerTLSConfig("dns.google", quad8Address)
+	nameServerRtx := testingx.NewDNSRoundTripperWithDNSConfig(nameServerConfig)
+	dotListener := testingx.MustNewDNSOverTLSListener(
+		&net.TCPAddr{IP: net.ParseIP(quad8Address), Port: 853},
+		nameServerStack, nameServerTLSConfig, nameServerRtx,
+	)
+	defer dotListener.Close()
+	doqListener := testingx.MustNewDNSOverQUICListener(
+		&net.UDPAddr{IP: net.ParseIP(quad8Address), Port: 853},
+		&netemDNSOverUDPUnderlyingListener{nameServerStack}, nameServerTLSConfig, nameServerRtx,
+	)
+	defer doqListener.Close()
+
 	// create the web server handler
 	bonsoirElliot := []byte("Bonsoir, Elliot!\r\n")
 	webServerStack := runtimex.Try1(topology.AddHost(exampleComAddress, quad8Address, &netem.LinkConfig{}))
@@ -101,6 +116,30 @@ func TestNetxWithNetem(t *testing.T) {
 		}
 	})
 
+	t.Run("DNS-over-TLS lookup", func(t *testing.T) {
+		reso := netx.NewParallelDNSOverTLSResolver(log.Log, "8.8.8.8:853")
+		defer reso.CloseIdleConnections()
+		addrs, err := reso.LookupHost(context.Background(), "www.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{exampleComAddress}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("DNS-over-QUIC lookup", func(t *testing.T) {
+		reso := netx.NewParallelDNSOverQUICResolver(log.Log, "8.8.8.8:853")
+		defer reso.CloseIdleConnections()
+		addrs, err := reso.LookupHost(context.Background(), "www.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{exampleComAddress}, addrs); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
 	t.Run("HTTP/3 fetch", func(t *testing.T) {
 		txp := netx.NewHTTP3TransportStdlib(log.Log)
 		client := &http.Client{Transport: txp}
@@ -122,6 +161,17 @@ func TestNetxWithNetem(t *testing.T) {
 	})
 }
 
+// netemDNSOverUDPUnderlyingListener adapts a [*netem.UNetStack] to be
+// a [testingx.DNSOverUDPUnderlyingListener].
+type netemDNSOverUDPUnderlyingListener struct {
+	stack *netem.UNetStack
+}
+
+// ListenUDP implements testingx.DNSOverUDPUnderlyingListener.
+func (ul *netemDNSOverUDPUnderlyingListener) ListenUDP(network string, addr *net.UDPAddr) (net.PacketConn, error) {
+	return ul.stack.ListenUDP(network, addr)
+}
+
 // We generally do not listen here as part of other tests, since the listening
 // functionality is mainly only use for testingx. So, here's a specific test for that.
 func TestNetxListenTCP(t *testing.T) {
@@ -6,6 +6,7 @@ package netxlite
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
@@ -35,6 +36,34 @@ func (netx *Netx) NewParallelDNSOverHTTPSResolver(logger model.DebugLogger, URL
 	return WrapResolver(logger, NewUnwrappedParallelResolver(txp))
 }
 
+// NewParallelODoHResolver implements [model.MeasuringNetwork].
+func (netx *Netx) NewParallelODoHResolver(logger model.DebugLogger, URL string) model.Resolver {
+	client := &http.Client{Transport: netx.NewHTTPTransportStdlib(logger)}
+	txp := NewDNSOverODoHTransport(client, URL)
+	return WrapResolver(logger, NewUnwrappedParallelResolver(txp))
+}
+
+// NewParallelDNSSECValidatingResolver implements [model.MeasuringNetwork].
+func (netx *Netx) NewParallelDNSSECValidatingResolver(logger model.DebugLogger, txp model.DNSTransport) model.Resolver {
+	return NewParallelDNSSECValidatingResolver(logger, txp)
+}
+
+// NewParallelDNSOverTLSResolver implements [model.MeasuringNetwork].
+func (netx *Netx) NewParallelDNSOverTLSResolver(logger model.DebugLogger, address string) model.Resolver {
+	dialer := netx.NewDialerWithResolver(logger, netx.NewStdlibResolver(logger))
+	tlsDialer := NewTLSDialerWithConfig(
+		dialer, netx.NewTLSHandshakerStdlib(logger), &tls.Config{NextProtos: []string{"dot"}})
+	txp := NewDNSOverTLSTransport(tlsDialer.DialTLSContext, address)
+	return WrapResolver(logger, NewUnwrappedParallelResolver(txp))
+}
+
+// NewParallelDNSOverQUICResolver implements [model.MeasuringNetwork].
+func (netx *Netx) NewParallelDNSOverQUICResolver(logger model.DebugLogger, address string) model.Resolver {
+	dialer := netx.NewQUICDialerWithResolver(netx.NewUDPListener(), logger, netx.NewStdlibResolver(logger))
+	txp := NewDNSOverQUICTransport(dialer, address)
+	return WrapResolver(logger, NewUnwrappedParallelResolver(txp))
+}
+
 func (netx *Netx) newUnwrappedStdlibResolver() model.Resolver {
 	return &resolverSystem{
 		t: wrapDNSTransport(netx.newDNSOverGetaddrinfoTransport()),
@@ -76,6 +105,16 @@ func (netx *Netx) NewParallelUDPResolver(logger model.DebugLogger, dialer model.
 	))
 }
 
+// NewParallelUDPResolverWithCollectWindow is like NewParallelUDPResolver but each
+// query waits for the given window to collect all the responses (including responses
+// injected by censors) as documented in [DNSOverUDPTransport].
+func (netx *Netx) NewParallelUDPResolverWithCollectWindow(logger model.DebugLogger,
+	dialer model.Dialer, address string, window time.Duration) model.Resolver {
+	txp := NewUnwrappedDNSOverUDPTransport(dialer, address)
+	txp.CollectWindow = window
+	return WrapResolver(logger, NewUnwrappedParallelResolver(wrapDNSTransport(txp)))
+}
+
 // WrapResolver creates a new resolver that wraps an
 // existing resolver to add these properties:
 //
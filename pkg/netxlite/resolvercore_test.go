@@ -74,6 +74,28 @@ func TestNewParallelUDPResolver(t *testing.T) {
 	}
 }
 
+func TestNewParallelUDPResolverWithCollectWindow(t *testing.T) {
+	netx := &Netx{}
+	d := netx.NewDialerWithoutResolver(log.Log)
+	resolver := netx.NewParallelUDPResolverWithCollectWindow(log.Log, d, "1.1.1.1:53", time.Second)
+	idnaReso := resolver.(*resolverIDNA)
+	logger := idnaReso.Resolver.(*resolverLogger)
+	if logger.Logger != log.Log {
+		t.Fatal("invalid logger")
+	}
+	shortCircuit := logger.Resolver.(*ResolverShortCircuitIPAddr)
+	errWrapper := shortCircuit.Resolver.(*resolverErrWrapper)
+	para := errWrapper.Resolver.(*ParallelResolver)
+	txp := para.Transport().(*dnsTransportErrWrapper)
+	dnsTxp := txp.DNSTransport.(*DNSOverUDPTransport)
+	if dnsTxp.Address() != "1.1.1.1:53" {
+		t.Fatal("invalid address")
+	}
+	if dnsTxp.CollectWindow != time.Second {
+		t.Fatal("invalid collect window")
+	}
+}
+
 func TestNewParallelDNSOverHTTPSResolver(t *testing.T) {
 	netx := &Netx{}
 	resolver := netx.NewParallelDNSOverHTTPSResolver(log.Log, "https://1.1.1.1/dns-query")
@@ -92,6 +114,64 @@ func TestNewParallelDNSOverHTTPSResolver(t *testing.T) {
 	}
 }
 
+func TestNewParallelDNSOverTLSResolver(t *testing.T) {
+	netx := &Netx{}
+	resolver := netx.NewParallelDNSOverTLSResolver(log.Log, "1.1.1.1:853")
+	idnaReso := resolver.(*resolverIDNA)
+	logger := idnaReso.Resolver.(*resolverLogger)
+	if logger.Logger != log.Log {
+		t.Fatal("invalid logger")
+	}
+	shortCircuit := logger.Resolver.(*ResolverShortCircuitIPAddr)
+	errWrapper := shortCircuit.Resolver.(*resolverErrWrapper)
+	para := errWrapper.Resolver.(*ParallelResolver)
+	txp := para.Transport().(*dnsTransportErrWrapper)
+	dnsTxp := txp.DNSTransport.(*DNSOverTCPTransport)
+	if dnsTxp.Address() != "1.1.1.1:853" {
+		t.Fatal("invalid address")
+	}
+	if dnsTxp.Network() != "dot" {
+		t.Fatal("invalid network")
+	}
+}
+
+func TestNewParallelDNSOverQUICResolver(t *testing.T) {
+	netx := &Netx{}
+	resolver := netx.NewParallelDNSOverQUICResolver(log.Log, "94.140.14.140:853")
+	idnaReso := resolver.(*resolverIDNA)
+	logger := idnaReso.Resolver.(*resolverLogger)
+	if logger.Logger != log.Log {
+		t.Fatal("invalid logger")
+	}
+	shortCircuit := logger.Resolver.(*ResolverShortCircuitIPAddr)
+	errWrapper := shortCircuit.Resolver.(*resolverErrWrapper)
+	para := errWrapper.Resolver.(*ParallelResolver)
+	txp := para.Transport().(*dnsTransportErrWrapper)
+	dnsTxp := txp.DNSTransport.(*DNSOverQUICTransport)
+	if dnsTxp.Address() != "94.140.14.140:853" {
+		t.Fatal("invalid address")
+	}
+}
+
+func TestNewParallelODoHResolver(t *testing.T) {
+	const URL = "odoh://odoh1.surfdomeinen.nl/odoh.cloudflare-dns.com"
+	netx := &Netx{}
+	resolver := netx.NewParallelODoHResolver(log.Log, URL)
+	idnaReso := resolver.(*resolverIDNA)
+	logger := idnaReso.Resolver.(*resolverLogger)
+	if logger.Logger != log.Log {
+		t.Fatal("invalid logger")
+	}
+	shortCircuit := logger.Resolver.(*ResolverShortCircuitIPAddr)
+	errWrapper := shortCircuit.Resolver.(*resolverErrWrapper)
+	para := errWrapper.Resolver.(*ParallelResolver)
+	txp := para.Transport().(*dnsTransportErrWrapper)
+	dnsTxp := txp.DNSTransport.(*DNSOverODoHTransport)
+	if dnsTxp.Address() != URL {
+		t.Fatal("invalid address")
+	}
+}
+
 func TestResolverSystem(t *testing.T) {
 	t.Run("Network", func(t *testing.T) {
 		expected := "antani"
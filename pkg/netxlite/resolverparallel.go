@@ -79,12 +79,18 @@ func (r *ParallelResolver) LookupHost(ctx context.Context, hostname string) ([]s
 func (r *ParallelResolver) LookupHTTPS(
 	ctx context.Context, hostname string) (*model.HTTPSSvc, error) {
 	encoder := &DNSEncoderMiekg{}
+	trace := ContextTraceOrDefault(ctx)
 	query := encoder.Encode(hostname, dns.TypeHTTPS, r.Txp.RequiresPadding())
+	started := trace.TimeNow()
 	response, err := r.Txp.RoundTrip(ctx, query)
+	finished := trace.TimeNow()
 	if err != nil {
+		trace.OnDNSRoundTripForLookupHTTPS(started, r, query, response, nil, err, finished)
 		return nil, err
 	}
-	return response.DecodeHTTPS()
+	https, err := response.DecodeHTTPS()
+	trace.OnDNSRoundTripForLookupHTTPS(started, r, query, response, https, err, finished)
+	return https, err
 }
 
 // parallelResolverResult is the internal representation of a
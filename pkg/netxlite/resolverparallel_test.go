@@ -485,4 +485,60 @@ func TestParallelResolver(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("LookupHTTPS uses a context-injected custom trace", func(t *testing.T) {
+		for _, expectErr := range []error{nil, errors.New("mocked")} {
+			expectHTTPS := &model.HTTPSSvc{IPv4: []string{"1.1.1.1"}}
+			txp := &mocks.DNSTransport{
+				MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+					if expectErr != nil {
+						return nil, expectErr
+					}
+					return &mocks.DNSResponse{
+						MockDecodeHTTPS: func() (*model.HTTPSSvc, error) {
+							return expectHTTPS, nil
+						},
+					}, nil
+				},
+				MockNetwork: func() string {
+					return "mocked"
+				},
+				MockRequiresPadding: func() bool {
+					return false
+				},
+			}
+			r := NewUnwrappedParallelResolver(txp)
+			var called bool
+			tx := &mocks.Trace{
+				MockTimeNow: time.Now,
+				MockOnDNSRoundTripForLookupHTTPS: func(started time.Time, reso model.Resolver, query model.DNSQuery,
+					response model.DNSResponse, https *model.HTTPSSvc, err error, finished time.Time) {
+					called = true
+					if query.Type() != dns.TypeHTTPS {
+						t.Fatal("unexpected query type")
+					}
+					if !errors.Is(err, expectErr) {
+						t.Fatal("unexpected error", err)
+					}
+					if expectErr == nil && https != expectHTTPS {
+						t.Fatal("unexpected https")
+					}
+					if expectErr != nil && https != nil {
+						t.Fatal("expected nil https")
+					}
+				},
+			}
+			ctx := ContextWithTrace(context.Background(), tx)
+			https, err := r.LookupHTTPS(ctx, "example.com")
+			if !errors.Is(err, expectErr) {
+				t.Fatal("unexpected error", err)
+			}
+			if expectErr == nil && https != expectHTTPS {
+				t.Fatal("unexpected https")
+			}
+			if !called {
+				t.Fatal("trace not called")
+			}
+		}
+	})
 }
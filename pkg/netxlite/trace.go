@@ -67,6 +67,12 @@ func (*traceDefault) OnDNSRoundTripForLookupHost(started time.Time, reso model.R
 	// nothing
 }
 
+// OnDNSRoundTripForLookupHTTPS implements model.Trace.OnDNSRoundTripForLookupHTTPS.
+func (*traceDefault) OnDNSRoundTripForLookupHTTPS(started time.Time, reso model.Resolver, query model.DNSQuery,
+	response model.DNSResponse, https *model.HTTPSSvc, err error, finished time.Time) {
+	// nothing
+}
+
 // OnDelayedDNSResponse implements model.Trace.OnDelayedDNSResponse.
 func (*traceDefault) OnDelayedDNSResponse(started time.Time, txp model.DNSTransport,
 	query model.DNSQuery, response model.DNSResponse, addrs []string, err error, finished time.Time) error {
@@ -80,7 +80,20 @@ func NewUTLSConn(conn net.Conn, config *tls.Config, cid *utls.ClientHelloID) (*U
 		NextProtos:                  config.NextProtos,
 		ServerName:                  config.ServerName,
 	}
-	tlsConn := utls.UClient(conn, uConfig, *cid)
+	newSpec, custom := utlsCustomSpecs[*cid]
+	if !custom {
+		tlsConn := utls.UClient(conn, uConfig, *cid)
+		oconn := &UTLSConn{
+			UConn:             tlsConn,
+			testableHandshake: nil,
+			nc:                conn,
+		}
+		return oconn, nil
+	}
+	tlsConn := utls.UClient(conn, uConfig, utls.HelloCustom)
+	if err := tlsConn.ApplyPreset(newSpec()); err != nil {
+		return nil, err
+	}
 	oconn := &UTLSConn{
 		UConn:             tlsConn,
 		testableHandshake: nil,
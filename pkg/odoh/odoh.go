@@ -0,0 +1,423 @@
+// Package odoh implements the message format and the encryption scheme
+// of Oblivious DNS-over-HTTPS (ODoH) as specified by RFC9230.
+//
+// This package only deals with bytes. See [netxlite] for the DNS transport
+// using this package and [testingx] for ODoH targets and proxies.
+//
+// [netxlite]: https://pkg.go.dev/github.com/ooni/probe-engine/pkg/netxlite
+// [testingx]: https://pkg.go.dev/github.com/ooni/probe-engine/pkg/testingx
+package odoh
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cloudflare/circl/hpke"
+	"github.com/cloudflare/circl/kem"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// ContentType is the content type of ODoH messages.
+const ContentType = "application/oblivious-dns-message"
+
+// ConfigsPath is the well-known path from which targets serve their configs.
+const ConfigsPath = "/.well-known/odohconfigs"
+
+// Version is the only ObliviousDoHConfig version we support.
+const Version = 0x0001
+
+const (
+	// messageTypeQuery is the message type of queries.
+	messageTypeQuery = 0x01
+
+	// messageTypeResponse is the message type of responses.
+	messageTypeResponse = 0x02
+)
+
+var (
+	// ErrNoSupportedConfig indicates that the ObliviousDoHConfigs we
+	// parsed do not contain any config we can use.
+	ErrNoSupportedConfig = errors.New("odoh: no supported config")
+
+	// ErrInvalidMessage indicates that we could not parse a message.
+	ErrInvalidMessage = errors.New("odoh: invalid message")
+
+	// ErrUnexpectedMessageType indicates we received a message whose type
+	// differs from the one we expected (e.g., a query instead of a response).
+	ErrUnexpectedMessageType = errors.New("odoh: unexpected message type")
+
+	// ErrUnknownKeyID indicates that a query uses a key ID we don't know.
+	ErrUnknownKeyID = errors.New("odoh: unknown key ID")
+)
+
+// Config is an ObliviousDoHConfig (see RFC9230 Sect. 6).
+type Config struct {
+	// KEM is the HPKE KEM.
+	KEM hpke.KEM
+
+	// KDF is the HPKE KDF.
+	KDF hpke.KDF
+
+	// AEAD is the HPKE AEAD.
+	AEAD hpke.AEAD
+
+	// PublicKey is the serialized public key of the target.
+	PublicKey []byte
+}
+
+// contents returns the serialized ObliviousDoHConfigContents.
+func (c *Config) contents() []byte {
+	var b cryptobyte.Builder
+	b.AddUint16(uint16(c.KEM))
+	b.AddUint16(uint16(c.KDF))
+	b.AddUint16(uint16(c.AEAD))
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(c.PublicKey)
+	})
+	return b.BytesOrPanic()
+}
+
+// KeyID returns the key ID identifying this config (see RFC9230 Sect. 6.2).
+func (c *Config) KeyID() []byte {
+	prk := c.KDF.Extract(c.contents(), nil)
+	return c.KDF.Expand(prk, []byte("odoh key id"), uint(c.KDF.ExtractSize()))
+}
+
+// supported returns whether we support the config algorithms.
+func (c *Config) supported() bool {
+	return c.KEM.IsValid() && c.KDF.IsValid() && c.AEAD.IsValid()
+}
+
+// MarshalConfigs serializes the given configs as ObliviousDoHConfigs.
+func MarshalConfigs(configs ...*Config) []byte {
+	var b cryptobyte.Builder
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, c := range configs {
+			b.AddUint16(Version)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddBytes(c.contents())
+			})
+		}
+	})
+	return b.BytesOrPanic()
+}
+
+// ParseConfigs parses serialized ObliviousDoHConfigs and returns the configs we
+// support in the order in which they appear. As mandated by RFC9230 Sect. 6,
+// we skip configs using unknown versions or algorithms.
+func ParseConfigs(data []byte) ([]*Config, error) {
+	var list cryptobyte.String
+	input := cryptobyte.String(data)
+	if !input.ReadUint16LengthPrefixed(&list) || !input.Empty() {
+		return nil, fmt.Errorf("%w: cannot parse configs", ErrInvalidMessage)
+	}
+	var out []*Config
+	for !list.Empty() {
+		var (
+			version  uint16
+			contents cryptobyte.String
+		)
+		if !list.ReadUint16(&version) || !list.ReadUint16LengthPrefixed(&contents) {
+			return nil, fmt.Errorf("%w: cannot parse config", ErrInvalidMessage)
+		}
+		if version != Version {
+			continue
+		}
+		var (
+			kemID, kdfID, aeadID uint16
+			publicKey            cryptobyte.String
+		)
+		if !contents.ReadUint16(&kemID) || !contents.ReadUint16(&kdfID) || !contents.ReadUint16(&aeadID) ||
+			!contents.ReadUint16LengthPrefixed(&publicKey) || !contents.Empty() {
+			return nil, fmt.Errorf("%w: cannot parse config contents", ErrInvalidMessage)
+		}
+		config := &Config{
+			KEM:       hpke.KEM(kemID),
+			KDF:       hpke.KDF(kdfID),
+			AEAD:      hpke.AEAD(aeadID),
+			PublicKey: publicKey,
+		}
+		if !config.supported() {
+			continue
+		}
+		out = append(out, config)
+	}
+	if len(out) <= 0 {
+		return nil, ErrNoSupportedConfig
+	}
+	return out, nil
+}
+
+// message is an ObliviousDoHMessage (see RFC9230 Sect. 6.1).
+type message struct {
+	messageType      uint8
+	keyID            []byte
+	encryptedMessage []byte
+}
+
+// marshal serializes the message.
+func (m *message) marshal() []byte {
+	var b cryptobyte.Builder
+	b.AddUint8(m.messageType)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(m.keyID)
+	})
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(m.encryptedMessage)
+	})
+	return b.BytesOrPanic()
+}
+
+// parseMessage parses a message with the expected type.
+func parseMessage(data []byte, expectedType uint8) (*message, error) {
+	var (
+		m                       message
+		keyID, encryptedMessage cryptobyte.String
+		input                   = cryptobyte.String(data)
+	)
+	if !input.ReadUint8(&m.messageType) || !input.ReadUint16LengthPrefixed(&keyID) ||
+		!input.ReadUint16LengthPrefixed(&encryptedMessage) || !input.Empty() {
+		return nil, ErrInvalidMessage
+	}
+	if m.messageType != expectedType {
+		return nil, ErrUnexpectedMessageType
+	}
+	m.keyID, m.encryptedMessage = keyID, encryptedMessage
+	return &m, nil
+}
+
+// marshalPlaintext serializes an ObliviousDoHMessagePlaintext without padding. We
+// do not add any padding because we already pad the DNS message using EDNS(0).
+func marshalPlaintext(dnsMessage []byte) ([]byte, error) {
+	var b cryptobyte.Builder
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(dnsMessage)
+	})
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		// no padding
+	})
+	return b.Bytes()
+}
+
+// parsePlaintext parses an ObliviousDoHMessagePlaintext and returns the DNS message.
+func parsePlaintext(data []byte) ([]byte, error) {
+	var (
+		dnsMessage, padding cryptobyte.String
+		input               = cryptobyte.String(data)
+	)
+	if !input.ReadUint16LengthPrefixed(&dnsMessage) || !input.ReadUint16LengthPrefixed(&padding) || !input.Empty() {
+		return nil, fmt.Errorf("%w: cannot parse plaintext", ErrInvalidMessage)
+	}
+	return dnsMessage, nil
+}
+
+// aad returns the AEAD additional data for the given message type and key ID.
+func aad(messageType uint8, keyID []byte) []byte {
+	var b cryptobyte.Builder
+	b.AddUint8(messageType)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(keyID)
+	})
+	return b.BytesOrPanic()
+}
+
+// responseNonceSize returns the size of the response nonce.
+func responseNonceSize(aead hpke.AEAD) uint {
+	return max(aead.KeySize(), aead.NonceSize())
+}
+
+// responseAEAD derives the AEAD for encrypting and decrypting the
+// response to the given query (see RFC9230 Sect. 6.4).
+func responseAEAD(ctx hpke.Context, config *Config, queryPlaintext, responseNonce []byte) (*responseCipher, error) {
+	secret := ctx.Export([]byte("odoh response"), config.AEAD.KeySize())
+	var b cryptobyte.Builder
+	b.AddBytes(queryPlaintext)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(responseNonce)
+	})
+	salt := b.BytesOrPanic()
+	prk := config.KDF.Extract(secret, salt)
+	key := config.KDF.Expand(prk, []byte("odoh key"), config.AEAD.KeySize())
+	nonce := config.KDF.Expand(prk, []byte("odoh nonce"), config.AEAD.NonceSize())
+	aead, err := config.AEAD.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &responseCipher{aead: aead, nonce: nonce, responseNonce: responseNonce}, nil
+}
+
+// QueryContext allows to decrypt the response to a query. The zero value
+// is invalid; please, use [EncryptQuery] to construct.
+type QueryContext struct {
+	config         *Config
+	sealer         hpke.Sealer
+	queryPlaintext []byte
+}
+
+// EncryptQuery encrypts the given DNS query using the given config and returns the
+// serialized ObliviousDoHMessage along with the context for decrypting the response.
+func EncryptQuery(config *Config, query []byte) ([]byte, *QueryContext, error) {
+	return encryptQuery(rand.Reader, config, query)
+}
+
+func encryptQuery(rnd io.Reader, config *Config, query []byte) ([]byte, *QueryContext, error) {
+	if !config.supported() {
+		return nil, nil, ErrNoSupportedConfig
+	}
+	publicKey, err := config.KEM.Scheme().UnmarshalBinaryPublicKey(config.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	suite := hpke.NewSuite(config.KEM, config.KDF, config.AEAD)
+	sender, err := suite.NewSender(publicKey, []byte("odoh query"))
+	if err != nil {
+		return nil, nil, err
+	}
+	enc, sealer, err := sender.Setup(rnd)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := marshalPlaintext(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyID := config.KeyID()
+	ciphertext, err := sealer.Seal(plaintext, aad(messageTypeQuery, keyID))
+	if err != nil {
+		return nil, nil, err
+	}
+	m := &message{
+		messageType:      messageTypeQuery,
+		keyID:            keyID,
+		encryptedMessage: append(enc, ciphertext...),
+	}
+	qctx := &QueryContext{config: config, sealer: sealer, queryPlaintext: plaintext}
+	return m.marshal(), qctx, nil
+}
+
+// DecryptResponse decrypts the serialized ObliviousDoHMessage containing
+// the response and returns the DNS response message.
+func (qctx *QueryContext) DecryptResponse(data []byte) ([]byte, error) {
+	m, err := parseMessage(data, messageTypeResponse)
+	if err != nil {
+		return nil, err
+	}
+	// the key_id field of a response contains the response nonce
+	rc, err := responseAEAD(qctx.sealer, qctx.config, qctx.queryPlaintext, m.keyID)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := rc.aead.Open(nil, rc.nonce, m.encryptedMessage, aad(messageTypeResponse, m.keyID))
+	if err != nil {
+		return nil, err
+	}
+	return parsePlaintext(plaintext)
+}
+
+// responseCipher encrypts or decrypts a response.
+type responseCipher struct {
+	aead          cipher.AEAD
+	nonce         []byte
+	responseNonce []byte
+}
+
+// KeyPair is the key pair used by an ODoH target. The zero
+// value is invalid; please, use [NewKeyPair] to construct.
+type KeyPair struct {
+	// Config is the config corresponding to this key pair.
+	Config *Config
+
+	// privateKey is the private key.
+	privateKey kem.PrivateKey
+}
+
+// NewKeyPair generates a new [*KeyPair] for the given algorithms.
+func NewKeyPair(kemID hpke.KEM, kdfID hpke.KDF, aeadID hpke.AEAD) (*KeyPair, error) {
+	config := &Config{KEM: kemID, KDF: kdfID, AEAD: aeadID}
+	if !config.supported() {
+		return nil, ErrNoSupportedConfig
+	}
+	publicKey, privateKey, err := kemID.Scheme().GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	config.PublicKey, err = publicKey.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{Config: config, privateKey: privateKey}, nil
+}
+
+// ResponseContext allows to encrypt the response to a query. The zero value
+// is invalid; please, use [*KeyPair.DecryptQuery] to construct.
+type ResponseContext struct {
+	config         *Config
+	opener         hpke.Opener
+	queryPlaintext []byte
+}
+
+// DecryptQuery decrypts the serialized ObliviousDoHMessage containing a query and
+// returns the DNS query message along with the context for encrypting the response.
+func (kp *KeyPair) DecryptQuery(data []byte) ([]byte, *ResponseContext, error) {
+	m, err := parseMessage(data, messageTypeQuery)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyID := kp.Config.KeyID()
+	if string(m.keyID) != string(keyID) {
+		return nil, nil, ErrUnknownKeyID
+	}
+	encSize := kp.Config.KEM.Scheme().CiphertextSize()
+	if len(m.encryptedMessage) < encSize {
+		return nil, nil, ErrInvalidMessage
+	}
+	enc, ciphertext := m.encryptedMessage[:encSize], m.encryptedMessage[encSize:]
+	suite := hpke.NewSuite(kp.Config.KEM, kp.Config.KDF, kp.Config.AEAD)
+	receiver, err := suite.NewReceiver(kp.privateKey, []byte("odoh query"))
+	if err != nil {
+		return nil, nil, err
+	}
+	opener, err := receiver.Setup(enc)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := opener.Open(ciphertext, aad(messageTypeQuery, keyID))
+	if err != nil {
+		return nil, nil, err
+	}
+	query, err := parsePlaintext(plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	rctx := &ResponseContext{config: kp.Config, opener: opener, queryPlaintext: plaintext}
+	return query, rctx, nil
+}
+
+// EncryptResponse encrypts the given DNS response and returns the serialized ObliviousDoHMessage.
+func (rctx *ResponseContext) EncryptResponse(response []byte) ([]byte, error) {
+	return rctx.encryptResponse(rand.Reader, response)
+}
+
+func (rctx *ResponseContext) encryptResponse(rnd io.Reader, response []byte) ([]byte, error) {
+	responseNonce := make([]byte, responseNonceSize(rctx.config.AEAD))
+	if _, err := io.ReadFull(rnd, responseNonce); err != nil {
+		return nil, err
+	}
+	rc, err := responseAEAD(rctx.opener, rctx.config, rctx.queryPlaintext, responseNonce)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := marshalPlaintext(response)
+	if err != nil {
+		return nil, err
+	}
+	m := &message{
+		messageType:      messageTypeResponse,
+		keyID:            responseNonce,
+		encryptedMessage: rc.aead.Seal(nil, rc.nonce, plaintext, aad(messageTypeResponse, responseNonce)),
+	}
+	return m.marshal(), nil
+}
@@ -0,0 +1,231 @@
+package odoh
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/cloudflare/circl/hpke"
+	"github.com/ooni/probe-engine/pkg/mocks"
+)
+
+func TestConfigs(t *testing.T) {
+	t.Run("we can marshal and parse configs", func(t *testing.T) {
+		kp, err := NewKeyPair(hpke.KEM_X25519_HKDF_SHA256, hpke.KDF_HKDF_SHA256, hpke.AEAD_AES128GCM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		configs, err := ParseConfigs(MarshalConfigs(kp.Config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(configs) != 1 {
+			t.Fatal("expected one config")
+		}
+		if !bytes.Equal(configs[0].KeyID(), kp.Config.KeyID()) {
+			t.Fatal("key ID mismatch")
+		}
+	})
+
+	t.Run("we skip unsupported configs", func(t *testing.T) {
+		kp, err := NewKeyPair(hpke.KEM_X25519_HKDF_SHA256, hpke.KDF_HKDF_SHA256, hpke.AEAD_AES128GCM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		unsupported := &Config{KEM: 0xffff, KDF: hpke.KDF_HKDF_SHA256, AEAD: hpke.AEAD_AES128GCM}
+		configs, err := ParseConfigs(MarshalConfigs(unsupported, kp.Config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(configs) != 1 || configs[0].KEM != hpke.KEM_X25519_HKDF_SHA256 {
+			t.Fatal("unexpected configs", configs)
+		}
+	})
+
+	t.Run("we skip unsupported versions", func(t *testing.T) {
+		data := []byte{0x00, 0x06, 0x00, 0x02, 0x00, 0x02, 0xaa, 0xbb}
+		configs, err := ParseConfigs(data)
+		if !errors.Is(err, ErrNoSupportedConfig) {
+			t.Fatal("unexpected error", err)
+		}
+		if len(configs) != 0 {
+			t.Fatal("expected no configs")
+		}
+	})
+
+	t.Run("we reject invalid data", func(t *testing.T) {
+		inputs := [][]byte{
+			{},
+			{0x00, 0x03, 0x00},
+			{0x00, 0x04, 0x00, 0x01, 0x00, 0x10},
+			{0x00, 0x07, 0x00, 0x01, 0x00, 0x03, 0x00, 0x20, 0x00},
+			{0x00, 0x01, 0x00, 0x02},
+		}
+		for _, input := range inputs {
+			if _, err := ParseConfigs(input); !errors.Is(err, ErrInvalidMessage) {
+				t.Fatal("unexpected error", err, input)
+			}
+		}
+	})
+
+	t.Run("NewKeyPair rejects unsupported algorithms", func(t *testing.T) {
+		kp, err := NewKeyPair(0xffff, hpke.KDF_HKDF_SHA256, hpke.AEAD_AES128GCM)
+		if !errors.Is(err, ErrNoSupportedConfig) {
+			t.Fatal("unexpected error", err)
+		}
+		if kp != nil {
+			t.Fatal("expected nil key pair")
+		}
+	})
+}
+
+func TestQueryResponse(t *testing.T) {
+	newKeyPair := func(t *testing.T) *KeyPair {
+		kp, err := NewKeyPair(hpke.KEM_X25519_HKDF_SHA256, hpke.KDF_HKDF_SHA256, hpke.AEAD_AES128GCM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return kp
+	}
+
+	t.Run("successful round trip", func(t *testing.T) {
+		kp := newKeyPair(t)
+		query, response := []byte("the DNS query"), []byte("the DNS response")
+		encryptedQuery, qctx, err := EncryptQuery(kp.Config, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotQuery, rctx, err := kp.DecryptQuery(encryptedQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gotQuery, query) {
+			t.Fatal("unexpected query", gotQuery)
+		}
+		encryptedResponse, err := rctx.EncryptResponse(response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotResponse, err := qctx.DecryptResponse(encryptedResponse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(gotResponse, response) {
+			t.Fatal("unexpected response", gotResponse)
+		}
+	})
+
+	t.Run("the target rejects queries using another key", func(t *testing.T) {
+		encryptedQuery, _, err := EncryptQuery(newKeyPair(t).Config, []byte("the DNS query"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := newKeyPair(t).DecryptQuery(encryptedQuery); !errors.Is(err, ErrUnknownKeyID) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("the target rejects responses", func(t *testing.T) {
+		m := &message{messageType: messageTypeResponse}
+		if _, _, err := newKeyPair(t).DecryptQuery(m.marshal()); !errors.Is(err, ErrUnexpectedMessageType) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("the target rejects truncated queries", func(t *testing.T) {
+		kp := newKeyPair(t)
+		m := &message{messageType: messageTypeQuery, keyID: kp.Config.KeyID(), encryptedMessage: []byte{1}}
+		if _, _, err := kp.DecryptQuery(m.marshal()); !errors.Is(err, ErrInvalidMessage) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("the target rejects garbage", func(t *testing.T) {
+		if _, _, err := newKeyPair(t).DecryptQuery([]byte{1, 2, 3}); !errors.Is(err, ErrInvalidMessage) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("the client rejects tampered responses", func(t *testing.T) {
+		kp := newKeyPair(t)
+		encryptedQuery, qctx, err := EncryptQuery(kp.Config, []byte("the DNS query"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, rctx, err := kp.DecryptQuery(encryptedQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encryptedResponse, err := rctx.EncryptResponse([]byte("the DNS response"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		encryptedResponse[len(encryptedResponse)-1] ^= 0xff
+		if _, err := qctx.DecryptResponse(encryptedResponse); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("the client rejects queries", func(t *testing.T) {
+		kp := newKeyPair(t)
+		encryptedQuery, qctx, err := EncryptQuery(kp.Config, []byte("the DNS query"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := qctx.DecryptResponse(encryptedQuery); !errors.Is(err, ErrUnexpectedMessageType) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("EncryptQuery rejects invalid public keys", func(t *testing.T) {
+		config := &Config{
+			KEM:       hpke.KEM_X25519_HKDF_SHA256,
+			KDF:       hpke.KDF_HKDF_SHA256,
+			AEAD:      hpke.AEAD_AES128GCM,
+			PublicKey: []byte{1, 2, 3},
+		}
+		if _, _, err := EncryptQuery(config, []byte("the DNS query")); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("EncryptQuery rejects unsupported configs", func(t *testing.T) {
+		config := &Config{KEM: 0xffff}
+		if _, _, err := EncryptQuery(config, nil); !errors.Is(err, ErrNoSupportedConfig) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("encryptQuery fails if we cannot read random bytes", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		reader := &mocks.Reader{
+			MockRead: func(b []byte) (int, error) {
+				return 0, expected
+			},
+		}
+		if _, _, err := encryptQuery(reader, newKeyPair(t).Config, nil); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("encryptResponse fails if we cannot read random bytes", func(t *testing.T) {
+		kp := newKeyPair(t)
+		encryptedQuery, _, err := EncryptQuery(kp.Config, []byte("the DNS query"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, rctx, err := kp.DecryptQuery(encryptedQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := errors.New("mocked error")
+		reader := &mocks.Reader{
+			MockRead: func(b []byte) (int, error) {
+				return 0, expected
+			},
+		}
+		if _, err := rctx.encryptResponse(reader, nil); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
@@ -0,0 +1,30 @@
+// Package oodnshelperd implements the DNS test helper.
+//
+// The DNS test helper is an authoritative DNS server for a zone controlled by OONI,
+// which allows probes to detect DNS manipulation independently of the variability
+// of the answers returned by CDNs. To this end, the helper answers to queries for any
+// name inside the zone, such that probes can query for random subdomains that no
+// resolver could have cached or could have been configured to answer for. Then, the
+// probe compares the answer it received with the answer it should have received.
+//
+// The helper answers A and AAAA queries using the configured addresses and answers TXT
+// queries echoing information about the query it received, which allows the probe to
+// learn which resolver is forwarding its queries. Each TXT string has the "key=value"
+// format and we currently emit the following keys:
+//
+// - resolver: the IP address from which we received the query;
+//
+// - edns_udp_size: the EDNS UDP payload size, if the query uses EDNS;
+//
+// - edns_do: whether the EDNS DO bit is set, if the query uses EDNS;
+//
+// - edns_options: the comma separated EDNS option codes, if any;
+//
+// - edns_client_subnet: the EDNS client subnet, if any (e.g., "130.192.91.0/24").
+//
+// The helper answers to queries outside of the zone using REFUSED.
+//
+// The helper serves queries using both UDP and TCP. When a response does not fit
+// into the size the client can handle over UDP, we truncate the response and set
+// the TC bit, such that the client can retry using TCP.
+package oodnshelperd
@@ -0,0 +1,332 @@
+package oodnshelperd
+
+//
+// DNS handler
+//
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// Handler is the DNS test helper handler.
+//
+// The zero value is invalid; construct using [NewHandler].
+type Handler struct {
+	// Addresses contains the OPTIONAL IPv4 and IPv6 addresses we use to answer
+	// A and AAAA queries for any name inside the zone. When this field does not
+	// contain any address for a given family, we return an empty answer.
+	Addresses []string
+
+	// QueryLog is the OPTIONAL writer where we log each query inside the zone
+	// using the JSON lines format. See [QueryLogEntry] for the format.
+	QueryLog io.Writer
+
+	// TTL is the OPTIONAL TTL of the records we serve. We default to zero
+	// such that resolvers do not cache the information we echo.
+	TTL uint32
+
+	// logger is the MANDATORY logger to use.
+	logger model.Logger
+
+	// mu provides mutual exclusion for writing the query log.
+	mu sync.Mutex
+
+	// timeNow is the MANDATORY function returning the current time.
+	timeNow func() time.Time
+
+	// zone is the MANDATORY zone for which we are authoritative.
+	zone string
+}
+
+// NewHandler creates a new [*Handler] that is authoritative for the given zone.
+func NewHandler(logger model.Logger, zone string) *Handler {
+	return &Handler{
+		Addresses: []string{},
+		QueryLog:  nil,
+		TTL:       0,
+		logger:    logger,
+		mu:        sync.Mutex{},
+		timeNow:   time.Now,
+		zone:      dns.Fqdn(strings.ToLower(zone)),
+	}
+}
+
+// QueryLogEntry is an entry of the [Handler] QueryLog.
+type QueryLogEntry struct {
+	// T is the time when we received the query.
+	T time.Time `json:"t"`
+
+	// Resolver is the IP address from which we received the query.
+	Resolver string `json:"resolver"`
+
+	// Name is the name we have been queried for.
+	Name string `json:"name"`
+
+	// Type is the query type (e.g., "A").
+	Type string `json:"type"`
+
+	// EDNSUDPSize is the EDNS UDP payload size or zero.
+	EDNSUDPSize uint16 `json:"edns_udp_size,omitempty"`
+
+	// EDNSDo indicates whether the EDNS DO bit was set.
+	EDNSDo bool `json:"edns_do,omitempty"`
+
+	// EDNSClientSubnet is the EDNS client subnet, if any.
+	EDNSClientSubnet string `json:"edns_client_subnet,omitempty"`
+}
+
+// handlerTCPIdleTimeout is the time after which we close an idle TCP connection.
+const handlerTCPIdleTimeout = 10 * time.Second
+
+// Serve answers the queries received from the given UDP conn until reading from the
+// conn fails, which typically happens when the caller closes the conn.
+func (h *Handler) Serve(pconn net.PacketConn) error {
+	for {
+		// read incoming raw query
+		buffer := make([]byte, dns.MaxMsgSize)
+		count, addr, err := pconn.ReadFrom(buffer)
+		if err != nil {
+			return err
+		}
+
+		// compute the raw response
+		rawResponse, err := h.RoundTrip(buffer[:count], addr)
+		if err != nil {
+			h.logger.Warnf("oodnshelperd: cannot answer query from %s: %s", addr.String(), err.Error())
+			continue
+		}
+
+		// send the raw response
+		_, _ = pconn.WriteTo(rawResponse, addr)
+	}
+}
+
+// ServeTCP accepts connections from the given listener and answers the queries received
+// from each of them until accepting fails, which typically happens when the caller
+// closes the listener. When this happens, we also close the accepted connections.
+func (h *Handler) ServeTCP(listener net.Listener) error {
+	conns := map[net.Conn]bool{}
+	mu := &sync.Mutex{}
+	defer func() {
+		defer mu.Unlock()
+		mu.Lock()
+		for conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		// track the conn such that we can close it when we're done
+		mu.Lock()
+		conns[conn] = true
+		mu.Unlock()
+
+		go func() {
+			defer func() {
+				defer mu.Unlock()
+				mu.Lock()
+				delete(conns, conn)
+				_ = conn.Close()
+			}()
+			h.serveConn(conn)
+		}()
+	}
+}
+
+// serveConn answers the queries received from the given TCP conn until reading
+// fails, which also happens when the conn has been idle for too much time.
+func (h *Handler) serveConn(conn net.Conn) {
+	for {
+		// read incoming raw query, which is prefixed by its length
+		_ = conn.SetDeadline(time.Now().Add(handlerTCPIdleTimeout))
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		buffer := make([]byte, int(header[0])<<8|int(header[1]))
+		if _, err := io.ReadFull(conn, buffer); err != nil {
+			return
+		}
+
+		// compute the raw response, which does not need to be truncated
+		rawResponse, err := h.roundTrip(buffer, conn.RemoteAddr(), dns.MaxMsgSize)
+		if err != nil {
+			h.logger.Warnf("oodnshelperd: cannot answer query from %s: %s", conn.RemoteAddr().String(), err.Error())
+			return
+		}
+
+		// send the raw response prefixed by its length
+		rawResponse = append([]byte{byte(len(rawResponse) >> 8), byte(len(rawResponse))}, rawResponse...)
+		if _, err := conn.Write(rawResponse); err != nil {
+			return
+		}
+	}
+}
+
+// RoundTrip responds to a raw DNS query received over UDP from the given source address
+// with a raw DNS response. This function fails if we cannot parse the query.
+func (h *Handler) RoundTrip(rawQuery []byte, source net.Addr) ([]byte, error) {
+	return h.roundTrip(rawQuery, source, 0)
+}
+
+// roundTrip is like RoundTrip but truncates the response to the given maximum size
+// when positive, or to the size the client can handle over UDP otherwise.
+func (h *Handler) roundTrip(rawQuery []byte, source net.Addr, maxSize int) ([]byte, error) {
+	query := &dns.Msg{}
+	if err := query.Unpack(rawQuery); err != nil {
+		return nil, err
+	}
+	resp := h.newResponse(query, handlerSourceIP(source))
+
+	// make sure the response fits into the size the client can handle
+	size := maxSize
+	if size <= 0 {
+		size = dns.MinMsgSize
+		if opt := query.IsEdns0(); opt != nil && int(opt.UDPSize()) > size {
+			size = int(opt.UDPSize())
+		}
+	}
+	resp.Truncate(size)
+
+	return resp.Pack()
+}
+
+// handlerSourceIP returns the IP address of the given source address.
+func handlerSourceIP(source net.Addr) string {
+	addr, _, err := net.SplitHostPort(source.String())
+	if err != nil {
+		return ""
+	}
+	return addr
+}
+
+// newResponse creates the response to the given query received from the given IP address.
+func (h *Handler) newResponse(query *dns.Msg, sourceIP string) *dns.Msg {
+	resp := &dns.Msg{}
+	resp.SetReply(query)
+	resp.Authoritative = true
+	resp.RecursionAvailable = false
+
+	// we only handle standard queries containing a single question
+	if query.Opcode != dns.OpcodeQuery || len(query.Question) != 1 {
+		resp.Rcode = dns.RcodeFormatError
+		return resp
+	}
+	q0 := query.Question[0]
+
+	// refuse to answer queries outside of our zone
+	if !dns.IsSubDomain(h.zone, strings.ToLower(q0.Name)) {
+		resp.Authoritative = false
+		resp.Rcode = dns.RcodeRefused
+		return resp
+	}
+
+	// log the query and compute what we should echo
+	opt := query.IsEdns0()
+	h.logQuery(sourceIP, q0, opt)
+
+	// fill the answer section
+	header := dns.RR_Header{
+		Name:   q0.Name,
+		Rrtype: q0.Qtype,
+		Class:  dns.ClassINET,
+		Ttl:    h.TTL,
+	}
+	switch q0.Qtype {
+	case dns.TypeA, dns.TypeAAAA:
+		for _, addr := range h.Addresses {
+			ip := net.ParseIP(addr)
+			switch {
+			case ip == nil:
+				continue
+			case q0.Qtype == dns.TypeA && ip.To4() != nil:
+				resp.Answer = append(resp.Answer, &dns.A{Hdr: header, A: ip.To4()})
+			case q0.Qtype == dns.TypeAAAA && ip.To4() == nil:
+				resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: header, AAAA: ip})
+			}
+		}
+	case dns.TypeTXT:
+		resp.Answer = append(resp.Answer, &dns.TXT{Hdr: header, Txt: handlerEchoTXT(sourceIP, opt)})
+	}
+
+	// echo EDNS support using the same payload size and DO bit
+	if opt != nil {
+		resp.SetEdns0(opt.UDPSize(), opt.Do())
+	}
+
+	return resp
+}
+
+// handlerEchoTXT returns the TXT strings echoing information about the query.
+func handlerEchoTXT(sourceIP string, opt *dns.OPT) []string {
+	out := []string{"resolver=" + sourceIP}
+	if opt == nil {
+		return out
+	}
+	out = append(out, fmt.Sprintf("edns_udp_size=%d", opt.UDPSize()))
+	out = append(out, fmt.Sprintf("edns_do=%v", opt.Do()))
+	var codes []string
+	for _, option := range opt.Option {
+		codes = append(codes, fmt.Sprintf("%d", option.Option()))
+	}
+	if len(codes) > 0 {
+		out = append(out, "edns_options="+strings.Join(codes, ","))
+	}
+	if subnet := handlerClientSubnet(opt); subnet != "" {
+		out = append(out, "edns_client_subnet="+subnet)
+	}
+	return out
+}
+
+// handlerClientSubnet returns the EDNS client subnet or an empty string.
+func handlerClientSubnet(opt *dns.OPT) string {
+	for _, option := range opt.Option {
+		if subnet, ok := option.(*dns.EDNS0_SUBNET); ok {
+			return fmt.Sprintf("%s/%d", subnet.Address.String(), subnet.SourceNetmask)
+		}
+	}
+	return ""
+}
+
+// logQuery logs the given query using the logger and the query log.
+func (h *Handler) logQuery(sourceIP string, q0 dns.Question, opt *dns.OPT) {
+	entry := &QueryLogEntry{
+		T:        h.timeNow().UTC(),
+		Resolver: sourceIP,
+		Name:     strings.ToLower(q0.Name),
+		Type:     dns.TypeToString[q0.Qtype],
+	}
+	if opt != nil {
+		entry.EDNSUDPSize = opt.UDPSize()
+		entry.EDNSDo = opt.Do()
+		entry.EDNSClientSubnet = handlerClientSubnet(opt)
+	}
+	h.logger.Debugf("oodnshelperd: %s %s from %s", entry.Type, entry.Name, entry.Resolver)
+
+	if h.QueryLog == nil {
+		return
+	}
+	data := runtimex.Try1(json.Marshal(entry))
+	data = append(data, '\n')
+
+	defer h.mu.Unlock()
+	h.mu.Lock()
+	if _, err := h.QueryLog.Write(data); err != nil {
+		h.logger.Warnf("oodnshelperd: cannot write query log: %s", err.Error())
+	}
+}
@@ -0,0 +1,257 @@
+package oodnshelperd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestHandlerRoundTrip(t *testing.T) {
+	source := &net.UDPAddr{IP: net.ParseIP("130.192.3.21"), Port: 54321}
+
+	// newHandler creates a new handler for testing.
+	newHandler := func() *Handler {
+		handler := NewHandler(model.DiscardLogger, "DNS.Example.ORG")
+		handler.Addresses = []string{"104.248.30.161", "2a03:b0c0:1:d0::1a4:1", "antani"}
+		return handler
+	}
+
+	// roundTrip sends the given query to the handler and parses the response.
+	roundTrip := func(t *testing.T, handler *Handler, query *dns.Msg) *dns.Msg {
+		rawResp, err := handler.RoundTrip(runtimex.Try1(query.Pack()), source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := &dns.Msg{}
+		if err := resp.Unpack(rawResp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Id != query.Id {
+			t.Fatal("unexpected ID")
+		}
+		return resp
+	}
+
+	// newQuery creates a new query.
+	newQuery := func(name string, qtype uint16) *dns.Msg {
+		query := &dns.Msg{}
+		query.SetQuestion(name, qtype)
+		return query
+	}
+
+	t.Run("we answer A queries for any name inside the zone", func(t *testing.T) {
+		resp := roundTrip(t, newHandler(), newQuery("xyzzy.dns.example.org.", dns.TypeA))
+		if resp.Rcode != dns.RcodeSuccess || !resp.Authoritative || len(resp.Answer) != 1 {
+			t.Fatal("unexpected response", resp)
+		}
+		if diff := cmp.Diff("104.248.30.161", resp.Answer[0].(*dns.A).A.String()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we answer AAAA queries using IPv6 addresses", func(t *testing.T) {
+		resp := roundTrip(t, newHandler(), newQuery("dns.example.org.", dns.TypeAAAA))
+		if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+			t.Fatal("unexpected response", resp)
+		}
+		if diff := cmp.Diff("2a03:b0c0:1:d0::1a4:1", resp.Answer[0].(*dns.AAAA).AAAA.String()); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we echo information about the query using TXT records", func(t *testing.T) {
+		query := newQuery("XyZzY.dns.example.org.", dns.TypeTXT)
+		query.SetEdns0(1232, true)
+		opt := query.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			Family:        1,
+			SourceNetmask: 24,
+			Address:       net.ParseIP("130.192.91.0").To4(),
+		})
+
+		resp := roundTrip(t, newHandler(), query)
+		if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 || resp.IsEdns0() == nil {
+			t.Fatal("unexpected response", resp)
+		}
+		expect := []string{
+			"resolver=130.192.3.21",
+			"edns_udp_size=1232",
+			"edns_do=true",
+			"edns_options=8",
+			"edns_client_subnet=130.192.91.0/24",
+		}
+		if diff := cmp.Diff(expect, resp.Answer[0].(*dns.TXT).Txt); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we answer other queries inside the zone with an empty answer", func(t *testing.T) {
+		resp := roundTrip(t, newHandler(), newQuery("dns.example.org.", dns.TypeMX))
+		if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 {
+			t.Fatal("unexpected response", resp)
+		}
+	})
+
+	t.Run("we refuse queries outside of the zone", func(t *testing.T) {
+		resp := roundTrip(t, newHandler(), newQuery("www.example.com.", dns.TypeA))
+		if resp.Rcode != dns.RcodeRefused || resp.Authoritative || len(resp.Answer) != 0 {
+			t.Fatal("unexpected response", resp)
+		}
+	})
+
+	t.Run("we reject queries with multiple questions", func(t *testing.T) {
+		query := newQuery("dns.example.org.", dns.TypeA)
+		query.Question = append(query.Question, query.Question[0])
+		resp := roundTrip(t, newHandler(), query)
+		if resp.Rcode != dns.RcodeFormatError {
+			t.Fatal("unexpected response", resp)
+		}
+	})
+
+	t.Run("we fail when we cannot parse the query", func(t *testing.T) {
+		rawResp, err := newHandler().RoundTrip([]byte{0x01}, source)
+		if err == nil || rawResp != nil {
+			t.Fatal("unexpected result", rawResp, err)
+		}
+	})
+
+	t.Run("we log the queries inside the zone", func(t *testing.T) {
+		handler := newHandler()
+		querylog := &bytes.Buffer{}
+		handler.QueryLog = querylog
+		handler.timeNow = func() time.Time {
+			return time.Date(2024, 2, 8, 9, 8, 7, 0, time.UTC)
+		}
+
+		query := newQuery("XyZzY.dns.example.org.", dns.TypeA)
+		query.SetEdns0(1232, false)
+		roundTrip(t, handler, query)
+		roundTrip(t, handler, newQuery("www.example.com.", dns.TypeA))
+
+		var entries []*QueryLogEntry
+		decoder := json.NewDecoder(querylog)
+		for decoder.More() {
+			var entry QueryLogEntry
+			if err := decoder.Decode(&entry); err != nil {
+				t.Fatal(err)
+			}
+			entries = append(entries, &entry)
+		}
+		expect := []*QueryLogEntry{{
+			T:           time.Date(2024, 2, 8, 9, 8, 7, 0, time.UTC),
+			Resolver:    "130.192.3.21",
+			Name:        "xyzzy.dns.example.org.",
+			Type:        "A",
+			EDNSUDPSize: 1232,
+		}}
+		if diff := cmp.Diff(expect, entries); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestHandlerServe(t *testing.T) {
+	pconn := runtimex.Try1(net.ListenPacket("udp", "127.0.0.1:0"))
+	handler := NewHandler(model.DiscardLogger, "dns.example.org")
+	handler.Addresses = []string{"104.248.30.161"}
+	done := make(chan error, 1)
+	go func() {
+		done <- handler.Serve(pconn)
+	}()
+
+	// send an unparseable query, which we should ignore, followed by a valid query
+	query := &dns.Msg{}
+	query.SetQuestion("xyzzy.dns.example.org.", dns.TypeA)
+	conn := runtimex.Try1(net.Dial("udp", pconn.LocalAddr().String()))
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	_ = runtimex.Try1(conn.Write([]byte{0x01}))
+	_ = runtimex.Try1(conn.Write(runtimex.Try1(query.Pack())))
+
+	buffer := make([]byte, dns.MaxMsgSize)
+	count, err := conn.Read(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &dns.Msg{}
+	if err := resp.Unpack(buffer[:count]); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Id != query.Id || len(resp.Answer) != 1 {
+		t.Fatal("unexpected response", resp)
+	}
+
+	// make sure Serve returns when we close the conn
+	pconn.Close()
+	if err := <-done; !errors.Is(err, net.ErrClosed) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+func TestHandlerServeTCP(t *testing.T) {
+	listener := runtimex.Try1(net.Listen("tcp", "127.0.0.1:0"))
+	handler := NewHandler(model.DiscardLogger, "dns.example.org")
+	handler.Addresses = []string{"104.248.30.161"}
+	done := make(chan error, 1)
+	go func() {
+		done <- handler.ServeTCP(listener)
+	}()
+
+	// prefix returns the raw message prefixed by its length
+	prefix := func(rawMsg []byte) []byte {
+		return append([]byte{byte(len(rawMsg) >> 8), byte(len(rawMsg))}, rawMsg...)
+	}
+
+	t.Run("we close the conn when we cannot parse the query", func(t *testing.T) {
+		conn := runtimex.Try1(net.Dial("tcp", listener.Addr().String()))
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+		_ = runtimex.Try1(conn.Write(prefix([]byte{0x01})))
+		if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("we answer multiple queries using the same conn", func(t *testing.T) {
+		conn := runtimex.Try1(net.Dial("tcp", listener.Addr().String()))
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+		for idx := 0; idx < 2; idx++ {
+			query := &dns.Msg{}
+			query.SetQuestion("xyzzy.dns.example.org.", dns.TypeA)
+			_ = runtimex.Try1(conn.Write(prefix(runtimex.Try1(query.Pack()))))
+
+			header := make([]byte, 2)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				t.Fatal(err)
+			}
+			buffer := make([]byte, int(header[0])<<8|int(header[1]))
+			if _, err := io.ReadFull(conn, buffer); err != nil {
+				t.Fatal(err)
+			}
+			resp := &dns.Msg{}
+			if err := resp.Unpack(buffer); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Id != query.Id || resp.Truncated || len(resp.Answer) != 1 {
+				t.Fatal("unexpected response", resp)
+			}
+		}
+	})
+
+	// make sure ServeTCP returns when we close the listener
+	listener.Close()
+	if err := <-done; !errors.Is(err, net.ErrClosed) {
+		t.Fatal("unexpected error", err)
+	}
+}
@@ -0,0 +1,261 @@
+package oohelperd
+
+//
+// Responses cache and requests coalescing
+//
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// handlerDefaultCacheTTL is the default [Handler] CacheTTL.
+const handlerDefaultCacheTTL = 5 * time.Minute
+
+// handlerDefaultCacheMaxEntries is the default [Handler] CacheMaxEntries.
+const handlerDefaultCacheMaxEntries = 4096
+
+// cacheKey returns the key identifying a request inside the cache. We normalize
+// the request such that requests differing only in the order of endpoints or
+// in the case of the header keys map to the same key.
+func cacheKey(creq *ctrlRequest) string {
+	// normalize the URL, which we already know to be parseable
+	// because the caller has already validated the request
+	target := creq.HTTPRequest
+	if URL, err := url.Parse(target); err == nil {
+		URL.Scheme = strings.ToLower(URL.Scheme)
+		URL.Host = strings.ToLower(URL.Host)
+		target = URL.String()
+	}
+
+	// normalize the endpoints by sorting and deduplicating them
+	endpoints := append([]string{}, creq.TCPConnect...)
+	sort.Strings(endpoints)
+	endpoints = cacheUniqueSorted(endpoints)
+
+	// normalize the headers by canonicalizing their keys
+	headers := map[string][]string{}
+	for key, values := range creq.HTTPRequestHeaders {
+		ckey := http.CanonicalHeaderKey(key)
+		headers[ckey] = append(headers[ckey], values...)
+	}
+
+	// note that json.Marshal emits map keys in sorted order
+	normalized := &model.THRequest{
+		HTTPRequest:        target,
+		HTTPRequestHeaders: headers,
+		TCPConnect:         endpoints,
+		XQUICEnabled:       creq.XQUICEnabled,
+		XTLSDetails:        creq.XTLSDetails,
+		XVantages:          creq.XVantages,
+	}
+	data := runtimex.Try1(json.Marshal(normalized))
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
+
+// cacheUniqueSorted removes duplicates from an already sorted slice.
+func cacheUniqueSorted(values []string) (out []string) {
+	for idx, value := range values {
+		if idx > 0 && values[idx-1] == value {
+			continue
+		}
+		out = append(out, value)
+	}
+	return
+}
+
+// cacheHasUncommonEndpoints returns true if the request contains endpoints
+// using ports other than the ones commonly used for HTTP and HTTPS. Such
+// requests are unlikely to be repeated and hence not worth caching.
+func cacheHasUncommonEndpoints(creq *ctrlRequest) bool {
+	for _, endpoint := range creq.TCPConnect {
+		_, port, err := net.SplitHostPort(endpoint)
+		if err != nil || (port != "80" && port != "443") {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheEntry is an entry inside the [responseCache].
+type cacheEntry struct {
+	// expiresAt is when the entry expires.
+	expiresAt time.Time
+
+	// key is the cache key.
+	key string
+
+	// resp is the cached response, which MUST NOT be modified.
+	resp *ctrlResponse
+}
+
+// cacheCall is a measurement in progress for a given key.
+type cacheCall struct {
+	// done is closed when the measurement is complete.
+	done chan any
+
+	// err is the measurement error.
+	err error
+
+	// resp is the measurement response.
+	resp *ctrlResponse
+}
+
+// responseCache is an LRU cache of responses with entries that expire after
+// a TTL, which also coalesces concurrent measurements of the same request.
+//
+// The zero value is invalid; construct using [newResponseCache].
+type responseCache struct {
+	// calls contains the measurements in progress.
+	calls map[string]*cacheCall
+
+	// entries maps a key to its element inside lru.
+	entries map[string]*list.Element
+
+	// lru contains the entries sorted from the most to the least recently used.
+	lru *list.List
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// timeNow is the MANDATORY function returning the current time.
+	timeNow func() time.Time
+}
+
+// newResponseCache creates a new [*responseCache].
+func newResponseCache() *responseCache {
+	return &responseCache{
+		calls:   map[string]*cacheCall{},
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		mu:      sync.Mutex{},
+		timeNow: time.Now,
+	}
+}
+
+// Do returns the cached response for the given key, if any. Otherwise, if there is
+// already a measurement in progress for the same key, Do waits for it to complete and
+// returns its result. Otherwise, Do calls fn in a background goroutine and caches its
+// successful result for the given ttl, evicting the least recently used entries to
+// stay below maxEntries. Because other requests may be waiting for the same result, fn
+// runs using a context that is not canceled when ctx is canceled and that expires after
+// the given timeout. In any case, Do returns early when ctx is canceled.
+//
+// Do counts the lookup using [metricCacheLookupsCount] as soon as it knows whether
+// it is a "hit", a "miss", or "coalesced" with a measurement in progress.
+//
+// The result is the [ctrlResponse], which MUST NOT be modified, and the
+// error that occurred, if any.
+func (c *responseCache) Do(ctx context.Context, key string, ttl time.Duration, maxEntries int,
+	timeout time.Duration, fn func(ctx context.Context) (*ctrlResponse, error)) (*ctrlResponse, error) {
+	c.mu.Lock()
+
+	// handle the case of a cache hit
+	if resp, found := c.getLocked(key); found {
+		c.mu.Unlock()
+		metricCacheLookupsCount.WithLabelValues("hit").Inc()
+		return resp, nil
+	}
+
+	// handle the case where we coalesce with a measurement in progress
+	if call, found := c.calls[key]; found {
+		c.mu.Unlock()
+		metricCacheLookupsCount.WithLabelValues("coalesced").Inc()
+		return c.wait(ctx, call)
+	}
+
+	// handle the case of a cache miss
+	call := &cacheCall{done: make(chan any)}
+	c.calls[key] = call
+	c.mu.Unlock()
+	metricCacheLookupsCount.WithLabelValues("miss").Inc()
+
+	go c.run(context.WithoutCancel(ctx), key, ttl, maxEntries, timeout, call, fn)
+	return c.wait(ctx, call)
+}
+
+// wait waits for the given call to complete or for the context to be done.
+func (c *responseCache) wait(ctx context.Context, call *cacheCall) (*ctrlResponse, error) {
+	select {
+	case <-call.done:
+		return call.resp, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run runs the measurement for the given call and caches its result.
+func (c *responseCache) run(ctx context.Context, key string, ttl time.Duration, maxEntries int,
+	timeout time.Duration, call *cacheCall, fn func(ctx context.Context) (*ctrlResponse, error)) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	call.resp, call.err = fn(ctx)
+
+	// avoid caching a response produced after the timeout has expired
+	// since the measurement is likely to be full of canceled operations
+	c.mu.Lock()
+	delete(c.calls, key)
+	if call.err == nil && ctx.Err() == nil {
+		c.putLocked(key, call.resp, ttl, maxEntries)
+	}
+	c.mu.Unlock()
+
+	close(call.done)
+}
+
+// getLocked returns the non-expired entry for the given key, if any. This
+// method MUST be called while holding the mutex.
+func (c *responseCache) getLocked(key string) (*ctrlResponse, bool) {
+	elem, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !c.timeNow().Before(entry.expiresAt) {
+		c.removeLocked(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.resp, true
+}
+
+// putLocked adds the given entry to the cache. This method MUST be
+// called while holding the mutex.
+func (c *responseCache) putLocked(key string, resp *ctrlResponse, ttl time.Duration, maxEntries int) {
+	if elem, found := c.entries[key]; found {
+		c.removeLocked(elem)
+	}
+	entry := &cacheEntry{
+		expiresAt: c.timeNow().Add(ttl),
+		key:       key,
+		resp:      resp,
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > maxEntries {
+		c.removeLocked(c.lru.Back())
+	}
+	metricCacheEntries.Set(float64(c.lru.Len()))
+}
+
+// removeLocked removes the given element from the cache. This method
+// MUST be called while holding the mutex.
+func (c *responseCache) removeLocked(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	metricCacheEntries.Set(float64(c.lru.Len()))
+}
@@ -0,0 +1,376 @@
+package oohelperd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCacheKey(t *testing.T) {
+	base := &ctrlRequest{
+		HTTPRequest: "https://www.example.com/",
+		HTTPRequestHeaders: map[string][]string{
+			"Accept": {"*/*"},
+		},
+		TCPConnect: []string{"93.184.216.34:443", "93.184.216.34:80"},
+	}
+
+	t.Run("equivalent requests map to the same key", func(t *testing.T) {
+		equivalent := &ctrlRequest{
+			HTTPRequest: "HTTPS://WWW.EXAMPLE.COM/",
+			HTTPRequestHeaders: map[string][]string{
+				"accept": {"*/*"},
+			},
+			TCPConnect: []string{"93.184.216.34:80", "93.184.216.34:443", "93.184.216.34:80"},
+		}
+		if cacheKey(base) != cacheKey(equivalent) {
+			t.Fatal("expected the same key")
+		}
+	})
+
+	t.Run("different requests map to different keys", func(t *testing.T) {
+		differentPath := *base
+		differentPath.HTTPRequest = "https://www.example.com/robots.txt"
+		differentEndpoints := *base
+		differentEndpoints.TCPConnect = []string{"93.184.216.34:443"}
+		differentHeaders := *base
+		differentHeaders.HTTPRequestHeaders = map[string][]string{"Accept": {"text/html"}}
+		differentFlags := *base
+		differentFlags.XTLSDetails = true
+		differentVantages := *base
+		differentVantages.XVantages = true
+		for _, creq := range []*ctrlRequest{&differentPath, &differentEndpoints, &differentHeaders, &differentFlags, &differentVantages} {
+			if cacheKey(base) == cacheKey(creq) {
+				t.Fatal("expected a different key for", creq)
+			}
+		}
+	})
+}
+
+func TestCacheHasUncommonEndpoints(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints []string
+		want      bool
+	}{{
+		name:      "with no endpoints",
+		endpoints: nil,
+		want:      false,
+	}, {
+		name:      "with common endpoints",
+		endpoints: []string{"93.184.216.34:443", "[2606:2800:220:1:248:1893:25c8:1946]:80"},
+		want:      false,
+	}, {
+		name:      "with an uncommon port",
+		endpoints: []string{"93.184.216.34:443", "93.184.216.34:8080"},
+		want:      true,
+	}, {
+		name:      "with an invalid endpoint",
+		endpoints: []string{"93.184.216.34"},
+		want:      true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheHasUncommonEndpoints(&ctrlRequest{TCPConnect: tt.endpoints}); got != tt.want {
+				t.Fatal("expected", tt.want, "got", got)
+			}
+		})
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	// newMeasure returns a function to pass to Do that counts its invocations.
+	newMeasure := func(count *atomic.Int64, err error) func(ctx context.Context) (*ctrlResponse, error) {
+		return func(ctx context.Context) (*ctrlResponse, error) {
+			count.Add(1)
+			if err != nil {
+				return nil, err
+			}
+			return &ctrlResponse{}, nil
+		}
+	}
+
+	t.Run("we reuse responses until they expire", func(t *testing.T) {
+		now := time.Now()
+		cache := newResponseCache()
+		cache.timeNow = func() time.Time {
+			return now
+		}
+		ctx := context.Background()
+		count := &atomic.Int64{}
+
+		for _, expect := range []string{"miss", "hit"} {
+			before := cacheLookupsForTesting(expect)
+			if _, err := cache.Do(ctx, "a", time.Minute, 10, time.Minute, newMeasure(count, nil)); err != nil {
+				t.Fatal(err)
+			}
+			if cacheLookupsForTesting(expect) != before+1 {
+				t.Fatal("expected a cache", expect)
+			}
+		}
+
+		now = now.Add(time.Minute)
+		before := cacheLookupsForTesting("miss")
+		cache.Do(ctx, "a", time.Minute, 10, time.Minute, newMeasure(count, nil))
+		if cacheLookupsForTesting("miss") != before+1 {
+			t.Fatal("expected the entry to be expired")
+		}
+		if count.Load() != 2 {
+			t.Fatal("unexpected number of measurements", count.Load())
+		}
+	})
+
+	t.Run("we evict the least recently used entries", func(t *testing.T) {
+		cache := newResponseCache()
+		ctx := context.Background()
+		count := &atomic.Int64{}
+
+		cache.Do(ctx, "a", time.Minute, 2, time.Minute, newMeasure(count, nil))
+		cache.Do(ctx, "b", time.Minute, 2, time.Minute, newMeasure(count, nil))
+		cache.Do(ctx, "a", time.Minute, 2, time.Minute, newMeasure(count, nil)) // now "b" is the least recently used
+		cache.Do(ctx, "c", time.Minute, 2, time.Minute, newMeasure(count, nil))
+
+		if _, found := cache.entries["b"]; found {
+			t.Fatal("expected b to be evicted")
+		}
+		if len(cache.entries) != 2 || cache.lru.Len() != 2 {
+			t.Fatal("unexpected number of entries")
+		}
+	})
+
+	t.Run("we do not cache failed measurements", func(t *testing.T) {
+		cache := newResponseCache()
+		ctx := context.Background()
+		count := &atomic.Int64{}
+		expected := errors.New("mocked error")
+
+		for idx := 0; idx < 2; idx++ {
+			if _, err := cache.Do(ctx, "a", time.Minute, 10, time.Minute, newMeasure(count, expected)); !errors.Is(err, expected) {
+				t.Fatal("unexpected error", err)
+			}
+		}
+		if count.Load() != 2 {
+			t.Fatal("unexpected number of measurements", count.Load())
+		}
+	})
+
+	t.Run("we do not cache measurements that hit the timeout", func(t *testing.T) {
+		cache := newResponseCache()
+		ctx := context.Background()
+
+		resp, err := cache.Do(ctx, "a", time.Minute, 10, time.Millisecond,
+			func(ctx context.Context) (*ctrlResponse, error) {
+				<-ctx.Done()
+				return &ctrlResponse{}, nil
+			})
+		if err != nil || resp == nil {
+			t.Fatal("unexpected result", resp, err)
+		}
+		if len(cache.entries) != 0 {
+			t.Fatal("expected no entries")
+		}
+	})
+
+	t.Run("the measurement continues when the leader goes away", func(t *testing.T) {
+		cache := newResponseCache()
+		count := &atomic.Int64{}
+		started, unblock := make(chan any), make(chan any)
+
+		// start a measurement that blocks until we unblock it
+		leaderCtx, leaderCancel := context.WithCancel(context.Background())
+		leader := make(chan error, 1)
+		go func() {
+			_, err := cache.Do(leaderCtx, "a", time.Minute, 10, time.Minute,
+				func(ctx context.Context) (*ctrlResponse, error) {
+					close(started)
+					<-unblock
+					if err := ctx.Err(); err != nil {
+						return nil, err
+					}
+					return newMeasure(count, nil)(ctx)
+				})
+			leader <- err
+		}()
+		<-started
+
+		// start a waiter for the same key
+		coalesced := cacheLookupsForTesting("coalesced")
+		waiter := make(chan error, 1)
+		go func() {
+			resp, err := cache.Do(context.Background(), "a", time.Minute, 10, time.Minute, nil)
+			if err == nil && resp == nil {
+				err = errors.New("unexpected waiter result")
+			}
+			waiter <- err
+		}()
+		for cacheLookupsForTesting("coalesced") != coalesced+1 {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		// the leader goes away while the waiter is pending
+		leaderCancel()
+		if err := <-leader; !errors.Is(err, context.Canceled) {
+			t.Fatal("unexpected leader error", err)
+		}
+		close(unblock)
+
+		if err := <-waiter; err != nil {
+			t.Fatal(err)
+		}
+		hits := cacheLookupsForTesting("hit")
+		if _, err := cache.Do(context.Background(), "a", time.Minute, 10, time.Minute, nil); err != nil {
+			t.Fatal(err)
+		}
+		if cacheLookupsForTesting("hit") != hits+1 {
+			t.Fatal("expected the response to be cached")
+		}
+		if count.Load() != 1 {
+			t.Fatal("unexpected number of measurements", count.Load())
+		}
+	})
+
+	t.Run("we coalesce concurrent measurements", func(t *testing.T) {
+		cache := newResponseCache()
+		ctx := context.Background()
+		count := &atomic.Int64{}
+		started, unblock := make(chan any), make(chan any)
+		misses, coalesced := cacheLookupsForTesting("miss"), cacheLookupsForTesting("coalesced")
+
+		// start a measurement that blocks until we unblock it
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.Do(ctx, "a", time.Minute, 10, time.Minute, func(ctx context.Context) (*ctrlResponse, error) {
+				close(started)
+				<-unblock
+				return newMeasure(count, nil)(ctx)
+			})
+		}()
+		<-started
+
+		// start concurrent measurements for the same key
+		const followers = 4
+		for idx := 0; idx < followers; idx++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cache.Do(ctx, "a", time.Minute, 10, time.Minute, newMeasure(count, nil))
+			}()
+		}
+
+		// wait for all the followers to be waiting on the leader
+		for cacheLookupsForTesting("coalesced") != coalesced+followers {
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(unblock)
+		wg.Wait()
+
+		if cacheLookupsForTesting("miss") != misses+1 {
+			t.Fatal("expected a single cache miss")
+		}
+		if count.Load() != 1 {
+			t.Fatal("unexpected number of measurements", count.Load())
+		}
+	})
+
+	t.Run("waiting for a measurement in progress honours the context", func(t *testing.T) {
+		cache := newResponseCache()
+		started, unblock := make(chan any), make(chan any)
+		defer close(unblock)
+		go cache.Do(context.Background(), "a", time.Minute, 10, time.Minute, func(ctx context.Context) (*ctrlResponse, error) {
+			close(started)
+			<-unblock
+			return &ctrlResponse{}, nil
+		})
+		<-started
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := cache.Do(ctx, "a", time.Minute, 10, time.Minute, nil); !errors.Is(err, context.Canceled) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
+
+func TestHandlerMeasureMaybeCached(t *testing.T) {
+	// newHandler returns a handler whose measure function counts its invocations.
+	newHandler := func(count *atomic.Int64) *Handler {
+		handler := NewHandler(model.DiscardLogger, nil)
+		handler.measure = func(ctx context.Context, config *Handler, creq *ctrlRequest) (*ctrlResponse, error) {
+			count.Add(1)
+			return &ctrlResponse{}, nil
+		}
+		return handler
+	}
+
+	tests := []struct {
+		name      string
+		configure func(handler *Handler)
+		endpoints []string
+		want      int64
+	}{{
+		name:      "with the default settings and common endpoints",
+		configure: func(handler *Handler) {},
+		endpoints: []string{"93.184.216.34:443"},
+		want:      1,
+	}, {
+		name:      "with the default settings and uncommon endpoints",
+		configure: func(handler *Handler) {},
+		endpoints: []string{"93.184.216.34:8443"},
+		want:      2,
+	}, {
+		name: "when caching uncommon endpoints",
+		configure: func(handler *Handler) {
+			handler.CacheBypassUncommonEndpoints = false
+		},
+		endpoints: []string{"93.184.216.34:8443"},
+		want:      1,
+	}, {
+		name: "with caching disabled via CacheTTL",
+		configure: func(handler *Handler) {
+			handler.CacheTTL = 0
+		},
+		endpoints: []string{"93.184.216.34:443"},
+		want:      2,
+	}, {
+		name: "with caching disabled via CacheMaxEntries",
+		configure: func(handler *Handler) {
+			handler.CacheMaxEntries = 0
+		},
+		endpoints: []string{"93.184.216.34:443"},
+		want:      2,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count := &atomic.Int64{}
+			handler := newHandler(count)
+			tt.configure(handler)
+			creq := &ctrlRequest{
+				HTTPRequest: "https://www.example.com/",
+				TCPConnect:  tt.endpoints,
+			}
+			for idx := 0; idx < 2; idx++ {
+				if _, err := handler.measureMaybeCached(context.Background(), creq); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if count.Load() != tt.want {
+				t.Fatal("expected", tt.want, "measurements, got", count.Load())
+			}
+		})
+	}
+}
+
+// cacheLookupsForTesting returns the value of [metricCacheLookupsCount] for the given result.
+func cacheLookupsForTesting(result string) float64 {
+	return testutil.ToFloat64(metricCacheLookupsCount.WithLabelValues(result))
+}
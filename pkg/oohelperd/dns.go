@@ -122,3 +122,45 @@ func dnsMapFailure(failure *string) *string {
 		}
 	}
 }
+
+// dnsECHConfig contains configuration for the [dnsECHDo] function.
+type dnsECHConfig struct {
+	// Domain is the MANDATORY domain to resolve.
+	Domain string
+
+	// Logger is the MANDATORY logger to use.
+	Logger model.Logger
+
+	// NewResolver is the MANDATORY factory to create a new resolver.
+	NewResolver func(model.Logger) model.Resolver
+
+	// Out is the MANDATORY channel where we publish whether the
+	// domain's HTTPS record contains an ECH config.
+	Out chan bool
+
+	// Wg is MANDATORY and allows [dnsECHDo] to synchronize with the caller.
+	Wg *sync.WaitGroup
+}
+
+// dnsECHDo checks whether the domain's HTTPS record offers ECH.
+func dnsECHDo(ctx context.Context, config *dnsECHConfig) {
+	// make sure this micro-measurement is bounded in time
+	const timeout = 4 * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// make sure the caller knows when we're done
+	defer config.Wg.Done()
+
+	// create a temporary resolver for this micro-measurement
+	reso := config.NewResolver(config.Logger)
+	defer reso.CloseIdleConnections()
+
+	// perform and log the actual DNS lookup
+	ol := logx.NewOperationLogger(config.Logger, "DNSLookupHTTPS %s", config.Domain)
+	https, err := reso.LookupHTTPS(ctx, config.Domain)
+	ol.Stop(err)
+
+	// a failure just means that ECH is not offered via the DNS
+	config.Out <- err == nil && len(https.ECHConfig) > 0
+}
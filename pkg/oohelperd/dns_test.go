@@ -200,3 +200,54 @@ func TestDNSDo(t *testing.T) {
 		})
 	}
 }
+
+func TestDNSECHDo(t *testing.T) {
+	tests := []struct {
+		name   string
+		https  *model.HTTPSSvc
+		err    error
+		expect bool
+	}{{
+		name:   "when the lookup fails",
+		https:  nil,
+		err:    errors.New(netxlite.DNSNoAnswerSuffix),
+		expect: false,
+	}, {
+		name:   "when the HTTPS record does not contain an ECH config",
+		https:  &model.HTTPSSvc{ALPN: []string{"h2"}},
+		err:    nil,
+		expect: false,
+	}, {
+		name:   "when the HTTPS record contains an ECH config",
+		https:  &model.HTTPSSvc{ALPN: []string{"h2"}, ECHConfig: []byte{0x00, 0x01}},
+		err:    nil,
+		expect: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &dnsECHConfig{
+				Domain: "www.example.com",
+				Logger: model.DiscardLogger,
+				NewResolver: func(model.Logger) model.Resolver {
+					return &mocks.Resolver{
+						MockLookupHTTPS: func(ctx context.Context, domain string) (*model.HTTPSSvc, error) {
+							return tt.https, tt.err
+						},
+						MockCloseIdleConnections: func() {
+							// nothing
+						},
+					}
+				},
+				Out: make(chan bool, 1),
+				Wg:  &sync.WaitGroup{},
+			}
+			config.Wg.Add(1)
+			dnsECHDo(context.Background(), config)
+			config.Wg.Wait()
+			if got := <-config.Out; got != tt.expect {
+				t.Fatal("expected", tt.expect, "got", got)
+			}
+		})
+	}
+}
@@ -7,10 +7,12 @@ package oohelperd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
 	"os"
 	"strings"
 	"sync/atomic"
@@ -23,6 +25,12 @@ import (
 	"golang.org/x/net/publicsuffix"
 )
 
+// handlerMeasureTimeout is the maximum time for which we run a measurement that
+// other requests are waiting for, which we do not cancel when the client that
+// started it goes away. In practice, measurements complete way earlier, because
+// each operation they perform has its own timeout.
+const handlerMeasureTimeout = 60 * time.Second
+
 // maxAcceptableBodySize is the maximum acceptable body size for incoming
 // API requests as well as when we're measuring webpages.
 const maxAcceptableBodySize = 1 << 24
@@ -32,12 +40,52 @@ const maxAcceptableBodySize = 1 << 24
 //
 // The zero value is invalid; construct using [NewHandler].
 type Handler struct {
+	// CacheBypassUncommonEndpoints OPTIONALLY avoids caching the responses to
+	// requests including endpoints using ports other than 80 and 443.
+	CacheBypassUncommonEndpoints bool
+
+	// CacheMaxEntries is the OPTIONAL maximum number of cached responses. A
+	// zero or negative value disables caching and requests coalescing.
+	CacheMaxEntries int
+
+	// CacheTTL is the OPTIONAL time for which we cache a response. A zero
+	// or negative value disables caching and requests coalescing.
+	CacheTTL time.Duration
+
 	// EnableQUIC OPTIONALLY enables QUIC.
 	EnableQUIC bool
 
+	// RateLimitClientASN is the OPTIONAL rate limiting policy for each client ASN. By
+	// default, we do not rate limit. When running behind a reverse proxy, you also
+	// need to set RateLimitClientIPHeader, otherwise all the clients share the
+	// IP address and the ASN of the reverse proxy.
+	RateLimitClientASN RateLimitPolicy
+
+	// RateLimitClientIP is the OPTIONAL rate limiting policy for each client IP
+	// address. By default, we do not rate limit. The same considerations made for
+	// RateLimitClientASN regarding RateLimitClientIPHeader apply.
+	RateLimitClientIP RateLimitPolicy
+
+	// RateLimitClientIPHeader is the OPTIONAL header containing the client IP
+	// address (e.g., X-Forwarded-For) to use when running behind a reverse proxy.
+	RateLimitClientIPHeader string
+
+	// RateLimitDomain is the OPTIONAL rate limiting policy for measuring each domain,
+	// which only applies to requests we cannot serve from the cache. By default, we
+	// do not rate limit, since many clients legitimately measure popular domains.
+	RateLimitDomain RateLimitPolicy
+
+	// Vantages contains the OPTIONAL additional vantage points from which we measure
+	// DNS and HTTP for the requests that set the XVantages flag. Each vantage point
+	// MUST have a unique name.
+	Vantages []*VantagePoint
+
 	// baseLogger is the MANDATORY logger to use.
 	baseLogger model.Logger
 
+	// cache is the MANDATORY responses cache.
+	cache *responseCache
+
 	// countRequests is the MANDATORY count of the number of
 	// requests that are currently in flight.
 	countRequests *atomic.Int64
@@ -69,6 +117,15 @@ type Handler struct {
 
 	// newTLSHandshaker is the MANDATORY factory for creating a new TLS handshaker.
 	newTLSHandshaker func(model.Logger) model.TLSHandshaker
+
+	// newVantageHTTPClient is the MANDATORY factory to create a new HTTPClient for a vantage point.
+	newVantageHTTPClient func(model.Logger, *VantagePoint) model.HTTPClient
+
+	// newVantageResolver is the MANDATORY factory to create a new resolver for a vantage point.
+	newVantageResolver func(model.Logger, *VantagePoint) model.Resolver
+
+	// rateLimiter is the MANDATORY rate limiter.
+	rateLimiter *rateLimiter
 }
 
 var _ http.Handler = &Handler{}
@@ -79,12 +136,21 @@ var enableQUIC = (os.Getenv("OOHELPERD_ENABLE_QUIC") == "1")
 // NewHandler constructs the [handler].
 func NewHandler(logger model.Logger, netx *netxlite.Netx) *Handler {
 	return &Handler{
-		EnableQUIC:        enableQUIC,
-		baseLogger:        logger,
-		countRequests:     &atomic.Int64{},
-		indexer:           &atomic.Int64{},
-		maxAcceptableBody: maxAcceptableBodySize,
-		measure:           measure,
+		CacheBypassUncommonEndpoints: true,
+		CacheMaxEntries:              handlerDefaultCacheMaxEntries,
+		CacheTTL:                     handlerDefaultCacheTTL,
+		EnableQUIC:                   enableQUIC,
+		RateLimitClientASN:           RateLimitPolicy{},
+		RateLimitClientIP:            RateLimitPolicy{},
+		RateLimitClientIPHeader:      "",
+		RateLimitDomain:              RateLimitPolicy{},
+		baseLogger:                   logger,
+		cache:                        newResponseCache(),
+		countRequests:                &atomic.Int64{},
+		indexer:                      &atomic.Int64{},
+		maxAcceptableBody:            maxAcceptableBodySize,
+		measure:                      measure,
+		rateLimiter:                  newRateLimiter(),
 
 		newHTTPClient: func(logger model.Logger) model.HTTPClient {
 			// TODO(https://github.com/ooni/probe/issues/2534): the NewHTTPTransportWithResolver has QUIRKS and
@@ -120,6 +186,14 @@ func NewHandler(logger model.Logger, netx *netxlite.Netx) *Handler {
 		newTLSHandshaker: func(logger model.Logger) model.TLSHandshaker {
 			return netx.NewTLSHandshakerStdlib(logger)
 		},
+
+		newVantageHTTPClient: func(logger model.Logger, vp *VantagePoint) model.HTTPClient {
+			return newVantageHTTPClient(netx, logger, vp)
+		},
+
+		newVantageResolver: func(logger model.Logger, vp *VantagePoint) model.Resolver {
+			return newVantageResolver(netx, logger, vp)
+		},
 	}
 }
 
@@ -185,6 +259,13 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	h.countRequests.Add(1)
 	defer h.countRequests.Add(-1)
 
+	// protect against clients sending too many requests
+	var rle *rateLimitError
+	if err := h.rateLimitClient(req); errors.As(err, &rle) {
+		handlerWriteRateLimited(w, rle)
+		return
+	}
+
 	// read and parse request body
 	reader := io.LimitReader(req.Body, h.maxAcceptableBody)
 	data, err := netxlite.ReadAllContext(req.Context(), reader)
@@ -200,13 +281,22 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// measure the given input
-	started := time.Now()
-	cresp, err := h.measure(req.Context(), h, &creq)
-	elapsed := time.Since(started)
+	// protect against clients using us to reach our own host or network
+	if URL, err := url.Parse(creq.HTTPRequest); err == nil && handlerIsForbiddenTarget(URL.Hostname()) {
+		metricRequestsCount.WithLabelValues("403", "forbidden_target").Inc()
+		metricRequestsRejectedCount.WithLabelValues("forbidden_target").Inc()
+		handlerWriteRejected(w, 403, &handlerRejectedResponse{Error: "forbidden_target"})
+		return
+	}
 
-	// track the time required to produce a response
-	metricWCTaskDurationSeconds.Observe(elapsed.Seconds())
+	// measure the given input or reuse a recent measurement
+	cresp, err := h.measureMaybeCached(req.Context(), &creq)
+
+	// handle the case where we've measured the domain too many times
+	if errors.As(err, &rle) {
+		handlerWriteRateLimited(w, rle)
+		return
+	}
 
 	// handle the case of fundamental failure
 	if err != nil {
@@ -226,6 +316,36 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	_, _ = w.Write(data)
 }
 
+// measureMaybeCached measures the given input unless the cache contains a response
+// for an equivalent request or there is an equivalent measurement in progress.
+func (h *Handler) measureMaybeCached(ctx context.Context, creq *ctrlRequest) (*ctrlResponse, error) {
+	measure := func(ctx context.Context) (*ctrlResponse, error) {
+		// make sure we're not measuring the same domain too frequently
+		if URL, err := url.Parse(creq.HTTPRequest); err == nil {
+			if err := h.rateLimitDomain(URL.Hostname()); err != nil {
+				return nil, err
+			}
+		}
+
+		started := time.Now()
+		cresp, err := h.measure(ctx, h, creq)
+		elapsed := time.Since(started)
+
+		// track the time required to produce a response
+		metricWCTaskDurationSeconds.Observe(elapsed.Seconds())
+		return cresp, err
+	}
+
+	// handle the case where we should not use the cache
+	if h.CacheTTL <= 0 || h.CacheMaxEntries <= 0 ||
+		(h.CacheBypassUncommonEndpoints && cacheHasUncommonEndpoints(creq)) {
+		metricCacheLookupsCount.WithLabelValues("bypass").Inc()
+		return measure(ctx)
+	}
+
+	return h.cache.Do(ctx, cacheKey(creq), h.CacheTTL, h.CacheMaxEntries, handlerMeasureTimeout, measure)
+}
+
 // newResolver creates a new [model.Resolver] suitable for serving
 // requests coming from ooniprobe clients.
 func newResolver(logger model.Logger, netx *netxlite.Netx) model.Resolver {
@@ -236,6 +356,18 @@ func newResolver(logger model.Logger, netx *netxlite.Netx) model.Resolver {
 	return resolver
 }
 
+// handlerCheckRedirect is like the default [http.Client] redirect policy, which stops
+// after 10 redirects, but also refuses to follow redirects to forbidden targets.
+func handlerCheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if handlerIsForbiddenTarget(req.URL.Hostname()) {
+		return errForbiddenTarget
+	}
+	return nil
+}
+
 // newCookieJar is the factory for constructing a new cookier jar.
 func newCookieJar() *cookiejar.Jar {
 	// Implementation note: the [cookiejar.New] function always returns a
@@ -275,7 +407,7 @@ func newHTTPClientWithTransportFactory(
 	// context and pointers to the relevant measurements.
 	client := &http.Client{
 		Transport:     txpFactory(netx, logger, reso),
-		CheckRedirect: nil,
+		CheckRedirect: handlerCheckRedirect,
 		Jar:           newCookieJar(),
 		Timeout:       0,
 	}
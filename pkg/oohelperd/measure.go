@@ -40,6 +40,27 @@ func measure(ctx context.Context, config *Handler, creq *ctrlRequest) (*ctrlResp
 	}
 	wg := &sync.WaitGroup{}
 
+	// vantages: start measuring from the additional vantage points, which
+	// are independent of the other measurements and run in parallel
+	vantagewg := &sync.WaitGroup{}
+	vantagech := make(chan model.THVantageResult, len(config.Vantages))
+	if creq.XVantages {
+		for _, vp := range config.Vantages {
+			vantagewg.Add(1)
+			go vantageDo(ctx, &vantageConfig{
+				Headers:           creq.HTTPRequestHeaders,
+				Logger:            logger,
+				MaxAcceptableBody: config.maxAcceptableBody,
+				NewClient:         config.newVantageHTTPClient,
+				NewResolver:       config.newVantageResolver,
+				Out:               vantagech,
+				URL:               URL,
+				VantagePoint:      vp,
+				Wg:                vantagewg,
+			})
+		}
+	}
+
 	// dns: start
 	dnsch := make(chan ctrlDNSResult, 1)
 	if net.ParseIP(URL.Hostname()) == nil {
@@ -53,9 +74,30 @@ func measure(ctx context.Context, config *Handler, creq *ctrlRequest) (*ctrlResp
 		})
 	}
 
+	// ech: start
+	echch := make(chan bool, 1)
+	if creq.XTLSDetails && net.ParseIP(URL.Hostname()) == nil {
+		wg.Add(1)
+		go dnsECHDo(ctx, &dnsECHConfig{
+			Domain:      URL.Hostname(),
+			Logger:      logger,
+			NewResolver: config.newResolver,
+			Out:         echch,
+			Wg:          wg,
+		})
+	}
+
 	// wait for DNS measurements to complete
 	wg.Wait()
 
+	// figure out whether the DNS offers ECH for the domain
+	var echOffered bool
+	select {
+	case echOffered = <-echch:
+	default:
+		// not measured
+	}
+
 	// start assembling the response
 	cresp := &ctrlResponse{
 		TCPConnect:    map[string]model.THTCPConnectResult{},
@@ -89,6 +131,7 @@ func measure(ctx context.Context, config *Handler, creq *ctrlRequest) (*ctrlResp
 		go tcpTLSDo(ctx, &tcpTLSConfig{
 			Address:          endpoint.Addr,
 			EnableTLS:        endpoint.TLS,
+			EnableTLSDetails: creq.XTLSDetails,
 			Endpoint:         endpoint.Epnt,
 			Logger:           logger,
 			NewDialer:        config.newDialer,
@@ -166,6 +209,7 @@ Loop:
 		case tcpconn := <-tcpconnch:
 			cresp.TCPConnect[tcpconn.Endpoint] = tcpconn.TCP
 			if tcpconn.TLS != nil {
+				tcpconn.TLS.ECHConfigOffered = echOffered
 				cresp.TLSHandshake[tcpconn.Endpoint] = *tcpconn.TLS
 				if info := cresp.IPInfo[tcpconn.Address]; info != nil && tcpconn.TLS.Failure == nil {
 					info.Flags |= model.THIPInfoFlagValidForDomain
@@ -178,5 +222,18 @@ Loop:
 		}
 	}
 
+	// wait for the vantage points and sort their results like the configuration
+	vantagewg.Wait()
+	close(vantagech)
+	results := map[string]model.THVantageResult{}
+	for result := range vantagech {
+		results[result.Name] = result
+	}
+	for _, vp := range config.Vantages {
+		if result, found := results[vp.Name]; found {
+			cresp.Vantages = append(cresp.Vantages, result)
+		}
+	}
+
 	return cresp, nil
 }
@@ -39,6 +39,26 @@ var (
 		Help: "The number or requests currently inflight",
 	})
 
+	// metricRequestsRejectedCount counts the requests we rejected by reason, which is
+	// either a rate limiting scope or "forbidden_target".
+	metricRequestsRejectedCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "oohelperd_requests_rejected_count",
+		Help: "Total number of requests rejected because of rate limiting or abuse protection",
+	}, []string{"reason"})
+
+	// metricCacheLookupsCount counts the cache lookups by result, which is one of
+	// "hit", "miss", "coalesced", and "bypass".
+	metricCacheLookupsCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "oohelperd_cache_lookups_count",
+		Help: "Total number of responses cache lookups",
+	}, []string{"result"})
+
+	// metricCacheEntries gauges the number of entries inside the responses cache.
+	metricCacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "oohelperd_cache_entries_gauge",
+		Help: "The number of entries inside the responses cache",
+	})
+
 	// metricWCTaskDurationSeconds summarizes the duration of the web connectivity measurement task.
 	metricWCTaskDurationSeconds = promauto.NewSummary(prometheus.SummaryOpts{
 		Name:       "oohelperd_wctask_duration_seconds",
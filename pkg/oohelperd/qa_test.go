@@ -3,8 +3,10 @@ package oohelperd_test
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 
 	"github.com/apex/log"
@@ -135,3 +137,139 @@ func TestQAEnableDisableQUIC(t *testing.T) {
 		})
 	}
 }
+
+// TestQATLSDetails ensures that we only include TLS details when requested.
+func TestQATLSDetails(t *testing.T) {
+	for _, xTLSDetails := range []bool{false, true} {
+		t.Run(fmt.Sprintf("with XTLSDetails=%v", xTLSDetails), func(t *testing.T) {
+			// create a new testing scenario
+			env := netemx.MustNewScenario(netemx.InternetScenario)
+			defer env.Close()
+
+			// create a new handler
+			handler := oohelperd.NewHandler(
+				log.Log,
+				&netxlite.Netx{Underlying: &netxlite.NetemUnderlyingNetworkAdapter{UNet: env.ClientStack}},
+			)
+
+			// create request body
+			reqbody := &model.THRequest{
+				HTTPRequest: "https://www.example.com/",
+				HTTPRequestHeaders: map[string][]string{
+					"Accept-Language": {model.HTTPHeaderAcceptLanguage},
+					"Accept":          {model.HTTPHeaderAccept},
+					"User-Agent":      {model.HTTPHeaderUserAgent},
+				},
+				TCPConnect:  []string{netemx.AddressWwwExampleCom},
+				XTLSDetails: xTLSDetails,
+			}
+
+			// create request
+			req := runtimex.Try1(http.NewRequest(
+				"POST",
+				"http://127.0.0.1:8080/",
+				bytes.NewReader(must.MarshalJSON(reqbody)),
+			))
+
+			// invoke the handler and get the response
+			resprec := httptest.NewRecorder()
+			handler.ServeHTTP(resprec, req)
+			resp := resprec.Result()
+			defer resp.Body.Close()
+			if resp.StatusCode != 200 {
+				t.Fatal("expected 200 Ok")
+			}
+
+			// read and parse the response body
+			respbody := runtimex.Try1(netxlite.ReadAllContext(context.Background(), resp.Body))
+			var jsonresp model.THResponse
+			must.UnmarshalJSON(respbody, &jsonresp)
+
+			// make sure the TLS details are there only when requested
+			result, found := jsonresp.TLSHandshake[netemx.AddressWwwExampleCom+":443"]
+			if !found || result.Failure != nil {
+				t.Fatal("expected a successful TLS handshake", result)
+			}
+			hasDetails := result.LeafCertificateFingerprint != "" &&
+				result.LeafCertificateIssuer != "" &&
+				slices.Contains(result.LeafCertificateSANs, "www.example.com") &&
+				result.TLSVersion != ""
+			if hasDetails != xTLSDetails {
+				t.Fatal("unexpected TLS details", result)
+			}
+		})
+	}
+}
+
+// TestQAVantages ensures that we measure from additional vantage points only when requested.
+func TestQAVantages(t *testing.T) {
+	for _, xVantages := range []bool{false, true} {
+		t.Run(fmt.Sprintf("with XVantages=%v", xVantages), func(t *testing.T) {
+			// create a new testing scenario
+			env := netemx.MustNewScenario(netemx.InternetScenario)
+			defer env.Close()
+
+			// create a new handler using the scenario's proxy as an additional vantage point
+			handler := oohelperd.NewHandler(
+				log.Log,
+				&netxlite.Netx{Underlying: &netxlite.NetemUnderlyingNetworkAdapter{UNet: env.ClientStack}},
+			)
+			vp := runtimex.Try1(oohelperd.NewVantagePoint("proxy", fmt.Sprintf("http://%s/", netemx.ISPProxyAddress)))
+			handler.Vantages = []*oohelperd.VantagePoint{vp}
+
+			// create request body
+			reqbody := &model.THRequest{
+				HTTPRequest: "https://www.example.com/",
+				HTTPRequestHeaders: map[string][]string{
+					"Accept-Language": {model.HTTPHeaderAcceptLanguage},
+					"Accept":          {model.HTTPHeaderAccept},
+					"User-Agent":      {model.HTTPHeaderUserAgent},
+				},
+				TCPConnect: []string{netemx.AddressWwwExampleCom},
+				XVantages:  xVantages,
+			}
+
+			// create request
+			req := runtimex.Try1(http.NewRequest(
+				"POST",
+				"http://127.0.0.1:8080/",
+				bytes.NewReader(must.MarshalJSON(reqbody)),
+			))
+
+			// invoke the handler and get the response
+			resprec := httptest.NewRecorder()
+			handler.ServeHTTP(resprec, req)
+			resp := resprec.Result()
+			defer resp.Body.Close()
+			if resp.StatusCode != 200 {
+				t.Fatal("expected 200 Ok")
+			}
+
+			// read and parse the response body
+			respbody := runtimex.Try1(netxlite.ReadAllContext(context.Background(), resp.Body))
+			var jsonresp model.THResponse
+			must.UnmarshalJSON(respbody, &jsonresp)
+
+			// make sure the vantage results are there only when requested
+			if !xVantages {
+				if len(jsonresp.Vantages) != 0 {
+					t.Fatal("expected no vantage results", jsonresp.Vantages)
+				}
+				return
+			}
+			if len(jsonresp.Vantages) != 1 {
+				t.Fatal("expected one vantage result", jsonresp.Vantages)
+			}
+			result := jsonresp.Vantages[0]
+			if result.Name != "proxy" {
+				t.Fatal("unexpected name", result.Name)
+			}
+			if result.DNS.Failure != nil || !slices.Contains(result.DNS.Addrs, netemx.AddressWwwExampleCom) {
+				t.Fatal("unexpected DNS result", result.DNS)
+			}
+			if result.HTTPRequest.Failure != nil || result.HTTPRequest.StatusCode != 200 {
+				t.Fatal("unexpected HTTP result", result.HTTPRequest)
+			}
+		})
+	}
+}
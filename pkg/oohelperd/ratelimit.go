@@ -0,0 +1,255 @@
+package oohelperd
+
+//
+// Rate limiting and abuse protection
+//
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/geoipx"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// RateLimitPolicy is a token bucket rate limiting policy.
+//
+// The zero value disables rate limiting.
+type RateLimitPolicy struct {
+	// Burst is the maximum number of tokens in the bucket, i.e., the
+	// maximum number of requests we allow in a burst.
+	Burst int
+
+	// Rate is the number of tokens per second we add to the bucket.
+	Rate float64
+}
+
+// enabled returns whether the policy enables rate limiting.
+func (p RateLimitPolicy) enabled() bool {
+	return p.Burst > 0 && p.Rate > 0
+}
+
+// Scopes for rate limiting, which we use as metrics labels and inside the
+// structured responses we send to rate limited clients.
+const (
+	rateLimitScopeClientIP  = "client_ip"
+	rateLimitScopeClientASN = "client_asn"
+	rateLimitScopeDomain    = "domain"
+)
+
+// rateLimitError is the error returned when a request is rate limited.
+type rateLimitError struct {
+	// RetryAfter is the time after which the client may retry.
+	RetryAfter time.Duration
+
+	// Scope is the rate limiting scope.
+	Scope string
+}
+
+// Error implements error.
+func (err *rateLimitError) Error() string {
+	return fmt.Sprintf("oohelperd: rate limited (scope: %s)", err.Scope)
+}
+
+// rateLimitMaxKeys is the number of keys after which [rateLimiter] prunes
+// the buckets that are full again, thus bounding its memory usage.
+const rateLimitMaxKeys = 1 << 16
+
+// rateLimitBucket is a token bucket.
+type rateLimitBucket struct {
+	// last is the last time we updated the bucket.
+	last time.Time
+
+	// policy is the policy of the bucket's scope. We keep it here because
+	// the buckets of all scopes share the same map, hence we need to know
+	// the right policy for each bucket when pruning.
+	policy RateLimitPolicy
+
+	// tokens is the number of tokens in the bucket.
+	tokens float64
+}
+
+// rateLimiter implements token bucket rate limiting for arbitrary keys.
+//
+// The zero value is invalid; construct using [newRateLimiter].
+type rateLimiter struct {
+	// buckets maps keys to their buckets.
+	buckets map[string]*rateLimitBucket
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// timeNow is the MANDATORY function returning the current time.
+	timeNow func() time.Time
+}
+
+// newRateLimiter creates a new [*rateLimiter].
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets: map[string]*rateLimitBucket{},
+		mu:      sync.Mutex{},
+		timeNow: time.Now,
+	}
+}
+
+// Allow consumes a token from the bucket of the given key according to the given
+// policy and returns zero when there was a token available. Otherwise, it returns
+// the time after which a token will be available. A disabled policy always allows.
+func (rl *rateLimiter) Allow(key string, policy RateLimitPolicy) time.Duration {
+	if !policy.enabled() {
+		return 0
+	}
+
+	defer rl.mu.Unlock()
+	rl.mu.Lock()
+
+	now := rl.timeNow()
+	if len(rl.buckets) >= rateLimitMaxKeys {
+		rl.pruneLocked(now)
+	}
+
+	bucket, found := rl.buckets[key]
+	if !found {
+		bucket = &rateLimitBucket{last: now, policy: policy, tokens: float64(policy.Burst)}
+		rl.buckets[key] = bucket
+	}
+	bucket.policy = policy
+	rl.refillLocked(bucket, now)
+
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) / policy.Rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return 0
+}
+
+// refillLocked adds to the bucket the tokens accumulated since the last update
+// according to the bucket's policy. This method MUST be called while holding the mutex.
+func (rl *rateLimiter) refillLocked(bucket *rateLimitBucket, now time.Time) {
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		policy := bucket.policy
+		bucket.tokens = math.Min(float64(policy.Burst), bucket.tokens+elapsed.Seconds()*policy.Rate)
+		bucket.last = now
+	}
+}
+
+// pruneLocked removes the buckets that are full again, which are equivalent to
+// buckets that do not exist. This method MUST be called while holding the mutex.
+func (rl *rateLimiter) pruneLocked(now time.Time) {
+	for key, bucket := range rl.buckets {
+		rl.refillLocked(bucket, now)
+		if bucket.tokens >= float64(bucket.policy.Burst) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// handlerClientIP returns the IP address of the client that sent the request. When
+// header is not empty, we use the last IP address inside such an header, which is
+// the one added by the reverse proxy in front of us. Otherwise, we use the address
+// of the remote endpoint. On failure, we return the empty string.
+func handlerClientIP(req *http.Request, header string) string {
+	if header != "" {
+		values := strings.Split(req.Header.Get(header), ",")
+		addr := strings.TrimSpace(values[len(values)-1])
+		if net.ParseIP(addr) == nil {
+			return ""
+		}
+		return addr
+	}
+	addr, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	return addr
+}
+
+// rateLimitClient returns a non-nil error if the client that sent the
+// given request should be rate limited by IP address or by ASN.
+func (h *Handler) rateLimitClient(req *http.Request) error {
+	addr := handlerClientIP(req, h.RateLimitClientIPHeader)
+	if addr == "" {
+		return nil // we cannot say anything about this client
+	}
+	if delay := h.rateLimiter.Allow(rateLimitScopeClientIP+"/"+addr, h.RateLimitClientIP); delay > 0 {
+		return &rateLimitError{RetryAfter: delay, Scope: rateLimitScopeClientIP}
+	}
+	if asn, _, err := geoipx.LookupASN(addr); err == nil && asn != 0 {
+		key := fmt.Sprintf("%s/AS%d", rateLimitScopeClientASN, asn)
+		if delay := h.rateLimiter.Allow(key, h.RateLimitClientASN); delay > 0 {
+			return &rateLimitError{RetryAfter: delay, Scope: rateLimitScopeClientASN}
+		}
+	}
+	return nil
+}
+
+// rateLimitDomain returns a non-nil error if we have recently performed
+// too many measurements for the given domain.
+func (h *Handler) rateLimitDomain(domain string) error {
+	key := rateLimitScopeDomain + "/" + strings.ToLower(domain)
+	if delay := h.rateLimiter.Allow(key, h.RateLimitDomain); delay > 0 {
+		return &rateLimitError{RetryAfter: delay, Scope: rateLimitScopeDomain}
+	}
+	return nil
+}
+
+// handlerRejectedResponse is the structured response body we send when we reject a request.
+type handlerRejectedResponse struct {
+	// Error is the reason why we rejected the request.
+	Error string `json:"error"`
+
+	// RetryAfter is the OPTIONAL number of seconds after which the client may retry.
+	RetryAfter int64 `json:"retry_after,omitempty"`
+
+	// Scope is the OPTIONAL rate limiting scope.
+	Scope string `json:"scope,omitempty"`
+}
+
+// handlerWriteRejected writes a structured response for a rejected request.
+func handlerWriteRejected(w http.ResponseWriter, code int, resp *handlerRejectedResponse) {
+	data, err := json.Marshal(resp)
+	runtimex.PanicOnError(err, "json.Marshal failed")
+	w.Header().Add("Content-Type", "application/json")
+	if resp.RetryAfter > 0 {
+		w.Header().Add("Retry-After", fmt.Sprintf("%d", resp.RetryAfter))
+	}
+	w.WriteHeader(code)
+	_, _ = w.Write(data)
+}
+
+// handlerWriteRateLimited writes the structured 429 response for the given error.
+func handlerWriteRateLimited(w http.ResponseWriter, err *rateLimitError) {
+	metricRequestsCount.WithLabelValues("429", "rate_limited").Inc()
+	metricRequestsRejectedCount.WithLabelValues(err.Scope).Inc()
+	handlerWriteRejected(w, 429, &handlerRejectedResponse{
+		Error:      "rate_limited",
+		RetryAfter: int64(math.Ceil(err.RetryAfter.Seconds())),
+		Scope:      err.Scope,
+	})
+}
+
+// errForbiddenTarget indicates that the target is on the denylist.
+var errForbiddenTarget = errors.New("oohelperd: forbidden target")
+
+// handlerIsForbiddenTarget returns true when the given URL hostname refers to the
+// helper's own host or network, i.e., an IP address for which [netxlite.IsBogon]
+// is true or a localhost name. Measuring such targets would allow clients to use the
+// helper for reaching otherwise unreachable services (also known as SSRF).
+//
+// Note that we do not need to check domain names here, because the helper only
+// connects to the addresses resolved for a domain that are not bogons.
+func handlerIsForbiddenTarget(hostname string) bool {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	if net.ParseIP(hostname) != nil {
+		return netxlite.IsBogon(hostname)
+	}
+	return hostname == "localhost" || strings.HasSuffix(hostname, ".localhost")
+}
@@ -0,0 +1,295 @@
+package oohelperd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+func TestRateLimiter(t *testing.T) {
+	policy := RateLimitPolicy{Burst: 2, Rate: 1}
+
+	t.Run("we allow bursts and then refill tokens over time", func(t *testing.T) {
+		now := time.Now()
+		rl := newRateLimiter()
+		rl.timeNow = func() time.Time {
+			return now
+		}
+
+		for idx := 0; idx < policy.Burst; idx++ {
+			if delay := rl.Allow("a", policy); delay != 0 {
+				t.Fatal("expected to allow request", idx)
+			}
+		}
+		if delay := rl.Allow("a", policy); delay != time.Second {
+			t.Fatal("expected to wait one second, got", delay)
+		}
+		if delay := rl.Allow("b", policy); delay != 0 {
+			t.Fatal("expected buckets to be independent")
+		}
+
+		now = now.Add(500 * time.Millisecond)
+		if delay := rl.Allow("a", policy); delay != 500*time.Millisecond {
+			t.Fatal("expected to wait half a second, got", delay)
+		}
+		now = now.Add(500 * time.Millisecond)
+		if delay := rl.Allow("a", policy); delay != 0 {
+			t.Fatal("expected to allow request after refill")
+		}
+	})
+
+	t.Run("a disabled policy always allows", func(t *testing.T) {
+		rl := newRateLimiter()
+		for idx := 0; idx < 128; idx++ {
+			if delay := rl.Allow("a", RateLimitPolicy{}); delay != 0 {
+				t.Fatal("expected to allow request", idx)
+			}
+		}
+		if len(rl.buckets) != 0 {
+			t.Fatal("expected no buckets")
+		}
+	})
+
+	t.Run("we prune full buckets when there are too many keys", func(t *testing.T) {
+		now := time.Now()
+		rl := newRateLimiter()
+		rl.timeNow = func() time.Time {
+			return now
+		}
+		for idx := 0; idx < rateLimitMaxKeys; idx++ {
+			rl.Allow(fmt.Sprintf("%d", idx), policy)
+		}
+		rl.Allow("0", policy) // make sure this bucket is not full when we prune
+
+		now = now.Add(time.Second)
+		rl.Allow("a", policy)
+		if diff := cmp.Diff(2, len(rl.buckets)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we prune each bucket according to its own policy", func(t *testing.T) {
+		now := time.Now()
+		rl := newRateLimiter()
+		rl.timeNow = func() time.Time {
+			return now
+		}
+		slow := RateLimitPolicy{Burst: 2, Rate: 0.1}
+		for idx := 0; idx < rateLimitMaxKeys; idx++ {
+			rl.Allow(fmt.Sprintf("%s/%d", rateLimitScopeDomain, idx), slow)
+		}
+
+		// with the caller's policy, these buckets would be full after one second
+		now = now.Add(time.Second)
+		rl.Allow(rateLimitScopeClientIP+"/130.192.91.211", policy)
+		if diff := cmp.Diff(rateLimitMaxKeys+1, len(rl.buckets)); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+}
+
+func TestHandlerClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		value      string
+		want       string
+	}{{
+		name:       "with the remote address",
+		remoteAddr: "130.192.91.211:54321",
+		want:       "130.192.91.211",
+	}, {
+		name:       "with an invalid remote address",
+		remoteAddr: "130.192.91.211",
+		want:       "",
+	}, {
+		name:       "with the last address inside the header",
+		remoteAddr: "127.0.0.1:54321",
+		header:     "X-Forwarded-For",
+		value:      "10.0.0.1, 130.192.91.211",
+		want:       "130.192.91.211",
+	}, {
+		name:       "with an invalid address inside the header",
+		remoteAddr: "127.0.0.1:54321",
+		header:     "X-Forwarded-For",
+		value:      "",
+		want:       "",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			if got := handlerClientIP(req, tt.header); got != tt.want {
+				t.Fatal("expected", tt.want, "got", got)
+			}
+		})
+	}
+}
+
+func TestHandlerIsForbiddenTarget(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     bool
+	}{
+		{hostname: "www.example.com", want: false},
+		{hostname: "93.184.216.34", want: false},
+		{hostname: "2606:2800:220:1:248:1893:25c8:1946", want: false},
+		{hostname: "127.0.0.1", want: true},
+		{hostname: "10.0.0.1", want: true},
+		{hostname: "169.254.169.254", want: true},
+		{hostname: "::1", want: true},
+		{hostname: "localhost", want: true},
+		{hostname: "LOCALHOST.", want: true},
+		{hostname: "www.localhost", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hostname, func(t *testing.T) {
+			if got := handlerIsForbiddenTarget(tt.hostname); got != tt.want {
+				t.Fatal("expected", tt.want, "got", got)
+			}
+		})
+	}
+}
+
+func TestHandlerCheckRedirect(t *testing.T) {
+	newRequest := func(URL string) *http.Request {
+		return &http.Request{URL: &url.URL{Scheme: "http", Host: URL, Path: "/"}}
+	}
+
+	t.Run("we follow redirects to other targets", func(t *testing.T) {
+		if err := handlerCheckRedirect(newRequest("www.example.com"), nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("we do not follow redirects to forbidden targets", func(t *testing.T) {
+		if err := handlerCheckRedirect(newRequest("169.254.169.254"), nil); !errors.Is(err, errForbiddenTarget) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("we stop after ten redirects", func(t *testing.T) {
+		via := make([]*http.Request, 10)
+		if err := handlerCheckRedirect(newRequest("www.example.com"), via); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestHandlerRateLimiting(t *testing.T) {
+	// serve sends the given request to the handler and returns the status code and the parsed body.
+	serve := func(t *testing.T, handler *Handler, target string) (int, http.Header, *handlerRejectedResponse) {
+		body := fmt.Sprintf(`{"http_request": %q, "tcp_connect": ["93.184.216.34:443"]}`, target)
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		req.RemoteAddr = "130.192.91.211:54321"
+		resprec := httptest.NewRecorder()
+		handler.ServeHTTP(resprec, req)
+		resp := resprec.Result()
+		var rejected handlerRejectedResponse
+		if resp.StatusCode != 200 {
+			if err := json.NewDecoder(resp.Body).Decode(&rejected); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, resp.Header, &rejected
+	}
+
+	// newHandler returns a handler whose measure function counts its invocations.
+	newHandler := func(count *atomic.Int64) *Handler {
+		handler := NewHandler(model.DiscardLogger, nil)
+		handler.measure = func(ctx context.Context, config *Handler, creq *ctrlRequest) (*ctrlResponse, error) {
+			count.Add(1)
+			return &ctrlResponse{}, nil
+		}
+		return handler
+	}
+
+	t.Run("we do not rate limit by default", func(t *testing.T) {
+		count := &atomic.Int64{}
+		handler := newHandler(count)
+		handler.CacheTTL = 0 // make sure we measure the domain each time
+
+		const requests = 100
+		for idx := 0; idx < requests; idx++ {
+			if code, _, _ := serve(t, handler, "https://www.example.com/"); code != 200 {
+				t.Fatal("unexpected status code", code)
+			}
+		}
+		if count.Load() != requests {
+			t.Fatal("unexpected number of measurements", count.Load())
+		}
+	})
+
+	t.Run("we rate limit by client IP address", func(t *testing.T) {
+		count := &atomic.Int64{}
+		handler := newHandler(count)
+		handler.RateLimitClientIP = RateLimitPolicy{Burst: 1, Rate: 0.1}
+
+		if code, _, _ := serve(t, handler, "https://www.example.com/"); code != 200 {
+			t.Fatal("unexpected status code", code)
+		}
+		code, header, rejected := serve(t, handler, "https://www.example.com/")
+		if code != 429 {
+			t.Fatal("unexpected status code", code)
+		}
+		if v := header.Get("Retry-After"); v != "10" {
+			t.Fatal("unexpected Retry-After", v)
+		}
+		expect := &handlerRejectedResponse{Error: "rate_limited", RetryAfter: 10, Scope: rateLimitScopeClientIP}
+		if diff := cmp.Diff(expect, rejected); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we rate limit measuring domains but not serving cached responses", func(t *testing.T) {
+		count := &atomic.Int64{}
+		handler := newHandler(count)
+		handler.RateLimitDomain = RateLimitPolicy{Burst: 1, Rate: 0.1}
+
+		for idx := 0; idx < 2; idx++ {
+			if code, _, _ := serve(t, handler, "https://www.example.com/"); code != 200 {
+				t.Fatal("unexpected status code", code)
+			}
+		}
+		code, _, rejected := serve(t, handler, "https://WWW.EXAMPLE.COM/robots.txt")
+		if code != 429 || rejected.Scope != rateLimitScopeDomain {
+			t.Fatal("unexpected response", code, rejected)
+		}
+		if count.Load() != 1 {
+			t.Fatal("unexpected number of measurements", count.Load())
+		}
+	})
+
+	t.Run("we refuse to measure forbidden targets", func(t *testing.T) {
+		count := &atomic.Int64{}
+		handler := newHandler(count)
+
+		code, _, rejected := serve(t, handler, "http://169.254.169.254/latest/meta-data/")
+		if code != 403 {
+			t.Fatal("unexpected status code", code)
+		}
+		if diff := cmp.Diff(&handlerRejectedResponse{Error: "forbidden_target"}, rejected); diff != "" {
+			t.Fatal(diff)
+		}
+		if count.Load() != 0 {
+			t.Fatal("expected no measurements")
+		}
+	})
+}
@@ -6,7 +6,9 @@ package oohelperd
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"sync"
 	"time"
 
@@ -45,6 +47,9 @@ type tcpTLSConfig struct {
 	// EnableTLS OPTIONALLY enables TLS.
 	EnableTLS bool
 
+	// EnableTLSDetails OPTIONALLY includes the TLS details into the TLS results.
+	EnableTLSDetails bool
+
 	// Endpoint is the MANDATORY endpoint to connect to.
 	Endpoint string
 
@@ -140,6 +145,7 @@ func tcpTLSDo(ctx context.Context, config *tcpTLSConfig) {
 
 	// perform the handshake
 	tlsConn, err := thx.Handshake(ctx, conn, tlsConfig)
+	state := netxlite.MaybeTLSConnectionState(tlsConn)
 	_ = measurexlite.MaybeClose(tlsConn)
 
 	// publish time required to handshake
@@ -154,6 +160,27 @@ func tcpTLSDo(ctx context.Context, config *tcpTLSConfig) {
 		Status:     err == nil,
 		Failure:    newfailure(err),
 	}
+	if err == nil && config.EnableTLSDetails {
+		tcpTLSAddDetails(out.TLS, state)
+	}
+}
+
+// tcpTLSAddDetails adds to the given result the details we extract from
+// the [tls.ConnectionState] of a successful TLS handshake.
+func tcpTLSAddDetails(out *ctrlTLSResult, state tls.ConnectionState) {
+	out.NegotiatedProtocol = state.NegotiatedProtocol
+	out.TLSVersion = netxlite.TLSVersionString(state.Version)
+	if len(state.PeerCertificates) <= 0 {
+		return
+	}
+	leaf := state.PeerCertificates[0]
+	digest := sha256.Sum256(leaf.Raw)
+	out.LeafCertificateFingerprint = hex.EncodeToString(digest[:])
+	out.LeafCertificateIssuer = leaf.Issuer.String()
+	out.LeafCertificateSANs = append(out.LeafCertificateSANs, leaf.DNSNames...)
+	for _, addr := range leaf.IPAddresses {
+		out.LeafCertificateSANs = append(out.LeafCertificateSANs, addr.String())
+	}
 }
 
 // tcpMapFailure attempts to map netxlite failures to the strings
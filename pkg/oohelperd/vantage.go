@@ -0,0 +1,187 @@
+package oohelperd
+
+//
+// Measurements from additional vantage points
+//
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/ooni/probe-engine/pkg/logx"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+// VantagePoint is an additional vantage point from which the [Handler] measures
+// DNS and HTTP by using an egress proxy. Because the proxy resolves the domains we
+// connect to, the helper cannot prevent the proxy from reaching bogons, so you
+// SHOULD make sure that the proxy cannot reach any internal network.
+//
+// The zero value is invalid; construct using [NewVantagePoint].
+type VantagePoint struct {
+	// Name is the name of the vantage point.
+	Name string
+
+	// ProxyURL is the URL of the SOCKS5 or HTTP(S) proxy.
+	ProxyURL *url.URL
+}
+
+// ErrVantagePointInvalid indicates that we cannot create a [VantagePoint].
+var ErrVantagePointInvalid = errors.New("oohelperd: invalid vantage point")
+
+// NewVantagePoint creates a new [*VantagePoint] using the given name and the given
+// proxy URL, whose scheme must be one of "socks5", "http", and "https".
+func NewVantagePoint(name, proxyURL string) (*VantagePoint, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: empty name", ErrVantagePointInvalid)
+	}
+	URL, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrVantagePointInvalid, err.Error())
+	}
+	switch URL.Scheme {
+	case "socks5", "http", "https":
+	default:
+		return nil, fmt.Errorf("%w: unsupported proxy scheme: %s", ErrVantagePointInvalid, URL.Scheme)
+	}
+	if URL.Host == "" {
+		return nil, fmt.Errorf("%w: empty proxy host", ErrVantagePointInvalid)
+	}
+	return &VantagePoint{Name: name, ProxyURL: URL}, nil
+}
+
+// newVantageHTTPTransport creates a new [model.HTTPTransport] using the given vantage point.
+func newVantageHTTPTransport(netx *netxlite.Netx, logger model.Logger, vp *VantagePoint) model.HTTPTransport {
+	// Implementation note: the transport only uses these dialers to reach the proxy. We
+	// configure the root CAs explicitly because the transport uses the TLSClientConfig
+	// rather than the TLS dialer when performing the TLS handshake through the proxy.
+	dialer := netx.NewDialerWithResolver(logger, newResolver(logger, netx))
+	tlsDialer := netxlite.NewTLSDialer(dialer, netx.NewTLSHandshakerStdlib(logger))
+	return netxlite.NewHTTPTransportWithOptions(
+		logger, dialer, tlsDialer,
+		netxlite.HTTPTransportOptionProxyURL(vp.ProxyURL),
+		netxlite.HTTPTransportOptionTLSClientConfig(&tls.Config{
+			RootCAs: netx.MaybeCustomUnderlyingNetwork().Get().DefaultCertPool(),
+		}),
+	)
+}
+
+// newVantageHTTPClient creates a new [model.HTTPClient] using the given vantage point.
+func newVantageHTTPClient(netx *netxlite.Netx, logger model.Logger, vp *VantagePoint) model.HTTPClient {
+	// fix: like newHTTPClientWithTransportFactory, we MUST set a cookie jar
+	client := &http.Client{
+		Transport:     newVantageHTTPTransport(netx, logger, vp),
+		CheckRedirect: handlerCheckRedirect,
+		Jar:           newCookieJar(),
+		Timeout:       0,
+	}
+	return netxlite.WrapHTTPClient(client)
+}
+
+// newVantageResolver creates a new [model.Resolver] using the given vantage point, which
+// uses the same DNS-over-HTTPS server used by [newResolver] through the proxy.
+func newVantageResolver(netx *netxlite.Netx, logger model.Logger, vp *VantagePoint) model.Resolver {
+	txp := netxlite.NewDNSOverHTTPSTransportWithHTTPTransport(
+		newVantageHTTPTransport(netx, logger, vp),
+		"https://dns.google/dns-query",
+	)
+	return netxlite.WrapResolver(logger, netxlite.NewUnwrappedParallelResolver(txp))
+}
+
+// vantageConfig contains configuration for the [vantageDo] function.
+type vantageConfig struct {
+	// Headers is OPTIONAL and contains the request headers we should set.
+	Headers map[string][]string
+
+	// Logger is the MANDATORY logger to use.
+	Logger model.Logger
+
+	// MaxAcceptableBody is MANDATORY and specifies the maximum acceptable body size.
+	MaxAcceptableBody int64
+
+	// NewClient is the MANDATORY factory to create a new client.
+	NewClient func(model.Logger, *VantagePoint) model.HTTPClient
+
+	// NewResolver is the MANDATORY factory to create a new resolver.
+	NewResolver func(model.Logger, *VantagePoint) model.Resolver
+
+	// Out is the MANDATORY channel where we publish the results.
+	Out chan model.THVantageResult
+
+	// URL is the MANDATORY URL to measure.
+	URL *url.URL
+
+	// VantagePoint is the MANDATORY vantage point to use.
+	VantagePoint *VantagePoint
+
+	// Wg is MANDATORY and allows [vantageDo] to synchronize with the caller.
+	Wg *sync.WaitGroup
+}
+
+// vantageDo measures DNS and HTTP from the given vantage point by reusing
+// the [dnsDo] and [httpDo] micro-measurements.
+func vantageDo(ctx context.Context, config *vantageConfig) {
+	// make sure the caller knows when we're done
+	defer config.Wg.Done()
+
+	// make sure we can distinguish the logs of each vantage point
+	logger := &logx.PrefixLogger{
+		Prefix: fmt.Sprintf("<%s> ", config.VantagePoint.Name),
+		Logger: config.Logger,
+	}
+	wg := &sync.WaitGroup{}
+
+	// dns: start, unless the URL hostname is an IP address
+	dnsch := make(chan ctrlDNSResult, 1)
+	if net.ParseIP(config.URL.Hostname()) == nil {
+		wg.Add(1)
+		go dnsDo(ctx, &dnsConfig{
+			Domain: config.URL.Hostname(),
+			Logger: logger,
+			NewResolver: func(logger model.Logger) model.Resolver {
+				return config.NewResolver(logger, config.VantagePoint)
+			},
+			Out: dnsch,
+			Wg:  wg,
+		})
+	}
+
+	// http: start
+	httpch := make(chan ctrlHTTPResponse, 1)
+	wg.Add(1)
+	go httpDo(ctx, &httpConfig{
+		Headers:           config.Headers,
+		Logger:            logger,
+		MaxAcceptableBody: config.MaxAcceptableBody,
+		NewClient: func(logger model.Logger) model.HTTPClient {
+			return config.NewClient(logger, config.VantagePoint)
+		},
+		Out:         httpch,
+		URL:         config.URL.String(),
+		Wg:          wg,
+		searchForH3: false,
+	})
+
+	// wait for the measurements to complete
+	wg.Wait()
+
+	// assemble the result like measure does
+	out := model.THVantageResult{
+		Name:        config.VantagePoint.Name,
+		DNS:         ctrlDNSResult{Failure: nil, Addrs: []string{}, ASNs: []int64{}},
+		HTTPRequest: <-httpch,
+	}
+	select {
+	case out.DNS = <-dnsch:
+	default:
+		// not measured
+	}
+	config.Out <- out
+}
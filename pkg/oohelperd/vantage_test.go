@@ -0,0 +1,145 @@
+package oohelperd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestNewVantagePoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		vpName   string
+		proxyURL string
+		wantErr  bool
+	}{{
+		name:     "with a SOCKS5 proxy",
+		vpName:   "de",
+		proxyURL: "socks5://10.0.0.1:1080",
+		wantErr:  false,
+	}, {
+		name:     "with an HTTPS proxy",
+		vpName:   "us",
+		proxyURL: "https://proxy.example.com/",
+		wantErr:  false,
+	}, {
+		name:     "with an empty name",
+		vpName:   "",
+		proxyURL: "socks5://10.0.0.1:1080",
+		wantErr:  true,
+	}, {
+		name:     "with an unparseable URL",
+		vpName:   "de",
+		proxyURL: "\t",
+		wantErr:  true,
+	}, {
+		name:     "with an unsupported scheme",
+		vpName:   "de",
+		proxyURL: "ftp://10.0.0.1/",
+		wantErr:  true,
+	}, {
+		name:     "with an empty host",
+		vpName:   "de",
+		proxyURL: "socks5:///",
+		wantErr:  true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vp, err := NewVantagePoint(tt.vpName, tt.proxyURL)
+			if tt.wantErr {
+				if !errors.Is(err, ErrVantagePointInvalid) || vp != nil {
+					t.Fatal("unexpected result", vp, err)
+				}
+				return
+			}
+			if err != nil || vp.Name != tt.vpName || vp.ProxyURL.String() != tt.proxyURL {
+				t.Fatal("unexpected result", vp, err)
+			}
+		})
+	}
+}
+
+func TestVantageDo(t *testing.T) {
+	// run runs vantageDo with the given URL and returns the result and whether we resolved.
+	run := func(t *testing.T, URL string) (model.THVantageResult, bool) {
+		var (
+			clientVP   *VantagePoint
+			resolved   bool
+			resolverVP *VantagePoint
+		)
+		vp := &VantagePoint{Name: "de", ProxyURL: &url.URL{Scheme: "socks5", Host: "10.0.0.1:1080"}}
+		out := make(chan model.THVantageResult, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		go vantageDo(context.Background(), &vantageConfig{
+			Logger:            model.DiscardLogger,
+			MaxAcceptableBody: 1 << 24,
+			NewClient: func(logger model.Logger, got *VantagePoint) model.HTTPClient {
+				clientVP = got
+				return &http.Client{
+					Transport: &mocks.HTTPTransport{
+						MockRoundTrip: func(req *http.Request) (*http.Response, error) {
+							return nil, netxlite.NewTopLevelGenericErrWrapper(netxlite.ECONNREFUSED)
+						},
+						MockCloseIdleConnections: func() {
+							// nothing
+						},
+					},
+				}
+			},
+			NewResolver: func(logger model.Logger, got *VantagePoint) model.Resolver {
+				resolverVP = got
+				return &mocks.Resolver{
+					MockLookupHost: func(ctx context.Context, domain string) ([]string, error) {
+						resolved = true
+						return []string{"93.184.216.34"}, nil
+					},
+					MockCloseIdleConnections: func() {
+						// nothing
+					},
+				}
+			},
+			Out:          out,
+			URL:          runtimex.Try1(url.Parse(URL)),
+			VantagePoint: vp,
+			Wg:           wg,
+		})
+		wg.Wait()
+		if clientVP != vp || (resolved && resolverVP != vp) {
+			t.Fatal("the factories did not receive the vantage point")
+		}
+		return <-out, resolved
+	}
+
+	t.Run("with a domain name", func(t *testing.T) {
+		result, resolved := run(t, "https://www.example.com/")
+		if !resolved || result.Name != "de" {
+			t.Fatal("unexpected result", result)
+		}
+		if result.DNS.Failure != nil || len(result.DNS.Addrs) != 1 || result.DNS.Addrs[0] != "93.184.216.34" {
+			t.Fatal("unexpected DNS result", result.DNS)
+		}
+		if result.HTTPRequest.Failure == nil {
+			t.Fatal("unexpected HTTP result", result.HTTPRequest)
+		}
+	})
+
+	t.Run("with an IP address", func(t *testing.T) {
+		result, resolved := run(t, "https://93.184.216.34/")
+		if resolved {
+			t.Fatal("expected no DNS lookup")
+		}
+		if result.DNS.Failure != nil || len(result.DNS.Addrs) != 0 {
+			t.Fatal("unexpected DNS result", result.DNS)
+		}
+	})
+}
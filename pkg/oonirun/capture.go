@@ -0,0 +1,93 @@
+package oonirun
+
+//
+// Capture packets while measuring.
+//
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/pcapx"
+)
+
+// experimentCaptureWrapper captures the packets exchanged while measuring and saves
+// those exchanged with the measurement endpoints into a pcapng file next to the
+// report file. We link such a file from the measurement annotations using its
+// basename and its SHA256, such that it is possible to find the file and to check
+// that it has not been modified. We write the file in cleartext, therefore we
+// MUST NOT use this wrapper when we encrypt the measurements at rest.
+type experimentCaptureWrapper struct {
+	// capturer is the packet capturer
+	capturer *pcapx.Capturer
+
+	// child is the child experiment wrapper
+	child InputProcessorExperimentWrapper
+
+	// logger is the logger to use
+	logger model.Logger
+
+	// reportFile is the report file path
+	reportFile string
+}
+
+func (cw *experimentCaptureWrapper) MeasureWithContext(
+	ctx context.Context, target model.ExperimentTarget, idx int) (meas *model.Measurement, err error) {
+	// Implementation note: we learn the endpoints as we dial them such that the
+	// capturer only buffers the packets exchanged with such endpoints
+	endpoints := pcapx.NewEndpoints()
+	underlying := (&netxlite.MaybeCustomUnderlyingNetwork{}).Get()
+	cw.capturer.Start(endpoints)
+	netxlite.WithCustomTProxy(endpoints.WrapUnderlyingNetwork(underlying), func() {
+		meas, err = cw.child.MeasureWithContext(ctx, target, idx)
+	})
+	packets := cw.capturer.Stop()
+	if err != nil {
+		return nil, err
+	}
+	filename, digest, err := cw.save(meas, packets)
+	if err != nil {
+		// policy: failing to save packets does not fail the measurement
+		cw.logger.Warnf("capture: cannot save packets: %s", err.Error())
+		return meas, nil
+	}
+	meas.AddAnnotation("pcapng_file", filepath.Base(filename))
+	meas.AddAnnotation("pcapng_sha256", digest)
+	cw.logger.Infof("capture: saved packets into %s", filename)
+	return meas, nil
+}
+
+// save writes the packets exchanged with the measurement endpoints into a new
+// pcapng file inside the report file directory and returns its name and the
+// hex-encoded SHA256 of its content.
+func (cw *experimentCaptureWrapper) save(meas *model.Measurement, packets []*pcapx.Packet) (string, string, error) {
+	endpoints, err := pcapx.MeasurementEndpoints(meas)
+	if err != nil {
+		return "", "", err
+	}
+	base := filepath.Base(cw.reportFile)
+	pattern := fmt.Sprintf("%s-%s-*.pcapng", strings.TrimSuffix(base, filepath.Ext(base)), meas.TestName)
+	filep, err := os.CreateTemp(filepath.Dir(cw.reportFile), pattern)
+	if err != nil {
+		return "", "", err
+	}
+	hash := sha256.New()
+	count, err := pcapx.WritePCAPNG(io.MultiWriter(filep, hash), cw.capturer.LinkType(), packets, endpoints)
+	if err != nil {
+		filep.Close()
+		return "", "", err
+	}
+	if err := filep.Close(); err != nil {
+		return "", "", err
+	}
+	cw.logger.Debugf("capture: kept %d out of %d packets", count, len(packets))
+	return filep.Name(), hex.EncodeToString(hash.Sum(nil)), nil
+}
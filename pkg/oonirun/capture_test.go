@@ -0,0 +1,257 @@
+package oonirun
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/pcapx"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// captureTestSource is a [pcapx.Source] where the test delivers packets synchronously.
+type captureTestSource struct {
+	done    chan any
+	packets chan *pcapx.Packet
+}
+
+func newCaptureTestSource() *captureTestSource {
+	return &captureTestSource{
+		done:    make(chan any),
+		packets: make(chan *pcapx.Packet),
+	}
+}
+
+// deliver returns once the capturer has processed a packet from src to dst.
+func (s *captureTestSource) deliver(t *testing.T, src, dst string) {
+	ipv4 := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP(src),
+		DstIP:    net.ParseIP(dst),
+	}
+	udp := &layers.UDP{SrcPort: 54321, DstPort: 443}
+	udp.SetNetworkLayerForChecksum(ipv4)
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buffer, options, ipv4, udp, gopacket.Payload("abc")); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.Bytes()
+	s.packets <- &pcapx.Packet{
+		CaptureInfo: gopacket.CaptureInfo{CaptureLength: len(data), Length: len(data)},
+		Data:        data,
+	}
+	// the capturer processes packets sequentially, so when it accepts
+	// the next packet we know it has processed the previous one
+	s.packets <- &pcapx.Packet{}
+}
+
+func (s *captureTestSource) ReadPacket() (*pcapx.Packet, error) {
+	select {
+	case <-s.done:
+		return nil, net.ErrClosed
+	case packet := <-s.packets:
+		return packet, nil
+	}
+}
+
+func (s *captureTestSource) LinkType() layers.LinkType {
+	return layers.LinkTypeRaw
+}
+
+func (s *captureTestSource) Close() error {
+	close(s.done)
+	return nil
+}
+
+func TestExperimentCaptureWrapper(t *testing.T) {
+	newWrapper := func(t *testing.T, reportFile string, measure func(source *captureTestSource) (*model.Measurement, error)) *experimentCaptureWrapper {
+		source := newCaptureTestSource()
+		capturer := pcapx.NewCapturer(source, model.DiscardLogger)
+		t.Cleanup(func() { capturer.Close() })
+		return &experimentCaptureWrapper{
+			capturer: capturer,
+			child: NewInputProcessorExperimentWrapper(&mocks.Experiment{
+				MockMeasureWithContext: func(ctx context.Context, target model.ExperimentTarget) (*model.Measurement, error) {
+					return measure(source)
+				},
+			}),
+			logger:     model.DiscardLogger,
+			reportFile: reportFile,
+		}
+	}
+
+	t.Run("we save the packets exchanged with the measurement endpoints", func(t *testing.T) {
+		dir := t.TempDir()
+		cw := newWrapper(t, filepath.Join(dir, "report.jsonl"), func(source *captureTestSource) (*model.Measurement, error) {
+			// we only buffer the packets exchanged with the endpoints we dial
+			underlying := (&netxlite.MaybeCustomUnderlyingNetwork{}).Get()
+			for _, endpoint := range []string{"8.8.8.8:443", "8.8.4.4:443"} {
+				if _, err := underlying.DialContext(context.Background(), "tcp", endpoint); err != nil {
+					t.Fatal(err)
+				}
+			}
+			source.deliver(t, "10.0.0.1", "8.8.8.8")
+			source.deliver(t, "10.0.0.1", "8.8.4.4")
+			source.deliver(t, "10.0.0.1", "1.1.1.1")
+			source.deliver(t, "8.8.8.8", "10.0.0.1")
+			meas := &model.Measurement{
+				TestName: "example",
+				TestKeys: map[string]any{
+					"tcp_connect": []any{map[string]any{"ip": "8.8.8.8", "port": 443}},
+				},
+			}
+			return meas, nil
+		})
+		tproxy := &mocks.UnderlyingNetwork{
+			MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return &mocks.Conn{}, nil
+			},
+		}
+		var (
+			meas *model.Measurement
+			err  error
+		)
+		netxlite.WithCustomTProxy(tproxy, func() {
+			meas, err = cw.MeasureWithContext(context.Background(), model.NewOOAPIURLInfoWithDefaultCategoryAndCountry(""), 0)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		filenames, err := filepath.Glob(filepath.Join(dir, "report-example-*.pcapng"))
+		if err != nil || len(filenames) != 1 {
+			t.Fatal("expected a single pcapng file", filenames, err)
+		}
+		if meas.Annotations["pcapng_file"] != filepath.Base(filenames[0]) {
+			t.Fatal("unexpected pcapng_file annotation", meas.Annotations)
+		}
+		data, err := os.ReadFile(filenames[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := sha256.Sum256(data)
+		if meas.Annotations["pcapng_sha256"] != hex.EncodeToString(digest[:]) {
+			t.Fatal("unexpected pcapng_sha256 annotation", meas.Annotations)
+		}
+		filep, err := os.Open(filenames[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer filep.Close()
+		reader, err := pcapgo.NewNgReader(filep, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		for {
+			if _, _, err := reader.ReadPacketData(); err != nil {
+				break
+			}
+			count++
+		}
+		// note: we do not save the packets exchanged with 8.8.4.4 because
+		// we dialed it but it does not appear in the test keys
+		if count != 2 {
+			t.Fatal("expected two packets, got", count)
+		}
+	})
+
+	t.Run("we do not save anything when the measurement fails", func(t *testing.T) {
+		dir := t.TempDir()
+		expected := errors.New("mocked error")
+		cw := newWrapper(t, filepath.Join(dir, "report.jsonl"), func(source *captureTestSource) (*model.Measurement, error) {
+			source.deliver(t, "10.0.0.1", "8.8.8.8")
+			return nil, expected
+		})
+		meas, err := cw.MeasureWithContext(context.Background(), model.NewOOAPIURLInfoWithDefaultCategoryAndCountry(""), 0)
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if meas != nil {
+			t.Fatal("expected nil measurement")
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Fatal("expected no files")
+		}
+	})
+
+	t.Run("failing to save packets does not fail the measurement", func(t *testing.T) {
+		reportFile := filepath.Join(t.TempDir(), "nonexistent", "report.jsonl")
+		cw := newWrapper(t, reportFile, func(source *captureTestSource) (*model.Measurement, error) {
+			return &model.Measurement{TestName: "example"}, nil
+		})
+		meas, err := cw.MeasureWithContext(context.Background(), model.NewOOAPIURLInfoWithDefaultCategoryAndCountry(""), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := os.ReadDir(filepath.Dir(filepath.Dir(reportFile)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 || meas == nil {
+			t.Fatal("expected the measurement and no files")
+		}
+		if len(meas.Annotations) != 0 {
+			t.Fatal("expected no annotations", meas.Annotations)
+		}
+	})
+}
+
+func TestExperimentNewInputProcessorWithCapturer(t *testing.T) {
+	capturer := pcapx.NewCapturer(newCaptureTestSource(), model.DiscardLogger)
+	defer capturer.Close()
+
+	identity := runtimex.Try1(age.GenerateX25519Identity())
+
+	for _, tc := range []struct {
+		name       string
+		noJSON     bool
+		recipients []age.Recipient
+		expect     bool
+	}{{
+		name:   "we capture when saving the report",
+		expect: true,
+	}, {
+		name:   "we do not capture when not saving the report",
+		noJSON: true,
+	}, {
+		name:       "we do not capture when encrypting the report",
+		recipients: []age.Recipient{identity.Recipient()},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			ed := &Experiment{
+				Capturer:   capturer,
+				NoJSON:     tc.noJSON,
+				Recipients: tc.recipients,
+				Session: &mocks.Session{
+					MockLogger: func() model.Logger {
+						return model.DiscardLogger
+					},
+				},
+			}
+			ip := ed.newInputProcessor(&mocks.Experiment{}, nil, &mocks.Saver{}, &mocks.Submitter{}).(*InputProcessor)
+			_, captures := ip.Experiment.(*experimentWrapper).child.(*experimentCaptureWrapper)
+			if captures != tc.expect {
+				t.Fatal("expected", tc.expect, "got", captures)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package oonirun
+
+//
+// Recording measurements into the results database
+//
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/ooni/probe-engine/pkg/engine"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/msmtcrypt"
+)
+
+// ResultsDatabase contains the config for recording measurements into the results
+// database. You MUST fill all the fields marked as MANDATORY.
+type ResultsDatabase struct {
+	// Database is the MANDATORY database where to record results.
+	Database model.WritableDatabase
+
+	// HomeDir is the MANDATORY directory inside which the database creates
+	// the directories containing the measurements of each result.
+	HomeDir string
+
+	// NetworkID is the MANDATORY ID of the network we're measuring, which
+	// you should obtain by calling the database's CreateNetwork method.
+	NetworkID int64
+
+	// Recipients OPTIONALLY contains the recipients for whom we encrypt the
+	// measurement files. See the msmtcrypt package for more info.
+	Recipients []age.Recipient
+}
+
+// experimentDatabaseRecorder records an experiment run into the results database. We
+// create a result for each experiment run and a measurement for each saved measurement.
+//
+// Because we should not stop measuring if the database is not working, the recorder
+// logs database errors and otherwise ignores them.
+type experimentDatabaseRecorder struct {
+	// config is the database config.
+	config *ResultsDatabase
+
+	// count counts the measurements we recorded.
+	count int
+
+	// logger is the logger to use.
+	logger model.Logger
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// result is the result we're recording.
+	result *model.DatabaseResult
+
+	// submitted contains the result of submitting each measurement.
+	submitted map[*model.Measurement]error
+
+	// targets maps each input to the corresponding target.
+	targets map[string]model.ExperimentTarget
+}
+
+// newExperimentDatabaseRecorder creates a new result for the given experiment and
+// returns the corresponding recorder or an error.
+func newExperimentDatabaseRecorder(config *ResultsDatabase, logger model.Logger,
+	experimentName string, targets []model.ExperimentTarget) (*experimentDatabaseRecorder, error) {
+	result, err := config.Database.CreateResult(config.HomeDir, experimentName, config.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+	rec := &experimentDatabaseRecorder{
+		config:    config,
+		count:     0,
+		logger:    logger,
+		mu:        sync.Mutex{},
+		result:    result,
+		submitted: make(map[*model.Measurement]error),
+		targets:   make(map[string]model.ExperimentTarget),
+	}
+	for _, target := range targets {
+		rec.targets[target.Input()] = target
+	}
+	return rec, nil
+}
+
+// wrapSubmitter returns a submitter that keeps track of the submission results.
+func (rec *experimentDatabaseRecorder) wrapSubmitter(submitter model.Submitter) model.Submitter {
+	return &experimentDatabaseSubmitter{child: submitter, rec: rec}
+}
+
+// wrapSaver returns a saver that also records measurements into the database.
+func (rec *experimentDatabaseRecorder) wrapSaver(saver model.Saver) model.Saver {
+	return &experimentDatabaseSaver{child: saver, rec: rec}
+}
+
+// experimentDatabaseSubmitter is the submitter returned by wrapSubmitter.
+type experimentDatabaseSubmitter struct {
+	child model.Submitter
+	rec   *experimentDatabaseRecorder
+}
+
+// Submit implements model.Submitter.
+func (sub *experimentDatabaseSubmitter) Submit(ctx context.Context, m *model.Measurement) error {
+	err := sub.child.Submit(ctx, m)
+	sub.rec.mu.Lock()
+	sub.rec.submitted[m] = err
+	sub.rec.mu.Unlock()
+	return err
+}
+
+// experimentDatabaseSaver is the saver returned by wrapSaver.
+type experimentDatabaseSaver struct {
+	child model.Saver
+	rec   *experimentDatabaseRecorder
+}
+
+// SaveMeasurement implements model.Saver.
+func (sav *experimentDatabaseSaver) SaveMeasurement(m *model.Measurement) error {
+	if err := sav.child.SaveMeasurement(m); err != nil {
+		return err
+	}
+	if err := sav.rec.record(m); err != nil {
+		sav.rec.logger.Warnf("cannot record measurement into the database: %s", err.Error())
+	}
+	return nil
+}
+
+// record records the given measurement into the database.
+func (rec *experimentDatabaseRecorder) record(m *model.Measurement) error {
+	defer rec.mu.Unlock()
+	rec.mu.Lock()
+	db := rec.config.Database
+
+	var urlID sql.NullInt64
+	if input := string(m.Input); input != "" {
+		categoryCode, countryCode := model.DefaultCategoryCode, model.DefaultCountryCode
+		if target, found := rec.targets[input]; found {
+			categoryCode, countryCode = target.Category(), target.Country()
+		}
+		id, err := db.CreateOrUpdateURL(input, categoryCode, countryCode)
+		if err != nil {
+			return err
+		}
+		urlID = sql.NullInt64{Int64: id, Valid: true}
+	}
+
+	reportID := sql.NullString{String: m.ReportID, Valid: m.ReportID != ""}
+	msmt, err := db.CreateMeasurement(
+		reportID, m.TestName, rec.result.MeasurementDir, rec.count, rec.result.ID, urlID)
+	if err != nil {
+		return err
+	}
+	rec.count++
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if len(rec.config.Recipients) > 0 {
+		if data, err = msmtcrypt.EncryptLine(data, rec.config.Recipients...); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(msmt.MeasurementFilePath.String, data, 0600); err != nil {
+		return err
+	}
+
+	if err := db.AddTestKeys(msmt, engine.MeasurementSummaryKeys(m)); err != nil {
+		return err
+	}
+
+	// Note: we only know about submission if we have submitted. When the user
+	// disables the collector, the measurement remains not uploaded.
+	if submitErr, found := rec.submitted[m]; found {
+		delete(rec.submitted, m)
+		if submitErr != nil {
+			if err := db.UploadFailed(msmt, submitErr.Error()); err != nil {
+				return err
+			}
+		} else {
+			if err := db.UploadSucceeded(msmt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return db.Done(msmt)
+}
+
+// finish marks the result as finished.
+func (rec *experimentDatabaseRecorder) finish(experiment model.Experiment) {
+	defer rec.mu.Unlock()
+	rec.mu.Lock()
+	db := rec.config.Database
+	rec.result.DataUsageUp = experiment.KibiBytesSent()
+	rec.result.DataUsageDown = experiment.KibiBytesReceived()
+	if err := db.Finished(rec.result); err != nil {
+		rec.logger.Warnf("cannot mark result as finished: %s", err.Error())
+		return
+	}
+	if err := db.UpdateUploadedStatus(rec.result); err != nil {
+		rec.logger.Warnf("cannot update the result upload status: %s", err.Error())
+	}
+}
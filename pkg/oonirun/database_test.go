@@ -0,0 +1,263 @@
+package oonirun
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/msmtcrypt"
+)
+
+// newTestingDatabase returns a mocked database recording into the given dir.
+func newTestingDatabase(dir string, calls map[string]int) *mocks.Database {
+	return &mocks.Database{
+		MockCreateResult: func(homePath string, testGroupName string, networkID int64) (*model.DatabaseResult, error) {
+			calls["CreateResult"]++
+			return &model.DatabaseResult{ID: 11, MeasurementDir: dir, NetworkID: networkID}, nil
+		},
+		MockCreateOrUpdateURL: func(urlStr string, categoryCode string, countryCode string) (int64, error) {
+			calls["CreateOrUpdateURL"]++
+			if categoryCode != "NEWS" || countryCode != "IT" {
+				panic("unexpected category or country code")
+			}
+			return 17, nil
+		},
+		MockCreateMeasurement: func(reportID sql.NullString, testName string, measurementDir string,
+			idx int, resultID int64, urlID sql.NullInt64) (*model.DatabaseMeasurement, error) {
+			calls["CreateMeasurement"]++
+			if resultID != 11 || !urlID.Valid || urlID.Int64 != 17 {
+				panic("unexpected result or URL ID")
+			}
+			return &model.DatabaseMeasurement{
+				MeasurementFilePath: sql.NullString{
+					String: filepath.Join(measurementDir, "msmt.json"),
+					Valid:  true,
+				},
+			}, nil
+		},
+		MockAddTestKeys: func(msmt *model.DatabaseMeasurement, sk model.MeasurementSummaryKeys) error {
+			calls["AddTestKeys"]++
+			return nil
+		},
+		MockUploadFailed: func(msmt *model.DatabaseMeasurement, failure string) error {
+			calls["UploadFailed"]++
+			return nil
+		},
+		MockUploadSucceeded: func(msmt *model.DatabaseMeasurement) error {
+			calls["UploadSucceeded"]++
+			return nil
+		},
+		MockDone: func(msmt *model.DatabaseMeasurement) error {
+			calls["Done"]++
+			return nil
+		},
+		MockFinished: func(result *model.DatabaseResult) error {
+			calls["Finished"]++
+			if result.DataUsageUp != 1 || result.DataUsageDown != 2 {
+				panic("unexpected data usage")
+			}
+			return nil
+		},
+		MockUpdateUploadedStatus: func(result *model.DatabaseResult) error {
+			calls["UpdateUploadedStatus"]++
+			return nil
+		},
+	}
+}
+
+func TestExperimentDatabaseRecorder(t *testing.T) {
+	targets := []model.ExperimentTarget{
+		&model.OOAPIURLInfo{CategoryCode: "NEWS", CountryCode: "IT", URL: "https://www.example.com/"},
+	}
+
+	t.Run("we record measurements and their submission status", func(t *testing.T) {
+		for _, submitErr := range []error{nil, errors.New("mocked error")} {
+			dir := t.TempDir()
+			calls := map[string]int{}
+			config := &ResultsDatabase{
+				Database:  newTestingDatabase(dir, calls),
+				HomeDir:   dir,
+				NetworkID: 4,
+			}
+			rec, err := newExperimentDatabaseRecorder(config, model.DiscardLogger, "web_connectivity", targets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			submitter := rec.wrapSubmitter(&mocks.Submitter{
+				MockSubmit: func(ctx context.Context, m *model.Measurement) error {
+					return submitErr
+				},
+			})
+			saver := rec.wrapSaver(&mocks.Saver{
+				MockSaveMeasurement: func(m *model.Measurement) error {
+					return nil
+				},
+			})
+			m := &model.Measurement{Input: "https://www.example.com/", TestName: "web_connectivity"}
+			if err := submitter.Submit(context.Background(), m); !errors.Is(err, submitErr) {
+				t.Fatal("unexpected error", err)
+			}
+			if err := saver.SaveMeasurement(m); err != nil {
+				t.Fatal(err)
+			}
+			rec.finish(&mocks.Experiment{
+				MockKibiBytesSent: func() float64 {
+					return 1
+				},
+				MockKibiBytesReceived: func() float64 {
+					return 2
+				},
+			})
+
+			expectUpload := "UploadSucceeded"
+			if submitErr != nil {
+				expectUpload = "UploadFailed"
+			}
+			for _, name := range []string{"CreateResult", "CreateOrUpdateURL", "CreateMeasurement",
+				"AddTestKeys", expectUpload, "Done", "Finished", "UpdateUploadedStatus"} {
+				if calls[name] != 1 {
+					t.Fatal("expected a single call to", name, "got", calls[name])
+				}
+			}
+			if len(rec.submitted) != 0 {
+				t.Fatal("expected to forget about the submitted measurement")
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "msmt.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var saved model.Measurement
+			if err := json.Unmarshal(data, &saved); err != nil {
+				t.Fatal(err)
+			}
+			if saved.Input != m.Input {
+				t.Fatal("unexpected saved measurement input", saved.Input)
+			}
+		}
+	})
+
+	t.Run("we do not mark as uploaded measurements we did not submit", func(t *testing.T) {
+		dir := t.TempDir()
+		calls := map[string]int{}
+		config := &ResultsDatabase{Database: newTestingDatabase(dir, calls), HomeDir: dir}
+		rec, err := newExperimentDatabaseRecorder(config, model.DiscardLogger, "web_connectivity", targets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := &model.Measurement{Input: "https://www.example.com/"}
+		if err := rec.record(m); err != nil {
+			t.Fatal(err)
+		}
+		if calls["UploadSucceeded"] != 0 || calls["UploadFailed"] != 0 || calls["Done"] != 1 {
+			t.Fatalf("unexpected calls %+v", calls)
+		}
+	})
+
+	t.Run("we encrypt the measurement files when there are recipients", func(t *testing.T) {
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		config := &ResultsDatabase{
+			Database:   newTestingDatabase(dir, map[string]int{}),
+			HomeDir:    dir,
+			Recipients: []age.Recipient{identity.Recipient()},
+		}
+		rec, err := newExperimentDatabaseRecorder(config, model.DiscardLogger, "web_connectivity", targets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.record(&model.Measurement{Input: "https://www.example.com/"}); err != nil {
+			t.Fatal(err)
+		}
+		filePath := filepath.Join(dir, "msmt.json")
+		if _, err := msmtcrypt.ReadFile(filePath); !errors.Is(err, msmtcrypt.ErrNoIdentity) {
+			t.Fatal("expected an encrypted file", err)
+		}
+		data, err := msmtcrypt.ReadFile(filePath, identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var saved model.Measurement
+		if err := json.Unmarshal(data, &saved); err != nil {
+			t.Fatal(err)
+		}
+		if saved.Input != "https://www.example.com/" {
+			t.Fatal("unexpected saved measurement input", saved.Input)
+		}
+	})
+
+	t.Run("we handle failure to create the result", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		config := &ResultsDatabase{
+			Database: &mocks.Database{
+				MockCreateResult: func(homePath string, testGroupName string, networkID int64) (*model.DatabaseResult, error) {
+					return nil, expected
+				},
+			},
+		}
+		rec, err := newExperimentDatabaseRecorder(config, model.DiscardLogger, "web_connectivity", targets)
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if rec != nil {
+			t.Fatal("expected nil recorder")
+		}
+	})
+
+	t.Run("the saver ignores database errors", func(t *testing.T) {
+		dir := t.TempDir()
+		calls := map[string]int{}
+		db := newTestingDatabase(dir, calls)
+		db.MockAddTestKeys = func(msmt *model.DatabaseMeasurement, sk model.MeasurementSummaryKeys) error {
+			return errors.New("mocked error")
+		}
+		config := &ResultsDatabase{Database: db, HomeDir: dir}
+		rec, err := newExperimentDatabaseRecorder(config, model.DiscardLogger, "web_connectivity", targets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saver := rec.wrapSaver(&mocks.Saver{
+			MockSaveMeasurement: func(m *model.Measurement) error {
+				return nil
+			},
+		})
+		if err := saver.SaveMeasurement(&model.Measurement{Input: "https://www.example.com/"}); err != nil {
+			t.Fatal(err)
+		}
+		if calls["Done"] != 0 {
+			t.Fatal("should not have marked the measurement as done")
+		}
+	})
+
+	t.Run("the saver does not record when the child saver fails", func(t *testing.T) {
+		dir := t.TempDir()
+		calls := map[string]int{}
+		config := &ResultsDatabase{Database: newTestingDatabase(dir, calls), HomeDir: dir}
+		rec, err := newExperimentDatabaseRecorder(config, model.DiscardLogger, "web_connectivity", targets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := errors.New("mocked error")
+		saver := rec.wrapSaver(&mocks.Saver{
+			MockSaveMeasurement: func(m *model.Measurement) error {
+				return expected
+			},
+		})
+		if err := saver.SaveMeasurement(&model.Measurement{}); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if calls["CreateMeasurement"] != 0 {
+			t.Fatal("should not have created a measurement")
+		}
+	})
+}
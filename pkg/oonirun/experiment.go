@@ -6,13 +6,17 @@ package oonirun
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"math/rand"
 	"sync/atomic"
 	"time"
 
+	"filippo.io/age"
 	"github.com/ooni/probe-engine/pkg/humanize"
 	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/pcapx"
+	"github.com/ooni/probe-engine/pkg/submitqueue"
 )
 
 // experimentShuffledInputs counts how many times we shuffled inputs
@@ -24,6 +28,12 @@ type Experiment struct {
 	// Annotations contains OPTIONAL Annotations for the experiment.
 	Annotations map[string]string
 
+	// Capturer is the OPTIONAL packet capturer. When set and NoJSON is false, we
+	// save the packets exchanged with each measurement's endpoints into a pcapng
+	// file next to the ReportFile. See the pcapx package for more info. Because
+	// we write such files in cleartext, we do not capture when Recipients is set.
+	Capturer *pcapx.Capturer
+
 	// ExtraOptions contains OPTIONAL extra options that modify the
 	// default experiment-specific configuration. We apply
 	// the changes described by this field after using the InitialOptions
@@ -57,13 +67,31 @@ type Experiment struct {
 	// Random OPTIONALLY indicates we should randomize inputs.
 	Random bool
 
+	// Recipients OPTIONALLY contains the recipients for whom we encrypt the
+	// measurements we save into the ReportFile. See the msmtcrypt package.
+	Recipients []age.Recipient
+
 	// ReportFile is the MANDATORY file in which to save reports, which is only
 	// used when noJSON is set to false.
 	ReportFile string
 
+	// ResultsDatabase is the OPTIONAL config for recording measurements
+	// into the results database.
+	ResultsDatabase *ResultsDatabase
+
 	// Session is the MANDATORY session.
 	Session Session
 
+	// SigningKey is the OPTIONAL key for signing the measurements we
+	// save into the ReportFile. See the msmtsign package for more info.
+	SigningKey ed25519.PrivateKey
+
+	// SubmitQueue is the OPTIONAL queue where we save the measurements
+	// we could not submit, such that we can retry submitting them later.
+	// We do not use the queue when Recipients is set, because the queue
+	// stores the measurements unencrypted.
+	SubmitQueue *submitqueue.Queue
+
 	// newExperimentBuilderFn is OPTIONAL and used for testing.
 	newExperimentBuilderFn func(experimentName string) (model.ExperimentBuilder, error)
 
@@ -138,10 +166,23 @@ func (ed *Experiment) Run(ctx context.Context) error {
 		return err
 	}
 
-	// 8. create an input processor
+	// 8. possibly record measurements into the results database
+	if ed.ResultsDatabase != nil {
+		recorder, err := newExperimentDatabaseRecorder(ed.ResultsDatabase, logger, ed.Name, targetList)
+		if err != nil {
+			return err
+		}
+		defer recorder.finish(experiment)
+		if !ed.NoCollector {
+			submitter = recorder.wrapSubmitter(submitter)
+		}
+		saver = recorder.wrapSaver(saver)
+	}
+
+	// 9. create an input processor
 	inputProcessor := ed.newInputProcessor(experiment, targetList, saver, submitter)
 
-	// 9. process input and generate measurements
+	// 10. process input and generate measurements
 	return inputProcessor.Run(ctx)
 }
 
@@ -164,10 +205,24 @@ func (ed *Experiment) newInputProcessor(experiment model.Experiment,
 	if ed.newInputProcessorFn != nil {
 		return ed.newInputProcessorFn(experiment, inputList, saver, submitter)
 	}
+	child := NewInputProcessorExperimentWrapper(experiment)
+	switch {
+	case ed.Capturer == nil || ed.NoJSON:
+		// nothing to capture or nowhere to save the packets
+	case len(ed.Recipients) > 0:
+		ed.Session.Logger().Warn("capture: not capturing packets because we would save them unencrypted")
+	default:
+		child = &experimentCaptureWrapper{
+			capturer:   ed.Capturer,
+			child:      child,
+			logger:     ed.Session.Logger(),
+			reportFile: ed.ReportFile,
+		}
+	}
 	return &InputProcessor{
 		Annotations: ed.Annotations,
 		Experiment: &experimentWrapper{
-			child:  NewInputProcessorExperimentWrapper(experiment),
+			child:  child,
 			logger: ed.Session.Logger(),
 			total:  len(inputList),
 		},
@@ -175,8 +230,10 @@ func (ed *Experiment) newInputProcessor(experiment model.Experiment,
 		MaxRuntime: time.Duration(ed.MaxRuntime) * time.Second,
 		Saver:      NewInputProcessorSaverWrapper(saver),
 		Submitter: &experimentSubmitterWrapper{
-			child:  NewInputProcessorSubmitterWrapper(submitter),
-			logger: ed.Session.Logger(),
+			child:     NewInputProcessorSubmitterWrapper(submitter),
+			logger:    ed.Session.Logger(),
+			queue:     ed.SubmitQueue,
+			encrypted: len(ed.Recipients) > 0,
 		},
 	}
 }
@@ -187,9 +244,11 @@ func (ed *Experiment) newSaver() (model.Saver, error) {
 		return ed.newSaverFn()
 	}
 	return NewSaver(SaverConfig{
-		Enabled:  !ed.NoJSON,
-		FilePath: ed.ReportFile,
-		Logger:   ed.Session.Logger(),
+		Enabled:    !ed.NoJSON,
+		FilePath:   ed.ReportFile,
+		Logger:     ed.Session.Logger(),
+		Recipients: ed.Recipients,
+		SigningKey: ed.SigningKey,
 	})
 }
 
@@ -261,12 +320,36 @@ type experimentSubmitterWrapper struct {
 
 	// logger is the logger to use
 	logger model.Logger
+
+	// queue is the OPTIONAL queue for measurements we could not submit
+	queue *submitqueue.Queue
+
+	// encrypted OPTIONALLY indicates that we encrypt the measurements at rest, in
+	// which case we do not use the queue, which stores measurements in cleartext.
+	encrypted bool
 }
 
 func (sw *experimentSubmitterWrapper) Submit(ctx context.Context, idx int, m *model.Measurement) error {
 	if err := sw.child.Submit(ctx, idx, m); err != nil {
 		sw.logger.Warnf("submitting measurement failed: %s", err.Error())
+		sw.maybeEnqueue(m, err)
 	}
 	// policy: we do not stop the loop if measurement submission fails
 	return nil
 }
+
+// maybeEnqueue adds the measurement to the submission queue, if configured.
+func (sw *experimentSubmitterWrapper) maybeEnqueue(m *model.Measurement, reason error) {
+	if sw.queue == nil {
+		return
+	}
+	if sw.encrypted {
+		sw.logger.Warn("not adding measurement to the submission queue, which would store it unencrypted")
+		return
+	}
+	if err := sw.queue.Add(m, reason); err != nil {
+		sw.logger.Warnf("cannot add measurement to the submission queue: %s", err.Error())
+		return
+	}
+	sw.logger.Info("added measurement to the submission queue; we will retry submitting it later")
+}
@@ -9,8 +9,10 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/ooni/probe-engine/pkg/engine"
+	"github.com/ooni/probe-engine/pkg/kvstore"
 	"github.com/ooni/probe-engine/pkg/mocks"
 	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/submitqueue"
 	"github.com/ooni/probe-engine/pkg/testingx"
 )
 
@@ -477,3 +479,79 @@ func TestExperimentRun(t *testing.T) {
 		})
 	}
 }
+
+func TestExperimentSubmitterWrapper(t *testing.T) {
+	newWrapper := func(queue *submitqueue.Queue) *experimentSubmitterWrapper {
+		return &experimentSubmitterWrapper{
+			child: NewInputProcessorSubmitterWrapper(&mocks.Submitter{
+				MockSubmit: func(ctx context.Context, m *model.Measurement) error {
+					return errors.New("mocked error")
+				},
+			}),
+			logger: model.DiscardLogger,
+			queue:  queue,
+		}
+	}
+
+	t.Run("without a queue we just ignore the error", func(t *testing.T) {
+		sw := newWrapper(nil)
+		if err := sw.Submit(context.Background(), 0, &model.Measurement{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("with a queue we enqueue the measurement", func(t *testing.T) {
+		queue := submitqueue.New(&kvstore.Memory{})
+		sw := newWrapper(queue)
+		if err := sw.Submit(context.Background(), 0, &model.Measurement{}); err != nil {
+			t.Fatal(err)
+		}
+		size, err := queue.Size()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != 1 {
+			t.Fatal("expected one queued measurement")
+		}
+		lastErr, err := queue.LastError()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastErr != "mocked error" {
+			t.Fatal("unexpected last error", lastErr)
+		}
+	})
+
+	t.Run("we do not store anything when we encrypt measurements", func(t *testing.T) {
+		var writes int
+		queue := submitqueue.New(&mocks.KeyValueStore{
+			MockGet: func(key string) ([]byte, error) {
+				return nil, kvstore.ErrNoSuchKey
+			},
+			MockSet: func(key string, value []byte) error {
+				writes++
+				return nil
+			},
+		})
+		sw := newWrapper(queue)
+		sw.encrypted = true
+		if err := sw.Submit(context.Background(), 0, &model.Measurement{}); err != nil {
+			t.Fatal(err)
+		}
+		if writes != 0 {
+			t.Fatal("expected no writes, got", writes)
+		}
+	})
+
+	t.Run("we handle errors when enqueueing", func(t *testing.T) {
+		queue := submitqueue.New(&mocks.KeyValueStore{
+			MockGet: func(key string) ([]byte, error) {
+				return nil, errors.New("mocked error")
+			},
+		})
+		sw := newWrapper(queue)
+		if err := sw.Submit(context.Background(), 0, &model.Measurement{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
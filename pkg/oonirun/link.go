@@ -6,9 +6,13 @@ package oonirun
 
 import (
 	"context"
+	"crypto/ed25519"
 	"strings"
 
+	"filippo.io/age"
 	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/pcapx"
+	"github.com/ooni/probe-engine/pkg/submitqueue"
 )
 
 // LinkConfig contains config for an OONI Run link. You MUST fill all the fields that
@@ -26,6 +30,9 @@ type LinkConfig struct {
 	// Annotations contains OPTIONAL Annotations for the experiment.
 	Annotations map[string]string
 
+	// Capturer is the OPTIONAL packet capturer. See [Experiment] for more info.
+	Capturer *pcapx.Capturer
+
 	// KVStore is the MANDATORY key-value store to use to keep track of
 	// OONI Run links and know when they are new or modified.
 	KVStore model.KeyValueStore
@@ -42,12 +49,28 @@ type LinkConfig struct {
 	// Random OPTIONALLY indicates we should randomize inputs.
 	Random bool
 
+	// Recipients OPTIONALLY contains the recipients for whom we encrypt the
+	// measurements we save into the ReportFile. See the msmtcrypt package.
+	Recipients []age.Recipient
+
 	// ReportFile is the MANDATORY file in which to save reports, which is only
 	// used when noJSON is set to false.
 	ReportFile string
 
+	// ResultsDatabase is the OPTIONAL config for recording measurements
+	// into the results database.
+	ResultsDatabase *ResultsDatabase
+
 	// Session is the MANDATORY Session to use.
 	Session Session
+
+	// SigningKey is the OPTIONAL key for signing the measurements we
+	// save into the ReportFile. See the msmtsign package for more info.
+	SigningKey ed25519.PrivateKey
+
+	// SubmitQueue is the OPTIONAL queue where we save the measurements
+	// we could not submit, such that we can retry submitting them later.
+	SubmitQueue *submitqueue.Queue
 }
 
 // LinkRunner knows how to run an OONI Run v1 or v2 link.
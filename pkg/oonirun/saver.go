@@ -1,10 +1,14 @@
 package oonirun
 
 import (
+	"crypto/ed25519"
 	"errors"
 
+	"filippo.io/age"
 	"github.com/ooni/probe-engine/pkg/engine"
 	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/msmtcrypt"
+	"github.com/ooni/probe-engine/pkg/msmtsign"
 )
 
 // SaverConfig is the configuration for creating a new Saver.
@@ -18,8 +22,25 @@ type SaverConfig struct {
 
 	// Logger is the logger used by the saver.
 	Logger model.Logger
+
+	// Recipients OPTIONALLY contains the recipients for whom we encrypt
+	// the measurements. When set, each line of FilePath contains an encrypted
+	// measurement rather than JSON. See the msmtcrypt package for more info.
+	Recipients []age.Recipient
+
+	// SigningKey is the OPTIONAL key for signing the measurements. When
+	// set, we append the measurements signatures to the file named like
+	// FilePath plus the [msmtsign.SignatureFileSuffix]. Because signatures
+	// cover the JSON measurement rather than the line we write, you cannot
+	// set both SigningKey and Recipients (see [ErrCannotSignEncrypted]).
+	SigningKey ed25519.PrivateKey
 }
 
+// ErrCannotSignEncrypted indicates that the configuration asks both to sign
+// and to encrypt the measurements, which we do not support because the
+// signatures would not verify against the encrypted lines we write.
+var ErrCannotSignEncrypted = errors.New("saver: cannot sign encrypted measurements")
+
 // NewSaver creates a new instance of Saver.
 func NewSaver(config SaverConfig) (model.Saver, error) {
 	if !config.Enabled {
@@ -28,11 +49,24 @@ func NewSaver(config SaverConfig) (model.Saver, error) {
 	if config.FilePath == "" {
 		return nil, errors.New("saver: passed an empty filepath")
 	}
-	return &realSaver{
+	if config.SigningKey != nil && len(config.Recipients) > 0 {
+		return nil, ErrCannotSignEncrypted
+	}
+	savefunc := engine.SaveMeasurement
+	if len(config.Recipients) > 0 {
+		savefunc = func(m *model.Measurement, filePath string) error {
+			return msmtcrypt.SaveMeasurement(m, filePath, config.Recipients...)
+		}
+	}
+	var saver model.Saver = &realSaver{
 		FilePath: config.FilePath,
 		Logger:   config.Logger,
-		savefunc: engine.SaveMeasurement,
-	}, nil
+		savefunc: savefunc,
+	}
+	if config.SigningKey != nil {
+		saver = msmtsign.NewSaver(saver, config.FilePath, config.SigningKey)
+	}
+	return saver, nil
 }
 
 type fakeSaver struct{}
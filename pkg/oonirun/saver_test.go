@@ -1,13 +1,21 @@
 package oonirun
 
 import (
+	"crypto/ed25519"
+	"encoding/json"
 	"errors"
+	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"filippo.io/age"
 	"github.com/apex/log"
 	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/kvstore"
 	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/msmtcrypt"
+	"github.com/ooni/probe-engine/pkg/msmtsign"
 	"github.com/ooni/probe-engine/pkg/runtimex"
 )
 
@@ -76,3 +84,88 @@ func TestNewSaverWithFailureWhenSaving(t *testing.T) {
 		t.Fatal("passed invalid filepath")
 	}
 }
+
+func TestNewSaverWithSigningKey(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "report.jsonl")
+	key, err := msmtsign.LoadOrCreateKey(&kvstore.Memory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saver, err := NewSaver(SaverConfig{
+		Enabled:    true,
+		FilePath:   filename,
+		Logger:     log.Log,
+		SigningKey: key,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saver.(*msmtsign.Saver); !ok {
+		t.Fatal("not the type of saver we expected")
+	}
+	if err := saver.SaveMeasurement(&model.Measurement{Input: "https://www.example.com/"}); err != nil {
+		t.Fatal(err)
+	}
+	report := runtimex.Try1(os.Open(filename))
+	defer report.Close()
+	signatures := runtimex.Try1(os.Open(filename + msmtsign.SignatureFileSuffix))
+	defer signatures.Close()
+	results, err := msmtsign.Verify(key.Public().(ed25519.PublicKey), report, signatures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Status != msmtsign.VerifyOK {
+		t.Fatal("unexpected results", results)
+	}
+}
+
+func TestNewSaverWithSigningKeyAndRecipients(t *testing.T) {
+	key, err := msmtsign.LoadOrCreateKey(&kvstore.Memory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := runtimex.Try1(age.GenerateX25519Identity())
+	saver, err := NewSaver(SaverConfig{
+		Enabled:    true,
+		FilePath:   filepath.Join(t.TempDir(), "report.jsonl"),
+		Logger:     log.Log,
+		Recipients: []age.Recipient{identity.Recipient()},
+		SigningKey: key,
+	})
+	if !errors.Is(err, ErrCannotSignEncrypted) {
+		t.Fatal("unexpected error", err)
+	}
+	if saver != nil {
+		t.Fatal("expected nil saver")
+	}
+}
+
+func TestNewSaverWithRecipients(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "report.jsonl")
+	identity := runtimex.Try1(age.GenerateX25519Identity())
+	saver, err := NewSaver(SaverConfig{
+		Enabled:    true,
+		FilePath:   filename,
+		Logger:     log.Log,
+		Recipients: []age.Recipient{identity.Recipient()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saver.SaveMeasurement(&model.Measurement{Input: "https://www.example.com/"}); err != nil {
+		t.Fatal(err)
+	}
+	report := runtimex.Try1(os.Open(filename))
+	defer report.Close()
+	data, err := io.ReadAll(msmtcrypt.NewReader(report, identity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m model.Measurement
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Input != "https://www.example.com/" {
+		t.Fatal("unexpected input", m.Input)
+	}
+}
@@ -73,6 +73,7 @@ func v1Measure(ctx context.Context, config *LinkConfig, URL string) error {
 	}
 	exp := &Experiment{
 		Annotations:            config.Annotations,
+		Capturer:               config.Capturer,
 		ExtraOptions:           nil, // no way to specify with v1 URLs
 		Inputs:                 inputs,
 		InputFilePaths:         nil,
@@ -81,8 +82,12 @@ func v1Measure(ctx context.Context, config *LinkConfig, URL string) error {
 		NoCollector:            config.NoCollector,
 		NoJSON:                 config.NoJSON,
 		Random:                 config.Random,
+		Recipients:             config.Recipients,
 		ReportFile:             config.ReportFile,
+		ResultsDatabase:        config.ResultsDatabase,
 		Session:                config.Session,
+		SigningKey:             config.SigningKey,
+		SubmitQueue:            config.SubmitQueue,
 		newExperimentBuilderFn: nil,
 		newTargetLoaderFn:      nil,
 		newSubmitterFn:         nil,
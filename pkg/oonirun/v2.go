@@ -191,6 +191,7 @@ func V2MeasureDescriptor(ctx context.Context, config *LinkConfig, desc *V2Descri
 		// construct an experiment from the current nettest
 		exp := &Experiment{
 			Annotations:            config.Annotations,
+			Capturer:               config.Capturer,
 			ExtraOptions:           make(map[string]any),
 			InitialOptions:         nettest.Options,
 			Inputs:                 nettest.Inputs,
@@ -200,8 +201,12 @@ func V2MeasureDescriptor(ctx context.Context, config *LinkConfig, desc *V2Descri
 			NoCollector:            config.NoCollector,
 			NoJSON:                 config.NoJSON,
 			Random:                 config.Random,
+			Recipients:             config.Recipients,
 			ReportFile:             config.ReportFile,
+			ResultsDatabase:        config.ResultsDatabase,
 			Session:                config.Session,
+			SigningKey:             config.SigningKey,
+			SubmitQueue:            config.SubmitQueue,
 			newExperimentBuilderFn: nil,
 			newTargetLoaderFn:      nil,
 			newSubmitterFn:         nil,
@@ -0,0 +1,181 @@
+package oonirun
+
+//
+// Validating OONI Run v2 descriptors
+//
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ooni/probe-engine/pkg/experimentname"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/registry"
+)
+
+// V2LintSeverity is the severity of a [*V2LintIssue].
+type V2LintSeverity string
+
+const (
+	// V2LintError indicates an issue that prevents running the descriptor
+	// or would cause one or more nettests to fail at run time.
+	V2LintError = V2LintSeverity("error")
+
+	// V2LintWarning indicates an issue that would not prevent running the
+	// descriptor but is likely a mistake.
+	V2LintWarning = V2LintSeverity("warning")
+)
+
+// V2LintIssue is an issue we found inside a [*V2Descriptor].
+type V2LintIssue struct {
+	// Severity is the issue severity.
+	Severity V2LintSeverity
+
+	// Nettest is the index of the nettest containing the
+	// issue or -1 for issues concerning the whole descriptor.
+	Nettest int
+
+	// TestName is the name of the nettest containing the issue.
+	TestName string
+
+	// Message describes the issue.
+	Message string
+}
+
+// String implements fmt.Stringer.
+func (issue *V2LintIssue) String() string {
+	if issue.Nettest < 0 {
+		return fmt.Sprintf("%s: %s", issue.Severity, issue.Message)
+	}
+	return fmt.Sprintf("%s: nettests[%d] (%s): %s", issue.Severity, issue.Nettest, issue.TestName, issue.Message)
+}
+
+// V2LintHasErrors returns whether any of the given issues is a [V2LintError].
+func V2LintHasErrors(issues []*V2LintIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == V2LintError {
+			return true
+		}
+	}
+	return false
+}
+
+// V2LintDescriptorJSON parses the given serialized descriptor and checks it using
+// [V2LintDescriptor]. Unlike the code running descriptors, we flag unknown fields
+// as errors. The returned descriptor is nil if we cannot parse the JSON.
+func V2LintDescriptorJSON(data []byte) (*V2Descriptor, []*V2LintIssue) {
+	var desc V2Descriptor
+	if err := json.Unmarshal(data, &desc); err != nil {
+		return nil, []*V2LintIssue{v2LintIssue(V2LintError, -1, "", "cannot parse descriptor: %s", err.Error())}
+	}
+	var issues []*V2LintIssue
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&V2Descriptor{}); err != nil {
+		issues = append(issues, v2LintIssue(V2LintError, -1, "", "invalid descriptor: %s", err.Error()))
+	}
+	return &desc, append(issues, V2LintDescriptor(&desc)...)
+}
+
+// V2LintDescriptor checks the given descriptor against the experiments registry and
+// returns the issues we found. We check for unknown experiments, unknown options,
+// options with the wrong type, and inputs not matching the experiment's input policy.
+func V2LintDescriptor(desc *V2Descriptor) (issues []*V2LintIssue) {
+	if desc == nil {
+		return []*V2LintIssue{v2LintIssue(V2LintError, -1, "", "%s", ErrNilDescriptor.Error())}
+	}
+	if desc.Name == "" {
+		issues = append(issues, v2LintIssue(V2LintWarning, -1, "", "missing descriptor name"))
+	}
+	if desc.Description == "" {
+		issues = append(issues, v2LintIssue(V2LintWarning, -1, "", "missing descriptor description"))
+	}
+	if desc.Author == "" {
+		issues = append(issues, v2LintIssue(V2LintWarning, -1, "", "missing descriptor author"))
+	}
+	if len(desc.Nettests) <= 0 {
+		issues = append(issues, v2LintIssue(V2LintError, -1, "", "the descriptor does not contain any nettest"))
+	}
+	for idx := range desc.Nettests {
+		issues = append(issues, v2LintNettest(idx, &desc.Nettests[idx])...)
+	}
+	return
+}
+
+// v2LintNettest checks the given nettest.
+func v2LintNettest(idx int, nettest *V2Nettest) (issues []*V2LintIssue) {
+	name := nettest.TestName
+	if name == "" {
+		return []*V2LintIssue{v2LintIssue(V2LintError, idx, name, "missing test_name")}
+	}
+	canonicalName := experimentname.Canonicalize(name)
+	factoryFunc := registry.AllExperiments[canonicalName]
+	if factoryFunc == nil {
+		return []*V2LintIssue{v2LintIssue(V2LintError, idx, name, "%s: %s", registry.ErrNoSuchExperiment.Error(), name)}
+	}
+	if canonicalName != name {
+		issues = append(issues, v2LintIssue(V2LintWarning, idx, name, "please use the canonical name: %s", canonicalName))
+	}
+	factory := factoryFunc()
+	if !factory.EnabledByDefault() {
+		issues = append(issues, v2LintIssue(
+			V2LintWarning, idx, name, "the experiment only runs when the check-in API enables it"))
+	}
+
+	if err := factory.ValidateOptionsJSON(nettest.Options); err != nil {
+		issues = append(issues, v2LintIssue(V2LintError, idx, name, "invalid options: %s", err.Error()))
+	}
+
+	switch policy := factory.InputPolicy(); {
+	case policy == model.InputStrictlyRequired && len(nettest.Inputs) <= 0:
+		issues = append(issues, v2LintIssue(V2LintError, idx, name, "the experiment requires inputs"))
+	case policy == model.InputNone && len(nettest.Inputs) > 0:
+		issues = append(issues, v2LintIssue(V2LintError, idx, name, "the experiment does not take any input"))
+	}
+
+	seen := make(map[string]bool)
+	for _, input := range nettest.Inputs {
+		switch {
+		case input == "":
+			issues = append(issues, v2LintIssue(V2LintWarning, idx, name, "empty input"))
+		case seen[input]:
+			issues = append(issues, v2LintIssue(V2LintWarning, idx, name, "duplicate input: %s", input))
+		}
+		seen[input] = true
+	}
+	return
+}
+
+// v2LintIssue creates a new [*V2LintIssue].
+func v2LintIssue(severity V2LintSeverity, idx int, name, format string, v ...any) *V2LintIssue {
+	return &V2LintIssue{
+		Severity: severity,
+		Nettest:  idx,
+		TestName: name,
+		Message:  fmt.Sprintf(format, v...),
+	}
+}
+
+// V2DiffWithCache returns the diff between the descriptor cached for the given URL, if
+// any, and the given descriptor, or an empty string when they are equal. The found return
+// value indicates whether we have a cached descriptor for the given URL.
+func V2DiffWithCache(kvStore model.KeyValueStore, URL string, desc *V2Descriptor) (diff string, found bool, err error) {
+	cache, err := v2DescriptorCacheLoad(kvStore)
+	if err != nil {
+		return "", false, err
+	}
+	oldValue, found := cache.Entries[URL]
+	oldData, err := json.Marshal(oldValue)
+	if err != nil {
+		return "", false, err
+	}
+	newData, err := json.Marshal(desc)
+	if err != nil {
+		return "", false, err
+	}
+	if bytes.Equal(oldData, newData) {
+		return "", found, nil
+	}
+	return v2DescriptorDiff(oldValue, desc, URL), found, nil
+}
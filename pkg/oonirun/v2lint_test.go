@@ -0,0 +1,139 @@
+package oonirun
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/kvstore"
+)
+
+func TestV2LintDescriptorJSON(t *testing.T) {
+	// testcase is a test case for this function.
+	type testcase struct {
+		// name is the name of the test case
+		name string
+
+		// descriptor is the serialized descriptor
+		descriptor string
+
+		// expect contains the expected issues
+		expect []string
+	}
+
+	cases := []testcase{{
+		name: "with a valid descriptor",
+		descriptor: `{"name": "n", "description": "d", "author": "a", "nettests": [
+			{"test_name": "example", "inputs": [], "options": {"SleepTime": 1}},
+			{"test_name": "simplequicping", "inputs": ["https://www.example.com/"], "options": null}
+		]}`,
+		expect: nil,
+	}, {
+		name:       "with invalid JSON",
+		descriptor: `{`,
+		expect:     []string{"error: cannot parse descriptor: unexpected end of JSON input"},
+	}, {
+		name:       "with an empty descriptor",
+		descriptor: `{"nettest": []}`,
+		expect: []string{
+			`error: invalid descriptor: json: unknown field "nettest"`,
+			"warning: missing descriptor name",
+			"warning: missing descriptor description",
+			"warning: missing descriptor author",
+			"error: the descriptor does not contain any nettest",
+		},
+	}, {
+		name: "with invalid nettests",
+		descriptor: `{"name": "n", "description": "d", "author": "a", "nettests": [
+			{"test_name": ""},
+			{"test_name": "antani"},
+			{"test_name": "Example", "inputs": ["x"], "options": {"SleepTme": 1}},
+			{"test_name": "example", "options": {"SleepTime": "1"}},
+			{"test_name": "simplequicping"},
+			{"test_name": "vanilla_tor"},
+			{"test_name": "dnscheck", "inputs": ["", "dot://1.1.1.1", "dot://1.1.1.1"]}
+		]}`,
+		expect: []string{
+			"error: nettests[0] (): missing test_name",
+			"error: nettests[1] (antani): no such experiment: antani",
+			"warning: nettests[2] (Example): please use the canonical name: example",
+			`error: nettests[2] (Example): invalid options: json: unknown field "SleepTme"`,
+			"error: nettests[2] (Example): the experiment does not take any input",
+			"error: nettests[3] (example): invalid options: json: cannot unmarshal string into Go struct field Config.SleepTime of type int64",
+			"error: nettests[4] (simplequicping): the experiment requires inputs",
+			"warning: nettests[5] (vanilla_tor): the experiment only runs when the check-in API enables it",
+			"warning: nettests[6] (dnscheck): empty input",
+			"warning: nettests[6] (dnscheck): duplicate input: dot://1.1.1.1",
+		},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, issues := V2LintDescriptorJSON([]byte(tc.descriptor))
+			var got []string
+			for _, issue := range issues {
+				got = append(got, issue.String())
+			}
+			if diff := cmp.Diff(tc.expect, got); diff != "" {
+				t.Fatal(diff)
+			}
+			expectErrors := strings.Contains(strings.Join(tc.expect, "\n"), "error:")
+			if V2LintHasErrors(issues) != expectErrors {
+				t.Fatal("unexpected V2LintHasErrors result")
+			}
+		})
+	}
+
+	t.Run("with a nil descriptor", func(t *testing.T) {
+		issues := V2LintDescriptor(nil)
+		if len(issues) != 1 || !V2LintHasErrors(issues) {
+			t.Fatal("unexpected issues", issues)
+		}
+	})
+}
+
+func TestV2DiffWithCache(t *testing.T) {
+	const URL = "https://example.com/descriptor.json"
+	desc := &V2Descriptor{Name: "n", Nettests: []V2Nettest{{TestName: "example"}}}
+	kvs := &kvstore.Memory{}
+
+	t.Run("when the descriptor is not cached", func(t *testing.T) {
+		diff, found, err := V2DiffWithCache(kvs, URL, desc)
+		if err != nil || found || !strings.Contains(diff, `+  "name": "n",`) {
+			t.Fatal("unexpected result", diff, found, err)
+		}
+	})
+
+	cache, err := v2DescriptorCacheLoad(kvs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Update(kvs, URL, desc); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("when the cached descriptor is equal", func(t *testing.T) {
+		diff, found, err := V2DiffWithCache(kvs, URL, desc)
+		if err != nil || !found || diff != "" {
+			t.Fatal("unexpected result", diff, found, err)
+		}
+	})
+
+	t.Run("when the cached descriptor is different", func(t *testing.T) {
+		changed := &V2Descriptor{Name: "m", Nettests: desc.Nettests}
+		diff, found, err := V2DiffWithCache(kvs, URL, changed)
+		if err != nil || !found || !strings.Contains(diff, `-  "name": "n",`) {
+			t.Fatal("unexpected result", diff, found, err)
+		}
+	})
+
+	t.Run("when we cannot load the cache", func(t *testing.T) {
+		broken := &kvstore.Memory{}
+		if err := broken.Set(v2DescriptorCacheKey, []byte(`{`)); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := V2DiffWithCache(broken, URL, desc); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package pcapx
+
+//
+// Buffering the packets captured during a measurement
+//
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/google/gopacket/layers"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// CapturerMaxBytes is the maximum number of bytes that a [Capturer] buffers
+// between Start and Stop. We drop the packets exceeding this limit.
+//
+// Because we only buffer the packets exchanged with the [*Endpoints] passed
+// to Start, we do not expect to reach this limit in practice.
+const CapturerMaxBytes = 1 << 26
+
+// Capturer reads packets from a [Source] in the background and buffers the
+// packets exchanged with the given [*Endpoints] between calls to Start and Stop. The zero value is invalid;
+// please, use [NewCapturer] to construct.
+type Capturer struct {
+	closeOnce sync.Once
+	endpoints *Endpoints
+	joined    chan any
+	logger    model.Logger
+	mu        sync.Mutex
+	packets   []*Packet
+	recording bool
+	size      int
+	source    Source
+}
+
+// NewCapturer creates a new [Capturer] taking ownership of the given [Source]
+// and starts reading packets in the background. Call Close when done.
+func NewCapturer(source Source, logger model.Logger) *Capturer {
+	c := &Capturer{
+		closeOnce: sync.Once{},
+		endpoints: nil,
+		joined:    make(chan any),
+		logger:    logger,
+		mu:        sync.Mutex{},
+		packets:   nil,
+		recording: false,
+		size:      0,
+		source:    source,
+	}
+	go c.loop()
+	return c
+}
+
+// LinkType returns the link type of the captured packets.
+func (c *Capturer) LinkType() layers.LinkType {
+	return c.source.LinkType()
+}
+
+// Start discards the packets buffered so far and starts buffering the packets
+// whose source or destination address belongs to the given [*Endpoints]. Since
+// we check each packet as soon as we read it, you should add an endpoint to the
+// set before communicating with it (see [*Endpoints.WrapUnderlyingNetwork]).
+func (c *Capturer) Start(endpoints *Endpoints) {
+	defer c.mu.Unlock()
+	c.mu.Lock()
+	c.packets, c.size, c.recording, c.endpoints = nil, 0, true, endpoints
+}
+
+// Stop stops buffering packets and returns the buffered packets.
+func (c *Capturer) Stop() []*Packet {
+	defer c.mu.Unlock()
+	c.mu.Lock()
+	packets := c.packets
+	c.packets, c.size, c.recording, c.endpoints = nil, 0, false, nil
+	return packets
+}
+
+// Close closes the underlying [Source] and waits for the background
+// goroutine to terminate. This method is idempotent.
+func (c *Capturer) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.source.Close()
+		<-c.joined
+	})
+	return err
+}
+
+// loop reads packets until the [Source] is closed.
+func (c *Capturer) loop() {
+	defer close(c.joined)
+	for {
+		packet, err := c.source.ReadPacket()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				c.logger.Warnf("pcapx: cannot read packet: %s", err.Error())
+			}
+			return
+		}
+		c.add(packet)
+	}
+}
+
+// add buffers the given packet if we are recording and it matches the endpoints.
+func (c *Capturer) add(packet *Packet) {
+	defer c.mu.Unlock()
+	c.mu.Lock()
+	if !c.recording || c.size+len(packet.Data) > CapturerMaxBytes {
+		return
+	}
+	if !packetMatches(c.source.LinkType(), packet, c.endpoints.Contains) {
+		return
+	}
+	c.packets = append(c.packets, packet)
+	c.size += len(packet.Data)
+}
@@ -0,0 +1,179 @@
+package pcapx
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// syncSource is a [Source] where the test delivers packets synchronously.
+type syncSource struct {
+	done    chan any
+	packets chan *Packet
+}
+
+func newSyncSource() *syncSource {
+	return &syncSource{
+		done:    make(chan any),
+		packets: make(chan *Packet),
+	}
+}
+
+// deliver returns once the capturer has processed the given packet.
+func (s *syncSource) deliver(packet *Packet) {
+	s.packets <- packet
+	// the capturer processes packets sequentially, so when it accepts
+	// the next packet we know it has processed the previous one
+	s.packets <- &Packet{}
+}
+
+// nonEmpty returns the non-empty packets, thus excluding the sentinels
+// that deliver uses for synchronizing with the capturer.
+func nonEmpty(packets []*Packet) (out []*Packet) {
+	for _, packet := range packets {
+		if len(packet.Data) > 0 {
+			out = append(out, packet)
+		}
+	}
+	return
+}
+
+func (s *syncSource) ReadPacket() (*Packet, error) {
+	select {
+	case <-s.done:
+		return nil, net.ErrClosed
+	case packet := <-s.packets:
+		return packet, nil
+	}
+}
+
+func (s *syncSource) LinkType() layers.LinkType {
+	return layers.LinkTypeRaw
+}
+
+func (s *syncSource) Close() error {
+	close(s.done)
+	return nil
+}
+
+func TestCapturer(t *testing.T) {
+	t.Run("we only buffer packets between Start and Stop", func(t *testing.T) {
+		source := newSyncSource()
+		capturer := NewCapturer(source, model.DiscardLogger)
+		defer capturer.Close()
+
+		endpoints := NewEndpoints()
+		endpoints.Add("8.8.8.8")
+		endpoints.Add("8.8.4.4")
+
+		source.deliver(newUDPPacket(t, "10.0.0.1", "8.8.8.8"))
+		capturer.Start(endpoints)
+		source.deliver(newUDPPacket(t, "10.0.0.1", "8.8.4.4"))
+		packets := nonEmpty(capturer.Stop())
+		source.deliver(newUDPPacket(t, "10.0.0.1", "8.8.8.8"))
+
+		if len(packets) != 1 {
+			t.Fatal("expected one packet, got", len(packets))
+		}
+		if capturer.LinkType() != layers.LinkTypeRaw {
+			t.Fatal("unexpected link type")
+		}
+		if packets := nonEmpty(capturer.Stop()); len(packets) != 0 {
+			t.Fatal("expected no packets")
+		}
+	})
+
+	t.Run("we only buffer packets exchanged with the endpoints", func(t *testing.T) {
+		source := newSyncSource()
+		capturer := NewCapturer(source, model.DiscardLogger)
+		defer capturer.Close()
+
+		endpoints := NewEndpoints()
+		capturer.Start(endpoints)
+		source.deliver(newUDPPacket(t, "10.0.0.1", "8.8.8.8"))
+		endpoints.Add("8.8.8.8:53")
+		source.deliver(newUDPPacket(t, "10.0.0.1", "8.8.8.8"))
+		source.deliver(newUDPPacket(t, "8.8.8.8", "10.0.0.1"))
+		source.deliver(newUDPPacket(t, "10.0.0.1", "1.1.1.1"))
+		source.deliver(&Packet{Data: []byte{0xff, 0xff}}) // not a valid IP packet
+		packets := nonEmpty(capturer.Stop())
+
+		if len(packets) != 2 {
+			t.Fatal("expected two packets, got", len(packets))
+		}
+	})
+
+	t.Run("we drop packets exceeding CapturerMaxBytes", func(t *testing.T) {
+		source := newSyncSource()
+		capturer := NewCapturer(source, model.DiscardLogger)
+		defer capturer.Close()
+
+		endpoints := NewEndpoints()
+		endpoints.Add("8.8.8.8")
+		big := newUDPPacket(t, "10.0.0.1", "8.8.8.8")
+		big.Data = append(big.Data, make([]byte, CapturerMaxBytes-len(big.Data))...)
+
+		capturer.Start(endpoints)
+		source.deliver(big)
+		source.deliver(newUDPPacket(t, "10.0.0.1", "8.8.8.8"))
+		packets := nonEmpty(capturer.Stop())
+
+		if len(packets) != 1 || len(packets[0].Data) != CapturerMaxBytes {
+			t.Fatal("expected just the first packet")
+		}
+	})
+
+	t.Run("we warn on unexpected read errors", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		var warnings atomic.Int64
+		logger := &mocks.Logger{
+			MockWarnf: func(format string, v ...any) {
+				warnings.Add(1)
+			},
+		}
+		source := &mockableSource{
+			MockReadPacket: func() (*Packet, error) {
+				return nil, expected
+			},
+		}
+		capturer := NewCapturer(source, logger)
+		<-capturer.joined
+		if err := capturer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if warnings.Load() != 1 {
+			t.Fatal("expected one warning")
+		}
+	})
+
+	t.Run("Close is idempotent", func(t *testing.T) {
+		capturer := NewCapturer(newSyncSource(), model.DiscardLogger)
+		for idx := 0; idx < 4; idx++ {
+			if err := capturer.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+// mockableSource is a mockable [Source].
+type mockableSource struct {
+	MockReadPacket func() (*Packet, error)
+}
+
+func (s *mockableSource) ReadPacket() (*Packet, error) {
+	return s.MockReadPacket()
+}
+
+func (s *mockableSource) LinkType() layers.LinkType {
+	return layers.LinkTypeRaw
+}
+
+func (s *mockableSource) Close() error {
+	return nil
+}
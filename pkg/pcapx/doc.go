@@ -0,0 +1,18 @@
+// Package pcapx captures the packets exchanged during a measurement and
+// saves them using the pcapng format.
+//
+// A [Source] provides captured packets. On Linux, [NewSystemSource] uses an
+// AF_PACKET socket, which requires CAP_NET_RAW. On other systems, or when we
+// lack the required privileges, [NewSystemSource] fails and the caller should
+// keep measuring without capturing packets. The [NetemSource] allows to
+// capture the packets flowing through [github.com/ooni/netem] userspace
+// network stacks, which is useful for writing tests.
+//
+// The [Capturer] reads from a [Source] in the background and buffers the
+// packets received between calls to [*Capturer.Start] and [*Capturer.Stop]
+// that we exchange with the given [Endpoints]. To learn the endpoints while
+// measuring, use [*Endpoints.WrapUnderlyingNetwork].
+//
+// [WritePCAPNG] writes the packets exchanged with the given endpoints and
+// [MeasurementEndpoints] returns the endpoints of a measurement.
+package pcapx
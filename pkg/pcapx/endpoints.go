@@ -0,0 +1,102 @@
+package pcapx
+
+//
+// Learning the measurement endpoints while measuring
+//
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sort"
+	"sync"
+
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// Endpoints is a goroutine-safe set of the IP addresses we communicate
+// with while measuring. The zero value is invalid; please, use [NewEndpoints].
+type Endpoints struct {
+	addrs map[netip.Addr]bool
+	mu    sync.Mutex
+}
+
+// NewEndpoints creates a new empty [*Endpoints].
+func NewEndpoints() *Endpoints {
+	return &Endpoints{
+		addrs: map[netip.Addr]bool{},
+		mu:    sync.Mutex{},
+	}
+}
+
+// Add adds the IP address of the given endpoint, which is either an IP address
+// or an IP address and a port. We ignore endpoints containing domain names.
+func (e *Endpoints) Add(endpoint string) {
+	if host, _, err := net.SplitHostPort(endpoint); err == nil {
+		endpoint = host
+	}
+	addr, err := netip.ParseAddr(endpoint)
+	if err != nil {
+		return
+	}
+	defer e.mu.Unlock()
+	e.mu.Lock()
+	e.addrs[addr.WithZone("").Unmap()] = true
+}
+
+// Contains returns whether the set contains the given IP address.
+func (e *Endpoints) Contains(addr netip.Addr) bool {
+	defer e.mu.Unlock()
+	e.mu.Lock()
+	return e.addrs[addr.WithZone("").Unmap()]
+}
+
+// sorted returns the sorted list of the IP addresses inside the set.
+func (e *Endpoints) sorted() (out []string) {
+	defer e.mu.Unlock()
+	e.mu.Lock()
+	for addr := range e.addrs {
+		out = append(out, addr.String())
+	}
+	sort.Strings(out)
+	return
+}
+
+// WrapUnderlyingNetwork returns a [model.UnderlyingNetwork] that adds to the set the
+// endpoints we dial or send datagrams to before using the given [model.UnderlyingNetwork].
+func (e *Endpoints) WrapUnderlyingNetwork(un model.UnderlyingNetwork) model.UnderlyingNetwork {
+	return &endpointsUnderlyingNetwork{UnderlyingNetwork: un, endpoints: e}
+}
+
+// endpointsUnderlyingNetwork is the [model.UnderlyingNetwork] returned by WrapUnderlyingNetwork.
+type endpointsUnderlyingNetwork struct {
+	model.UnderlyingNetwork
+	endpoints *Endpoints
+}
+
+// DialContext implements model.UnderlyingNetwork.
+func (un *endpointsUnderlyingNetwork) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	un.endpoints.Add(address)
+	return un.UnderlyingNetwork.DialContext(ctx, network, address)
+}
+
+// ListenUDP implements model.UnderlyingNetwork.
+func (un *endpointsUnderlyingNetwork) ListenUDP(network string, addr *net.UDPAddr) (model.UDPLikeConn, error) {
+	pconn, err := un.UnderlyingNetwork.ListenUDP(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &endpointsUDPLikeConn{UDPLikeConn: pconn, endpoints: un.endpoints}, nil
+}
+
+// endpointsUDPLikeConn is the [model.UDPLikeConn] returned by endpointsUnderlyingNetwork.
+type endpointsUDPLikeConn struct {
+	model.UDPLikeConn
+	endpoints *Endpoints
+}
+
+// WriteTo implements model.UDPLikeConn.
+func (c *endpointsUDPLikeConn) WriteTo(data []byte, addr net.Addr) (int, error) {
+	c.endpoints.Add(addr.String())
+	return c.UDPLikeConn.WriteTo(data, addr)
+}
@@ -0,0 +1,98 @@
+package pcapx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+func TestEndpoints(t *testing.T) {
+	t.Run("Add and Contains", func(t *testing.T) {
+		endpoints := NewEndpoints()
+		for _, endpoint := range []string{
+			"8.8.8.8",
+			"8.8.4.4:53",
+			"[2001:4860:4860::8888]:443",
+			"::ffff:1.1.1.1",
+			"fe80::1%eth0",
+			"dns.google:443",
+			"",
+		} {
+			endpoints.Add(endpoint)
+		}
+
+		expect := []string{"1.1.1.1", "2001:4860:4860::8888", "8.8.4.4", "8.8.8.8", "fe80::1"}
+		if diff := cmp.Diff(expect, endpoints.sorted()); diff != "" {
+			t.Fatal(diff)
+		}
+		if !endpoints.Contains(netip.MustParseAddr("::ffff:8.8.8.8")) {
+			t.Fatal("expected to contain 8.8.8.8")
+		}
+		if endpoints.Contains(netip.MustParseAddr("9.9.9.9")) {
+			t.Fatal("did not expect to contain 9.9.9.9")
+		}
+	})
+
+	t.Run("WrapUnderlyingNetwork", func(t *testing.T) {
+		t.Run("DialContext adds the endpoint", func(t *testing.T) {
+			endpoints := NewEndpoints()
+			un := endpoints.WrapUnderlyingNetwork(&mocks.UnderlyingNetwork{
+				MockDialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return &mocks.Conn{}, nil
+				},
+			})
+			if _, err := un.DialContext(context.Background(), "tcp", "8.8.8.8:443"); err != nil {
+				t.Fatal(err)
+			}
+			if !endpoints.Contains(netip.MustParseAddr("8.8.8.8")) {
+				t.Fatal("expected to contain 8.8.8.8")
+			}
+		})
+
+		t.Run("WriteTo adds the endpoint", func(t *testing.T) {
+			endpoints := NewEndpoints()
+			un := endpoints.WrapUnderlyingNetwork(&mocks.UnderlyingNetwork{
+				MockListenUDP: func(network string, addr *net.UDPAddr) (model.UDPLikeConn, error) {
+					return &mocks.UDPLikeConn{
+						MockWriteTo: func(p []byte, addr net.Addr) (int, error) {
+							return len(p), nil
+						},
+					}, nil
+				},
+			})
+			pconn, err := un.ListenUDP("udp", &net.UDPAddr{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr := &net.UDPAddr{IP: net.ParseIP("8.8.8.8"), Port: 443}
+			if _, err := pconn.WriteTo([]byte("abc"), addr); err != nil {
+				t.Fatal(err)
+			}
+			if !endpoints.Contains(netip.MustParseAddr("8.8.8.8")) {
+				t.Fatal("expected to contain 8.8.8.8")
+			}
+		})
+
+		t.Run("ListenUDP failure", func(t *testing.T) {
+			expected := errors.New("mocked error")
+			un := NewEndpoints().WrapUnderlyingNetwork(&mocks.UnderlyingNetwork{
+				MockListenUDP: func(network string, addr *net.UDPAddr) (model.UDPLikeConn, error) {
+					return nil, expected
+				},
+			})
+			pconn, err := un.ListenUDP("udp", &net.UDPAddr{})
+			if !errors.Is(err, expected) {
+				t.Fatal("unexpected error", err)
+			}
+			if pconn != nil {
+				t.Fatal("expected nil conn")
+			}
+		})
+	})
+}
@@ -0,0 +1,110 @@
+package pcapx
+
+//
+// Capturing packets using netem
+//
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/ooni/netem"
+)
+
+// netemSourceBufferSize is the number of packets that a [NetemSource] buffers
+// before it starts dropping them because nobody is reading.
+const netemSourceBufferSize = 4096
+
+// NetemSource is a [Source] capturing the packets flowing through the NICs
+// wrapped using its WrapNIC method. The zero value is invalid; please, use
+// [NewNetemSource] to construct. You should register this struct as a
+// [netem.LinkNICWrapper] inside a [netem.LinkConfig].
+type NetemSource struct {
+	closeOnce sync.Once
+	done      chan any
+	packets   chan *Packet
+}
+
+// NewNetemSource creates a new [NetemSource].
+func NewNetemSource() *NetemSource {
+	return &NetemSource{
+		closeOnce: sync.Once{},
+		done:      make(chan any),
+		packets:   make(chan *Packet, netemSourceBufferSize),
+	}
+}
+
+var (
+	_ Source               = &NetemSource{}
+	_ netem.LinkNICWrapper = &NetemSource{}
+)
+
+// WrapNIC implements netem.LinkNICWrapper.
+func (s *NetemSource) WrapNIC(nic netem.NIC) netem.NIC {
+	return &netemSourceNIC{NIC: nic, s: s}
+}
+
+// ReadPacket implements Source.
+func (s *NetemSource) ReadPacket() (*Packet, error) {
+	select {
+	case <-s.done:
+		return nil, net.ErrClosed
+	case packet := <-s.packets:
+		return packet, nil
+	}
+}
+
+// LinkType implements Source.
+func (s *NetemSource) LinkType() layers.LinkType {
+	return layers.LinkTypeRaw
+}
+
+// Close implements Source.
+func (s *NetemSource) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// deliver delivers a copy of the given packet to the reader.
+func (s *NetemSource) deliver(payload []byte) {
+	packet := &Packet{
+		CaptureInfo: gopacket.CaptureInfo{
+			Timestamp:     time.Now(),
+			CaptureLength: len(payload),
+			Length:        len(payload),
+		},
+		Data: append([]byte{}, payload...),
+	}
+	select {
+	case s.packets <- packet:
+	default:
+		// just drop from the capture
+	}
+}
+
+// netemSourceNIC is the [netem.NIC] returned by [*NetemSource.WrapNIC].
+type netemSourceNIC struct {
+	netem.NIC
+	s *NetemSource
+}
+
+// ReadFrameNonblocking implements netem.NIC.
+func (n *netemSourceNIC) ReadFrameNonblocking() (*netem.Frame, error) {
+	frame, err := n.NIC.ReadFrameNonblocking()
+	if err != nil {
+		return nil, err
+	}
+	n.s.deliver(frame.Payload)
+	return frame, nil
+}
+
+// WriteFrame implements netem.NIC.
+func (n *netemSourceNIC) WriteFrame(frame *netem.Frame) error {
+	n.s.deliver(frame.Payload)
+	return n.NIC.WriteFrame(frame)
+}
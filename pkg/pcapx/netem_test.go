@@ -0,0 +1,87 @@
+package pcapx
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netemx"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+func TestNetemSource(t *testing.T) {
+	t.Run("we capture the packets flowing through netem", func(t *testing.T) {
+		source := NewNetemSource()
+		capturer := NewCapturer(source, model.DiscardLogger)
+		defer capturer.Close()
+
+		env := netemx.MustNewQAEnv(
+			netemx.QAEnvOptionNetStack(
+				"8.8.8.8",
+				&netemx.HTTPSecureServerFactory{
+					Factory:          netemx.ExampleWebPageHandlerFactory(),
+					Ports:            []int{443},
+					ServerNameMain:   "quad8.com",
+					ServerNameExtras: []string{},
+				},
+			),
+			netemx.QAEnvOptionClientNICWrapper(source),
+		)
+		defer env.Close()
+
+		env.AddRecordToAllResolvers("quad8.com", "", "8.8.8.8")
+
+		endpoints := NewEndpoints()
+		capturer.Start(endpoints)
+		env.Do(func() {
+			underlying := (&netxlite.MaybeCustomUnderlyingNetwork{}).Get()
+			netxlite.WithCustomTProxy(endpoints.WrapUnderlyingNetwork(underlying), func() {
+				client := netxlite.NewHTTPClientStdlib(model.DiscardLogger)
+				req, err := http.NewRequest("GET", "https://quad8.com/", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				client.CloseIdleConnections()
+			})
+		})
+		packets := capturer.Stop()
+
+		var buffer bytes.Buffer
+		count, err := WritePCAPNG(&buffer, capturer.LinkType(), packets, []string{"8.8.8.8"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count <= 0 {
+			t.Fatal("expected to see packets exchanged with 8.8.8.8")
+		}
+		if count != len(packets) {
+			t.Fatal("expected to only capture the packets exchanged with 8.8.8.8")
+		}
+	})
+
+	t.Run("ReadPacket returns net.ErrClosed after Close", func(t *testing.T) {
+		source := NewNetemSource()
+		source.Close()
+		source.Close() // idempotent
+		if _, err := source.ReadPacket(); err != net.ErrClosed {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("we drop packets when nobody is reading", func(t *testing.T) {
+		source := NewNetemSource()
+		for idx := 0; idx < netemSourceBufferSize+1; idx++ {
+			source.deliver([]byte{4})
+		}
+		if len(source.packets) != netemSourceBufferSize {
+			t.Fatal("unexpected number of buffered packets")
+		}
+	})
+}
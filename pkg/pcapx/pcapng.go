@@ -0,0 +1,114 @@
+package pcapx
+
+//
+// Writing the packets exchanged with the measurement endpoints
+//
+
+import (
+	"encoding/json"
+	"io"
+	"net/netip"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// WritePCAPNG writes into w, using the pcapng format, the packets whose source or
+// destination address is one of the given endpoints' IP addresses. It returns the
+// number of packets written. We skip the packets we cannot parse.
+func WritePCAPNG(w io.Writer, linkType layers.LinkType, packets []*Packet, endpoints []string) (int, error) {
+	addrs := make(map[netip.Addr]bool)
+	for _, endpoint := range endpoints {
+		if addr, err := netip.ParseAddr(endpoint); err == nil {
+			addrs[addr.Unmap()] = true
+		}
+	}
+	writer, err := pcapgo.NewNgWriter(w, linkType)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for _, packet := range packets {
+		if !packetMatches(linkType, packet, func(addr netip.Addr) bool { return addrs[addr.Unmap()] }) {
+			continue
+		}
+		if err := writer.WritePacket(packet.CaptureInfo, packet.Data); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, writer.Flush()
+}
+
+// packetMatches returns whether the packet source or destination address is one of the given addresses.
+func packetMatches(linkType layers.LinkType, packet *Packet, contains func(addr netip.Addr) bool) bool {
+	decoded := gopacket.NewPacket(packet.Data, linkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	network := decoded.NetworkLayer()
+	if network == nil {
+		return false
+	}
+	flow := network.NetworkFlow()
+	for _, endpoint := range []gopacket.Endpoint{flow.Src(), flow.Dst()} {
+		if addr, good := netip.AddrFromSlice(endpoint.Raw()); good && contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// measurementEndpointsTestKeys contains the test keys fields from which
+// [MeasurementEndpoints] reads the measurement endpoints.
+type measurementEndpointsTestKeys struct {
+	NetworkEvents []struct {
+		Address string `json:"address"`
+	} `json:"network_events"`
+
+	Queries []struct {
+		ResolverAddress string `json:"resolver_address"`
+	} `json:"queries"`
+
+	QUICHandshakes []struct {
+		Address string `json:"address"`
+	} `json:"quic_handshakes"`
+
+	TCPConnect []struct {
+		IP string `json:"ip"`
+	} `json:"tcp_connect"`
+
+	TLSHandshakes []struct {
+		Address string `json:"address"`
+	} `json:"tls_handshakes"`
+}
+
+// MeasurementEndpoints returns the sorted list of the unique IP addresses of the endpoints
+// we communicated with according to the network events, DNS queries, TCP connects, and
+// TLS and QUIC handshakes inside the test keys of the given measurement.
+func MeasurementEndpoints(m *model.Measurement) ([]string, error) {
+	data, err := json.Marshal(m.TestKeys)
+	if err != nil {
+		return nil, err
+	}
+	var tk measurementEndpointsTestKeys
+	if err := json.Unmarshal(data, &tk); err != nil {
+		return nil, err
+	}
+	endpoints := NewEndpoints()
+	for _, ev := range tk.NetworkEvents {
+		endpoints.Add(ev.Address)
+	}
+	for _, query := range tk.Queries {
+		endpoints.Add(query.ResolverAddress)
+	}
+	for _, handshake := range tk.QUICHandshakes {
+		endpoints.Add(handshake.Address)
+	}
+	for _, connect := range tk.TCPConnect {
+		endpoints.Add(connect.IP)
+	}
+	for _, handshake := range tk.TLSHandshakes {
+		endpoints.Add(handshake.Address)
+	}
+	return endpoints.sorted(), nil
+}
@@ -0,0 +1,191 @@
+package pcapx
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// newUDPPacket returns a raw IP packet containing an UDP datagram between the given addresses.
+func newUDPPacket(t *testing.T, src, dst string) *Packet {
+	srcIP, dstIP := net.ParseIP(src), net.ParseIP(dst)
+	udp := &layers.UDP{SrcPort: 54321, DstPort: 53}
+	var network gopacket.SerializableLayer
+	if srcIP.To4() != nil {
+		ipv4 := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: srcIP, DstIP: dstIP}
+		udp.SetNetworkLayerForChecksum(ipv4)
+		network = ipv4
+	} else {
+		ipv6 := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: srcIP, DstIP: dstIP}
+		udp.SetNetworkLayerForChecksum(ipv6)
+		network = ipv6
+	}
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buffer, options, network, udp, gopacket.Payload("abc")); err != nil {
+		t.Fatal(err)
+	}
+	data := buffer.Bytes()
+	return &Packet{
+		CaptureInfo: gopacket.CaptureInfo{
+			Timestamp:     time.Now(),
+			CaptureLength: len(data),
+			Length:        len(data),
+		},
+		Data: data,
+	}
+}
+
+func TestWritePCAPNG(t *testing.T) {
+	packets := []*Packet{
+		newUDPPacket(t, "10.0.0.1", "8.8.8.8"),
+		newUDPPacket(t, "8.8.4.4", "10.0.0.1"),
+		newUDPPacket(t, "10.0.0.1", "1.1.1.1"),
+		newUDPPacket(t, "2001:db8::1", "2001:4860:4860::8888"),
+		{Data: []byte{0xff, 0xff}}, // not a valid IP packet
+	}
+
+	tests := []struct {
+		name      string
+		endpoints []string
+		want      int
+	}{{
+		name:      "with no endpoints",
+		endpoints: nil,
+		want:      0,
+	}, {
+		name:      "with IPv4 endpoints",
+		endpoints: []string{"8.8.8.8", "8.8.4.4"},
+		want:      2,
+	}, {
+		name:      "with an IPv6 endpoint",
+		endpoints: []string{"2001:4860:4860::8888"},
+		want:      1,
+	}, {
+		name:      "with invalid endpoints",
+		endpoints: []string{"dns.google", ""},
+		want:      0,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			count, err := WritePCAPNG(&buffer, layers.LinkTypeRaw, packets, tt.endpoints)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.want {
+				t.Fatal("expected", tt.want, "got", count)
+			}
+			reader, err := pcapgo.NewNgReader(&buffer, pcapgo.DefaultNgReaderOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var read int
+			for {
+				if _, _, err := reader.ReadPacketData(); err != nil {
+					break
+				}
+				read++
+			}
+			if read != tt.want {
+				t.Fatal("expected", tt.want, "read", read)
+			}
+		})
+	}
+
+	t.Run("when writing fails", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		w := &failingWriter{err: expected}
+		_, err := WritePCAPNG(w, layers.LinkTypeRaw, packets, []string{"8.8.8.8"})
+		if !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
+
+// failingWriter is an [io.Writer] that always fails.
+type failingWriter struct {
+	err error
+}
+
+func (w *failingWriter) Write(data []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestMeasurementEndpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		testKeys any
+		want     []string
+		wantErr  bool
+	}{{
+		name:     "with nil test keys",
+		testKeys: nil,
+		want:     nil,
+	}, {
+		name: "with network events, queries, connects, and handshakes",
+		testKeys: map[string]any{
+			"network_events": []any{
+				map[string]any{"address": "8.8.8.8:53", "operation": "write"},
+				map[string]any{"address": "", "operation": "resolve_start"},
+			},
+			"queries": []any{
+				map[string]any{
+					"resolver_address": "8.8.8.8:53",
+					"answers": []any{
+						map[string]any{"ipv4": "9.9.9.9"},
+					},
+				},
+				map[string]any{"resolver_address": "https://dns.google/dns-query"},
+			},
+			"quic_handshakes": []any{
+				map[string]any{"address": "[2001:4860:4860::8844]:443"},
+			},
+			"tcp_connect": []any{
+				map[string]any{"ip": "8.8.4.4", "port": 443},
+				map[string]any{"ip": "::ffff:1.0.0.1", "port": 443},
+			},
+			"tls_handshakes": []any{
+				map[string]any{"address": "1.1.1.1:853"},
+			},
+			"requests": []any{
+				map[string]any{"url": "https://9.9.9.10/"},
+			},
+			"not_an_endpoint": "149.112.112.112",
+		},
+		want: []string{
+			"1.0.0.1", "1.1.1.1", "2001:4860:4860::8844", "8.8.4.4", "8.8.8.8",
+		},
+	}, {
+		name:     "with test keys that are not an object",
+		testKeys: []any{"8.8.8.8"},
+		want:     nil,
+		wantErr:  true,
+	}, {
+		name:     "with test keys that cannot be serialized",
+		testKeys: map[string]any{"chan": make(chan int)},
+		want:     nil,
+		wantErr:  true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MeasurementEndpoints(&model.Measurement{TestKeys: tt.testKeys})
+			if (err != nil) != tt.wantErr {
+				t.Fatal("unexpected error", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatal(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package pcapx
+
+//
+// Sources of captured packets
+//
+
+import (
+	"errors"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Packet is a captured packet.
+type Packet struct {
+	// CaptureInfo contains the capture metadata.
+	CaptureInfo gopacket.CaptureInfo
+
+	// Data contains the captured bytes.
+	Data []byte
+}
+
+// Source is a source of captured packets.
+type Source interface {
+	// ReadPacket blocks until a packet is available and returns it. After
+	// Close, ReadPacket MUST return [net.ErrClosed]. You SHOULD NOT call this
+	// method concurrently from multiple goroutines.
+	ReadPacket() (*Packet, error)
+
+	// LinkType returns the link type of the captured packets.
+	LinkType() layers.LinkType
+
+	// Close closes the source and unblocks ReadPacket.
+	Close() error
+}
+
+// ErrNotSupported indicates that we cannot capture packets on this system.
+var ErrNotSupported = errors.New("pcapx: packet capture not supported on this system")
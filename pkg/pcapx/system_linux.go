@@ -0,0 +1,181 @@
+//go:build linux
+
+package pcapx
+
+//
+// Capturing packets using AF_PACKET sockets
+//
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/sys/unix"
+)
+
+// systemMaxPacketSize is the maximum number of bytes we capture for each packet.
+const systemMaxPacketSize = 1 << 16
+
+// NewSystemSource returns a [Source] capturing the IPv4 and IPv6 packets sent and
+// received by the network interface used by the default route. We use a cooked
+// AF_PACKET socket, hence the captured packets start with the IP header.
+//
+// This function requires CAP_NET_RAW and fails when we lack privileges.
+func NewSystemSource() (Source, error) {
+	ifname, err := systemDefaultInterface()
+	if err != nil {
+		return nil, err
+	}
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return nil, err
+	}
+	protocol := systemHtons(unix.ETH_P_ALL)
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, int(protocol))
+	if err != nil {
+		return nil, fmt.Errorf("pcapx: cannot create AF_PACKET socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: protocol, Ifindex: iface.Index}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("pcapx: cannot bind to %s: %w", ifname, err)
+	}
+	// Because the socket is nonblocking, os.NewFile registers it with the runtime
+	// poller, such that closing the file unblocks pending reads.
+	file := os.NewFile(uintptr(fd), "pcapx-"+ifname)
+	conn, err := file.SyscallConn()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	source := &systemSource{
+		buffer: make([]byte, systemMaxPacketSize),
+		closed: &atomic.Bool{},
+		conn:   conn,
+		file:   file,
+	}
+	return source, nil
+}
+
+// systemSource is the [Source] returned by [NewSystemSource].
+type systemSource struct {
+	buffer []byte
+	closed *atomic.Bool
+	conn   syscall.RawConn
+	file   *os.File
+}
+
+var _ Source = &systemSource{}
+
+// ReadPacket implements Source.
+func (s *systemSource) ReadPacket() (*Packet, error) {
+	for {
+		var (
+			count int
+			from  unix.Sockaddr
+			err   error
+		)
+		rawErr := s.conn.Read(func(fd uintptr) bool {
+			// Using MSG_TRUNC causes the kernel to return the real packet length.
+			count, from, err = unix.Recvfrom(int(fd), s.buffer, unix.MSG_TRUNC)
+			return !errors.Is(err, unix.EAGAIN)
+		})
+		if s.closed.Load() {
+			return nil, net.ErrClosed
+		}
+		if rawErr != nil {
+			return nil, rawErr
+		}
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sll, good := from.(*unix.SockaddrLinklayer)
+		if !good || (sll.Protocol != systemHtons(unix.ETH_P_IP) && sll.Protocol != systemHtons(unix.ETH_P_IPV6)) {
+			continue // not an IP packet
+		}
+		captured := min(count, len(s.buffer))
+		packet := &Packet{
+			CaptureInfo: gopacket.CaptureInfo{
+				Timestamp:     time.Now(),
+				CaptureLength: captured,
+				Length:        count,
+			},
+			Data: append([]byte{}, s.buffer[:captured]...),
+		}
+		return packet, nil
+	}
+}
+
+// LinkType implements Source.
+func (s *systemSource) LinkType() layers.LinkType {
+	return layers.LinkTypeRaw
+}
+
+// Close implements Source.
+func (s *systemSource) Close() error {
+	s.closed.Store(true)
+	return s.file.Close()
+}
+
+// systemHtons converts a short from host to network byte order.
+func systemHtons(value uint16) uint16 {
+	return value<<8 | value>>8
+}
+
+// errNoDefaultRoute indicates we could not find the default route.
+var errNoDefaultRoute = errors.New("pcapx: cannot find the default route")
+
+// systemDefaultInterface returns the name of the network interface
+// used by the IPv4 default route or, if missing, by the IPv6 one.
+func systemDefaultInterface() (string, error) {
+	// See https://man7.org/linux/man-pages/man5/proc.5.html for the format.
+	//
+	// /proc/net/route: Iface Destination Gateway Flags ...
+	if ifname, err := systemScanRoutes("/proc/net/route", func(fields []string) string {
+		if len(fields) >= 2 && fields[1] == "00000000" {
+			return fields[0]
+		}
+		return ""
+	}); err == nil {
+		return ifname, nil
+	}
+	// /proc/net/ipv6_route: Destination PrefixLength Source PrefixLength NextHop Metric ... Iface
+	return systemScanRoutes("/proc/net/ipv6_route", func(fields []string) string {
+		if len(fields) >= 10 && fields[1] == "00" && fields[9] != "lo" &&
+			fields[0] == strings.Repeat("0", 32) {
+			return fields[9]
+		}
+		return ""
+	})
+}
+
+// systemScanRoutes scans the given routing table file and returns the first non-empty
+// value returned by the given function, which receives each line's fields.
+func systemScanRoutes(filename string, match func(fields []string) string) (string, error) {
+	filep, err := os.Open(filename) // #nosec G304 - we only open /proc files
+	if err != nil {
+		return "", err
+	}
+	defer filep.Close()
+	scanner := bufio.NewScanner(filep)
+	for scanner.Scan() {
+		if ifname := match(strings.Fields(scanner.Text())); ifname != "" {
+			return ifname, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errNoDefaultRoute
+}
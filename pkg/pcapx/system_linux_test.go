@@ -0,0 +1,82 @@
+//go:build linux
+
+package pcapx
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+)
+
+func TestNewSystemSource(t *testing.T) {
+	source, err := NewSystemSource()
+	if err != nil {
+		// we cannot assume we have CAP_NET_RAW or a default route
+		t.Skip("cannot create system source", err)
+	}
+	if source.LinkType() != layers.LinkTypeRaw {
+		t.Fatal("unexpected link type")
+	}
+	if err := source.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.ReadPacket(); err == nil {
+		t.Fatal("expected an error after Close")
+	}
+}
+
+func TestSystemScanRoutes(t *testing.T) {
+	match := func(fields []string) string {
+		if len(fields) >= 2 && fields[1] == "00000000" {
+			return fields[0]
+		}
+		return ""
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr error
+	}{{
+		name: "with a default route",
+		content: strings.Join([]string{
+			"Iface\tDestination\tGateway\tFlags",
+			"eth0\t0002A8C0\t00000000\t0001",
+			"wlan0\t00000000\t0102A8C0\t0003",
+		}, "\n"),
+		want:    "wlan0",
+		wantErr: nil,
+	}, {
+		name:    "without a default route",
+		content: "Iface\tDestination\tGateway\tFlags\neth0\t0002A8C0\t00000000\t0001\n",
+		want:    "",
+		wantErr: errNoDefaultRoute,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "route")
+			if err := os.WriteFile(filename, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := systemScanRoutes(filename, match)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatal("unexpected error", err)
+			}
+			if got != tt.want {
+				t.Fatal("expected", tt.want, "got", got)
+			}
+		})
+	}
+
+	t.Run("with a nonexistent file", func(t *testing.T) {
+		if _, err := systemScanRoutes(filepath.Join(t.TempDir(), "nonexistent"), match); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
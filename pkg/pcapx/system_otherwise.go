@@ -0,0 +1,10 @@
+//go:build !linux
+
+package pcapx
+
+// NewSystemSource returns a [Source] capturing the packets sent and received
+// by the network interface used by the default route. This system does not
+// support packet capture, hence this function always returns [ErrNotSupported].
+func NewSystemSource() (Source, error) {
+	return nil, ErrNotSupported
+}
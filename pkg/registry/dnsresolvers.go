@@ -0,0 +1,27 @@
+package registry
+
+//
+// Registers the `dnsresolvers' experiment.
+//
+
+import (
+	"github.com/ooni/probe-engine/pkg/experiment/dnsresolvers"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+func init() {
+	const canonicalName = "dnsresolvers"
+	AllExperiments[canonicalName] = func() *Factory {
+		return &Factory{
+			build: func(config interface{}) model.ExperimentMeasurer {
+				return dnsresolvers.NewExperimentMeasurer(
+					*config.(*dnsresolvers.Config),
+				)
+			},
+			canonicalName:    canonicalName,
+			config:           &dnsresolvers.Config{},
+			enabledByDefault: true,
+			inputPolicy:      model.InputNone,
+		}
+	}
+}
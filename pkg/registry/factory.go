@@ -5,6 +5,7 @@ package registry
 //
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -267,6 +268,40 @@ func (b *Factory) SetOptionsJSON(value json.RawMessage) error {
 	return json.Unmarshal(value, b.config)
 }
 
+// ValidateOptionsJSON checks whether we can unmarshal the given [json.RawMessage]
+// inside the experiment specific configuration without unknown fields and with the
+// correct types. Unlike SetOptionsJSON, this method does not modify the configuration.
+func (b *Factory) ValidateOptionsJSON(value json.RawMessage) error {
+	// handle the case where the options are empty
+	if len(value) <= 0 {
+		return nil
+	}
+
+	// make sure we're dealing with a pointer to a structure
+	ptrinfo := reflect.ValueOf(b.config)
+	if ptrinfo.Kind() != reflect.Ptr || ptrinfo.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w but a %T", ErrConfigIsNotAStructPointer, b.config)
+	}
+
+	// unmarshal into a fresh copy of the configuration
+	config := reflect.New(ptrinfo.Elem().Type()).Interface()
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(config)
+}
+
+// DefaultOptionsJSON returns the JSON serialization of the experiment specific
+// configuration, which contains the default values of the options.
+func (b *Factory) DefaultOptionsJSON() (json.RawMessage, error) {
+	return json.Marshal(b.config)
+}
+
+// EnabledByDefault returns whether the experiment is enabled by default. When
+// this is false, the check-in API needs to enable the experiment.
+func (b *Factory) EnabledByDefault() bool {
+	return b.enabledByDefault
+}
+
 // fieldbyname return v's field whose name is equal to the given key.
 func (b *Factory) fieldbyname(v interface{}, key string) (reflect.Value, error) {
 	// See https://stackoverflow.com/a/6396678/4354461
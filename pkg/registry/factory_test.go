@@ -564,6 +564,81 @@ func TestFactorySetOptionsJSON(t *testing.T) {
 	}
 }
 
+func TestFactoryValidateOptionsJSON(t *testing.T) {
+
+	// PersonRecord is a fake experiment configuration.
+	type PersonRecord struct {
+		Name string `json:"name"`
+		Age  int64  `json:"age"`
+	}
+
+	// testcase is a test case for this function.
+	type testcase struct {
+		// name is the name of the test case
+		name string
+
+		// rawJSON contains the raw JSON to validate
+		rawJSON json.RawMessage
+
+		// expectErr is the error we expect
+		expectErr string
+	}
+
+	cases := []testcase{{
+		name:      "we accept zero-length options",
+		rawJSON:   []byte{},
+		expectErr: "",
+	}, {
+		name:      "we accept valid options",
+		rawJSON:   []byte(`{"name":"foo","age":55}`),
+		expectErr: "",
+	}, {
+		name:      "we reject unknown options",
+		rawJSON:   []byte(`{"nmae":"foo"}`),
+		expectErr: `json: unknown field "nmae"`,
+	}, {
+		name:      "we reject options with the wrong type",
+		rawJSON:   []byte(`{"age":"55"}`),
+		expectErr: "json: cannot unmarshal string into Go struct field PersonRecord.age of type int64",
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &PersonRecord{Name: "bar"}
+			factory := &Factory{config: config}
+			err := factory.ValidateOptionsJSON(tc.rawJSON)
+			switch {
+			case err == nil && tc.expectErr == "":
+			case err != nil && err.Error() == tc.expectErr:
+			default:
+				t.Fatal("expected", tc.expectErr, "got", err)
+			}
+			if config.Name != "bar" || config.Age != 0 {
+				t.Fatal("ValidateOptionsJSON modified the config", config)
+			}
+		})
+	}
+
+	t.Run("we reject configs that are not pointers to struct", func(t *testing.T) {
+		factory := &Factory{config: PersonRecord{}}
+		err := factory.ValidateOptionsJSON([]byte(`{}`))
+		if !errors.Is(err, ErrConfigIsNotAStructPointer) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+}
+
+func TestFactoryDefaultOptionsJSON(t *testing.T) {
+	factory := AllExperiments["example"]()
+	data, err := factory.DefaultOptionsJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := factory.ValidateOptionsJSON(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestNewFactory(t *testing.T) {
 	// experimentSpecificExpectations contains expectations for an experiment
 	type experimentSpecificExpectations struct {
@@ -592,6 +667,10 @@ func TestNewFactory(t *testing.T) {
 			enabledByDefault: true,
 			inputPolicy:      model.InputOrStaticDefault,
 		},
+		"dnsresolvers": {
+			enabledByDefault: true,
+			inputPolicy:      model.InputNone,
+		},
 		"echcheck": {
 			enabledByDefault: true,
 			inputPolicy: model.InputOptional,
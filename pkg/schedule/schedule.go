@@ -0,0 +1,325 @@
+// Package schedule runs experiments periodically according to a schedule file.
+//
+// A schedule file is a JSON document containing a list of [*Entry], each describing
+// an experiment to run, how often to run it, and under which conditions. Use [Load]
+// to load a schedule file and [NewScheduler] to run the schedule.
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/memoryless"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// Duration is a [time.Duration] that we serialize to JSON as a string
+// such as "1h30m" and that we also parse from a number of seconds.
+type Duration time.Duration
+
+var (
+	_ json.Marshaler   = Duration(0)
+	_ json.Unmarshaler = (*Duration)(nil)
+)
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Window is a daily time window expressed in local time. When Start is
+// after End, the window spans across midnight (e.g., 22:00 to 06:00).
+type Window struct {
+	// Start is the start of the window in the HH:MM format.
+	Start string `json:"start"`
+
+	// End is the end of the window in the HH:MM format.
+	End string `json:"end"`
+}
+
+// minutes returns the start and end of the window in minutes since midnight.
+func (w *Window) minutes() (int, int, error) {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("schedule: empty window %s-%s", w.Start, w.End)
+	}
+	return start, end, nil
+}
+
+// parseClock parses a HH:MM clock and returns the minutes since midnight.
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("schedule: invalid clock %q: %w", value, err)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains returns whether the given minute of the day is inside the window.
+func (w *Window) contains(minute int) bool {
+	start, end, err := w.minutes()
+	runtimex.PanicOnError(err, "w.minutes failed after validation")
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// Entry is an entry of the schedule file.
+type Entry struct {
+	// Name is the OPTIONAL unique name of the entry, which defaults to the
+	// experiment name. We use the name for saving the last run time.
+	Name string `json:"name,omitempty"`
+
+	// Experiment is the MANDATORY name of the experiment to run.
+	Experiment string `json:"experiment"`
+
+	// Inputs contains OPTIONAL inputs for the experiment.
+	Inputs []string `json:"inputs,omitempty"`
+
+	// Options contains OPTIONAL options for the experiment.
+	Options map[string]any `json:"options,omitempty"`
+
+	// MaxRuntime is the OPTIONAL maximum runtime of the experiment.
+	MaxRuntime Duration `json:"max_runtime,omitempty"`
+
+	// Interval is the MANDATORY interval between runs. When Poisson is
+	// true, this is the expected interval between runs.
+	Interval Duration `json:"interval"`
+
+	// Jitter is the OPTIONAL maximum random amount of time we add to or subtract
+	// from the Interval. We ignore this field when Poisson is true.
+	Jitter Duration `json:"jitter,omitempty"`
+
+	// Poisson OPTIONALLY indicates that we should draw the time between runs
+	// from the exponential distribution, such that the runs are Poisson
+	// distributed. To avoid extreme values, we clamp the time between runs
+	// between 10% and 250% of the Interval. See the memoryless package.
+	Poisson bool `json:"poisson,omitempty"`
+
+	// Windows contains the OPTIONAL time windows in which we can run. When
+	// empty, we can run at any time of the day.
+	Windows []Window `json:"windows,omitempty"`
+
+	// NetworkTypes contains the OPTIONAL network types (e.g., "wifi") in which
+	// we can run. When empty, we can run with any network type.
+	NetworkTypes []string `json:"network_types,omitempty"`
+
+	// FeatureFlag is the OPTIONAL check-in feature flag that must be
+	// enabled for us to run. See the checkincache package.
+	FeatureFlag string `json:"feature_flag,omitempty"`
+}
+
+// validate ensures that the entry is valid and fills the default values.
+func (e *Entry) validate() error {
+	if e.Experiment == "" {
+		return errors.New("schedule: missing experiment name")
+	}
+	if e.Name == "" {
+		e.Name = e.Experiment
+	}
+	if e.Interval <= 0 {
+		return fmt.Errorf("schedule: %s: the interval must be positive", e.Name)
+	}
+	if e.Jitter < 0 || e.Jitter >= e.Interval {
+		return fmt.Errorf("schedule: %s: the jitter must be between zero and the interval", e.Name)
+	}
+	if e.MaxRuntime < 0 {
+		return fmt.Errorf("schedule: %s: the max runtime must not be negative", e.Name)
+	}
+	for idx := range e.Windows {
+		if _, _, err := e.Windows[idx].minutes(); err != nil {
+			return fmt.Errorf("schedule: %s: %w", e.Name, err)
+		}
+	}
+	if _, err := e.ExtraOptions(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ExtraOptions returns the sorted list of the options serialized as "key=value"
+// strings, which is the format used by miniooni's -O flag. Because experiments only
+// support string, boolean, and integer options, we fail for other types of values.
+func (e *Entry) ExtraOptions() ([]string, error) {
+	out := []string{}
+	for key, value := range e.Options {
+		serialized, err := formatOption(value)
+		if err != nil {
+			return nil, fmt.Errorf("schedule: %s: option %s: %w", e.Name, key, err)
+		}
+		out = append(out, key+"="+serialized)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// formatOption serializes the value of an option.
+func formatOption(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		if math.Trunc(v) != v || math.Abs(v) > 1<<53-1 {
+			return "", fmt.Errorf("not an integer: %v", v)
+		}
+		return strconv.FormatInt(int64(v), 10), nil
+	default:
+		return "", fmt.Errorf("unsupported value type: %T", value)
+	}
+}
+
+// poissonConfig returns the config for drawing Poisson distributed runs.
+func (e *Entry) poissonConfig() memoryless.Config {
+	expected := time.Duration(e.Interval)
+	return memoryless.Config{
+		Expected: expected,
+		Min:      expected / 10,
+		Max:      expected * 5 / 2,
+	}
+}
+
+// newTimer returns a timer expiring when we should run again.
+func (e *Entry) newTimer() *time.Timer {
+	if e.Poisson {
+		timer, err := memoryless.NewTimer(e.poissonConfig())
+		runtimex.PanicOnError(err, "memoryless.NewTimer failed after validation")
+		return timer
+	}
+	delay := time.Duration(e.Interval)
+	if e.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(2*int64(e.Jitter)+1)) - time.Duration(e.Jitter) // #nosec G404
+	}
+	return time.NewTimer(delay)
+}
+
+// InWindow returns whether the given time is inside one of the entry windows.
+func (e *Entry) InWindow(t time.Time) bool {
+	if len(e.Windows) <= 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for idx := range e.Windows {
+		if e.Windows[idx].contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// UntilWindow returns how long we should wait from the given time before
+// we enter into one of the entry windows. We return zero if we're already
+// inside a window or the entry does not have any window.
+func (e *Entry) UntilWindow(t time.Time) time.Duration {
+	if e.InWindow(t) {
+		return 0
+	}
+	var candidates []time.Duration
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for idx := range e.Windows {
+		start, _, err := e.Windows[idx].minutes()
+		runtimex.PanicOnError(err, "minutes failed after validation")
+		for _, day := range []int{0, 1} {
+			begin := midnight.AddDate(0, 0, day).Add(time.Duration(start) * time.Minute)
+			if begin.After(t) {
+				candidates = append(candidates, begin.Sub(t))
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i] < candidates[j]
+	})
+	return candidates[0]
+}
+
+// AllowsNetworkType returns whether we can run with the given network type.
+func (e *Entry) AllowsNetworkType(networkType string) bool {
+	if len(e.NetworkTypes) <= 0 {
+		return true
+	}
+	for _, value := range e.NetworkTypes {
+		if value == networkType {
+			return true
+		}
+	}
+	return false
+}
+
+// File is the content of a schedule file.
+type File struct {
+	// Entries contains the schedule entries.
+	Entries []*Entry `json:"entries"`
+}
+
+// Parse parses and validates the content of a schedule file.
+func Parse(data []byte) (*File, error) {
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if len(file.Entries) <= 0 {
+		return nil, errors.New("schedule: no entries")
+	}
+	names := make(map[string]bool)
+	for _, entry := range file.Entries {
+		if entry == nil {
+			return nil, errors.New("schedule: null entry")
+		}
+		if err := entry.validate(); err != nil {
+			return nil, err
+		}
+		if names[entry.Name] {
+			return nil, fmt.Errorf("schedule: duplicate entry name: %s", entry.Name)
+		}
+		names[entry.Name] = true
+	}
+	return &file, nil
+}
+
+// Load loads and validates a schedule file.
+func Load(filePath string) (*File, error) {
+	data, err := os.ReadFile(filePath) // #nosec G304 - this is working as intended
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
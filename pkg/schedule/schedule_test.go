@@ -0,0 +1,225 @@
+package schedule
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDuration(t *testing.T) {
+	t.Run("we parse strings and seconds", func(t *testing.T) {
+		var values []Duration
+		if err := json.Unmarshal([]byte(`["1h30m", 90, 0.5]`), &values); err != nil {
+			t.Fatal(err)
+		}
+		expect := []Duration{Duration(90 * time.Minute), Duration(90 * time.Second), Duration(500 * time.Millisecond)}
+		if diff := cmp.Diff(expect, values); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("we serialize to string", func(t *testing.T) {
+		data, err := json.Marshal(Duration(90 * time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != `"1h30m0s"` {
+			t.Fatal("unexpected serialization", string(data))
+		}
+	})
+
+	t.Run("we reject invalid values", func(t *testing.T) {
+		for _, value := range []string{`"antani"`, `true`} {
+			var d Duration
+			if err := json.Unmarshal([]byte(value), &d); err == nil {
+				t.Fatal("expected an error for", value)
+			}
+		}
+	})
+}
+
+func TestParse(t *testing.T) {
+	t.Run("with a valid schedule", func(t *testing.T) {
+		file, err := Parse([]byte(`{"entries": [
+			{"experiment": "web_connectivity", "interval": "1h", "jitter": "10m",
+			 "inputs": ["https://www.example.com/"], "max_runtime": 300},
+			{"name": "ndt-night", "experiment": "ndt", "interval": "24h", "poisson": true,
+			 "windows": [{"start": "22:00", "end": "06:00"}], "network_types": ["wifi"]}
+		]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(file.Entries) != 2 || file.Entries[0].Name != "web_connectivity" {
+			t.Fatal("unexpected entries", file.Entries)
+		}
+		if file.Entries[0].MaxRuntime != Duration(5*time.Minute) {
+			t.Fatal("unexpected max runtime", file.Entries[0].MaxRuntime)
+		}
+	})
+
+	t.Run("with invalid schedules", func(t *testing.T) {
+		cases := []string{
+			`{`,
+			`{"entries": []}`,
+			`{"entries": [null]}`,
+			`{"entries": [{"interval": "1h"}]}`,
+			`{"entries": [{"experiment": "ndt"}]}`,
+			`{"entries": [{"experiment": "ndt", "interval": "1h", "jitter": "1h"}]}`,
+			`{"entries": [{"experiment": "ndt", "interval": "1h", "max_runtime": -1}]}`,
+			`{"entries": [{"experiment": "ndt", "interval": "1h", "windows": [{"start": "25:00", "end": "01:00"}]}]}`,
+			`{"entries": [{"experiment": "ndt", "interval": "1h", "windows": [{"start": "01:00", "end": "1"}]}]}`,
+			`{"entries": [{"experiment": "ndt", "interval": "1h", "windows": [{"start": "01:00", "end": "01:00"}]}]}`,
+			`{"entries": [{"experiment": "ndt", "interval": "1h"}, {"experiment": "ndt", "interval": "2h"}]}`,
+			`{"entries": [{"experiment": "ndt", "interval": "1h", "options": {"Servers": ["a", "b"]}}]}`,
+			`{"entries": [{"experiment": "ndt", "interval": "1h", "options": {"Headers": {"a": "b"}}}]}`,
+			`{"entries": [{"experiment": "ndt", "interval": "1h", "options": {"Timeout": 1.5}}]}`,
+			`{"entries": [{"experiment": "ndt", "interval": "1h", "options": {"Nothing": null}}]}`,
+		}
+		for _, value := range cases {
+			if _, err := Parse([]byte(value)); err == nil {
+				t.Fatal("expected an error for", value)
+			}
+		}
+	})
+}
+
+func TestEntryExtraOptions(t *testing.T) {
+	file, err := Parse([]byte(`{"entries": [{"experiment": "dnscheck", "interval": "1h", "options": {
+		"HTTP3Enabled": true, "DefaultAddrs": "8.8.8.8 8.8.4.4", "Runs": 1000000, "Negative": -3}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	options, err := file.Entries[0].ExtraOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"DefaultAddrs=8.8.8.8 8.8.4.4",
+		"HTTP3Enabled=true",
+		"Negative=-3",
+		"Runs=1000000",
+	}
+	if diff := cmp.Diff(expect, options); diff != "" {
+		t.Fatal(diff)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "schedule.json")
+	content := `{"entries": [{"experiment": "ndt", "interval": "1h"}]}`
+	if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(filePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "nonexistent.json")); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestEntryWindows(t *testing.T) {
+	day := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 2, hour, minute, 0, 0, time.Local)
+	}
+
+	type testcase struct {
+		name        string
+		windows     []Window
+		now         time.Time
+		inWindow    bool
+		untilWindow time.Duration
+	}
+
+	cases := []testcase{{
+		name:     "without windows",
+		now:      day(3, 0),
+		inWindow: true,
+	}, {
+		name:     "inside a daytime window",
+		windows:  []Window{{Start: "08:00", End: "20:00"}},
+		now:      day(8, 0),
+		inWindow: true,
+	}, {
+		name:        "before a daytime window",
+		windows:     []Window{{Start: "08:00", End: "20:00"}},
+		now:         day(7, 30),
+		untilWindow: 30 * time.Minute,
+	}, {
+		name:        "after a daytime window",
+		windows:     []Window{{Start: "08:00", End: "20:00"}},
+		now:         day(20, 0),
+		untilWindow: 12 * time.Hour,
+	}, {
+		name:     "inside a window spanning midnight",
+		windows:  []Window{{Start: "22:00", End: "06:00"}},
+		now:      day(5, 59),
+		inWindow: true,
+	}, {
+		name:        "outside a window spanning midnight",
+		windows:     []Window{{Start: "22:00", End: "06:00"}},
+		now:         day(6, 0),
+		untilWindow: 16 * time.Hour,
+	}, {
+		name:        "with multiple windows",
+		windows:     []Window{{Start: "22:00", End: "23:00"}, {Start: "12:00", End: "13:00"}},
+		now:         day(11, 0),
+		untilWindow: time.Hour,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			entry := &Entry{Experiment: "ndt", Interval: Duration(time.Hour), Windows: tc.windows}
+			if err := entry.validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := entry.InWindow(tc.now); got != tc.inWindow {
+				t.Fatal("unexpected InWindow", got)
+			}
+			if got := entry.UntilWindow(tc.now); got != tc.untilWindow {
+				t.Fatal("unexpected UntilWindow", got)
+			}
+		})
+	}
+}
+
+func TestEntryAllowsNetworkType(t *testing.T) {
+	entry := &Entry{}
+	if !entry.AllowsNetworkType("") || !entry.AllowsNetworkType("mobile") {
+		t.Fatal("an entry without constraints should allow any network type")
+	}
+	entry.NetworkTypes = []string{"wifi", "wired"}
+	if !entry.AllowsNetworkType("wired") || entry.AllowsNetworkType("mobile") || entry.AllowsNetworkType("") {
+		t.Fatal("unexpected network type constraints")
+	}
+}
+
+func TestEntryNewTimer(t *testing.T) {
+	t.Run("with jitter", func(t *testing.T) {
+		entry := &Entry{Interval: Duration(10 * time.Millisecond), Jitter: Duration(5 * time.Millisecond)}
+		for idx := 0; idx < 10; idx++ {
+			start := time.Now()
+			<-entry.newTimer().C
+			if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+				t.Fatal("timer expired too early", elapsed)
+			}
+		}
+	})
+
+	t.Run("with poisson", func(t *testing.T) {
+		entry := &Entry{Interval: Duration(10 * time.Millisecond), Poisson: true}
+		config := entry.poissonConfig()
+		if config.Min != time.Millisecond || config.Max != 25*time.Millisecond || config.Check() != nil {
+			t.Fatalf("unexpected config %+v", config)
+		}
+		start := time.Now()
+		<-entry.newTimer().C
+		if elapsed := time.Since(start); elapsed < time.Millisecond {
+			t.Fatal("timer expired too early", elapsed)
+		}
+	})
+}
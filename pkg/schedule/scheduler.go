@@ -0,0 +1,200 @@
+package schedule
+
+//
+// Running the schedule
+//
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/checkincache"
+	"github.com/ooni/probe-engine/pkg/kvstore"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// StateKey is the [model.KeyValueStore] key containing the last run times.
+const StateKey = "schedule.state"
+
+// state is the state saved in the key-value store.
+type state struct {
+	// LastRun maps each entry name to the time of its last run.
+	LastRun map[string]time.Time
+}
+
+// SchedulerConfig contains config for [NewScheduler]. You MUST fill all
+// the fields marked as MANDATORY.
+type SchedulerConfig struct {
+	// File is the MANDATORY schedule file.
+	File *File
+
+	// KVStore is the MANDATORY key-value store where we persist the last
+	// run times and from which we read the check-in feature flags.
+	KVStore model.KeyValueStore
+
+	// Logger is the MANDATORY logger to use.
+	Logger model.Logger
+
+	// NetworkType is the OPTIONAL function returning the current network type,
+	// which we call before each run. When nil, the network type is unknown and
+	// we only run the entries that do not constrain the network type.
+	NetworkType func() string
+
+	// Runner is the MANDATORY function that runs the given entry.
+	Runner func(ctx context.Context, entry *Entry) error
+}
+
+// Scheduler runs experiments according to a schedule. We run a single
+// experiment at a time. Construct using [NewScheduler].
+type Scheduler struct {
+	config  *SchedulerConfig
+	mu      sync.Mutex
+	timeNow func() time.Time
+}
+
+// NewScheduler creates a new [*Scheduler].
+func NewScheduler(config *SchedulerConfig) *Scheduler {
+	return &Scheduler{
+		config:  config,
+		mu:      sync.Mutex{},
+		timeNow: time.Now,
+	}
+}
+
+// LastRun returns the last run time of the given entry or the zero time.
+func (s *Scheduler) LastRun(name string) time.Time {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	return s.loadState().LastRun[name]
+}
+
+// loadState loads the state. We start from an empty state on error.
+func (s *Scheduler) loadState() *state {
+	st := &state{LastRun: make(map[string]time.Time)}
+	data, err := s.config.KVStore.Get(StateKey)
+	if err != nil {
+		if !errors.Is(err, kvstore.ErrNoSuchKey) {
+			s.config.Logger.Warnf("schedule: cannot read the state: %s", err.Error())
+		}
+		return st
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		s.config.Logger.Warnf("schedule: cannot parse the state: %s", err.Error())
+		return &state{LastRun: make(map[string]time.Time)}
+	}
+	if st.LastRun == nil {
+		st.LastRun = make(map[string]time.Time)
+	}
+	return st
+}
+
+// saveLastRun saves the last run time of the given entry.
+func (s *Scheduler) saveLastRun(name string, t time.Time) {
+	defer s.mu.Unlock()
+	s.mu.Lock()
+	st := s.loadState()
+	st.LastRun[name] = t
+	data, err := json.Marshal(st)
+	runtimex.PanicOnError(err, "json.Marshal unexpectedly failed")
+	if err := s.config.KVStore.Set(StateKey, data); err != nil {
+		s.config.Logger.Warnf("schedule: cannot save the state: %s", err.Error())
+	}
+}
+
+// Run runs the schedule until the context is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	due := make(chan *Entry)
+	wg := &sync.WaitGroup{}
+	for _, entry := range s.config.File.Entries {
+		wg.Add(1)
+		go s.loop(ctx, entry, due, wg)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			cancel()
+			wg.Wait()
+			return
+		case entry := <-due:
+			s.maybeRun(ctx, entry)
+		}
+	}
+}
+
+// loop waits until the given entry is due and posts it into the due channel.
+func (s *Scheduler) loop(ctx context.Context, entry *Entry, due chan<- *Entry, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// We honour the last run time when we start, such that restarting the
+	// scheduler does not cause all the experiments to run immediately.
+	var timer *time.Timer
+	if lastRun := s.LastRun(entry.Name); !lastRun.IsZero() {
+		timer = time.NewTimer(lastRun.Add(time.Duration(entry.Interval)).Sub(s.timeNow()))
+	} else {
+		timer = time.NewTimer(0)
+	}
+
+	for {
+		if !waitTimer(ctx, timer) {
+			return
+		}
+		if delay := entry.UntilWindow(s.timeNow()); delay > 0 {
+			s.config.Logger.Infof("schedule: %s: waiting %s for the next time window", entry.Name, delay)
+			if !waitTimer(ctx, time.NewTimer(delay)) {
+				return
+			}
+		}
+		select {
+		case due <- entry:
+		case <-ctx.Done():
+			return
+		}
+		timer = entry.newTimer()
+	}
+}
+
+// waitTimer waits for the timer to expire or the context to be done and
+// returns true if the timer expired and false otherwise.
+func waitTimer(ctx context.Context, timer *time.Timer) bool {
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// maybeRun runs the given entry if all its constraints are satisfied.
+func (s *Scheduler) maybeRun(ctx context.Context, entry *Entry) {
+	logger := s.config.Logger
+	if !entry.InWindow(s.timeNow()) {
+		logger.Infof("schedule: %s: skipping because we're outside the time windows", entry.Name)
+		return
+	}
+	var networkType string
+	if s.config.NetworkType != nil {
+		networkType = s.config.NetworkType()
+	}
+	if !entry.AllowsNetworkType(networkType) {
+		logger.Infof("schedule: %s: skipping because of the network type: %q", entry.Name, networkType)
+		return
+	}
+	if entry.FeatureFlag != "" && !checkincache.GetFeatureFlag(s.config.KVStore, entry.FeatureFlag) {
+		logger.Infof("schedule: %s: skipping because %s is not enabled by check-in", entry.Name, entry.FeatureFlag)
+		return
+	}
+	logger.Infof("schedule: %s: running %s", entry.Name, entry.Experiment)
+	s.saveLastRun(entry.Name, s.timeNow())
+	if err := s.config.Runner(ctx, entry); err != nil {
+		logger.Warnf("schedule: %s: %s", entry.Name, err.Error())
+		return
+	}
+	logger.Infof("schedule: %s: done", entry.Name)
+}
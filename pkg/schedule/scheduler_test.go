@@ -0,0 +1,185 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/checkincache"
+	"github.com/ooni/probe-engine/pkg/kvstore"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+// newTestingFile returns a schedule file containing the given entries.
+func newTestingFile(t *testing.T, entries ...*Entry) *File {
+	for _, entry := range entries {
+		if err := entry.validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &File{Entries: entries}
+}
+
+// runCounter counts the runs of each entry and cancels the context
+// when the given entry has run the given number of times.
+type runCounter struct {
+	cancel context.CancelFunc
+	count  int
+	mu     sync.Mutex
+	name   string
+	runs   map[string]int
+}
+
+func (rc *runCounter) run(ctx context.Context, entry *Entry) error {
+	defer rc.mu.Unlock()
+	rc.mu.Lock()
+	rc.runs[entry.Name]++
+	if entry.Name == rc.name && rc.runs[entry.Name] >= rc.count {
+		rc.cancel()
+	}
+	return errors.New("mocked error") // make sure we continue running
+}
+
+func TestScheduler(t *testing.T) {
+	t.Run("we run the entries and save the last run time", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		counter := &runCounter{cancel: cancel, count: 3, name: "fast", runs: map[string]int{}}
+		kvs := &kvstore.Memory{}
+		sched := NewScheduler(&SchedulerConfig{
+			File: newTestingFile(t,
+				&Entry{Name: "fast", Experiment: "example", Interval: Duration(time.Millisecond)},
+				&Entry{Name: "poisson", Experiment: "example", Interval: Duration(time.Millisecond), Poisson: true},
+				&Entry{Name: "wifi", Experiment: "example", Interval: Duration(time.Millisecond),
+					NetworkTypes: []string{"wifi"}},
+				&Entry{Name: "flag", Experiment: "example", Interval: Duration(time.Millisecond),
+					FeatureFlag: "antani"},
+			),
+			KVStore: kvs,
+			Logger:  model.DiscardLogger,
+			NetworkType: func() string {
+				return "mobile"
+			},
+			Runner: counter.run,
+		})
+		sched.Run(ctx)
+		if ctx.Err() == nil {
+			t.Fatal("Run returned before the context was done")
+		}
+		if counter.runs["fast"] < 3 {
+			t.Fatal("unexpected number of runs", counter.runs)
+		}
+		if counter.runs["wifi"] != 0 || counter.runs["flag"] != 0 {
+			t.Fatal("we should have skipped the constrained entries", counter.runs)
+		}
+		if sched.LastRun("fast").IsZero() || !sched.LastRun("wifi").IsZero() {
+			t.Fatal("unexpected last run times")
+		}
+	})
+
+	t.Run("we honour the check-in feature flags", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		kvs := &kvstore.Memory{}
+		resp := &model.OOAPICheckInResult{Conf: model.OOAPICheckInResultConfig{
+			Features: map[string]bool{"antani": true},
+		}}
+		if err := checkincache.Store(kvs, resp); err != nil {
+			t.Fatal(err)
+		}
+		counter := &runCounter{cancel: cancel, count: 1, name: "flag", runs: map[string]int{}}
+		sched := NewScheduler(&SchedulerConfig{
+			File: newTestingFile(t, &Entry{Name: "flag", Experiment: "example",
+				Interval: Duration(time.Millisecond), FeatureFlag: "antani"}),
+			KVStore: kvs,
+			Logger:  model.DiscardLogger,
+			Runner:  counter.run,
+		})
+		sched.Run(ctx)
+		if counter.runs["flag"] != 1 {
+			t.Fatal("unexpected number of runs", counter.runs)
+		}
+	})
+
+	t.Run("we honour the last run time when starting", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		file := newTestingFile(t, &Entry{Experiment: "example", Interval: Duration(time.Hour)})
+		runs := 0
+		sched := NewScheduler(&SchedulerConfig{
+			File:    file,
+			KVStore: kvs,
+			Logger:  model.DiscardLogger,
+			Runner: func(ctx context.Context, entry *Entry) error {
+				runs++
+				return nil
+			},
+		})
+		sched.saveLastRun("example", time.Now())
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		sched.Run(ctx)
+		if runs != 0 {
+			t.Fatal("we should not have run", runs)
+		}
+	})
+
+	t.Run("we skip entries when we're outside the time windows", func(t *testing.T) {
+		runs := 0
+		sched := NewScheduler(&SchedulerConfig{
+			File: newTestingFile(t, &Entry{Experiment: "example", Interval: Duration(time.Hour),
+				Windows: []Window{{Start: "08:00", End: "09:00"}}}),
+			KVStore: &kvstore.Memory{},
+			Logger:  model.DiscardLogger,
+			Runner: func(ctx context.Context, entry *Entry) error {
+				runs++
+				return nil
+			},
+		})
+		sched.timeNow = func() time.Time {
+			return time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local)
+		}
+		sched.maybeRun(context.Background(), sched.config.File.Entries[0])
+		if runs != 0 {
+			t.Fatal("we should not have run", runs)
+		}
+	})
+
+	t.Run("we handle key-value store errors", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		sched := NewScheduler(&SchedulerConfig{
+			KVStore: &mocks.KeyValueStore{
+				MockGet: func(key string) ([]byte, error) {
+					return nil, expected
+				},
+				MockSet: func(key string, value []byte) error {
+					return expected
+				},
+			},
+			Logger: model.DiscardLogger,
+		})
+		sched.saveLastRun("example", time.Now())
+		if !sched.LastRun("example").IsZero() {
+			t.Fatal("expected zero time")
+		}
+	})
+
+	t.Run("we handle an invalid state", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		for _, value := range []string{`{`, `{}`} {
+			if err := kvs.Set(StateKey, []byte(value)); err != nil {
+				t.Fatal(err)
+			}
+			sched := NewScheduler(&SchedulerConfig{KVStore: kvs, Logger: model.DiscardLogger})
+			if !sched.LastRun("example").IsZero() {
+				t.Fatal("expected zero time")
+			}
+			sched.saveLastRun("example", time.Now())
+			if sched.LastRun("example").IsZero() {
+				t.Fatal("expected nonzero time")
+			}
+		}
+	})
+}
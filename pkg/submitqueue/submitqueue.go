@@ -0,0 +1,343 @@
+// Package submitqueue contains a persistent queue of measurements we could not submit.
+//
+// When submitting a measurement fails (e.g., because the collector is unreachable or
+// we are behind a captive portal), we add the measurement to the queue. Later runs
+// call [*Queue.Flush] to retry submitting the queued measurements. We use exponential
+// backoff to avoid hammering the collector with measurements that keep failing.
+package submitqueue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ooni/probe-engine/pkg/kvstore"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// StateKey is the [model.KeyValueStore] key containing the queue index, i.e., the
+// ordered list of queued measurements UIDs and the most recent submission error.
+const StateKey = "submitqueue.state"
+
+// EntryKeyPrefix is the prefix of the [model.KeyValueStore] keys containing the
+// queued entries. We store each entry using its own key, such that adding or
+// updating an entry does not require rewriting the whole queue.
+const EntryKeyPrefix = "submitqueue.entry."
+
+const (
+	// BackoffBase is the delay before retrying after the first failure. We
+	// double the delay after each subsequent failure up to [BackoffMax].
+	BackoffBase = 5 * time.Minute
+
+	// BackoffMax is the maximum delay between two submission attempts.
+	BackoffMax = 24 * time.Hour
+
+	// MaxEntries is the maximum number of queued measurements. When the queue
+	// is full, adding a new measurement drops the oldest one.
+	MaxEntries = 512
+)
+
+// Entry is a measurement inside the queue.
+type Entry struct {
+	// UID is the measurement UID computed using [MeasurementUID].
+	UID string
+
+	// Measurement is the JSON serialized measurement.
+	Measurement json.RawMessage
+
+	// Attempts is the number of failed submission attempts.
+	Attempts int64
+
+	// Queued is when we added the measurement to the queue.
+	Queued time.Time
+
+	// NextAttempt is when we should attempt to submit again.
+	NextAttempt time.Time
+
+	// LastError is the error that occurred when last submitting.
+	LastError string
+}
+
+// state is the queue index saved in the key-value store.
+type state struct {
+	// UIDs contains the UIDs of the queued measurements from the oldest to the newest.
+	UIDs []string
+
+	// LastError is the most recent submission error.
+	LastError string
+}
+
+// Queue is the queue of measurements we could not submit. The queue is
+// safe for concurrent use within the same process but it does not protect
+// against concurrent modifications from several processes.
+//
+// Construct using [New].
+type Queue struct {
+	// kvStore is the underlying key-value store.
+	kvStore model.ExtendedKeyValueStore
+
+	// mu provides mutual exclusion.
+	mu sync.Mutex
+
+	// timeNow allows to mock time.Now in tests.
+	timeNow func() time.Time
+}
+
+// New creates a new [*Queue] storing its state into the given [model.KeyValueStore].
+func New(kvStore model.KeyValueStore) *Queue {
+	return &Queue{
+		kvStore: kvstore.NewExtended(kvStore),
+		mu:      sync.Mutex{},
+		timeNow: time.Now,
+	}
+}
+
+// MeasurementUID returns a stable identifier for the given measurement, which we
+// use to avoid queueing the same measurement more than once. Because the collector
+// assigns the definitive UID only after a successful submission, we use the locally
+// generated measurement ID, if any, and otherwise the SHA256 of the measurement
+// serialized without the report ID, which changes across submission attempts.
+func MeasurementUID(m *model.Measurement) string {
+	if m.ID != "" {
+		return m.ID
+	}
+	dup := *m
+	dup.ReportID = ""
+	data, err := json.Marshal(&dup)
+	runtimex.PanicOnError(err, "json.Marshal unexpectedly failed")
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// backoff returns the delay to wait after the given number of failed attempts.
+func backoff(attempts int64) time.Duration {
+	delay := BackoffBase
+	for idx := int64(1); idx < attempts && delay < BackoffMax; idx++ {
+		delay *= 2
+	}
+	if delay > BackoffMax {
+		delay = BackoffMax
+	}
+	return delay
+}
+
+// entryKey returns the key containing the entry with the given UID. We hash the
+// UID because the measurement ID may contain characters not valid in a key.
+func entryKey(uid string) string {
+	sum := sha256.Sum256([]byte(uid))
+	return EntryKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// loadLocked loads the index from the key-value store. A missing key is not
+// an error and results in an empty index.
+func (q *Queue) loadLocked() (*state, error) {
+	data, err := q.kvStore.Get(StateKey)
+	if err != nil {
+		if errors.Is(err, kvstore.ErrNoSuchKey) {
+			return &state{}, nil
+		}
+		return nil, err
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// storeLocked stores the index into the key-value store.
+func (q *Queue) storeLocked(st *state) error {
+	data, err := json.Marshal(st)
+	runtimex.PanicOnError(err, "json.Marshal unexpectedly failed")
+	return q.kvStore.Set(StateKey, data)
+}
+
+// loadEntryLocked loads the entry with the given UID.
+func (q *Queue) loadEntryLocked(uid string) (*Entry, error) {
+	data, err := q.kvStore.Get(entryKey(uid))
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// storeEntryLocked stores the given entry using its own key.
+func (q *Queue) storeEntryLocked(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	runtimex.PanicOnError(err, "json.Marshal unexpectedly failed")
+	return q.kvStore.Set(entryKey(entry.UID), data)
+}
+
+// entriesLocked loads the entries listed by the given index. We skip the entries
+// we cannot load, which may happen if we crashed while updating the queue.
+func (q *Queue) entriesLocked(st *state) []*Entry {
+	entries := []*Entry{}
+	for _, uid := range st.UIDs {
+		entry, err := q.loadEntryLocked(uid)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// deleteEntriesLocked deletes the entries with the given UIDs. Because we have
+// already removed the entries from the index, failing to delete is harmless.
+func (q *Queue) deleteEntriesLocked(uids ...string) {
+	for _, uid := range uids {
+		_ = q.kvStore.Delete(entryKey(uid))
+	}
+}
+
+// Add adds a measurement we could not submit because of the given error to the
+// queue. Adding a measurement that is already queued does nothing.
+func (q *Queue) Add(m *model.Measurement, reason error) error {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+	st, err := q.loadLocked()
+	if err != nil {
+		return err
+	}
+	uid := MeasurementUID(m)
+	for _, queued := range st.UIDs {
+		if queued == uid {
+			return nil
+		}
+	}
+	data, err := json.Marshal(m)
+	runtimex.PanicOnError(err, "json.Marshal unexpectedly failed")
+	now := q.timeNow()
+	entry := &Entry{
+		UID:         uid,
+		Measurement: data,
+		Attempts:    1,
+		Queued:      now,
+		NextAttempt: now.Add(backoff(1)),
+		LastError:   model.ErrorToStringOrOK(reason),
+	}
+	// note: we store the entry before the index, such that a crash leaves
+	// behind at most an entry that is not listed by the index
+	if err := q.storeEntryLocked(entry); err != nil {
+		return err
+	}
+	st.UIDs = append(st.UIDs, uid)
+	var dropped []string
+	if len(st.UIDs) > MaxEntries {
+		dropped = st.UIDs[:len(st.UIDs)-MaxEntries]
+		st.UIDs = st.UIDs[len(st.UIDs)-MaxEntries:]
+	}
+	st.LastError = entry.LastError
+	if err := q.storeLocked(st); err != nil {
+		return err
+	}
+	q.deleteEntriesLocked(dropped...)
+	return nil
+}
+
+// Entries returns a copy of the queued entries.
+func (q *Queue) Entries() ([]*Entry, error) {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+	st, err := q.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	return q.entriesLocked(st), nil
+}
+
+// Size returns the number of queued measurements.
+func (q *Queue) Size() (int, error) {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+	st, err := q.loadLocked()
+	if err != nil {
+		return 0, err
+	}
+	return len(st.UIDs), nil
+}
+
+// LastError returns the most recent submission error or an empty string.
+func (q *Queue) LastError() (string, error) {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+	st, err := q.loadLocked()
+	if err != nil {
+		return "", err
+	}
+	return st.LastError, nil
+}
+
+// FlushResult contains the result of [*Queue.Flush].
+type FlushResult struct {
+	// Submitted is the number of measurements we submitted.
+	Submitted int
+
+	// Failed is the number of measurements we failed to submit.
+	Failed int
+
+	// Postponed is the number of measurements we did not try to submit
+	// because we have not waited for long enough since the last attempt.
+	Postponed int
+}
+
+// Flush attempts to submit the queued measurements using the given submitter. Unless
+// force is true, we only retry the measurements for which the backoff delay is expired.
+// We remove submitted measurements from the queue and we reschedule the ones that
+// fail using exponential backoff. We stop when the context is done.
+func (q *Queue) Flush(ctx context.Context, submitter model.Submitter, force bool) (*FlushResult, error) {
+	defer q.mu.Unlock()
+	q.mu.Lock()
+	st, err := q.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	result := &FlushResult{}
+	remaining := []string{}
+	submitted := []string{}
+	for _, entry := range q.entriesLocked(st) {
+		if ctx.Err() != nil || (!force && q.timeNow().Before(entry.NextAttempt)) {
+			result.Postponed++
+			remaining = append(remaining, entry.UID)
+			continue
+		}
+		if err := q.submit(ctx, submitter, entry); err != nil {
+			entry.Attempts++
+			entry.NextAttempt = q.timeNow().Add(backoff(entry.Attempts))
+			entry.LastError = err.Error()
+			st.LastError = entry.LastError
+			result.Failed++
+			remaining = append(remaining, entry.UID)
+			if err := q.storeEntryLocked(entry); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		result.Submitted++
+		submitted = append(submitted, entry.UID)
+	}
+	st.UIDs = remaining
+	if err := q.storeLocked(st); err != nil {
+		return nil, err
+	}
+	q.deleteEntriesLocked(submitted...)
+	return result, nil
+}
+
+// submit submits a single queued measurement.
+func (q *Queue) submit(ctx context.Context, submitter model.Submitter, entry *Entry) error {
+	var m model.Measurement
+	if err := json.Unmarshal(entry.Measurement, &m); err != nil {
+		return err
+	}
+	return submitter.Submit(ctx, &m)
+}
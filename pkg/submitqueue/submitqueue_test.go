@@ -0,0 +1,286 @@
+package submitqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/kvstore"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+)
+
+func TestMeasurementUID(t *testing.T) {
+	t.Run("we use the measurement ID when available", func(t *testing.T) {
+		m := &model.Measurement{ID: "antani"}
+		if uid := MeasurementUID(m); uid != "antani" {
+			t.Fatal("unexpected uid", uid)
+		}
+	})
+
+	t.Run("the UID does not depend on the report ID", func(t *testing.T) {
+		m1 := &model.Measurement{Input: "https://www.example.com/", ReportID: "xx"}
+		m2 := &model.Measurement{Input: "https://www.example.com/"}
+		m3 := &model.Measurement{Input: "https://www.example.org/"}
+		if MeasurementUID(m1) != MeasurementUID(m2) {
+			t.Fatal("expected same UID")
+		}
+		if MeasurementUID(m1) == MeasurementUID(m3) {
+			t.Fatal("expected different UID")
+		}
+		if m1.ReportID != "xx" {
+			t.Fatal("should not have modified the original measurement")
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	expect := map[int64]time.Duration{
+		0:   BackoffBase,
+		1:   BackoffBase,
+		2:   2 * BackoffBase,
+		3:   4 * BackoffBase,
+		100: BackoffMax,
+	}
+	for attempts, delay := range expect {
+		if got := backoff(attempts); got != delay {
+			t.Fatal("attempts", attempts, "expected", delay, "got", got)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	t.Run("empty queue", func(t *testing.T) {
+		q := New(&kvstore.Memory{})
+		size, err := q.Size()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != 0 {
+			t.Fatal("expected empty queue")
+		}
+		lastErr, err := q.LastError()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastErr != "" {
+			t.Fatal("expected no error")
+		}
+	})
+
+	t.Run("Add dedupes measurements", func(t *testing.T) {
+		q := New(&kvstore.Memory{})
+		m := &model.Measurement{Input: "https://www.example.com/"}
+		for idx := 0; idx < 3; idx++ {
+			if err := q.Add(m, errors.New("connection_refused")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		size, err := q.Size()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != 1 {
+			t.Fatal("expected a single entry")
+		}
+		lastErr, err := q.LastError()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastErr != "connection_refused" {
+			t.Fatal("unexpected last error", lastErr)
+		}
+	})
+
+	t.Run("Add drops the oldest entries when the queue is full", func(t *testing.T) {
+		q := New(&kvstore.Memory{})
+		for idx := 0; idx < MaxEntries+1; idx++ {
+			m := &model.Measurement{MeasurementRuntime: float64(idx)}
+			if err := q.Add(m, errors.New("generic_timeout_error")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		entries, err := q.Entries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != MaxEntries {
+			t.Fatal("unexpected number of entries", len(entries))
+		}
+		if entries[0].UID != MeasurementUID(&model.Measurement{MeasurementRuntime: 1}) {
+			t.Fatal("we did not drop the oldest entry")
+		}
+	})
+
+	t.Run("Flush honours backoff and removes submitted measurements", func(t *testing.T) {
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		q := New(&kvstore.Memory{})
+		q.timeNow = func() time.Time {
+			return now
+		}
+		m1 := &model.Measurement{Input: "https://www.example.com/"}
+		m2 := &model.Measurement{Input: "https://www.example.org/"}
+		if err := q.Add(m1, errors.New("connection_reset")); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Add(m2, errors.New("connection_reset")); err != nil {
+			t.Fatal(err)
+		}
+
+		submitter := &mocks.Submitter{
+			MockSubmit: func(ctx context.Context, m *model.Measurement) error {
+				if m.Input == "https://www.example.org/" {
+					return errors.New("eof_error")
+				}
+				return nil
+			},
+		}
+
+		// nothing should happen before the backoff expires
+		result, err := q.Flush(context.Background(), submitter, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Postponed != 2 || result.Submitted != 0 || result.Failed != 0 {
+			t.Fatalf("unexpected result %+v", result)
+		}
+
+		// after the backoff expires we should retry
+		now = now.Add(BackoffBase)
+		result, err = q.Flush(context.Background(), submitter, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Postponed != 0 || result.Submitted != 1 || result.Failed != 1 {
+			t.Fatalf("unexpected result %+v", result)
+		}
+		entries, err := q.Entries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Fatal("expected a single entry")
+		}
+		if entries[0].Attempts != 2 || entries[0].LastError != "eof_error" {
+			t.Fatalf("unexpected entry %+v", entries[0])
+		}
+		if !entries[0].NextAttempt.Equal(now.Add(2 * BackoffBase)) {
+			t.Fatal("unexpected next attempt", entries[0].NextAttempt)
+		}
+
+		// forcing should ignore the backoff
+		result, err = q.Flush(context.Background(), submitter, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Postponed != 0 || result.Submitted != 0 || result.Failed != 1 {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	})
+
+	t.Run("Flush postpones everything with a canceled context", func(t *testing.T) {
+		q := New(&kvstore.Memory{})
+		if err := q.Add(&model.Measurement{}, errors.New("connection_reset")); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		submitter := &mocks.Submitter{
+			MockSubmit: func(ctx context.Context, m *model.Measurement) error {
+				panic("should not be called")
+			},
+		}
+		result, err := q.Flush(ctx, submitter, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Postponed != 1 {
+			t.Fatalf("unexpected result %+v", result)
+		}
+	})
+
+	t.Run("we handle key-value store errors", func(t *testing.T) {
+		expected := errors.New("mocked error")
+		q := New(&mocks.KeyValueStore{
+			MockGet: func(key string) ([]byte, error) {
+				return nil, expected
+			},
+		})
+		if err := q.Add(&model.Measurement{}, nil); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if _, err := q.Size(); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if _, err := q.LastError(); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+		if _, err := q.Flush(context.Background(), &mocks.Submitter{}, true); !errors.Is(err, expected) {
+			t.Fatal("unexpected error", err)
+		}
+	})
+
+	t.Run("Add only writes the new entry and the index", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		var written []string
+		q := New(&mocks.KeyValueStore{
+			MockGet: kvs.Get,
+			MockSet: func(key string, value []byte) error {
+				written = append(written, key)
+				return kvs.Set(key, value)
+			},
+		})
+		for idx := 0; idx < 3; idx++ {
+			m := &model.Measurement{MeasurementRuntime: float64(idx)}
+			if err := q.Add(m, errors.New("generic_timeout_error")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		m := &model.Measurement{MeasurementRuntime: 3}
+		written = nil
+		if err := q.Add(m, errors.New("generic_timeout_error")); err != nil {
+			t.Fatal(err)
+		}
+		expect := []string{entryKey(MeasurementUID(m)), StateKey}
+		if diff := cmp.Diff(expect, written); diff != "" {
+			t.Fatal(diff)
+		}
+	})
+
+	t.Run("Flush deletes the submitted entries", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		q := New(kvs)
+		m := &model.Measurement{Input: "https://www.example.com/"}
+		if err := q.Add(m, errors.New("connection_reset")); err != nil {
+			t.Fatal(err)
+		}
+		submitter := &mocks.Submitter{
+			MockSubmit: func(ctx context.Context, m *model.Measurement) error {
+				return nil
+			},
+		}
+		if _, err := q.Flush(context.Background(), submitter, true); err != nil {
+			t.Fatal(err)
+		}
+		keys, err := kvs.List(EntryKeyPrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 0 {
+			t.Fatal("expected no entries", keys)
+		}
+	})
+
+	t.Run("we handle a corrupted state", func(t *testing.T) {
+		kvs := &kvstore.Memory{}
+		if err := kvs.Set(StateKey, []byte("{")); err != nil {
+			t.Fatal(err)
+		}
+		q := New(kvs)
+		if _, err := q.Entries(); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
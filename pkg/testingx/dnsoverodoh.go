@@ -0,0 +1,102 @@
+package testingx
+
+//
+// Oblivious DNS-over-HTTPS target and proxy
+//
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/cloudflare/circl/hpke"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/odoh"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// ODoHTargetHandler is an [http.Handler] implementing an Oblivious DNS-over-HTTPS
+// target. It serves its config at [odoh.ConfigsPath] and answers to encrypted queries
+// sent using POST to any other path. The zero value is invalid; please, use
+// [MustNewODoHTargetHandler] to construct.
+type ODoHTargetHandler struct {
+	// KeyPair is the key pair used by the target.
+	KeyPair *odoh.KeyPair
+
+	// RoundTripper is the round tripper to use.
+	RoundTripper DNSRoundTripper
+}
+
+// MustNewODoHTargetHandler creates a new [*ODoHTargetHandler] with a fresh key pair
+// using X25519, HKDF-SHA256, and AES-128-GCM. This function PANICS on failure.
+func MustNewODoHTargetHandler(rtx DNSRoundTripper) *ODoHTargetHandler {
+	kp := runtimex.Try1(odoh.NewKeyPair(hpke.KEM_X25519_HKDF_SHA256, hpke.KDF_HKDF_SHA256, hpke.AEAD_AES128GCM))
+	return &ODoHTargetHandler{KeyPair: kp, RoundTripper: rtx}
+}
+
+var _ http.Handler = &ODoHTargetHandler{}
+
+// ServeHTTP implements [http.Handler].
+func (p *ODoHTargetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer p.handlePanic(w)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == odoh.ConfigsPath:
+		_, _ = w.Write(odoh.MarshalConfigs(p.KeyPair.Config))
+	case r.Method == http.MethodPost && r.Header.Get("content-type") == odoh.ContentType:
+		rawQuery, rctx := runtimex.Try2(p.KeyPair.DecryptQuery(runtimex.Try1(io.ReadAll(r.Body))))
+		rawResponse := runtimex.Try1(p.RoundTripper.RoundTrip(r.Context(), rawQuery))
+		encryptedResponse := runtimex.Try1(rctx.EncryptResponse(rawResponse))
+		w.Header().Add("content-type", odoh.ContentType)
+		_, _ = w.Write(encryptedResponse)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (p *ODoHTargetHandler) handlePanic(w http.ResponseWriter) {
+	if r := recover(); r != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ODoHProxyHandler is an [http.Handler] implementing an Oblivious DNS-over-HTTPS proxy
+// that forwards POST requests containing the targethost and targetpath query parameters
+// to https://targethost/targetpath and sends back the target response.
+type ODoHProxyHandler struct {
+	// Client is the MANDATORY HTTP client to use to reach the target.
+	Client model.HTTPClient
+}
+
+var _ http.Handler = &ODoHProxyHandler{}
+
+// ServeHTTP implements [http.Handler].
+func (p *ODoHProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer p.handlePanic(w)
+	targetHost, targetPath := r.URL.Query().Get("targethost"), r.URL.Query().Get("targetpath")
+	if r.Method != http.MethodPost || targetHost == "" || targetPath == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	body := runtimex.Try1(io.ReadAll(r.Body))
+	targetURL := &url.URL{Scheme: "https", Host: targetHost, Path: targetPath}
+	req := runtimex.Try1(http.NewRequestWithContext(r.Context(), http.MethodPost, targetURL.String(), bytes.NewReader(body)))
+	req.Header.Set("content-type", odoh.ContentType)
+	req.Header.Set("accept", odoh.ContentType)
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	rawResponse := runtimex.Try1(io.ReadAll(resp.Body))
+	w.Header().Add("content-type", resp.Header.Get("content-type"))
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(rawResponse)
+}
+
+func (p *ODoHProxyHandler) handlePanic(w http.ResponseWriter) {
+	if r := recover(); r != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
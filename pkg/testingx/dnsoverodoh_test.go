@@ -0,0 +1,189 @@
+package testingx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/netem"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/odoh"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+func TestODoHTargetHandler(t *testing.T) {
+	config := netem.NewDNSConfig()
+	config.AddRecord("example.com", "", "93.184.216.34")
+	handler := MustNewODoHTargetHandler(NewDNSRoundTripperWithDNSConfig(config))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	// getConfig fetches the target config.
+	getConfig := func(t *testing.T) *odoh.Config {
+		resp, err := http.Get(srv.URL + odoh.ConfigsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		configs, err := odoh.ParseConfigs(runtimex.Try1(io.ReadAll(resp.Body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return configs[0]
+	}
+
+	t.Run("we can fetch the config", func(t *testing.T) {
+		if !bytes.Equal(getConfig(t).KeyID(), handler.KeyPair.Config.KeyID()) {
+			t.Fatal("unexpected key ID")
+		}
+	})
+
+	t.Run("we can resolve a domain", func(t *testing.T) {
+		query := &dns.Msg{}
+		query.SetQuestion("example.com.", dns.TypeA)
+		encryptedQuery, qctx, err := odoh.EncryptQuery(getConfig(t), runtimex.Try1(query.Pack()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(srv.URL+"/dns-query", odoh.ContentType, bytes.NewReader(encryptedQuery))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 || resp.Header.Get("content-type") != odoh.ContentType {
+			t.Fatal("unexpected response", resp.StatusCode, resp.Header)
+		}
+		rawResponse, err := qctx.DecryptResponse(runtimex.Try1(io.ReadAll(resp.Body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response := &dns.Msg{}
+		if err := response.Unpack(rawResponse); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Answer) != 1 || response.Answer[0].(*dns.A).A.String() != "93.184.216.34" {
+			t.Fatal("unexpected answer", response.Answer)
+		}
+	})
+
+	t.Run("we reject invalid queries", func(t *testing.T) {
+		resp, err := http.Post(srv.URL+"/dns-query", odoh.ContentType, bytes.NewReader([]byte{1, 2, 3}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Fatal("unexpected status code", resp.StatusCode)
+		}
+	})
+
+	t.Run("we reject other requests", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/dns-query")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatal("unexpected status code", resp.StatusCode)
+		}
+	})
+}
+
+func TestODoHProxyHandler(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dns-query" || r.Header.Get("content-type") != odoh.ContentType {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("content-type", odoh.ContentType)
+		_, _ = w.Write(runtimex.Try1(io.ReadAll(r.Body)))
+	}))
+	defer target.Close()
+
+	// newClient returns a client that connects to the target regardless of the address.
+	newClient := func() *http.Client {
+		client := target.Client()
+		txp := client.Transport.(*http.Transport)
+		txp.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, target.Listener.Addr().String())
+		}
+		return client
+	}
+
+	type testconfig struct {
+		name         string
+		client       *http.Client
+		method       string
+		query        string
+		expectStatus int
+		expectBody   []byte
+	}
+
+	testcases := []testconfig{{
+		name:         "successful forwarding",
+		client:       newClient(),
+		method:       http.MethodPost,
+		query:        "?targethost=target.example.com&targetpath=/dns-query",
+		expectStatus: 200,
+		expectBody:   []byte("deadbeef"),
+	}, {
+		name:         "the target returns an error",
+		client:       newClient(),
+		method:       http.MethodPost,
+		query:        "?targethost=target.example.com&targetpath=/invalid",
+		expectStatus: http.StatusBadRequest,
+		expectBody:   []byte{},
+	}, {
+		name: "we cannot connect to the target",
+		client: &http.Client{Transport: &mocks.HTTPTransport{
+			MockRoundTrip: func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("mocked error")
+			},
+		}},
+		method:       http.MethodPost,
+		query:        "?targethost=target.example.com&targetpath=/dns-query",
+		expectStatus: http.StatusBadGateway,
+		expectBody:   []byte{},
+	}, {
+		name:         "missing targethost",
+		client:       newClient(),
+		method:       http.MethodPost,
+		query:        "?targetpath=/dns-query",
+		expectStatus: http.StatusBadRequest,
+		expectBody:   []byte{},
+	}, {
+		name:         "invalid method",
+		client:       newClient(),
+		method:       http.MethodGet,
+		query:        "?targethost=target.example.com&targetpath=/dns-query",
+		expectStatus: http.StatusBadRequest,
+		expectBody:   []byte{},
+	}}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			proxy := httptest.NewServer(&ODoHProxyHandler{Client: tc.client})
+			defer proxy.Close()
+			req := runtimex.Try1(http.NewRequest(tc.method, proxy.URL+"/proxy"+tc.query, bytes.NewReader([]byte("deadbeef"))))
+			req.Header.Set("content-type", odoh.ContentType)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.expectStatus {
+				t.Fatal("unexpected status code", resp.StatusCode)
+			}
+			body := runtimex.Try1(io.ReadAll(resp.Body))
+			if !bytes.Equal(body, tc.expectBody) {
+				t.Fatal("unexpected body", string(body))
+			}
+		})
+	}
+}
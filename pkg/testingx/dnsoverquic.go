@@ -0,0 +1,117 @@
+package testingx
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+	"github.com/quic-go/quic-go"
+)
+
+// DNSOverQUICListener is a DNS-over-QUIC listener. The zero value of this
+// struct is invalid, please use [MustNewDNSOverQUICListener].
+type DNSOverQUICListener struct {
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	listener  *quic.Listener
+	pconn     net.PacketConn
+	rtx       DNSRoundTripper
+	wg        sync.WaitGroup
+}
+
+// MustNewDNSOverQUICListener creates a new [DNSOverQUICListener] using the given
+// [*net.UDPAddr], [DNSOverUDPUnderlyingListener], [*tls.Config], and [DNSRoundTripper].
+//
+// We force the ALPN to be "doq" as required by RFC9250.
+func MustNewDNSOverQUICListener(addr *net.UDPAddr, dul DNSOverUDPUnderlyingListener,
+	tlsConfig *tls.Config, rtx DNSRoundTripper) *DNSOverQUICListener {
+	pconn := runtimex.Try1(dul.ListenUDP("udp", addr))
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{"doq"}
+	listener := runtimex.Try1(quic.Listen(pconn, tlsConfig, &quic.Config{}))
+	ctx, cancel := context.WithCancel(context.Background())
+	dl := &DNSOverQUICListener{
+		cancel:    cancel,
+		closeOnce: sync.Once{},
+		listener:  listener,
+		pconn:     pconn,
+		rtx:       rtx,
+		wg:        sync.WaitGroup{},
+	}
+	dl.wg.Add(1)
+	go dl.mainloop(ctx)
+	return dl
+}
+
+// LocalAddr returns the listener address.
+func (dl *DNSOverQUICListener) LocalAddr() net.Addr {
+	return dl.pconn.LocalAddr()
+}
+
+// Close implements io.Closer.
+func (dl *DNSOverQUICListener) Close() (err error) {
+	dl.closeOnce.Do(func() {
+		// close the listener to interrupt Accept
+		err = dl.listener.Close()
+
+		// quic-go does not close connections it did not create
+		_ = dl.pconn.Close()
+
+		// cancel the context to interrupt the round tripper
+		dl.cancel()
+
+		// wait for the background goroutine to join
+		dl.wg.Wait()
+	})
+	return err
+}
+
+func (dl *DNSOverQUICListener) mainloop(ctx context.Context) {
+	defer dl.wg.Done()
+
+	for {
+		qconn, err := dl.listener.Accept(ctx)
+		if err != nil {
+			return // we've been closed
+		}
+		go dl.handleConn(ctx, qconn)
+	}
+}
+
+func (dl *DNSOverQUICListener) handleConn(ctx context.Context, qconn quic.Connection) {
+	defer runtimex.CatchLogAndIgnorePanic(log.Log, "DNSOverQUICListener.handleConn")
+	for {
+		stream, err := qconn.AcceptStream(ctx)
+		if err != nil {
+			return // the client closed the connection or we've been closed
+		}
+		go dl.handleStream(ctx, stream)
+	}
+}
+
+func (dl *DNSOverQUICListener) handleStream(ctx context.Context, stream quic.Stream) {
+	// RFC9250 Sect. 4.2 says each stream carries a single query and response
+	defer stream.Close()
+
+	// make sure we do not block forever
+	_ = stream.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// read the raw request prefixed by its length
+	rawReq, err := dnsReadLengthPrefixedMessage(stream)
+	if err != nil {
+		return
+	}
+
+	// perform the round trip
+	rawResp, err := dl.rtx.RoundTrip(ctx, rawReq)
+	if err != nil {
+		return
+	}
+
+	// write the raw response prefixed by its length
+	_ = dnsWriteLengthPrefixedMessage(stream, rawResp)
+}
@@ -0,0 +1,125 @@
+package testingx
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/ooni/probe-engine/pkg/runtimex"
+)
+
+// DNSOverTLSListener is a DNS-over-TLS listener. The zero value of this
+// struct is invalid, please use [MustNewDNSOverTLSListener].
+type DNSOverTLSListener struct {
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	listener  net.Listener
+	rtx       DNSRoundTripper
+	wg        sync.WaitGroup
+}
+
+// MustNewDNSOverTLSListener creates a new [DNSOverTLSListener] using the given
+// [*net.TCPAddr], [TCPListener], [*tls.Config], and [DNSRoundTripper].
+//
+// We force the ALPN to be "dot" (see RFC7858 Sect. 3.1 and RFC7301 Sect. 6).
+func MustNewDNSOverTLSListener(
+	addr *net.TCPAddr, tcpListener TCPListener, tlsConfig *tls.Config, rtx DNSRoundTripper) *DNSOverTLSListener {
+	listener := runtimex.Try1(tcpListener.ListenTCP("tcp", addr))
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{"dot"}
+	ctx, cancel := context.WithCancel(context.Background())
+	dl := &DNSOverTLSListener{
+		cancel:    cancel,
+		closeOnce: sync.Once{},
+		listener:  tls.NewListener(listener, tlsConfig),
+		rtx:       rtx,
+		wg:        sync.WaitGroup{},
+	}
+	dl.wg.Add(1)
+	go dl.mainloop(ctx)
+	return dl
+}
+
+// LocalAddr returns the listener address.
+func (dl *DNSOverTLSListener) LocalAddr() net.Addr {
+	return dl.listener.Addr()
+}
+
+// Close implements io.Closer.
+func (dl *DNSOverTLSListener) Close() (err error) {
+	dl.closeOnce.Do(func() {
+		// close the listener to interrupt Accept
+		err = dl.listener.Close()
+
+		// cancel the context to interrupt the round tripper
+		dl.cancel()
+
+		// wait for the background goroutine to join
+		dl.wg.Wait()
+	})
+	return err
+}
+
+func (dl *DNSOverTLSListener) mainloop(ctx context.Context) {
+	defer runtimex.CatchLogAndIgnorePanic(log.Log, "DNSOverTLSListener.mainloop")
+	defer dl.wg.Done()
+
+	for {
+		conn, err := dl.listener.Accept()
+
+		// like TLSServer.mainloop, we use panic to quickly exit on error
+		runtimex.PanicOnError(err, "dl.listener.Accept")
+
+		go dl.handle(ctx, conn)
+	}
+}
+
+func (dl *DNSOverTLSListener) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	for {
+		// make sure we do not block forever
+		_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		// read the raw request prefixed by its length
+		rawReq, err := dnsReadLengthPrefixedMessage(conn)
+		if err != nil {
+			return
+		}
+
+		// perform the round trip
+		rawResp, err := dl.rtx.RoundTrip(ctx, rawReq)
+		if err != nil {
+			return
+		}
+
+		// write the raw response prefixed by its length
+		if err := dnsWriteLengthPrefixedMessage(conn, rawResp); err != nil {
+			return
+		}
+	}
+}
+
+// dnsReadLengthPrefixedMessage reads a DNS message prefixed by its
+// length as specified by RFC1035 Sect. 4.2.2.
+func dnsReadLengthPrefixedMessage(reader io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	message := make([]byte, int(header[0])<<8|int(header[1]))
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// dnsWriteLengthPrefixedMessage is the dual of [dnsReadLengthPrefixedMessage].
+func dnsWriteLengthPrefixedMessage(writer io.Writer, message []byte) error {
+	buf := []byte{byte(len(message) >> 8), byte(len(message))}
+	_, err := writer.Write(append(buf, message...))
+	return err
+}
@@ -0,0 +1,198 @@
+package webconnectivityalgo
+
+//
+// DNS tampering checks
+//
+// The purpose of these checks is figuring out whether a resolver alters the
+// answers for a zone served by the OONI DNS test helper. Because the helper
+// is authoritative for the zone and we query for random subdomains, we know
+// exactly which answer we should receive, regardless of CDNs.
+//
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+	"github.com/ooni/probe-engine/pkg/randx"
+)
+
+// DNSTamperingCheckResult contains the result of [*DNSTamperingChecker.Check].
+type DNSTamperingCheckResult struct {
+	// Domain is the random domain we queried for.
+	Domain string `json:"domain"`
+
+	// Addresses contains the addresses resolved for the domain.
+	Addresses []string `json:"addresses"`
+
+	// ExpectedAddresses contains the addresses served by the DNS test helper.
+	ExpectedAddresses []string `json:"expected_addresses"`
+
+	// Failure is the first failure that occurred resolving the domain, if any.
+	Failure *string `json:"failure"`
+
+	// Resolver is the OPTIONAL address of the resolver that forwarded our
+	// query to the DNS test helper, as echoed by the helper.
+	Resolver string `json:"resolver,omitempty"`
+
+	// EDNSClientSubnet is the OPTIONAL EDNS client subnet that the resolver
+	// forwarded to the DNS test helper, as echoed by the helper.
+	EDNSClientSubnet string `json:"edns_client_subnet,omitempty"`
+
+	// Tampered indicates that the answer differs from the expected one, including
+	// the case where the resolver claims that the domain does not exist.
+	Tampered bool `json:"tampered"`
+}
+
+// DNSTamperingChecker checks whether a resolver alters the answers for a zone
+// served by the OONI DNS test helper (see the oodnshelperd package).
+//
+// The zero value of this struct is invalid. Please, construct using
+// the [NewDNSTamperingChecker] factory function.
+type DNSTamperingChecker struct {
+	// expectedAddrs contains the addresses served by the helper.
+	expectedAddrs []string
+
+	// logger is the logger.
+	logger model.Logger
+
+	// newLabel returns the random label to prepend to the zone.
+	newLabel func() string
+
+	// zone is the zone served by the helper.
+	zone string
+}
+
+// NewDNSTamperingChecker constructs a new [*DNSTamperingChecker] for the given
+// zone, for which the DNS test helper serves the given addresses.
+func NewDNSTamperingChecker(logger model.Logger, zone string, expectedAddrs ...string) *DNSTamperingChecker {
+	return &DNSTamperingChecker{
+		expectedAddrs: expectedAddrs,
+		logger:        logger,
+		newLabel: func() string {
+			return strings.ToLower(randx.Letters(16))
+		},
+		zone: strings.TrimSuffix(zone, "."),
+	}
+}
+
+// Check queries the given transport for a random subdomain of the zone and
+// compares the answer with the one served by the DNS test helper.
+func (c *DNSTamperingChecker) Check(ctx context.Context, txp model.DNSTransport) *DNSTamperingCheckResult {
+	domain := c.newLabel() + "." + c.zone
+	result := &DNSTamperingCheckResult{
+		Domain:            domain,
+		Addresses:         []string{},
+		ExpectedAddresses: c.expectedAddrs,
+	}
+
+	// resolve the domain for each address family served by the helper and compare
+	// each family with the expected addresses, such that we support helpers serving
+	// only IPv4 addresses, only IPv6 addresses, or both
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		expected := dnsTamperingFilterAddresses(c.expectedAddrs, qtype)
+		if len(expected) <= 0 {
+			continue
+		}
+		addrs, err := c.lookupHost(ctx, txp, domain, qtype)
+		if err != nil {
+			failure := err.Error()
+			if result.Failure == nil {
+				result.Failure = &failure
+			}
+
+			// the helper serves any name inside the zone, so claiming that the
+			// name does not exist or has no addresses is a form of tampering
+			if failure == netxlite.FailureDNSNXDOMAINError || failure == netxlite.FailureDNSNoAnswer {
+				result.Tampered = true
+			}
+			continue
+		}
+		result.Addresses = append(result.Addresses, addrs...)
+		if !dnsTamperingSameAddresses(addrs, expected) {
+			result.Tampered = true
+		}
+	}
+
+	// learn about the resolver forwarding our queries
+	for key, value := range c.lookupEcho(ctx, txp, domain) {
+		switch key {
+		case "resolver":
+			result.Resolver = value
+		case "edns_client_subnet":
+			result.EDNSClientSubnet = value
+		}
+	}
+
+	c.logger.Infof("dns tampering check: %s via %s: tampered=%v", domain, txp.Address(), result.Tampered)
+	return result
+}
+
+// lookupHost performs an A or AAAA lookup for the given domain using the given transport.
+func (c *DNSTamperingChecker) lookupHost(
+	ctx context.Context, txp model.DNSTransport, domain string, qtype uint16) ([]string, error) {
+	encoder := &netxlite.DNSEncoderMiekg{}
+	resp, err := txp.RoundTrip(ctx, encoder.Encode(domain, qtype, txp.RequiresPadding()))
+	if err != nil {
+		return nil, netxlite.NewTopLevelGenericErrWrapper(err)
+	}
+	return resp.DecodeLookupHost()
+}
+
+// lookupEcho performs a TXT lookup for the given domain using the given transport and
+// returns the key-value pairs echoed by the helper or an empty map on failure.
+func (c *DNSTamperingChecker) lookupEcho(ctx context.Context, txp model.DNSTransport, domain string) map[string]string {
+	out := map[string]string{}
+	encoder := &netxlite.DNSEncoderMiekg{}
+	resp, err := txp.RoundTrip(ctx, encoder.Encode(domain, dns.TypeTXT, txp.RequiresPadding()))
+	if err != nil {
+		return out
+	}
+	msg := &dns.Msg{}
+	if err := msg.Unpack(resp.Bytes()); err != nil {
+		return out
+	}
+	for _, answer := range msg.Answer {
+		txt, ok := answer.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		for _, entry := range txt.Txt {
+			if key, value, found := strings.Cut(entry, "="); found {
+				out[key] = value
+			}
+		}
+	}
+	return out
+}
+
+// dnsTamperingFilterAddresses returns the addresses we expect in the answer to
+// a query of the given type, i.e., IPv4 addresses for A and IPv6 for AAAA.
+func dnsTamperingFilterAddresses(addrs []string, qtype uint16) (out []string) {
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		switch {
+		case ip == nil:
+			continue
+		case qtype == dns.TypeA && ip.To4() != nil:
+			out = append(out, ip.String())
+		case qtype == dns.TypeAAAA && ip.To4() == nil:
+			out = append(out, ip.String())
+		}
+	}
+	return
+}
+
+// dnsTamperingSameAddresses returns whether the two lists contain the same addresses.
+func dnsTamperingSameAddresses(left, right []string) bool {
+	normalize := func(addrs []string) string {
+		addrs = append([]string{}, addrs...)
+		sort.Strings(addrs)
+		return strings.Join(addrs, ",")
+	}
+	return normalize(left) == normalize(right)
+}
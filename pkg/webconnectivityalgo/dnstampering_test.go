@@ -0,0 +1,183 @@
+package webconnectivityalgo
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/google/go-cmp/cmp"
+	"github.com/ooni/probe-engine/pkg/mocks"
+	"github.com/ooni/probe-engine/pkg/model"
+	"github.com/ooni/probe-engine/pkg/netemx"
+	"github.com/ooni/probe-engine/pkg/netxlite"
+)
+
+func TestDNSTamperingChecker(t *testing.T) {
+	// testcase is a test case defined by this function
+	type testcase struct {
+		// name is the test case name
+		name string
+
+		// resolver is the address of the resolver to query
+		resolver string
+
+		// helperAddrs OPTIONALLY contains the addresses served by the
+		// helper, which by default serves its own IPv4 address
+		helperAddrs []string
+
+		// configure OPTIONALLY configures the environment
+		configure func(env *netemx.QAEnv)
+
+		// expect contains the expected result
+		expect *DNSTamperingCheckResult
+	}
+
+	const (
+		zone   = "dns.th.ooni.org"
+		domain = "xyzzy.dns.th.ooni.org"
+		ipv6   = "2001:db8::1"
+	)
+
+	cases := []testcase{{
+		name:      "when directly querying the DNS test helper",
+		resolver:  netemx.AddressDNSTHOONIOrg,
+		configure: func(env *netemx.QAEnv) {},
+		expect: &DNSTamperingCheckResult{
+			Domain:            domain,
+			Addresses:         []string{netemx.AddressDNSTHOONIOrg},
+			ExpectedAddresses: []string{netemx.AddressDNSTHOONIOrg},
+			Failure:           nil,
+			Resolver:          netemx.DefaultClientAddress,
+			Tampered:          false,
+		},
+	}, {
+		name:     "when the resolver returns a different address",
+		resolver: netemx.ISPResolverAddress,
+		configure: func(env *netemx.QAEnv) {
+			env.ISPResolverConfig().AddRecord(domain, "", "10.10.34.35")
+		},
+		expect: &DNSTamperingCheckResult{
+			Domain:            domain,
+			Addresses:         []string{"10.10.34.35"},
+			ExpectedAddresses: []string{netemx.AddressDNSTHOONIOrg},
+			Failure:           nil,
+			Tampered:          true,
+		},
+	}, {
+		name:      "when the resolver claims the domain does not exist",
+		resolver:  netemx.ISPResolverAddress,
+		configure: func(env *netemx.QAEnv) {},
+		expect: &DNSTamperingCheckResult{
+			Domain:            domain,
+			Addresses:         []string{},
+			ExpectedAddresses: []string{netemx.AddressDNSTHOONIOrg},
+			Failure: (func() *string {
+				s := netxlite.FailureDNSNXDOMAINError
+				return &s
+			})(),
+			Tampered: true,
+		},
+	}, {
+		name:        "when directly querying a dual-stack DNS test helper",
+		resolver:    netemx.AddressDNSTHOONIOrg,
+		helperAddrs: []string{netemx.AddressDNSTHOONIOrg, ipv6},
+		configure:   func(env *netemx.QAEnv) {},
+		expect: &DNSTamperingCheckResult{
+			Domain:            domain,
+			Addresses:         []string{netemx.AddressDNSTHOONIOrg, ipv6},
+			ExpectedAddresses: []string{netemx.AddressDNSTHOONIOrg, ipv6},
+			Failure:           nil,
+			Resolver:          netemx.DefaultClientAddress,
+			Tampered:          false,
+		},
+	}, {
+		name:        "when directly querying an IPv6-only DNS test helper",
+		resolver:    netemx.AddressDNSTHOONIOrg,
+		helperAddrs: []string{ipv6},
+		configure:   func(env *netemx.QAEnv) {},
+		expect: &DNSTamperingCheckResult{
+			Domain:            domain,
+			Addresses:         []string{ipv6},
+			ExpectedAddresses: []string{ipv6},
+			Failure:           nil,
+			Resolver:          netemx.DefaultClientAddress,
+			Tampered:          false,
+		},
+	}, {
+		name:        "when the resolver only returns the IPv4 address of a dual-stack helper",
+		resolver:    netemx.ISPResolverAddress,
+		helperAddrs: []string{netemx.AddressDNSTHOONIOrg, ipv6},
+		configure: func(env *netemx.QAEnv) {
+			env.ISPResolverConfig().AddRecord(domain, "", netemx.AddressDNSTHOONIOrg)
+		},
+		expect: &DNSTamperingCheckResult{
+			Domain:            domain,
+			Addresses:         []string{netemx.AddressDNSTHOONIOrg},
+			ExpectedAddresses: []string{netemx.AddressDNSTHOONIOrg, ipv6},
+			Failure: (func() *string {
+				s := netxlite.FailureDNSNoAnswer
+				return &s
+			})(),
+			Tampered: true,
+		},
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			helperAddrs := tc.helperAddrs
+			if len(helperAddrs) <= 0 {
+				helperAddrs = []string{netemx.AddressDNSTHOONIOrg}
+			}
+
+			// create testing scenario
+			env := netemx.MustNewQAEnv(netemx.QAEnvOptionNetStack(
+				netemx.AddressDNSTHOONIOrg,
+				&netemx.OODNSHelperDFactory{
+					Addresses: helperAddrs,
+					Zone:      zone,
+				},
+			))
+			defer env.Close()
+			tc.configure(env)
+
+			// create the checker using a fixed label
+			checker := NewDNSTamperingChecker(log.Log, zone, helperAddrs...)
+			checker.newLabel = func() string {
+				return "xyzzy"
+			}
+
+			env.Do(func() {
+				netx := &netxlite.Netx{}
+				dialer := netx.NewDialerWithoutResolver(log.Log)
+				txp := netxlite.NewDNSOverUDPTransport(dialer, net.JoinHostPort(tc.resolver, "53"))
+				result := checker.Check(context.Background(), txp)
+				if diff := cmp.Diff(tc.expect, result); diff != "" {
+					t.Fatal(diff)
+				}
+			})
+		})
+	}
+
+	t.Run("when the lookup fails for other reasons", func(t *testing.T) {
+		checker := NewDNSTamperingChecker(model.DiscardLogger, zone+".", netemx.AddressDNSTHOONIOrg)
+		txp := &mocks.DNSTransport{
+			MockRoundTrip: func(ctx context.Context, query model.DNSQuery) (model.DNSResponse, error) {
+				return nil, context.DeadlineExceeded
+			},
+			MockRequiresPadding: func() bool {
+				return false
+			},
+			MockAddress: func() string {
+				return "8.8.8.8:53"
+			},
+		}
+		result := checker.Check(context.Background(), txp)
+		if result.Failure == nil || *result.Failure != netxlite.FailureGenericTimeoutError {
+			t.Fatal("unexpected failure", result.Failure)
+		}
+		if result.Tampered {
+			t.Fatal("a timeout is not evidence of tampering")
+		}
+	})
+}